@@ -333,6 +333,7 @@ func TrustedAssetsUpdateObserverForModel(model *asserts.Model) (*TrustedAssetsUp
 
 	return &TrustedAssetsUpdateObserver{
 		cache: newTrustedAssetsCache(dirs.SnapBootAssetsDir),
+		model: model,
 	}, nil
 }
 
@@ -340,6 +341,7 @@ func TrustedAssetsUpdateObserverForModel(model *asserts.Model) (*TrustedAssetsUp
 // attempts to reseal when needed.
 type TrustedAssetsUpdateObserver struct {
 	cache *trustedAssetsCache
+	model *asserts.Model
 
 	bootBootloader    bootloader.Bootloader
 	bootTrustedAssets []string
@@ -569,7 +571,20 @@ func (o *TrustedAssetsUpdateObserver) observeRollback(bl bootloader.Bootloader,
 }
 
 // BeforeWrite is called when the update process has been staged for execution.
+// The update is aborted if the boot chains for resealing the encryption keys
+// cannot be computed with the updated boot assets.
 func (o *TrustedAssetsUpdateObserver) BeforeWrite() error {
+	if o.modeenv == nil {
+		// modeenv wasn't even loaded yet, meaning none of the trusted
+		// boot assets was updated
+		return nil
+	}
+	if !hasSealedKeys() {
+		return nil
+	}
+	if _, _, err := predictedSealKeyModelParams(o.model, o.modeenv); err != nil {
+		return fmt.Errorf("cannot compute boot chains with updated boot assets: %v", err)
+	}
 	// TODO:UC20:
 	// - reseal with a given state of modeenv
 	return nil
@@ -724,6 +724,63 @@ func (s *assetsSuite) TestUpdateObserverUpdateMocked(c *C) {
 	})
 }
 
+func (s *assetsSuite) TestUpdateObserverBeforeWriteBootChains(c *C) {
+	d := c.MkDir()
+	root := c.MkDir()
+
+	data := []byte("foobar")
+	// SHA3-384
+	dataHash := "0fa8abfbdaf924ad307b74dd2ed183b9a4a398891a2f6bac8fd2db7041b77f068580f9c6c66f699b496c2da1cbcc7ed8"
+	err := ioutil.WriteFile(filepath.Join(d, "foobar"), data, 0644)
+	c.Assert(err, IsNil)
+
+	m := boot.Modeenv{
+		Mode:           "run",
+		CurrentKernels: []string{"pc-kernel_500.snap"},
+		CurrentTrustedBootAssets: boot.BootAssetsMap{
+			"asset": {dataHash},
+		},
+		CurrentTrustedRecoveryBootAssets: boot.BootAssetsMap{
+			"shim": {"shim-hash"},
+		},
+	}
+	err = m.WriteTo("")
+	c.Assert(err, IsNil)
+
+	tab := s.bootloaderWithTrustedAssets(c, []string{"asset"})
+	tab.BootChainList = []bootloader.BootFile{
+		bootloader.NewBootFile("", "shim", bootloader.RoleRecovery),
+		bootloader.NewBootFile("", "asset", bootloader.RoleRunMode),
+		bootloader.NewBootFile("pc-kernel_500.snap", "kernel.efi", bootloader.RoleRunMode),
+	}
+
+	obs := s.uc20UpdateObserver(c)
+	_, err = obs.Observe(gadget.ContentUpdate, mockRunBootStruct, root, "asset",
+		&gadget.ContentChange{After: filepath.Join(d, "foobar")})
+	c.Assert(err, IsNil)
+
+	// keys are not sealed
+	err = obs.BeforeWrite()
+	c.Assert(err, IsNil)
+	c.Check(tab.BootChainKernelPath, HasLen, 0)
+
+	sealedKey := filepath.Join(boot.InitramfsEncryptionKeyDir, "ubuntu-data.sealed-key")
+	c.Assert(os.MkdirAll(filepath.Dir(sealedKey), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(sealedKey, nil, 0600), IsNil)
+
+	// the recovery asset is not in the cache
+	err = obs.BeforeWrite()
+	c.Assert(err, ErrorMatches, `cannot compute boot chains with updated boot assets: cannot build load chains with current boot assets: file .*/trusted/shim-shim-hash not found in boot assets cache`)
+	c.Check(tab.BootChainKernelPath, DeepEquals, []string{
+		filepath.Join(dirs.SnapBlobDir, "pc-kernel_500.snap"),
+	})
+
+	err = ioutil.WriteFile(filepath.Join(dirs.SnapBootAssetsDir, "trusted", "shim-shim-hash"), nil, 0644)
+	c.Assert(err, IsNil)
+	err = obs.BeforeWrite()
+	c.Assert(err, IsNil)
+}
+
 func (s *assetsSuite) TestUpdateObserverUpdateExistingAssetMocked(c *C) {
 	d := c.MkDir()
 	root := c.MkDir()
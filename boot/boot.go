@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/snap"
 )
@@ -91,6 +92,21 @@ type Device interface {
 	HasModeenv() bool
 }
 
+// modelDevice is implemented by devices that can provide their model, which
+// is needed to reseal the encryption keys.
+type modelDevice interface {
+	Model() *asserts.Model
+}
+
+// deviceModel returns the model of the device or nil if it cannot provide
+// one.
+func deviceModel(dev Device) *asserts.Model {
+	if md, ok := dev.(modelDevice); ok {
+		return md.Model()
+	}
+	return nil
+}
+
 // Participant figures out what the BootParticipant is for the given
 // arguments, and returns it. If the snap does _not_ participate in
 // the boot process, the returned object will be a NOP, so it's safe
@@ -337,11 +353,15 @@ func MarkBootSuccessful(dev Device) error {
 	}
 
 	if dev.HasModeenv() {
-		b := trustedAssetsBootState()
-		var err error
-		u, err = b.markSuccessful(u)
-		if err != nil {
-			return fmt.Errorf(errPrefix, err)
+		for _, b := range []successfulBootState{
+			trustedAssetsBootState(),
+			commandLineBootState(deviceModel(dev)),
+		} {
+			var err error
+			u, err = b.markSuccessful(u)
+			if err != nil {
+				return fmt.Errorf(errPrefix, err)
+			}
 		}
 	}
 
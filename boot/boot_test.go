@@ -1395,6 +1395,50 @@ func (s *bootenv20Suite) TestMarkBootSuccessful20BaseUpdate(c *C) {
 	c.Assert(m3.BaseStatus, Equals, "")
 }
 
+func (s *bootenv20Suite) TestMarkBootSuccessful20CommandLineUpdated(c *C) {
+	// the extra kernel command line arguments were changed
+	m := &boot.Modeenv{
+		Mode:           "run",
+		Base:           s.base1.Filename(),
+		CurrentKernels: []string{s.kern1.Filename()},
+		CurrentKernelCommandLines: boot.BootCommandLines{
+			"snapd_recovery_mode=run panic=-1",
+			"snapd_recovery_mode=run panic=-1 isolcpus=1",
+		},
+	}
+	r := setupUC20Bootenv(
+		c,
+		s.bootloader,
+		&bootenv20Setup{
+			modeenv:    m,
+			kern:       s.kern1,
+			kernStatus: boot.DefaultStatus,
+		},
+	)
+	defer r()
+
+	mockProcCmdline := filepath.Join(c.MkDir(), "cmdline")
+	s.AddCleanup(boot.MockProcCmdline(mockProcCmdline))
+
+	coreDev := boottest.MockUC20Device("some-snap")
+
+	// booted with an unexpected command line
+	c.Assert(ioutil.WriteFile(mockProcCmdline, []byte("snapd_recovery_mode=run debug\n"), 0644), IsNil)
+	err := boot.MarkBootSuccessful(coreDev)
+	c.Assert(err, IsNil)
+	m2, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(m2.CurrentKernelCommandLines, DeepEquals, m.CurrentKernelCommandLines)
+
+	// booted with the new command line
+	c.Assert(ioutil.WriteFile(mockProcCmdline, []byte("snapd_recovery_mode=run panic=-1 isolcpus=1\n"), 0644), IsNil)
+	err = boot.MarkBootSuccessful(coreDev)
+	c.Assert(err, IsNil)
+	m3, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(m3.CurrentKernelCommandLines, HasLen, 0)
+}
+
 func (s *bootenv20Suite) bootloaderWithTrustedAssets(c *C, trustedAssets []string) *bootloadertest.MockTrustedAssetsBootloader {
 	tab := bootloadertest.Mock("trusted", "").WithTrustedAssets()
 	bootloader.Force(tab)
@@ -23,6 +23,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sort"
 
@@ -264,3 +266,64 @@ func bootAssetsToLoadChains(assets []bootAsset, kernelBootFile bootloader.BootFi
 	}
 	return chains, nil
 }
+
+// bootFilesToLoadChain generates a load chain out of a sequence of boot files
+// reported by the bootloader. Boot files which do not come from a snap are
+// located relative to the root directory of the bootloader with their role.
+func bootFilesToLoadChain(bootFiles []bootloader.BootFile, roleToRootDir map[bootloader.Role]string) (*secboot.LoadChain, error) {
+	var chain *secboot.LoadChain
+	for i := len(bootFiles) - 1; i >= 0; i-- {
+		bf := bootFiles[i]
+		if bf.Snap == "" {
+			rootDir := roleToRootDir[bf.Role]
+			if rootDir == "" {
+				return nil, fmt.Errorf("internal error: no root directory for boot file role %q", bf.Role)
+			}
+			bf = bf.WithPath(filepath.Join(rootDir, bf.Path))
+		}
+		if chain == nil {
+			chain = secboot.NewLoadChain(bf)
+		} else {
+			chain = secboot.NewLoadChain(bf, chain)
+		}
+	}
+	if chain == nil {
+		return nil, fmt.Errorf("internal error: empty boot chain")
+	}
+	return chain, nil
+}
+
+// bootChainsFileUnder returns the path of the file where the boot chains the
+// encryption keys were last sealed with are stored.
+func bootChainsFileUnder(rootdir string) string {
+	return filepath.Join(dirs.SnapFDEDirUnder(rootdir), "boot-chains")
+}
+
+// readBootChains reads the boot chains from a given file. It returns nil boot
+// chains when the file does not exist.
+func readBootChains(path string) (predictableBootChains, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot open existing boot chains data file: %v", err)
+	}
+	var pbc predictableBootChains
+	if err := json.Unmarshal(content, &pbc); err != nil {
+		return nil, fmt.Errorf("cannot read boot chains data: %v", err)
+	}
+	return pbc, nil
+}
+
+// writeBootChains writes the boot chains to a given file.
+func writeBootChains(pbc predictableBootChains, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("cannot create device fde state directory: %v", err)
+	}
+	content, err := json.Marshal(pbc)
+	if err != nil {
+		return fmt.Errorf("cannot marshal boot chains: %v", err)
+	}
+	return osutil.AtomicWriteFile(path, content, 0600, 0)
+}
@@ -1220,3 +1220,40 @@ func (s *bootchainSuite) TestBootAssetsToLoadChainWithAlternativeChains(c *C) {
 	}
 	c.Check(chains, DeepEquals, expected)
 }
+
+func (s *bootchainSuite) TestReadWriteBootChains(c *C) {
+	p := boot.BootChainsFileUnder(s.rootDir)
+	c.Check(p, Equals, filepath.Join(s.rootDir, "var/lib/snapd/device/fde/boot-chains"))
+
+	// no file yet
+	pbc, err := boot.ReadBootChains(p)
+	c.Assert(err, IsNil)
+	c.Check(pbc, IsNil)
+
+	pbc = boot.ToPredictableBootChains([]boot.BootChain{
+		{
+			BrandID:        "mybrand",
+			Model:          "foo",
+			Grade:          "dangerous",
+			ModelSignKeyID: "my-key-id",
+			AssetChain: []boot.BootAsset{
+				{Role: bootloader.RoleRecovery, Name: "shim", Hashes: []string{"x", "y"}},
+			},
+			Kernel:         "pc-kernel",
+			KernelRevision: "1234",
+			KernelCmdlines: []string{"snapd_recovery_mode=run foo"},
+		},
+	})
+	err = boot.WriteBootChains(pbc, p)
+	c.Assert(err, IsNil)
+	c.Check(p, testutil.FileEquals, `[{"brand-id":"mybrand","model":"foo","grade":"dangerous","model-sign-key-id":"my-key-id","asset-chain":[{"role":"recovery","name":"shim","hashes":["x","y"]}],"kernel":"pc-kernel","kernel-revision":"1234","kernel-cmdlines":["snapd_recovery_mode=run foo"]}]`)
+
+	read, err := boot.ReadBootChains(p)
+	c.Assert(err, IsNil)
+	c.Check(read, DeepEquals, pbc)
+
+	err = ioutil.WriteFile(p, []byte("garbage"), 0600)
+	c.Assert(err, IsNil)
+	_, err = boot.ReadBootChains(p)
+	c.Assert(err, ErrorMatches, "cannot read boot chains data: .*")
+}
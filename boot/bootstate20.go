@@ -21,8 +21,11 @@ package boot
 
 import (
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
+	"strings"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
@@ -683,3 +686,54 @@ func (ba20 *bootState20BootAssets) markSuccessful(update bootStateUpdate) (bootS
 func trustedAssetsBootState() *bootState20BootAssets {
 	return &bootState20BootAssets{}
 }
+
+// bootState20CommandLine implements the successfulBootState interface for the
+// kernel command line on UC20.
+type bootState20CommandLine struct {
+	model *asserts.Model
+}
+
+func (bcl20 *bootState20CommandLine) markSuccessful(update bootStateUpdate) (bootStateUpdate, error) {
+	u20, err := toBootStateUpdate20(update)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u20.modeenv.CurrentKernelCommandLines) == 0 {
+		// no change of the command line pending
+		return update, nil
+	}
+
+	content, err := ioutil.ReadFile(procCmdline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kernel command line: %v", err)
+	}
+	cmdline := strings.TrimSpace(string(content))
+	pending := u20.modeenv.CurrentKernelCommandLines
+	if cmdline != pending[len(pending)-1] {
+		// booted with the previous or an unexpected command line,
+		// the new one was not observed yet, keep the pending ones
+		// around
+		return u20, nil
+	}
+	// the command line the system booted with is the one composed from
+	// the current boot configuration
+	u20.writeModeenv.CurrentKernelCommandLines = nil
+
+	if !hasSealedKeys() {
+		return u20, nil
+	}
+	if bcl20.model == nil {
+		return nil, fmt.Errorf("internal error: cannot reseal the encryption key without a model")
+	}
+	// the encryption key no longer needs to be unsealed with the
+	// previous command line
+	u20.postModeenv(func() error {
+		return resealKeyToModeenv(bcl20.model, u20.writeModeenv)
+	})
+	return u20, nil
+}
+
+func commandLineBootState(model *asserts.Model) *bootState20CommandLine {
+	return &bootState20CommandLine{model: model}
+}
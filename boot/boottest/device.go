@@ -22,6 +22,7 @@ package boottest
 import (
 	"strings"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/boot"
 )
 
@@ -29,6 +30,7 @@ type mockDevice struct {
 	bootSnap string
 	mode     string
 	uc20     bool
+	model    *asserts.Model
 }
 
 // MockDevice implements boot.Device. It wraps a string like
@@ -50,6 +52,13 @@ func MockUC20Device(s string) boot.Device {
 	return m
 }
 
+// MockUC20DeviceWithModel is like MockUC20Device, with the given model.
+func MockUC20DeviceWithModel(s string, model *asserts.Model) boot.Device {
+	m := MockUC20Device(s).(*mockDevice)
+	m.model = model
+	return m
+}
+
 func snapAndMode(str string) (snap, mode string) {
 	parts := strings.SplitN(string(str), "@", 2)
 	if len(parts) == 1 || parts[1] == "" {
@@ -63,3 +72,5 @@ func (d *mockDevice) Base() string     { return d.bootSnap }
 func (d *mockDevice) Classic() bool    { return d.bootSnap == "" }
 func (d *mockDevice) RunMode() bool    { return d.mode == "run" }
 func (d *mockDevice) HasModeenv() bool { return d.uc20 }
+
+func (d *mockDevice) Model() *asserts.Model { return d.model }
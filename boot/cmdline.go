@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 
 	"github.com/snapcore/snapd/asserts"
@@ -42,13 +43,17 @@ const (
 	// ModeRecover is a mode in which the device boots into the recovery
 	// system.
 	ModeRecover = "recover"
+	// ModeFactoryReset is a mode in which the device boots into the
+	// recovery system and recreates ubuntu-data, while keeping the device
+	// identity.
+	ModeFactoryReset = "factory-reset"
 )
 
 var (
 	// the kernel commandline - can be overridden in tests
 	procCmdline = "/proc/cmdline"
 
-	validModes = []string{ModeInstall, ModeRecover, ModeRun}
+	validModes = []string{ModeInstall, ModeRecover, ModeFactoryReset, ModeRun}
 )
 
 func whichModeAndRecoverySystem(cmdline []byte) (mode string, sysLabel string, err error) {
@@ -84,6 +89,8 @@ func whichModeAndRecoverySystem(cmdline []byte) (mode string, sysLabel string, e
 		return "", "", fmt.Errorf("cannot detect mode nor recovery system to use")
 	case mode == ModeInstall && sysLabel == "":
 		return "", "", fmt.Errorf("cannot specify install mode without system label")
+	case mode == ModeFactoryReset && sysLabel == "":
+		return "", "", fmt.Errorf("cannot specify factory-reset mode without system label")
 	case mode == ModeRun && sysLabel != "":
 		// XXX: should we silently ignore the label? at least log for now
 		logger.Noticef(`ignoring recovery system label %q in "run" mode`, sysLabel)
@@ -136,7 +143,7 @@ func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, syst
 	if model.Grade() == asserts.ModelGradeUnset {
 		return "", nil
 	}
-	if mode != ModeRun && mode != ModeRecover {
+	if mode != ModeRun && mode != ModeRecover && mode != ModeFactoryReset {
 		return "", fmt.Errorf("internal error: unsupported command line mode %q", mode)
 	}
 	// get the run mode bootloader under the native run partition layout
@@ -147,12 +154,12 @@ func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, syst
 	bootloaderRootDir := InitramfsUbuntuBootDir
 	modeArg := "snapd_recovery_mode=run"
 	systemArg := ""
-	if mode == ModeRecover {
+	if mode == ModeRecover || mode == ModeFactoryReset {
 		// dealing with recovery system bootloader
 		opts.Role = bootloader.RoleRecovery
 		bootloaderRootDir = InitramfsUbuntuSeedDir
 		// recovery mode & system command line arguments
-		modeArg = "snapd_recovery_mode=recover"
+		modeArg = "snapd_recovery_mode=" + mode
 		systemArg = fmt.Sprintf("snapd_recovery_system=%v", system)
 	}
 	mbl, err := getBootloaderManagingItsAssets(bootloaderRootDir, opts)
@@ -162,8 +169,13 @@ func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, syst
 		}
 		return "", err
 	}
-	// TODO:UC20: fetch extra args from gadget
 	extraArgs := ""
+	if mode == ModeRun {
+		extraArgs, err = extraKernelCommandLine(mbl)
+		if err != nil {
+			return "", err
+		}
+	}
 	if currentOrCandidate == currentEdition {
 		return mbl.CommandLine(modeArg, systemArg, extraArgs)
 	} else {
@@ -177,6 +189,12 @@ func ComposeRecoveryCommandLine(model *asserts.Model, system string) (string, er
 	return composeCommandLine(model, currentEdition, ModeRecover, system)
 }
 
+// ComposeFactoryResetCommandLine composes the kernel command line used when
+// booting a given system in factory-reset mode.
+func ComposeFactoryResetCommandLine(model *asserts.Model, system string) (string, error) {
+	return composeCommandLine(model, currentEdition, ModeFactoryReset, system)
+}
+
 // ComposeCommandLine composes the kernel command line used when booting the
 // system in run mode.
 func ComposeCommandLine(model *asserts.Model) (string, error) {
@@ -191,3 +209,75 @@ func ComposeCommandLine(model *asserts.Model) (string, error) {
 func ComposeCandidateCommandLine(model *asserts.Model) (string, error) {
 	return composeCommandLine(model, candidateEdition, ModeRun, "")
 }
+
+// extraKernelCommandLine returns the extra arguments of the run mode kernel
+// command line set in the bootloader environment.
+func extraKernelCommandLine(mbl bootloader.ManagedAssetsBootloader) (string, error) {
+	m, err := mbl.GetBootVars("snapd_extra_cmdline_args")
+	if err != nil {
+		if os.IsNotExist(err) {
+			// no environment yet
+			return "", nil
+		}
+		return "", fmt.Errorf("cannot read extra kernel command line arguments: %v", err)
+	}
+	return m["snapd_extra_cmdline_args"], nil
+}
+
+// SetExtraKernelCommandLine sets the arguments appended to the kernel command
+// line of the run mode system. The new command line is recorded in the modeenv
+// and the encryption keys are resealed so that they can be unsealed when
+// booting with either the current or the new command line. It returns true if
+// the command line changed and a reboot is required for it to take effect.
+func SetExtraKernelCommandLine(model *asserts.Model, extraArgs string) (rebootRequired bool, err error) {
+	if model.Grade() == asserts.ModelGradeUnset {
+		return false, fmt.Errorf("cannot set kernel command line on a system without managed boot config")
+	}
+	opts := &bootloader.Options{
+		Role:        bootloader.RoleRunMode,
+		NoSlashBoot: true,
+	}
+	mbl, err := getBootloaderManagingItsAssets(InitramfsUbuntuBootDir, opts)
+	if err != nil {
+		if err == errBootConfigNotManaged {
+			return false, fmt.Errorf("cannot set kernel command line on a system without managed boot config")
+		}
+		return false, err
+	}
+	currentArgs, err := extraKernelCommandLine(mbl)
+	if err != nil {
+		return false, err
+	}
+	if currentArgs == extraArgs {
+		return false, nil
+	}
+
+	const modeArg = "snapd_recovery_mode=run"
+	currentCmdline, err := mbl.CommandLine(modeArg, "", currentArgs)
+	if err != nil {
+		return false, err
+	}
+	newCmdline, err := mbl.CommandLine(modeArg, "", extraArgs)
+	if err != nil {
+		return false, err
+	}
+
+	modeenv, err := loadModeenv()
+	if err != nil {
+		return false, err
+	}
+	// the system may still boot with the current command line, until the
+	// new one is observed on a successful boot
+	modeenv.CurrentKernelCommandLines = bootCommandLines{currentCmdline, newCmdline}
+	if err := modeenv.Write(); err != nil {
+		return false, err
+	}
+	if err := resealKeyToModeenv(model, modeenv); err != nil {
+		return false, err
+	}
+
+	if err := mbl.SetBootVars(map[string]string{"snapd_extra_cmdline_args": extraArgs}); err != nil {
+		return false, fmt.Errorf("cannot set extra kernel command line arguments: %v", err)
+	}
+	return true, nil
+}
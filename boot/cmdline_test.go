@@ -75,6 +75,10 @@ func (s *kernelCommandLineSuite) TestModeAndLabel(c *C) {
 	}, {
 		cmd:  "snapd_recovery_mode=run snapd_recovery_system=1234",
 		mode: boot.ModeRun,
+	}, {
+		cmd:   "snapd_recovery_mode=factory-reset snapd_recovery_system=1234",
+		mode:  boot.ModeFactoryReset,
+		label: "1234",
 	}, {
 		cmd: "option=1 other-option=\0123 none",
 		err: "cannot detect mode nor recovery system to use",
@@ -85,6 +89,9 @@ func (s *kernelCommandLineSuite) TestModeAndLabel(c *C) {
 		// no recovery system label
 		cmd: "snapd_recovery_mode=install foo=bar",
 		err: `cannot specify install mode without system label`,
+	}, {
+		cmd: "snapd_recovery_mode=factory-reset foo=bar",
+		err: `cannot specify factory-reset mode without system label`,
 	}, {
 		// boot scripts couldn't decide on mode
 		cmd: "snapd_recovery_mode=install snapd_recovery_system=1234 snapd_recovery_mode=run",
@@ -193,6 +200,10 @@ func (s *kernelCommandLineSuite) TestComposeCommandLineManagedHappy(c *C) {
 	cmdline, err = boot.ComposeCommandLine(model)
 	c.Assert(err, IsNil)
 	c.Assert(cmdline, Equals, "snapd_recovery_mode=run panic=-1")
+
+	cmdline, err = boot.ComposeFactoryResetCommandLine(model, "20200314")
+	c.Assert(err, IsNil)
+	c.Assert(cmdline, Equals, "snapd_recovery_mode=factory-reset snapd_recovery_system=20200314 panic=-1")
 }
 
 func (s *kernelCommandLineSuite) TestComposeCandidateCommandLineManagedHappy(c *C) {
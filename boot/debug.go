@@ -20,10 +20,14 @@
 package boot
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/secboot"
 )
 
 // DumpBootVars writes a dump of the snapd bootvars to the given writer
@@ -56,3 +60,80 @@ func DumpBootVars(w io.Writer, dir string, uc20 bool) error {
 	}
 	return nil
 }
+
+type loadChainPreview struct {
+	Snap string              `json:"snap,omitempty"`
+	Path string              `json:"path"`
+	Role bootloader.Role     `json:"role"`
+	Next []*loadChainPreview `json:"next,omitempty"`
+}
+
+func toLoadChainPreviews(chains []*secboot.LoadChain) []*loadChainPreview {
+	var previews []*loadChainPreview
+	for _, lc := range chains {
+		previews = append(previews, &loadChainPreview{
+			Snap: lc.Snap,
+			Path: lc.Path,
+			Role: lc.Role,
+			Next: toLoadChainPreviews(lc.Next),
+		})
+	}
+	return previews
+}
+
+// pcrProfilePreview describes the parameters of the PCR protection profile of
+// a model; the EFI load chains are part of the secure boot policy while the
+// kernel command lines and the model are measured by the kernel EFI stub.
+type pcrProfilePreview struct {
+	BrandID        string              `json:"brand-id"`
+	Model          string              `json:"model"`
+	EFILoadChains  []*loadChainPreview `json:"efi-load-chains"`
+	KernelCmdlines []string            `json:"kernel-cmdlines"`
+}
+
+type bootChainsPreview struct {
+	Current      predictableBootChains `json:"current-boot-chains"`
+	Predicted    predictableBootChains `json:"predicted-boot-chains"`
+	ResealNeeded bool                  `json:"reseal-needed"`
+	PCRProfiles  []pcrProfilePreview   `json:"pcr-profiles"`
+}
+
+// DumpBootChains writes a dump of the boot chains the encryption keys were
+// last sealed with, the boot chains they would be resealed with for the current
+// state of the system, and the parameters of the resulting PCR profiles to the
+// given writer. Passing the snap file name of a candidate kernel previews the
+// boot chains of a refresh to that kernel. No changes are made to the system.
+func DumpBootChains(w io.Writer, model *asserts.Model, candidateKernel string) error {
+	modeenv, err := ReadModeenv("")
+	if err != nil {
+		return fmt.Errorf("cannot load modeenv: %v", err)
+	}
+	current, err := readBootChains(bootChainsFileUnder(dirs.GlobalRootDir))
+	if err != nil {
+		return err
+	}
+	var extraKernels []string
+	if candidateKernel != "" {
+		extraKernels = append(extraKernels, candidateKernel)
+	}
+	predicted, params, err := predictedSealKeyModelParams(model, modeenv, extraKernels...)
+	if err != nil {
+		return fmt.Errorf("cannot compute boot chains: %v", err)
+	}
+	preview := bootChainsPreview{
+		Current:      current,
+		Predicted:    predicted,
+		ResealNeeded: !predictableBootChainsEqualForReseal(current, predicted),
+	}
+	for _, p := range params {
+		preview.PCRProfiles = append(preview.PCRProfiles, pcrProfilePreview{
+			BrandID:        p.Model.BrandID(),
+			Model:          p.Model.Model(),
+			EFILoadChains:  toLoadChainPreviews(p.EFILoadChains),
+			KernelCmdlines: p.KernelCmdlines,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(preview)
+}
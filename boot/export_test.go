@@ -25,7 +25,9 @@ import (
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/seed"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/timings"
 )
 
 func NewCoreBootParticipant(s snap.PlaceInfo, t snap.Type, dev Device) *coreBootParticipant {
@@ -61,6 +63,7 @@ var (
 )
 
 type BootAssetsMap = bootAssetsMap
+type BootCommandLines = bootCommandLines
 type TrackedAsset = trackedAsset
 
 func (t *TrackedAsset) Equals(blName, name, hash string) error {
@@ -89,6 +92,24 @@ func MockSecbootSealKey(f func(key secboot.EncryptionKey, params *secboot.SealKe
 	}
 }
 
+// MarkCommandLineSuccessful runs the successful boot handling of the kernel
+// command line alone.
+func MarkCommandLineSuccessful(model *asserts.Model) error {
+	u, err := commandLineBootState(model).markSuccessful(nil)
+	if err != nil || u == nil {
+		return err
+	}
+	return u.commit()
+}
+
+func MockSecbootResealKey(f func(params *secboot.ResealKeyParams) error) (restore func()) {
+	old := secbootResealKey
+	secbootResealKey = f
+	return func() {
+		secbootResealKey = old
+	}
+}
+
 func (o *TrustedAssetsUpdateObserver) InjectChangedAsset(blName, assetName, hash string, recovery bool) {
 	ta := &trackedAsset{
 		blName: blName,
@@ -113,8 +134,20 @@ var (
 	ToPredictableBootChains             = toPredictableBootChains
 	PredictableBootChainsEqualForReseal = predictableBootChainsEqualForReseal
 	BootAssetsToLoadChains              = bootAssetsToLoadChains
+	ReadBootChains                      = readBootChains
+	WriteBootChains                     = writeBootChains
+	BootChainsFileUnder                 = bootChainsFileUnder
+	BuildBootAssets                     = buildBootAssets
 )
 
+func MockSeedReadSystemEssential(f func(seedDir, label string, essentialTypes []snap.Type, tm timings.Measurer) (*asserts.Model, []*seed.Snap, error)) (restore func()) {
+	old := seedReadSystemEssential
+	seedReadSystemEssential = f
+	return func() {
+		seedReadSystemEssential = old
+	}
+}
+
 func (b *bootChain) SetModelAssertion(model *asserts.Model) {
 	b.model = model
 }
@@ -122,3 +155,25 @@ func (b *bootChain) SetModelAssertion(model *asserts.Model) {
 func (b *bootChain) SetKernelBootFile(kbf bootloader.BootFile) {
 	b.kernelBootFile = kbf
 }
+
+func MockSecbootRecoveryKeyFuncs(newKey func() (secboot.RecoveryKey, error), add func(rkey, newRKey secboot.RecoveryKey, node string) error, remove func(rkey secboot.RecoveryKey, node string) error) (restore func()) {
+	oldNew := secbootNewRecoveryKey
+	oldAdd := secbootAddRecoveryKeyUsingRecoveryKey
+	oldRemove := secbootRemoveRecoveryKey
+	secbootNewRecoveryKey = newKey
+	secbootAddRecoveryKeyUsingRecoveryKey = add
+	secbootRemoveRecoveryKey = remove
+	return func() {
+		secbootNewRecoveryKey = oldNew
+		secbootAddRecoveryKeyUsingRecoveryKey = oldAdd
+		secbootRemoveRecoveryKey = oldRemove
+	}
+}
+
+func MockEncryptedPartitions(names []string) (restore func()) {
+	old := encryptedPartitions
+	encryptedPartitions = names
+	return func() {
+		encryptedPartitions = old
+	}
+}
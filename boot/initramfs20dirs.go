@@ -46,6 +46,10 @@ var (
 	// initramfs.
 	InitramfsUbuntuSeedDir string
 
+	// InitramfsUbuntuSaveDir is the location of ubuntu-save during the
+	// initramfs and during install mode.
+	InitramfsUbuntuSaveDir string
+
 	// InitramfsWritableDir is the location of the writable partition during the
 	// initramfs. Note that this may refer to a temporary filesystem or a
 	// physical partition depending on what system mode the system is in.
@@ -59,6 +63,10 @@ var (
 	// InstallHostFDEDataDir is the location of the FDE data during install mode.
 	InstallHostFDEDataDir string
 
+	// InstallHostDeviceSaveDir is the location of the device data kept on
+	// ubuntu-save during install mode.
+	InstallHostDeviceSaveDir string
+
 	// InitramfsEncryptionKeyDir is the location of the encrypted partition keys
 	// during the initramfs.
 	InitramfsEncryptionKeyDir string
@@ -70,8 +78,10 @@ func setInitramfsDirVars(rootdir string) {
 	InitramfsHostUbuntuDataDir = filepath.Join(InitramfsRunMntDir, "host", "ubuntu-data")
 	InitramfsUbuntuBootDir = filepath.Join(InitramfsRunMntDir, "ubuntu-boot")
 	InitramfsUbuntuSeedDir = filepath.Join(InitramfsRunMntDir, "ubuntu-seed")
+	InitramfsUbuntuSaveDir = filepath.Join(InitramfsRunMntDir, "ubuntu-save")
 	InstallHostWritableDir = filepath.Join(InitramfsRunMntDir, "ubuntu-data", "system-data")
 	InstallHostFDEDataDir = filepath.Join(InstallHostWritableDir, "var/lib/snapd/device/fde")
+	InstallHostDeviceSaveDir = filepath.Join(InitramfsUbuntuSaveDir, "device")
 	InitramfsWritableDir = filepath.Join(InitramfsDataDir, "system-data")
 	InitramfsEncryptionKeyDir = filepath.Join(InitramfsUbuntuSeedDir, "device/fde")
 }
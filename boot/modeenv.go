@@ -36,6 +36,10 @@ import (
 
 type bootAssetsMap map[string][]string
 
+// bootCommandLines is a list of kernel command lines, it is serialized as JSON
+// as the command lines may contain commas.
+type bootCommandLines []string
+
 // Modeenv is a file on UC20 that provides additional information
 // about the current mode (run,recover,install)
 type Modeenv struct {
@@ -60,6 +64,11 @@ type Modeenv struct {
 	// asset names to a list of hashes of the asset contents. Used similarly
 	// to CurrentTrustedBootAssets.
 	CurrentTrustedRecoveryBootAssets bootAssetsMap
+	// CurrentKernelCommandLines is a list of the run mode kernel command
+	// lines the system may boot with, on top of the ones composed from the
+	// current boot configuration. It carries the previous command line
+	// while a change of the extra arguments is pending a reboot.
+	CurrentKernelCommandLines bootCommandLines
 
 	// read is set to true when a modenv was read successfully
 	read bool
@@ -110,6 +119,7 @@ func ReadModeenv(rootdir string) (*Modeenv, error) {
 	unmarshalModeenvValueFromCfg(cfg, "grade", &m.Grade)
 	unmarshalModeenvValueFromCfg(cfg, "current_trusted_boot_assets", &m.CurrentTrustedBootAssets)
 	unmarshalModeenvValueFromCfg(cfg, "current_trusted_recovery_boot_assets", &m.CurrentTrustedRecoveryBootAssets)
+	unmarshalModeenvValueFromCfg(cfg, "current_kernel_command_lines", &m.CurrentKernelCommandLines)
 
 	return &m, nil
 }
@@ -190,6 +200,7 @@ func (m *Modeenv) WriteTo(rootdir string) error {
 	marshalModeenvEntryTo(buf, "grade", m.Grade)
 	marshalModeenvEntryTo(buf, "current_trusted_boot_assets", m.CurrentTrustedBootAssets)
 	marshalModeenvEntryTo(buf, "current_trusted_recovery_boot_assets", m.CurrentTrustedRecoveryBootAssets)
+	marshalModeenvEntryTo(buf, "current_kernel_command_lines", m.CurrentKernelCommandLines)
 
 	if err := osutil.AtomicWriteFile(modeenvPath, buf.Bytes(), 0644, 0); err != nil {
 		return err
@@ -333,3 +344,16 @@ func (b *bootAssetsMap) UnmarshalJSON(data []byte) error {
 	*b = bootAssetsMap(asMap)
 	return nil
 }
+
+func (b bootCommandLines) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string(b))
+}
+
+func (b *bootCommandLines) UnmarshalJSON(data []byte) error {
+	var asList []string
+	if err := json.Unmarshal(data, &asList); err != nil {
+		return err
+	}
+	*b = bootCommandLines(asList)
+	return nil
+}
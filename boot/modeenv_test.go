@@ -592,3 +592,30 @@ current_trusted_recovery_boot_assets={"bootx64.efi":["shimhash1","shimhash2"],"g
 		"bootx64.efi": []string{"shimhash1", "shimhash2"},
 	})
 }
+
+func (s *modeenvSuite) TestMarshalCurrentKernelCommandLines(c *C) {
+	c.Assert(s.mockModeenvPath, testutil.FileAbsent)
+
+	modeenv := &boot.Modeenv{
+		Mode:           "run",
+		RecoverySystem: "20191128",
+		CurrentKernelCommandLines: boot.BootCommandLines{
+			"snapd_recovery_mode=run console=ttyS0,115200",
+			"snapd_recovery_mode=run console=ttyS0,115200 isolcpus=1,2",
+		},
+	}
+	err := modeenv.WriteTo(s.tmpdir)
+	c.Assert(err, IsNil)
+
+	c.Assert(s.mockModeenvPath, testutil.FileEquals, `mode=run
+recovery_system=20191128
+current_kernel_command_lines=["snapd_recovery_mode=run console=ttyS0,115200","snapd_recovery_mode=run console=ttyS0,115200 isolcpus=1,2"]
+`)
+
+	modeenvRead, err := boot.ReadModeenv(s.tmpdir)
+	c.Assert(err, IsNil)
+	c.Assert(modeenvRead.CurrentKernelCommandLines, DeepEquals, boot.BootCommandLines{
+		"snapd_recovery_mode=run console=ttyS0,115200",
+		"snapd_recovery_mode=run console=ttyS0,115200 isolcpus=1,2",
+	})
+}
@@ -0,0 +1,122 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/secboot"
+)
+
+var (
+	secbootNewRecoveryKey                 = secboot.NewRecoveryKey
+	secbootAddRecoveryKeyUsingRecoveryKey = secboot.AddRecoveryKeyUsingRecoveryKey
+	secbootRemoveRecoveryKey              = secboot.RemoveRecoveryKey
+)
+
+// ErrNoRecoveryKey is returned when the device has no recovery key, that is
+// when its partitions are not encrypted.
+var ErrNoRecoveryKey = errors.New("no recovery key: system is not encrypted")
+
+// encryptedPartitions lists the names of the partitions which are encrypted
+// and can be unlocked with the recovery key.
+var encryptedPartitions = []string{"ubuntu-data", "ubuntu-save"}
+
+// presentEncryptedPartitions returns the encrypted partitions of the device,
+// ubuntu-save is only there if the gadget declares it.
+func presentEncryptedPartitions() []string {
+	var names []string
+	for _, name := range encryptedPartitions {
+		if name == "ubuntu-save" && !osutil.FileExists(encryptedDeviceNode(name)) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func recoveryKeyFile() string {
+	return filepath.Join(dirs.SnapFDEDir, "recovery.key")
+}
+
+func encryptedDeviceNode(name string) string {
+	// the LUKS container is labeled after the partition it holds
+	return filepath.Join(dirs.GlobalRootDir, "/dev/disk/by-label", name+"-enc")
+}
+
+// RecoveryKey returns the recovery key of the encrypted partitions of the
+// device. ErrNoRecoveryKey is returned when the device is not encrypted.
+func RecoveryKey() (secboot.RecoveryKey, error) {
+	rkey, err := secboot.RecoveryKeyFromFile(recoveryKeyFile())
+	if os.IsNotExist(err) {
+		return rkey, ErrNoRecoveryKey
+	}
+	return rkey, err
+}
+
+// RotateRecoveryKey replaces the recovery key of the encrypted partitions of
+// the device with a newly generated one, which is returned. The new key is
+// added to all the partitions and stored before the old key is removed, so
+// that the partitions can always be unlocked with the stored key.
+func RotateRecoveryKey() (secboot.RecoveryKey, error) {
+	oldKey, err := RecoveryKey()
+	if err != nil {
+		return oldKey, err
+	}
+	newKey, err := secbootNewRecoveryKey()
+	if err != nil {
+		return newKey, fmt.Errorf("cannot create recovery key: %v", err)
+	}
+
+	partitions := presentEncryptedPartitions()
+	var added []string
+	undo := func() {
+		for _, name := range added {
+			if err := secbootRemoveRecoveryKey(newKey, encryptedDeviceNode(name)); err != nil {
+				logger.Noticef("cannot remove new recovery key from %s: %v", name, err)
+			}
+		}
+	}
+	for _, name := range partitions {
+		if err := secbootAddRecoveryKeyUsingRecoveryKey(oldKey, newKey, encryptedDeviceNode(name)); err != nil {
+			undo()
+			return newKey, fmt.Errorf("cannot add recovery key to %s: %v", name, err)
+		}
+		added = append(added, name)
+	}
+	if err := newKey.Save(recoveryKeyFile()); err != nil {
+		undo()
+		return newKey, fmt.Errorf("cannot store recovery key: %v", err)
+	}
+
+	// the new key is in place, the old one can go now
+	for _, name := range partitions {
+		if err := secbootRemoveRecoveryKey(oldKey, encryptedDeviceNode(name)); err != nil {
+			return newKey, fmt.Errorf("cannot remove old recovery key from %s: %v", name, err)
+		}
+	}
+	return newKey, nil
+}
@@ -0,0 +1,193 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type recoveryKeySuite struct {
+	testutil.BaseTest
+
+	rootdir string
+	oldKey  secboot.RecoveryKey
+	newKey  secboot.RecoveryKey
+	ops     []string
+}
+
+var _ = Suite(&recoveryKeySuite{})
+
+func (s *recoveryKeySuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.rootdir = c.MkDir()
+	dirs.SetRootDir(s.rootdir)
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+	s.AddCleanup(boot.MockEncryptedPartitions([]string{"ubuntu-data", "ubuntu-other"}))
+
+	s.oldKey = secboot.RecoveryKey{15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0}
+	s.newKey = secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	s.ops = nil
+}
+
+func (s *recoveryKeySuite) keyName(key secboot.RecoveryKey) string {
+	switch key {
+	case s.oldKey:
+		return "old"
+	case s.newKey:
+		return "new"
+	}
+	return "unknown"
+}
+
+func (s *recoveryKeySuite) mockSecboot(c *C, failOn string) {
+	s.AddCleanup(boot.MockSecbootRecoveryKeyFuncs(
+		func() (secboot.RecoveryKey, error) {
+			return s.newKey, nil
+		},
+		func(rkey, newRKey secboot.RecoveryKey, node string) error {
+			op := fmt.Sprintf("add %s with %s to %s", s.keyName(newRKey), s.keyName(rkey), node)
+			s.ops = append(s.ops, op)
+			if op == failOn {
+				return errors.New("boom")
+			}
+			return nil
+		},
+		func(rkey secboot.RecoveryKey, node string) error {
+			op := fmt.Sprintf("remove %s from %s", s.keyName(rkey), node)
+			s.ops = append(s.ops, op)
+			if op == failOn {
+				return errors.New("boom")
+			}
+			return nil
+		}))
+}
+
+func (s *recoveryKeySuite) node(name string) string {
+	return filepath.Join(s.rootdir, "/dev/disk/by-label", name+"-enc")
+}
+
+func (s *recoveryKeySuite) TestRecoveryKeyNotEncrypted(c *C) {
+	_, err := boot.RecoveryKey()
+	c.Assert(err, Equals, boot.ErrNoRecoveryKey)
+
+	s.mockSecboot(c, "")
+	_, err = boot.RotateRecoveryKey()
+	c.Assert(err, Equals, boot.ErrNoRecoveryKey)
+	c.Check(s.ops, HasLen, 0)
+}
+
+func (s *recoveryKeySuite) TestRecoveryKey(c *C) {
+	err := s.oldKey.Save(filepath.Join(dirs.SnapFDEDir, "recovery.key"))
+	c.Assert(err, IsNil)
+
+	key, err := boot.RecoveryKey()
+	c.Assert(err, IsNil)
+	c.Check(key, Equals, s.oldKey)
+}
+
+func (s *recoveryKeySuite) TestRotateRecoveryKeyHappy(c *C) {
+	keyFile := filepath.Join(dirs.SnapFDEDir, "recovery.key")
+	err := s.oldKey.Save(keyFile)
+	c.Assert(err, IsNil)
+	s.mockSecboot(c, "")
+
+	key, err := boot.RotateRecoveryKey()
+	c.Assert(err, IsNil)
+	c.Check(key, Equals, s.newKey)
+	c.Check(s.ops, DeepEquals, []string{
+		"add new with old to " + s.node("ubuntu-data"),
+		"add new with old to " + s.node("ubuntu-other"),
+		"remove old from " + s.node("ubuntu-data"),
+		"remove old from " + s.node("ubuntu-other"),
+	})
+	c.Check(keyFile, testutil.FileEquals, string(s.newKey[:]))
+}
+
+func (s *recoveryKeySuite) TestRotateRecoveryKeyUbuntuSave(c *C) {
+	s.AddCleanup(boot.MockEncryptedPartitions([]string{"ubuntu-data", "ubuntu-save"}))
+	keyFile := filepath.Join(dirs.SnapFDEDir, "recovery.key")
+	err := s.oldKey.Save(keyFile)
+	c.Assert(err, IsNil)
+	s.mockSecboot(c, "")
+
+	// no ubuntu-save on this device
+	_, err = boot.RotateRecoveryKey()
+	c.Assert(err, IsNil)
+	c.Check(s.ops, DeepEquals, []string{
+		"add new with old to " + s.node("ubuntu-data"),
+		"remove old from " + s.node("ubuntu-data"),
+	})
+
+	// with ubuntu-save
+	c.Assert(os.MkdirAll(filepath.Dir(s.node("ubuntu-save")), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.node("ubuntu-save"), nil, 0644), IsNil)
+	s.oldKey, s.newKey = s.newKey, s.oldKey
+	s.ops = nil
+
+	_, err = boot.RotateRecoveryKey()
+	c.Assert(err, IsNil)
+	c.Check(s.ops, DeepEquals, []string{
+		"add new with old to " + s.node("ubuntu-data"),
+		"add new with old to " + s.node("ubuntu-save"),
+		"remove old from " + s.node("ubuntu-data"),
+		"remove old from " + s.node("ubuntu-save"),
+	})
+}
+
+func (s *recoveryKeySuite) TestRotateRecoveryKeyAddFails(c *C) {
+	keyFile := filepath.Join(dirs.SnapFDEDir, "recovery.key")
+	err := s.oldKey.Save(keyFile)
+	c.Assert(err, IsNil)
+	s.mockSecboot(c, "add new with old to "+s.node("ubuntu-other"))
+
+	_, err = boot.RotateRecoveryKey()
+	c.Assert(err, ErrorMatches, "cannot add recovery key to ubuntu-other: boom")
+	// the new key was removed from where it was already added
+	c.Check(s.ops, DeepEquals, []string{
+		"add new with old to " + s.node("ubuntu-data"),
+		"add new with old to " + s.node("ubuntu-other"),
+		"remove new from " + s.node("ubuntu-data"),
+	})
+	// and the old key is still in place
+	c.Check(keyFile, testutil.FileEquals, string(s.oldKey[:]))
+}
+
+func (s *recoveryKeySuite) TestRotateRecoveryKeyRemoveOldFails(c *C) {
+	keyFile := filepath.Join(dirs.SnapFDEDir, "recovery.key")
+	err := s.oldKey.Save(keyFile)
+	c.Assert(err, IsNil)
+	s.mockSecboot(c, "remove old from "+s.node("ubuntu-data"))
+
+	_, err = boot.RotateRecoveryKey()
+	c.Assert(err, ErrorMatches, "cannot remove old recovery key from ubuntu-data: boom")
+	// the new key is usable with all partitions already
+	c.Check(keyFile, testutil.FileEquals, string(s.newKey[:]))
+}
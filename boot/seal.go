@@ -25,31 +25,31 @@ import (
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/seed"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timings"
 )
 
 var (
-	secbootSealKey = secboot.SealKey
+	secbootSealKey   = secboot.SealKey
+	secbootResealKey = secboot.ResealKey
+
+	seedReadSystemEssential = seed.ReadSystemEssential
 )
 
 // sealKeyToModeenv seals the supplied key to the parameters specified
 // in modeenv.
 func sealKeyToModeenv(key secboot.EncryptionKey, model *asserts.Model, modeenv *Modeenv) error {
-	// TODO:UC20: binaries are EFI/bootloader-specific, hardcoded for now
 	// TODO:UC20: produce separate a recovery and a run boot chains
-	kernelPath := filepath.Join(InitramfsUbuntuBootDir, "EFI/ubuntu/kernel.efi")
-	kbf := bootloader.NewBootFile("", kernelPath, bootloader.RoleRunMode)
-	loadChain := secboot.NewLoadChain(kbf)
-
-	// the path to the run mode grub EFI binary
-	runbf := bootloader.NewBootFile("", filepath.Join(InitramfsUbuntuBootDir, "EFI/boot/grubx64.efi"), bootloader.RoleRunMode)
-	loadChain = secboot.NewLoadChain(runbf, loadChain)
-	// the path to the recovery grub EFI binary
-	recbf := bootloader.NewBootFile("", filepath.Join(InitramfsUbuntuSeedDir, "EFI/boot/grubx64.efi"), bootloader.RoleRecovery)
-	loadChain = secboot.NewLoadChain(recbf, loadChain)
-	// the path to the shim EFI binary
-	shimbf := bootloader.NewBootFile("", filepath.Join(InitramfsUbuntuSeedDir, "EFI/boot/bootx64.efi"), bootloader.RoleRecovery)
-	loadChain = secboot.NewLoadChain(shimbf, loadChain)
+	loadChain, err := runModeLoadChain(modeenv)
+	if err != nil {
+		return fmt.Errorf("cannot compose the boot chain: %v", err)
+	}
 
 	// Get the expected kernel command line for the system that is currently being installed
 	cmdline, err := ComposeCandidateCommandLine(model)
@@ -63,9 +63,17 @@ func sealKeyToModeenv(key secboot.EncryptionKey, model *asserts.Model, modeenv *
 		return fmt.Errorf("cannot obtain recovery kernel command line: %v", err)
 	}
 
+	// ubuntu-data is also unlocked in factory-reset mode, so that the device
+	// identity can be carried over to the recreated partition
+	factoryResetCmdline, err := ComposeFactoryResetCommandLine(model, modeenv.RecoverySystem)
+	if err != nil {
+		return fmt.Errorf("cannot obtain factory-reset kernel command line: %v", err)
+	}
+
 	kernelCmdlines := []string{
 		cmdline,
 		recoveryCmdline,
+		factoryResetCmdline,
 	}
 
 	sealKeyParams := secboot.SealKeyParams{
@@ -85,5 +93,361 @@ func sealKeyToModeenv(key secboot.EncryptionKey, model *asserts.Model, modeenv *
 		return fmt.Errorf("cannot seal the encryption key: %v", err)
 	}
 
+	// keep track of the boot chains the key was sealed with, so that they
+	// can be compared with the ones used for resealing later
+	runSnapsDir := dirs.SnapBlobDirUnder(InstallHostWritableDir)
+	pbc, err := bootChainsForModeenv(model, modeenv, runSnapsDir)
+	if err == nil {
+		err = writeBootChains(pbc, bootChainsFileUnder(InstallHostWritableDir))
+	}
+	if err != nil {
+		logger.Noticef("cannot record sealed boot chains: %v", err)
+	}
+
+	return nil
+}
+
+// resealKeyToModeenv reseals the encryption key of ubuntu-data to the boot
+// chains computed for the given modeenv. It does nothing on devices without
+// sealed keys.
+func resealKeyToModeenv(model *asserts.Model, modeenv *Modeenv) error {
+	if !hasSealedKeys() {
+		return nil
+	}
+	pbc, params, err := predictedSealKeyModelParams(model, modeenv)
+	if err != nil {
+		return fmt.Errorf("cannot compute boot chains: %v", err)
+	}
+	resealKeyParams := secboot.ResealKeyParams{
+		ModelParams:             params,
+		KeyFile:                 filepath.Join(InitramfsEncryptionKeyDir, "ubuntu-data.sealed-key"),
+		TPMPolicyUpdateDataFile: filepath.Join(dirs.SnapFDEDir, "policy-update-data"),
+	}
+	if err := secbootResealKey(&resealKeyParams); err != nil {
+		return fmt.Errorf("cannot reseal the encryption key: %v", err)
+	}
+	if err := writeBootChains(pbc, bootChainsFileUnder(dirs.GlobalRootDir)); err != nil {
+		logger.Noticef("cannot record sealed boot chains: %v", err)
+	}
+	return nil
+}
+
+// runModeLoadChain returns the load chain for booting the system in run mode,
+// as reported by the recovery bootloader, using the kernel snap recorded in
+// the modeenv.
+func runModeLoadChain(modeenv *Modeenv) (*secboot.LoadChain, error) {
+	if len(modeenv.CurrentKernels) != 1 {
+		return nil, fmt.Errorf("internal error: expected exactly one kernel in modeenv, got %d", len(modeenv.CurrentKernels))
+	}
+	kernelPath := filepath.Join(dirs.SnapBlobDirUnder(InstallHostWritableDir), modeenv.CurrentKernels[0])
+
+	rbl, bl, err := findBootChainsBootloaders()
+	if err != nil {
+		return nil, err
+	}
+	tbl, ok := rbl.(bootloader.TrustedAssetsBootloader)
+	if !ok {
+		return nil, fmt.Errorf("%q bootloader does not support trusted assets", rbl.Name())
+	}
+	bootFiles, err := tbl.BootChain(bl, kernelPath)
+	if err != nil {
+		return nil, err
+	}
+	return bootFilesToLoadChain(bootFiles, map[bootloader.Role]string{
+		bootloader.RoleRecovery: InitramfsUbuntuSeedDir,
+		bootloader.RoleRunMode:  InitramfsUbuntuBootDir,
+	})
+}
+
+// hasSealedKeys returns true when the encryption keys of the device were
+// sealed to the boot chains.
+func hasSealedKeys() bool {
+	return osutil.FileExists(filepath.Join(InitramfsEncryptionKeyDir, "ubuntu-data.sealed-key"))
+}
+
+// buildBootAssets builds the list of boot assets out of a sequence of boot
+// files, using the asset hashes tracked in the modeenv. The last boot file is
+// the kernel, which is returned separately.
+func buildBootAssets(bootFiles []bootloader.BootFile, modeenv *Modeenv) (assets []bootAsset, kernel bootloader.BootFile, err error) {
+	if len(bootFiles) == 0 {
+		return nil, kernel, fmt.Errorf("internal error: cannot build boot assets without boot files")
+	}
+	for _, bf := range bootFiles[:len(bootFiles)-1] {
+		name := filepath.Base(bf.Path)
+		var hashes []string
+		var ok bool
+		if bf.Role == bootloader.RoleRecovery {
+			hashes, ok = modeenv.CurrentTrustedRecoveryBootAssets[name]
+		} else {
+			hashes, ok = modeenv.CurrentTrustedBootAssets[name]
+		}
+		if !ok {
+			return nil, kernel, fmt.Errorf("cannot find expected boot asset %s in modeenv", name)
+		}
+		assets = append(assets, bootAsset{
+			Role:   bf.Role,
+			Name:   name,
+			Hashes: hashes,
+		})
+	}
+	return assets, bootFiles[len(bootFiles)-1], nil
+}
+
+func kernelRevisionForChain(kernel snap.PlaceInfo) string {
+	// unasserted kernels have no revision, their boot chains are always
+	// considered different
+	if !kernel.SnapRevision().Store() {
+		return ""
+	}
+	return kernel.SnapRevision().String()
+}
+
+func newBootChain(model *asserts.Model, assetChain []bootAsset, kernel snap.PlaceInfo, kbf bootloader.BootFile, cmdlines []string) bootChain {
+	return bootChain{
+		BrandID:        model.BrandID(),
+		Model:          model.Model(),
+		Grade:          string(model.Grade()),
+		ModelSignKeyID: model.SignKeyID(),
+		AssetChain:     assetChain,
+		Kernel:         kernel.SnapName(),
+		KernelRevision: kernelRevisionForChain(kernel),
+		KernelCmdlines: cmdlines,
+		model:          model,
+		kernelBootFile: kbf,
+	}
+}
+
+// runModeBootChains computes the boot chains of the run mode kernels with the
+// given snap file names, located in runSnapsDir.
+func runModeBootChains(rbl, bl bootloader.Bootloader, model *asserts.Model, modeenv *Modeenv, kernels []string, runSnapsDir string) ([]bootChain, error) {
+	tbl, ok := rbl.(bootloader.TrustedAssetsBootloader)
+	if !ok {
+		return nil, fmt.Errorf("%q bootloader does not support trusted assets", rbl.Name())
+	}
+	// either edition of the boot config may be in use when the keys are
+	// unsealed
+	var cmdlines []string
+	for _, compose := range []func(*asserts.Model) (string, error){ComposeCommandLine, ComposeCandidateCommandLine} {
+		cmdline, err := compose(model)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain kernel command line: %v", err)
+		}
+		if !strutil.ListContains(cmdlines, cmdline) {
+			cmdlines = append(cmdlines, cmdline)
+		}
+	}
+	// as well as the command lines that are pending a reboot
+	for _, cmdline := range modeenv.CurrentKernelCommandLines {
+		if !strutil.ListContains(cmdlines, cmdline) {
+			cmdlines = append(cmdlines, cmdline)
+		}
+	}
+	chains := make([]bootChain, 0, len(kernels))
+	for _, k := range kernels {
+		info, err := snap.ParsePlaceInfoFromSnapFileName(k)
+		if err != nil {
+			return nil, err
+		}
+		bootFiles, err := tbl.BootChain(bl, filepath.Join(runSnapsDir, info.Filename()))
+		if err != nil {
+			return nil, err
+		}
+		assetChain, kbf, err := buildBootAssets(bootFiles, modeenv)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, newBootChain(model, assetChain, info, kbf, cmdlines))
+	}
+	return chains, nil
+}
+
+// recoveryBootChains computes the boot chains of the recovery systems listed
+// in the modeenv, with the kernels obtained from their seeds.
+func recoveryBootChains(rbl bootloader.Bootloader, model *asserts.Model, modeenv *Modeenv) ([]bootChain, error) {
+	tbl, ok := rbl.(bootloader.TrustedAssetsBootloader)
+	if !ok {
+		return nil, fmt.Errorf("%q bootloader does not support trusted assets", rbl.Name())
+	}
+	systems := modeenv.CurrentRecoverySystems
+	if len(systems) == 0 && modeenv.RecoverySystem != "" {
+		systems = []string{modeenv.RecoverySystem}
+	}
+	chains := make([]bootChain, 0, len(systems))
+	for _, system := range systems {
+		_, snaps, err := seedReadSystemEssential(InitramfsUbuntuSeedDir, system, []snap.Type{snap.TypeKernel}, timings.New(nil))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read recovery system %q seed: %v", system, err)
+		}
+		var seedKernel *seed.Snap
+		for _, sn := range snaps {
+			if sn.EssentialType == snap.TypeKernel {
+				seedKernel = sn
+				break
+			}
+		}
+		if seedKernel == nil {
+			return nil, fmt.Errorf("cannot find kernel of recovery system %q", system)
+		}
+		cmdline, err := ComposeRecoveryCommandLine(model, system)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain recovery kernel command line: %v", err)
+		}
+		factoryResetCmdline, err := ComposeFactoryResetCommandLine(model, system)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain factory-reset kernel command line: %v", err)
+		}
+		bootFiles, err := tbl.RecoveryBootChain(seedKernel.Path)
+		if err != nil {
+			return nil, err
+		}
+		assetChain, kbf, err := buildBootAssets(bootFiles, modeenv)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, newBootChain(model, assetChain, seedKernel.PlaceInfo(), kbf, []string{cmdline, factoryResetCmdline}))
+	}
+	return chains, nil
+}
+
+func findBootChainsBootloaders() (rbl, bl bootloader.Bootloader, err error) {
+	rbl, err = bootloader.Find(InitramfsUbuntuSeedDir, &bootloader.Options{
+		Role: bootloader.RoleRecovery,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot find the recovery bootloader: %v", err)
+	}
+	bl, err = bootloader.Find(InitramfsUbuntuBootDir, &bootloader.Options{
+		Role:        bootloader.RoleRunMode,
+		NoSlashBoot: true,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot find the run mode bootloader: %v", err)
+	}
+	return rbl, bl, nil
+}
+
+// bootChainsForModeenv computes the run mode and recovery boot chains the
+// encryption keys would be sealed to with the given modeenv. The extra kernels
+// are included as run mode kernels along with the ones listed in the modeenv.
+func bootChainsForModeenv(model *asserts.Model, modeenv *Modeenv, runSnapsDir string, extraKernels ...string) (predictableBootChains, error) {
+	rbl, bl, err := findBootChainsBootloaders()
+	if err != nil {
+		return nil, err
+	}
+	kernels := append([]string(nil), modeenv.CurrentKernels...)
+	for _, k := range extraKernels {
+		if !strutil.ListContains(kernels, k) {
+			kernels = append(kernels, k)
+		}
+	}
+	runChains, err := runModeBootChains(rbl, bl, model, modeenv, kernels, runSnapsDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compose run mode boot chains: %v", err)
+	}
+	recoveryChains, err := recoveryBootChains(rbl, model, modeenv)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compose recovery boot chains: %v", err)
+	}
+	return toPredictableBootChains(append(runChains, recoveryChains...)), nil
+}
+
+// sealKeyModelParams composes the model specific parameters for sealing the
+// encryption keys to the given boot chains. The boot assets of the chains are
+// looked up in the boot assets cache.
+func sealKeyModelParams(pbc predictableBootChains, roleToBlName map[bootloader.Role]string) ([]*secboot.SealKeyModelParams, error) {
+	var params []*secboot.SealKeyModelParams
+	modelToParams := map[*asserts.Model]*secboot.SealKeyModelParams{}
+	for _, bc := range pbc {
+		if bc.model == nil {
+			return nil, fmt.Errorf("internal error: boot chain of kernel %q has no model", bc.Kernel)
+		}
+		loadChains, err := bootAssetsToLoadChains(bc.AssetChain, bc.kernelBootFile, roleToBlName)
+		if err != nil {
+			return nil, fmt.Errorf("cannot build load chains with current boot assets: %v", err)
+		}
+		p := modelToParams[bc.model]
+		if p == nil {
+			p = &secboot.SealKeyModelParams{Model: bc.model}
+			modelToParams[bc.model] = p
+			params = append(params, p)
+		}
+		p.EFILoadChains = append(p.EFILoadChains, loadChains...)
+		for _, cmdline := range bc.KernelCmdlines {
+			if !strutil.ListContains(p.KernelCmdlines, cmdline) {
+				p.KernelCmdlines = append(p.KernelCmdlines, cmdline)
+			}
+		}
+	}
+	return params, nil
+}
+
+// predictedSealKeyModelParams computes the boot chains and the parameters the
+// encryption keys would be resealed with for the current state of the system
+// described by the modeenv and any extra run mode kernels.
+func predictedSealKeyModelParams(model *asserts.Model, modeenv *Modeenv, extraKernels ...string) (predictableBootChains, []*secboot.SealKeyModelParams, error) {
+	rbl, bl, err := findBootChainsBootloaders()
+	if err != nil {
+		return nil, nil, err
+	}
+	pbc, err := bootChainsForModeenv(model, modeenv, dirs.SnapBlobDir, extraKernels...)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err := sealKeyModelParams(pbc, map[bootloader.Role]string{
+		bootloader.RoleRecovery: rbl.Name(),
+		bootloader.RoleRunMode:  bl.Name(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pbc, params, nil
+}
+
+// CheckBootChainsForKernel verifies that consistent boot chains can be
+// computed for resealing the encryption keys of the device once the given
+// kernel snap is installed as a run mode kernel, and that the kernel boot file
+// the keys get sealed to can be read from the kernel snap file. It does nothing
+// on devices without sealed encryption keys.
+func CheckBootChainsForKernel(kernel snap.PlaceInfo, kernelFile snap.Container, model *asserts.Model) error {
+	if !hasSealedKeys() {
+		return nil
+	}
+	modeenv, err := ReadModeenv("")
+	if err != nil {
+		return fmt.Errorf("cannot load modeenv: %v", err)
+	}
+	pbc, _, err := predictedSealKeyModelParams(model, modeenv, kernel.Filename())
+	if err != nil {
+		return fmt.Errorf("cannot compute boot chains with kernel %q: %v", kernel.Filename(), err)
+	}
+	kernelSnap := filepath.Join(dirs.SnapBlobDir, kernel.Filename())
+	for _, bc := range pbc {
+		if bc.kernelBootFile.Snap != kernelSnap {
+			continue
+		}
+		if err := checkKernelBootFile(kernelFile, bc.kernelBootFile.Path); err != nil {
+			return fmt.Errorf("cannot use kernel %q: %v", kernel.Filename(), err)
+		}
+		return nil
+	}
+	return fmt.Errorf("internal error: cannot find boot chain of kernel %q", kernel.Filename())
+}
+
+// checkKernelBootFile checks that the kernel boot file at the given path in
+// the kernel snap file exists and can be read to its end.
+func checkKernelBootFile(kernelFile snap.Container, path string) error {
+	f, err := kernelFile.RandomAccessFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot open kernel boot file %s: %v", path, err)
+	}
+	defer f.Close()
+	if f.Size() == 0 {
+		return fmt.Errorf("kernel boot file %s is empty", path)
+	}
+	// a truncated snap file fails to read the last block
+	buf := make([]byte, 1)
+	if _, err := f.ReadAt(buf, f.Size()-1); err != nil {
+		return fmt.Errorf("cannot read kernel boot file %s: %v", path, err)
+	}
 	return nil
 }
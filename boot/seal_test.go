@@ -20,18 +20,26 @@
 package boot_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/seed"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/timings"
 )
 
 type sealSuite struct {
@@ -60,6 +68,7 @@ func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 
 		modeenv := &boot.Modeenv{
 			RecoverySystem: "20200825",
+			CurrentKernels: []string{"pc-kernel_500.snap"},
 		}
 
 		// set encryption key
@@ -82,11 +91,12 @@ func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 				bootloader.NewBootFile("", filepath.Join(tmpDir, "run/mnt/ubuntu-seed/EFI/boot/bootx64.efi"), bootloader.RoleRecovery),
 				bootloader.NewBootFile("", filepath.Join(tmpDir, "run/mnt/ubuntu-seed/EFI/boot/grubx64.efi"), bootloader.RoleRecovery),
 				bootloader.NewBootFile("", filepath.Join(tmpDir, "run/mnt/ubuntu-boot/EFI/boot/grubx64.efi"), bootloader.RoleRunMode),
-				bootloader.NewBootFile("", filepath.Join(tmpDir, "run/mnt/ubuntu-boot/EFI/ubuntu/kernel.efi"), bootloader.RoleRunMode),
+				bootloader.NewBootFile(filepath.Join(tmpDir, "run/mnt/ubuntu-data/system-data/var/lib/snapd/snaps/pc-kernel_500.snap"), "kernel.efi", bootloader.RoleRunMode),
 			})
 			c.Assert(params.ModelParams[0].KernelCmdlines, DeepEquals, []string{
 				"snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1",
 				"snapd_recovery_mode=recover snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+				"snapd_recovery_mode=factory-reset snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
 			})
 			return tc.sealErr
 		})
@@ -126,3 +136,346 @@ func createMockGrubCfg(baseDir string) error {
 	}
 	return ioutil.WriteFile(cfg, []byte("# Snapd-Boot-Config-Edition: 1\n"), 0644)
 }
+
+func (s *sealSuite) TestBuildBootAssets(c *C) {
+	modeenv := &boot.Modeenv{
+		CurrentTrustedRecoveryBootAssets: boot.BootAssetsMap{
+			"bootx64.efi": []string{"shim-hash"},
+			"grubx64.efi": []string{"grub-hash"},
+		},
+		CurrentTrustedBootAssets: boot.BootAssetsMap{
+			"grubx64.efi": []string{"run-grub-hash", "new-run-grub-hash"},
+		},
+	}
+	bootFiles := []bootloader.BootFile{
+		bootloader.NewBootFile("", "EFI/boot/bootx64.efi", bootloader.RoleRecovery),
+		bootloader.NewBootFile("", "EFI/boot/grubx64.efi", bootloader.RoleRecovery),
+		bootloader.NewBootFile("", "EFI/boot/grubx64.efi", bootloader.RoleRunMode),
+		bootloader.NewBootFile("pc-kernel_1.snap", "kernel.efi", bootloader.RoleRunMode),
+	}
+
+	assets, kernel, err := boot.BuildBootAssets(bootFiles, modeenv)
+	c.Assert(err, IsNil)
+	c.Check(assets, DeepEquals, []boot.BootAsset{
+		{Role: bootloader.RoleRecovery, Name: "bootx64.efi", Hashes: []string{"shim-hash"}},
+		{Role: bootloader.RoleRecovery, Name: "grubx64.efi", Hashes: []string{"grub-hash"}},
+		{Role: bootloader.RoleRunMode, Name: "grubx64.efi", Hashes: []string{"run-grub-hash", "new-run-grub-hash"}},
+	})
+	c.Check(kernel, DeepEquals, bootFiles[3])
+
+	// the run mode asset is not tracked
+	modeenv.CurrentTrustedBootAssets = nil
+	_, _, err = boot.BuildBootAssets(bootFiles, modeenv)
+	c.Assert(err, ErrorMatches, "cannot find expected boot asset grubx64.efi in modeenv")
+
+	_, _, err = boot.BuildBootAssets(nil, modeenv)
+	c.Assert(err, ErrorMatches, "internal error: cannot build boot assets without boot files")
+}
+
+// setupSealedSystem mocks a run mode system with grub and encryption keys
+// sealed to the tracked boot assets.
+func (s *sealSuite) setupSealedSystem(c *C, rootdir string) {
+	dirs.SetRootDir(rootdir)
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	c.Assert(createMockGrubCfg(filepath.Join(rootdir, "run/mnt/ubuntu-seed")), IsNil)
+	c.Assert(createMockGrubCfg(filepath.Join(rootdir, "run/mnt/ubuntu-boot")), IsNil)
+
+	sealedKey := filepath.Join(boot.InitramfsEncryptionKeyDir, "ubuntu-data.sealed-key")
+	c.Assert(os.MkdirAll(filepath.Dir(sealedKey), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(sealedKey, nil, 0600), IsNil)
+
+	for _, name := range []string{"bootx64.efi-shim-hash", "grubx64.efi-grub-hash", "grubx64.efi-run-grub-hash"} {
+		p := filepath.Join(dirs.SnapBootAssetsDir, "grub", name)
+		c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(p, nil, 0644), IsNil)
+	}
+
+	modeenv := &boot.Modeenv{
+		Mode:                   "run",
+		RecoverySystem:         "20200825",
+		CurrentRecoverySystems: []string{"20200825"},
+		CurrentKernels:         []string{"pc-kernel_500.snap"},
+		CurrentTrustedRecoveryBootAssets: boot.BootAssetsMap{
+			"bootx64.efi": []string{"shim-hash"},
+			"grubx64.efi": []string{"grub-hash"},
+		},
+		CurrentTrustedBootAssets: boot.BootAssetsMap{
+			"grubx64.efi": []string{"run-grub-hash"},
+		},
+	}
+	c.Assert(modeenv.WriteTo(""), IsNil)
+
+	s.AddCleanup(boot.MockSeedReadSystemEssential(func(seedDir, label string, essentialTypes []snap.Type, tm timings.Measurer) (*asserts.Model, []*seed.Snap, error) {
+		c.Check(seedDir, Equals, filepath.Join(rootdir, "run/mnt/ubuntu-seed"))
+		c.Check(label, Equals, "20200825")
+		return nil, []*seed.Snap{
+			{
+				Path:          filepath.Join(seedDir, "snaps/pc-kernel_1.snap"),
+				SideInfo:      &snap.SideInfo{RealName: "pc-kernel", Revision: snap.R(1)},
+				EssentialType: snap.TypeKernel,
+			},
+		}, nil
+	}))
+}
+
+func (s *sealSuite) TestCheckBootChainsForKernel(c *C) {
+	rootdir := c.MkDir()
+	s.setupSealedSystem(c, rootdir)
+	model := makeMockUC20Model()
+
+	kernel := snap.MinimalPlaceInfo("pc-kernel", snap.R(501))
+	kernelFile := snaptest.MockContainer(c, [][]string{{"kernel.efi", "kernel"}})
+	err := boot.CheckBootChainsForKernel(kernel, kernelFile, model)
+	c.Assert(err, IsNil)
+
+	// the run mode bootloader asset is gone from the cache
+	err = os.Remove(filepath.Join(dirs.SnapBootAssetsDir, "grub/grubx64.efi-run-grub-hash"))
+	c.Assert(err, IsNil)
+	err = boot.CheckBootChainsForKernel(kernel, kernelFile, model)
+	c.Assert(err, ErrorMatches, `cannot compute boot chains with kernel "pc-kernel_501.snap": cannot build load chains with current boot assets: file .*/grub/grubx64.efi-run-grub-hash not found in boot assets cache`)
+
+	// not an issue when the keys are not sealed
+	err = os.Remove(filepath.Join(boot.InitramfsEncryptionKeyDir, "ubuntu-data.sealed-key"))
+	c.Assert(err, IsNil)
+	err = boot.CheckBootChainsForKernel(kernel, kernelFile, model)
+	c.Assert(err, IsNil)
+}
+
+// truncatedContainer mocks a snap file cut short, its files cannot be read to
+// their end.
+type truncatedContainer struct {
+	snap.Container
+}
+
+type truncatedFile struct {
+	size int64
+}
+
+func (f truncatedFile) ReadAt(p []byte, off int64) (int, error) { return 0, io.ErrUnexpectedEOF }
+func (f truncatedFile) Close() error                            { return nil }
+func (f truncatedFile) Size() int64                             { return f.size }
+
+func (t truncatedContainer) RandomAccessFile(path string) (interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}, error) {
+	return truncatedFile{size: 1024}, nil
+}
+
+func (s *sealSuite) TestCheckBootChainsForKernelBadKernelFile(c *C) {
+	rootdir := c.MkDir()
+	s.setupSealedSystem(c, rootdir)
+	model := makeMockUC20Model()
+	kernel := snap.MinimalPlaceInfo("pc-kernel", snap.R(501))
+
+	for _, tc := range []struct {
+		kernelFile snap.Container
+		err        string
+	}{
+		// renamed kernel boot file
+		{snaptest.MockContainer(c, [][]string{{"vmlinuz.efi", "kernel"}}), `cannot use kernel "pc-kernel_501.snap": cannot open kernel boot file kernel.efi: .*`},
+		{snaptest.MockContainer(c, [][]string{{"kernel.efi", ""}}), `cannot use kernel "pc-kernel_501.snap": kernel boot file kernel.efi is empty`},
+		{truncatedContainer{snaptest.MockContainer(c, nil)}, `cannot use kernel "pc-kernel_501.snap": cannot read kernel boot file kernel.efi: unexpected EOF`},
+	} {
+		err := boot.CheckBootChainsForKernel(kernel, tc.kernelFile, model)
+		c.Check(err, ErrorMatches, tc.err)
+	}
+}
+
+func (s *sealSuite) TestSetExtraKernelCommandLine(c *C) {
+	rootdir := c.MkDir()
+	s.setupSealedSystem(c, rootdir)
+	model := makeMockUC20Model()
+
+	var resealParams []*secboot.ResealKeyParams
+	s.AddCleanup(boot.MockSecbootResealKey(func(params *secboot.ResealKeyParams) error {
+		resealParams = append(resealParams, params)
+		return nil
+	}))
+
+	const currentCmdline = "snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1"
+	const newCmdline = "snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1 isolcpus=1 debug"
+
+	rebootRequired, err := boot.SetExtraKernelCommandLine(model, "isolcpus=1 debug")
+	c.Assert(err, IsNil)
+	c.Check(rebootRequired, Equals, true)
+
+	// the key was resealed to both the current and the new command line
+	c.Assert(resealParams, HasLen, 1)
+	c.Check(resealParams[0].KeyFile, Equals, filepath.Join(boot.InitramfsEncryptionKeyDir, "ubuntu-data.sealed-key"))
+	c.Check(resealParams[0].TPMPolicyUpdateDataFile, Equals, filepath.Join(dirs.SnapFDEDir, "policy-update-data"))
+	c.Assert(resealParams[0].ModelParams, HasLen, 1)
+	c.Check(resealParams[0].ModelParams[0].KernelCmdlines, DeepEquals, []string{
+		"snapd_recovery_mode=factory-reset snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+		"snapd_recovery_mode=recover snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+		currentCmdline,
+		newCmdline,
+	})
+	c.Check(boot.BootChainsFileUnder(rootdir), testutil.FilePresent)
+
+	modeenv, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(modeenv.CurrentKernelCommandLines, DeepEquals, boot.BootCommandLines{currentCmdline, newCmdline})
+
+	// the new command line is used for the next boot
+	cmdline, err := boot.ComposeCommandLine(model)
+	c.Assert(err, IsNil)
+	c.Check(cmdline, Equals, newCmdline)
+
+	// nothing happens when the arguments do not change
+	rebootRequired, err = boot.SetExtraKernelCommandLine(model, "isolcpus=1 debug")
+	c.Assert(err, IsNil)
+	c.Check(rebootRequired, Equals, false)
+	c.Check(resealParams, HasLen, 1)
+}
+
+func (s *sealSuite) TestSetExtraKernelCommandLineResealError(c *C) {
+	rootdir := c.MkDir()
+	s.setupSealedSystem(c, rootdir)
+	model := makeMockUC20Model()
+
+	s.AddCleanup(boot.MockSecbootResealKey(func(params *secboot.ResealKeyParams) error {
+		return errors.New("tpm error")
+	}))
+
+	_, err := boot.SetExtraKernelCommandLine(model, "debug")
+	c.Assert(err, ErrorMatches, "cannot reseal the encryption key: tpm error")
+
+	// the bootloader was not touched
+	cmdline, err := boot.ComposeCommandLine(model)
+	c.Assert(err, IsNil)
+	c.Check(cmdline, Equals, "snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1")
+}
+
+func (s *sealSuite) TestMarkCommandLineSuccessfulReseals(c *C) {
+	rootdir := c.MkDir()
+	s.setupSealedSystem(c, rootdir)
+	model := makeMockUC20Model()
+
+	var resealParams []*secboot.ResealKeyParams
+	s.AddCleanup(boot.MockSecbootResealKey(func(params *secboot.ResealKeyParams) error {
+		resealParams = append(resealParams, params)
+		return nil
+	}))
+	mockProcCmdline := filepath.Join(c.MkDir(), "cmdline")
+	s.AddCleanup(boot.MockProcCmdline(mockProcCmdline))
+
+	const currentCmdline = "snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1"
+	const newCmdline = "snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1 debug"
+	_, err := boot.SetExtraKernelCommandLine(model, "debug")
+	c.Assert(err, IsNil)
+	c.Assert(resealParams, HasLen, 1)
+
+	// booted with the previous command line, the new one is still
+	// pending
+	c.Assert(ioutil.WriteFile(mockProcCmdline, []byte(currentCmdline+"\n"), 0644), IsNil)
+	c.Assert(boot.MarkCommandLineSuccessful(model), IsNil)
+	c.Check(resealParams, HasLen, 1)
+	modeenv, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(modeenv.CurrentKernelCommandLines, DeepEquals, boot.BootCommandLines{currentCmdline, newCmdline})
+
+	// booted with the new command line, the key is resealed to it alone
+	c.Assert(ioutil.WriteFile(mockProcCmdline, []byte(newCmdline+"\n"), 0644), IsNil)
+	c.Assert(boot.MarkCommandLineSuccessful(model), IsNil)
+	c.Assert(resealParams, HasLen, 2)
+	c.Assert(resealParams[1].ModelParams, HasLen, 1)
+	c.Check(resealParams[1].ModelParams[0].KernelCmdlines, DeepEquals, []string{
+		"snapd_recovery_mode=factory-reset snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+		"snapd_recovery_mode=recover snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+		newCmdline,
+	})
+	modeenv, err = boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(modeenv.CurrentKernelCommandLines, HasLen, 0)
+
+	// nothing pending anymore
+	c.Assert(boot.MarkCommandLineSuccessful(model), IsNil)
+	c.Check(resealParams, HasLen, 2)
+}
+
+func (s *sealSuite) TestMarkCommandLineSuccessfulNoModel(c *C) {
+	rootdir := c.MkDir()
+	s.setupSealedSystem(c, rootdir)
+	model := makeMockUC20Model()
+
+	s.AddCleanup(boot.MockSecbootResealKey(func(params *secboot.ResealKeyParams) error {
+		return nil
+	}))
+	mockProcCmdline := filepath.Join(c.MkDir(), "cmdline")
+	s.AddCleanup(boot.MockProcCmdline(mockProcCmdline))
+
+	_, err := boot.SetExtraKernelCommandLine(model, "debug")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(mockProcCmdline, []byte("snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1 debug\n"), 0644), IsNil)
+
+	err = boot.MarkCommandLineSuccessful(nil)
+	c.Assert(err, ErrorMatches, "internal error: cannot reseal the encryption key without a model")
+}
+
+func (s *sealSuite) TestDumpBootChains(c *C) {
+	rootdir := c.MkDir()
+	s.setupSealedSystem(c, rootdir)
+	model := makeMockUC20Model()
+
+	var buf bytes.Buffer
+	err := boot.DumpBootChains(&buf, model, "")
+	c.Assert(err, IsNil)
+
+	var preview struct {
+		Current      boot.PredictableBootChains `json:"current-boot-chains"`
+		Predicted    boot.PredictableBootChains `json:"predicted-boot-chains"`
+		ResealNeeded bool                       `json:"reseal-needed"`
+		PCRProfiles  []struct {
+			Model          string            `json:"model"`
+			EFILoadChains  []json.RawMessage `json:"efi-load-chains"`
+			KernelCmdlines []string          `json:"kernel-cmdlines"`
+		} `json:"pcr-profiles"`
+	}
+	c.Assert(json.Unmarshal(buf.Bytes(), &preview), IsNil)
+	// nothing recorded yet
+	c.Check(preview.Current, HasLen, 0)
+	c.Check(preview.ResealNeeded, Equals, true)
+	// the recovery chain sorts first, it has fewer assets
+	c.Assert(preview.Predicted, HasLen, 2)
+	c.Check(preview.Predicted[0].Kernel, Equals, "pc-kernel")
+	c.Check(preview.Predicted[0].KernelRevision, Equals, "1")
+	c.Check(preview.Predicted[0].KernelCmdlines, DeepEquals, []string{
+		"snapd_recovery_mode=factory-reset snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+		"snapd_recovery_mode=recover snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+	})
+	c.Check(preview.Predicted[1].KernelRevision, Equals, "500")
+	c.Check(preview.Predicted[1].AssetChain, DeepEquals, []boot.BootAsset{
+		{Role: bootloader.RoleRecovery, Name: "bootx64.efi", Hashes: []string{"shim-hash"}},
+		{Role: bootloader.RoleRecovery, Name: "grubx64.efi", Hashes: []string{"grub-hash"}},
+		{Role: bootloader.RoleRunMode, Name: "grubx64.efi", Hashes: []string{"run-grub-hash"}},
+	})
+	c.Assert(preview.PCRProfiles, HasLen, 1)
+	c.Check(preview.PCRProfiles[0].Model, Equals, "my-model-uc20")
+	c.Check(preview.PCRProfiles[0].EFILoadChains, HasLen, 2)
+	c.Check(preview.PCRProfiles[0].KernelCmdlines, DeepEquals, []string{
+		"snapd_recovery_mode=factory-reset snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+		"snapd_recovery_mode=recover snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1",
+		"snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1",
+	})
+
+	// record what was predicted as the currently sealed boot chains
+	err = boot.WriteBootChains(preview.Predicted, boot.BootChainsFileUnder(rootdir))
+	c.Assert(err, IsNil)
+	buf.Reset()
+	err = boot.DumpBootChains(&buf, model, "")
+	c.Assert(err, IsNil)
+	c.Assert(json.Unmarshal(buf.Bytes(), &preview), IsNil)
+	c.Check(preview.Current, HasLen, 2)
+	c.Check(preview.ResealNeeded, Equals, false)
+
+	// a candidate kernel adds a run mode boot chain
+	buf.Reset()
+	err = boot.DumpBootChains(&buf, model, "pc-kernel_501.snap")
+	c.Assert(err, IsNil)
+	c.Assert(json.Unmarshal(buf.Bytes(), &preview), IsNil)
+	c.Check(preview.Predicted, HasLen, 3)
+	c.Check(preview.ResealNeeded, Equals, true)
+}
@@ -0,0 +1,51 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assets_test
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/bootloader/assets"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type systemdBootAssetsTestSuite struct{}
+
+var _ = Suite(&systemdBootAssetsTestSuite{})
+
+func (s *systemdBootAssetsTestSuite) TestLoaderConf(c *C) {
+	a := assets.Internal("systemd-boot-loader.conf")
+	c.Assert(a, NotNil)
+	c.Check(string(a), testutil.Contains, "timeout 3\n")
+	c.Check(string(a), testutil.Contains, "editor no\n")
+	// the default entry is written by snapd
+	c.Check(string(a), Not(testutil.Contains), "default ")
+	idx := bytes.IndexRune(a, '\n')
+	c.Assert(idx, Not(Equals), -1)
+	c.Assert(string(a[:idx]), Equals, "# Snapd-Boot-Config-Edition: 1")
+}
+
+func (s *systemdBootAssetsTestSuite) TestLoaderConfCmdlineSnippetEditions(c *C) {
+	snip := assets.SnippetForEdition("systemd-boot-loader.conf:static-cmdline", 1)
+	c.Assert(snip, NotNil)
+	c.Check(snip, DeepEquals, []byte("console=ttyS0 console=tty1 panic=-1"))
+}
@@ -24,11 +24,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/snapcore/snapd/bootloader/assets"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
 )
 
 var (
@@ -248,6 +250,27 @@ func genericUpdateBootConfigFromAssets(systemFile string, assetName string) erro
 	return osutil.AtomicWriteFile(systemFile, bc.Raw(), 0644, 0)
 }
 
+// composeKernelCommandLine returns the kernel command line composed of the
+// mode and system arguments, followed by static and extra arguments.
+func composeKernelCommandLine(staticArgs, modeArg, systemArg, extraArgs string) (string, error) {
+	args, err := strutil.KernelCommandLineSplit(staticArgs + " " + extraArgs)
+	if err != nil {
+		return "", fmt.Errorf("cannot use badly formatted kernel command line: %v", err)
+	}
+	// join all argument with a single space, see
+	// grub-core/lib/cmdline.c:grub_create_loader_cmdline() for reference,
+	// arguments are separated by a single space, the space after last is
+	// replaced with terminating NULL
+	snapdArgs := make([]string, 0, 2)
+	if modeArg != "" {
+		snapdArgs = append(snapdArgs, modeArg)
+	}
+	if systemArg != "" {
+		snapdArgs = append(snapdArgs, systemArg)
+	}
+	return strings.Join(append(snapdArgs, args...), " "), nil
+}
+
 // InstallBootConfig installs the bootloader config from the gadget
 // snap dir into the right place.
 func InstallBootConfig(gadgetDir, rootDir string, opts *Options) error {
@@ -255,7 +278,7 @@ func InstallBootConfig(gadgetDir, rootDir string, opts *Options) error {
 		return err
 	}
 	// TODO:UC20 use ForGadget() to obtain the right bootloader
-	for _, bl := range []installableBootloader{&grub{}, &uboot{}, &androidboot{}, &lk{}} {
+	for _, bl := range []installableBootloader{&grub{}, &sdboot{}, &uboot{}, &androidboot{}, &lk{}} {
 		bl.setRootDir(rootDir)
 		ok, err := bl.InstallBootConfig(gadgetDir, opts)
 		if ok {
@@ -274,6 +297,7 @@ var (
 	bootloaders = []bootloaderNewFunc{
 		newUboot,
 		newGrub,
+		newSdboot,
 		newAndroidBoot,
 		newLk,
 	}
@@ -261,6 +261,24 @@ func (s *bootenvTestSuite) TestBootloaderFind(c *C) {
 			opts:    &bootloader.Options{Role: bootloader.RoleRunMode, NoSlashBoot: true},
 			expName: "uboot",
 		},
+		{
+			// native run partition layout
+			name: "systemd-boot", sysFile: "/loader/loader.conf",
+			opts:    &bootloader.Options{Role: bootloader.RoleRunMode, NoSlashBoot: true},
+			expName: "systemd-boot",
+		},
+		{
+			// run partition mounted at runtime
+			name: "systemd-boot", sysFile: "/run/mnt/ubuntu-boot/loader/loader.conf",
+			opts:    &bootloader.Options{Role: bootloader.RoleRunMode},
+			expName: "systemd-boot",
+		},
+		{
+			// recovery layout
+			name: "systemd-boot", sysFile: "/loader/loader.conf",
+			opts:    &bootloader.Options{Role: bootloader.RoleRecovery},
+			expName: "systemd-boot",
+		},
 		{name: "androidboot", sysFile: "/boot/androidboot/androidboot.env", expName: "androidboot"},
 		// lk is detected differently based on runtime/prepare-image
 		{name: "lk", sysFile: "/dev/disk/by-partlabel/snapbootsel", expName: "lk"},
@@ -292,6 +310,7 @@ func (s *bootenvTestSuite) TestBootloaderForGadget(c *C) {
 		{name: "grub", gadgetFile: "grub.conf", expName: "grub"},
 		{name: "grub", gadgetFile: "grub.conf", opts: &bootloader.Options{Role: bootloader.RoleRunMode, NoSlashBoot: true}, expName: "grub"},
 		{name: "grub", gadgetFile: "grub.conf", opts: &bootloader.Options{Role: bootloader.RoleRecovery}, expName: "grub"},
+		{name: "systemd-boot", gadgetFile: "systemd-boot.conf", opts: &bootloader.Options{Role: bootloader.RoleRecovery}, expName: "systemd-boot"},
 		{name: "uboot", gadgetFile: "uboot.conf", expName: "uboot"},
 		{name: "androidboot", gadgetFile: "androidboot.conf", expName: "androidboot"},
 		{name: "lk", gadgetFile: "lk.conf", expName: "lk"},
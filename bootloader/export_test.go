@@ -98,6 +98,10 @@ func MockLkFiles(c *C, rootdir string, opts *Options) {
 	c.Assert(err, IsNil)
 }
 
+func NewSdboot(rootdir string, opts *Options) ExtractedRunKernelImageBootloader {
+	return newSdboot(rootdir, opts).(ExtractedRunKernelImageBootloader)
+}
+
 func LkRuntimeMode(b Bootloader) bool {
 	lk := b.(*lk)
 	return lk.inRuntimeMode
@@ -23,13 +23,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/snapcore/snapd/bootloader/assets"
 	"github.com/snapcore/snapd/bootloader/grubenv"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
-	"github.com/snapcore/snapd/strutil"
 )
 
 // sanity - grub implements the required interfaces
@@ -395,22 +393,7 @@ func (g *grub) commandLineForEdition(edition uint, modeArg, systemArg, extraArgs
 		assetName = "grub-recovery.cfg"
 	}
 	staticCmdline := staticCommandLineForGrubAssetEdition(assetName, edition)
-	args, err := strutil.KernelCommandLineSplit(staticCmdline + " " + extraArgs)
-	if err != nil {
-		return "", fmt.Errorf("cannot use badly formatted kernel command line: %v", err)
-	}
-	// join all argument with a single space, see
-	// grub-core/lib/cmdline.c:grub_create_loader_cmdline() for reference,
-	// arguments are separated by a single space, the space after last is
-	// replaced with terminating NULL
-	snapdArgs := make([]string, 0, 2)
-	if modeArg != "" {
-		snapdArgs = append(snapdArgs, modeArg)
-	}
-	if systemArg != "" {
-		snapdArgs = append(snapdArgs, systemArg)
-	}
-	return strings.Join(append(snapdArgs, args...), " "), nil
+	return composeKernelCommandLine(staticCmdline, modeArg, systemArg, extraArgs)
 }
 
 // CommandLine returns the kernel command line composed of mode and
@@ -0,0 +1,661 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package bootloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/bootloader/assets"
+	"github.com/snapcore/snapd/bootloader/grubenv"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// sanity - sdboot implements the required interfaces
+var (
+	_ Bootloader                             = (*sdboot)(nil)
+	_ installableBootloader                  = (*sdboot)(nil)
+	_ ExtractedRecoveryKernelImageBootloader = (*sdboot)(nil)
+	_ ExtractedRunKernelImageBootloader      = (*sdboot)(nil)
+	_ ManagedAssetsBootloader                = (*sdboot)(nil)
+	_ TrustedAssetsBootloader                = (*sdboot)(nil)
+)
+
+const (
+	sdbootLoaderConfAsset = "systemd-boot-loader.conf"
+
+	// the run mode entries; the try entry uses the systemd-boot boot
+	// counting, the entry is renamed by the bootloader to
+	// ubuntu-core-run-try+0-1.conf once it was attempted, and is then
+	// considered bad and never picked as the default entry again
+	sdbootRunEntry         = "ubuntu-core-run.conf"
+	sdbootTryEntry         = "ubuntu-core-run-try+1.conf"
+	sdbootTryEntryGlob     = "ubuntu-core-run-try+*.conf"
+	sdbootTriedEntry       = "ubuntu-core-run-try+0-1.conf"
+	sdbootRunDefaultEntry  = "ubuntu-core-run*"
+	sdbootRecoverEntryTmpl = "ubuntu-core-recover-%s.conf"
+	sdbootInstallEntryTmpl = "ubuntu-core-install-%s.conf"
+)
+
+// sdboot implements systemd-boot support for UC20. The systemd-boot EFI
+// binary is installed on ubuntu-seed, which is the EFI system partition, as
+// the default removable media loader. The ubuntu-boot partition is an
+// extended boot loader partition (XBOOTLDR) whose loader entries are picked up
+// by the same systemd-boot instance, thus there is no separate run mode
+// bootloader binary. All kernels are unified kernel images which are started
+// directly by systemd-boot.
+type sdboot struct {
+	rootdir string
+
+	// basedir is the location of the root of the partition the
+	// bootloader uses relative to rootdir
+	basedir string
+
+	recovery              bool
+	nativePartitionLayout bool
+}
+
+// newSdboot creates a new systemd-boot bootloader object
+func newSdboot(rootdir string, opts *Options) Bootloader {
+	s := &sdboot{rootdir: rootdir}
+	s.processOpts(opts)
+	return s
+}
+
+func (s *sdboot) processOpts(opts *Options) {
+	if opts != nil {
+		s.recovery = opts.Role == RoleRecovery
+		s.nativePartitionLayout = opts.NoSlashBoot || s.recovery
+	}
+	if s.nativePartitionLayout {
+		s.basedir = ""
+	} else {
+		// unlike grub, systemd-boot needs access to the whole
+		// ubuntu-boot partition and not just the EFI/ubuntu directory
+		s.basedir = "run/mnt/ubuntu-boot"
+	}
+}
+
+func (s *sdboot) Name() string {
+	return "systemd-boot"
+}
+
+func (s *sdboot) setRootDir(rootdir string) {
+	s.rootdir = rootdir
+}
+
+func (s *sdboot) dir() string {
+	if s.rootdir == "" {
+		panic("internal error: unset rootdir")
+	}
+	return filepath.Join(s.rootdir, s.basedir)
+}
+
+func (s *sdboot) ConfigFile() string {
+	return filepath.Join(s.dir(), "loader/loader.conf")
+}
+
+func (s *sdboot) envFile() string {
+	return filepath.Join(s.dir(), "EFI/ubuntu/sdbootenv")
+}
+
+func (s *sdboot) entriesDir() string {
+	return filepath.Join(s.dir(), "loader/entries")
+}
+
+func (s *sdboot) kernelsDir() string {
+	return filepath.Join(s.dir(), "EFI/ubuntu")
+}
+
+func (s *sdboot) InstallBootConfig(gadgetDir string, opts *Options) (bool, error) {
+	gadgetFile := filepath.Join(gadgetDir, s.Name()+".conf")
+	if !osutil.FileExists(gadgetFile) {
+		// gadget does not use systemd-boot bootloader
+		return false, nil
+	}
+	if opts == nil || opts.Role == RoleSole {
+		return true, fmt.Errorf("cannot use systemd-boot bootloader on a system without recovery")
+	}
+	// InstallBootConfig gets called on a sdboot that does not come from
+	// newSdboot so we need to apply the options here
+	s.processOpts(opts)
+	// there is no default entry until the boot variables get set
+	return true, s.writeLoaderConf("")
+}
+
+func (s *sdboot) writeLoaderConf(defaultEntry string) error {
+	loaderConf := assets.Internal(sdbootLoaderConfAsset)
+	if loaderConf == nil {
+		return fmt.Errorf("internal error: no boot asset for %q", sdbootLoaderConfAsset)
+	}
+	var buf bytes.Buffer
+	buf.Write(loaderConf)
+	if defaultEntry != "" {
+		fmt.Fprintf(&buf, "default %s\n", defaultEntry)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.ConfigFile()), 0755); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(s.ConfigFile(), buf.Bytes(), 0644, 0)
+}
+
+func (s *sdboot) loadEnv() (*grubenv.Env, error) {
+	env := grubenv.NewEnv(s.envFile())
+	if err := env.Load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (s *sdboot) GetBootVars(names ...string) (map[string]string, error) {
+	out := make(map[string]string)
+
+	env := grubenv.NewEnv(s.envFile())
+	if err := env.Load(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		value := env.Get(name)
+		if name == "kernel_status" && value == "try" && !s.recovery {
+			// systemd-boot does not modify the environment, but
+			// the try entry gets renamed when the bootloader
+			// attempts to boot it
+			if osutil.FileExists(filepath.Join(s.entriesDir(), sdbootTriedEntry)) {
+				value = "trying"
+			}
+		}
+		out[name] = value
+	}
+
+	return out, nil
+}
+
+func (s *sdboot) SetBootVars(values map[string]string) error {
+	env, err := s.loadEnv()
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		env.Set(k, v)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.envFile()), 0755); err != nil {
+		return err
+	}
+	if err := env.Save(); err != nil {
+		return err
+	}
+
+	if s.recovery {
+		_, hasMode := values["snapd_recovery_mode"]
+		_, hasSystem := values["snapd_recovery_system"]
+		if !hasMode && !hasSystem {
+			return nil
+		}
+		return s.writeLoaderConf(defaultEntryFromEnv(env))
+	}
+	if _, ok := values["snapd_extra_cmdline_args"]; ok {
+		// the command line is part of the entries
+		return s.rewriteRunEntries(env)
+	}
+	return nil
+}
+
+// defaultEntryFromEnv returns the pattern of the loader entry systemd-boot
+// should boot by default, given the recovery mode and system set in the
+// environment.
+func defaultEntryFromEnv(env *grubenv.Env) string {
+	system := env.Get("snapd_recovery_system")
+	switch env.Get("snapd_recovery_mode") {
+	case "run":
+		// picks the try entry while it has tries left
+		return sdbootRunDefaultEntry
+	case "recover":
+		if system == "" {
+			return ""
+		}
+		return fmt.Sprintf(sdbootRecoverEntryTmpl, system)
+	default:
+		// unset mode means install
+		if system == "" {
+			return ""
+		}
+		return fmt.Sprintf(sdbootInstallEntryTmpl, system)
+	}
+}
+
+type sdbootEntry struct {
+	title   string
+	efi     string
+	options string
+}
+
+func (s *sdboot) writeEntry(name string, entry *sdbootEntry) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "title %s\n", entry.title)
+	fmt.Fprintf(&buf, "efi %s\n", entry.efi)
+	if entry.options != "" {
+		fmt.Fprintf(&buf, "options %s\n", entry.options)
+	}
+	if err := os.MkdirAll(s.entriesDir(), 0755); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(filepath.Join(s.entriesDir(), name), buf.Bytes(), 0644, 0)
+}
+
+// readEntryEFI returns the path of the EFI binary booted by a given entry.
+func (s *sdboot) readEntryEFI(name string) (string, error) {
+	f, err := os.Open(filepath.Join(s.entriesDir(), name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "efi" {
+			return fields[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("cannot find EFI binary in loader entry %s", name)
+}
+
+func (s *sdboot) ExtractKernelAssets(sn snap.PlaceInfo, snapf snap.Container) error {
+	// the kernel is a unified kernel image carrying the initrd
+	return extractKernelAssetsToBootDir(
+		filepath.Join(s.kernelsDir(), sn.Filename()),
+		snapf,
+		[]string{"kernel.efi"},
+	)
+}
+
+func (s *sdboot) RemoveKernelAssets(sn snap.PlaceInfo) error {
+	return removeKernelAssetsFromBootDir(s.kernelsDir(), sn)
+}
+
+// ExtractRecoveryKernelAssets extracts the kernel of a recovery system next to
+// the recovery system and adds loader entries for booting the system in the
+// recover and install modes.
+//
+// Implements ExtractedRecoveryKernelImageBootloader for the systemd-boot
+// bootloader.
+func (s *sdboot) ExtractRecoveryKernelAssets(recoverySystemDir string, sn snap.PlaceInfo, snapf snap.Container) error {
+	if recoverySystemDir == "" {
+		return fmt.Errorf("internal error: recoverySystemDir unset")
+	}
+
+	kernelDir := filepath.Join(s.dir(), recoverySystemDir)
+	if err := extractKernelAssetsToBootDir(kernelDir, snapf, []string{"kernel.efi"}); err != nil {
+		return err
+	}
+	return s.writeRecoverySystemEntries(recoverySystemDir)
+}
+
+func (s *sdboot) writeRecoverySystemEntries(recoverySystemDir string) error {
+	label := filepath.Base(recoverySystemDir)
+	kernel := filepath.Join("/", recoverySystemDir, "kernel.efi")
+	systemArg := fmt.Sprintf("snapd_recovery_system=%s", label)
+	for _, mode := range []struct {
+		mode string
+		tmpl string
+	}{
+		{"recover", sdbootRecoverEntryTmpl},
+		{"install", sdbootInstallEntryTmpl},
+	} {
+		cmdline, err := s.CommandLine("snapd_recovery_mode="+mode.mode, systemArg, "")
+		if err != nil {
+			return err
+		}
+		entry := &sdbootEntry{
+			title:   fmt.Sprintf("Ubuntu Core 20 (%s %s)", mode.mode, label),
+			efi:     kernel,
+			options: cmdline,
+		}
+		if err := s.writeEntry(fmt.Sprintf(mode.tmpl, label), entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sdboot) writeKernelEntry(name, title string, sn snap.PlaceInfo, extraArgs string) error {
+	// check that the kernel snap has been extracted already so we don't
+	// inadvertently create an entry for a missing kernel
+	kernel := filepath.Join(sn.Filename(), "kernel.efi")
+	if !osutil.FileExists(filepath.Join(s.kernelsDir(), kernel)) {
+		return fmt.Errorf("cannot enable %s at %s: %v", title, kernel, os.ErrNotExist)
+	}
+	cmdline, err := s.CommandLine("snapd_recovery_mode=run", "", extraArgs)
+	if err != nil {
+		return err
+	}
+	entry := &sdbootEntry{
+		title:   fmt.Sprintf("Ubuntu Core 20 (%s)", title),
+		efi:     filepath.Join("/EFI/ubuntu", kernel),
+		options: cmdline,
+	}
+	return s.writeEntry(name, entry)
+}
+
+func (s *sdboot) extraCmdlineArgs() (string, error) {
+	env, err := s.loadEnv()
+	if err != nil {
+		return "", err
+	}
+	return env.Get("snapd_extra_cmdline_args"), nil
+}
+
+// rewriteRunEntries regenerates the loader entries of the current and the try
+// kernels, for instance after the kernel command line changed.
+func (s *sdboot) rewriteRunEntries(env *grubenv.Env) error {
+	extraArgs := env.Get("snapd_extra_cmdline_args")
+	kernel, err := s.Kernel()
+	if err != nil {
+		if os.IsNotExist(err) {
+			// no kernel enabled yet
+			return nil
+		}
+		return err
+	}
+	if err := s.writeKernelEntry(sdbootRunEntry, "run", kernel, extraArgs); err != nil {
+		return err
+	}
+	tryEntry, err := s.tryEntry()
+	if err != nil || tryEntry == "" {
+		return err
+	}
+	tryKernel, err := s.kernelFromEntry(tryEntry)
+	if err != nil {
+		return err
+	}
+	// keep the name, so that the boot counting state is preserved
+	return s.writeKernelEntry(tryEntry, "try", tryKernel, extraArgs)
+}
+
+func (s *sdboot) tryEntry() (string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.entriesDir(), sdbootTryEntryGlob))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+	sort.Strings(matches)
+	return filepath.Base(matches[0]), nil
+}
+
+func (s *sdboot) kernelFromEntry(name string) (snap.PlaceInfo, error) {
+	efi, err := s.readEntryEFI(name)
+	if err != nil {
+		return nil, err
+	}
+	kernelSnapFileName := filepath.Base(filepath.Dir(efi))
+	sn, err := snap.ParsePlaceInfoFromSnapFileName(kernelSnapFileName)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"cannot parse kernel snap file name from loader entry %s %q: %v",
+			name,
+			kernelSnapFileName,
+			err,
+		)
+	}
+	return sn, nil
+}
+
+// EnableKernel writes the loader entry of the run mode kernel, pointing to the
+// extracted image of the referenced kernel snap. EnableKernel() will fail if
+// the referenced kernel snap was not extracted.
+func (s *sdboot) EnableKernel(sn snap.PlaceInfo) error {
+	extraArgs, err := s.extraCmdlineArgs()
+	if err != nil {
+		return err
+	}
+	return s.writeKernelEntry(sdbootRunEntry, "run", sn, extraArgs)
+}
+
+// EnableTryKernel writes a loader entry with boot counting for the try-kernel,
+// which systemd-boot picks over the run mode kernel entry on the next boot.
+// EnableTryKernel() will fail if the referenced kernel snap was not extracted.
+func (s *sdboot) EnableTryKernel(sn snap.PlaceInfo) error {
+	extraArgs, err := s.extraCmdlineArgs()
+	if err != nil {
+		return err
+	}
+	// drop any leftover entries with stale boot counting
+	if err := s.DisableTryKernel(); err != nil {
+		return err
+	}
+	return s.writeKernelEntry(sdbootTryEntry, "try", sn, extraArgs)
+}
+
+// DisableTryKernel removes the try-kernel entry in all its boot counting
+// variants.
+func (s *sdboot) DisableTryKernel() error {
+	matches, err := filepath.Glob(filepath.Join(s.entriesDir(), sdbootTryEntryGlob))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Kernel returns the kernel snap referenced by the run mode loader entry.
+func (s *sdboot) Kernel() (snap.PlaceInfo, error) {
+	return s.kernelFromEntry(sdbootRunEntry)
+}
+
+// TryKernel returns the kernel snap referenced by the try-kernel loader entry
+// or ErrNoTryKernelRef when there is none.
+func (s *sdboot) TryKernel() (snap.PlaceInfo, error) {
+	tryEntry, err := s.tryEntry()
+	if err != nil {
+		return nil, err
+	}
+	if tryEntry == "" {
+		return nil, ErrNoTryKernelRef
+	}
+	return s.kernelFromEntry(tryEntry)
+}
+
+// UpdateBootConfig updates the loader configuration and regenerates the
+// loader entries only if the configuration is already managed and has a
+// lower edition.
+//
+// Implements ManagedAssetsBootloader for the systemd-boot bootloader.
+func (s *sdboot) UpdateBootConfig(opts *Options) error {
+	currentEdition, err := editionFromDiskConfigAsset(s.ConfigFile())
+	if err != nil && err != errNoEdition {
+		return err
+	}
+	if err == errNoEdition {
+		return nil
+	}
+	newEdition, err := editionFromInternalConfigAsset(sdbootLoaderConfAsset)
+	if err != nil {
+		return err
+	}
+	if newEdition <= currentEdition {
+		// edition of the candidate boot config is lower than or equal
+		// to one currently installed
+		return nil
+	}
+	env, err := s.loadEnv()
+	if err != nil {
+		return err
+	}
+	if s.recovery {
+		if err := s.writeLoaderConf(defaultEntryFromEnv(env)); err != nil {
+			return err
+		}
+		// the static command line may have changed too
+		systems, err := filepath.Glob(filepath.Join(s.dir(), "systems/*/kernel.efi"))
+		if err != nil {
+			return err
+		}
+		for _, kernel := range systems {
+			systemDir, err := filepath.Rel(s.dir(), filepath.Dir(kernel))
+			if err != nil {
+				return err
+			}
+			if err := s.writeRecoverySystemEntries(systemDir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := s.writeLoaderConf(""); err != nil {
+		return err
+	}
+	return s.rewriteRunEntries(env)
+}
+
+// IsCurrentlyManaged returns true when the boot config is managed by snapd.
+//
+// Implements ManagedAssetsBootloader for the systemd-boot bootloader.
+func (s *sdboot) IsCurrentlyManaged() (bool, error) {
+	_, err := editionFromDiskConfigAsset(s.ConfigFile())
+	if err != nil && err != errNoEdition {
+		return false, err
+	}
+	return err != errNoEdition, nil
+}
+
+// ManagedAssets returns a list relative paths to boot assets inside the root
+// directory of the filesystem.
+//
+// Implements ManagedAssetsBootloader for the systemd-boot bootloader.
+func (s *sdboot) ManagedAssets() []string {
+	return []string{
+		filepath.Join(s.basedir, "loader/loader.conf"),
+	}
+}
+
+// CommandLine returns the kernel command line composed of mode and
+// system arguments, built-in bootloader specific static arguments
+// corresponding to the on-disk boot asset edition, followed by any
+// extra arguments.
+//
+// Implements ManagedAssetsBootloader for the systemd-boot bootloader.
+func (s *sdboot) CommandLine(modeArg, systemArg, extraArgs string) (string, error) {
+	edition, err := editionFromDiskConfigAsset(s.ConfigFile())
+	if err != nil {
+		if err != errNoEdition {
+			return "", fmt.Errorf("cannot obtain edition number of current boot config: %v", err)
+		}
+		// the loader configuration is always written by snapd, use
+		// the initial edition of the internal asset
+		edition = 1
+	}
+	return s.commandLineForEdition(edition, modeArg, systemArg, extraArgs)
+}
+
+// CandidateCommandLine is similar to CommandLine, but uses the current
+// edition of managed built-in boot assets as reference.
+//
+// Implements ManagedAssetsBootloader for the systemd-boot bootloader.
+func (s *sdboot) CandidateCommandLine(modeArg, systemArg, extraArgs string) (string, error) {
+	edition, err := editionFromInternalConfigAsset(sdbootLoaderConfAsset)
+	if err != nil {
+		return "", err
+	}
+	return s.commandLineForEdition(edition, modeArg, systemArg, extraArgs)
+}
+
+func (s *sdboot) commandLineForEdition(edition uint, modeArg, systemArg, extraArgs string) (string, error) {
+	var staticCmdline string
+	snippet := assets.SnippetForEdition(sdbootLoaderConfAsset+":static-cmdline", edition)
+	if snippet != nil {
+		staticCmdline = string(snippet)
+	}
+	return composeKernelCommandLine(staticCmdline, modeArg, systemArg, extraArgs)
+}
+
+var (
+	// systemd-boot installed as the removable media loader
+	sdbootRecoveryModeTrustedAssets = []string{
+		"EFI/boot/bootx64.efi",
+	}
+)
+
+// TrustedAssets returns the list of relative paths to assets inside
+// the bootloader's rootdir that are measured in the boot process in the
+// order of loading during the boot. The run mode kernels are loaded by the
+// systemd-boot binary of the recovery partition, thus there are no run mode
+// trusted assets.
+func (s *sdboot) TrustedAssets() ([]string, error) {
+	if !s.nativePartitionLayout {
+		return nil, fmt.Errorf("internal error: trusted assets called without native host-partition layout")
+	}
+	if s.recovery {
+		return sdbootRecoveryModeTrustedAssets, nil
+	}
+	return nil, nil
+}
+
+// RecoveryBootChain returns the load chain for recovery modes.
+// It should be called on a RoleRecovery bootloader.
+func (s *sdboot) RecoveryBootChain(kernelPath string) ([]BootFile, error) {
+	if !s.recovery {
+		return nil, fmt.Errorf("not a recovery bootloader")
+	}
+
+	chain := make([]BootFile, 0, len(sdbootRecoveryModeTrustedAssets)+1)
+	for _, ta := range sdbootRecoveryModeTrustedAssets {
+		chain = append(chain, NewBootFile("", ta, RoleRecovery))
+	}
+	chain = append(chain, NewBootFile(kernelPath, "kernel.efi", RoleRecovery))
+
+	return chain, nil
+}
+
+// BootChain returns the load chain for run mode.
+// It should be called on a RoleRecovery bootloader passing the
+// RoleRunMode bootloader.
+func (s *sdboot) BootChain(runBl Bootloader, kernelPath string) ([]BootFile, error) {
+	if !s.recovery {
+		return nil, fmt.Errorf("not a recovery bootloader")
+	}
+	if runBl.Name() != s.Name() {
+		return nil, fmt.Errorf("run mode bootloader must be systemd-boot")
+	}
+
+	// the run mode kernel is loaded directly by the recovery bootloader
+	chain := make([]BootFile, 0, len(sdbootRecoveryModeTrustedAssets)+1)
+	for _, ta := range sdbootRecoveryModeTrustedAssets {
+		chain = append(chain, NewBootFile("", ta, RoleRecovery))
+	}
+	chain = append(chain, NewBootFile(kernelPath, "kernel.efi", RoleRunMode))
+
+	return chain, nil
+}
@@ -0,0 +1,365 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package bootloader_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/bootloader/assets"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapfile"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type sdbootTestSuite struct {
+	baseBootenvTestSuite
+}
+
+var _ = Suite(&sdbootTestSuite{})
+
+var (
+	sdbootRunOpts      = &bootloader.Options{Role: bootloader.RoleRunMode, NoSlashBoot: true}
+	sdbootRecoveryOpts = &bootloader.Options{Role: bootloader.RoleRecovery}
+)
+
+func (s *sdbootTestSuite) entry(name string) string {
+	return filepath.Join(s.rootdir, "loader/entries", name)
+}
+
+func (s *sdbootTestSuite) installBootConfig(c *C, opts *bootloader.Options) {
+	gadgetDir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(gadgetDir, "systemd-boot.conf"), nil, 0644)
+	c.Assert(err, IsNil)
+	err = bootloader.InstallBootConfig(gadgetDir, s.rootdir, opts)
+	c.Assert(err, IsNil)
+}
+
+func (s *sdbootTestSuite) makeKernelSnapFile(c *C, rev int) (*snap.Info, snap.Container) {
+	files := [][]string{
+		{"kernel.efi", "I'm a unified kernel image"},
+		{"meta/kernel.yaml", "version: 4.2"},
+	}
+	si := &snap.SideInfo{
+		RealName: "ubuntu-kernel",
+		Revision: snap.R(rev),
+	}
+	fn := snaptest.MakeTestSnapWithFiles(c, packageKernel, files)
+	snapf, err := snapfile.Open(fn)
+	c.Assert(err, IsNil)
+	info, err := snap.ReadInfoFromSnapFile(snapf, si)
+	c.Assert(err, IsNil)
+	return info, snapf
+}
+
+func (s *sdbootTestSuite) TestNewSdboot(c *C) {
+	b := bootloader.NewSdboot(s.rootdir, sdbootRunOpts)
+	c.Assert(b, NotNil)
+	c.Check(b.Name(), Equals, "systemd-boot")
+	c.Check(b.ConfigFile(), Equals, filepath.Join(s.rootdir, "loader/loader.conf"))
+
+	// run partition mounted at runtime
+	b = bootloader.NewSdboot(s.rootdir, &bootloader.Options{Role: bootloader.RoleRunMode})
+	c.Check(b.ConfigFile(), Equals, filepath.Join(s.rootdir, "run/mnt/ubuntu-boot/loader/loader.conf"))
+}
+
+func (s *sdbootTestSuite) TestInstallBootConfig(c *C) {
+	for _, opts := range []*bootloader.Options{sdbootRunOpts, sdbootRecoveryOpts} {
+		s.installBootConfig(c, opts)
+		c.Check(filepath.Join(s.rootdir, "loader/loader.conf"), testutil.FileEquals,
+			string(assets.Internal("systemd-boot-loader.conf")))
+	}
+}
+
+func (s *sdbootTestSuite) TestInstallBootConfigNoRecoveryErr(c *C) {
+	gadgetDir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(gadgetDir, "systemd-boot.conf"), nil, 0644)
+	c.Assert(err, IsNil)
+	err = bootloader.InstallBootConfig(gadgetDir, s.rootdir, nil)
+	c.Assert(err, ErrorMatches, "cannot use systemd-boot bootloader on a system without recovery")
+}
+
+func (s *sdbootTestSuite) TestRecoverySetBootVarsDefaultEntry(c *C) {
+	s.installBootConfig(c, sdbootRecoveryOpts)
+	b := bootloader.NewSdboot(s.rootdir, sdbootRecoveryOpts)
+
+	loaderConf := string(assets.Internal("systemd-boot-loader.conf"))
+	for _, tc := range []struct {
+		vars         map[string]string
+		defaultEntry string
+	}{
+		{map[string]string{"snapd_recovery_system": "20200825"}, "ubuntu-core-install-20200825.conf"},
+		{map[string]string{"snapd_recovery_mode": "run"}, "ubuntu-core-run*"},
+		{map[string]string{"snapd_recovery_mode": "recover"}, "ubuntu-core-recover-20200825.conf"},
+		{map[string]string{"snapd_recovery_mode": "install", "snapd_recovery_system": "20201010"}, "ubuntu-core-install-20201010.conf"},
+	} {
+		err := b.SetBootVars(tc.vars)
+		c.Assert(err, IsNil)
+		c.Check(b.ConfigFile(), testutil.FileEquals, loaderConf+"default "+tc.defaultEntry+"\n")
+	}
+
+	vars, err := b.GetBootVars("snapd_recovery_mode", "snapd_recovery_system")
+	c.Assert(err, IsNil)
+	c.Check(vars, DeepEquals, map[string]string{
+		"snapd_recovery_mode":   "install",
+		"snapd_recovery_system": "20201010",
+	})
+}
+
+func (s *sdbootTestSuite) TestExtractRecoveryKernelAssets(c *C) {
+	s.installBootConfig(c, sdbootRecoveryOpts)
+	b := bootloader.NewSdboot(s.rootdir, sdbootRecoveryOpts)
+	erb, ok := b.(bootloader.ExtractedRecoveryKernelImageBootloader)
+	c.Assert(ok, Equals, true)
+
+	info, snapf := s.makeKernelSnapFile(c, 42)
+
+	err := erb.ExtractRecoveryKernelAssets("", info, snapf)
+	c.Assert(err, ErrorMatches, "internal error: recoverySystemDir unset")
+
+	err = erb.ExtractRecoveryKernelAssets("systems/20200825", info, snapf)
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(s.rootdir, "systems/20200825/kernel.efi"), testutil.FileEquals, "I'm a unified kernel image")
+	c.Check(s.entry("ubuntu-core-recover-20200825.conf"), testutil.FileEquals, `title Ubuntu Core 20 (recover 20200825)
+efi /systems/20200825/kernel.efi
+options snapd_recovery_mode=recover snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1
+`)
+	c.Check(s.entry("ubuntu-core-install-20200825.conf"), testutil.FileEquals, `title Ubuntu Core 20 (install 20200825)
+efi /systems/20200825/kernel.efi
+options snapd_recovery_mode=install snapd_recovery_system=20200825 console=ttyS0 console=tty1 panic=-1
+`)
+}
+
+func (s *sdbootTestSuite) TestEnableKernel(c *C) {
+	s.installBootConfig(c, sdbootRunOpts)
+	b := bootloader.NewSdboot(s.rootdir, sdbootRunOpts)
+
+	info, snapf := s.makeKernelSnapFile(c, 42)
+
+	// not extracted yet
+	err := b.EnableKernel(info)
+	c.Assert(err, ErrorMatches, "cannot enable run at ubuntu-kernel_42.snap/kernel.efi: file does not exist")
+
+	err = b.ExtractKernelAssets(info, snapf)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.rootdir, "EFI/ubuntu/ubuntu-kernel_42.snap/kernel.efi"), testutil.FileEquals, "I'm a unified kernel image")
+
+	err = b.EnableKernel(info)
+	c.Assert(err, IsNil)
+	c.Check(s.entry("ubuntu-core-run.conf"), testutil.FileEquals, `title Ubuntu Core 20 (run)
+efi /EFI/ubuntu/ubuntu-kernel_42.snap/kernel.efi
+options snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1
+`)
+
+	kernel, err := b.Kernel()
+	c.Assert(err, IsNil)
+	c.Check(kernel.Filename(), Equals, "ubuntu-kernel_42.snap")
+
+	_, err = b.TryKernel()
+	c.Assert(err, Equals, bootloader.ErrNoTryKernelRef)
+
+	err = b.RemoveKernelAssets(info)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(s.rootdir, "EFI/ubuntu/ubuntu-kernel_42.snap"), testutil.FileAbsent)
+}
+
+func (s *sdbootTestSuite) TestTryKernelBootCounting(c *C) {
+	s.installBootConfig(c, sdbootRunOpts)
+	b := bootloader.NewSdboot(s.rootdir, sdbootRunOpts)
+
+	info, snapf := s.makeKernelSnapFile(c, 1)
+	tryInfo, trySnapf := s.makeKernelSnapFile(c, 2)
+	c.Assert(b.ExtractKernelAssets(info, snapf), IsNil)
+	c.Assert(b.ExtractKernelAssets(tryInfo, trySnapf), IsNil)
+	c.Assert(b.EnableKernel(info), IsNil)
+
+	err := b.EnableTryKernel(tryInfo)
+	c.Assert(err, IsNil)
+	err = b.SetBootVars(map[string]string{"kernel_status": "try"})
+	c.Assert(err, IsNil)
+
+	c.Check(s.entry("ubuntu-core-run-try+1.conf"), testutil.FileEquals, `title Ubuntu Core 20 (try)
+efi /EFI/ubuntu/ubuntu-kernel_2.snap/kernel.efi
+options snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1
+`)
+	tryKernel, err := b.TryKernel()
+	c.Assert(err, IsNil)
+	c.Check(tryKernel.Filename(), Equals, "ubuntu-kernel_2.snap")
+
+	vars, err := b.GetBootVars("kernel_status")
+	c.Assert(err, IsNil)
+	c.Check(vars, DeepEquals, map[string]string{"kernel_status": "try"})
+
+	// systemd-boot attempts the entry
+	err = os.Rename(s.entry("ubuntu-core-run-try+1.conf"), s.entry("ubuntu-core-run-try+0-1.conf"))
+	c.Assert(err, IsNil)
+
+	vars, err = b.GetBootVars("kernel_status")
+	c.Assert(err, IsNil)
+	c.Check(vars, DeepEquals, map[string]string{"kernel_status": "trying"})
+
+	// the entry is still found
+	tryKernel, err = b.TryKernel()
+	c.Assert(err, IsNil)
+	c.Check(tryKernel.Filename(), Equals, "ubuntu-kernel_2.snap")
+
+	err = b.DisableTryKernel()
+	c.Assert(err, IsNil)
+	c.Check(s.entry("ubuntu-core-run-try+0-1.conf"), testutil.FileAbsent)
+	_, err = b.TryKernel()
+	c.Assert(err, Equals, bootloader.ErrNoTryKernelRef)
+
+	// disabling again is fine
+	err = b.DisableTryKernel()
+	c.Assert(err, IsNil)
+}
+
+func (s *sdbootTestSuite) TestExtraCmdlineArgsRewritesEntries(c *C) {
+	s.installBootConfig(c, sdbootRunOpts)
+	b := bootloader.NewSdboot(s.rootdir, sdbootRunOpts)
+
+	info, snapf := s.makeKernelSnapFile(c, 1)
+	tryInfo, trySnapf := s.makeKernelSnapFile(c, 2)
+	c.Assert(b.ExtractKernelAssets(info, snapf), IsNil)
+	c.Assert(b.ExtractKernelAssets(tryInfo, trySnapf), IsNil)
+	c.Assert(b.EnableKernel(info), IsNil)
+	c.Assert(b.EnableTryKernel(tryInfo), IsNil)
+	// already attempted by the bootloader
+	err := os.Rename(s.entry("ubuntu-core-run-try+1.conf"), s.entry("ubuntu-core-run-try+0-1.conf"))
+	c.Assert(err, IsNil)
+
+	err = b.SetBootVars(map[string]string{"snapd_extra_cmdline_args": "isolcpus=1"})
+	c.Assert(err, IsNil)
+
+	c.Check(s.entry("ubuntu-core-run.conf"), testutil.FileContains,
+		"options snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1 isolcpus=1\n")
+	// boot counting state is kept
+	c.Check(s.entry("ubuntu-core-run-try+0-1.conf"), testutil.FileContains,
+		"options snapd_recovery_mode=run console=ttyS0 console=tty1 panic=-1 isolcpus=1\n")
+}
+
+func (s *sdbootTestSuite) TestCommandLine(c *C) {
+	s.installBootConfig(c, sdbootRecoveryOpts)
+	b := bootloader.NewSdboot(s.rootdir, sdbootRecoveryOpts)
+	mb, ok := b.(bootloader.ManagedAssetsBootloader)
+	c.Assert(ok, Equals, true)
+
+	restore := assets.MockSnippetsForEdition("systemd-boot-loader.conf:static-cmdline", []assets.ForEditions{
+		{FirstEdition: 1, Snippet: []byte("static=1")},
+		{FirstEdition: 2, Snippet: []byte("static=2")},
+	})
+	defer restore()
+	restore = assets.MockInternal("systemd-boot-loader.conf", []byte("# Snapd-Boot-Config-Edition: 2\n"))
+	defer restore()
+
+	cmdline, err := mb.CommandLine("snapd_recovery_mode=recover", "snapd_recovery_system=1234", "extra")
+	c.Assert(err, IsNil)
+	c.Check(cmdline, Equals, "snapd_recovery_mode=recover snapd_recovery_system=1234 static=1 extra")
+
+	cmdline, err = mb.CandidateCommandLine("snapd_recovery_mode=run", "", "")
+	c.Assert(err, IsNil)
+	c.Check(cmdline, Equals, "snapd_recovery_mode=run static=2")
+}
+
+func (s *sdbootTestSuite) TestUpdateBootConfig(c *C) {
+	s.installBootConfig(c, sdbootRecoveryOpts)
+	b := bootloader.NewSdboot(s.rootdir, sdbootRecoveryOpts)
+	info, snapf := s.makeKernelSnapFile(c, 1)
+	erb := b.(bootloader.ExtractedRecoveryKernelImageBootloader)
+	c.Assert(erb.ExtractRecoveryKernelAssets("systems/20200825", info, snapf), IsNil)
+	c.Assert(b.SetBootVars(map[string]string{"snapd_recovery_mode": "run"}), IsNil)
+
+	mb := b.(bootloader.ManagedAssetsBootloader)
+	managed, err := mb.IsCurrentlyManaged()
+	c.Assert(err, IsNil)
+	c.Check(managed, Equals, true)
+	c.Check(mb.ManagedAssets(), DeepEquals, []string{"loader/loader.conf"})
+
+	// same edition, nothing changes
+	err = mb.UpdateBootConfig(sdbootRecoveryOpts)
+	c.Assert(err, IsNil)
+
+	restore := assets.MockInternal("systemd-boot-loader.conf", []byte("# Snapd-Boot-Config-Edition: 2\ntimeout 0\n"))
+	defer restore()
+	restore = assets.MockSnippetsForEdition("systemd-boot-loader.conf:static-cmdline", []assets.ForEditions{
+		{FirstEdition: 1, Snippet: []byte("static=1")},
+		{FirstEdition: 2, Snippet: []byte("static=2")},
+	})
+	defer restore()
+
+	err = mb.UpdateBootConfig(sdbootRecoveryOpts)
+	c.Assert(err, IsNil)
+	// default entry is preserved
+	c.Check(b.ConfigFile(), testutil.FileEquals, "# Snapd-Boot-Config-Edition: 2\ntimeout 0\ndefault ubuntu-core-run*\n")
+	// and the entries use the new command line
+	c.Check(s.entry("ubuntu-core-recover-20200825.conf"), testutil.FileContains,
+		"options snapd_recovery_mode=recover snapd_recovery_system=20200825 static=2\n")
+}
+
+func (s *sdbootTestSuite) TestTrustedAssets(c *C) {
+	rb := bootloader.NewSdboot(s.rootdir, sdbootRecoveryOpts).(bootloader.TrustedAssetsBootloader)
+	ta, err := rb.TrustedAssets()
+	c.Assert(err, IsNil)
+	c.Check(ta, DeepEquals, []string{"EFI/boot/bootx64.efi"})
+
+	// run mode kernels are loaded by systemd-boot on the recovery partition
+	b := bootloader.NewSdboot(s.rootdir, sdbootRunOpts).(bootloader.TrustedAssetsBootloader)
+	ta, err = b.TrustedAssets()
+	c.Assert(err, IsNil)
+	c.Check(ta, HasLen, 0)
+
+	b = bootloader.NewSdboot(s.rootdir, &bootloader.Options{Role: bootloader.RoleRunMode}).(bootloader.TrustedAssetsBootloader)
+	_, err = b.TrustedAssets()
+	c.Assert(err, ErrorMatches, "internal error: trusted assets called without native host-partition layout")
+}
+
+func (s *sdbootTestSuite) TestBootChains(c *C) {
+	runBl := bootloader.NewSdboot(s.rootdir, sdbootRunOpts)
+	rb := bootloader.NewSdboot(s.rootdir, sdbootRecoveryOpts).(bootloader.TrustedAssetsBootloader)
+
+	chain, err := rb.RecoveryBootChain("kernel.snap")
+	c.Assert(err, IsNil)
+	c.Check(chain, DeepEquals, []bootloader.BootFile{
+		{Path: "EFI/boot/bootx64.efi", Role: bootloader.RoleRecovery},
+		{Snap: "kernel.snap", Path: "kernel.efi", Role: bootloader.RoleRecovery},
+	})
+
+	chain, err = rb.BootChain(runBl, "kernel.snap")
+	c.Assert(err, IsNil)
+	c.Check(chain, DeepEquals, []bootloader.BootFile{
+		{Path: "EFI/boot/bootx64.efi", Role: bootloader.RoleRecovery},
+		{Snap: "kernel.snap", Path: "kernel.efi", Role: bootloader.RoleRunMode},
+	})
+
+	_, err = rb.BootChain(bootloader.NewGrub(s.rootdir, nil), "kernel.snap")
+	c.Assert(err, ErrorMatches, "run mode bootloader must be systemd-boot")
+
+	b := runBl.(bootloader.TrustedAssetsBootloader)
+	_, err = b.BootChain(runBl, "kernel.snap")
+	c.Assert(err, ErrorMatches, "not a recovery bootloader")
+	_, err = b.RecoveryBootChain("kernel.snap")
+	c.Assert(err, ErrorMatches, "not a recovery bootloader")
+}
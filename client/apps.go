@@ -22,7 +22,6 @@ package client
 import (
 	"bufio"
 	"bytes"
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -52,6 +51,13 @@ type AppInfo struct {
 	Active      bool           `json:"active,omitempty"`
 	CommonID    string         `json:"common-id,omitempty"`
 	Activators  []AppActivator `json:"activators,omitempty"`
+	// Health is the health of a service as found by its health probe.
+	Health *SnapHealth `json:"health,omitempty"`
+	// Restarts is the number of times systemd restarted a service
+	// since it was last started otherwise.
+	Restarts int `json:"restarts,omitempty"`
+	// CrashLoop is set if a service keeps being restarted.
+	CrashLoop bool `json:"crash-loop,omitempty"`
 }
 
 // IsService returns true if the application is a background daemon.
@@ -120,7 +126,7 @@ func (client *Client) Logs(names []string, opts LogOptions) (<-chan Log, error)
 		query.Set("follow", strconv.FormatBool(opts.Follow))
 	}
 
-	rsp, err := client.raw(context.Background(), "GET", "/v2/logs", query, nil, nil)
+	rsp, err := client.raw(client.context(), "GET", "/v2/logs", query, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +84,7 @@ func (client *Client) Known(assertTypeName string, headers map[string]string, op
 		q.Set("remote", "true")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), doTimeout)
+	ctx, cancel := context.WithTimeout(client.context(), doTimeout)
 	defer cancel()
 	response, err := client.raw(ctx, "GET", path, q, nil, nil)
 	if err != nil {
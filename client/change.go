@@ -24,6 +24,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -39,6 +41,9 @@ type Change struct {
 
 	SpawnTime time.Time `json:"spawn-time,omitempty"`
 	ReadyTime time.Time `json:"ready-time,omitempty"`
+	// NotBefore is set when the change is scheduled not to start
+	// before the given time.
+	NotBefore time.Time `json:"not-before,omitempty"`
 
 	data map[string]*json.RawMessage
 }
@@ -134,31 +139,93 @@ const (
 type ChangesOptions struct {
 	SnapName string // if empty, no filtering by name is done
 	Selector ChangeSelector
+
+	// Kinds and Statuses, if not empty, restrict the changes to
+	// those of one of the given kinds and statuses.
+	Kinds    []string
+	Statuses []string
+	// TaskKind, if set, restricts the changes to those with a task
+	// of the given kind.
+	TaskKind string
+	// Since and Until, if set, restrict the changes to those spawned
+	// at or after Since and before Until.
+	Since time.Time
+	Until time.Time
+	// Sort is one of "spawn-time" (the default), "ready-time",
+	// "-spawn-time" and "-ready-time", the latter two for descending
+	// order.
+	Sort string
+	// Limit, if set, is the maximum number of changes to return.
+	Limit int
+	// After is the cursor, as returned by ChangesPage, of the page
+	// of changes to get.
+	After string
+	// Archived includes changes already pruned from the state but
+	// kept in the changes archive.
+	Archived bool
 }
 
-func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
+func (opts *ChangesOptions) query() url.Values {
 	query := url.Values{}
-	if opts != nil {
-		if opts.Selector != 0 {
-			query.Set("select", opts.Selector.String())
-		}
-		if opts.SnapName != "" {
-			query.Set("for", opts.SnapName)
-		}
+	if opts == nil {
+		return query
+	}
+	if opts.Selector != 0 {
+		query.Set("select", opts.Selector.String())
+	}
+	if opts.SnapName != "" {
+		query.Set("for", opts.SnapName)
+	}
+	if len(opts.Kinds) > 0 {
+		query.Set("kind", strings.Join(opts.Kinds, ","))
+	}
+	if len(opts.Statuses) > 0 {
+		query.Set("status", strings.Join(opts.Statuses, ","))
+	}
+	if opts.TaskKind != "" {
+		query.Set("task-kind", opts.TaskKind)
+	}
+	if !opts.Since.IsZero() {
+		query.Set("since", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("until", opts.Until.Format(time.RFC3339))
+	}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
 	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.After != "" {
+		query.Set("after", opts.After)
+	}
+	if opts.Archived {
+		query.Set("archived", "true")
+	}
+	return query
+}
+
+func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
+	chgs, _, err := client.ChangesPage(opts)
+	return chgs, err
+}
 
+// ChangesPage returns the changes matching the given options together
+// with the cursor to use as After to get the next page of changes, or
+// an empty cursor if there are no more.
+func (client *Client) ChangesPage(opts *ChangesOptions) (chgs []*Change, next string, err error) {
 	var chgds []changeAndData
-	_, err := client.doSync("GET", "/v2/changes", query, nil, nil, &chgds)
+	info, err := client.doSync("GET", "/v2/changes", opts.query(), nil, nil, &chgds)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	var chgs []*Change
 	for i := range chgds {
 		chgd := &chgds[i]
 		chgd.Change.data = chgd.Data
 		chgs = append(chgs, &chgd.Change)
 	}
 
-	return chgs, err
+	return chgs, info.NextCursor, nil
 }
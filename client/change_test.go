@@ -24,6 +24,7 @@ import (
 
 	"github.com/snapcore/snapd/client"
 	"io/ioutil"
+	"net/url"
 	"time"
 )
 
@@ -36,6 +37,7 @@ func (cs *clientSuite) TestClientChange(c *check.C) {
   "ready": false,
   "spawn-time": "2016-04-21T01:02:03Z",
   "ready-time": "2016-04-21T01:02:04Z",
+  "not-before": "2016-04-22T02:00:00Z",
   "tasks": [{"kind": "bar", "summary": "...", "status": "Do", "progress": {"done": 0, "total": 1}, "spawn-time": "2016-04-21T01:02:03Z", "ready-time": "2016-04-21T01:02:04Z"}]
 }}`
 
@@ -57,6 +59,7 @@ func (cs *clientSuite) TestClientChange(c *check.C) {
 
 		SpawnTime: time.Date(2016, 04, 21, 1, 2, 3, 0, time.UTC),
 		ReadyTime: time.Date(2016, 04, 21, 1, 2, 4, 0, time.UTC),
+		NotBefore: time.Date(2016, 04, 22, 2, 0, 0, 0, time.UTC),
 	})
 }
 
@@ -178,6 +181,46 @@ func (cs *clientSuite) TestClientChanges(c *check.C) {
 
 }
 
+func (cs *clientSuite) TestClientChangesPage(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": [{
+  "id":   "uno",
+  "kind": "foo",
+  "summary": "...",
+  "status": "Done",
+  "ready": true
+}], "next-cursor": "some-cursor"}`
+
+	chgs, next, err := cs.cli.ChangesPage(&client.ChangesOptions{
+		Selector: client.ChangesAll,
+		Kinds:    []string{"foo", "bar"},
+		Statuses: []string{"Done", "Error"},
+		TaskKind: "baz",
+		Since:    time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC),
+		Until:    time.Date(2020, 10, 2, 10, 0, 0, 0, time.UTC),
+		Sort:     "-spawn-time",
+		Limit:    10,
+		After:    "prev-cursor",
+		Archived: true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(next, check.Equals, "some-cursor")
+	c.Assert(chgs, check.HasLen, 1)
+	c.Check(chgs[0].ID, check.Equals, "uno")
+
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"select":    {"all"},
+		"kind":      {"foo,bar"},
+		"status":    {"Done,Error"},
+		"task-kind": {"baz"},
+		"since":     {"2020-10-01T10:00:00Z"},
+		"until":     {"2020-10-02T10:00:00Z"},
+		"sort":      {"-spawn-time"},
+		"limit":     {"10"},
+		"after":     {"prev-cursor"},
+		"archived":  {"true"},
+	})
+}
+
 func (cs *clientSuite) TestClientChangesData(c *check.C) {
 	cs.rsp = `{"type": "sync", "result": [{
   "id":   "uno",
@@ -22,6 +22,7 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -33,6 +34,8 @@ import (
 	"path"
 	"time"
 
+	"golang.org/x/xerrors"
+
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/jsonutil"
 )
@@ -74,6 +77,14 @@ type Config struct {
 
 	// User-Agent to sent to the snapd daemon
 	UserAgent string
+
+	// APIToken is a scoped API access token to authorize requests with,
+	// instead of the auth.json data. It is sent even with DisableAuth.
+	APIToken string
+
+	// TLSConfig is used to talk to snapd over https, as set by BaseURL;
+	// it carries the client certificate snapd knows the client by.
+	TLSConfig *tls.Config
 }
 
 // A Client knows how to talk to the snappy daemon.
@@ -83,6 +94,7 @@ type Client struct {
 
 	disableAuth bool
 	interactive bool
+	apiToken    string
 
 	maintenance error
 
@@ -90,6 +102,8 @@ type Client struct {
 	warningTimestamp time.Time
 
 	userAgent string
+
+	ctx context.Context
 }
 
 // New returns a new instance of Client
@@ -110,6 +124,7 @@ func New(config *Config) *Client {
 			disableAuth: config.DisableAuth,
 			interactive: config.Interactive,
 			userAgent:   config.UserAgent,
+			apiToken:    config.APIToken,
 		}
 	}
 
@@ -119,13 +134,34 @@ func New(config *Config) *Client {
 	}
 	return &Client{
 		baseURL:     *baseURL,
-		doer:        &http.Client{Transport: &http.Transport{DisableKeepAlives: config.DisableKeepAlive}},
+		doer:        &http.Client{Transport: &http.Transport{DisableKeepAlives: config.DisableKeepAlive, TLSClientConfig: config.TLSConfig}},
 		disableAuth: config.DisableAuth,
 		interactive: config.Interactive,
 		userAgent:   config.UserAgent,
+		apiToken:    config.APIToken,
 	}
 }
 
+// WithContext returns a shallow copy of the client whose requests are all
+// bound to the given context, so that canceling it aborts any ongoing
+// request and retries. The maintenance status and warnings summary seen
+// by the copy are not reflected on the original client.
+func (client *Client) WithContext(ctx context.Context) *Client {
+	if ctx == nil {
+		panic("nil context")
+	}
+	cli := *client
+	cli.ctx = ctx
+	return &cli
+}
+
+func (client *Client) context() context.Context {
+	if client.ctx != nil {
+		return client.ctx
+	}
+	return context.Background()
+}
+
 // Maintenance returns an error reflecting the daemon maintenance status or nil.
 func (client *Client) Maintenance() error {
 	return client.maintenance
@@ -151,6 +187,11 @@ func (client *Client) WhoAmI() (string, error) {
 }
 
 func (client *Client) setAuthorization(req *http.Request) error {
+	if client.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+client.apiToken)
+		return nil
+	}
+
 	user, err := readAuthData()
 	if os.IsNotExist(err) {
 		return nil
@@ -223,7 +264,7 @@ func (client *Client) raw(ctx context.Context, method, urlpath string, query url
 		req.Header.Set(key, value)
 	}
 
-	if !client.disableAuth {
+	if !client.disableAuth || client.apiToken != "" {
 		// set Authorization header if there are user's credentials
 		err = client.setAuthorization(req)
 		if err != nil {
@@ -314,7 +355,7 @@ func (client *Client) do(method, path string, query url.Values, headers map[stri
 	defer timeout.Stop()
 
 	var rsp *http.Response
-	var ctx context.Context = context.Background()
+	ctx := client.context()
 	for {
 		if flags.NoTimeout {
 			rsp, err = client.raw(ctx, method, path, query, headers, body)
@@ -335,6 +376,7 @@ func (client *Client) do(method, path string, query url.Values, headers map[stri
 		case <-retry.C:
 			continue
 		case <-timeout.C:
+		case <-ctx.Done():
 		}
 		break
 	}
@@ -485,6 +527,19 @@ func (e *Error) Error() string {
 	return e.Message
 }
 
+// Is returns whether target is an *Error of the same kind, so that
+// xerrors.Is (or errors.Is) matches errors by kind.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t != nil && e.Kind == t.Kind
+}
+
+// IsErrorKind returns whether err is, or wraps, an *Error of the given kind.
+func IsErrorKind(err error, kind ErrorKind) bool {
+	var e *Error
+	return xerrors.As(err, &e) && e.Kind == kind
+}
+
 // IsRetryable returns true if the given error is an error
 // that can be retried later.
 func IsRetryable(err error) bool {
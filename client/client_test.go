@@ -20,10 +20,12 @@
 package client_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -34,6 +36,7 @@ import (
 	"testing"
 	"time"
 
+	"golang.org/x/xerrors"
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
@@ -130,6 +133,21 @@ func (cs *clientSuite) TestClientDoReportsErrors(c *C) {
 	}
 }
 
+func (cs *clientSuite) TestClientWithContextCanceled(c *C) {
+	cs.err = errors.New("ouchie")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cli := cs.cli.WithContext(ctx)
+	_, err := cli.Do("GET", "/", nil, nil, nil, client.DoFlags{})
+	c.Check(err, ErrorMatches, "cannot communicate with server: request canceled")
+	c.Check(cs.doCalls, Equals, 1)
+	c.Check(cs.req.Context().Err(), Equals, context.Canceled)
+}
+
+func (cs *clientSuite) TestClientWithContextNilPanics(c *C) {
+	c.Check(func() { cs.cli.WithContext(nil) }, PanicMatches, "nil context")
+}
+
 func (cs *clientSuite) TestClientWorks(c *C) {
 	var v []int
 	cs.rsp = `[1,2]`
@@ -189,6 +207,34 @@ func (cs *clientSuite) TestClientSetsAuthorization(c *C) {
 	c.Check(authorization, Equals, `Macaroon root="macaroon", discharge="discharge"`)
 }
 
+func (cs *clientSuite) TestClientSetsAPITokenAuthorization(c *C) {
+	os.Setenv(client.TestAuthFileEnvKey, filepath.Join(c.MkDir(), "json"))
+	defer os.Unsetenv(client.TestAuthFileEnvKey)
+
+	mockUserData := client.User{
+		Macaroon:   "macaroon",
+		Discharges: []string{"discharge"},
+	}
+	err := client.TestWriteAuth(mockUserData)
+	c.Assert(err, IsNil)
+
+	var v string
+	cli := client.New(&client.Config{APIToken: "s3cr3t"})
+	cli.SetDoer(cs)
+	_, _ = cli.Do("GET", "/this", nil, nil, &v, client.DoFlags{})
+	authorization := cs.req.Header.Get("Authorization")
+	c.Check(authorization, Equals, "Bearer s3cr3t")
+}
+
+func (cs *clientSuite) TestClientSendsAPITokenWithDisableAuth(c *C) {
+	var v string
+	cli := client.New(&client.Config{APIToken: "s3cr3t", DisableAuth: true})
+	cli.SetDoer(cs)
+	_, _ = cli.Do("GET", "/this", nil, nil, &v, client.DoFlags{})
+	authorization := cs.req.Header.Get("Authorization")
+	c.Check(authorization, Equals, "Bearer s3cr3t")
+}
+
 func (cs *clientSuite) TestClientHonorsDisableAuth(c *C) {
 	os.Setenv(client.TestAuthFileEnvKey, filepath.Join(c.MkDir(), "json"))
 	defer os.Unsetenv(client.TestAuthFileEnvKey)
@@ -479,6 +525,19 @@ func (cs *clientSuite) TestIsRetryable(c *C) {
 	c.Check(client.IsRetryable(&client.Error{Kind: client.ErrorKindSnapChangeConflict}), Equals, true)
 }
 
+func (cs *clientSuite) TestErrorIsKind(c *C) {
+	err := error(&client.Error{Kind: client.ErrorKindSnapNotFound, Message: "snap not found"})
+	c.Check(xerrors.Is(err, &client.Error{Kind: client.ErrorKindSnapNotFound}), Equals, true)
+	c.Check(xerrors.Is(err, &client.Error{Kind: client.ErrorKindSnapAlreadyInstalled}), Equals, false)
+	c.Check(xerrors.Is(err, (*client.Error)(nil)), Equals, false)
+
+	wrapped := xerrors.Errorf("cannot frob: %w", err)
+	c.Check(client.IsErrorKind(wrapped, client.ErrorKindSnapNotFound), Equals, true)
+	c.Check(client.IsErrorKind(wrapped, client.ErrorKindSnapChangeConflict), Equals, false)
+	c.Check(client.IsErrorKind(errors.New("snap-not-found"), client.ErrorKindSnapNotFound), Equals, false)
+	c.Check(client.IsErrorKind(nil, client.ErrorKindSnapNotFound), Equals, false)
+}
+
 func (cs *clientSuite) TestUserAgent(c *C) {
 	cli := client.New(&client.Config{UserAgent: "some-agent/9.87"})
 	cli.SetDoer(cs)
@@ -549,3 +608,28 @@ func (cs *integrationSuite) TestClientTimeoutLP1837804(c *C) {
 	_, err = cli.Do("POST", "/", nil, nil, nil, client.DoFlags{})
 	c.Assert(err, ErrorMatches, `.* timeout exceeded while waiting for response`)
 }
+
+func (cs *integrationSuite) TestClientTLSConfig(c *C) {
+	// leave enough time for the TLS handshake on a loaded machine
+	restore := client.MockDoTimings(time.Millisecond, 500*time.Millisecond)
+	defer restore()
+
+	testServer := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(res, `{"hello":"world"}`)
+	}))
+	defer testServer.Close()
+	// quiet the handshake errors of the untrusting client
+	testServer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	// the server certificate is not trusted by default
+	cli := client.New(&client.Config{BaseURL: testServer.URL, DisableAuth: true})
+	var v map[string]string
+	_, err := cli.Do("GET", "/", nil, nil, &v, client.DoFlags{})
+	c.Assert(err, NotNil)
+
+	tlsConfig := testServer.Client().Transport.(*http.Transport).TLSClientConfig
+	cli = client.New(&client.Config{BaseURL: testServer.URL, DisableAuth: true, TLSConfig: tlsConfig})
+	_, err = cli.Do("GET", "/", nil, nil, &v, client.DoFlags{})
+	c.Assert(err, IsNil)
+	c.Check(v, DeepEquals, map[string]string{"hello": "world"})
+}
@@ -110,6 +110,9 @@ func ClientAppInfoNotes(app *client.AppInfo) string {
 	if seenSocket {
 		notes = append(notes, "socket-activated")
 	}
+	if app.CrashLoop {
+		notes = append(notes, "crash-loop")
+	}
 	if len(notes) == 0 {
 		return "-"
 	}
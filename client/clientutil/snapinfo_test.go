@@ -283,4 +283,11 @@ func (*cmdSuite) TestAppStatusNotes(c *C) {
 		},
 	}
 	c.Check(clientutil.ClientAppInfoNotes(&ai), Equals, "timer-activated,socket-activated")
+
+	ai = client.AppInfo{
+		Daemon:    "simple",
+		Restarts:  7,
+		CrashLoop: true,
+	}
+	c.Check(clientutil.ClientAppInfoNotes(&ai), Equals, "crash-loop")
 }
@@ -23,7 +23,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // SetConf requests a snap to apply the provided patch to the configuration.
@@ -50,3 +52,52 @@ func (client *Client) Conf(snapName string, keys []string) (configuration map[st
 
 	return configuration, nil
 }
+
+// ConfSchema asks for the configuration schema of a snap, or the schemas of
+// the given keys.
+func (client *Client) ConfSchema(snapName string, keys []string) (schema map[string]interface{}, err error) {
+	query := url.Values{}
+	query.Set("keys", strings.Join(keys, ","))
+	query.Set("schema", "true")
+
+	_, err = client.doSync("GET", "/v2/snaps/"+snapName+"/conf", query, nil, nil, &schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// ConfHistoryEntry is a configuration of a snap as recorded in its
+// configuration history.
+type ConfHistoryEntry struct {
+	ID       int       `json:"id"`
+	Time     time.Time `json:"time"`
+	ChangeID string    `json:"change-id,omitempty"`
+	// UID is the user that requested the change, nil if the
+	// configuration was changed by snapd itself.
+	UID    *uint32                `json:"uid,omitempty"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// ConfHistory asks for the recorded configurations of a snap, oldest first.
+func (client *Client) ConfHistory(snapName string) (history []*ConfHistoryEntry, err error) {
+	query := url.Values{}
+	query.Set("history", "true")
+
+	_, err = client.doSync("GET", "/v2/snaps/"+snapName+"/conf", query, nil, nil, &history)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// RevertConf requests a snap to reapply the configuration recorded in its
+// configuration history with the given id.
+func (client *Client) RevertConf(snapName string, id int) (changeID string, err error) {
+	query := url.Values{}
+	query.Set("revert-to", strconv.Itoa(id))
+
+	return client.doAsync("PUT", "/v2/snaps/"+snapName+"/conf", query, nil, nil)
+}
@@ -21,8 +21,11 @@ package client_test
 
 import (
 	"encoding/json"
+	"time"
 
 	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
 )
 
 func (cs *clientSuite) TestClientSetConfCallsEndpoint(c *check.C) {
@@ -103,3 +106,65 @@ func (cs *clientSuite) TestClientGetConfMultipleKeys(c *check.C) {
 		"test-key2": "test-value2",
 	})
 }
+
+func (cs *clientSuite) TestClientGetConfSchema(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"test-key": {"type": "integer", "minimum": 1}}
+	}`
+	value, err := cs.cli.ConfSchema("snap-name", []string{"test-key"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps/snap-name/conf")
+	c.Check(cs.req.URL.Query().Get("keys"), check.Equals, "test-key")
+	c.Check(cs.req.URL.Query().Get("schema"), check.Equals, "true")
+	c.Check(value, check.DeepEquals, map[string]interface{}{
+		"test-key": map[string]interface{}{"type": "integer", "minimum": json.Number("1")},
+	})
+}
+
+func (cs *clientSuite) TestClientConfHistory(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"id": 1, "time": "2020-06-01T10:00:00Z", "config": {"test-key": "a"}},
+			{"id": 2, "time": "2020-06-01T11:00:00Z", "change-id": "42", "uid": 1000, "config": {"test-key": "b"}}
+		]
+	}`
+	history, err := cs.cli.ConfHistory("snap-name")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps/snap-name/conf")
+	c.Check(cs.req.URL.Query().Get("history"), check.Equals, "true")
+
+	uid := uint32(1000)
+	c.Check(history, check.DeepEquals, []*client.ConfHistoryEntry{{
+		ID:     1,
+		Time:   time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC),
+		Config: map[string]interface{}{"test-key": "a"},
+	}, {
+		ID:       2,
+		Time:     time.Date(2020, 6, 1, 11, 0, 0, 0, time.UTC),
+		ChangeID: "42",
+		UID:      &uid,
+		Config:   map[string]interface{}{"test-key": "b"},
+	}})
+}
+
+func (cs *clientSuite) TestClientRevertConf(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"result": { },
+		"change": "foo"
+	}`
+	id, err := cs.cli.RevertConf("snap-name", 3)
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "foo")
+	c.Check(cs.req.Method, check.Equals, "PUT")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps/snap-name/conf")
+	c.Check(cs.req.URL.Query().Get("revert-to"), check.Equals, "3")
+}
@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"time"
 
 	"golang.org/x/xerrors"
 
@@ -33,12 +34,29 @@ import (
 
 type remodelData struct {
 	NewModel string `json:"new-model"`
+	*RemodelOptions
+}
+
+// RemodelOptions holds optional constraints on when a remodel may start.
+type RemodelOptions struct {
+	// NotBefore delays the start of the remodel until the given time.
+	NotBefore *time.Time `json:"not-before,omitempty"`
+	// Window delays the start of the remodel until the next maintenance
+	// window, given as a schedule in the same format as refresh.timer.
+	Window string `json:"window,omitempty"`
 }
 
 // Remodel tries to remodel the system with the given assertion data
 func (client *Client) Remodel(b []byte) (changeID string, err error) {
+	return client.RemodelWithOptions(b, nil)
+}
+
+// RemodelWithOptions tries to remodel the system with the given assertion
+// data, honouring the given scheduling options
+func (client *Client) RemodelWithOptions(b []byte, opts *RemodelOptions) (changeID string, err error) {
 	data, err := json.Marshal(&remodelData{
-		NewModel: string(b),
+		NewModel:       string(b),
+		RemodelOptions: opts,
 	})
 	if err != nil {
 		return "", fmt.Errorf("cannot marshal remodel data: %v", err)
@@ -80,7 +98,7 @@ func (client *Client) CurrentSerialAssertion() (*asserts.Serial, error) {
 func currentAssertion(client *Client, path string) (asserts.Assertion, error) {
 	q := url.Values{}
 
-	ctx, cancel := context.WithTimeout(context.Background(), doTimeout)
+	ctx, cancel := context.WithTimeout(client.context(), doTimeout)
 	defer cancel()
 	response, err := client.raw(ctx, "GET", path, q, nil, nil)
 	if err != nil {
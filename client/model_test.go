@@ -30,6 +30,7 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/client"
 )
 
 const happyModelAssertionResponse = `type: model
@@ -130,6 +131,30 @@ func (cs *clientSuite) TestClientRemodel(c *C) {
 	c.Check(jsonBody["new-model"], Equals, string(remodelJsonData))
 }
 
+func (cs *clientSuite) TestClientRemodelWithOptions(c *C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"result": {},
+		"change": "d728"
+	}`
+	remodelJsonData := []byte(`{"new-model": "some-model"}`)
+	id, err := cs.cli.RemodelWithOptions(remodelJsonData, &client.RemodelOptions{Window: "sat,02:00-04:00"})
+	c.Assert(err, IsNil)
+	c.Check(id, Equals, "d728")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, IsNil)
+	jsonBody := make(map[string]string)
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, IsNil)
+	c.Check(jsonBody, DeepEquals, map[string]string{
+		"new-model": string(remodelJsonData),
+		"window":    "sat,02:00-04:00",
+	})
+}
+
 func (cs *clientSuite) TestClientGetModelHappy(c *C) {
 	cs.status = 200
 	cs.rsp = happyModelAssertionResponse
@@ -125,6 +125,7 @@ const (
 
 type ResultInfo struct {
 	SuggestedCurrency string `json:"suggested-currency"`
+	NextCursor        string `json:"next-cursor"`
 }
 
 // FindOptions supports exactly one of the following options:
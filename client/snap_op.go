@@ -21,13 +21,27 @@ package client
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// TransactionType specifies how a multi-snap operation is undone when
+// it fails for some of the snaps.
+type TransactionType string
+
+const (
+	// TransactionPerSnap undoes only the operation on the snaps for
+	// which it failed, the default.
+	TransactionPerSnap TransactionType = "per-snap"
+	// TransactionAllSnaps undoes the operation on all the snaps when
+	// it fails for any of them.
+	TransactionAllSnaps TransactionType = "all-snaps"
 )
 
 type SnapOptions struct {
@@ -45,6 +59,25 @@ type SnapOptions struct {
 	Amend            bool   `json:"amend,omitempty"`
 
 	Users []string `json:"users,omitempty"`
+	// IncludeSecrets makes snapshots carry secret configuration options.
+	IncludeSecrets bool `json:"include-secrets,omitempty"`
+	// Transaction is only supported by RefreshMany.
+	Transaction TransactionType `json:"transaction,omitempty"`
+	// NotBefore delays the start of the change until the given time.
+	NotBefore *time.Time `json:"not-before,omitempty"`
+	// Window delays the start of the change until the next maintenance
+	// window, given as a schedule in the same format as refresh.timer.
+	Window string `json:"window,omitempty"`
+}
+
+// multiOptionsOnly returns whether only options supported by
+// multi-snap operations are set.
+func (opts *SnapOptions) multiOptionsOnly() bool {
+	o := *opts
+	o.Transaction = ""
+	o.NotBefore = nil
+	o.Window = ""
+	return reflect.DeepEqual(o, SnapOptions{})
 }
 
 func writeFieldBool(mw *multipart.Writer, key string, val bool) error {
@@ -88,6 +121,13 @@ type multiActionData struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+
+	IncludeSecrets bool `json:"include-secrets,omitempty"`
+
+	Transaction TransactionType `json:"transaction,omitempty"`
+
+	NotBefore *time.Time `json:"not-before,omitempty"`
+	Window    string     `json:"window,omitempty"`
 }
 
 // Install adds the snap with the given name from the given channel (or
@@ -139,7 +179,13 @@ func (client *Client) Switch(name string, options *SnapOptions) (changeID string
 
 // SnapshotMany snapshots many snaps (all, if names empty) for many users (all, if users is empty).
 func (client *Client) SnapshotMany(names []string, users []string) (setID uint64, changeID string, err error) {
-	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, &SnapOptions{Users: users})
+	return client.SnapshotManyWithOptions(names, &SnapOptions{Users: users})
+}
+
+// SnapshotManyWithOptions snapshots many snaps (all, if names empty) as
+// SnapshotMany, honouring the Users and IncludeSecrets options.
+func (client *Client) SnapshotManyWithOptions(names []string, options *SnapOptions) (setID uint64, changeID string, err error) {
+	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, options)
 	if err != nil {
 		return 0, "", err
 	}
@@ -179,7 +225,7 @@ func (client *Client) doSnapAction(actionName string, snapName string, options *
 }
 
 func (client *Client) doMultiSnapAction(actionName string, snaps []string, options *SnapOptions) (changeID string, err error) {
-	if options != nil {
+	if options != nil && (!options.multiOptionsOnly() || (options.Transaction != "" && actionName != "refresh")) {
 		return "", fmt.Errorf("cannot use options for multi-action") // (yet)
 	}
 	_, changeID, err = client.doMultiSnapActionFull(actionName, snaps, options)
@@ -194,6 +240,10 @@ func (client *Client) doMultiSnapActionFull(actionName string, snaps []string, o
 	}
 	if options != nil {
 		action.Users = options.Users
+		action.IncludeSecrets = options.IncludeSecrets
+		action.Transaction = options.Transaction
+		action.NotBefore = options.NotBefore
+		action.Window = options.Window
 	}
 	data, err := json.Marshal(&action)
 	if err != nil {
@@ -364,7 +414,7 @@ func (client *Client) Download(name string, options *DownloadOptions) (dlInfo *D
 	}
 
 	// no deadline for downloads
-	ctx := context.Background()
+	ctx := client.context()
 	rsp, err := client.raw(ctx, "POST", "/v2/download", nil, headers, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, nil, err
@@ -29,6 +29,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -186,6 +187,67 @@ func (cs *clientSuite) TestClientMultiOpSnap(c *check.C) {
 	}
 }
 
+func (cs *clientSuite) TestClientRefreshManyTransaction(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	id, err := cs.cli.RefreshMany([]string{pkgName}, &client.SnapOptions{Transaction: client.TransactionAllSnaps})
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "d728")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":      "refresh",
+		"snaps":       []interface{}{pkgName},
+		"transaction": "all-snaps",
+	})
+}
+
+func (cs *clientSuite) TestClientRemoveManyWindow(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	notBefore := time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC)
+	id, err := cs.cli.RemoveMany([]string{pkgName}, &client.SnapOptions{NotBefore: &notBefore, Window: "02:00-04:00"})
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "d728")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var jsonBody map[string]interface{}
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":     "remove",
+		"snaps":      []interface{}{pkgName},
+		"not-before": "2020-03-02T12:00:00Z",
+		"window":     "02:00-04:00",
+	})
+}
+
+func (cs *clientSuite) TestClientMultiOpSnapUnsupportedOptions(c *check.C) {
+	for _, t := range []struct {
+		op   func(*client.Client, []string, *client.SnapOptions) (string, error)
+		opts *client.SnapOptions
+	}{
+		{(*client.Client).RefreshMany, &client.SnapOptions{Channel: "edge", Transaction: client.TransactionAllSnaps}},
+		{(*client.Client).InstallMany, &client.SnapOptions{Transaction: client.TransactionAllSnaps}},
+		{(*client.Client).RemoveMany, &client.SnapOptions{Purge: true}},
+	} {
+		_, err := t.op(cs.cli, []string{pkgName}, t.opts)
+		c.Check(err, check.ErrorMatches, "cannot use options for multi-action")
+	}
+	c.Check(cs.req, check.IsNil)
+}
+
 func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 	// Note body is essentially the same as TestClientMultiOpSnap; keep in sync
 	cs.status = 202
@@ -212,6 +274,34 @@ func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 	c.Check(changeID, check.Equals, "d728")
 }
 
+func (cs *clientSuite) TestClientMultiSnapshotIncludeSecrets(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"result": {"set-id": 42},
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	setID, _, err := cs.cli.SnapshotManyWithOptions([]string{pkgName}, &client.SnapOptions{
+		Users:          []string{"foo"},
+		IncludeSecrets: true,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(42))
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":          "snapshot",
+		"snaps":           []interface{}{pkgName},
+		"users":           []interface{}{"foo"},
+		"include-secrets": true,
+	})
+}
+
 func (cs *clientSuite) TestClientOpInstallPath(c *check.C) {
 	cs.status = 202
 	cs.rsp = `{
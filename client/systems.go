@@ -135,3 +135,40 @@ func (client *Client) RebootToSystem(systemLabel, mode string) error {
 	}
 	return nil
 }
+
+// SystemRecoveryKeysResponse contains the recovery key of the encrypted
+// partitions of the device.
+type SystemRecoveryKeysResponse struct {
+	RecoveryKey string `json:"recovery-key"`
+}
+
+// SystemRecoveryKeys returns the recovery key of the encrypted partitions of
+// the device.
+func (client *Client) SystemRecoveryKeys() (*SystemRecoveryKeysResponse, error) {
+	var rsp SystemRecoveryKeysResponse
+
+	if _, err := client.doSync("GET", "/v2/system-recovery-keys", nil, nil, nil, &rsp); err != nil {
+		return nil, xerrors.Errorf("cannot get recovery keys: %v", err)
+	}
+	return &rsp, nil
+}
+
+// RotateSystemRecoveryKeys replaces the recovery key of the encrypted
+// partitions of the device with a new one, which is returned.
+func (client *Client) RotateSystemRecoveryKeys() (*SystemRecoveryKeysResponse, error) {
+	req := struct {
+		Action string `json:"action"`
+	}{
+		Action: "rotate",
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(&req); err != nil {
+		return nil, err
+	}
+	var rsp SystemRecoveryKeysResponse
+	if _, err := client.doSync("POST", "/v2/system-recovery-keys", nil, nil, &body, &rsp); err != nil {
+		return nil, xerrors.Errorf("cannot rotate recovery keys: %v", err)
+	}
+	return &rsp, nil
+}
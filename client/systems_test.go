@@ -203,3 +203,52 @@ func (cs *clientSuite) TestRequestSystemRebootError(c *check.C) {
 	c.Check(cs.req.Method, check.Equals, "POST")
 	c.Check(cs.req.URL.Path, check.Equals, "/v2/systems/1234")
 }
+
+func (cs *clientSuite) TestSystemRecoveryKeys(c *check.C) {
+	cs.rsp = `{
+	    "type": "sync",
+	    "status-code": 200,
+	    "result": {"recovery-key": "00256-00770-01284-01798-02312-02826-03340-65294"}
+	}`
+	rsp, err := cs.cli.SystemRecoveryKeys()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/system-recovery-keys")
+	c.Check(rsp, check.DeepEquals, &client.SystemRecoveryKeysResponse{
+		RecoveryKey: "00256-00770-01284-01798-02312-02826-03340-65294",
+	})
+}
+
+func (cs *clientSuite) TestRotateSystemRecoveryKeys(c *check.C) {
+	cs.rsp = `{
+	    "type": "sync",
+	    "status-code": 200,
+	    "result": {"recovery-key": "00256-00770-01284-01798-02312-02826-03340-65294"}
+	}`
+	rsp, err := cs.cli.RotateSystemRecoveryKeys()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/system-recovery-keys")
+	c.Check(rsp, check.DeepEquals, &client.SystemRecoveryKeysResponse{
+		RecoveryKey: "00256-00770-01284-01798-02312-02826-03340-65294",
+	})
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Assert(req, check.DeepEquals, map[string]interface{}{
+		"action": "rotate",
+	})
+}
+
+func (cs *clientSuite) TestRotateSystemRecoveryKeysError(c *check.C) {
+	cs.rsp = `{
+	    "type": "error",
+	    "status-code": 404,
+	    "result": {"message": "no recovery key: system is not encrypted"}
+	}`
+	_, err := cs.cli.RotateSystemRecoveryKeys()
+	c.Assert(err, check.ErrorMatches, "cannot rotate recovery keys: no recovery key: system is not encrypted")
+}
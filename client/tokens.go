@@ -0,0 +1,121 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// APITokenScope describes the part of the API a token grants access to:
+// the given actions ("read" for GET requests) on the endpoint, optionally
+// only for the given snaps.
+type APITokenScope struct {
+	Endpoint string   `json:"endpoint"`
+	Actions  []string `json:"actions"`
+	Snaps    []string `json:"snaps,omitempty"`
+}
+
+// APIToken holds the details of a scoped API access token, but not the
+// token itself.
+type APIToken struct {
+	ID      int             `json:"id"`
+	Label   string          `json:"label,omitempty"`
+	Scopes  []APITokenScope `json:"scopes"`
+	Created time.Time       `json:"created"`
+	Expires *time.Time      `json:"expires,omitempty"`
+	// CertFingerprint is set for tokens bound to a client certificate,
+	// as the hex encoded SHA256 of the DER certificate.
+	CertFingerprint string `json:"cert-fingerprint,omitempty"`
+}
+
+// CreateAPITokenOptions holds the details of a token to create.
+type CreateAPITokenOptions struct {
+	Label  string          `json:"label,omitempty"`
+	Scopes []APITokenScope `json:"scopes"`
+	// Expires is when the token stops being valid, the zero time means
+	// never.
+	Expires time.Time `json:"-"`
+	// Certificate is a PEM encoded client certificate to bind the token
+	// to, for use over the TLS listener, instead of handing it out.
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// CreateAPITokenResult holds the identifier of a new token and the token
+// itself, which cannot be retrieved again; tokens bound to a certificate
+// are not handed out.
+type CreateAPITokenResult struct {
+	ID    int    `json:"id"`
+	Token string `json:"token,omitempty"`
+}
+
+type apiTokenAction struct {
+	Action string `json:"action"`
+	*CreateAPITokenOptions
+	Expires *time.Time `json:"expires,omitempty"`
+	ID      int        `json:"id,omitempty"`
+}
+
+func (client *Client) doAPITokenAction(act *apiTokenAction, result interface{}) error {
+	data, err := json.Marshal(act)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.doSync("POST", "/v2/tokens", nil, nil, bytes.NewReader(data), result)
+	return err
+}
+
+// CreateAPIToken mints a scoped API access token.
+func (client *Client) CreateAPIToken(options *CreateAPITokenOptions) (*CreateAPITokenResult, error) {
+	if options == nil || len(options.Scopes) == 0 {
+		return nil, fmt.Errorf("cannot create a token without scopes")
+	}
+	act := &apiTokenAction{Action: "create", CreateAPITokenOptions: options}
+	if !options.Expires.IsZero() {
+		act.Expires = &options.Expires
+	}
+
+	var result CreateAPITokenResult
+	if err := client.doAPITokenAction(act, &result); err != nil {
+		return nil, fmt.Errorf("cannot create token: %v", err)
+	}
+	return &result, nil
+}
+
+// RevokeAPIToken revokes the token with the given identifier.
+func (client *Client) RevokeAPIToken(id int) error {
+	if err := client.doAPITokenAction(&apiTokenAction{Action: "revoke", ID: id}, nil); err != nil {
+		return fmt.Errorf("cannot revoke token: %v", err)
+	}
+	return nil
+}
+
+// APITokens returns the details of the scoped API access tokens.
+func (client *Client) APITokens() ([]*APIToken, error) {
+	var result []*APIToken
+
+	if _, err := client.doSync("GET", "/v2/tokens", nil, nil, nil, &result); err != nil {
+		return nil, fmt.Errorf("cannot list tokens: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"io/ioutil"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientCreateAPIToken(c *C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {"id": 3, "token": "s3cr3t"}
+	}`
+	res, err := cs.cli.CreateAPIToken(&client.CreateAPITokenOptions{
+		Label: "monitoring",
+		Scopes: []client.APITokenScope{
+			{Endpoint: "/v2/snaps", Actions: []string{"refresh"}, Snaps: []string{"foo"}},
+		},
+		Expires: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC),
+	})
+	c.Assert(err, IsNil)
+	c.Check(res, DeepEquals, &client.CreateAPITokenResult{ID: 3, Token: "s3cr3t"})
+	c.Check(cs.req.Method, Equals, "POST")
+	c.Check(cs.req.URL.Path, Equals, "/v2/tokens")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, `{"action":"create","label":"monitoring","scopes":[{"endpoint":"/v2/snaps","actions":["refresh"],"snaps":["foo"]}],"expires":"2020-07-01T00:00:00Z"}`)
+}
+
+func (cs *clientSuite) TestClientCreateAPITokenForCertificate(c *C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": {"id": 4}
+	}`
+	res, err := cs.cli.CreateAPIToken(&client.CreateAPITokenOptions{
+		Scopes: []client.APITokenScope{
+			{Endpoint: "/v2/changes", Actions: []string{"read"}},
+		},
+		Certificate: "PEM",
+	})
+	c.Assert(err, IsNil)
+	c.Check(res, DeepEquals, &client.CreateAPITokenResult{ID: 4})
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, `{"action":"create","scopes":[{"endpoint":"/v2/changes","actions":["read"]}],"certificate":"PEM"}`)
+}
+
+func (cs *clientSuite) TestClientCreateAPITokenErrors(c *C) {
+	_, err := cs.cli.CreateAPIToken(&client.CreateAPITokenOptions{})
+	c.Check(err, ErrorMatches, "cannot create a token without scopes")
+	c.Check(cs.req, IsNil)
+
+	cs.rsp = `{
+		"type": "error",
+		"result": {"message": "no can do"}
+	}`
+	_, err = cs.cli.CreateAPIToken(&client.CreateAPITokenOptions{
+		Scopes: []client.APITokenScope{{Endpoint: "/v2/changes", Actions: []string{"read"}}},
+	})
+	c.Check(err, ErrorMatches, "cannot create token: no can do")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, `{"action":"create","scopes":[{"endpoint":"/v2/changes","actions":["read"]}]}`)
+}
+
+func (cs *clientSuite) TestClientRevokeAPIToken(c *C) {
+	cs.rsp = `{"type": "sync", "result": null}`
+	err := cs.cli.RevokeAPIToken(3)
+	c.Assert(err, IsNil)
+	c.Check(cs.req.Method, Equals, "POST")
+	c.Check(cs.req.URL.Path, Equals, "/v2/tokens")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, `{"action":"revoke","id":3}`)
+}
+
+func (cs *clientSuite) TestClientAPITokens(c *C) {
+	cs.rsp = `{
+		"type": "sync",
+		"result": [
+			{"id": 1, "label": "monitoring", "scopes": [{"endpoint": "/v2/changes", "actions": ["read"]}], "created": "2020-06-01T10:00:00Z"},
+			{"id": 2, "scopes": [{"endpoint": "/v2/apps", "actions": ["restart"], "snaps": ["baz"]}], "created": "2020-06-01T10:00:00Z", "expires": "2020-07-01T00:00:00Z"}
+		]
+	}`
+	tokens, err := cs.cli.APITokens()
+	c.Assert(err, IsNil)
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v2/tokens")
+
+	created := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	expires := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	c.Check(tokens, DeepEquals, []*client.APIToken{{
+		ID:      1,
+		Label:   "monitoring",
+		Scopes:  []client.APITokenScope{{Endpoint: "/v2/changes", Actions: []string{"read"}}},
+		Created: created,
+	}, {
+		ID:      2,
+		Scopes:  []client.APITokenScope{{Endpoint: "/v2/apps", Actions: []string{"restart"}, Snaps: []string{"baz"}}},
+		Created: created,
+		Expires: &expires,
+	}})
+}
@@ -0,0 +1,241 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	// watchPollTime is the time between polls of a watched change
+	watchPollTime = 100 * time.Millisecond
+	// watchMaxGoneTime is how long a watched change keeps being
+	// polled while the daemon cannot be reached, e.g. while it or
+	// the system restarts
+	watchMaxGoneTime = 5 * time.Minute
+)
+
+// MockWatchTimings mocks the poll time and the time a watched change
+// keeps being polled while the daemon cannot be reached.
+func MockWatchTimings(poll, maxGone time.Duration) (restore func()) {
+	oldPoll := watchPollTime
+	oldMaxGone := watchMaxGoneTime
+	watchPollTime = poll
+	watchMaxGoneTime = maxGone
+	return func() {
+		watchPollTime = oldPoll
+		watchMaxGoneTime = oldMaxGone
+	}
+}
+
+// ChangeUpdate describes an update of a watched change.
+type ChangeUpdate struct {
+	// Change is the change as of the update.
+	Change *Change
+	// Tasks are the tasks of the change whose status, progress or
+	// log changed since the previous update; all the tasks of the
+	// change on the first update.
+	Tasks []*Task
+	// Err is set on the last update sent if watching the change
+	// failed; the change is then nil.
+	Err error
+}
+
+// IsRestartError returns whether the given error is due to the daemon or
+// the system restarting, either as reported by the daemon or because the
+// daemon cannot be reached.
+func IsRestartError(err error) bool {
+	if IsErrorKind(err, ErrorKindDaemonRestart) || IsErrorKind(err, ErrorKindSystemRestart) {
+		return true
+	}
+	var connErr ConnectionError
+	if !xerrors.As(err, &connErr) {
+		return false
+	}
+	return !xerrors.Is(connErr.Err, context.Canceled) && !xerrors.Is(connErr.Err, context.DeadlineExceeded)
+}
+
+func taskChanged(old, new *Task) bool {
+	return old.Status != new.Status || old.Progress != new.Progress || len(old.Log) != len(new.Log)
+}
+
+// changedTasks returns the tasks of chg that are new or changed compared
+// to the ones of old.
+func changedTasks(old, chg *Change) []*Task {
+	if old == nil {
+		return chg.Tasks
+	}
+	oldTasks := make(map[string]*Task, len(old.Tasks))
+	for _, t := range old.Tasks {
+		oldTasks[t.ID] = t
+	}
+	var changed []*Task
+	for _, t := range chg.Tasks {
+		if ot, ok := oldTasks[t.ID]; !ok || taskChanged(ot, t) {
+			changed = append(changed, t)
+		}
+	}
+	return changed
+}
+
+// Watch polls the given change until it is ready, sending an update on
+// the returned channel whenever the change or one of its tasks changes.
+// The channel is closed after the update where the change is ready, or
+// after an update carrying an error. While the daemon cannot be reached,
+// as when it or the system restarts, the change keeps being polled until
+// the daemon is back. Canceling the context stops the watching.
+func (client *Client) Watch(ctx context.Context, changeID string) <-chan ChangeUpdate {
+	updates := make(chan ChangeUpdate)
+	cli := client.WithContext(ctx)
+
+	go func() {
+		defer close(updates)
+
+		send := func(upd ChangeUpdate) bool {
+			select {
+			case updates <- upd:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var last *Change
+		var goneSince time.Time
+		for {
+			chg, err := cli.Change(changeID)
+			switch {
+			case err == nil:
+				goneSince = time.Time{}
+			case IsRestartError(err) && ctx.Err() == nil:
+				if goneSince.IsZero() {
+					goneSince = time.Now()
+				}
+				if time.Since(goneSince) < watchMaxGoneTime {
+					break
+				}
+				fallthrough
+			default:
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
+				send(ChangeUpdate{Err: err})
+				return
+			}
+
+			if chg != nil {
+				tasks := changedTasks(last, chg)
+				if last == nil || len(tasks) > 0 || chg.Status != last.Status || chg.Ready != last.Ready {
+					if !send(ChangeUpdate{Change: chg, Tasks: tasks}) {
+						return
+					}
+				}
+				last = chg
+				if chg.Ready {
+					return
+				}
+			}
+
+			select {
+			case <-time.After(watchPollTime):
+			case <-ctx.Done():
+				send(ChangeUpdate{Err: ctx.Err()})
+				return
+			}
+		}
+	}()
+
+	return updates
+}
+
+// WaitChange watches the given change until it is ready, calling the
+// given callback, if any, on every update of it. It returns the ready
+// change, and an error as well if the change did not finish successfully.
+func (client *Client) WaitChange(ctx context.Context, changeID string, callback func(*ChangeUpdate)) (*Change, error) {
+	var chg *Change
+	for upd := range client.Watch(ctx, changeID) {
+		if upd.Err != nil {
+			return nil, upd.Err
+		}
+		if callback != nil {
+			callback(&upd)
+		}
+		chg = upd.Change
+	}
+	if chg == nil || !chg.Ready {
+		// the channel was closed as the context was done
+		return nil, ctx.Err()
+	}
+
+	switch {
+	case chg.Status == "Done":
+		return chg, nil
+	case chg.Err != "":
+		return chg, errors.New(chg.Err)
+	default:
+		return chg, fmt.Errorf("change finished in status %q with no error message", chg.Status)
+	}
+}
+
+// RetryOptions controls how Retry retries.
+type RetryOptions struct {
+	// Interval is the time between attempts, one second if unset.
+	Interval time.Duration
+	// Timeout is how long to keep retrying for, one minute if unset.
+	Timeout time.Duration
+}
+
+// Retry calls f until it succeeds or returns an error that is neither
+// retryable as per IsRetryable nor a restart error as per IsRestartError,
+// retrying for up to the timeout given in opts or until the context is
+// done. It returns the last error from f.
+func Retry(ctx context.Context, opts *RetryOptions, f func() error) error {
+	interval := time.Second
+	timeout := time.Minute
+	if opts != nil {
+		if opts.Interval > 0 {
+			interval = opts.Interval
+		}
+		if opts.Timeout > 0 {
+			timeout = opts.Timeout
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		err := f()
+		if err == nil || !(IsRetryable(err) || IsRestartError(err)) {
+			return err
+		}
+		select {
+		case <-time.After(interval):
+		case <-deadline.C:
+			return err
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
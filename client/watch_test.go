@@ -0,0 +1,246 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func changeJSON(status string, ready bool, taskStatus string, done int) string {
+	return fmt.Sprintf(`{"type": "sync", "result": {
+  "id": "42",
+  "kind": "foo",
+  "status": %q,
+  "ready": %v,
+  "tasks": [
+    {"id": "1", "kind": "bar", "status": "Done", "progress": {"done": 1, "total": 1}},
+    {"id": "2", "kind": "baz", "status": %q, "progress": {"done": %d, "total": 2}}
+  ]
+}}`, status, ready, taskStatus, done)
+}
+
+// downDoer fails the given calls as if the daemon could not be reached
+type downDoer struct {
+	cs   *clientSuite
+	down map[int]bool
+}
+
+func (d *downDoer) Do(req *http.Request) (*http.Response, error) {
+	if d.down[d.cs.doCalls] {
+		d.cs.doCalls++
+		return nil, errors.New("connection refused")
+	}
+	return d.cs.Do(req)
+}
+
+func (cs *clientSuite) collectUpdates(c *C, ctx context.Context) []client.ChangeUpdate {
+	var updates []client.ChangeUpdate
+	for upd := range cs.cli.Watch(ctx, "42") {
+		updates = append(updates, upd)
+	}
+	return updates
+}
+
+func (cs *clientSuite) TestWatch(c *C) {
+	defer client.MockWatchTimings(time.Millisecond, time.Second)()
+	cs.rsps = []string{
+		changeJSON("Doing", false, "Doing", 0),
+		changeJSON("Doing", false, "Doing", 0),
+		changeJSON("Doing", false, "Doing", 1),
+		changeJSON("Done", true, "Done", 2),
+	}
+
+	updates := cs.collectUpdates(c, context.Background())
+	c.Assert(updates, HasLen, 3)
+	c.Check(cs.doCalls, Equals, 4)
+
+	c.Check(updates[0].Err, IsNil)
+	c.Check(updates[0].Change.Status, Equals, "Doing")
+	c.Check(updates[0].Tasks, HasLen, 2)
+
+	c.Check(updates[1].Change.Status, Equals, "Doing")
+	c.Assert(updates[1].Tasks, HasLen, 1)
+	c.Check(updates[1].Tasks[0].ID, Equals, "2")
+	c.Check(updates[1].Tasks[0].Progress.Done, Equals, 1)
+
+	c.Check(updates[2].Change.Status, Equals, "Done")
+	c.Check(updates[2].Change.Ready, Equals, true)
+	c.Assert(updates[2].Tasks, HasLen, 1)
+	c.Check(updates[2].Tasks[0].Status, Equals, "Done")
+
+	for _, req := range cs.reqs {
+		c.Check(req.URL.Path, Equals, "/v2/changes/42")
+	}
+}
+
+func (cs *clientSuite) TestWatchDaemonRestart(c *C) {
+	defer client.MockWatchTimings(time.Millisecond, time.Second)()
+	defer client.MockDoTimings(time.Millisecond, time.Millisecond)()
+	cs.cli.SetDoer(&downDoer{cs: cs, down: map[int]bool{1: true, 2: true}})
+	cs.rsps = []string{
+		changeJSON("Doing", false, "Doing", 0),
+		"",
+		"",
+		changeJSON("Done", true, "Done", 2),
+	}
+
+	updates := cs.collectUpdates(c, context.Background())
+	c.Assert(updates, HasLen, 2)
+	c.Check(updates[0].Change.Status, Equals, "Doing")
+	c.Check(updates[1].Err, IsNil)
+	c.Check(updates[1].Change.Status, Equals, "Done")
+	c.Check(cs.doCalls, Equals, 4)
+}
+
+func (cs *clientSuite) TestWatchDaemonGone(c *C) {
+	defer client.MockWatchTimings(time.Millisecond, 10*time.Millisecond)()
+	defer client.MockDoTimings(time.Millisecond, time.Millisecond)()
+	cs.err = errors.New("connection refused")
+
+	updates := cs.collectUpdates(c, context.Background())
+	c.Assert(updates, HasLen, 1)
+	c.Check(updates[0].Change, IsNil)
+	c.Check(updates[0].Err, ErrorMatches, "cannot communicate with server: connection refused")
+}
+
+func (cs *clientSuite) TestWatchError(c *C) {
+	cs.status = 404
+	cs.rsp = `{"type": "error", "result": {"message": "cannot find change with id \"42\"", "kind": "not-found"}}`
+
+	updates := cs.collectUpdates(c, context.Background())
+	c.Assert(updates, HasLen, 1)
+	c.Check(updates[0].Err, ErrorMatches, `cannot find change with id "42"`)
+	c.Check(cs.doCalls, Equals, 1)
+}
+
+func (cs *clientSuite) TestWatchCanceled(c *C) {
+	defer client.MockWatchTimings(time.Millisecond, time.Second)()
+	cs.rsp = changeJSON("Doing", false, "Doing", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := cs.cli.Watch(ctx, "42")
+	upd := <-updates
+	c.Check(upd.Change.Status, Equals, "Doing")
+	cancel()
+	for upd := range updates {
+		c.Check(upd.Err, Equals, context.Canceled)
+	}
+}
+
+func (cs *clientSuite) TestWaitChange(c *C) {
+	defer client.MockWatchTimings(time.Millisecond, time.Second)()
+	cs.rsps = []string{
+		changeJSON("Doing", false, "Doing", 0),
+		changeJSON("Done", true, "Done", 2),
+	}
+
+	var seen []string
+	chg, err := cs.cli.WaitChange(context.Background(), "42", func(upd *client.ChangeUpdate) {
+		seen = append(seen, upd.Change.Status)
+	})
+	c.Assert(err, IsNil)
+	c.Check(chg.Status, Equals, "Done")
+	c.Check(seen, DeepEquals, []string{"Doing", "Done"})
+}
+
+func (cs *clientSuite) TestWaitChangeFailed(c *C) {
+	cs.rsp = `{"type": "sync", "result": {"id": "42", "status": "Error", "ready": true, "err": "boom"}}`
+
+	chg, err := cs.cli.WaitChange(context.Background(), "42", nil)
+	c.Check(err, ErrorMatches, "boom")
+	c.Assert(chg, NotNil)
+	c.Check(chg.Status, Equals, "Error")
+}
+
+func (cs *clientSuite) TestRetry(c *C) {
+	errs := []error{
+		&client.Error{Kind: client.ErrorKindSnapChangeConflict, Message: "conflict"},
+		&client.Error{Kind: client.ErrorKindDaemonRestart, Message: "daemon is restarting"},
+		client.ConnectionError{Err: errors.New("connection refused")},
+		nil,
+	}
+	n := 0
+	err := client.Retry(context.Background(), &client.RetryOptions{Interval: time.Millisecond}, func() error {
+		n++
+		return errs[n-1]
+	})
+	c.Check(err, IsNil)
+	c.Check(n, Equals, 4)
+}
+
+func (cs *clientSuite) TestRetryNotRetryable(c *C) {
+	n := 0
+	err := client.Retry(context.Background(), &client.RetryOptions{Interval: time.Millisecond}, func() error {
+		n++
+		return &client.Error{Kind: client.ErrorKindSnapNotFound, Message: "not found"}
+	})
+	c.Check(err, ErrorMatches, "not found")
+	c.Check(n, Equals, 1)
+}
+
+func (cs *clientSuite) TestRetryTimeout(c *C) {
+	n := 0
+	err := client.Retry(context.Background(), &client.RetryOptions{Interval: time.Millisecond, Timeout: 20 * time.Millisecond}, func() error {
+		n++
+		return &client.Error{Kind: client.ErrorKindSystemRestart, Message: "system is restarting"}
+	})
+	c.Check(err, ErrorMatches, "system is restarting")
+	c.Check(n > 1, Equals, true)
+}
+
+func (cs *clientSuite) TestRetryCanceled(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	err := client.Retry(ctx, &client.RetryOptions{Interval: time.Hour}, func() error {
+		n++
+		cancel()
+		return client.ConnectionError{Err: errors.New("connection refused")}
+	})
+	c.Check(err, ErrorMatches, "cannot communicate with server: connection refused")
+	c.Check(n, Equals, 1)
+}
+
+func (cs *clientSuite) TestIsRestartError(c *C) {
+	for _, t := range []struct {
+		err     error
+		restart bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{&client.Error{Kind: client.ErrorKindDaemonRestart}, true},
+		{&client.Error{Kind: client.ErrorKindSystemRestart}, true},
+		{&client.Error{Kind: client.ErrorKindSnapNotFound}, false},
+		{client.ConnectionError{Err: errors.New("connection refused")}, true},
+		{xerrors.Errorf("wrapped: %w", client.ConnectionError{Err: errors.New("connection refused")}), true},
+		{client.ConnectionError{Err: context.Canceled}, false},
+		{client.ConnectionError{Err: context.DeadlineExceeded}, false},
+	} {
+		c.Check(client.IsRestartError(t.err), Equals, t.restart, Commentf("%v", t.err))
+	}
+}
@@ -73,6 +73,7 @@ var (
 	secbootMeasureSnapSystemEpochWhenPossible = secboot.MeasureSnapSystemEpochWhenPossible
 	secbootMeasureSnapModelWhenPossible       = secboot.MeasureSnapModelWhenPossible
 	secbootUnlockVolumeIfEncrypted            = secboot.UnlockVolumeIfEncrypted
+	secbootUnlockEncryptedVolumeUsingKey      = secboot.UnlockEncryptedVolumeUsingKey
 
 	bootFindPartitionUUIDForBootedKernelDisk = boot.FindPartitionUUIDForBootedKernelDisk
 )
@@ -115,6 +116,8 @@ func generateInitramfsMounts() error {
 		return generateMountsModeRecover(mst)
 	case "install":
 		return generateMountsModeInstall(mst)
+	case "factory-reset":
+		return generateMountsModeFactoryReset(mst)
 	case "run":
 		return generateMountsModeRun(mst)
 	}
@@ -251,12 +254,9 @@ func copyFromGlobHelper(src, dst, globEx string) error {
 	return nil
 }
 
-func generateMountsModeRecover(mst *initramfsMountsState) error {
-	// steps 1 and 2 are shared with install mode
-	if err := generateMountsCommonInstallRecover(mst); err != nil {
-		return err
-	}
-
+// mountHostUbuntuData mounts the ubuntu-data partition of the installed
+// system, unlocking it if it is encrypted.
+func mountHostUbuntuData() error {
 	// get the disk that we mounted the ubuntu-seed partition from as a
 	// reference point for future mounts
 	disk, err := disks.DiskFromMountPoint(boot.InitramfsUbuntuSeedDir, nil)
@@ -264,7 +264,6 @@ func generateMountsModeRecover(mst *initramfsMountsState) error {
 		return err
 	}
 
-	// 3. mount ubuntu-data for recovery
 	const lockKeysOnFinish = true
 	device, isDecryptDev, err := secbootUnlockVolumeIfEncrypted(disk, "ubuntu-data", boot.InitramfsEncryptionKeyDir, lockKeysOnFinish)
 	if err != nil {
@@ -276,7 +275,7 @@ func generateMountsModeRecover(mst *initramfsMountsState) error {
 		return err
 	}
 
-	// 3.1 verify that the host ubuntu-data comes from where we expect it to
+	// verify that the host ubuntu-data comes from where we expect it to
 	diskOpts := &disks.Options{}
 	if isDecryptDev {
 		// then we need to specify that the data mountpoint is expected to be a
@@ -292,6 +291,88 @@ func generateMountsModeRecover(mst *initramfsMountsState) error {
 		return fmt.Errorf("cannot validate boot: ubuntu-data mountpoint is expected to be from disk %s but is not", disk.Dev())
 	}
 
+	return mountUbuntuSave(disk, filepath.Join(boot.InitramfsHostUbuntuDataDir, "system-data"))
+}
+
+// mountUbuntuSave mounts the ubuntu-save partition of the disk if there is
+// one, using the key stored in the given ubuntu-data writable dir to unlock
+// it if it is encrypted. It is made available to the system being booted at
+// /var/lib/snapd/save.
+func mountUbuntuSave(disk disks.Disk, dataWritableDir string) error {
+	var device string
+	keyFile := filepath.Join(dirs.SnapFDEDirUnder(dataWritableDir), "ubuntu-save.key")
+	if osutil.FileExists(keyFile) {
+		key, err := secboot.EncryptionKeyFromFile(keyFile)
+		if err != nil {
+			return err
+		}
+		device, err = secbootUnlockEncryptedVolumeUsingKey(disk, "ubuntu-save", key)
+		if err != nil {
+			return err
+		}
+	} else {
+		partUUID, err := disk.FindMatchingPartitionUUID("ubuntu-save")
+		if _, ok := err.(disks.FilesystemLabelNotFoundError); ok {
+			// no ubuntu-save on this device
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		device = fmt.Sprintf("/dev/disk/by-partuuid/%s", partUUID)
+	}
+
+	if err := doSystemdMount(device, boot.InitramfsUbuntuSaveDir, nil); err != nil {
+		return err
+	}
+	return writeUbuntuSaveMountUnit(boot.InitramfsWritableDir)
+}
+
+const ubuntuSaveMountUnit = `[Unit]
+Description=Mount unit for ubuntu-save
+Before=snapd.service
+
+[Mount]
+What=%s
+Where=%s
+Type=none
+Options=bind
+
+[Install]
+WantedBy=local-fs.target
+`
+
+// writeUbuntuSaveMountUnit writes the unit that bind mounts ubuntu-save at
+// /var/lib/snapd/save in the system using the given writable dir.
+func writeUbuntuSaveMountUnit(writableDir string) error {
+	unitName := "var-lib-snapd-save.mount"
+	unitsDir := filepath.Join(writableDir, "etc/systemd/system")
+	wantsDir := filepath.Join(unitsDir, "local-fs.target.wants")
+	if err := os.MkdirAll(wantsDir, 0755); err != nil {
+		return err
+	}
+	content := fmt.Sprintf(ubuntuSaveMountUnit, dirs.StripRootDir(boot.InitramfsUbuntuSaveDir), dirs.StripRootDir(dirs.SnapSaveDir))
+	if err := osutil.AtomicWriteFile(filepath.Join(unitsDir, unitName), []byte(content), 0644, 0); err != nil {
+		return err
+	}
+	unitLink := filepath.Join(wantsDir, unitName)
+	if osutil.IsSymlink(unitLink) {
+		return nil
+	}
+	return os.Symlink(filepath.Join("/etc/systemd/system", unitName), unitLink)
+}
+
+func generateMountsModeRecover(mst *initramfsMountsState) error {
+	// steps 1 and 2 are shared with install mode
+	if err := generateMountsCommonInstallRecover(mst); err != nil {
+		return err
+	}
+
+	// 3. mount ubuntu-data and ubuntu-save for recovery
+	if err := mountHostUbuntuData(); err != nil {
+		return err
+	}
+
 	// 4. final step: copy the auth data and network config from
 	//    the real ubuntu-data dir to the ephemeral ubuntu-data
 	//    dir, write the modeenv to the tmpfs data, and disable
@@ -330,6 +411,46 @@ func generateMountsModeRecover(mst *initramfsMountsState) error {
 	return nil
 }
 
+func generateMountsModeFactoryReset(mst *initramfsMountsState) error {
+	// steps 1 and 2 are shared with install and recover modes
+	if err := generateMountsCommonInstallRecover(mst); err != nil {
+		return err
+	}
+
+	// 3. mount ubuntu-data and ubuntu-save, snapd reads the device identity
+	//    from there before recreating ubuntu-data
+	if err := mountHostUbuntuData(); err != nil {
+		// without them neither the device identity nor the keys of
+		// ubuntu-save can be kept
+		return fmt.Errorf("cannot factory reset: cannot access ubuntu-data of the installed system: %v", err)
+	}
+
+	// 4. final step: copy the network config from the real ubuntu-data dir
+	//    to the ephemeral ubuntu-data dir, write the modeenv to the tmpfs
+	//    data, and disable cloud-init in factory-reset mode
+	if err := copyNetworkConfig(boot.InitramfsHostUbuntuDataDir, boot.InitramfsDataDir); err != nil {
+		return err
+	}
+
+	modeEnv := &boot.Modeenv{
+		Mode:           "factory-reset",
+		RecoverySystem: mst.recoverySystem,
+	}
+	if err := modeEnv.WriteTo(boot.InitramfsWritableDir); err != nil {
+		return err
+	}
+	// we need to put the file to disable cloud-init in the
+	// _writable_defaults dir for writable-paths(5) to install it properly
+	writableDefaultsDir := sysconfig.WritableDefaultsDir(boot.InitramfsWritableDir)
+	if err := sysconfig.DisableCloudInit(writableDefaultsDir); err != nil {
+		return err
+	}
+
+	// done, no output, no error indicates to initramfs we are done with
+	// mounting stuff
+	return nil
+}
+
 // mountPartitionMatchingKernelDisk will select the partition to mount at dir,
 // using the boot package function FindPartitionUUIDForBootedKernelDisk to
 // determine what partition the booted kernel came from. If which disk the
@@ -480,6 +601,11 @@ func generateMountsModeRun(mst *initramfsMountsState) error {
 		return fmt.Errorf("cannot validate boot: ubuntu-data mountpoint is expected to be from disk %s but is not", disk.Dev())
 	}
 
+	// 4.1.1 mount ubuntu-save, if the device has it
+	if err := mountUbuntuSave(disk, boot.InitramfsWritableDir); err != nil {
+		return err
+	}
+
 	// 4.2. read modeenv
 	modeEnv, err := boot.ReadModeenv(boot.InitramfsWritableDir)
 	if err != nil {
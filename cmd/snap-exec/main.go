@@ -113,6 +113,10 @@ func findCommand(app *snap.AppInfo, command string) (string, error) {
 		cmd = app.ReloadCommand
 	case "post-stop":
 		cmd = app.PostStopCommand
+	case "health-probe":
+		if app.HealthProbe != nil {
+			cmd = app.HealthProbe.Exec
+		}
 	case "", "gdb", "gdbserver":
 		cmd = app.Command
 	default:
@@ -63,6 +63,8 @@ apps:
   command: run-app cmd-arg1 $SNAP_DATA
   stop-command: stop-app
   post-stop-command: post-stop-app
+  health-probe:
+   exec: probe-app
   completer: you/complete/me
   environment:
    BASE_PATH: /some/path
@@ -123,6 +125,7 @@ func (s *snapExecSuite) TestFindCommand(c *C) {
 		{cmd: "", expected: `run-app cmd-arg1 $SNAP_DATA`},
 		{cmd: "stop", expected: "stop-app"},
 		{cmd: "post-stop", expected: "post-stop-app"},
+		{cmd: "health-probe", expected: "probe-app"},
 	} {
 		cmd, err := snapExec.FindCommand(info.Apps["app"], t.cmd)
 		c.Check(err, IsNil)
@@ -130,6 +133,14 @@ func (s *snapExecSuite) TestFindCommand(c *C) {
 	}
 }
 
+func (s *snapExecSuite) TestFindCommandNoHealthProbe(c *C) {
+	info, err := snap.InfoFromSnapYaml(mockYaml)
+	c.Assert(err, IsNil)
+
+	_, err = snapExec.FindCommand(info.Apps["app2"], "health-probe")
+	c.Check(err, ErrorMatches, `no "health-probe" command found for "app2"`)
+}
+
 func (s *snapExecSuite) TestFindCommandInvalidCommand(c *C) {
 	info, err := snap.InfoFromSnapYaml(mockYaml)
 	c.Assert(err, IsNil)
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"time"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
@@ -34,6 +35,13 @@ var shortChangesHelp = i18n.G("List system changes")
 var shortTasksHelp = i18n.G("List a change's tasks")
 var longChangesHelp = i18n.G(`
 The changes command displays a summary of system changes performed recently.
+
+The changes shown can be restricted to those of the given kinds or statuses,
+and to those spawned since a given time, given either as a date
+(2006-01-02), as a RFC3339 timestamp or as a duration ago (e.g. 48h).
+
+With --archived, changes already pruned from the system state are also shown
+if they were kept, see the core changes.archive option.
 `)
 var longTasksHelp = i18n.G(`
 The tasks command displays a summary of tasks associated with an individual
@@ -43,6 +51,11 @@ change.
 type cmdChanges struct {
 	clientMixin
 	timeMixin
+	formatMixin
+	Kind       []string `long:"kind" value-name:"<kind>"`
+	Status     []string `long:"status" value-name:"<status>"`
+	Since      string   `long:"since" value-name:"<time>"`
+	Archived   bool     `long:"archived"`
 	Positional struct {
 		Snap string `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -50,15 +63,25 @@ type cmdChanges struct {
 
 type cmdTasks struct {
 	timeMixin
+	formatMixin
 	changeIDMixin
 }
 
 func init() {
 	addCommand("changes", shortChangesHelp, longChangesHelp,
-		func() flags.Commander { return &cmdChanges{} }, timeDescs, nil)
+		func() flags.Commander { return &cmdChanges{} }, timeDescs.also(formatDescs).also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"kind": i18n.G("Only show changes of the given kind (can be repeated)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"status": i18n.G("Only show changes with the given status (can be repeated)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"since": i18n.G("Only show changes spawned since the given time"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"archived": i18n.G("Also show archived changes"),
+		}), nil)
 	addCommand("tasks", shortTasksHelp, longTasksHelp,
 		func() flags.Commander { return &cmdTasks{} },
-		changeIDMixinOptDesc.also(timeDescs),
+		changeIDMixinOptDesc.also(timeDescs).also(formatDescs),
 		changeIDMixinArgDesc).alias = "change"
 }
 
@@ -70,6 +93,27 @@ func (s changesByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 var allDigits = regexp.MustCompile(`^[0-9]+$`).MatchString
 
+// parseSince parses the given time, either a RFC3339 timestamp, a date
+// or a duration before now.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return timeNow().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf(i18n.G("cannot parse --since %q: expected a date, a RFC3339 timestamp or a duration"), s)
+}
+
+// changeScheduled returns whether the change is waiting for the time
+// it was scheduled to start at.
+func changeScheduled(chg *client.Change) bool {
+	return !chg.Ready && chg.Status == "Do" && chg.NotBefore.After(timeNow())
+}
+
 func queryChanges(cli *client.Client, opts *client.ChangesOptions) ([]*client.Change, error) {
 	chgs, err := cli.Changes(opts)
 	if err != nil {
@@ -99,6 +143,16 @@ func (c *cmdChanges) Execute(args []string) error {
 	opts := client.ChangesOptions{
 		SnapName: c.Positional.Snap,
 		Selector: client.ChangesAll,
+		Kinds:    c.Kind,
+		Statuses: c.Status,
+		Archived: c.Archived,
+	}
+	if c.Since != "" {
+		since, err := parseSince(c.Since)
+		if err != nil {
+			return err
+		}
+		opts.Since = since
 	}
 
 	changes, err := queryChanges(c.client, &opts)
@@ -106,12 +160,19 @@ func (c *cmdChanges) Execute(args []string) error {
 		return err
 	}
 
+	sort.Sort(changesByTime(changes))
+
+	if c.structured() {
+		if changes == nil {
+			changes = []*client.Change{}
+		}
+		return c.printStructured(changes)
+	}
+
 	if len(changes) == 0 {
 		return fmt.Errorf(i18n.G("no changes found"))
 	}
 
-	sort.Sort(changesByTime(changes))
-
 	w := tabWriter()
 
 	fmt.Fprintf(w, i18n.G("ID\tStatus\tSpawn\tReady\tSummary\n"))
@@ -121,7 +182,11 @@ func (c *cmdChanges) Execute(args []string) error {
 		if chg.ReadyTime.IsZero() {
 			readyTime = "-"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", chg.ID, chg.Status, spawnTime, readyTime, chg.Summary)
+		status := chg.Status
+		if changeScheduled(chg) {
+			status = i18n.G("Scheduled")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", chg.ID, status, spawnTime, readyTime, chg.Summary)
 	}
 
 	w.Flush()
@@ -159,6 +224,10 @@ func (c *cmdTasks) showChange(chid string) error {
 		return err
 	}
 
+	if c.structured() {
+		return c.printStructured(chg)
+	}
+
 	w := tabWriter()
 
 	fmt.Fprintf(w, i18n.G("Status\tSpawn\tReady\tSummary\n"))
@@ -177,6 +246,12 @@ func (c *cmdTasks) showChange(chid string) error {
 
 	w.Flush()
 
+	if changeScheduled(chg) {
+		fmt.Fprintln(Stdout)
+		// TRANSLATORS: %s is a time, as shown in the Spawn and Ready columns
+		fmt.Fprintf(Stdout, i18n.G("Scheduled to start %s\n"), c.fmtTime(chg.NotBefore))
+	}
+
 	for _, t := range chg.Tasks {
 		if len(t.Log) == 0 {
 			continue
@@ -20,9 +20,12 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -231,3 +234,172 @@ Doing +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +some summary \(50.00%\)
 `)
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+func (s *SnapSuite) TestChangesFilters(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2020, 10, 2, 10, 0, 0, 0, time.UTC)
+	})
+	defer restore()
+
+	for _, t := range []struct {
+		since string
+		query string
+	}{
+		{"2020-10-01T10:00:00Z", "2020-10-01T10:00:00Z"},
+		{"48h", "2020-09-30T10:00:00Z"},
+		{"2020-10-01", time.Date(2020, 10, 1, 0, 0, 0, 0, time.Local).Format(time.RFC3339)},
+	} {
+		n := 0
+		s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes")
+			c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+				"select":   {"all"},
+				"kind":     {"install-snap,remove-snap"},
+				"status":   {"Done"},
+				"since":    {t.query},
+				"archived": {"true"},
+			})
+			fmt.Fprintln(w, mockChangesJSON)
+			n++
+		})
+
+		_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--abs-time",
+			"--kind=install-snap", "--kind=remove-snap", "--status=Done", "--since=" + t.since, "--archived"})
+		c.Assert(err, check.IsNil)
+		c.Check(n, check.Equals, 1)
+		c.Check(s.Stdout(), check.Matches, `(?ms)ID +Status +Spawn +Ready +Summary
+four +Do +2015-02-21T01:02:03Z +2015-02-21T01:02:04Z +...
+.*`)
+		s.ResetStdStreams()
+	}
+}
+
+func (s *SnapSuite) TestChangesScheduled(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2020, 10, 2, 10, 0, 0, 0, time.UTC)
+	})
+	defer restore()
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/changes")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+  {"id": "one", "kind": "remove-snap", "summary": "...", "status": "Do", "ready": false,
+   "spawn-time": "2020-10-02T09:00:00Z", "not-before": "2020-10-03T02:00:00Z"},
+  {"id": "two", "kind": "remove-snap", "summary": "...", "status": "Do", "ready": false,
+   "spawn-time": "2020-10-02T09:30:00Z", "not-before": "2020-10-02T09:45:00Z"}
+]}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `ID   Status     Spawn                 Ready  Summary
+one  Scheduled  2020-10-02T09:00:00Z  -      ...
+two  Do         2020-10-02T09:30:00Z  -      ...
+
+`)
+}
+
+func (s *SnapSuite) TestTasksScheduled(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2020, 10, 2, 10, 0, 0, 0, time.UTC)
+	})
+	defer restore()
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+		fmt.Fprintln(w, `{"type": "sync", "result": {"id": "42", "kind": "remove-snap", "summary": "...",
+  "status": "Do", "ready": false, "spawn-time": "2020-10-02T09:00:00Z", "not-before": "2020-10-03T02:00:00Z",
+  "tasks": [{"kind": "bar", "summary": "some summary", "status": "Do", "progress": {"done": 0, "total": 1},
+    "spawn-time": "2020-10-02T09:00:00Z"}]}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"tasks", "--abs-time", "42"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `Status  Spawn                 Ready  Summary
+Do      2020-10-02T09:00:00Z  -      some summary
+
+Scheduled to start 2020-10-03T02:00:00Z
+
+`)
+}
+
+func (s *SnapSuite) TestChangesBadSince(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, since := range []string{"yesterday", "-1h", "2020-13-01"} {
+		_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--since=" + since})
+		c.Check(err, check.ErrorMatches, fmt.Sprintf(`cannot parse --since %q: expected a date, a RFC3339 timestamp or a duration`, since))
+	}
+}
+
+func (s *SnapSuite) TestTasksFormatYAML(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+		fmt.Fprintln(w, mockChangeInProgressJSON)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"tasks", "--format=yaml", "42"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `
+id: uno
+kind: foo
+not-before: "0001-01-01T00:00:00Z"
+ready: false
+ready-time: "2016-04-21T01:02:04Z"
+spawn-time: "2016-04-21T01:02:03Z"
+status: Do
+summary: '...'
+tasks:
+- id: ""
+  kind: bar
+  progress:
+    done: 50
+    label: ""
+    total: 100
+  ready-time: "2016-04-21T01:02:04Z"
+  spawn-time: "2016-04-21T01:02:03Z"
+  status: Doing
+  summary: some summary
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestChangesFormatJSON(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/changes")
+		fmt.Fprintln(w, mockChangesJSON)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--format=json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stderr(), check.Equals, "")
+
+	var changes []map[string]interface{}
+	c.Assert(json.Unmarshal(s.stdout.Bytes(), &changes), check.IsNil)
+	c.Assert(changes, check.HasLen, 4)
+	// sorted by spawn time, as in the text output
+	var ids []string
+	for _, chg := range changes {
+		ids = append(ids, chg["id"].(string))
+	}
+	c.Check(ids, check.DeepEquals, []string{"four", "three", "one", "two"})
+	c.Check(changes[0]["kind"], check.Equals, "install-snap")
+	c.Check(changes[0]["status"], check.Equals, "Do")
+	c.Check(changes[0]["spawn-time"], check.Equals, "2015-02-21T01:02:03Z")
+	c.Check(changes[0]["tasks"], check.HasLen, 1)
+}
+
+func (s *SnapSuite) TestChangesFormatJSONNoChanges(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--format=json"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "[]\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
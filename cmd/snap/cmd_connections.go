@@ -32,6 +32,7 @@ import (
 
 type cmdConnections struct {
 	clientMixin
+	formatMixin
 	All         bool `long:"all"`
 	Positionals struct {
 		Snap installedSnapName
@@ -56,9 +57,9 @@ snap.
 func init() {
 	addCommand("connections", shortConnectionsHelp, longConnectionsHelp, func() flags.Commander {
 		return &cmdConnections{}
-	}, map[string]string{
+	}, formatDescs.also(map[string]string{
 		"all": i18n.G("Show connected and unconnected plugs and slots"),
-	}, []argDesc{{
+	}), []argDesc{{
 		// TRANSLATORS: This needs to be wrapped in <>s.
 		name: "<snap>",
 		// TRANSLATORS: This should not start with a lowercase letter.
@@ -158,6 +159,9 @@ func (x *cmdConnections) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
+	if x.structured() {
+		return x.printStructured(connections)
+	}
 	if len(connections.Plugs) == 0 && len(connections.Slots) == 0 {
 		return nil
 	}
@@ -0,0 +1,78 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/release"
+)
+
+type cmdBootChains struct {
+	clientMixin
+	Kernel string `long:"kernel"`
+}
+
+var bootDumpBootChains = boot.DumpBootChains
+
+func init() {
+	cmd := addDebugCommand("boot-chains",
+		"(internal) show the boot chains of the encryption keys",
+		"(internal) show the boot chains the encryption keys were last sealed with, the boot chains they would be resealed with and the resulting PCR profile parameters, without changing the system",
+		func() flags.Commander {
+			return &cmdBootChains{}
+		}, map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"kernel": i18n.G("Preview a refresh to the kernel snap with the given file name, eg. pc-kernel_123.snap"),
+		}, nil)
+	if release.OnClassic {
+		cmd.hidden = true
+	}
+}
+
+func (x *cmdBootChains) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if release.OnClassic {
+		return errors.New(`the "boot-chains" command is not available on classic systems`)
+	}
+	var resp struct {
+		Model string `json:"model"`
+	}
+	if err := x.client.DebugGet("model", &resp, nil); err != nil {
+		return err
+	}
+	as, err := asserts.Decode([]byte(resp.Model))
+	if err != nil {
+		return fmt.Errorf("cannot decode model assertion: %v", err)
+	}
+	model, ok := as.(*asserts.Model)
+	if !ok {
+		return fmt.Errorf("internal error: unexpected assertion type %q", as.Type().Name)
+	}
+	return bootDumpBootChains(Stdout, model, x.Kernel)
+}
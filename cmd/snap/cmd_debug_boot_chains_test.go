@@ -0,0 +1,75 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	snap "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/release"
+)
+
+func (s *SnapSuite) TestDebugBootChains(c *check.C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	encoded, err := json.Marshal(happyModelAssertionResponse)
+	c.Assert(err, check.IsNil)
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/debug")
+		c.Check(r.URL.RawQuery, check.Equals, "aspect=model")
+		fmt.Fprintf(w, `{"type": "sync", "result": {"model": %s}}`, encoded)
+	})
+
+	dumpCalls := 0
+	restore = snap.MockBootDumpBootChains(func(w io.Writer, model *asserts.Model, candidateKernel string) error {
+		dumpCalls++
+		c.Check(model.Model(), check.Equals, "test-model")
+		c.Check(candidateKernel, check.Equals, "pc-kernel_2.snap")
+		fmt.Fprintf(w, "boot chains\n")
+		return nil
+	})
+	defer restore()
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "boot-chains", "--kernel", "pc-kernel_2.snap"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, "boot chains\n")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+	c.Check(dumpCalls, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestDebugBootChainsNotOnClassic(c *check.C) {
+	restore := release.MockOnClassic(true)
+	defer restore()
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "boot-chains"})
+	c.Assert(err, check.ErrorMatches, `the "boot-chains" command is not available on classic systems`)
+}
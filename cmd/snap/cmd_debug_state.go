@@ -20,16 +20,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/timings"
 )
 
 type cmdDebugState struct {
@@ -43,8 +46,13 @@ type cmdDebugState struct {
 
 	IsSeeded bool `long:"is-seeded"`
 
+	Check  bool `long:"check"`
+	Repair bool `long:"repair"`
+
 	// flags for --change=N output
 	DotOutput bool `long:"dot"` // XXX: mildly useful (too crowded in many cases), but let's have it just in case
+	JSONGraph bool `long:"json-graph"`
+	Timeline  bool `long:"timeline"`
 	// When inspecting errors/undone tasks, those in Hold state are usually irrelevant, make it possible to ignore them
 	NoHoldState bool `long:"no-hold"`
 
@@ -54,7 +62,15 @@ type cmdDebugState struct {
 }
 
 var cmdDebugStateShortHelp = i18n.G("Inspect a snapd state file.")
-var cmdDebugStateLongHelp = i18n.G("Inspect a snapd state file, bypassing snapd API.")
+var cmdDebugStateLongHelp = i18n.G(`
+Inspect a snapd state file, bypassing snapd API.
+
+With --check, the references between changes and tasks, the lanes of the
+tasks, the snap sequences against the snap files on disk and the connections
+against the installed snaps are checked for consistency. With --repair, a
+copy of the state with the problems that can be repaired fixed is written to
+<state-file>.repaired; the original state file is left untouched.
+`)
 
 type byChangeID []*state.Change
 
@@ -80,12 +96,16 @@ func init() {
 		return &cmdDebugState{}
 	}, timeDescs.also(map[string]string{
 		// TRANSLATORS: This should not start with a lowercase letter.
-		"change":    i18n.G("ID of the change to inspect"),
-		"task":      i18n.G("ID of the task to inspect"),
-		"dot":       i18n.G("Dot (graphviz) output"),
-		"no-hold":   i18n.G("Omit tasks in 'Hold' state in the change output"),
-		"changes":   i18n.G("List all changes"),
-		"is-seeded": i18n.G("Output seeding status (true or false)"),
+		"change":     i18n.G("ID of the change to inspect"),
+		"task":       i18n.G("ID of the task to inspect"),
+		"dot":        i18n.G("Dot (graphviz) output"),
+		"json-graph": i18n.G("JSON output of the tasks of the change and their relationships"),
+		"timeline":   i18n.G("Show the timeline of the tasks of the change, with timings if available"),
+		"no-hold":    i18n.G("Omit tasks in 'Hold' state in the change output"),
+		"changes":    i18n.G("List all changes"),
+		"is-seeded":  i18n.G("Output seeding status (true or false)"),
+		"check":      i18n.G("Check the consistency of the state"),
+		"repair":     i18n.G("Check the consistency of the state and write a repaired copy of it next to it"),
 	}), nil)
 }
 
@@ -114,6 +134,27 @@ func waitChainSearch(startT, searchT *state.Task) bool {
 	return false
 }
 
+// dotStatusColors are the fill colors of the tasks in the dot output,
+// by status; tasks with other statuses are not filled.
+var dotStatusColors = map[state.Status]string{
+	state.DoingStatus:   "yellow",
+	state.UndoingStatus: "orange",
+	state.DoneStatus:    "palegreen",
+	state.ErrorStatus:   "red",
+	state.UndoneStatus:  "lightblue",
+	state.HoldStatus:    "lightgrey",
+	state.AbortStatus:   "grey",
+}
+
+func (c *cmdDebugState) writeDotTask(t *state.Task, indent string) {
+	label := fmt.Sprintf("%s %s\n%s", t.ID(), t.Kind(), t.Status())
+	if color, ok := dotStatusColors[t.Status()]; ok {
+		fmt.Fprintf(Stdout, "%s%s [label=%q, style=filled, fillcolor=%s];\n", indent, t.ID(), label, color)
+	} else {
+		fmt.Fprintf(Stdout, "%s%s [label=%q];\n", indent, t.ID(), label)
+	}
+}
+
 func (c *cmdDebugState) writeDotOutput(st *state.State, changeID string) error {
 	st.Lock()
 	defer st.Unlock()
@@ -123,13 +164,47 @@ func (c *cmdDebugState) writeDotOutput(st *state.State, changeID string) error {
 		return fmt.Errorf("no such change: %s", changeID)
 	}
 
-	fmt.Fprintf(Stdout, "digraph D{\n")
-	tasks := chg.Tasks()
-	for _, t := range tasks {
+	var tasks []*state.Task
+	for _, t := range chg.Tasks() {
 		if c.NoHoldState && t.Status() == state.HoldStatus {
 			continue
 		}
-		fmt.Fprintf(Stdout, "  %s [label=%q];\n", t.ID(), t.Kind())
+		tasks = append(tasks, t)
+	}
+	sort.Sort(byTaskID(tasks))
+
+	// tasks are grouped by their first lane, tasks not in any lane
+	// are drawn outside of the lane clusters
+	var lanes []int
+	byLane := make(map[int][]*state.Task)
+	for _, t := range tasks {
+		lane := 0
+		if tl := t.Lanes(); len(tl) > 0 {
+			lane = tl[0]
+		}
+		if _, ok := byLane[lane]; !ok {
+			lanes = append(lanes, lane)
+		}
+		byLane[lane] = append(byLane[lane], t)
+	}
+	sort.Ints(lanes)
+
+	fmt.Fprintf(Stdout, "digraph D{\n")
+	for _, lane := range lanes {
+		if lane == 0 {
+			for _, t := range byLane[lane] {
+				c.writeDotTask(t, "  ")
+			}
+			continue
+		}
+		fmt.Fprintf(Stdout, "  subgraph cluster_lane_%d {\n", lane)
+		fmt.Fprintf(Stdout, "    label=\"lane %d\";\n", lane)
+		for _, t := range byLane[lane] {
+			c.writeDotTask(t, "    ")
+		}
+		fmt.Fprintf(Stdout, "  }\n")
+	}
+	for _, t := range tasks {
 		for _, wt := range t.WaitTasks() {
 			if c.NoHoldState && wt.Status() == state.HoldStatus {
 				continue
@@ -142,6 +217,176 @@ func (c *cmdDebugState) writeDotOutput(st *state.State, changeID string) error {
 	return nil
 }
 
+type graphTask struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Summary   string     `json:"summary"`
+	Status    string     `json:"status"`
+	Lanes     []int      `json:"lanes,omitempty"`
+	WaitTasks []string   `json:"wait-tasks,omitempty"`
+	HaltTasks []string   `json:"halt-tasks,omitempty"`
+	SpawnTime time.Time  `json:"spawn-time"`
+	ReadyTime *time.Time `json:"ready-time,omitempty"`
+}
+
+type changeGraph struct {
+	ID      string       `json:"id"`
+	Kind    string       `json:"kind"`
+	Summary string       `json:"summary"`
+	Status  string       `json:"status"`
+	Tasks   []*graphTask `json:"tasks"`
+}
+
+func taskIDs(tasks []*state.Task, noHold bool) []string {
+	var ids []string
+	for _, t := range tasks {
+		if noHold && t.Status() == state.HoldStatus {
+			continue
+		}
+		ids = append(ids, t.ID())
+	}
+	return ids
+}
+
+func (c *cmdDebugState) writeJSONGraph(st *state.State, changeID string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.Change(changeID)
+	if chg == nil {
+		return fmt.Errorf("no such change: %s", changeID)
+	}
+
+	graph := &changeGraph{
+		ID:      chg.ID(),
+		Kind:    chg.Kind(),
+		Summary: chg.Summary(),
+		Status:  chg.Status().String(),
+		Tasks:   []*graphTask{},
+	}
+	tasks := chg.Tasks()
+	sort.Sort(byTaskID(tasks))
+	for _, t := range tasks {
+		if c.NoHoldState && t.Status() == state.HoldStatus {
+			continue
+		}
+		gt := &graphTask{
+			ID:        t.ID(),
+			Kind:      t.Kind(),
+			Summary:   t.Summary(),
+			Status:    t.Status().String(),
+			Lanes:     t.Lanes(),
+			WaitTasks: taskIDs(t.WaitTasks(), c.NoHoldState),
+			HaltTasks: taskIDs(t.HaltTasks(), c.NoHoldState),
+			SpawnTime: t.SpawnTime(),
+		}
+		if readyTime := t.ReadyTime(); !readyTime.IsZero() {
+			gt.ReadyTime = &readyTime
+		}
+		graph.Tasks = append(graph.Tasks, gt)
+	}
+
+	enc := json.NewEncoder(Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(graph)
+}
+
+// byTaskSpawnTime sorts tasks by spawn and then ready time.
+type byTaskSpawnTime []*state.Task
+
+func (t byTaskSpawnTime) Len() int      { return len(t) }
+func (t byTaskSpawnTime) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byTaskSpawnTime) Less(i, j int) bool {
+	if !t[i].SpawnTime().Equal(t[j].SpawnTime()) {
+		return t[i].SpawnTime().Before(t[j].SpawnTime())
+	}
+	if !t[i].ReadyTime().Equal(t[j].ReadyTime()) {
+		// tasks not ready yet go last
+		if t[i].ReadyTime().IsZero() || t[j].ReadyTime().IsZero() {
+			return t[j].ReadyTime().IsZero()
+		}
+		return t[i].ReadyTime().Before(t[j].ReadyTime())
+	}
+	return byTaskID(t).Less(i, j)
+}
+
+// byTaskID sorts tasks by their numeric ID.
+type byTaskID []*state.Task
+
+func (t byTaskID) Len() int      { return len(t) }
+func (t byTaskID) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byTaskID) Less(i, j int) bool {
+	id1, _ := strconv.Atoi(t[i].ID())
+	id2, _ := strconv.Atoi(t[j].ID())
+	return id1 < id2
+}
+
+func (c *cmdDebugState) showTimeline(st *state.State, changeID string) error {
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.Change(changeID)
+	if chg == nil {
+		return fmt.Errorf("no such change: %s", changeID)
+	}
+
+	changeTimings, err := timings.Get(st, -1, func(tags map[string]string) bool {
+		return tags["change-id"] == changeID && tags["task-id"] != ""
+	})
+	if err != nil {
+		return err
+	}
+	taskTimings := make(map[string][]*timings.TimingsInfo)
+	for _, tm := range changeTimings {
+		taskID := tm.Tags["task-id"]
+		taskTimings[taskID] = append(taskTimings[taskID], tm)
+	}
+
+	tasks := chg.Tasks()
+	sort.Sort(byTaskSpawnTime(tasks))
+
+	// times are shown relative to the spawn time of the change
+	start := chg.SpawnTime()
+	w := tabwriter.NewWriter(Stdout, 5, 3, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tStatus\tStart\tReady\tDoing\tUndoing\tKind\tSummary\n")
+	for _, t := range tasks {
+		if c.NoHoldState && t.Status() == state.HoldStatus {
+			continue
+		}
+		readyStr := "-"
+		if readyTime := t.ReadyTime(); !readyTime.IsZero() {
+			readyStr = formatDuration(readyTime.Sub(start))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.ID(),
+			t.Status().String(),
+			formatDuration(t.SpawnTime().Sub(start)),
+			readyStr,
+			formatDuration(t.DoingTime()),
+			formatDuration(t.UndoingTime()),
+			t.Kind(),
+			t.Summary())
+		for _, tm := range taskTimings[t.ID()] {
+			undoing := tm.Tags["task-status"] == state.UndoingStatus.String()
+			for _, nested := range tm.NestedTimings {
+				doingStr, undoingStr := formatDuration(nested.Duration), "-"
+				if undoing {
+					doingStr, undoingStr = "-", doingStr
+				}
+				fmt.Fprintf(w, "%s^\t\t\t\t%s\t%s\t%s\t%s\n",
+					strings.Repeat(" ", nested.Level+1),
+					doingStr,
+					undoingStr,
+					nested.Label,
+					strings.Repeat(" ", 2*nested.Level)+nested.Summary)
+			}
+		}
+	}
+	w.Flush()
+
+	return nil
+}
+
 func (c *cmdDebugState) showTasks(st *state.State, changeID string) error {
 	st.Lock()
 	defer st.Unlock()
@@ -273,11 +518,6 @@ func (c *cmdDebugState) showTask(st *state.State, taskID string) error {
 }
 
 func (c *cmdDebugState) Execute(args []string) error {
-	st, err := loadState(c.Positional.StateFilePath)
-	if err != nil {
-		return err
-	}
-
 	// check valid combinations of args
 	var cmds []string
 	if c.Changes {
@@ -292,16 +532,46 @@ func (c *cmdDebugState) Execute(args []string) error {
 	if c.IsSeeded != false {
 		cmds = append(cmds, "--is-seeded")
 	}
+	if c.Check {
+		cmds = append(cmds, "--check")
+	}
+	if c.Repair {
+		cmds = append(cmds, "--repair")
+	}
 	if len(cmds) > 1 {
 		return fmt.Errorf("cannot use %s and %s together", cmds[0], cmds[1])
 	}
 
+	if c.Check || c.Repair {
+		// the state is checked without loading it, as it might
+		// not be loadable
+		return c.checkState()
+	}
+
+	st, err := loadState(c.Positional.StateFilePath)
+	if err != nil {
+		return err
+	}
+
 	if c.IsSeeded {
 		return c.showIsSeeded(st)
 	}
 
-	if c.DotOutput && c.ChangeID == "" {
-		return fmt.Errorf("--dot can only be used with --change=")
+	var outputs []string
+	if c.DotOutput {
+		outputs = append(outputs, "--dot")
+	}
+	if c.JSONGraph {
+		outputs = append(outputs, "--json-graph")
+	}
+	if c.Timeline {
+		outputs = append(outputs, "--timeline")
+	}
+	if len(outputs) > 0 && c.ChangeID == "" {
+		return fmt.Errorf("%s can only be used with --change=", outputs[0])
+	}
+	if len(outputs) > 1 {
+		return fmt.Errorf("cannot use %s and %s together", outputs[0], outputs[1])
 	}
 	if c.NoHoldState && c.ChangeID == "" {
 		return fmt.Errorf("--no-hold can only be used with --change=")
@@ -316,8 +586,13 @@ func (c *cmdDebugState) Execute(args []string) error {
 		if err != nil {
 			return fmt.Errorf("invalid change: %s", c.ChangeID)
 		}
-		if c.DotOutput {
+		switch {
+		case c.DotOutput:
 			return c.writeDotOutput(st, c.ChangeID)
+		case c.JSONGraph:
+			return c.writeJSONGraph(st, c.ChangeID)
+		case c.Timeline:
+			return c.showTimeline(st, c.ChangeID)
 		}
 		return c.showTasks(st, c.ChangeID)
 	}
@@ -0,0 +1,442 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// rawObject is a JSON object of the state file. The checks work on raw
+// objects rather than on a loaded state.State so that they can cope with
+// inconsistencies the state package would choke on, and so that the
+// repaired state keeps all the fields the checks know nothing about.
+type rawObject map[string]*json.RawMessage
+
+func (o rawObject) get(key string, v interface{}) error {
+	raw := o[key]
+	if raw == nil {
+		return nil
+	}
+	return json.Unmarshal(*raw, v)
+}
+
+func (o rawObject) set(key string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// only ever called with plain types
+		panic(fmt.Sprintf("cannot marshal %q: %v", key, err))
+	}
+	raw := json.RawMessage(data)
+	o[key] = &raw
+}
+
+func (o rawObject) setStrings(key string, l []string) {
+	if len(l) == 0 {
+		delete(o, key)
+		return
+	}
+	o.set(key, l)
+}
+
+type stateProblem struct {
+	msg     string
+	fixable bool
+}
+
+// stateChecker runs consistency checks over a state file, fixing what it
+// can in its in-memory copy of the state.
+type stateChecker struct {
+	top     rawObject
+	data    rawObject
+	changes map[string]rawObject
+	tasks   map[string]rawObject
+
+	problems []stateProblem
+}
+
+func readRawState(path string) (*stateChecker, error) {
+	if path == "" {
+		path = "state.json"
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the state file: %s", err)
+	}
+
+	sc := &stateChecker{}
+	if err := json.Unmarshal(content, &sc.top); err != nil {
+		return nil, fmt.Errorf("cannot decode the state file: %v", err)
+	}
+	for _, v := range []struct {
+		key string
+		v   interface{}
+	}{
+		{"data", &sc.data},
+		{"changes", &sc.changes},
+		{"tasks", &sc.tasks},
+	} {
+		if err := sc.top.get(v.key, v.v); err != nil {
+			return nil, fmt.Errorf("cannot decode %q of the state file: %v", v.key, err)
+		}
+	}
+	if sc.data == nil {
+		sc.data = make(rawObject)
+	}
+	if sc.changes == nil {
+		sc.changes = make(map[string]rawObject)
+	}
+	if sc.tasks == nil {
+		sc.tasks = make(map[string]rawObject)
+	}
+	return sc, nil
+}
+
+func (sc *stateChecker) report(fixable bool, format string, args ...interface{}) {
+	sc.problems = append(sc.problems, stateProblem{
+		msg:     fmt.Sprintf(format, args...),
+		fixable: fixable,
+	})
+}
+
+// sortedIDs returns the keys of the given map, sorted numerically.
+func sortedIDs(m map[string]rawObject) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		id1, _ := strconv.Atoi(ids[i])
+		id2, _ := strconv.Atoi(ids[j])
+		if id1 != id2 {
+			return id1 < id2
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func (sc *stateChecker) taskStrings(taskID, key string) []string {
+	var l []string
+	if err := sc.tasks[taskID].get(key, &l); err != nil {
+		sc.report(true, "task %s: cannot decode %s: %v", taskID, key, err)
+		delete(sc.tasks[taskID], key)
+		return nil
+	}
+	return l
+}
+
+func (sc *stateChecker) taskChange(taskID string) string {
+	var chgID string
+	if err := sc.tasks[taskID].get("change", &chgID); err != nil {
+		sc.report(true, "task %s: cannot decode change: %v", taskID, err)
+		delete(sc.tasks[taskID], "change")
+	}
+	return chgID
+}
+
+// checkTaskChanges checks the references between changes and their tasks.
+func (sc *stateChecker) checkTaskChanges() {
+	for _, taskID := range sortedIDs(sc.tasks) {
+		chgID := sc.taskChange(taskID)
+		if chgID != "" && sc.changes[chgID] == nil {
+			sc.report(true, "task %s: change %s does not exist", taskID, chgID)
+			delete(sc.tasks, taskID)
+		}
+	}
+
+	for _, chgID := range sortedIDs(sc.changes) {
+		chg := sc.changes[chgID]
+		var taskIDs []string
+		if err := chg.get("task-ids", &taskIDs); err != nil {
+			sc.report(true, "change %s: cannot decode task-ids: %v", chgID, err)
+		}
+		var kept []string
+		for _, taskID := range taskIDs {
+			switch {
+			case sc.tasks[taskID] == nil:
+				sc.report(true, "change %s: task %s does not exist", chgID, taskID)
+			case sc.taskChange(taskID) != chgID:
+				sc.report(true, "change %s: task %s belongs to another change", chgID, taskID)
+			case strutil.ListContains(kept, taskID):
+				sc.report(true, "change %s: task %s is listed more than once", chgID, taskID)
+			default:
+				kept = append(kept, taskID)
+			}
+		}
+		chg.setStrings("task-ids", kept)
+	}
+
+	for _, taskID := range sortedIDs(sc.tasks) {
+		chgID := sc.taskChange(taskID)
+		if chgID == "" {
+			continue
+		}
+		chg := sc.changes[chgID]
+		var taskIDs []string
+		chg.get("task-ids", &taskIDs)
+		if !strutil.ListContains(taskIDs, taskID) {
+			sc.report(true, "task %s: not listed in its change %s", taskID, chgID)
+			chg.setStrings("task-ids", append(taskIDs, taskID))
+		}
+	}
+}
+
+// checkTaskLinks checks that the wait and halt relationships between
+// tasks refer to existing tasks and are symmetric.
+func (sc *stateChecker) checkTaskLinks() {
+	for _, links := range []struct {
+		key, inverse string
+	}{
+		{"wait-tasks", "halt-tasks"},
+		{"halt-tasks", "wait-tasks"},
+	} {
+		for _, taskID := range sortedIDs(sc.tasks) {
+			var kept []string
+			for _, otherID := range sc.taskStrings(taskID, links.key) {
+				if sc.tasks[otherID] == nil {
+					sc.report(true, "task %s: %s refers to missing task %s", taskID, links.key, otherID)
+					continue
+				}
+				if strutil.ListContains(kept, otherID) {
+					continue
+				}
+				kept = append(kept, otherID)
+				inverse := sc.taskStrings(otherID, links.inverse)
+				if !strutil.ListContains(inverse, taskID) {
+					sc.report(true, "task %s: %s has %s but task %s lacks the matching %s", taskID, links.key, otherID, otherID, links.inverse)
+					sc.tasks[otherID].setStrings(links.inverse, append(inverse, taskID))
+				}
+			}
+			sc.tasks[taskID].setStrings(links.key, kept)
+		}
+	}
+}
+
+// checkCounters checks the lanes of the tasks and that the last used
+// change, task and lane IDs are not behind the ones in use.
+func (sc *stateChecker) checkCounters() {
+	laneChange := make(map[int]string)
+	maxLane := 0
+	for _, taskID := range sortedIDs(sc.tasks) {
+		var lanes []int
+		if err := sc.tasks[taskID].get("lanes", &lanes); err != nil {
+			sc.report(true, "task %s: cannot decode lanes: %v", taskID, err)
+			delete(sc.tasks[taskID], "lanes")
+			continue
+		}
+		chgID := sc.taskChange(taskID)
+		for _, lane := range lanes {
+			if lane <= 0 {
+				sc.report(false, "task %s: invalid lane %d", taskID, lane)
+				continue
+			}
+			if lane > maxLane {
+				maxLane = lane
+			}
+			if other, ok := laneChange[lane]; ok && other != chgID {
+				sc.report(false, "task %s: lane %d of change %s is also used by change %s", taskID, lane, chgID, other)
+				continue
+			}
+			laneChange[lane] = chgID
+		}
+	}
+
+	maxID := func(m map[string]rawObject) int {
+		max := 0
+		for id := range m {
+			if n, err := strconv.Atoi(id); err == nil && n > max {
+				max = n
+			}
+		}
+		return max
+	}
+	for _, counter := range []struct {
+		key string
+		max int
+	}{
+		{"last-change-id", maxID(sc.changes)},
+		{"last-task-id", maxID(sc.tasks)},
+		{"last-lane-id", maxLane},
+	} {
+		var last int
+		if err := sc.top.get(counter.key, &last); err != nil {
+			sc.report(true, "cannot decode %s: %v", counter.key, err)
+		}
+		if last < counter.max {
+			sc.report(true, "%s is %d but %d is in use", counter.key, last, counter.max)
+			sc.top.set(counter.key, counter.max)
+		}
+	}
+}
+
+type checkedSnapState struct {
+	Sequence []*snap.SideInfo `json:"sequence"`
+	Current  snap.Revision    `json:"current"`
+}
+
+// checkSnaps checks the sequences of the snaps against the snap files on
+// disk. It returns the names of the snaps in the state.
+func (sc *stateChecker) checkSnaps() map[string]bool {
+	var snaps map[string]*checkedSnapState
+	if err := sc.data.get("snaps", &snaps); err != nil {
+		sc.report(false, "cannot decode snaps: %v", err)
+		return nil
+	}
+	names := make([]string, 0, len(snaps))
+	for name := range snaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	installed := make(map[string]bool, len(snaps))
+	for _, name := range names {
+		snapst := snaps[name]
+		installed[name] = true
+		if snapst == nil || len(snapst.Sequence) == 0 {
+			continue
+		}
+		current := false
+		for _, si := range snapst.Sequence {
+			if si == nil {
+				sc.report(false, "snap %s: empty entry in its sequence", name)
+				continue
+			}
+			if si.Revision == snapst.Current {
+				current = true
+			}
+			mountFile := snap.MountFile(name, si.Revision)
+			if !osutil.FileExists(mountFile) {
+				sc.report(false, "snap %s: file %s of revision %s is missing", name, mountFile, si.Revision)
+			}
+		}
+		if !current {
+			sc.report(false, "snap %s: current revision %s is not in its sequence", name, snapst.Current)
+		}
+	}
+	return installed
+}
+
+// checkConnections checks that the connections refer to snaps in the
+// state.
+func (sc *stateChecker) checkConnections(installed map[string]bool) {
+	var conns map[string]*json.RawMessage
+	if err := sc.data.get("conns", &conns); err != nil {
+		sc.report(false, "cannot decode conns: %v", err)
+		return
+	}
+	ids := make([]string, 0, len(conns))
+	for id := range conns {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	changed := false
+	for _, id := range ids {
+		connRef, err := interfaces.ParseConnRef(id)
+		if err != nil {
+			sc.report(true, "connection %q: %v", id, err)
+			delete(conns, id)
+			changed = true
+			continue
+		}
+		for _, snapName := range []string{connRef.PlugRef.Snap, connRef.SlotRef.Snap} {
+			if !installed[snapName] {
+				sc.report(true, "connection %q: snap %s is not installed", id, snapName)
+				delete(conns, id)
+				changed = true
+				break
+			}
+		}
+	}
+	if changed {
+		sc.data.set("conns", conns)
+	}
+}
+
+func (sc *stateChecker) check() {
+	sc.checkTaskChanges()
+	sc.checkTaskLinks()
+	sc.checkCounters()
+	installed := sc.checkSnaps()
+	sc.checkConnections(installed)
+}
+
+func (sc *stateChecker) marshal() ([]byte, error) {
+	sc.top.set("data", sc.data)
+	sc.top.set("changes", sc.changes)
+	sc.top.set("tasks", sc.tasks)
+	return json.Marshal(sc.top)
+}
+
+func (c *cmdDebugState) checkState() error {
+	sc, err := readRawState(c.Positional.StateFilePath)
+	if err != nil {
+		return err
+	}
+	sc.check()
+
+	fixable := 0
+	for _, p := range sc.problems {
+		note := "cannot be repaired"
+		if p.fixable {
+			fixable++
+			note = "can be repaired"
+			if c.Repair {
+				note = "repaired"
+			}
+		}
+		fmt.Fprintf(Stdout, "%s (%s)\n", p.msg, note)
+	}
+
+	if c.Repair && fixable > 0 {
+		path := c.Positional.StateFilePath
+		if path == "" {
+			path = "state.json"
+		}
+		content, err := sc.marshal()
+		if err != nil {
+			return fmt.Errorf("cannot marshal the repaired state: %v", err)
+		}
+		repaired := path + ".repaired"
+		if err := osutil.AtomicWriteFile(repaired, content, 0600, 0); err != nil {
+			return fmt.Errorf("cannot write the repaired state: %v", err)
+		}
+		fmt.Fprintf(Stdout, "Repaired state written to %s\n", repaired)
+	}
+
+	switch {
+	case len(sc.problems) == 0:
+		fmt.Fprintf(Stdout, "No problems found\n")
+	case c.Repair && fixable == len(sc.problems):
+		// all good now
+	default:
+		return fmt.Errorf("found %d problem(s) in the state", len(sc.problems))
+	}
+	return nil
+}
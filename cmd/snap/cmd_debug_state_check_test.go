@@ -0,0 +1,162 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var brokenStateJSON = []byte(`
+{
+	"last-task-id": 2,
+	"last-change-id": 2,
+	"last-lane-id": 0,
+
+	"data": {
+		"snaps": {
+			"a": {"sequence": [{"name": "a", "revision": "1"}], "current": "1", "active": true},
+			"b": {"sequence": [{"name": "b", "revision": "2"}], "current": "3", "active": true}
+		},
+		"conns": {
+			"a:plug b:slot": {"interface": "foo"},
+			"a:plug gone:slot": {"interface": "foo"}
+		}
+	},
+	"changes": {
+		"1": {"id": "1", "kind": "install-snap", "summary": "...", "task-ids": ["1", "2", "9"]},
+		"2": {"id": "2", "kind": "remove-snap", "summary": "...", "task-ids": ["5"]}
+	},
+	"tasks": {
+		"1": {"id": "1", "change": "1", "kind": "foo", "summary": "...", "lanes": [1], "wait-tasks": ["2", "7"]},
+		"2": {"id": "2", "change": "1", "kind": "foo", "summary": "..."},
+		"3": {"id": "3", "change": "5", "kind": "foo", "summary": "...", "halt-tasks": ["1"]},
+		"4": {"id": "4", "change": "1", "kind": "foo", "summary": "..."},
+		"5": {"id": "5", "change": "2", "kind": "foo", "summary": "...", "lanes": [1]}
+	}
+}
+`)
+
+func (s *SnapSuite) writeBrokenState(c *C) string {
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+	c.Assert(os.MkdirAll(dirs.SnapBlobDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(snap.MountFile("a", snap.R(1)), nil, 0644), IsNil)
+
+	stateFile := filepath.Join(c.MkDir(), "state.json")
+	c.Assert(ioutil.WriteFile(stateFile, brokenStateJSON, 0644), IsNil)
+	return stateFile
+}
+
+const brokenStateReport = `task 3: change 5 does not exist (%[1]s)
+change 1: task 9 does not exist (%[1]s)
+task 4: not listed in its change 1 (%[1]s)
+task 1: wait-tasks has 2 but task 2 lacks the matching halt-tasks (%[1]s)
+task 1: wait-tasks refers to missing task 7 (%[1]s)
+task 5: lane 1 of change 2 is also used by change 1 (cannot be repaired)
+last-task-id is 2 but 5 is in use (%[1]s)
+last-lane-id is 0 but 1 is in use (%[1]s)
+snap b: file %[2]s/b_2.snap of revision 2 is missing (cannot be repaired)
+snap b: current revision 3 is not in its sequence (cannot be repaired)
+connection "a:plug gone:slot": snap gone is not installed (%[1]s)
+`
+
+func (s *SnapSuite) TestDebugStateCheck(c *C) {
+	stateFile := s.writeBrokenState(c)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--check", stateFile})
+	c.Check(err, ErrorMatches, `found 11 problem\(s\) in the state`)
+	c.Check(s.Stdout(), Equals, fmt.Sprintf(brokenStateReport, "can be repaired", dirs.SnapBlobDir))
+	c.Check(filepath.Join(filepath.Dir(stateFile), "state.json.repaired"), testutil.FileAbsent)
+}
+
+func (s *SnapSuite) TestDebugStateRepair(c *C) {
+	stateFile := s.writeBrokenState(c)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--repair", stateFile})
+	c.Check(err, ErrorMatches, `found 11 problem\(s\) in the state`)
+	repaired := stateFile + ".repaired"
+	c.Check(s.Stdout(), Equals, fmt.Sprintf(brokenStateReport, "repaired", dirs.SnapBlobDir)+
+		"Repaired state written to "+repaired+"\n")
+
+	// the original is untouched
+	c.Check(stateFile, testutil.FileEquals, string(brokenStateJSON))
+
+	// the repaired state can be loaded and is consistent
+	f, err := os.Open(repaired)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	st, err := state.ReadState(nil, f)
+	c.Assert(err, IsNil)
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change("1")
+	c.Assert(chg, NotNil)
+	var taskIDs []string
+	for _, t := range chg.Tasks() {
+		taskIDs = append(taskIDs, t.ID())
+	}
+	c.Check(taskIDs, DeepEquals, []string{"1", "2", "4"})
+	c.Check(st.Task("3"), IsNil)
+	c.Check(st.Task("2").HaltTasks(), DeepEquals, []*state.Task{st.Task("1")})
+	c.Check(st.Task("1").WaitTasks(), DeepEquals, []*state.Task{st.Task("2")})
+	var conns map[string]interface{}
+	c.Assert(st.Get("conns", &conns), IsNil)
+	c.Check(conns, DeepEquals, map[string]interface{}{
+		"a:plug b:slot": map[string]interface{}{"interface": "foo"},
+	})
+	c.Check(st.NewTask("foo", "...").ID(), Equals, "6")
+
+	// only the problems that cannot be repaired are left
+	s.ResetStdStreams()
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--check", repaired})
+	c.Check(err, ErrorMatches, `found 3 problem\(s\) in the state`)
+
+	var top map[string]interface{}
+	content, err := ioutil.ReadFile(repaired)
+	c.Assert(err, IsNil)
+	c.Assert(json.Unmarshal(content, &top), IsNil)
+	c.Check(top["last-lane-id"], Equals, 1.0)
+}
+
+func (s *SnapSuite) TestDebugStateCheckClean(c *C) {
+	dir := c.MkDir()
+	stateFile := filepath.Join(dir, "test-state.json")
+	c.Assert(ioutil.WriteFile(stateFile, graphStateJSON, 0644), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--repair", stateFile})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "No problems found\n")
+	c.Check(stateFile+".repaired", testutil.FileAbsent)
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--check", "--changes", stateFile})
+	c.Check(err, ErrorMatches, "cannot use --changes and --check together")
+}
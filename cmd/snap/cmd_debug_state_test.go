@@ -20,6 +20,7 @@
 package main_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"path/filepath"
 
@@ -230,3 +231,144 @@ func (s *SnapSuite) TestDebugIsSeededNo(c *C) {
 	c.Check(s.Stdout(), Matches, "false\n")
 	c.Check(s.Stderr(), Equals, "")
 }
+
+var graphStateJSON = []byte(`
+{
+	"last-task-id": 4,
+	"last-change-id": 1,
+	"last-lane-id": 1,
+
+	"data": {
+		"timings": [{
+			"tags": {"change-id": "1", "task-id": "2", "task-kind": "mount-snap", "task-status": "Doing"},
+			"timings": [
+				{"label": "check-snap", "summary": "check snap a", "duration": 3000000},
+				{"level": 1, "label": "verify", "summary": "verify signature", "duration": 1000000}
+			],
+			"start-time": "2020-10-02T10:00:01Z",
+			"stop-time": "2020-10-02T10:00:02Z"
+		}, {
+			"tags": {"change-id": "2", "task-id": "7"},
+			"timings": [{"label": "other", "duration": 1000000}],
+			"start-time": "2020-10-02T10:00:01Z",
+			"stop-time": "2020-10-02T10:00:02Z"
+		}]
+	},
+	"changes": {
+		"1": {
+			"id": "1",
+			"kind": "install-snap",
+			"summary": "install a snap",
+			"status": 0,
+			"spawn-time": "2020-10-02T10:00:00Z",
+			"task-ids": ["1","2","3","4"]
+		}
+	},
+	"tasks": {
+		"1": {"id": "1", "change": "1", "kind": "download-snap", "summary": "Download a", "status": 4,
+			"lanes": [1], "halt-tasks": ["2"],
+			"spawn-time": "2020-10-02T10:00:00Z", "ready-time": "2020-10-02T10:00:01Z", "doing-time": 1000000000},
+		"2": {"id": "2", "change": "1", "kind": "mount-snap", "summary": "Mount a", "status": 3,
+			"lanes": [1], "wait-tasks": ["1"], "halt-tasks": ["3"],
+			"spawn-time": "2020-10-02T10:00:00Z"},
+		"3": {"id": "3", "change": "1", "kind": "link-snap", "summary": "Link a", "status": 2,
+			"lanes": [1], "wait-tasks": ["2"],
+			"spawn-time": "2020-10-02T10:00:00Z"},
+		"4": {"id": "4", "change": "1", "kind": "hold-task", "summary": "Held", "status": 1,
+			"spawn-time": "2020-10-02T10:00:00.5Z"}
+	}
+}
+`)
+
+func (s *SnapSuite) TestDebugStateDot(c *C) {
+	dir := c.MkDir()
+	stateFile := filepath.Join(dir, "test-state.json")
+	c.Assert(ioutil.WriteFile(stateFile, graphStateJSON, 0644), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--dot", "--change=1", stateFile})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, `digraph D{
+  4 [label="4 hold-task\nHold", style=filled, fillcolor=lightgrey];
+  subgraph cluster_lane_1 {
+    label="lane 1";
+    1 [label="1 download-snap\nDone", style=filled, fillcolor=palegreen];
+    2 [label="2 mount-snap\nDoing", style=filled, fillcolor=yellow];
+    3 [label="3 link-snap\nDo"];
+  }
+  2 -> 1;
+  3 -> 2;
+}
+`)
+	s.ResetStdStreams()
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--dot", "--no-hold", "--change=1", stateFile})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Not(Matches), `(?s).*hold-task.*`)
+}
+
+func (s *SnapSuite) TestDebugStateJSONGraph(c *C) {
+	dir := c.MkDir()
+	stateFile := filepath.Join(dir, "test-state.json")
+	c.Assert(ioutil.WriteFile(stateFile, graphStateJSON, 0644), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--json-graph", "--no-hold", "--change=1", stateFile})
+	c.Assert(err, IsNil)
+
+	var graph map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(s.Stdout()), &graph), IsNil)
+	c.Check(graph, DeepEquals, map[string]interface{}{
+		"id":      "1",
+		"kind":    "install-snap",
+		"summary": "install a snap",
+		"status":  "Doing",
+		"tasks": []interface{}{
+			map[string]interface{}{
+				"id": "1", "kind": "download-snap", "summary": "Download a", "status": "Done",
+				"lanes": []interface{}{1.0}, "halt-tasks": []interface{}{"2"},
+				"spawn-time": "2020-10-02T10:00:00Z", "ready-time": "2020-10-02T10:00:01Z",
+			},
+			map[string]interface{}{
+				"id": "2", "kind": "mount-snap", "summary": "Mount a", "status": "Doing",
+				"lanes": []interface{}{1.0}, "wait-tasks": []interface{}{"1"}, "halt-tasks": []interface{}{"3"},
+				"spawn-time": "2020-10-02T10:00:00Z",
+			},
+			map[string]interface{}{
+				"id": "3", "kind": "link-snap", "summary": "Link a", "status": "Do",
+				"lanes": []interface{}{1.0}, "wait-tasks": []interface{}{"2"},
+				"spawn-time": "2020-10-02T10:00:00Z",
+			},
+		},
+	})
+}
+
+func (s *SnapSuite) TestDebugStateTimeline(c *C) {
+	dir := c.MkDir()
+	stateFile := filepath.Join(dir, "test-state.json")
+	c.Assert(ioutil.WriteFile(stateFile, graphStateJSON, 0644), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--timeline", "--change=1", stateFile})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, ""+
+		"ID   Status  Start  Ready   Doing   Undoing  Kind           Summary\n"+
+		"1    Done    0ms    1000ms  1000ms  0ms      download-snap  Download a\n"+
+		"2    Doing   0ms    -       0ms     0ms      mount-snap     Mount a\n"+
+		" ^                          3ms     -        check-snap     check snap a\n"+
+		"  ^                         1ms     -        verify           verify signature\n"+
+		"3    Do      0ms    -       0ms     0ms      link-snap      Link a\n"+
+		"4    Hold    500ms  -       0ms     0ms      hold-task      Held\n")
+}
+
+func (s *SnapSuite) TestDebugStateGraphOptionsErrors(c *C) {
+	dir := c.MkDir()
+	stateFile := filepath.Join(dir, "test-state.json")
+	c.Assert(ioutil.WriteFile(stateFile, graphStateJSON, 0644), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--timeline", stateFile})
+	c.Check(err, ErrorMatches, "--timeline can only be used with --change=")
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--dot", "--json-graph", "--change=1", stateFile})
+	c.Check(err, ErrorMatches, "cannot use --dot and --json-graph together")
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"debug", "state", "--json-graph", "--change=9", stateFile})
+	c.Check(err, ErrorMatches, "no such change: 9")
+}
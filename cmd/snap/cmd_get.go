@@ -23,7 +23,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 
@@ -48,6 +50,16 @@ Nested values may be retrieved via a dotted path:
 
     $ snap get snap-name author.name
     frank
+
+The configuration schema shipped by the snap, with the types, allowed
+values and defaults of the options, is printed with -d --schema:
+
+    $ snap get -d --schema snap-name author.name
+
+The configurations recorded every time the options of the snap changed are
+printed with --history, see 'snap set --revert-to' to go back to one of them:
+
+    $ snap get --history snap-name
 `)
 
 type cmdGet struct {
@@ -60,6 +72,8 @@ type cmdGet struct {
 	Typed    bool `short:"t"`
 	Document bool `short:"d"`
 	List     bool `short:"l"`
+	Schema   bool `long:"schema"`
+	History  bool `long:"history"`
 }
 
 func init() {
@@ -71,6 +85,10 @@ func init() {
 			"l": i18n.G("Always return list, even with single key"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"t": i18n.G("Strict typing with nulls and quoted strings"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"schema": i18n.G("Return the configuration schema instead of the values (requires -d)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"history": i18n.G("Return the recorded configuration history of the snap"),
 		}, []argDesc{
 			{
 				name: "<snap>",
@@ -177,6 +195,42 @@ func (x *cmdGet) outputList(conf map[string]interface{}) error {
 	return nil
 }
 
+// outputHistory prints the configuration history of the snap, as a
+// document with "-d" or as a table otherwise.
+func (x *cmdGet) outputHistory(snapName string) error {
+	history, err := x.client.ConfHistory(snapName)
+	if err != nil {
+		return err
+	}
+	if x.Document {
+		return x.outputJson(history)
+	}
+	if len(history) == 0 {
+		return fmt.Errorf("snap %q has no configuration history", snapName)
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "ID\tTime\tChange\tUser\tConfig\n")
+	for _, entry := range history {
+		changeID := entry.ChangeID
+		if changeID == "" {
+			changeID = "-"
+		}
+		user := "-"
+		if entry.UID != nil {
+			user = strconv.FormatUint(uint64(*entry.UID), 10)
+		}
+		cfg, err := json.Marshal(entry.Config)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", entry.ID, entry.Time.Format(time.RFC3339), changeID, user, cfg)
+	}
+	return nil
+}
+
 // outputDefault will be used when no commandline switch to override the
 // output where used. The output follows the following rules:
 // - a single key with a string value is printed directly
@@ -239,9 +293,33 @@ func (x *cmdGet) Execute(args []string) error {
 		return fmt.Errorf("cannot use -d and -l together")
 	}
 
+	if x.Schema && !x.Document {
+		return fmt.Errorf("cannot use --schema without -d")
+	}
+
+	if x.History && (x.Schema || x.Typed || x.List) {
+		return fmt.Errorf("cannot use --history with --schema, -t or -l")
+	}
+
+	if x.History && len(x.Positional.Keys) > 0 {
+		return fmt.Errorf("cannot use --history with keys")
+	}
+
 	snapName := string(x.Positional.Snap)
 	confKeys := x.Positional.Keys
 
+	if x.History {
+		return x.outputHistory(snapName)
+	}
+
+	if x.Schema {
+		schema, err := x.client.ConfSchema(snapName, confKeys)
+		if err != nil {
+			return err
+		}
+		return x.outputJson(schema)
+	}
+
 	conf, err := x.client.Conf(snapName, confKeys)
 	if err != nil {
 		return err
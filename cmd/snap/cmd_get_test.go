@@ -144,6 +144,62 @@ func (s *SnapSuite) TestSnapGetNoConfiguration(c *C) {
 	s.runTests(getNoConfigTests, c)
 }
 
+var getSchemaTests = []getCmdArgs{{
+	args:  "get --schema snapname",
+	error: "cannot use --schema without -d",
+}, {
+	args:   "get -d --schema snapname test-key1",
+	stdout: "{\n\t\"test-key1\": {\n\t\t\"enum\": [\n\t\t\t\"a\",\n\t\t\t\"b\"\n\t\t],\n\t\t\"type\": \"string\"\n\t}\n}\n",
+}}
+
+func (s *SnapSuite) TestSnapGetSchema(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/snaps/snapname/conf")
+		c.Check(r.URL.Query().Get("schema"), Equals, "true")
+		c.Check(r.URL.Query().Get("keys"), Equals, "test-key1")
+		fmt.Fprintln(w, `{"type":"sync", "status-code": 200, "result": {"test-key1":{"type":"string","enum":["a","b"]}}}`)
+	})
+	s.runTests(getSchemaTests, c)
+}
+
+var getHistoryTests = []getCmdArgs{{
+	args:  "get --history snapname test-key1",
+	error: "cannot use --history with keys",
+}, {
+	args:  "get --history -l snapname",
+	error: "cannot use --history with --schema, -t or -l",
+}, {
+	args: "get --history snapname",
+	stdout: "ID   Time                  Change  User  Config\n" +
+		"1    2020-06-01T10:00:00Z  -       -     {\"test-key1\":\"a\"}\n" +
+		"2    2020-06-01T11:00:00Z  42      1000  {\"test-key1\":\"b\",\"test-key2\":2}\n",
+}, {
+	args:   "get -d --history snapname",
+	stdout: "[\n\t{\n\t\t\"id\": 1,\n\t\t\"time\": \"2020-06-01T10:00:00Z\",\n\t\t\"config\": {\n\t\t\t\"test-key1\": \"a\"\n\t\t}\n\t},\n\t{\n\t\t\"id\": 2,\n\t\t\"time\": \"2020-06-01T11:00:00Z\",\n\t\t\"change-id\": \"42\",\n\t\t\"uid\": 1000,\n\t\t\"config\": {\n\t\t\t\"test-key1\": \"b\",\n\t\t\t\"test-key2\": 2\n\t\t}\n\t}\n]\n",
+}}
+
+func (s *SnapSuite) TestSnapGetHistory(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/snaps/snapname/conf")
+		c.Check(r.URL.Query().Get("history"), Equals, "true")
+		fmt.Fprintln(w, `{"type":"sync", "status-code": 200, "result": [
+			{"id": 1, "time": "2020-06-01T10:00:00Z", "config": {"test-key1": "a"}},
+			{"id": 2, "time": "2020-06-01T11:00:00Z", "change-id": "42", "uid": 1000, "config": {"test-key1": "b", "test-key2": 2}}
+		]}`)
+	})
+	s.runTests(getHistoryTests, c)
+}
+
+func (s *SnapSuite) TestSnapGetHistoryEmpty(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type":"sync", "status-code": 200, "result": []}`)
+	})
+	_, err := snapset.Parser(snapset.Client()).ParseArgs([]string{"get", "--history", "snapname"})
+	c.Check(err, ErrorMatches, `snap "snapname" has no configuration history`)
+}
+
 func (s *SnapSuite) TestSortByPath(c *C) {
 	values := []snapset.ConfigValue{
 		{Path: "test-key3.b"},
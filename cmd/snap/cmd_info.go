@@ -48,6 +48,7 @@ type infoCmd struct {
 	clientMixin
 	colorMixin
 	timeMixin
+	formatMixin
 
 	Verbose    bool `long:"verbose"`
 	Positional struct {
@@ -71,7 +72,7 @@ func init() {
 		longInfoHelp,
 		func() flags.Commander {
 			return &infoCmd{}
-		}, colorDescs.also(timeDescs).also(map[string]string{
+		}, colorDescs.also(timeDescs).also(formatDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"verbose": i18n.G("Include more details on the snap (expanded notes, base, etc.)"),
 		}), nil)
@@ -521,7 +522,11 @@ func (iw *infoWriter) maybePrintServices() {
 		} else {
 			enabled = "disabled"
 		}
-		services = append(services, fmt.Sprintf("  %s:\t%s, %s, %s", snap.JoinSnapApp(iw.theSnap.Name, app.Name), app.Daemon, enabled, active))
+		svc := fmt.Sprintf("  %s:\t%s, %s, %s", snap.JoinSnapApp(iw.theSnap.Name, app.Name), app.Daemon, enabled, active)
+		if app.Health != nil {
+			svc += fmt.Sprintf(", health: %s", app.Health.Status)
+		}
+		services = append(services, svc)
 	}
 	if len(services) == 0 {
 		return
@@ -676,7 +681,55 @@ func (chInfos *channelInfos) dump(w io.Writer) {
 	}
 }
 
+// snapInfo is what is printed about each snap when a machine-readable
+// output format is asked for.
+type snapInfo struct {
+	Name string `json:"name"`
+	// Path and File are set when the snap was given as a snap file or
+	// a directory.
+	Path string       `json:"path,omitempty"`
+	File *client.Snap `json:"file,omitempty"`
+	// Installed and Store are set when the snap was given by name and
+	// is installed or found in the store respectively.
+	Installed *client.Snap `json:"installed,omitempty"`
+	Store     *client.Snap `json:"store,omitempty"`
+}
+
+func (x *infoCmd) printStructuredInfo() error {
+	infos := make([]snapInfo, 0, len(x.Positional.Snaps))
+	for _, snapName := range x.Positional.Snaps {
+		snapName := string(snapName)
+		info := snapInfo{Name: snapName}
+		if diskSnap, err := clientSnapFromPath(snapName); err == nil {
+			info.Name = diskSnap.Name
+			info.Path = norm(snapName)
+			info.File = diskSnap
+		} else {
+			info.Store, _, _ = x.client.FindOne(snap.InstanceSnap(snapName))
+			info.Installed, _, _ = x.client.Snap(snapName)
+		}
+
+		if info.File == nil && info.Installed == nil && info.Store == nil {
+			if len(x.Positional.Snaps) == 1 {
+				return fmt.Errorf("no snap found for %q", snapName)
+			}
+			fmt.Fprintf(Stderr, i18n.G("warning: no snap found for %q\n"), snapName)
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	if len(infos) == 0 {
+		return fmt.Errorf(i18n.G("no valid snaps given"))
+	}
+	return x.printStructured(infos)
+}
+
 func (x *infoCmd) Execute([]string) error {
+	if x.structured() {
+		return x.printStructuredInfo()
+	}
+
 	termWidth, _ := termSize()
 	termWidth -= 3
 	if termWidth > 100 {
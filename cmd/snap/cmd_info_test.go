@@ -21,6 +21,7 @@ package main_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -79,6 +80,20 @@ func (s *infoSuite) TestMaybePrintServices(c *check.C) {
 	}
 }
 
+func (s *infoSuite) TestMaybePrintServicesHealth(c *check.C) {
+	var buf flushBuffer
+	iw := snap.NewInfoWriter(&buf)
+	infos := append([]client.AppInfo(nil), svcAppInfos...)
+	infos[0].Health = &client.SnapHealth{Status: "error", Code: "snapd-probe-failed"}
+	snap.SetupDiskSnap(iw, "", &client.Snap{Name: "foo", Apps: infos})
+	snap.MaybePrintServices(iw)
+
+	c.Check(buf.String(), check.Equals, `services:
+  foo.svc1:	simple, disabled, active, health: error
+  foo.svc2:	simple, enabled, inactive
+`)
+}
+
 func (s *infoSuite) TestMaybePrintServicesNoServices(c *check.C) {
 	var buf flushBuffer
 	iw := snap.NewInfoWriter(&buf)
@@ -728,6 +743,71 @@ func (s *infoSuite) TestInfoNotFound(c *check.C) {
 	c.Check(s.Stderr(), check.Equals, "")
 }
 
+func (s *infoSuite) TestInfoFormatJSON(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/find")
+			fmt.Fprintln(w, mockInfoJSON)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps/hello")
+			fmt.Fprintln(w, mockInfoJSONOtherLicense)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d (%v)", n+1, r)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"info", "--format=json", "hello"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stderr(), check.Equals, "")
+
+	var infos []struct {
+		Name      string       `json:"name"`
+		Path      string       `json:"path"`
+		File      *client.Snap `json:"file"`
+		Installed *client.Snap `json:"installed"`
+		Store     *client.Snap `json:"store"`
+	}
+	c.Assert(json.Unmarshal([]byte(s.Stdout()), &infos), check.IsNil)
+	c.Assert(infos, check.HasLen, 1)
+	c.Check(infos[0].Name, check.Equals, "hello")
+	c.Check(infos[0].Path, check.Equals, "")
+	c.Check(infos[0].File, check.IsNil)
+	c.Assert(infos[0].Installed, check.NotNil)
+	c.Check(infos[0].Installed.License, check.Equals, "BSD-3")
+	c.Check(infos[0].Installed.TrackingChannel, check.Equals, "beta")
+	c.Assert(infos[0].Store, check.NotNil)
+	c.Check(infos[0].Store.License, check.Equals, "MIT")
+	c.Check(infos[0].Store.Version, check.Equals, "2.10")
+}
+
+func (s *infoSuite) TestInfoFormatYAMLSomeNotFound(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/find" && r.URL.Query().Get("name") == "hello":
+			fmt.Fprintln(w, mockInfoJSON)
+		default:
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"type":"error","status-code":404,"status":"Not Found","result":{"message":"No.","kind":"snap-not-found","value":"x"}}`)
+		}
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"info", "--format=yaml", "hello", "x"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stderr(), check.Equals, "warning: no snap found for \"x\"\n")
+	c.Check(s.Stdout(), check.Matches, `(?ms)^- name: hello\n  store:\n.*^    license: MIT$.*`)
+	c.Check(s.Stdout(), check.Not(check.Matches), `(?ms).*installed:.*`)
+
+	s.ResetStdStreams()
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"info", "--format=yaml", "x"})
+	c.Assert(err, check.ErrorMatches, `no snap found for "x"`)
+	c.Check(s.Stdout(), check.Equals, "")
+}
+
 func (s *infoSuite) TestInfoWithLocalNoLicense(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -20,10 +20,12 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
 
 	snap "github.com/snapcore/snapd/cmd/snap"
 )
@@ -43,6 +45,8 @@ indicates that the publisher has been verified.
                                       some things. (default: auto)
       --unicode=[auto|never|always]   Use a little bit of Unicode to improve
                                       legibility. (default: auto)
+      --format=[text|json|yaml]       Print in the given format, json and yaml
+                                      being machine-readable (default: text)
 `
 	s.testSubCommandHelp(c, "list", msg)
 }
@@ -127,6 +131,66 @@ func (s *SnapSuite) TestListEmpty(c *check.C) {
 	c.Check(s.Stderr(), check.Equals, "No snaps are installed yet. Try 'snap install hello-world'.\n")
 }
 
+func (s *SnapSuite) TestListFormatJSON(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+{"name": "foo", "status": "active", "version": "4.2", "publisher": {"id": "bar-id", "username": "bar", "display-name": "Bar", "validation": "unproven"}, "revision": 17, "tracking-channel": "potatoes"},
+{"name": "bar", "status": "active", "version": "1.0", "revision": 3, "installed-size": 123456789}
+]}`)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"list", "--format=json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stderr(), check.Equals, "")
+
+	var snaps []map[string]interface{}
+	c.Assert(json.Unmarshal(s.stdout.Bytes(), &snaps), check.IsNil)
+	c.Assert(snaps, check.HasLen, 2)
+	// sorted by name, as in the text output
+	c.Check(snaps[0]["name"], check.Equals, "bar")
+	c.Check(snaps[0]["installed-size"], check.Equals, 123456789.)
+	c.Check(snaps[1]["name"], check.Equals, "foo")
+	c.Check(snaps[1]["version"], check.Equals, "4.2")
+	c.Check(snaps[1]["revision"], check.Equals, "17")
+	c.Check(snaps[1]["tracking-channel"], check.Equals, "potatoes")
+	c.Check(snaps[1]["publisher"].(map[string]interface{})["username"], check.Equals, "bar")
+}
+
+func (s *SnapSuite) TestListFormatYAML(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		fmt.Fprintln(w, `{"type": "sync", "result": [{"name": "foo", "status": "active", "version": "4.2", "revision": 17, "installed-size": 123456789, "tracking-channel": "potatoes"}]}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"list", "--format=yaml"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Matches, `(?ms)- .*^  installed-size: 123456789$.*`)
+
+	var snaps []map[string]interface{}
+	c.Assert(yaml.Unmarshal(s.stdout.Bytes(), &snaps), check.IsNil)
+	c.Assert(snaps, check.HasLen, 1)
+	c.Check(snaps[0]["name"], check.Equals, "foo")
+	c.Check(snaps[0]["version"], check.Equals, "4.2")
+	c.Check(snaps[0]["revision"], check.Equals, "17")
+	c.Check(snaps[0]["installed-size"], check.Equals, 123456789)
+	c.Check(snaps[0]["tracking-channel"], check.Equals, "potatoes")
+}
+
+func (s *SnapSuite) TestListFormatEmpty(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"list", "--format=json"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "[]\n")
+	c.Check(s.Stderr(), check.Equals, "")
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"list", "--format=json", "quux"})
+	c.Assert(err, check.ErrorMatches, "no matching snaps installed")
+}
+
 func (s *SnapSuite) TestListEmptyWithQuery(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	. "gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestRebootHappy(c *C) {
+	for _, tc := range []struct {
+		cmdline      []string
+		expectedPath string
+		expectedMode string
+		expectedMsg  string
+	}{
+		{
+			cmdline:      []string{"reboot"},
+			expectedPath: "/v2/systems",
+			expectedMode: "",
+			expectedMsg:  "Reboot\n",
+		},
+		{
+			cmdline:      []string{"reboot", "--recover"},
+			expectedPath: "/v2/systems",
+			expectedMode: "recover",
+			expectedMsg:  `Reboot into "recover" mode.` + "\n",
+		},
+		{
+			cmdline:      []string{"reboot", "20200101"},
+			expectedPath: "/v2/systems/20200101",
+			expectedMode: "",
+			expectedMsg:  `Reboot into "20200101".` + "\n",
+		},
+		{
+			cmdline:      []string{"reboot", "--install", "20200101"},
+			expectedPath: "/v2/systems/20200101",
+			expectedMode: "install",
+			expectedMsg:  `Reboot into "20200101" "install" mode.` + "\n",
+		},
+		{
+			cmdline:      []string{"reboot", "--factory-reset", "20200101"},
+			expectedPath: "/v2/systems/20200101",
+			expectedMode: "factory-reset",
+			expectedMsg:  `Reboot into "20200101" "factory-reset" mode.` + "\n",
+		},
+	} {
+		s.ResetStdStreams()
+
+		n := 0
+		s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+			switch n {
+			case 0:
+				c.Check(r.Method, Equals, "POST")
+				c.Check(r.URL.Path, Equals, tc.expectedPath)
+				c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+					"action": "reboot",
+					"mode":   tc.expectedMode,
+				})
+				fmt.Fprintln(w, `{"type": "sync", "result": {}}`)
+			default:
+				c.Fatalf("expected to get 1 request, now on %d", n+1)
+			}
+			n++
+		})
+
+		rest, err := snap.Parser(snap.Client()).ParseArgs(tc.cmdline)
+		c.Assert(err, IsNil)
+		c.Assert(rest, DeepEquals, []string{})
+		c.Check(s.Stdout(), Equals, tc.expectedMsg)
+		c.Check(s.Stderr(), Equals, "")
+	}
+}
+
+func (s *SnapSuite) TestRebootUnhappy(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"reboot", "--run", "--factory-reset"})
+	c.Assert(err, ErrorMatches, "Please specify a single mode")
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"reboot", "20200101", "extra-arg"})
+	c.Assert(err, ErrorMatches, "too many arguments for command")
+}
+
+func (s *SnapSuite) TestRebootAPIFail(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		fmt.Fprintln(w, `{"type": "error", "status-code": 500, "result": {"message": "boom"}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"reboot", "--factory-reset", "20200101"})
+	c.Assert(err, ErrorMatches, "cannot request system action: boom")
+	c.Check(s.Stdout(), Equals, "")
+}
@@ -32,18 +32,30 @@ import (
 type cmdRecovery struct {
 	clientMixin
 	colorMixin
+
+	ShowKeys bool `long:"show-keys"`
+	Rotate   bool `long:"rotate"`
 }
 
 var shortRecoveryHelp = i18n.G("List available recovery systems")
 var longRecoveryHelp = i18n.G(`
 The recovery command lists the available recovery systems.
+
+With --show-keys it displays the recovery key that unlocks the encrypted
+partitions of the device, with --rotate it replaces that key with a new one
+and displays it.
 `)
 
 func init() {
 	addCommand("recovery", shortRecoveryHelp, longRecoveryHelp, func() flags.Commander {
 		// XXX: if we want more/nicer details we can add `snap recovery <system>` later
 		return &cmdRecovery{}
-	}, nil, nil)
+	}, colorDescs.also(map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"show-keys": i18n.G("Show recovery keys (if available) to unlock encrypted partitions"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"rotate": i18n.G("Replace the recovery keys with new ones and show them"),
+	}), nil)
 }
 
 func notesForSystem(sys *client.System) string {
@@ -53,11 +65,37 @@ func notesForSystem(sys *client.System) string {
 	return "-"
 }
 
+func (x *cmdRecovery) showKeys(rsp *client.SystemRecoveryKeysResponse) {
+	w := tabWriter()
+	defer w.Flush()
+	fmt.Fprintf(w, "recovery:\t%s\n", rsp.RecoveryKey)
+}
+
 func (x *cmdRecovery) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
 
+	if x.ShowKeys && x.Rotate {
+		return fmt.Errorf(i18n.G("cannot use --show-keys and --rotate together"))
+	}
+	if x.ShowKeys {
+		rsp, err := x.client.SystemRecoveryKeys()
+		if err != nil {
+			return err
+		}
+		x.showKeys(rsp)
+		return nil
+	}
+	if x.Rotate {
+		rsp, err := x.client.RotateSystemRecoveryKeys()
+		if err != nil {
+			return err
+		}
+		x.showKeys(rsp)
+		return nil
+	}
+
 	systems, err := x.client.ListSystems()
 	if err != nil {
 		return err
@@ -34,9 +34,19 @@ func (s *SnapSuite) TestRecoveryHelp(c *C) {
 
 The recovery command lists the available recovery systems.
 
+With --show-keys it displays the recovery key that unlocks the encrypted
+partitions of the device, with --rotate it replaces that key with a new one
+and displays it.
+
 [recovery command options]
-      --color=[auto|never|always]
-      --unicode=[auto|never|always]
+      --color=[auto|never|always]     Use a little bit of color to highlight
+                                      some things. (default: auto)
+      --unicode=[auto|never|always]   Use a little bit of Unicode to improve
+                                      legibility. (default: auto)
+      --show-keys                     Show recovery keys (if available) to
+                                      unlock encrypted partitions
+      --rotate                        Replace the recovery keys with new ones
+                                      and show them
 `
 	s.testSubCommandHelp(c, "recovery", msg)
 }
@@ -145,3 +155,57 @@ func (s *SnapSuite) TestNoRecoverySystemsError(c *C) {
 	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery"})
 	c.Check(err, ErrorMatches, `cannot list recovery systems: permission denied`)
 }
+
+func (s *SnapSuite) TestRecoveryShowKeys(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, Equals, "GET")
+			c.Check(r.URL.Path, Equals, "/v2/system-recovery-keys")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"recovery-key": "61665-00531-54469-09783-47273-19035-40077-28287"}}`)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+		n++
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--show-keys"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, "recovery:  61665-00531-54469-09783-47273-19035-40077-28287\n")
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestRecoveryRotate(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, Equals, "POST")
+			c.Check(r.URL.Path, Equals, "/v2/system-recovery-keys")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action": "rotate",
+			})
+			fmt.Fprintln(w, `{"type": "sync", "result": {"recovery-key": "61665-00531-54469-09783-47273-19035-40077-28287"}}`)
+		default:
+			c.Fatalf("expected to get 1 requests, now on %d", n+1)
+		}
+		n++
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--rotate"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, "recovery:  61665-00531-54469-09783-47273-19035-40077-28287\n")
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestRecoveryShowKeysError(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "error", "result": {"message": "no recovery key: system is not encrypted"}, "status-code": 404}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--show-keys"})
+	c.Check(err, ErrorMatches, `cannot get recovery keys: no recovery key: system is not encrypted`)
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--show-keys", "--rotate"})
+	c.Check(err, ErrorMatches, `cannot use --show-keys and --rotate together`)
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
 )
 
@@ -41,6 +42,7 @@ snaps, new kernel or gadget etc.
 
 type cmdRemodel struct {
 	waitMixin
+	scheduleMixin
 	RemodelOptions struct {
 		NewModelFile flags.Filename
 	} `positional-args:"true" required:"true"`
@@ -52,7 +54,7 @@ func init() {
 		longRemodelHelp,
 		func() flags.Commander {
 			return &cmdRemodel{}
-		}, nil, []argDesc{{
+		}, waitDescs.also(scheduleDescs), []argDesc{{
 			// TRANSLATORS: This needs to begin with < and end with >
 			name: i18n.G("<new model file>"),
 			// TRANSLATORS: This should not start with a lowercase letter.
@@ -70,7 +72,15 @@ func (x *cmdRemodel) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
-	changeID, err := x.client.Remodel(modelData)
+	notBefore, err := x.notBefore()
+	if err != nil {
+		return err
+	}
+	var opts *client.RemodelOptions
+	if x.asksForSchedule() {
+		opts = &client.RemodelOptions{NotBefore: notBefore, Window: x.Window}
+	}
+	changeID, err := x.client.RemodelWithOptions(modelData, opts)
 	if err != nil {
 		return fmt.Errorf("cannot remodel: %v", err)
 	}
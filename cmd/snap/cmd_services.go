@@ -32,6 +32,7 @@ import (
 
 type svcStatus struct {
 	clientMixin
+	formatMixin
 	Positional struct {
 		ServiceNames []serviceName
 	} `positional-args:"yes"`
@@ -81,7 +82,7 @@ func init() {
 		// TRANSLATORS: This should not start with a lowercase letter.
 		desc: i18n.G("A service specification, which can be just a snap name (for all services in the snap), or <snap>.<app> for a single service."),
 	}}
-	addCommand("services", shortServicesHelp, longServicesHelp, func() flags.Commander { return &svcStatus{} }, nil, argdescs)
+	addCommand("services", shortServicesHelp, longServicesHelp, func() flags.Commander { return &svcStatus{} }, formatDescs, argdescs)
 	addCommand("logs", shortLogsHelp, longLogsHelp, func() flags.Commander { return &svcLogs{} },
 		map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
@@ -125,6 +126,13 @@ func (s *svcStatus) Execute(args []string) error {
 		return err
 	}
 
+	if s.structured() {
+		if services == nil {
+			services = []*client.AppInfo{}
+		}
+		return s.printStructured(services)
+	}
+
 	if len(services) == 0 {
 		fmt.Fprintln(Stderr, i18n.G("There are no services provided by installed snaps."))
 		return nil
@@ -133,7 +141,20 @@ func (s *svcStatus) Execute(args []string) error {
 	w := tabWriter()
 	defer w.Flush()
 
-	fmt.Fprintln(w, i18n.G("Service\tStartup\tCurrent\tNotes"))
+	// the health column is only shown if some service has a health probe
+	showHealth := false
+	for _, svc := range services {
+		if svc.Health != nil {
+			showHealth = true
+			break
+		}
+	}
+
+	if showHealth {
+		fmt.Fprintln(w, i18n.G("Service\tStartup\tCurrent\tHealth\tNotes"))
+	} else {
+		fmt.Fprintln(w, i18n.G("Service\tStartup\tCurrent\tNotes"))
+	}
 
 	for _, svc := range services {
 		startup := i18n.G("disabled")
@@ -144,7 +165,15 @@ func (s *svcStatus) Execute(args []string) error {
 		if svc.Active {
 			current = i18n.G("active")
 		}
-		fmt.Fprintf(w, "%s.%s\t%s\t%s\t%s\n", svc.Snap, svc.Name, startup, current, clientutil.ClientAppInfoNotes(svc))
+		if showHealth {
+			health := "-"
+			if svc.Health != nil {
+				health = svc.Health.Status
+			}
+			fmt.Fprintf(w, "%s.%s\t%s\t%s\t%s\t%s\n", svc.Snap, svc.Name, startup, current, health, clientutil.ClientAppInfoNotes(svc))
+		} else {
+			fmt.Fprintf(w, "%s.%s\t%s\t%s\t%s\n", svc.Snap, svc.Name, startup, current, clientutil.ClientAppInfoNotes(svc))
+		}
 	}
 
 	return nil
@@ -219,6 +219,69 @@ foo.zed  enabled  active    -
 	c.Check(n, check.Equals, 1)
 }
 
+func (s *appOpSuite) TestAppStatusHealth(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/apps")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+{"snap": "foo", "name": "bar", "daemon": "simple", "active": true, "enabled": true, "health": {"revision": "1", "timestamp": "2020-06-01T12:00:00Z", "status": "okay"}},
+{"snap": "foo", "name": "baz", "daemon": "simple", "active": true, "enabled": true, "health": {"revision": "1", "timestamp": "2020-06-01T12:00:00Z", "status": "error", "code": "snapd-probe-failed", "message": "tcp health probe failed: connection refused"}},
+{"snap": "foo", "name": "zed", "daemon": "simple", "active": true, "enabled": true}
+]}`)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"services"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `Service  Startup  Current  Health  Notes
+foo.bar  enabled  active   okay    -
+foo.baz  enabled  active   error   -
+foo.zed  enabled  active   -       -
+`)
+}
+
+func (s *appOpSuite) TestAppStatusFormatYAML(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/apps")
+		c.Check(r.URL.Query().Get("select"), check.Equals, "service")
+		c.Check(r.URL.Query().Get("names"), check.Equals, "foo")
+		c.Check(r.Method, check.Equals, "GET")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+{"snap": "foo", "name": "bar", "daemon": "oneshot", "active": false, "enabled": true, "activators": [{"name": "bar", "type": "timer", "active": true, "enabled": true}]},
+{"snap": "foo", "name": "zed", "daemon": "simple", "active": true, "enabled": true}
+]}`)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"services", "--format=yaml", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+- activators:
+  - Active: true
+    Enabled: true
+    Name: bar
+    Type: timer
+  daemon: oneshot
+  enabled: true
+  name: bar
+  snap: foo
+- active: true
+  daemon: simple
+  enabled: true
+  name: zed
+  snap: foo
+`[1:])
+}
+
+func (s *appOpSuite) TestAppStatusFormatJSONNoServices(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"services", "--format=json"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "[]\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *appOpSuite) TestServiceCompletion(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -44,18 +44,26 @@ Nested values may be modified via a dotted path:
 
 Configuration option may be unset with exclamation mark:
     $ snap set snap-name author!
+
+A configuration recorded in the history shown by 'snap get --history' may be
+reapplied as a whole with --revert-to:
+    $ snap set --revert-to=3 snap-name
 `)
 
 type cmdSet struct {
 	waitMixin
+	RevertTo   int `long:"revert-to"`
 	Positional struct {
-		Snap       installedSnapName
-		ConfValues []string `required:"1"`
-	} `positional-args:"yes" required:"yes"`
+		Snap       installedSnapName `required:"yes"`
+		ConfValues []string
+	} `positional-args:"yes"`
 }
 
 func init() {
-	addCommand("set", shortSetHelp, longSetHelp, func() flags.Commander { return &cmdSet{} }, waitDescs, []argDesc{
+	addCommand("set", shortSetHelp, longSetHelp, func() flags.Commander { return &cmdSet{} }, waitDescs.also(map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"revert-to": i18n.G("Reapply the configuration with the given id from the configuration history"),
+	}), []argDesc{
 		{
 			name: "<snap>",
 			// TRANSLATORS: This should not start with a lowercase letter.
@@ -70,6 +78,16 @@ func init() {
 }
 
 func (x *cmdSet) Execute(args []string) error {
+	if x.RevertTo != 0 {
+		if len(x.Positional.ConfValues) > 0 {
+			return fmt.Errorf(i18n.G("cannot use --revert-to with configuration values"))
+		}
+		return x.revert()
+	}
+	if len(x.Positional.ConfValues) == 0 {
+		return fmt.Errorf(i18n.G("the required argument `<conf value>` was not provided"))
+	}
+
 	patchValues := make(map[string]interface{})
 	for _, patchValue := range x.Positional.ConfValues {
 		parts := strings.SplitN(patchValue, "=", 2)
@@ -95,6 +113,22 @@ func (x *cmdSet) Execute(args []string) error {
 		return err
 	}
 
+	return x.waitConf(id)
+}
+
+func (x *cmdSet) revert() error {
+	if x.RevertTo < 0 {
+		return fmt.Errorf(i18n.G("invalid configuration history id: %d"), x.RevertTo)
+	}
+	id, err := x.client.RevertConf(string(x.Positional.Snap), x.RevertTo)
+	if err != nil {
+		return err
+	}
+
+	return x.waitConf(id)
+}
+
+func (x *cmdSet) waitConf(id string) error {
 	if _, err := x.wait(id); err != nil {
 		if err == noWait {
 			return nil
@@ -92,6 +92,10 @@ have developer access to the snap, either directly or through the
 store's collaboration feature, and to be logged in (see 'snap help login').
 
 Note a later refresh will typically undo a revision override.
+
+When refreshing several snaps, by default a failure to refresh one of them
+only undoes the refresh of that snap. With --transaction=all-snaps a failure
+to refresh any of them undoes the refresh of all of them.
 `)
 
 var longTryHelp = i18n.G(`
@@ -117,6 +121,7 @@ and the snap can easily be enabled again.
 
 type cmdRemove struct {
 	waitMixin
+	scheduleMixin
 
 	Revision   string `long:"revision"`
 	Purge      bool   `long:"purge"`
@@ -192,6 +197,9 @@ func (x *cmdRemove) removeMany(opts *client.SnapOptions) error {
 
 func (x *cmdRemove) Execute([]string) error {
 	opts := &client.SnapOptions{Revision: x.Revision, Purge: x.Purge}
+	if err := x.setSchedule(opts); err != nil {
+		return err
+	}
 	if len(x.Positional.Snaps) == 1 {
 		return x.removeOne(opts)
 	}
@@ -199,7 +207,11 @@ func (x *cmdRemove) Execute([]string) error {
 	if x.Purge || x.Revision != "" {
 		return errors.New(i18n.G("a single snap name is needed to specify options"))
 	}
-	return x.removeMany(nil)
+	var manyOpts *client.SnapOptions
+	if x.asksForSchedule() {
+		manyOpts = &client.SnapOptions{NotBefore: opts.NotBefore, Window: opts.Window}
+	}
+	return x.removeMany(manyOpts)
 }
 
 type channelMixin struct {
@@ -457,9 +469,52 @@ func (mx modeMixin) setModes(opts *client.SnapOptions) {
 	opts.Classic = mx.Classic
 }
 
+type scheduleMixin struct {
+	NotBefore string `long:"not-before" value-name:"<time>"`
+	Window    string `long:"window" value-name:"<schedule>"`
+}
+
+var scheduleDescs = mixinDescs{
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"not-before": i18n.G("Do not start the change before the given time, either a RFC3339 timestamp or a duration from now (e.g. 2h)"),
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"window": i18n.G("Only start the change within the given maintenance window, in the same format as refresh.timer (e.g. sat,02:00-04:00)"),
+}
+
+func (mx scheduleMixin) asksForSchedule() bool {
+	return mx.NotBefore != "" || mx.Window != ""
+}
+
+// notBefore parses the --not-before option, either a RFC3339 timestamp
+// or a duration from now.
+func (mx scheduleMixin) notBefore() (*time.Time, error) {
+	if mx.NotBefore == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, mx.NotBefore); err == nil {
+		return &t, nil
+	}
+	if d, err := time.ParseDuration(mx.NotBefore); err == nil && d >= 0 {
+		t := timeNow().Add(d)
+		return &t, nil
+	}
+	return nil, fmt.Errorf(i18n.G("cannot parse --not-before %q: expected a RFC3339 timestamp or a duration"), mx.NotBefore)
+}
+
+func (mx scheduleMixin) setSchedule(opts *client.SnapOptions) error {
+	notBefore, err := mx.notBefore()
+	if err != nil {
+		return err
+	}
+	opts.NotBefore = notBefore
+	opts.Window = mx.Window
+	return nil
+}
+
 type cmdInstall struct {
 	colorMixin
 	waitMixin
+	scheduleMixin
 
 	channelMixin
 	modeMixin
@@ -487,6 +542,9 @@ func (x *cmdInstall) installOne(nameOrPath, desiredName string, opts *client.Sna
 	var path string
 
 	if strings.Contains(nameOrPath, "/") || strings.HasSuffix(nameOrPath, ".snap") || strings.Contains(nameOrPath, ".snap.") {
+		if x.asksForSchedule() {
+			return errors.New(i18n.G("cannot schedule the installation of a snap file"))
+		}
 		path = nameOrPath
 		changeID, err = x.client.InstallPath(path, x.Name, opts)
 	} else {
@@ -598,6 +656,9 @@ func (x *cmdInstall) Execute([]string) error {
 		CohortKey: x.Cohort,
 	}
 	x.setModes(opts)
+	if err := x.setSchedule(opts); err != nil {
+		return err
+	}
 
 	names := remoteSnapNames(x.Positional.Snaps)
 	if len(names) == 0 {
@@ -620,13 +681,18 @@ func (x *cmdInstall) Execute([]string) error {
 	if x.Name != "" {
 		return errors.New(i18n.G("cannot use instance name when installing multiple snaps"))
 	}
-	return x.installMany(names, nil)
+	var manyOpts *client.SnapOptions
+	if x.asksForSchedule() {
+		manyOpts = &client.SnapOptions{NotBefore: opts.NotBefore, Window: opts.Window}
+	}
+	return x.installMany(names, manyOpts)
 }
 
 type cmdRefresh struct {
 	colorMixin
 	timeMixin
 	waitMixin
+	scheduleMixin
 	channelMixin
 	modeMixin
 
@@ -637,7 +703,10 @@ type cmdRefresh struct {
 	List             bool   `long:"list"`
 	Time             bool   `long:"time"`
 	IgnoreValidation bool   `long:"ignore-validation"`
-	Positional       struct {
+
+	Transaction client.TransactionType `long:"transaction" choice:"per-snap" choice:"all-snaps"`
+
+	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
 }
@@ -807,6 +876,9 @@ func (x *cmdRefresh) Execute([]string) error {
 			LeaveCohort:      x.LeaveCohort,
 		}
 		x.setModes(opts)
+		if err := x.setSchedule(opts); err != nil {
+			return err
+		}
 		return x.refreshOne(names[0], opts)
 	}
 
@@ -818,7 +890,14 @@ func (x *cmdRefresh) Execute([]string) error {
 		return errors.New(i18n.G("a single snap name must be specified when ignoring validation"))
 	}
 
-	return x.refreshMany(names, nil)
+	var opts *client.SnapOptions
+	if x.Transaction != "" || x.asksForSchedule() {
+		opts = &client.SnapOptions{Transaction: x.Transaction}
+		if err := x.setSchedule(opts); err != nil {
+			return err
+		}
+	}
+	return x.refreshMany(names, opts)
 }
 
 type cmdTry struct {
@@ -1075,14 +1154,14 @@ func (x cmdSwitch) Execute(args []string) error {
 
 func init() {
 	addCommand("remove", shortRemoveHelp, longRemoveHelp, func() flags.Commander { return &cmdRemove{} },
-		waitDescs.also(map[string]string{
+		waitDescs.also(scheduleDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"revision": i18n.G("Remove only the given revision"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"purge": i18n.G("Remove the snap without saving a snapshot of its data"),
 		}), nil)
 	addCommand("install", shortInstallHelp, longInstallHelp, func() flags.Commander { return &cmdInstall{} },
-		colorDescs.also(waitDescs).also(channelDescs).also(modeDescs).also(map[string]string{
+		colorDescs.also(waitDescs).also(scheduleDescs).also(channelDescs).also(modeDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"revision": i18n.G("Install the given revision of a snap, to which you must have developer access"),
 			// TRANSLATORS: This should not start with a lowercase letter.
@@ -1097,7 +1176,7 @@ func init() {
 			"cohort": i18n.G("Install the snap in the given cohort"),
 		}), nil)
 	addCommand("refresh", shortRefreshHelp, longRefreshHelp, func() flags.Commander { return &cmdRefresh{} },
-		colorDescs.also(waitDescs).also(channelDescs).also(modeDescs).also(timeDescs).also(map[string]string{
+		colorDescs.also(waitDescs).also(scheduleDescs).also(channelDescs).also(modeDescs).also(timeDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"amend": i18n.G("Allow refresh attempt on snap unknown to the store"),
 			// TRANSLATORS: This should not start with a lowercase letter.
@@ -1112,6 +1191,8 @@ func init() {
 			"cohort": i18n.G("Refresh the snap into the given cohort"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"leave-cohort": i18n.G("Refresh the snap out of its cohort"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"transaction": i18n.G("Whether a failure to refresh one of the snaps undoes the refresh of only that snap (per-snap) or of all of them (all-snaps)"),
 		}), nil)
 	addCommand("try", shortTryHelp, longTryHelp, func() flags.Commander { return &cmdTry{} }, waitDescs.also(modeDescs), nil)
 	addCommand("enable", shortEnableHelp, longEnableHelp, func() flags.Commander { return &cmdEnable{} }, waitDescs, nil)
@@ -1363,6 +1363,124 @@ func (s *SnapOpSuite) TestRefreshManyIgnoreValidation(c *check.C) {
 	c.Assert(err, check.ErrorMatches, `a single snap name must be specified when ignoring validation`)
 }
 
+func (s *SnapOpSuite) TestRefreshManyTransaction(c *check.C) {
+	for _, args := range [][]string{
+		{"refresh", "--transaction=all-snaps", "one", "two"},
+		{"refresh", "--transaction=all-snaps"},
+	} {
+		n := 0
+		s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+			switch n {
+			case 0:
+				c.Check(r.Method, check.Equals, "POST")
+				c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+				expected := map[string]interface{}{
+					"action":      "refresh",
+					"transaction": "all-snaps",
+				}
+				if len(args) > 2 {
+					expected["snaps"] = []interface{}{"one", "two"}
+				}
+				c.Check(DecodedRequestBody(c, r), check.DeepEquals, expected)
+				w.WriteHeader(202)
+				fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+			case 1:
+				c.Check(r.Method, check.Equals, "GET")
+				c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+				fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+			default:
+				c.Fatalf("expected to get 2 requests, now on %d", n+1)
+			}
+			n++
+		})
+
+		_, err := snap.Parser(snap.Client()).ParseArgs(args)
+		c.Assert(err, check.IsNil)
+		c.Check(n, check.Equals, 2)
+		c.Check(s.Stderr(), check.Equals, "All snaps up to date.\n")
+		s.ResetStdStreams()
+	}
+}
+
+func (s *SnapOpSuite) TestRefreshTransactionInvalid(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--transaction=some-snaps", "one", "two"})
+	c.Assert(err, check.ErrorMatches, `Invalid value .some-snaps. for option .--transaction.*`)
+}
+
+func (s *SnapOpSuite) TestRemoveManyScheduled(c *check.C) {
+	restore := snap.MockTimeNow(func() time.Time {
+		return time.Date(2020, 10, 2, 10, 0, 0, 0, time.UTC)
+	})
+	defer restore()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action":     "remove",
+				"snaps":      []interface{}{"one", "two"},
+				"not-before": "2020-10-02T12:00:00Z",
+				"window":     "sat,02:00-04:00",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": false, "status": "Do", "not-before": "2020-10-03T02:00:00Z"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"remove", "--not-before=2h", "--window=sat,02:00-04:00", "one", "two"})
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 2)
+	c.Check(s.Stdout(), check.Equals, "Change 42 scheduled to start at 2020-10-03T02:00:00Z\n")
+}
+
+func (s *SnapOpSuite) TestRefreshOneNotBefore(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps/one")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action":     "refresh",
+				"not-before": "2099-01-01T00:00:00Z",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": false, "status": "Do", "not-before": "2099-01-01T00:00:00Z"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--not-before=2099-01-01T00:00:00Z", "one"})
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 2)
+	c.Check(s.Stdout(), check.Equals, "Change 42 scheduled to start at 2099-01-01T00:00:00Z\n")
+}
+
+func (s *SnapOpSuite) TestScheduleErrors(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--not-before=tomorrow", "one"})
+	c.Check(err, check.ErrorMatches, `cannot parse --not-before "tomorrow": expected a RFC3339 timestamp or a duration`)
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"install", "--window=02:00-04:00", "./foo.snap"})
+	c.Check(err, check.ErrorMatches, `cannot schedule the installation of a snap file`)
+}
+
 func (s *SnapOpSuite) TestRefreshAllModeFlags(c *check.C) {
 	s.RedirectClientToTestServer(nil)
 	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--devmode"})
@@ -28,6 +28,7 @@ import (
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/strutil/quantity"
@@ -61,6 +62,9 @@ for which users, or a combination of these.
 If a snap is included in a save operation, excluding its system and
 configuration data from the snapshot is not currently possible. This
 restriction may be lifted in the future.
+
+Configuration options the snap marked as secret are left out of the
+snapshot unless --include-secrets is given.
 `)
 var longForgetHelp = i18n.G(`
 The forget command deletes a snapshot. This operation can not be
@@ -108,6 +112,7 @@ Export a snapshot to the given filename.
 type savedCmd struct {
 	clientMixin
 	durationMixin
+	formatMixin
 	ID         snapshotID `long:"id"`
 	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
@@ -128,6 +133,12 @@ func (x *savedCmd) Execute([]string) error {
 	if err != nil {
 		return err
 	}
+	if x.structured() {
+		if list == nil {
+			list = []client.SnapshotSet{}
+		}
+		return x.printStructured(list)
+	}
 	if len(list) == 0 {
 		fmt.Fprintln(Stdout, i18n.G("No snapshots found."))
 		return nil
@@ -171,8 +182,9 @@ func (x *savedCmd) Execute([]string) error {
 type saveCmd struct {
 	waitMixin
 	durationMixin
-	Users      string `long:"users"`
-	Positional struct {
+	Users          string `long:"users"`
+	IncludeSecrets bool   `long:"include-secrets"`
+	Positional     struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
 }
@@ -180,7 +192,10 @@ type saveCmd struct {
 func (x *saveCmd) Execute([]string) error {
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	setID, changeID, err := x.client.SnapshotMany(snaps, users)
+	setID, changeID, err := x.client.SnapshotManyWithOptions(snaps, &client.SnapOptions{
+		Users:          users,
+		IncludeSecrets: x.IncludeSecrets,
+	})
 	if err != nil {
 		return err
 	}
@@ -319,7 +334,7 @@ func init() {
 		func() flags.Commander {
 			return &savedCmd{}
 		},
-		durationDescs.also(map[string]string{
+		durationDescs.also(formatDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"id": i18n.G("Show only a specific snapshot."),
 		}),
@@ -333,6 +348,8 @@ func init() {
 		}, durationDescs.also(waitDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Snapshot data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"include-secrets": i18n.G("Include secret configuration options in the snapshot"),
 		}), nil)
 
 	addCommand("restore",
@@ -20,6 +20,7 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"path/filepath"
@@ -98,6 +99,28 @@ func (s *SnapSuite) TestSnapSnaphotsTest(c *C) {
 	}
 }
 
+func (s *SnapSuite) TestSnapshotSavedFormatJSON(c *C) {
+	s.mockSnapshotsServer(c)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"saved", "--format=json", "--id=3"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stderr(), Equals, "")
+
+	var sets []map[string]interface{}
+	c.Assert(json.Unmarshal(s.stdout.Bytes(), &sets), IsNil)
+	c.Assert(sets, HasLen, 1)
+	c.Check(sets[0]["id"], Equals, 3.)
+	snapshots := sets[0]["snapshots"].([]interface{})
+	c.Assert(snapshots, HasLen, 1)
+	sh := snapshots[0].(map[string]interface{})
+	c.Check(sh["set"], Equals, 3.)
+	c.Check(sh["snap"], Equals, "htop")
+	c.Check(sh["revision"], Equals, "1168")
+	c.Check(sh["version"], Equals, "2")
+	c.Check(sh["auto"], Equals, true)
+	c.Check(sh["size"], Equals, 1.)
+}
+
 func (s *SnapSuite) TestSnapshotExportHappy(c *C) {
 	s.mockSnapshotsServer(c)
 
@@ -110,6 +133,32 @@ func (s *SnapSuite) TestSnapshotExportHappy(c *C) {
 	c.Check(exportedSnapshotPath+".part", testutil.FileAbsent)
 }
 
+func (s *SnapSuite) TestSnapshotSaveIncludeSecrets(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/snaps":
+			c.Check(r.Method, Equals, "POST")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action":          "snapshot",
+				"snaps":           []interface{}{"htop"},
+				"include-secrets": true,
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9", "result": {"set-id": 1}}`)
+		case "/v2/changes/9":
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		case "/v2/snapshots":
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":1,"snapshots":[{"set":1,"time":"2020-01-01T00:00:00Z","snap":"htop","revision":"1168","snap-id":"Z","epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1}]}]}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--include-secrets", "htop"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), testutil.Contains, "htop")
+}
+
 func (s *SnapSuite) mockSnapshotsServer(c *C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
@@ -0,0 +1,216 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var shortTokensHelp = i18n.G("List, create or revoke scoped API access tokens")
+var longTokensHelp = i18n.G(`
+The tokens command lists the scoped API access tokens, which let
+unprivileged agents use parts of the snapd API.
+
+With --create it creates a token granting the given scopes and prints it;
+the token cannot be displayed again. Each scope has the form
+
+    <endpoint>=<action>[,<action>...][@<snap>[,<snap>...]]
+
+where the action "read" covers GET requests, and the others are the actions
+of the requests to the endpoint. For example:
+
+    $ snap tokens --create --label=monitoring /v2/changes=read \
+        /v2/snaps=refresh@foo,bar /v2/apps=start,stop,restart@baz
+
+Clients pass the token in an "Authorization: Bearer <token>" header; the
+snap command uses the token in the SNAPD_API_TOKEN environment variable.
+
+With --cert the token is instead bound to the given PEM client certificate,
+and is used by clients presenting that certificate to the TLS listener set
+up via the api.tls.listen system option (see snap --host).
+
+With --revoke it revokes the token with the given ID.
+`)
+
+type cmdTokens struct {
+	clientMixin
+	timeMixin
+
+	Create    bool          `long:"create"`
+	Label     string        `long:"label"`
+	ExpiresIn time.Duration `long:"expires-in"`
+	Cert      string        `long:"cert"`
+	Revoke    int           `long:"revoke"`
+
+	Positional struct {
+		Scopes []string `positional-arg-name:"<scope>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("tokens", shortTokensHelp, longTokensHelp, func() flags.Commander {
+		return &cmdTokens{}
+	}, timeDescs.also(map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"create": i18n.G("Create a token granting the given scopes"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"label": i18n.G("Label of the token to create"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"expires-in": i18n.G("Duration after which the token to create expires (default: never)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"cert": i18n.G("Bind the token to create to the client certificate in the given file"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"revoke": i18n.G("Revoke the token with the given ID"),
+	}), []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<scope>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Scope granted by the token to create"),
+	}})
+}
+
+// parseTokenScope parses <endpoint>=<action>[,<action>...][@<snap>,...]
+func parseTokenScope(s string) (*client.APITokenScope, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf(i18n.G("invalid scope %q (want <endpoint>=<action>[,<action>...][@<snap>,...])"), s)
+	}
+	scope := &client.APITokenScope{Endpoint: parts[0]}
+	actions := parts[1]
+	if i := strings.IndexRune(actions, '@'); i >= 0 {
+		scope.Snaps = strutil.CommaSeparatedList(actions[i+1:])
+		actions = actions[:i]
+		if len(scope.Snaps) == 0 {
+			return nil, fmt.Errorf(i18n.G("invalid scope %q: no snaps after @"), s)
+		}
+	}
+	scope.Actions = strutil.CommaSeparatedList(actions)
+	if len(scope.Actions) == 0 {
+		return nil, fmt.Errorf(i18n.G("invalid scope %q: no actions"), s)
+	}
+	return scope, nil
+}
+
+func fmtTokenScopes(scopes []client.APITokenScope) string {
+	out := make([]string, len(scopes))
+	for i, sc := range scopes {
+		out[i] = sc.Endpoint + "=" + strings.Join(sc.Actions, ",")
+		if len(sc.Snaps) > 0 {
+			out[i] += "@" + strings.Join(sc.Snaps, ",")
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func (x *cmdTokens) create() error {
+	if len(x.Positional.Scopes) == 0 {
+		return fmt.Errorf(i18n.G("cannot create a token without scopes"))
+	}
+	opts := &client.CreateAPITokenOptions{Label: x.Label}
+	for _, s := range x.Positional.Scopes {
+		scope, err := parseTokenScope(s)
+		if err != nil {
+			return err
+		}
+		opts.Scopes = append(opts.Scopes, *scope)
+	}
+	if x.ExpiresIn < 0 {
+		return fmt.Errorf(i18n.G("cannot create a token with a negative expiry"))
+	}
+	if x.ExpiresIn > 0 {
+		opts.Expires = timeNow().Add(x.ExpiresIn)
+	}
+
+	if x.Cert != "" {
+		cert, err := ioutil.ReadFile(x.Cert)
+		if err != nil {
+			return err
+		}
+		opts.Certificate = string(cert)
+	}
+
+	res, err := x.client.CreateAPIToken(opts)
+	if err != nil {
+		return err
+	}
+	if x.Cert != "" {
+		fmt.Fprintf(Stdout, i18n.G("Token %d bound to certificate %q.\n"), res.ID, x.Cert)
+		return nil
+	}
+	fmt.Fprintf(Stdout, "%s\n", res.Token)
+	return nil
+}
+
+func (x *cmdTokens) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	if x.Create && x.Revoke != 0 {
+		return fmt.Errorf(i18n.G("cannot use --create and --revoke together"))
+	}
+	if !x.Create && (x.Label != "" || x.ExpiresIn != 0 || x.Cert != "" || len(x.Positional.Scopes) > 0) {
+		return fmt.Errorf(i18n.G("--label, --expires-in, --cert and scopes can only be used with --create"))
+	}
+	if x.Create {
+		return x.create()
+	}
+	if x.Revoke != 0 {
+		if err := x.client.RevokeAPIToken(x.Revoke); err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, i18n.G("Token %d revoked.\n"), x.Revoke)
+		return nil
+	}
+
+	tokens, err := x.client.APITokens()
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No tokens."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+	fmt.Fprintln(w, i18n.G("ID\tLabel\tCreated\tExpires\tScopes"))
+	for _, tok := range tokens {
+		label := tok.Label
+		if label == "" {
+			label = "-"
+		}
+		expires := "-"
+		if tok.Expires != nil {
+			expires = x.fmtTime(*tok.Expires)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", tok.ID, label, x.fmtTime(tok.Created), expires, fmtTokenScopes(tok.Scopes))
+	}
+	return nil
+}
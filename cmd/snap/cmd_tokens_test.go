@@ -0,0 +1,166 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) TestTokensList(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/tokens")
+		c.Check(r.Header.Get("Authorization"), Equals, "Bearer s3cr3t")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+			{"id": 1, "label": "monitoring", "scopes": [{"endpoint": "/v2/changes", "actions": ["read"]}, {"endpoint": "/v2/snaps", "actions": ["refresh"], "snaps": ["foo", "bar"]}], "created": "2020-06-01T10:00:00Z"},
+			{"id": 2, "scopes": [{"endpoint": "/v2/apps", "actions": ["start", "restart"], "snaps": ["baz"]}], "created": "2020-06-01T10:00:00Z", "expires": "2020-07-01T00:00:00Z"}
+		]}`)
+	})
+
+	os.Setenv("SNAPD_API_TOKEN", "s3cr3t")
+	defer os.Unsetenv("SNAPD_API_TOKEN")
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"tokens", "--abs-time"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(n, Equals, 1)
+	c.Check(s.Stdout(), Equals, `
+ID   Label       Created               Expires               Scopes
+1    monitoring  2020-06-01T10:00:00Z  -                     /v2/changes=read /v2/snaps=refresh@foo,bar
+2    -           2020-06-01T10:00:00Z  2020-07-01T00:00:00Z  /v2/apps=start,restart@baz
+`[1:])
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestTokensListEmpty(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"tokens"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "")
+	c.Check(s.Stderr(), Equals, "No tokens.\n")
+}
+
+func (s *SnapSuite) TestTokensCreate(c *C) {
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	defer snap.MockTimeNow(func() time.Time { return now })()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, Equals, "POST")
+		c.Check(r.URL.Path, Equals, "/v2/tokens")
+		c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+			"action": "create",
+			"label":  "monitoring",
+			"scopes": []interface{}{
+				map[string]interface{}{"endpoint": "/v2/changes", "actions": []interface{}{"read"}},
+				map[string]interface{}{"endpoint": "/v2/apps", "actions": []interface{}{"start", "restart"}, "snaps": []interface{}{"baz"}},
+			},
+			"expires": "2020-06-02T10:00:00Z",
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": {"id": 3, "token": "s3cr3t"}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"tokens", "--create", "--label=monitoring", "--expires-in=24h", "/v2/changes=read", "/v2/apps=start,restart@baz"})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1)
+	c.Check(s.Stdout(), Equals, "s3cr3t\n")
+}
+
+func (s *SnapSuite) TestTokensCreateForCertificate(c *C) {
+	certFile := filepath.Join(c.MkDir(), "client.crt")
+	c.Assert(ioutil.WriteFile(certFile, []byte("PEM"), 0644), IsNil)
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+			"action": "create",
+			"scopes": []interface{}{
+				map[string]interface{}{"endpoint": "/v2/changes", "actions": []interface{}{"read"}},
+			},
+			"certificate": "PEM",
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": {"id": 4}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"tokens", "--create", "--cert", certFile, "/v2/changes=read"})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1)
+	c.Check(s.Stdout(), Equals, fmt.Sprintf("Token 4 bound to certificate %q.\n", certFile))
+}
+
+func (s *SnapSuite) TestTokensRevoke(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, Equals, "POST")
+		c.Check(r.URL.Path, Equals, "/v2/tokens")
+		c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+			"action": "revoke",
+			"id":     json.Number("3"),
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": null}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"tokens", "--revoke=3"})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1)
+	c.Check(s.Stdout(), Equals, "Token 3 revoked.\n")
+}
+
+func (s *SnapSuite) TestTokensErrors(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--create", "--revoke=1"}, "cannot use --create and --revoke together"},
+		{[]string{"--label=foo"}, "--label, --expires-in, --cert and scopes can only be used with --create"},
+		{[]string{"/v2/changes=read"}, "--label, --expires-in, --cert and scopes can only be used with --create"},
+		{[]string{"--create"}, "cannot create a token without scopes"},
+		{[]string{"--create", "--expires-in=-1h", "/v2/changes=read"}, "cannot create a token with a negative expiry"},
+		{[]string{"--create", "/v2/changes"}, `invalid scope "/v2/changes" \(want <endpoint>=<action>\[,<action>...\]\[@<snap>,...\]\)`},
+		{[]string{"--create", "=read"}, `invalid scope "=read" .*`},
+		{[]string{"--create", "/v2/changes="}, `invalid scope "/v2/changes=": no actions`},
+		{[]string{"--create", "/v2/snaps=refresh@"}, `invalid scope "/v2/snaps=refresh@": no snaps after @`},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(append([]string{"tokens"}, t.args...))
+		c.Check(err, ErrorMatches, t.err, Commentf("%v", t.args))
+	}
+}
@@ -39,6 +39,7 @@ type cmdWarnings struct {
 	clientMixin
 	timeMixin
 	unicodeMixin
+	formatMixin
 	All     bool `long:"all"`
 	Verbose bool `long:"verbose"`
 }
@@ -65,7 +66,7 @@ sufficient time has passed.
 `)
 
 func init() {
-	addCommand("warnings", shortWarningsHelp, longWarningsHelp, func() flags.Commander { return &cmdWarnings{} }, timeDescs.also(unicodeDescs).also(map[string]string{
+	addCommand("warnings", shortWarningsHelp, longWarningsHelp, func() flags.Commander { return &cmdWarnings{} }, timeDescs.also(unicodeDescs).also(formatDescs).also(map[string]string{
 		// TRANSLATORS: This should not start with a lowercase letter.
 		"all": i18n.G("Show all warnings"),
 		// TRANSLATORS: This should not start with a lowercase letter.
@@ -74,6 +75,26 @@ func init() {
 	addCommand("okay", shortOkayHelp, longOkayHelp, func() flags.Commander { return &cmdOkay{} }, nil, nil)
 }
 
+// structuredWarning is a warning as printed in a machine-readable format,
+// with its durations in the same format as in the REST API.
+type structuredWarning struct {
+	*client.Warning
+	ExpireAfter string `json:"expire-after,omitempty"`
+	RepeatAfter string `json:"repeat-after,omitempty"`
+}
+
+func structuredWarnings(warnings []*client.Warning) []structuredWarning {
+	sws := make([]structuredWarning, len(warnings))
+	for i, warning := range warnings {
+		sws[i] = structuredWarning{
+			Warning:     warning,
+			ExpireAfter: warning.ExpireAfter.String(),
+			RepeatAfter: warning.RepeatAfter.String(),
+		}
+	}
+	return sws
+}
+
 func (cmd *cmdWarnings) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
@@ -85,6 +106,9 @@ func (cmd *cmdWarnings) Execute(args []string) error {
 		return err
 	}
 	if len(warnings) == 0 {
+		if cmd.structured() {
+			return cmd.printStructured([]structuredWarning{})
+		}
 		if t, _ := lastWarningTimestamp(); t.IsZero() {
 			fmt.Fprintln(Stdout, i18n.G("No warnings."))
 		} else {
@@ -97,6 +121,10 @@ func (cmd *cmdWarnings) Execute(args []string) error {
 		return err
 	}
 
+	if cmd.structured() {
+		return cmd.printStructured(structuredWarnings(warnings))
+	}
+
 	termWidth, _ := termSize()
 	if termWidth > 100 {
 		// any wider than this and it gets hard to read
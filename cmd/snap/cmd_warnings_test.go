@@ -117,6 +117,49 @@ warning: |
 `[1:])
 }
 
+func (s *warningSuite) TestWarningsFormatJSON(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, twoWarnings))
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"warnings", "--format=json"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+[
+	{
+		"message": "hello world number one",
+		"first-added": "2018-09-19T12:41:18.505007495Z",
+		"last-added": "2018-09-19T12:41:18.505007495Z",
+		"last-shown": "0001-01-01T00:00:00Z",
+		"expire-after": "672h0m0s",
+		"repeat-after": "24h0m0s"
+	},
+	{
+		"message": "hello world number two",
+		"first-added": "2018-09-19T12:44:19.680362867Z",
+		"last-added": "2018-09-19T12:44:19.680362867Z",
+		"last-shown": "0001-01-01T00:00:00Z",
+		"expire-after": "672h0m0s",
+		"repeat-after": "24h0m0s"
+	}
+]
+`[1:])
+
+	// the warnings count as seen, as with the text output
+	t, err := snap.LastWarningTimestamp()
+	c.Assert(err, check.IsNil)
+	c.Check(t.IsZero(), check.Equals, false)
+}
+
+func (s *warningSuite) TestNoWarningsFormatYAML(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, `{"type": "sync", "status-code": 200, "result": []}`))
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"warnings", "--format=yaml"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, "[]\n")
+}
+
 func (s *warningSuite) TestVerboseWarnings(c *check.C) {
 	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, twoWarnings))
 
@@ -20,12 +20,14 @@
 package main
 
 import (
+	"io"
 	"os"
 	"os/user"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/image"
 	"github.com/snapcore/snapd/sandbox/cgroup"
@@ -67,6 +69,7 @@ var (
 	ReadRpc = readRpc
 
 	WriteWarningTimestamp = writeWarningTimestamp
+	LastWarningTimestamp  = lastWarningTimestamp
 	MaybePresentWarnings  = maybePresentWarnings
 
 	LongSnapDescription     = longSnapDescription
@@ -135,6 +138,14 @@ var (
 	MaybePrintHealth            = (*infoWriter).maybePrintHealth
 )
 
+func MockBootDumpBootChains(f func(w io.Writer, model *asserts.Model, candidateKernel string) error) (restore func()) {
+	old := bootDumpBootChains
+	bootDumpBootChains = f
+	return func() {
+		bootDumpBootChains = old
+	}
+}
+
 func MockPollTime(d time.Duration) (restore func()) {
 	d0 := pollTime
 	pollTime = d
@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/i18n"
+)
+
+type formatMixin struct {
+	Format string `long:"format" default:"text" choice:"text" choice:"json" choice:"yaml"`
+}
+
+var formatDescs = mixinDescs{
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"format": i18n.G("Print in the given format, json and yaml being machine-readable"),
+}
+
+// structured returns whether a machine-readable output format was asked for.
+func (mx formatMixin) structured() bool {
+	return mx.Format == "json" || mx.Format == "yaml"
+}
+
+// printStructured prints v in the machine-readable format asked for. The
+// field names are the ones of the JSON encoding of v in either format, so
+// that they stay the same as the ones of the REST API.
+func (mx formatMixin) printStructured(v interface{}) error {
+	switch mx.Format {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "%s\n", data)
+	case "yaml":
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var generic interface{}
+		if err := dec.Decode(&generic); err != nil {
+			return err
+		}
+		data, err = yaml.Marshal(yamlFromJSON(generic))
+		if err != nil {
+			return err
+		}
+		Stdout.Write(data)
+	default:
+		return fmt.Errorf("internal error: unsupported output format %q", mx.Format)
+	}
+	return nil
+}
+
+// yamlFromJSON turns the numbers in the decoded JSON value v into
+// integers where possible, as yaml would otherwise print them either as
+// strings or in exponent notation.
+func yamlFromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = yamlFromJSON(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = yamlFromJSON(e)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
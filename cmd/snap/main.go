@@ -71,7 +71,8 @@ var (
 )
 
 type options struct {
-	Version func() `long:"version"`
+	Version func()             `long:"version"`
+	Host    func(string) error `long:"host"`
 }
 
 type argDesc struct {
@@ -319,6 +320,9 @@ func Parser(cli *client.Client) *flags.Parser {
 		printVersions(cli)
 		panic(&exitStatus{0})
 	}
+	optionsData.Host = func(host string) error {
+		return useRemoteHost(cli, host)
+	}
 	flagopts := flags.Options(flags.PassDoubleDash)
 	if firstNonOptionIsRun() {
 		flagopts |= flags.PassAfterNonOption
@@ -333,6 +337,11 @@ func Parser(cli *client.Client) *flags.Parser {
 		version.Description = i18n.G("Print the version and exit")
 		version.Hidden = true
 	}
+	if host := parser.FindOptionByLongName("host"); host != nil {
+		host.Description = i18n.G("Talk to the snapd on the given <host>:<port> over TLS")
+		host.ValueName = "<host>:<port>"
+		host.Hidden = true
+	}
 	// add --help like what go-flags would do for us, but hidden
 	addHelp(parser)
 
@@ -388,6 +397,8 @@ func mkClient() *client.Client {
 	// Set client user-agent when talking to the snapd daemon to the
 	// same value as when talking to the store.
 	cfg.UserAgent = snapdenv.UserAgent()
+	// a scoped API access token, see "snap help tokens"
+	cfg.APIToken = os.Getenv("SNAPD_API_TOKEN")
 
 	cli := client.New(cfg)
 	goos := runtime.GOOS
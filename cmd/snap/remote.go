@@ -0,0 +1,94 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// remoteTLSDir returns the directory with the client certificate and key
+// (client.crt and client.key) and the CA certificate of remote snapd
+// (server-ca.crt): ~/.snap/tls, unless SNAPD_TLS_DIR says otherwise.
+func remoteTLSDir() (string, error) {
+	if dir := os.Getenv("SNAPD_TLS_DIR"); dir != "" {
+		return dir, nil
+	}
+	real, err := osutil.RealUser()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(real.HomeDir, ".snap", "tls"), nil
+}
+
+func remoteTLSConfig() (*tls.Config, error) {
+	dir, err := remoteTLSDir()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("cannot load client certificate: %v"), err)
+	}
+	caPEM, err := ioutil.ReadFile(filepath.Join(dir, "server-ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("cannot load snapd CA certificate: %v"), err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf(i18n.G("cannot load snapd CA certificate: no certificates found"))
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// useRemoteHost points cli to the snapd listening for TLS connections on
+// the given host:port, as set up via the api.tls.listen system option.
+func useRemoteHost(cli *client.Client, host string) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return fmt.Errorf(i18n.G("cannot use host %q: %v"), host, err)
+	}
+	tlsConfig, err := remoteTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	cfg := ClientConfig
+	cfg.BaseURL = "https://" + host
+	cfg.TLSConfig = tlsConfig
+	// the login data is for the local snapd, the remote one knows us
+	// by our certificate
+	cfg.DisableAuth = true
+	*cli = *client.New(&cfg)
+	return nil
+}
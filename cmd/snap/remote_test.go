@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+// mockRemoteSnapd starts a TLS server asking for client certificates and
+// sets up SNAPD_TLS_DIR so that the client trusts it and presents the
+// server's own certificate as its client certificate.
+func (s *SnapSuite) mockRemoteSnapd(c *C, handler func(w http.ResponseWriter, r *http.Request)) (host string) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	s.AddCleanup(server.Close)
+
+	cert := server.TLS.Certificates[0]
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(cert.PrivateKey.(*rsa.PrivateKey))})
+
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "client.crt"), certPEM, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "client.key"), keyPEM, 0600), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "server-ca.crt"), certPEM, 0644), IsNil)
+	os.Setenv("SNAPD_TLS_DIR", dir)
+	s.AddCleanup(func() { os.Unsetenv("SNAPD_TLS_DIR") })
+
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+func (s *SnapSuite) TestHostTalksToRemoteSnapd(c *C) {
+	// the local snapd is not to be talked to
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request to the local snapd: %v", r.URL)
+	})
+	s.Login(c)
+
+	n := 0
+	host := s.mockRemoteSnapd(c, func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.URL.Path, Equals, "/v2/tokens")
+		c.Check(r.TLS.PeerCertificates, HasLen, 1)
+		// the local login is not used remotely
+		c.Check(r.Header.Get("Authorization"), Equals, "")
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"--host", host, "tokens"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(n, Equals, 1)
+	c.Check(s.Stderr(), Equals, "No tokens.\n")
+}
+
+func (s *SnapSuite) TestHostSendsAPIToken(c *C) {
+	n := 0
+	host := s.mockRemoteSnapd(c, func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Header.Get("Authorization"), Equals, "Bearer s3cr3t")
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+
+	os.Setenv("SNAPD_API_TOKEN", "s3cr3t")
+	defer os.Unsetenv("SNAPD_API_TOKEN")
+
+	// the token is picked up when the client is made
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"--host", host, "tokens"})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1)
+}
+
+func (s *SnapSuite) TestHostErrors(c *C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"--host", "example.com", "tokens"})
+	c.Check(err, ErrorMatches, `.*: cannot use host "example.com": address example.com: missing port in address`)
+
+	os.Setenv("SNAPD_TLS_DIR", c.MkDir())
+	defer os.Unsetenv("SNAPD_TLS_DIR")
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"--host", "example.com:8443", "tokens"})
+	c.Check(err, ErrorMatches, `.*: cannot load client certificate: open .*/client.crt: no such file or directory`)
+}
@@ -147,6 +147,12 @@ func (wmx waitMixin) wait(id string) (*client.Change, error) {
 			return nil, fmt.Errorf(i18n.G("change finished in status %q with no error message"), chg.Status)
 		}
 
+		if changeScheduled(chg) {
+			// TRANSLATORS: the first %s is the change id, the second a RFC 3339 time
+			fmt.Fprintf(Stdout, i18n.G("Change %s scheduled to start at %s\n"), id, chg.NotBefore.Format(time.RFC3339))
+			return nil, noWait
+		}
+
 		if rebootingErr != nil {
 			return nil, rebootingErr
 		}
@@ -57,8 +57,10 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/changearchive"
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/healthstate"
 	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/servicestate"
@@ -113,6 +115,9 @@ var api = []*Command{
 	serialModelCmd,
 	systemsCmd,
 	systemsActionCmd,
+	systemRecoveryKeysCmd,
+	tokensCmd,
+	metricsCmd,
 }
 
 var servicestateControl = servicestate.Control
@@ -391,6 +396,16 @@ func UserFromRequest(st *state.State, req *http.Request) (*auth.UserState, error
 	return user, err
 }
 
+// tokenFromRequest extracts the scoped API access token of the request, if
+// any, from its "Authorization: Bearer <token>" header.
+func tokenFromRequest(st *state.State, req *http.Request) (*auth.TokenState, error) {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, auth.ErrInvalidAuth
+	}
+	return auth.CheckToken(st, strings.TrimPrefix(header, "Bearer "))
+}
+
 var muxVars = mux.Vars
 
 func getSnapInfo(c *Command, r *http.Request, user *auth.UserState) Response {
@@ -804,6 +819,14 @@ type snapInstruction struct {
 	License  *licenseData `json:"license"`
 	Snaps    []string     `json:"snaps"`
 	Users    []string     `json:"users"`
+	// IncludeSecrets asks for secret configuration options to be saved
+	// in snapshots
+	IncludeSecrets bool `json:"include-secrets,omitempty"`
+	// Transaction asks for a multi-snap refresh to be undone for all
+	// the snaps if it fails for any of them
+	Transaction snapstate.TransactionType `json:"transaction,omitempty"`
+	// changeSchedule optionally delays the start of the change
+	changeSchedule
 
 	// The fields below should not be unmarshalled into. Do not export them.
 	userID int
@@ -845,6 +868,15 @@ func (inst *snapInstruction) validate() error {
 			return fmt.Errorf("leave-cohort can only be specified for refresh or switch")
 		}
 	}
+	switch inst.Transaction {
+	case "", snapstate.TransactionPerSnap, snapstate.TransactionAllSnaps:
+		// ok
+	default:
+		return fmt.Errorf("invalid value for transaction type: %q", inst.Transaction)
+	}
+	if inst.Transaction != "" && inst.Action != "refresh" {
+		return fmt.Errorf("transaction type can only be specified for refresh")
+	}
 	if inst.Action == "install" {
 		for _, snapName := range inst.Snaps {
 			// FIXME: alternatively we could simply mutate *inst
@@ -925,7 +957,8 @@ func snapUpdateMany(inst *snapInstruction, st *state.State) (*snapInstructionRes
 	}
 
 	// TODO: use a per-request context
-	updated, tasksets, err := snapstateUpdateMany(context.TODO(), st, inst.Snaps, inst.userID, nil)
+	flags := &snapstate.Flags{Transaction: inst.Transaction}
+	updated, tasksets, err := snapstateUpdateMany(context.TODO(), st, inst.Snaps, inst.userID, flags)
 	if err != nil {
 		return nil, err
 	}
@@ -1155,7 +1188,7 @@ func snapSwitch(inst *snapInstruction, st *state.State) (string, []*state.TaskSe
 }
 
 func snapshotMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
-	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users)
+	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users, &snapshotstate.SaveOptions{IncludeSecrets: inst.IncludeSecrets})
 	if err != nil {
 		return nil, err
 	}
@@ -1230,6 +1263,10 @@ func postSnap(c *Command, r *http.Request, user *auth.UserState) Response {
 	if err := inst.validate(); err != nil {
 		return BadRequest("%s", err)
 	}
+	notBefore, err := inst.changeSchedule.start()
+	if err != nil {
+		return BadRequest("%v", err)
+	}
 
 	impl := inst.dispatch()
 	if impl == nil {
@@ -1242,6 +1279,9 @@ func postSnap(c *Command, r *http.Request, user *auth.UserState) Response {
 	}
 
 	chg := newChange(state, inst.Action+"-snap", msg, tsets, inst.Snaps)
+	if !notBefore.IsZero() {
+		chg.SetNotBefore(notBefore)
+	}
 
 	ensureStateSoon(state)
 
@@ -1335,6 +1375,10 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 	if err := inst.validate(); err != nil {
 		return BadRequest("%v", err)
 	}
+	notBefore, err := inst.changeSchedule.start()
+	if err != nil {
+		return BadRequest("%v", err)
+	}
 
 	st := c.d.overlord.State()
 	st.Lock()
@@ -1369,6 +1413,9 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 		chg.SetStatus(state.DoneStatus)
 	} else {
 		chg = newChange(st, inst.Action+"-snap", res.Summary, res.Tasksets, res.Affected)
+		if !notBefore.IsZero() {
+			chg.SetNotBefore(notBefore)
+		}
 		ensureStateSoon(st)
 	}
 
@@ -1605,6 +1652,21 @@ func getSnapConf(c *Command, r *http.Request, user *auth.UserState) Response {
 
 	keys := strutil.CommaSeparatedList(r.URL.Query().Get("keys"))
 
+	if r.URL.Query().Get("schema") == "true" {
+		return getSnapConfSchema(c, snapName, keys)
+	}
+
+	// secret options are only shown to root, a caller we cannot identify
+	// is not root
+	redact := true
+	if _, uid, _, err := ucrednetGet(r.RemoteAddr); err == nil && uid == 0 {
+		redact = false
+	}
+
+	if r.URL.Query().Get("history") == "true" {
+		return getSnapConfHistory(c, snapName, redact)
+	}
+
 	s := c.d.overlord.State()
 	s.Lock()
 	tr := config.NewTransaction(s)
@@ -1637,6 +1699,9 @@ func getSnapConf(c *Command, r *http.Request, user *auth.UserState) Response {
 				return InternalError("%v", err)
 			}
 		}
+		if redact {
+			value = tr.Redact(snapName, key, value)
+		}
 		if key == "" {
 			if len(keys) > 1 {
 				return BadRequest("keys contains zero-length string")
@@ -1650,12 +1715,76 @@ func getSnapConf(c *Command, r *http.Request, user *auth.UserState) Response {
 	return SyncResponse(currentConfValues, nil)
 }
 
+// getSnapConfSchema returns the configuration schema of the snap, or the
+// schemas of the given keys.
+func getSnapConfSchema(c *Command, snapName string, keys []string) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if err := snapstate.Get(st, snapName, &snapstate.SnapState{}); err == state.ErrNoState {
+		return SnapNotFound(snapName, &snap.NotInstalledError{Snap: snapName})
+	}
+	schema, err := configstate.SnapConfigSchema(st, snapName)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	if schema == nil {
+		return NotFound("snap %q has no configuration schema", configstate.RemapSnapToResponse(snapName))
+	}
+	if len(keys) == 0 {
+		return SyncResponse(schema, nil)
+	}
+
+	schemas := make(map[string]*config.Schema, len(keys))
+	for _, key := range keys {
+		keySchema := schema.Lookup(key)
+		if keySchema == nil {
+			return NotFound("option %q is not described by the configuration schema of snap %q", key, configstate.RemapSnapToResponse(snapName))
+		}
+		schemas[key] = keySchema
+	}
+	return SyncResponse(schemas, nil)
+}
+
+// getSnapConfHistory returns the recorded configurations of the snap,
+// oldest first, optionally with the values of secret options redacted.
+func getSnapConfHistory(c *Command, snapName string, redact bool) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if snapName != "core" {
+		if err := snapstate.Get(st, snapName, &snapstate.SnapState{}); err == state.ErrNoState {
+			return SnapNotFound(snapName, &snap.NotInstalledError{Snap: snapName})
+		}
+	}
+	entries, err := config.History(st, snapName)
+	if err != nil {
+		return InternalError("%v", err)
+	}
+	if entries == nil {
+		entries = []*config.HistoryEntry{}
+	}
+	if redact {
+		entries = config.NewTransaction(st).RedactHistory(snapName, entries)
+	}
+	return SyncResponse(entries, nil)
+}
+
 func setSnapConf(c *Command, r *http.Request, user *auth.UserState) Response {
 	vars := muxVars(r)
 	snapName := configstate.RemapSnapFromRequest(vars["name"])
 
+	var revertTo int
 	var patchValues map[string]interface{}
-	if err := jsonutil.DecodeWithNumber(r.Body, &patchValues); err != nil {
+	if s := r.URL.Query().Get("revert-to"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return BadRequest("invalid configuration history entry %q", s)
+		}
+		revertTo = n
+	} else if err := jsonutil.DecodeWithNumber(r.Body, &patchValues); err != nil {
 		return BadRequest("cannot decode request body into patch values: %v", err)
 	}
 
@@ -1663,17 +1792,36 @@ func setSnapConf(c *Command, r *http.Request, user *auth.UserState) Response {
 	st.Lock()
 	defer st.Unlock()
 
-	taskset, err := configstate.ConfigureInstalled(st, snapName, patchValues, 0)
+	var taskset *state.TaskSet
+	var err error
+	if revertTo != 0 {
+		taskset, err = configstate.RevertConfig(st, snapName, revertTo)
+	} else {
+		taskset, err = configstate.ConfigureInstalled(st, snapName, patchValues, 0)
+	}
 	if err != nil {
 		// TODO: just return snap-not-installed instead ?
 		if _, ok := err.(*snap.NotInstalledError); ok {
 			return SnapNotFound(snapName, err)
 		}
+		if _, ok := err.(*config.ValidationError); ok {
+			return BadRequest("%v", err)
+		}
+		if _, ok := err.(*config.NoHistoryEntryError); ok {
+			return BadRequest("%v", err)
+		}
 		return errToResponse(err, []string{snapName}, InternalError, "%v")
 	}
 
 	summary := fmt.Sprintf("Change configuration of %q snap", snapName)
+	if revertTo != 0 {
+		summary = fmt.Sprintf("Revert configuration of %q snap to history entry %d", snapName, revertTo)
+	}
 	change := newChange(st, "configure-snap", summary, []*state.TaskSet{taskset}, []string{snapName})
+	// recorded in the configuration history
+	if _, uid, _, err := ucrednetGet(r.RemoteAddr); err == nil {
+		change.Set("author-uid", uid)
+	}
 
 	st.EnsureBefore(0)
 
@@ -1880,6 +2028,7 @@ type changeInfo struct {
 
 	SpawnTime time.Time  `json:"spawn-time,omitempty"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
+	NotBefore *time.Time `json:"not-before,omitempty"`
 
 	Data map[string]*json.RawMessage `json:"data,omitempty"`
 }
@@ -1917,6 +2066,10 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 	if !readyTime.IsZero() {
 		chgInfo.ReadyTime = &readyTime
 	}
+	notBefore := chg.NotBefore()
+	if !notBefore.IsZero() {
+		chgInfo.NotBefore = &notBefore
+	}
 	if err := chg.Err(); err != nil {
 		chgInfo.Err = err.Error()
 	}
@@ -1969,62 +2122,42 @@ func getChange(c *Command, r *http.Request, user *auth.UserState) Response {
 }
 
 func getChanges(c *Command, r *http.Request, user *auth.UserState) Response {
-	query := r.URL.Query()
-	qselect := query.Get("select")
-	if qselect == "" {
-		qselect = "in-progress"
-	}
-	var filter func(*state.Change) bool
-	switch qselect {
-	case "all":
-		filter = func(*state.Change) bool { return true }
-	case "in-progress":
-		filter = func(chg *state.Change) bool { return !chg.Status().Ready() }
-	case "ready":
-		filter = func(chg *state.Change) bool { return chg.Status().Ready() }
-	default:
-		return BadRequest("select should be one of: all,in-progress,ready")
-	}
-
-	if wantedName := query.Get("for"); wantedName != "" {
-		outerFilter := filter
-		filter = func(chg *state.Change) bool {
-			if !outerFilter(chg) {
-				return false
-			}
-
-			var snapNames []string
-			if err := chg.Get("snap-names", &snapNames); err != nil {
-				logger.Noticef("Cannot get snap-name for change %v", chg.ID())
-				return false
-			}
-
-			for _, name := range snapNames {
-				// due to
-				// https://bugs.launchpad.net/snapd/+bug/1880560
-				// the snap-names in service-control changes
-				// could have included <snap>.<app>
-				snapName, _ := snap.SplitSnapApp(name)
-				if snapName == wantedName {
-					return true
-				}
-			}
-			return false
-		}
+	q, rsp := parseChangesQuery(r.URL.Query())
+	if rsp != nil {
+		return rsp
 	}
 
 	state := c.d.overlord.State()
 	state.Lock()
-	defer state.Unlock()
 	chgs := state.Changes()
-	chgInfos := make([]*changeInfo, 0, len(chgs))
+	cands := make([]*changeCandidate, 0, len(chgs))
 	for _, chg := range chgs {
-		if !filter(chg) {
-			continue
+		cands = append(cands, liveChangeCandidate(chg))
+	}
+	state.Unlock()
+
+	if q.archived {
+		recs, err := changearchive.Read()
+		if err != nil {
+			return InternalError("cannot read archived changes: %v", err)
+		}
+		live := make(map[string]bool, len(cands))
+		for _, cand := range cands {
+			live[cand.info.ID] = true
+		}
+		for _, rec := range recs {
+			if !live[rec.ID] {
+				cands = append(cands, archivedChangeCandidate(rec))
+			}
 		}
-		chgInfos = append(chgInfos, change2changeInfo(chg))
 	}
-	return SyncResponse(chgInfos, nil)
+
+	chgInfos, next := q.page(cands)
+	var meta *Meta
+	if next != "" {
+		meta = &Meta{NextCursor: next}
+	}
+	return SyncResponse(chgInfos, meta)
 }
 
 func abortChange(c *Command, r *http.Request, user *auth.UserState) Response {
@@ -2355,7 +2488,24 @@ func getAppsInfo(c *Command, r *http.Request, user *auth.UserState) Response {
 		return rsp
 	}
 
-	sd := servicestate.NewStatusDecorator(progress.Null)
+	st := c.d.overlord.State()
+	st.Lock()
+	appHealths, err := healthstate.AllApps(st)
+	if err != nil {
+		st.Unlock()
+		return InternalError("%v", err)
+	}
+	restarts, err := servicestate.AllServiceRestarts(st)
+	st.Unlock()
+	if err != nil {
+		return InternalError("%v", err)
+	}
+
+	sd := &serviceStateDecorator{
+		StatusDecorator: servicestate.NewStatusDecorator(progress.Null),
+		health:          appHealths,
+		restarts:        restarts,
+	}
 
 	clientAppInfos, err := clientutil.ClientAppInfosFromSnapAppInfos(appInfos, sd)
 	if err != nil {
@@ -0,0 +1,391 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/changearchive"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
+)
+
+var timeNow = time.Now
+
+// changeSchedule holds the optional constraints on when a change
+// submitted through the API is allowed to start.
+type changeSchedule struct {
+	// NotBefore is the earliest time the change may start.
+	NotBefore *time.Time `json:"not-before,omitempty"`
+	// Window is a schedule, in the same format as refresh.timer, of
+	// the maintenance windows the change may start in.
+	Window string `json:"window,omitempty"`
+}
+
+// start returns the time the change is allowed to start at, or the zero
+// time if it can start right away.
+func (sched *changeSchedule) start() (time.Time, error) {
+	now := timeNow()
+	start := now
+	if sched.NotBefore != nil && sched.NotBefore.After(start) {
+		start = *sched.NotBefore
+	}
+	if sched.Window != "" {
+		schedule, err := timeutil.ParseSchedule(sched.Window)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot parse window: %v", err)
+		}
+		start = timeutil.WindowStart(schedule, start)
+		if start.IsZero() {
+			return time.Time{}, fmt.Errorf("cannot find the start of window %q within a year", sched.Window)
+		}
+	}
+	if !start.After(now) {
+		return time.Time{}, nil
+	}
+	return start, nil
+}
+
+// changesQuery holds the filtering, sorting and pagination
+// parameters of a GET /v2/changes request.
+type changesQuery struct {
+	selector string
+	snapName string
+	kinds    []string
+	statuses []string
+	taskKind string
+	since    time.Time
+	until    time.Time
+	sort     string
+	limit    int
+	after    *changesCursor
+	archived bool
+}
+
+// changesCursor points right after the last change returned in a page
+// of changes; it is handed out to clients as an opaque string.
+type changesCursor struct {
+	Sort      string     `json:"sort"`
+	ID        string     `json:"id"`
+	SpawnTime time.Time  `json:"spawn-time"`
+	ReadyTime *time.Time `json:"ready-time,omitempty"`
+}
+
+func (cur *changesCursor) String() string {
+	b, err := json.Marshal(cur)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseChangesCursor(s string) (*changesCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cur changesCursor
+	if err := json.Unmarshal(b, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+var changesSortOrders = []string{"spawn-time", "-spawn-time", "ready-time", "-ready-time"}
+
+func parseChangesQuery(query url.Values) (*changesQuery, Response) {
+	q := &changesQuery{
+		selector: query.Get("select"),
+		snapName: query.Get("for"),
+		kinds:    strutil.CommaSeparatedList(query.Get("kind")),
+		taskKind: query.Get("task-kind"),
+		sort:     query.Get("sort"),
+	}
+
+	switch q.selector {
+	case "":
+		q.selector = "in-progress"
+	case "all", "in-progress", "ready":
+		// ok
+	default:
+		return nil, BadRequest("select should be one of: all,in-progress,ready")
+	}
+
+	for _, s := range strutil.CommaSeparatedList(query.Get("status")) {
+		found := false
+		for st := state.DefaultStatus; st <= state.ErrorStatus; st++ {
+			if strings.EqualFold(s, st.String()) {
+				q.statuses = append(q.statuses, st.String())
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, BadRequest("invalid status %q", s)
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.since}, {"until", &q.until}} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, BadRequest("invalid value for %s: %q: %v", p.name, s, err)
+		}
+		*p.t = t
+	}
+
+	if q.sort == "" {
+		q.sort = "spawn-time"
+	} else if !strutil.ListContains(changesSortOrders, q.sort) {
+		return nil, BadRequest("sort should be one of: %s", strings.Join(changesSortOrders, ","))
+	}
+
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, BadRequest("invalid value for limit: %q", s)
+		}
+		q.limit = n
+	}
+
+	if s := query.Get("after"); s != "" {
+		cur, err := parseChangesCursor(s)
+		if err != nil {
+			return nil, BadRequest("invalid cursor %q", s)
+		}
+		if cur.Sort != q.sort {
+			return nil, BadRequest("cursor %q cannot be used with sort %q", s, q.sort)
+		}
+		q.after = cur
+	}
+
+	if s := query.Get("archived"); s != "" {
+		archived, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, BadRequest("invalid value for archived: %q: %v", s, err)
+		}
+		q.archived = archived
+	}
+
+	return q, nil
+}
+
+// changeCandidate is a change, live or archived, considered for a
+// GET /v2/changes response.
+type changeCandidate struct {
+	info      *changeInfo
+	snapNames []string
+}
+
+func liveChangeCandidate(chg *state.Change) *changeCandidate {
+	var snapNames []string
+	// errors are ignored, not all changes have snap-names
+	chg.Get("snap-names", &snapNames)
+	return &changeCandidate{
+		info:      change2changeInfo(chg),
+		snapNames: snapNames,
+	}
+}
+
+func archivedChangeCandidate(rec *changearchive.Record) *changeCandidate {
+	info := &changeInfo{
+		ID:        rec.ID,
+		Kind:      rec.Kind,
+		Summary:   rec.Summary,
+		Status:    rec.Status,
+		Ready:     rec.ReadyTime != nil,
+		Err:       rec.Err,
+		SpawnTime: rec.SpawnTime,
+		ReadyTime: rec.ReadyTime,
+		Data:      rec.Data,
+	}
+	info.Tasks = make([]*taskInfo, len(rec.Tasks))
+	for i, t := range rec.Tasks {
+		info.Tasks[i] = &taskInfo{
+			ID:        t.ID,
+			Kind:      t.Kind,
+			Summary:   t.Summary,
+			Status:    t.Status,
+			Log:       t.Log,
+			SpawnTime: t.SpawnTime,
+			ReadyTime: t.ReadyTime,
+		}
+	}
+	return &changeCandidate{
+		info:      info,
+		snapNames: rec.SnapNames,
+	}
+}
+
+func (q *changesQuery) matches(cand *changeCandidate) bool {
+	info := cand.info
+	switch q.selector {
+	case "in-progress":
+		if info.Ready {
+			return false
+		}
+	case "ready":
+		if !info.Ready {
+			return false
+		}
+	}
+
+	if q.snapName != "" {
+		found := false
+		for _, name := range cand.snapNames {
+			// due to
+			// https://bugs.launchpad.net/snapd/+bug/1880560
+			// the snap-names in service-control changes
+			// could have included <snap>.<app>
+			snapName, _ := snap.SplitSnapApp(name)
+			if snapName == q.snapName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(q.kinds) > 0 && !strutil.ListContains(q.kinds, info.Kind) {
+		return false
+	}
+	if len(q.statuses) > 0 && !strutil.ListContains(q.statuses, info.Status) {
+		return false
+	}
+	if q.taskKind != "" {
+		found := false
+		for _, t := range info.Tasks {
+			if t.Kind == q.taskKind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !q.since.IsZero() && info.SpawnTime.Before(q.since) {
+		return false
+	}
+	if !q.until.IsZero() && !info.SpawnTime.Before(q.until) {
+		return false
+	}
+	return true
+}
+
+// compareChangeIDs compares the numeric change IDs a and b.
+func compareChangeIDs(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// compareChanges compares the changes described by the given sort
+// keys in the given sort order. Ties are broken by change ID. When
+// sorting by ready time, changes that are not ready yet sort last.
+func compareChanges(order, idA string, spawnA time.Time, readyA *time.Time, idB string, spawnB time.Time, readyB *time.Time) int {
+	var cmp int
+	switch strings.TrimPrefix(order, "-") {
+	case "spawn-time":
+		cmp = compareTimes(spawnA, spawnB)
+	case "ready-time":
+		switch {
+		case readyA == nil && readyB == nil:
+			cmp = 0
+		case readyA == nil:
+			cmp = 1
+		case readyB == nil:
+			cmp = -1
+		default:
+			cmp = compareTimes(*readyA, *readyB)
+		}
+	}
+	if cmp == 0 {
+		cmp = compareChangeIDs(idA, idB)
+	}
+	if strings.HasPrefix(order, "-") {
+		cmp = -cmp
+	}
+	return cmp
+}
+
+// page sorts and filters the given candidates according to the query,
+// returning the resulting page of changes together with the cursor for
+// the next page, if any.
+func (q *changesQuery) page(cands []*changeCandidate) (infos []*changeInfo, next string) {
+	sort.Slice(cands, func(i, j int) bool {
+		a, b := cands[i].info, cands[j].info
+		return compareChanges(q.sort, a.ID, a.SpawnTime, a.ReadyTime, b.ID, b.SpawnTime, b.ReadyTime) < 0
+	})
+
+	infos = make([]*changeInfo, 0, len(cands))
+	for _, cand := range cands {
+		info := cand.info
+		if !q.matches(cand) {
+			continue
+		}
+		if q.after != nil && compareChanges(q.sort, info.ID, info.SpawnTime, info.ReadyTime, q.after.ID, q.after.SpawnTime, q.after.ReadyTime) <= 0 {
+			continue
+		}
+		if q.limit > 0 && len(infos) == q.limit {
+			last := infos[len(infos)-1]
+			next = (&changesCursor{
+				Sort:      q.sort,
+				ID:        last.ID,
+				SpawnTime: last.SpawnTime,
+				ReadyTime: last.ReadyTime,
+			}).String()
+			break
+		}
+		infos = append(infos, info)
+	}
+	return infos, next
+}
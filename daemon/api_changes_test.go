@@ -0,0 +1,338 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/changearchive"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// setupTimedChanges adds a change per given kind, spawned an hour
+// apart starting at base; changes of kind "remove" are made to fail.
+func setupTimedChanges(st *state.State, base time.Time, kinds ...string) []*state.Change {
+	chgs := make([]*state.Change, len(kinds))
+	for i, kind := range kinds {
+		restore := state.MockTime(base.Add(time.Duration(i) * time.Hour))
+		chg := st.NewChange(kind, kind+"...")
+		chg.Set("snap-names", []string{fmt.Sprintf("snap-%d", i)})
+		t := st.NewTask(kind+"-task", "...")
+		chg.AddTask(t)
+		if kind == "remove" {
+			t.SetStatus(state.ErrorStatus)
+		}
+		restore()
+		chgs[i] = chg
+	}
+	return chgs
+}
+
+func (s *apiSuite) getChangesInfo(c *check.C, query string) ([]*changeInfo, string) {
+	req, err := http.NewRequest("GET", "/v2/changes?"+query, nil)
+	c.Assert(err, check.IsNil)
+	rsp := getChanges(stateChangesCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, 200, check.Commentf("%v", rsp.Result))
+	c.Assert(rsp.Result, check.FitsTypeOf, []*changeInfo(nil))
+
+	var next string
+	if rsp.Meta != nil {
+		next = rsp.Meta.NextCursor
+	}
+	return rsp.Result.([]*changeInfo), next
+}
+
+func changeIDs(infos []*changeInfo) []string {
+	ids := make([]string, len(infos))
+	for i, info := range infos {
+		ids[i] = info.ID
+	}
+	return ids
+}
+
+func (s *apiSuite) TestStateChangesFilters(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	base := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	st.Lock()
+	chgs := setupTimedChanges(st, base, "install", "remove", "refresh", "install")
+	st.Unlock()
+
+	for _, t := range []struct {
+		query string
+		ids   []*state.Change
+	}{
+		{"select=all", chgs},
+		{"select=all&kind=install", []*state.Change{chgs[0], chgs[3]}},
+		{"select=all&kind=install,refresh", []*state.Change{chgs[0], chgs[2], chgs[3]}},
+		{"select=all&status=error", []*state.Change{chgs[1]}},
+		{"select=all&status=Do,Error", chgs},
+		{"select=all&task-kind=refresh-task", []*state.Change{chgs[2]}},
+		{"select=all&since=2020-10-01T11:00:00Z", chgs[1:]},
+		{"select=all&until=2020-10-01T11:00:00Z", chgs[:1]},
+		{"select=all&since=2020-10-01T10:30:00Z&until=2020-10-01T12:30:00Z", chgs[1:3]},
+		{"select=in-progress&kind=install&for=snap-3", chgs[3:]},
+		{"select=ready&kind=install", nil},
+	} {
+		infos, next := s.getChangesInfo(c, t.query)
+		expected := make([]string, len(t.ids))
+		for i, chg := range t.ids {
+			expected[i] = chg.ID()
+		}
+		c.Check(changeIDs(infos), check.DeepEquals, expected, check.Commentf(t.query))
+		c.Check(next, check.Equals, "")
+	}
+}
+
+func (s *apiSuite) TestStateChangesSortAndPaginate(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	base := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	st.Lock()
+	chgs := setupTimedChanges(st, base, "install", "install", "install", "install", "install")
+	// same spawn time as the previous change, ties are broken by id
+	restore := state.MockTime(base.Add(4 * time.Hour))
+	chgs = append(chgs, st.NewChange("install", "..."))
+	restore()
+	st.Unlock()
+
+	var ids []string
+	for _, chg := range chgs {
+		ids = append(ids, chg.ID())
+	}
+	reversed := make([]string, len(ids))
+	for i, id := range ids {
+		reversed[len(ids)-i-1] = id
+	}
+
+	for _, t := range []struct {
+		sort     string
+		expected []string
+	}{
+		{"", ids},
+		{"spawn-time", ids},
+		{"-spawn-time", reversed},
+	} {
+		var got []string
+		query := "select=all&limit=4&sort=" + t.sort
+		infos, next := s.getChangesInfo(c, query)
+		c.Check(infos, check.HasLen, 4)
+		got = append(got, changeIDs(infos)...)
+		c.Assert(next, check.Not(check.Equals), "")
+
+		infos, next = s.getChangesInfo(c, query+"&after="+next)
+		c.Check(infos, check.HasLen, 2)
+		got = append(got, changeIDs(infos)...)
+		c.Check(next, check.Equals, "")
+
+		c.Check(got, check.DeepEquals, t.expected, check.Commentf(t.sort))
+	}
+}
+
+func (s *apiSuite) TestStateChangesSortByReadyTime(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	base := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	st.Lock()
+	chgs := setupTimedChanges(st, base, "install", "refresh", "remove")
+	// the refresh becomes ready after the remove
+	restore := state.MockTime(base.Add(5 * time.Hour))
+	chgs[1].Tasks()[0].SetStatus(state.DoneStatus)
+	restore()
+	st.Unlock()
+
+	infos, _ := s.getChangesInfo(c, "select=all&sort=ready-time")
+	// not ready changes sort last
+	c.Check(changeIDs(infos), check.DeepEquals, []string{chgs[2].ID(), chgs[1].ID(), chgs[0].ID()})
+
+	infos, _ = s.getChangesInfo(c, "select=all&sort=-ready-time")
+	c.Check(changeIDs(infos), check.DeepEquals, []string{chgs[0].ID(), chgs[1].ID(), chgs[2].ID()})
+}
+
+func (s *apiSuite) TestStateChangesArchived(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	base := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	st.Lock()
+	chgs := setupTimedChanges(st, base, "remove", "install", "install")
+	// archive and prune the first change, the second one is both
+	// archived and live
+	c.Assert(changearchive.Append(chgs[0]), check.IsNil)
+	c.Assert(changearchive.Append(chgs[1]), check.IsNil)
+	st.Prune(time.Now(), time.Hour, time.Hour, 100)
+	c.Assert(st.Change(chgs[0].ID()), check.IsNil)
+	st.Unlock()
+
+	infos, _ := s.getChangesInfo(c, "select=all")
+	c.Check(changeIDs(infos), check.DeepEquals, []string{chgs[1].ID(), chgs[2].ID()})
+
+	infos, _ = s.getChangesInfo(c, "select=all&archived=true")
+	c.Check(changeIDs(infos), check.DeepEquals, []string{chgs[0].ID(), chgs[1].ID(), chgs[2].ID()})
+	// the archived change is as it was when archived
+	c.Check(infos[0].Kind, check.Equals, "remove")
+	c.Check(infos[0].Status, check.Equals, "Error")
+	c.Check(infos[0].Ready, check.Equals, true)
+	c.Check(infos[0].SpawnTime.Equal(base), check.Equals, true)
+	c.Assert(infos[0].Tasks, check.HasLen, 1)
+	c.Check(infos[0].Tasks[0].Kind, check.Equals, "remove-task")
+
+	infos, _ = s.getChangesInfo(c, "select=all&archived=true&kind=remove&for=snap-0")
+	c.Check(changeIDs(infos), check.DeepEquals, []string{chgs[0].ID()})
+}
+
+func (s *apiSuite) TestStateChangesBadQuery(c *check.C) {
+	s.daemon(c)
+
+	cursor := (&changesCursor{Sort: "-spawn-time", ID: "1"}).String()
+	for _, t := range []struct {
+		query string
+		err   string
+	}{
+		{"select=foo", `select should be one of: all,in-progress,ready`},
+		{"status=foo", `invalid status "foo"`},
+		{"since=yesterday", `invalid value for since: "yesterday": .*`},
+		{"until=2020-10-01", `invalid value for until: "2020-10-01": .*`},
+		{"sort=name", `sort should be one of: spawn-time,-spawn-time,ready-time,-ready-time`},
+		{"limit=0", `invalid value for limit: "0"`},
+		{"limit=many", `invalid value for limit: "many"`},
+		{"after=!!", `invalid cursor "!!"`},
+		{"after=" + cursor, `cursor ".*" cannot be used with sort "spawn-time"`},
+		{"archived=maybe", `invalid value for archived: "maybe": .*`},
+	} {
+		req, err := http.NewRequest("GET", "/v2/changes?"+t.query, nil)
+		c.Assert(err, check.IsNil)
+		rsp := getChanges(stateChangesCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf(t.query))
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, t.err, check.Commentf(t.query))
+	}
+}
+
+func (s *apiSuite) TestChangeScheduleStart(c *check.C) {
+	now := time.Date(2020, 3, 2, 12, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	later := now.Add(5 * time.Hour)
+	earlier := now.Add(-5 * time.Hour)
+	for _, t := range []struct {
+		sched changeSchedule
+		start time.Time
+	}{
+		{changeSchedule{}, time.Time{}},
+		{changeSchedule{NotBefore: &earlier}, time.Time{}},
+		{changeSchedule{NotBefore: &later}, later},
+		// currently inside the window
+		{changeSchedule{Window: "11:00-13:00"}, time.Time{}},
+		{changeSchedule{Window: "02:00-04:00"}, time.Date(2020, 3, 3, 2, 0, 0, 0, time.Local)},
+		{changeSchedule{NotBefore: &later, Window: "16:00-18:00"}, time.Date(2020, 3, 2, 17, 0, 0, 0, time.Local)},
+		{changeSchedule{NotBefore: &later, Window: "13:00-14:00"}, time.Date(2020, 3, 3, 13, 0, 0, 0, time.Local)},
+	} {
+		start, err := t.sched.start()
+		c.Assert(err, check.IsNil)
+		c.Check(start.Equal(t.start), check.Equals, true, check.Commentf("%+v: %v", t.sched, start))
+	}
+
+	_, err := (&changeSchedule{Window: "25:00-26:00"}).start()
+	c.Check(err, check.ErrorMatches, `cannot parse window: .*`)
+}
+
+func (s *apiSuite) TestPostSnapNotBefore(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	s.vars = map[string]string{"name": "foo"}
+
+	snapInstructionDispTable["install"] = func(inst *snapInstruction, st *state.State) (string, []*state.TaskSet, error) {
+		t := st.NewTask("fake-install-snap", "Doing a fake install")
+		return "foooo", []*state.TaskSet{state.NewTaskSet(t)}, nil
+	}
+	defer func() {
+		snapInstructionDispTable["install"] = snapInstall
+	}()
+
+	notBefore := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "install", "not-before": %q}`, notBefore.Format(time.RFC3339)))
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.NotBefore().Equal(notBefore), check.Equals, true)
+
+	info := change2changeInfo(chg)
+	c.Assert(info.NotBefore, check.NotNil)
+	c.Check(info.NotBefore.Equal(notBefore), check.Equals, true)
+	c.Check(info.Status, check.Equals, "Do")
+}
+
+func (s *apiSuite) TestPostSnapsWindow(c *check.C) {
+	now := time.Date(2020, 3, 2, 12, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	assertstateRefreshSnapDeclarations = func(s *state.State, userID int) error {
+		return nil
+	}
+	snapstateUpdateMany = func(_ context.Context, s *state.State, names []string, userID int, flags *snapstate.Flags) ([]string, []*state.TaskSet, error) {
+		t := s.NewTask("fake-refresh-2", "Refreshing two")
+		return names, []*state.TaskSet{state.NewTaskSet(t)}, nil
+	}
+
+	d := s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "refresh", "snaps": ["foo", "bar"], "window": "02:00-04:00"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.NotBefore().Equal(time.Date(2020, 3, 3, 2, 0, 0, 0, time.Local)), check.Equals, true)
+}
+
+func (s *apiSuite) TestPostSnapsBadWindow(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("POST", "/v2/snaps", strings.NewReader(`{"action": "remove", "snaps": ["foo"], "window": "bogus"}`))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Matches, `cannot parse window: .*`)
+}
@@ -0,0 +1,52 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+// metricsCmd is root only, as the counters are internal, but scrapers can
+// be given access via a token (possibly bound to the certificate they
+// present to the TLS listener).
+var metricsCmd = &Command{
+	Path:     "/v2/metrics",
+	GET:      getMetrics,
+	RootOnly: true,
+	TokenOK:  true,
+}
+
+// metricsResponse writes out the metrics in the OpenMetrics text format.
+type metricsResponse struct{}
+
+func (metricsResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.Write(w); err != nil {
+		logger.Noticef("cannot write metrics: %v", err)
+	}
+}
+
+func getMetrics(c *Command, r *http.Request, user *auth.UserState) Response {
+	return metricsResponse{}
+}
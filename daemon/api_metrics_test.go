@@ -0,0 +1,115 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func (s *apiSuite) TestMetrics(c *check.C) {
+	s.daemon(c)
+
+	req, err := http.NewRequest("GET", "/v2/metrics", nil)
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=0;socket=;"
+
+	rec := httptest.NewRecorder()
+	metricsCmd.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, 200)
+	c.Check(rec.Header().Get("Content-Type"), check.Equals, "application/openmetrics-text; version=1.0.0; charset=utf-8")
+
+	body := rec.Body.String()
+	for _, family := range []string{
+		"snapd_changes counter",
+		"snapd_ensure_seconds histogram",
+		"snapd_state_lock_held_seconds histogram",
+		"snapd_state_size_bytes gauge",
+		"snapd_store_download_bytes counter",
+		"snapd_store_request_errors counter",
+		"snapd_store_request_seconds histogram",
+		"snapd_task_run_seconds histogram",
+	} {
+		c.Check(body, testutil.Contains, "# TYPE "+family+"\n")
+	}
+	c.Check(strings.HasSuffix(body, "\n# EOF\n"), check.Equals, true)
+}
+
+func (s *apiSuite) TestMetricsRootOnly(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	user, err := auth.NewUser(st, "username", "email@test.com", "", nil)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	for _, withUser := range []bool{false, true} {
+		req, err := http.NewRequest("GET", "/v2/metrics", nil)
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = "pid=100;uid=1000;socket=;"
+		if withUser {
+			// logged in with "snap login"
+			req.Header.Set("Authorization", fmt.Sprintf(`Macaroon root="%s"`, user.Macaroon))
+		}
+		rec := httptest.NewRecorder()
+		metricsCmd.ServeHTTP(rec, req)
+		c.Check(rec.Code, check.Equals, 401, check.Commentf("logged in: %v", withUser))
+	}
+}
+
+func (s *apiSuite) TestMetricsWithToken(c *check.C) {
+	d := s.daemon(c)
+
+	st := d.overlord.State()
+	st.Lock()
+	_, token, err := auth.NewToken(st, "", []auth.TokenScope{
+		{Endpoint: "/v2/metrics", Actions: []string{"read"}},
+	}, time.Time{})
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	for _, remoteAddr := range []string{
+		// not a local user, as over the TLS listener
+		"192.0.2.1:4242",
+		// a local user that is not root
+		"pid=100;uid=1000;socket=;",
+	} {
+		for tok, code := range map[string]int{token: 200, "": 401} {
+			req, err := http.NewRequest("GET", "/v2/metrics", nil)
+			c.Assert(err, check.IsNil)
+			req.RemoteAddr = remoteAddr
+			if tok != "" {
+				req.Header.Set("Authorization", "Bearer "+tok)
+			}
+			rec := httptest.NewRecorder()
+			metricsCmd.ServeHTTP(rec, req)
+			c.Check(rec.Code, check.Equals, code, check.Commentf("%s %q", remoteAddr, tok))
+		}
+	}
+}
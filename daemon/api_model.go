@@ -55,6 +55,8 @@ var devicestateRemodel = devicestate.Remodel
 
 type postModelData struct {
 	NewModel string `json:"new-model"`
+	// changeSchedule optionally delays the start of the remodel
+	changeSchedule
 }
 
 type modelAssertJSONResponse struct {
@@ -77,6 +79,10 @@ func postModel(c *Command, r *http.Request, _ *auth.UserState) Response {
 	if !ok {
 		return BadRequest("new model is not a model assertion: %v", newModel.Type())
 	}
+	notBefore, err := data.changeSchedule.start()
+	if err != nil {
+		return BadRequest("%v", err)
+	}
 
 	st := c.d.overlord.State()
 	st.Lock()
@@ -86,6 +92,9 @@ func postModel(c *Command, r *http.Request, _ *auth.UserState) Response {
 	if err != nil {
 		return BadRequest("cannot remodel device: %v", err)
 	}
+	if !notBefore.IsZero() {
+		chg.SetNotBefore(notBefore)
+	}
 	ensureStateSoon(st)
 
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
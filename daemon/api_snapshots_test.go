@@ -65,8 +65,9 @@ func (s *snapshotSuite) TearDownTest(c *check.C) {
 }
 
 func (s *snapshotSuite) TestSnapshotMany(c *check.C) {
-	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string) (uint64, []string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string, opts *snapshotstate.SaveOptions) (uint64, []string, *state.TaskSet, error) {
 		c.Check(snaps, check.HasLen, 2)
+		c.Check(opts.IncludeSecrets, check.Equals, false)
 		t := s.NewTask("fake-snapshot-2", "Snapshot two")
 		return 1, snaps, state.NewTaskSet(t), nil
 	})()
@@ -81,6 +82,21 @@ func (s *snapshotSuite) TestSnapshotMany(c *check.C) {
 	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
 }
 
+func (s *snapshotSuite) TestSnapshotManyIncludeSecrets(c *check.C) {
+	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string, opts *snapshotstate.SaveOptions) (uint64, []string, *state.TaskSet, error) {
+		c.Check(opts.IncludeSecrets, check.Equals, true)
+		t := s.NewTask("fake-snapshot", "Snapshot")
+		return 1, snaps, state.NewTaskSet(t), nil
+	})()
+
+	inst := daemon.MustUnmarshalSnapInstruction(c, `{"action": "snapshot", "snaps": ["foo"], "include-secrets": true}`)
+	st := s.o.State()
+	st.Lock()
+	_, err := daemon.SnapshotMany(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+}
+
 func (s *snapshotSuite) TestListSnapshots(c *check.C) {
 	snapshots := []client.SnapshotSet{{ID: 1}, {ID: 42}}
 
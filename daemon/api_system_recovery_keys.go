@@ -0,0 +1,95 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+var systemRecoveryKeysCmd = &Command{
+	Path:     "/v2/system-recovery-keys",
+	GET:      getSystemRecoveryKeys,
+	POST:     postSystemRecoveryKeys,
+	RootOnly: true,
+}
+
+// wrapped for unit tests
+var (
+	bootRecoveryKey       = boot.RecoveryKey
+	bootRotateRecoveryKey = boot.RotateRecoveryKey
+)
+
+// recoveryKeyRotationLock keeps rotations from racing each other, the state
+// lock is not held as rotating runs cryptsetup on the encrypted devices
+var recoveryKeyRotationLock sync.Mutex
+
+func getSystemRecoveryKeys(c *Command, r *http.Request, user *auth.UserState) Response {
+	rkey, err := bootRecoveryKey()
+	if err == boot.ErrNoRecoveryKey {
+		return NotFound(err.Error())
+	}
+	if err != nil {
+		return InternalError("cannot read recovery key: %v", err)
+	}
+	rsp := client.SystemRecoveryKeysResponse{
+		RecoveryKey: rkey.String(),
+	}
+	return SyncResponse(&rsp, nil)
+}
+
+type systemRecoveryKeysRequest struct {
+	Action string `json:"action"`
+}
+
+func postSystemRecoveryKeys(c *Command, r *http.Request, user *auth.UserState) Response {
+	var req systemRecoveryKeysRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		return BadRequest("cannot decode request body into recovery keys action: %v", err)
+	}
+	if decoder.More() {
+		return BadRequest("extra content found in request body")
+	}
+	if req.Action != "rotate" {
+		return BadRequest("unsupported recovery keys action %q", req.Action)
+	}
+
+	recoveryKeyRotationLock.Lock()
+	defer recoveryKeyRotationLock.Unlock()
+
+	rkey, err := bootRotateRecoveryKey()
+	if err == boot.ErrNoRecoveryKey {
+		return NotFound(err.Error())
+	}
+	if err != nil {
+		return InternalError("cannot rotate recovery key: %v", err)
+	}
+	rsp := client.SystemRecoveryKeysResponse{
+		RecoveryKey: rkey.String(),
+	}
+	return SyncResponse(&rsp, nil)
+}
@@ -0,0 +1,150 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/secboot"
+)
+
+var mockRecoveryKey = secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+func (s *apiSuite) serveRecoveryKeys(c *check.C, method, body, uid string) (code int, result map[string]interface{}) {
+	req, err := http.NewRequest(method, "/v2/system-recovery-keys", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=%s;socket=;", uid)
+
+	rec := httptest.NewRecorder()
+	systemRecoveryKeysCmd.ServeHTTP(rec, req)
+	var rsp map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
+	result, _ = rsp["result"].(map[string]interface{})
+	return rec.Code, result
+}
+
+func (s *apiSuite) TestSystemRecoveryKeysNeedsRoot(c *check.C) {
+	s.daemon(c)
+	restore := MockBootRecoveryKey(func() (secboot.RecoveryKey, error) {
+		c.Fatalf("unexpected call")
+		return secboot.RecoveryKey{}, nil
+	})
+	defer restore()
+	restore = MockBootRotateRecoveryKey(func() (secboot.RecoveryKey, error) {
+		c.Fatalf("unexpected call")
+		return secboot.RecoveryKey{}, nil
+	})
+	defer restore()
+
+	code, _ := s.serveRecoveryKeys(c, "GET", "", "1000")
+	c.Check(code, check.Equals, 401)
+	code, _ = s.serveRecoveryKeys(c, "POST", `{"action":"rotate"}`, "1000")
+	c.Check(code, check.Equals, 401)
+}
+
+func (s *apiSuite) TestSystemRecoveryKeysGet(c *check.C) {
+	s.daemon(c)
+	restore := MockBootRecoveryKey(func() (secboot.RecoveryKey, error) {
+		return mockRecoveryKey, nil
+	})
+	defer restore()
+
+	code, result := s.serveRecoveryKeys(c, "GET", "", "0")
+	c.Check(code, check.Equals, 200)
+	c.Check(result, check.DeepEquals, map[string]interface{}{
+		"recovery-key": "00256-00770-01284-01798-02312-02826-03340-03854",
+	})
+}
+
+func (s *apiSuite) TestSystemRecoveryKeysGetErrors(c *check.C) {
+	s.daemon(c)
+
+	for _, tc := range []struct {
+		err  error
+		code int
+		msg  string
+	}{
+		{boot.ErrNoRecoveryKey, 404, "no recovery key: system is not encrypted"},
+		{fmt.Errorf("boom"), 500, "cannot read recovery key: boom"},
+	} {
+		restore := MockBootRecoveryKey(func() (secboot.RecoveryKey, error) {
+			return secboot.RecoveryKey{}, tc.err
+		})
+		defer restore()
+
+		code, result := s.serveRecoveryKeys(c, "GET", "", "0")
+		c.Check(code, check.Equals, tc.code)
+		c.Check(result["message"], check.Equals, tc.msg)
+	}
+}
+
+func (s *apiSuite) TestSystemRecoveryKeysRotate(c *check.C) {
+	d := s.daemon(c)
+	called := 0
+	restore := MockBootRotateRecoveryKey(func() (secboot.RecoveryKey, error) {
+		called++
+		// the state is not locked while cryptsetup runs
+		st := d.overlord.State()
+		st.Lock()
+		st.Unlock()
+		return mockRecoveryKey, nil
+	})
+	defer restore()
+
+	code, result := s.serveRecoveryKeys(c, "POST", `{"action":"rotate"}`, "0")
+	c.Check(code, check.Equals, 200)
+	c.Check(called, check.Equals, 1)
+	c.Check(result, check.DeepEquals, map[string]interface{}{
+		"recovery-key": "00256-00770-01284-01798-02312-02826-03340-03854",
+	})
+}
+
+func (s *apiSuite) TestSystemRecoveryKeysRotateErrors(c *check.C) {
+	s.daemon(c)
+
+	for _, tc := range []struct {
+		body string
+		err  error
+		code int
+		msg  string
+	}{
+		{`{"action":"rotate"}`, boot.ErrNoRecoveryKey, 404, "no recovery key: system is not encrypted"},
+		{`{"action":"rotate"}`, fmt.Errorf("boom"), 500, "cannot rotate recovery key: boom"},
+		{`{"action":"foo"}`, nil, 400, `unsupported recovery keys action "foo"`},
+		{`{"action":"rotate"}{}`, nil, 400, "extra content found in request body"},
+		{`{`, nil, 400, "cannot decode request body into recovery keys action: unexpected EOF"},
+	} {
+		restore := MockBootRotateRecoveryKey(func() (secboot.RecoveryKey, error) {
+			return secboot.RecoveryKey{}, tc.err
+		})
+		defer restore()
+
+		code, result := s.serveRecoveryKeys(c, "POST", tc.body, "0")
+		c.Check(code, check.Equals, tc.code, check.Commentf(tc.body))
+		c.Check(result["message"], check.Equals, tc.msg)
+	}
+}
@@ -3492,6 +3492,36 @@ func (s *apiSuite) TestGetRootDocument(c *check.C) {
 	c.Check(result, check.DeepEquals, map[string]interface{}{"test-key1": "test-value1", "test-key2": "test-value2"})
 }
 
+func (s *apiSuite) TestGetConfSecretRedacted(c *check.C) {
+	d := s.daemon(c)
+	d.overlord.State().Lock()
+	tr := config.NewTransaction(d.overlord.State())
+	tr.Set("test-snap", "test-key1", "test-value1")
+	tr.Set("test-snap", "token", "s3cr3t")
+	c.Assert(tr.MarkSecret("test-snap", "token"), check.IsNil)
+	tr.Commit()
+	d.overlord.State().Unlock()
+
+	for _, t := range []struct {
+		remoteAddr string
+		token      string
+	}{
+		{"", "*****"},
+		{"pid=100;uid=1000;socket=;", "*****"},
+		{"pid=100;uid=0;socket=;", "s3cr3t"},
+	} {
+		for _, keys := range []string{"", "token,test-key1"} {
+			s.vars = map[string]string{"name": "test-snap"}
+			req, err := http.NewRequest("GET", "/v2/snaps/test-snap/conf?keys="+keys, nil)
+			c.Assert(err, check.IsNil)
+			req.RemoteAddr = t.remoteAddr
+			rsp := getSnapConf(snapConfCmd, req, nil).(*resp)
+			c.Assert(rsp.Status, check.Equals, 200)
+			c.Check(rsp.Result, check.DeepEquals, map[string]interface{}{"test-key1": "test-value1", "token": t.token})
+		}
+	}
+}
+
 func (s *apiSuite) TestGetConfBadKey(c *check.C) {
 	s.daemon(c)
 	// TODO: this one in particular should really be a 400 also
@@ -3675,6 +3705,256 @@ func (s *apiSuite) TestSetConfBadSnap(c *check.C) {
 		"type": "error"})
 }
 
+const configSchemaJSON = `{
+  "type": "object",
+  "properties": {
+    "port": {"type": "integer", "minimum": 1, "maximum": 65535},
+    "mode": {"type": "string", "enum": ["fast", "slow"]}
+  }
+}`
+
+func (s *apiSuite) mockSnapWithConfigSchema(c *check.C) {
+	info := s.mockSnap(c, configYaml)
+	schemaFile := filepath.Join(info.MountDir(), "meta", "config-schema.json")
+	c.Assert(ioutil.WriteFile(schemaFile, []byte(configSchemaJSON), 0644), check.IsNil)
+}
+
+func (s *apiSuite) runGetConfSchema(c *check.C, snapName string, keys []string, statusCode int) map[string]interface{} {
+	s.vars = map[string]string{"name": snapName}
+	req, err := http.NewRequest("GET", "/v2/snaps/"+snapName+"/conf?schema=true&keys="+strings.Join(keys, ","), nil)
+	c.Check(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	snapConfCmd.GET(snapConfCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, statusCode)
+
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Check(err, check.IsNil)
+	return body["result"].(map[string]interface{})
+}
+
+func (s *apiSuite) TestGetConfSchema(c *check.C) {
+	s.daemon(c)
+	s.mockSnapWithConfigSchema(c)
+
+	result := s.runGetConfSchema(c, "config-snap", nil, 200)
+	c.Check(result["type"], check.Equals, "object")
+	c.Check(result["properties"], check.HasLen, 2)
+
+	result = s.runGetConfSchema(c, "config-snap", []string{"mode"}, 200)
+	c.Check(result, check.DeepEquals, map[string]interface{}{
+		"mode": map[string]interface{}{
+			"type": "string",
+			"enum": []interface{}{"fast", "slow"},
+		},
+	})
+
+	result = s.runGetConfSchema(c, "config-snap", []string{"other"}, 404)
+	c.Check(result["message"], check.Equals, `option "other" is not described by the configuration schema of snap "config-snap"`)
+}
+
+func (s *apiSuite) TestGetConfSchemaNoSchema(c *check.C) {
+	s.daemon(c)
+	s.mockSnap(c, configYaml)
+
+	result := s.runGetConfSchema(c, "config-snap", nil, 404)
+	c.Check(result["message"], check.Equals, `snap "config-snap" has no configuration schema`)
+}
+
+func (s *apiSuite) TestGetConfSchemaBadSnap(c *check.C) {
+	s.daemon(c)
+
+	result := s.runGetConfSchema(c, "config-snap", nil, 404)
+	c.Check(result["kind"], check.Equals, "snap-not-found")
+}
+
+func (s *apiSuite) TestSetConfSchemaViolation(c *check.C) {
+	s.daemon(c)
+	s.mockSnapWithConfigSchema(c)
+
+	text, err := json.Marshal(map[string]interface{}{"port": 70000})
+	c.Assert(err, check.IsNil)
+
+	buffer := bytes.NewBuffer(text)
+	req, err := http.NewRequest("PUT", "/v2/snaps/config-snap/conf", buffer)
+	c.Assert(err, check.IsNil)
+
+	s.vars = map[string]string{"name": "config-snap"}
+
+	rec := httptest.NewRecorder()
+	snapConfCmd.PUT(snapConfCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 400)
+
+	var body map[string]interface{}
+	err = json.Unmarshal(rec.Body.Bytes(), &body)
+	c.Assert(err, check.IsNil)
+	c.Check(body["result"], check.DeepEquals, map[string]interface{}{
+		"message": `invalid configuration for "port": must be at most 65535`,
+	})
+}
+
+func (s *apiSuite) TestGetConfHistory(c *check.C) {
+	d := s.daemon(c)
+	s.mockSnap(c, configYaml)
+
+	st := d.overlord.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("config-snap", "foo", "a")
+	tr.Commit()
+	tr = config.NewTransaction(st)
+	tr.SetChangeID("42")
+	tr.SetAuthor(1000)
+	tr.Set("config-snap", "foo", "b")
+	tr.Commit()
+	st.Unlock()
+
+	s.vars = map[string]string{"name": "config-snap"}
+	req, err := http.NewRequest("GET", "/v2/snaps/config-snap/conf?history=true", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getSnapConf(snapConfCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	entries := rsp.Result.([]*config.HistoryEntry)
+	c.Assert(entries, check.HasLen, 2)
+	c.Check(entries[0].ID, check.Equals, 1)
+	c.Check(string(*entries[0].Config["foo"]), check.Equals, `"a"`)
+	c.Check(entries[1].ID, check.Equals, 2)
+	c.Check(entries[1].ChangeID, check.Equals, "42")
+	c.Check(*entries[1].UID, check.Equals, uint32(1000))
+	c.Check(string(*entries[1].Config["foo"]), check.Equals, `"b"`)
+}
+
+func (s *apiSuite) TestGetConfHistorySecretRedacted(c *check.C) {
+	d := s.daemon(c)
+	s.mockSnap(c, configYaml)
+
+	st := d.overlord.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("config-snap", "password", "pw")
+	c.Assert(tr.MarkSecret("config-snap", "password"), check.IsNil)
+	c.Assert(tr.Commit(), check.IsNil)
+	// an entry recorded before the option became secret
+	password := json.RawMessage(`"pw"`)
+	foo := json.RawMessage(`"a"`)
+	st.Set("config-history", map[string][]*config.HistoryEntry{
+		"config-snap": {{ID: 1, Config: map[string]*json.RawMessage{"password": &password, "foo": &foo}}},
+	})
+	st.Unlock()
+
+	for _, t := range []struct {
+		remoteAddr string
+		password   string
+	}{
+		{"", `"*****"`},
+		{"pid=100;uid=1000;socket=;", `"*****"`},
+		{"pid=100;uid=0;socket=;", `"pw"`},
+	} {
+		s.vars = map[string]string{"name": "config-snap"}
+		req, err := http.NewRequest("GET", "/v2/snaps/config-snap/conf?history=true", nil)
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = t.remoteAddr
+		rsp := getSnapConf(snapConfCmd, req, nil).(*resp)
+		c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+		entries := rsp.Result.([]*config.HistoryEntry)
+		c.Assert(entries, check.HasLen, 1)
+		c.Check(string(*entries[0].Config["password"]), check.Equals, t.password)
+		c.Check(string(*entries[0].Config["foo"]), check.Equals, `"a"`)
+	}
+}
+
+func (s *apiSuite) TestGetConfHistoryEmpty(c *check.C) {
+	s.daemon(c)
+	s.mockSnap(c, configYaml)
+
+	s.vars = map[string]string{"name": "config-snap"}
+	req, err := http.NewRequest("GET", "/v2/snaps/config-snap/conf?history=true", nil)
+	c.Assert(err, check.IsNil)
+	rsp := getSnapConf(snapConfCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, []*config.HistoryEntry{})
+}
+
+func (s *apiSuite) mockConfigSnapState(st *state.State) {
+	st.Lock()
+	defer st.Unlock()
+	snapstate.Set(st, "config-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "config-snap", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+}
+
+func (s *apiSuite) TestSetConfRevertTo(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	st := d.overlord.State()
+	s.mockConfigSnapState(st)
+
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("config-snap", "foo", "a")
+	tr.Commit()
+	tr = config.NewTransaction(st)
+	tr.Set("config-snap", "foo", "b")
+	tr.Set("config-snap", "bar", 1)
+	tr.Commit()
+	st.Unlock()
+
+	req, err := http.NewRequest("PUT", "/v2/snaps/config-snap/conf?revert-to=1", nil)
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=1000;socket=;"
+	s.vars = map[string]string{"name": "config-snap"}
+
+	rsp := setSnapConf(snapConfCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Summary(), check.Equals, `Revert configuration of "config-snap" snap to history entry 1`)
+	var uid uint32
+	c.Assert(chg.Get("author-uid", &uid), check.IsNil)
+	c.Check(uid, check.Equals, uint32(1000))
+
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 1)
+	var contextData struct {
+		Patch map[string]interface{} `json:"patch"`
+	}
+	c.Assert(tasks[0].Get("hook-context", &contextData), check.IsNil)
+	c.Check(contextData.Patch, check.DeepEquals, map[string]interface{}{
+		"foo": "a",
+		"bar": nil,
+	})
+}
+
+func (s *apiSuite) TestSetConfRevertToBadEntry(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+	s.mockConfigSnapState(d.overlord.State())
+	s.vars = map[string]string{"name": "config-snap"}
+
+	for _, tc := range []struct {
+		revertTo string
+		message  string
+	}{
+		{"foo", `invalid configuration history entry "foo"`},
+		{"0", `invalid configuration history entry "0"`},
+		{"3", `snap "config-snap" has no configuration history entry 3`},
+	} {
+		req, err := http.NewRequest("PUT", "/v2/snaps/config-snap/conf?revert-to="+tc.revertTo, nil)
+		c.Assert(err, check.IsNil)
+
+		rsp := setSnapConf(snapConfCmd, req, nil).(*resp)
+		c.Check(rsp.Type, check.Equals, ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, 400)
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, tc.message)
+	}
+}
+
 func simulateConflict(o *overlord.Overlord, name string) {
 	st := o.State()
 	st.Lock()
@@ -4319,6 +4599,55 @@ func (s *apiSuite) TestRefreshMany1(c *check.C) {
 	c.Check(refreshSnapDecls, check.Equals, true)
 }
 
+func (s *apiSuite) TestRefreshManyTransaction(c *check.C) {
+	assertstateRefreshSnapDeclarations = func(s *state.State, userID int) error {
+		return nil
+	}
+
+	var gotFlags *snapstate.Flags
+	snapstateUpdateMany = func(_ context.Context, s *state.State, names []string, userID int, flags *snapstate.Flags) ([]string, []*state.TaskSet, error) {
+		gotFlags = flags
+		t := s.NewTask("fake-refresh-2", "Refreshing two")
+		return names, []*state.TaskSet{state.NewTaskSet(t)}, nil
+	}
+
+	d := s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "refresh", "snaps": ["foo", "bar"], "transaction": "all-snaps"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+	c.Check(gotFlags, check.DeepEquals, &snapstate.Flags{Transaction: snapstate.TransactionAllSnaps})
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Change(rsp.Change).Summary(), check.Equals, `Refresh snaps "foo", "bar"`)
+}
+
+func (s *apiSuite) TestPostSnapsTransactionErrors(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`{"action": "refresh", "transaction": "some-snaps"}`, `invalid value for transaction type: "some-snaps"`},
+		{`{"action": "remove", "snaps": ["foo"], "transaction": "all-snaps"}`, `transaction type can only be specified for refresh`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/snaps", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/json")
+
+		rsp := postSnaps(snapsCmd, req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf(t.body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, t.err, check.Commentf(t.body))
+	}
+}
+
 func (s *apiSuite) TestInstallMany(c *check.C) {
 	snapstateInstallMany = func(s *state.State, names []string, userID int) ([]string, []*state.TaskSet, error) {
 		c.Check(names, check.HasLen, 2)
@@ -6986,6 +7315,84 @@ UnitFileState=enabled
 	c.Check(sort.StringsAreSorted(appNames), check.Equals, true)
 }
 
+func (s *appSuite) TestGetAppsInfoHealth(c *check.C) {
+	for _, name := range []string{"snap-a.svc1", "snap-a.svc2"} {
+		s.sysctlBufs = append(s.sysctlBufs, []byte(fmt.Sprintf(`
+Id=snap.%s.service
+Type=simple
+ActiveState=active
+UnitFileState=enabled
+`[1:], name)))
+	}
+
+	t0 := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	st := s.d.overlord.State()
+	st.Lock()
+	healthstate.SetApp(st, "snap-a", "svc1", &healthstate.HealthState{
+		Revision:  snap.R(1),
+		Timestamp: t0,
+		Status:    healthstate.ErrorStatus,
+		Code:      "snapd-probe-failed",
+		Message:   "tcp health probe failed: connection refused",
+	})
+	// the health of another revision is ignored
+	healthstate.SetApp(st, "snap-a", "svc2", &healthstate.HealthState{
+		Revision: snap.R(2),
+		Status:   healthstate.OkayStatus,
+	})
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/apps?names=snap-a", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	svcs := rsp.Result.([]client.AppInfo)
+	c.Assert(svcs, check.HasLen, 2)
+	c.Check(svcs[0].Name, check.Equals, "svc1")
+	c.Check(svcs[0].Health, check.DeepEquals, &client.SnapHealth{
+		Revision:  snap.R(1),
+		Timestamp: t0,
+		Status:    "error",
+		Code:      "snapd-probe-failed",
+		Message:   "tcp health probe failed: connection refused",
+	})
+	c.Check(svcs[1].Name, check.Equals, "svc2")
+	c.Check(svcs[1].Health, check.IsNil)
+}
+
+func (s *appSuite) TestGetAppsInfoRestarts(c *check.C) {
+	for _, name := range []string{"snap-a.svc1", "snap-a.svc2"} {
+		s.sysctlBufs = append(s.sysctlBufs, []byte(fmt.Sprintf(`
+Id=snap.%s.service
+Type=simple
+ActiveState=active
+UnitFileState=enabled
+`[1:], name)))
+	}
+
+	st := s.d.overlord.State()
+	st.Lock()
+	st.Set("service-restarts", map[string]map[string]*servicestate.ServiceRestarts{
+		"snap-a": {"svc2": {Count: 12, CrashLoop: true}},
+	})
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/apps?names=snap-a", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := getAppsInfo(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	svcs := rsp.Result.([]client.AppInfo)
+	c.Assert(svcs, check.HasLen, 2)
+	c.Check(svcs[0].Name, check.Equals, "svc1")
+	c.Check(svcs[0].Restarts, check.Equals, 0)
+	c.Check(svcs[0].CrashLoop, check.Equals, false)
+	c.Check(svcs[1].Name, check.Equals, "svc2")
+	c.Check(svcs[1].Restarts, check.Equals, 12)
+	c.Check(svcs[1].CrashLoop, check.Equals, true)
+}
+
 func (s *appSuite) TestGetAppsInfoBadSelect(c *check.C) {
 	req, err := http.NewRequest("GET", "/v2/apps?select=potato", nil)
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,187 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"time"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+var tokensCmd = &Command{
+	Path:     "/v2/tokens",
+	GET:      getTokens,
+	POST:     postTokens,
+	RootOnly: true,
+}
+
+func tokenResponse(tok *auth.TokenState) *client.APIToken {
+	rsp := &client.APIToken{
+		ID:      tok.ID,
+		Label:   tok.Label,
+		Scopes:  make([]client.APITokenScope, len(tok.Scopes)),
+		Created: tok.Created,
+	}
+	for i, sc := range tok.Scopes {
+		rsp.Scopes[i] = client.APITokenScope(sc)
+	}
+	if !tok.Expires.IsZero() {
+		expires := tok.Expires
+		rsp.Expires = &expires
+	}
+	rsp.CertFingerprint = tok.CertFingerprint
+	return rsp
+}
+
+func getTokens(c *Command, r *http.Request, user *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	tokens, err := auth.Tokens(st)
+	if err != nil {
+		return InternalError("cannot get tokens: %v", err)
+	}
+	rsp := make([]*client.APIToken, len(tokens))
+	for i, tok := range tokens {
+		rsp[i] = tokenResponse(tok)
+	}
+	return SyncResponse(rsp, nil)
+}
+
+type tokensRequest struct {
+	Action  string            `json:"action"`
+	Label   string            `json:"label"`
+	Scopes  []auth.TokenScope `json:"scopes"`
+	Expires *time.Time        `json:"expires"`
+	ID      int               `json:"id"`
+	// Certificate is the PEM client certificate to bind the token to
+	Certificate string `json:"certificate"`
+}
+
+// checkTokenScope checks that the scope is about an API endpoint tokens
+// can grant access to.
+func checkTokenScope(d *Daemon, sc *auth.TokenScope) Response {
+	var cmd *Command
+	if route := d.router.Get(sc.Endpoint); route != nil {
+		cmd, _ = route.GetHandler().(*Command)
+	}
+	if cmd == nil || cmd.Path != sc.Endpoint {
+		return BadRequest("cannot grant access to unknown endpoint %q", sc.Endpoint)
+	}
+	if cmd.RootOnly {
+		return BadRequest("cannot grant access to root only endpoint %q", sc.Endpoint)
+	}
+	if len(sc.Actions) == 0 {
+		return BadRequest("cannot grant access to endpoint %q without actions", sc.Endpoint)
+	}
+	return nil
+}
+
+func postTokens(c *Command, r *http.Request, user *auth.UserState) Response {
+	var req tokensRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		return BadRequest("cannot decode request body into tokens action: %v", err)
+	}
+	if decoder.More() {
+		return BadRequest("extra content found in request body")
+	}
+
+	switch req.Action {
+	case "create":
+		return createToken(c, &req)
+	case "revoke":
+		return revokeToken(c, &req)
+	default:
+		return BadRequest("unsupported tokens action %q", req.Action)
+	}
+}
+
+func createToken(c *Command, req *tokensRequest) Response {
+	if len(req.Scopes) == 0 {
+		return BadRequest("cannot create a token without scopes")
+	}
+	for i := range req.Scopes {
+		if rsp := checkTokenScope(c.d, &req.Scopes[i]); rsp != nil {
+			return rsp
+		}
+	}
+	var expires time.Time
+	if req.Expires != nil {
+		expires = *req.Expires
+		if !expires.After(time.Now()) {
+			return BadRequest("cannot create a token that expired already")
+		}
+	}
+
+	var fingerprint string
+	if req.Certificate != "" {
+		block, _ := pem.Decode([]byte(req.Certificate))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return BadRequest("cannot create a token for a certificate: no PEM certificate found")
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return BadRequest("cannot create a token for a certificate: %v", err)
+		}
+		fingerprint = auth.CertFingerprint(block.Bytes)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if fingerprint != "" {
+		if _, err := auth.CheckCertToken(st, fingerprint); err == nil {
+			return BadRequest("cannot create a token for a certificate that has one already")
+		}
+		tok, err := auth.NewCertToken(st, req.Label, fingerprint, req.Scopes, expires)
+		if err != nil {
+			return InternalError("cannot create token: %v", err)
+		}
+		return SyncResponse(&client.CreateAPITokenResult{ID: tok.ID}, nil)
+	}
+
+	tok, token, err := auth.NewToken(st, req.Label, req.Scopes, expires)
+	if err != nil {
+		return InternalError("cannot create token: %v", err)
+	}
+	return SyncResponse(&client.CreateAPITokenResult{ID: tok.ID, Token: token}, nil)
+}
+
+func revokeToken(c *Command, req *tokensRequest) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if _, err := auth.RemoveToken(st, req.ID); err != nil {
+		if err == auth.ErrInvalidToken {
+			return NotFound("cannot find token %d", req.ID)
+		}
+		return InternalError("cannot revoke token: %v", err)
+	}
+	return SyncResponse(nil, nil)
+}
@@ -0,0 +1,161 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+func (s *apiSuite) serveTokens(c *check.C, method, body, uid string) (code int, result interface{}) {
+	req, err := http.NewRequest(method, "/v2/tokens", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=%s;socket=;", uid)
+
+	rec := httptest.NewRecorder()
+	tokensCmd.ServeHTTP(rec, req)
+	var rsp map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
+	return rec.Code, rsp["result"]
+}
+
+func (s *apiSuite) TestTokensNeedRoot(c *check.C) {
+	s.daemon(c)
+
+	code, _ := s.serveTokens(c, "GET", "", "1000")
+	c.Check(code, check.Equals, 401)
+	code, _ = s.serveTokens(c, "POST", `{"action":"create","scopes":[{"endpoint":"/v2/changes","actions":["read"]}]}`, "1000")
+	c.Check(code, check.Equals, 401)
+}
+
+func (s *apiSuite) TestTokensCreateListRevoke(c *check.C) {
+	d := s.daemon(c)
+
+	code, result := s.serveTokens(c, "POST", `{"action":"create","label":"monitoring","scopes":[{"endpoint":"/v2/changes","actions":["read"]},{"endpoint":"/v2/snaps","actions":["refresh"],"snaps":["foo"]}],"expires":"2100-01-01T00:00:00Z"}`, "0")
+	c.Assert(code, check.Equals, 200)
+	created := result.(map[string]interface{})
+	c.Check(created["id"], check.Equals, 1.)
+	token := created["token"].(string)
+
+	st := d.overlord.State()
+	st.Lock()
+	tok, err := auth.CheckToken(st, token)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(tok.Label, check.Equals, "monitoring")
+	c.Check(tok.Allows("/v2/snaps", "refresh", []string{"foo"}), check.Equals, true)
+
+	code, result = s.serveTokens(c, "GET", "", "0")
+	c.Assert(code, check.Equals, 200)
+	tokens := result.([]interface{})
+	c.Assert(tokens, check.HasLen, 1)
+	listed := tokens[0].(map[string]interface{})
+	c.Check(listed["id"], check.Equals, 1.)
+	c.Check(listed["label"], check.Equals, "monitoring")
+	c.Check(listed["expires"], check.Equals, "2100-01-01T00:00:00Z")
+	c.Check(listed["scopes"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"endpoint": "/v2/changes", "actions": []interface{}{"read"}},
+		map[string]interface{}{"endpoint": "/v2/snaps", "actions": []interface{}{"refresh"}, "snaps": []interface{}{"foo"}},
+	})
+	// neither the token nor its digest are exposed
+	c.Check(listed["token"], check.IsNil)
+	c.Check(listed["digest"], check.IsNil)
+
+	code, _ = s.serveTokens(c, "POST", `{"action":"revoke","id":1}`, "0")
+	c.Check(code, check.Equals, 200)
+	st.Lock()
+	_, err = auth.CheckToken(st, token)
+	st.Unlock()
+	c.Check(err, check.Equals, auth.ErrInvalidAuth)
+
+	code, result = s.serveTokens(c, "POST", `{"action":"revoke","id":1}`, "0")
+	c.Check(code, check.Equals, 404)
+	c.Check(result.(map[string]interface{})["message"], check.Equals, "cannot find token 1")
+
+	code, result = s.serveTokens(c, "GET", "", "0")
+	c.Check(code, check.Equals, 200)
+	c.Check(result, check.DeepEquals, []interface{}{})
+}
+
+func (s *apiSuite) TestTokensCreateErrors(c *check.C) {
+	s.daemon(c)
+
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`{"action":"frobnicate"}`, `unsupported tokens action "frobnicate"`},
+		{`{"action":"create"}`, `cannot create a token without scopes`},
+		{`{"action":"create","scopes":[{"endpoint":"/v2/nope","actions":["read"]}]}`, `cannot grant access to unknown endpoint "/v2/nope"`},
+		{`{"action":"create","scopes":[{"endpoint":"/v2/tokens","actions":["read"]}]}`, `cannot grant access to root only endpoint "/v2/tokens"`},
+		{`{"action":"create","scopes":[{"endpoint":"/v2/changes"}]}`, `cannot grant access to endpoint "/v2/changes" without actions`},
+		{`{"action":"create","scopes":[{"endpoint":"/v2/changes","actions":["read"]}],"expires":"2000-01-01T00:00:00Z"}`, `cannot create a token that expired already`},
+		{`{"action":"create"}{}`, `extra content found in request body`},
+	} {
+		code, result := s.serveTokens(c, "POST", t.body, "0")
+		c.Check(code, check.Equals, 400, check.Commentf(t.body))
+		c.Check(result.(map[string]interface{})["message"], check.Equals, t.err, check.Commentf(t.body))
+	}
+}
+
+func (s *apiSuite) TestTokensCreateForCertificate(c *check.C) {
+	d := s.daemon(c)
+
+	cert := makeTestCert(c, "remote", nil)
+	body, err := json.Marshal(map[string]interface{}{
+		"action":      "create",
+		"scopes":      []map[string]interface{}{{"endpoint": "/v2/changes", "actions": []string{"read"}}},
+		"certificate": string(cert.certPEM()),
+	})
+	c.Assert(err, check.IsNil)
+
+	code, result := s.serveTokens(c, "POST", string(body), "0")
+	c.Assert(code, check.Equals, 200)
+	// the token is bound to the certificate, not handed out
+	c.Check(result, check.DeepEquals, map[string]interface{}{"id": 1.})
+
+	fingerprint := auth.CertFingerprint(cert.cert.Raw)
+	st := d.overlord.State()
+	st.Lock()
+	tok, err := auth.CheckCertToken(st, fingerprint)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(tok.ID, check.Equals, 1)
+
+	code, result = s.serveTokens(c, "GET", "", "0")
+	c.Assert(code, check.Equals, 200)
+	c.Check(result.([]interface{})[0].(map[string]interface{})["cert-fingerprint"], check.Equals, fingerprint)
+
+	// one token per certificate
+	code, result = s.serveTokens(c, "POST", string(body), "0")
+	c.Check(code, check.Equals, 400)
+	c.Check(result.(map[string]interface{})["message"], check.Equals, "cannot create a token for a certificate that has one already")
+
+	code, result = s.serveTokens(c, "POST", `{"action":"create","scopes":[{"endpoint":"/v2/changes","actions":["read"]}],"certificate":"junk"}`, "0")
+	c.Check(code, check.Equals, 400)
+	c.Check(result.(map[string]interface{})["message"], check.Equals, "cannot create a token for a certificate: no PEM certificate found")
+}
@@ -20,8 +20,13 @@
 package daemon
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
 	"os"
@@ -46,8 +51,10 @@ import (
 	"github.com/snapcore/snapd/overlord/standby"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/polkit"
+	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
 )
 
@@ -62,6 +69,7 @@ type Daemon struct {
 	state           *state.State
 	snapdListener   net.Listener
 	snapListener    net.Listener
+	tlsListener     net.Listener
 	connTracker     *connTracker
 	serve           *http.Server
 	tomb            tomb.Tomb
@@ -100,6 +108,8 @@ type Command struct {
 	SnapOK bool
 	// this path is only accessible to root
 	RootOnly bool
+	// can scoped API access tokens grant access even if RootOnly?
+	TokenOK bool
 
 	// can polkit grant access? set to polkit action ID if so
 	PolkitOK string
@@ -129,6 +139,8 @@ var polkitCheckAuthorization = polkit.CheckAuthorization
 // - UserOK: any uid on the local system can access GET
 // - RootOnly: only root can access this
 // - SnapOK: a snap can access this via `snapctl`
+//
+// Scoped API access tokens are checked separately by tokenAllows.
 func (c *Command) canAccess(r *http.Request, user *auth.UserState) accessResult {
 	if c.RootOnly && (c.UserOK || c.GuestOK || c.SnapOK) {
 		// programming error
@@ -211,11 +223,84 @@ func (c *Command) canAccess(r *http.Request, user *auth.UserState) accessResult
 	return accessUnauthorized
 }
 
+// maxTokenBodySize is the most of a JSON request body read to find out
+// what a scoped API access token is used for.
+const maxTokenBodySize = 64 * 1024
+
+// tokenAllows returns whether the scoped API access token grants the
+// request. The action of a GET request is auth.ReadAction, other requests
+// are known by the "action" of their JSON body or otherwise by their lower
+// case method; the snaps are those named in the path, the "snaps" and
+// "names" query parameters and the "snaps" and "names" of the body.
+func (c *Command) tokenAllows(r *http.Request, token *auth.TokenState) bool {
+	if c.RootOnly && !c.TokenOK {
+		// tokens do not delegate what only root can do
+		return false
+	}
+	if _, _, socket, err := ucrednetGet(r.RemoteAddr); err == nil && socket == dirs.SnapSocket {
+		// snaps can only do what is SnapOK, token or not
+		return false
+	}
+
+	var snaps []string
+	addNames := func(names []string) {
+		for _, name := range names {
+			// apps are named <snap>.<app>
+			snapName, _ := snap.SplitSnapApp(name)
+			snaps = append(snaps, snapName)
+		}
+	}
+	if name := mux.Vars(r)["name"]; name != "" {
+		addNames([]string{name})
+	}
+	query := r.URL.Query()
+	addNames(strutil.CommaSeparatedList(query.Get("snaps")))
+	addNames(strutil.CommaSeparatedList(query.Get("names")))
+
+	action := auth.ReadAction
+	if r.Method != "GET" {
+		action = strings.ToLower(r.Method)
+		// only JSON bodies say what they are for, others like the
+		// multipart upload of a snap are left alone; not all clients
+		// set the content type of JSON bodies
+		contentType := r.Header.Get("Content-Type")
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if r.Body != nil && (contentType == "" || mediaType == "application/json") {
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxTokenBodySize+1))
+			if err != nil || len(body) > maxTokenBodySize {
+				return false
+			}
+			// the handler still needs to read the body
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			var req struct {
+				Action string   `json:"action"`
+				Snaps  []string `json:"snaps"`
+				Names  []string `json:"names"`
+			}
+			if err := json.Unmarshal(body, &req); err == nil {
+				if req.Action != "" {
+					action = req.Action
+				}
+				addNames(req.Snaps)
+				addNames(req.Names)
+			}
+		}
+	}
+
+	return token.Allows(c.Path, action, snaps)
+}
+
 func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	st := c.d.state
 	st.Lock()
 	// TODO Look at the error and fail if there's an attempt to authenticate with invalid data.
 	user, _ := UserFromRequest(st, r)
+	token, _ := tokenFromRequest(st, r)
+	if user == nil && token == nil {
+		// remote clients are known by their certificate
+		user, token = tlsPeerFromRequest(st, r)
+	}
 	st.Unlock()
 
 	// check if we are in degradedMode
@@ -224,7 +309,12 @@ func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch c.canAccess(r, user) {
+	access := c.canAccess(r, user)
+	if access == accessUnauthorized && token != nil && c.tokenAllows(r, token) {
+		access = accessOK
+	}
+
+	switch access {
 	case accessOK:
 		// nothing
 	case accessUnauthorized:
@@ -338,6 +428,8 @@ func (d *Daemon) Init() error {
 		logger.Debugf("cannot get listener for %q: %v", dirs.SnapSocket, err)
 	}
 
+	d.initTLSListener()
+
 	d.addRoutes()
 
 	logger.Noticef("started %v.", snapdenv.UserAgent())
@@ -464,6 +556,16 @@ func (d *Daemon) Start() error {
 			})
 		}
 
+		if d.tlsListener != nil {
+			d.tomb.Go(func() error {
+				if err := d.serve.Serve(d.tlsListener); err != http.ErrServerClosed && d.tomb.Err() == tomb.ErrStillAlive {
+					return err
+				}
+
+				return nil
+			})
+		}
+
 		if err := d.serve.Serve(d.snapdListener); err != http.ErrServerClosed && d.tomb.Err() == tomb.ErrStillAlive {
 			return err
 		}
@@ -532,6 +634,9 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 	d.mu.Unlock()
 
 	d.snapdListener.Close()
+	if d.tlsListener != nil {
+		d.tlsListener.Close()
+	}
 	d.standbyOpinions.Stop()
 
 	if d.snapListener != nil {
@@ -31,6 +31,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -384,6 +385,120 @@ func (s *daemonSuite) TestSuperAccess(c *check.C) {
 	c.Check(cmd.canAccess(put, nil), check.Equals, accessOK)
 }
 
+func (s *daemonSuite) TestScopedTokenAccess(c *check.C) {
+	d := newTestDaemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	_, token, err := auth.NewToken(st, "", []auth.TokenScope{
+		{Endpoint: "/v2/snaps", Actions: []string{"refresh"}, Snaps: []string{"foo"}},
+		{Endpoint: "/v2/apps", Actions: []string{"restart"}, Snaps: []string{"baz"}},
+		{Endpoint: "/v2/changes", Actions: []string{"read"}},
+	}, time.Time{})
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	var body string
+	rf := func(innerCmd *Command, req *http.Request, user *auth.UserState) Response {
+		if req.Body != nil {
+			buf, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, check.IsNil)
+			body = string(buf)
+		}
+		return SyncResponse(nil, nil)
+	}
+
+	for _, t := range []struct {
+		cmd    *Command
+		method string
+		url    string
+		body   string
+		token  string
+		code   int
+	}{
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", "/v2/snaps", `{"action":"refresh","snaps":["foo"]}`, token, 200},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", "/v2/snaps", `{"action":"refresh","snaps":["foo"]}`, "", 401},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", "/v2/snaps", `{"action":"refresh","snaps":["foo"]}`, "bogus", 401},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", "/v2/snaps", `{"action":"refresh","snaps":["foo","bar"]}`, token, 401},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", "/v2/snaps", `{"action":"refresh"}`, token, 401},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", "/v2/snaps", `{"action":"remove","snaps":["foo"]}`, token, 401},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", "/v2/snaps", `not json`, token, 401},
+		{&Command{d: d, Path: "/v2/apps", POST: rf}, "POST", "/v2/apps", `{"action":"restart","names":["baz.svc"]}`, token, 200},
+		{&Command{d: d, Path: "/v2/apps", POST: rf}, "POST", "/v2/apps", `{"action":"restart","names":["baz.svc","other"]}`, token, 401},
+		{&Command{d: d, Path: "/v2/changes", GET: rf}, "GET", "/v2/changes?select=all", "", token, 200},
+		{&Command{d: d, Path: "/v2/changes", POST: rf}, "POST", "/v2/changes", `{"action":"abort"}`, token, 401},
+		// tokens never grant root only commands
+		{&Command{d: d, Path: "/v2/changes", GET: rf, RootOnly: true}, "GET", "/v2/changes", "", token, 401},
+	} {
+		body = ""
+		req, err := http.NewRequest(t.method, t.url, bytes.NewBufferString(t.body))
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = "pid=100;uid=42;socket=;"
+		if t.token != "" {
+			req.Header.Set("Authorization", "Bearer "+t.token)
+		}
+		rec := httptest.NewRecorder()
+		t.cmd.ServeHTTP(rec, req)
+		c.Check(rec.Code, check.Equals, t.code, check.Commentf("%s %s %s", t.method, t.url, t.body))
+		if t.code == 200 {
+			// the handler still gets the whole body
+			c.Check(body, check.Equals, t.body)
+		}
+	}
+
+	// tokens are never considered for requests coming from snaps
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(`{"action":"refresh","snaps":["foo"]}`))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = fmt.Sprintf("pid=100;uid=42;socket=%s;", dirs.SnapSocket)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	(&Command{d: d, Path: "/v2/snaps", POST: rf}).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 401)
+
+	// nor are the bodies of other kinds of requests read, they are left
+	// to the handler
+	body = ""
+	upload := `--foo\r\nContent-Disposition: form-data; name="action"\r\n\r\nrefresh\r\n--foo--\r\n`
+	req, err = http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(upload))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=42;socket=;"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=foo")
+	rec = httptest.NewRecorder()
+	(&Command{d: d, Path: "/v2/snaps", POST: rf}).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 401)
+	c.Check(body, check.Equals, "")
+
+	// and too big JSON bodies are refused
+	big := fmt.Sprintf(`{"action":"refresh","snaps":["foo"],"pad":"%s"}`, strings.Repeat("x", 64*1024))
+	req, err = http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(big))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=42;socket=;"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	(&Command{d: d, Path: "/v2/snaps", POST: rf}).ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 401)
+
+	// snaps named in the path are taken into account
+	router := mux.NewRouter()
+	router.Handle("/v2/snaps/{name}", &Command{d: d, Path: "/v2/snaps/{name}", POST: rf})
+	st.Lock()
+	_, token, err = auth.NewToken(st, "", []auth.TokenScope{
+		{Endpoint: "/v2/snaps/{name}", Actions: []string{"refresh"}, Snaps: []string{"foo"}},
+	}, time.Time{})
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	for name, code := range map[string]int{"foo": 200, "bar": 401} {
+		req, err := http.NewRequest("POST", "/v2/snaps/"+name, bytes.NewBufferString(`{"action":"refresh"}`))
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = "pid=100;uid=42;socket=;"
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		c.Check(rec.Code, check.Equals, code, check.Commentf(name))
+	}
+}
+
 func (s *daemonSuite) TestPolkitAccess(c *check.C) {
 	put := &http.Request{Method: "PUT", RemoteAddr: "pid=100;uid=42;socket=;"}
 	cmd := &Command{d: newTestDaemon(c), PolkitOK: "polkit.action"}
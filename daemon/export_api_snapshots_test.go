@@ -32,7 +32,7 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 )
 
-func MockSnapshotSave(newSave func(*state.State, []string, []string) (uint64, []string, *state.TaskSet, error)) (restore func()) {
+func MockSnapshotSave(newSave func(*state.State, []string, []string, *snapshotstate.SaveOptions) (uint64, []string, *state.TaskSet, error)) (restore func()) {
 	oldSave := snapshotSave
 	snapshotSave = newSave
 	return func() {
@@ -21,6 +21,7 @@ package daemon
 
 import (
 	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/secboot"
 )
 
 func MockDeviceManagerReboot(f func(*devicestate.DeviceManager, string, string) error) (restore func()) {
@@ -30,3 +31,19 @@ func MockDeviceManagerReboot(f func(*devicestate.DeviceManager, string, string)
 		deviceManagerReboot = old
 	}
 }
+
+func MockBootRecoveryKey(f func() (secboot.RecoveryKey, error)) (restore func()) {
+	old := bootRecoveryKey
+	bootRecoveryKey = f
+	return func() {
+		bootRecoveryKey = old
+	}
+}
+
+func MockBootRotateRecoveryKey(f func() (secboot.RecoveryKey, error)) (restore func()) {
+	old := bootRotateRecoveryKey
+	bootRotateRecoveryKey = f
+	return func() {
+		bootRotateRecoveryKey = old
+	}
+}
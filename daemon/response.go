@@ -99,6 +99,7 @@ type Meta struct {
 	Change            string     `json:"change,omitempty"`
 	WarningTimestamp  *time.Time `json:"warning-timestamp,omitempty"`
 	WarningCount      int        `json:"warning-count,omitempty"`
+	NextCursor        string     `json:"next-cursor,omitempty"`
 }
 
 type respJSON struct {
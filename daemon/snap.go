@@ -32,6 +32,7 @@ import (
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/healthstate"
+	"github.com/snapcore/snapd/overlord/servicestate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
@@ -67,9 +68,10 @@ func publisherAccount(st *state.State, snapID string) (snap.StoreAccount, error)
 }
 
 type aboutSnap struct {
-	info   *snap.Info
-	snapst *snapstate.SnapState
-	health *client.SnapHealth
+	info      *snap.Info
+	snapst    *snapstate.SnapState
+	health    *client.SnapHealth
+	appHealth map[string]*healthstate.HealthState
 }
 
 func clientHealthFromHealthstate(h *healthstate.HealthState) *client.SnapHealth {
@@ -113,11 +115,16 @@ func localSnapInfo(st *state.State, name string) (aboutSnap, error) {
 	if err != nil {
 		return aboutSnap{}, err
 	}
+	appHealth, err := healthstate.AllApps(st)
+	if err != nil {
+		return aboutSnap{}, err
+	}
 
 	return aboutSnap{
-		info:   info,
-		snapst: &snapst,
-		health: clientHealthFromHealthstate(health),
+		info:      info,
+		snapst:    &snapst,
+		health:    clientHealthFromHealthstate(health),
+		appHealth: appHealth[name],
 	}, nil
 }
 
@@ -136,6 +143,10 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 	if err != nil {
 		return nil, err
 	}
+	appHealths, err := healthstate.AllApps(st)
+	if err != nil {
+		return nil, err
+	}
 
 	var firstErr error
 	for name, snapst := range snapStates {
@@ -164,13 +175,13 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 				if err != nil && firstErr == nil {
 					firstErr = err
 				}
-				aboutThis = append(aboutThis, aboutSnap{info, snapst, health})
+				aboutThis = append(aboutThis, aboutSnap{info, snapst, health, appHealths[name]})
 			}
 		} else {
 			info, err = snapst.CurrentInfo()
 			if err == nil {
 				info.Publisher, err = publisherAccount(st, info.SnapID)
-				aboutThis = append(aboutThis, aboutSnap{info, snapst, health})
+				aboutThis = append(aboutThis, aboutSnap{info, snapst, health, appHealths[name]})
 			}
 		}
 
@@ -286,8 +297,38 @@ func appInfosFor(st *state.State, names []string, opts appInfoOptions) ([]*snap.
 	return appInfos, nil
 }
 
+// serviceStateDecorator decorates the client.AppInfos of services with
+// what snapd keeps track of about them, that is the health found by their
+// health probes and their restarts by systemd, on top of their status.
+type serviceStateDecorator struct {
+	clientutil.StatusDecorator
+	// health and restarts are by snap and app name
+	health   map[string]map[string]*healthstate.HealthState
+	restarts map[string]map[string]*servicestate.ServiceRestarts
+}
+
+func (sd *serviceStateDecorator) DecorateWithStatus(appInfo *client.AppInfo, snapApp *snap.AppInfo) error {
+	if err := sd.StatusDecorator.DecorateWithStatus(appInfo, snapApp); err != nil {
+		return err
+	}
+	if health := sd.health[appInfo.Snap][appInfo.Name]; health != nil && health.Revision == snapApp.Snap.Revision {
+		appInfo.Health = clientHealthFromHealthstate(health)
+	}
+	if restarts := sd.restarts[appInfo.Snap][appInfo.Name]; restarts != nil {
+		appInfo.Restarts = restarts.Count
+		appInfo.CrashLoop = restarts.CrashLoop
+	}
+	return nil
+}
+
 func mapLocal(about aboutSnap, sd clientutil.StatusDecorator) *client.Snap {
 	localSnap, snapst := about.info, about.snapst
+	if sd != nil && len(about.appHealth) > 0 {
+		sd = &serviceStateDecorator{
+			StatusDecorator: sd,
+			health:          map[string]map[string]*healthstate.HealthState{localSnap.InstanceName(): about.appHealth},
+		}
+	}
 	result, err := clientutil.ClientSnapFromSnapInfo(localSnap, sd)
 	if err != nil {
 		logger.Noticef("cannot get full app info for snap %q: %v", localSnap.InstanceName(), err)
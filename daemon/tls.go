@@ -0,0 +1,137 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var netListen = net.Listen
+
+// tlsListenAddress returns the address the TLS listener should be bound
+// to, as set via the api.tls.listen system option; the empty address
+// means the listener is disabled.
+func tlsListenAddress(st *state.State) (string, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	var addr string
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "api.tls.listen", &addr); err != nil && !config.IsNoOption(err) {
+		return "", err
+	}
+	return addr, nil
+}
+
+// tlsConfig returns the configuration of the TLS listener: it presents
+// server.crt and requires clients to present a certificate signed by
+// client-ca.crt, all of them from dirs.SnapdTLSDir.
+func tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dirs.SnapdTLSDir, "server.crt"), filepath.Join(dirs.SnapdTLSDir, "server.key"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot load server certificate: %v", err)
+	}
+	caPEM, err := ioutil.ReadFile(filepath.Join(dirs.SnapdTLSDir, "client-ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot load client CA certificate: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("cannot load client CA certificate: no certificates found")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// initTLSListener sets up the TLS listener if one is configured. A broken
+// setup is logged but does not stop the daemon, which is still reachable
+// over its local sockets.
+func (d *Daemon) initTLSListener() {
+	addr, err := tlsListenAddress(d.state)
+	if err != nil {
+		logger.Noticef("cannot get TLS listener address: %v", err)
+		return
+	}
+	if addr == "" {
+		return
+	}
+	cfg, err := tlsConfig()
+	if err != nil {
+		logger.Noticef("cannot set up TLS listener on %s: %v", addr, err)
+		return
+	}
+	listener, err := netListen("tcp", addr)
+	if err != nil {
+		logger.Noticef("cannot set up TLS listener on %s: %v", addr, err)
+		return
+	}
+	d.tlsListener = tls.NewListener(listener, cfg)
+	logger.Noticef("listening for TLS connections on %s", listener.Addr())
+}
+
+// tlsPeerFromRequest maps the verified client certificate of a request
+// that came in over the TLS listener to either the token bound to the
+// certificate or, failing that, the user named by the certificate's
+// common name (as username or email).
+func tlsPeerFromRequest(st *state.State, r *http.Request) (*auth.UserState, *auth.TokenState) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	if token, err := auth.CheckCertToken(st, auth.CertFingerprint(cert.Raw)); err == nil {
+		return nil, token
+	}
+
+	name := cert.Subject.CommonName
+	if name == "" {
+		return nil, nil
+	}
+	if user, err := auth.UserByUsername(st, name); err == nil {
+		return user, nil
+	}
+	users, err := auth.Users(st)
+	if err != nil {
+		return nil, nil
+	}
+	for _, user := range users {
+		if user.Email == name {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
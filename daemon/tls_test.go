@@ -0,0 +1,259 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func (tc *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.cert.Raw})
+}
+
+func (tc *testCert) keyPEM(c *check.C) []byte {
+	der, err := x509.MarshalECPrivateKey(tc.key)
+	c.Assert(err, check.IsNil)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (tc *testCert) tlsCertificate(c *check.C) tls.Certificate {
+	cert, err := tls.X509KeyPair(tc.certPEM(), tc.keyPEM(c))
+	c.Assert(err, check.IsNil)
+	return cert
+}
+
+var testCertSerial int64
+
+// makeTestCert makes a certificate for the given common name, signed by
+// parent or self-signed if parent is nil.
+func makeTestCert(c *check.C, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+
+	testCertSerial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(testCertSerial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	c.Assert(err, check.IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, check.IsNil)
+	return &testCert{cert: cert, key: key}
+}
+
+// writeTestTLSDir sets up the server side of the TLS listener, returning
+// the CA that signs both server and client certificates.
+func writeTestTLSDir(c *check.C) *testCert {
+	ca := makeTestCert(c, "test CA", nil)
+	server := makeTestCert(c, "snapd", ca)
+
+	c.Assert(os.MkdirAll(dirs.SnapdTLSDir, 0700), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapdTLSDir, "server.crt"), server.certPEM(), 0644), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapdTLSDir, "server.key"), server.keyPEM(c), 0600), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapdTLSDir, "client-ca.crt"), ca.certPEM(), 0644), check.IsNil)
+	return ca
+}
+
+func (s *daemonSuite) setTLSListenAddress(c *check.C, d *Daemon, addr string) {
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	tr := config.NewTransaction(st)
+	c.Assert(tr.Set("core", "api.tls.listen", addr), check.IsNil)
+	tr.Commit()
+}
+
+func (s *daemonSuite) TestTLSPeerAccess(c *check.C) {
+	d := newTestDaemon(c)
+	st := d.overlord.State()
+
+	ca := makeTestCert(c, "test CA", nil)
+	byName := makeTestCert(c, "someuser", ca)
+	byEmail := makeTestCert(c, "someone@example.com", ca)
+	unknown := makeTestCert(c, "nobody", ca)
+	withToken := makeTestCert(c, "someuser", ca)
+
+	st.Lock()
+	_, err := auth.NewUser(st, "someuser", "someone@example.com", "macaroon", nil)
+	c.Assert(err, check.IsNil)
+	_, err = auth.NewCertToken(st, "", auth.CertFingerprint(withToken.cert.Raw), []auth.TokenScope{
+		{Endpoint: "/v2/changes", Actions: []string{"read"}},
+	}, time.Time{})
+	c.Assert(err, check.IsNil)
+	st.Unlock()
+
+	var gotUser *auth.UserState
+	rf := func(innerCmd *Command, req *http.Request, user *auth.UserState) Response {
+		gotUser = user
+		return SyncResponse(nil, nil)
+	}
+
+	for _, t := range []struct {
+		cmd    *Command
+		method string
+		peer   *testCert
+		code   int
+		user   string
+	}{
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", byName, 200, "someuser"},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", byEmail, 200, "someuser"},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", unknown, 401, ""},
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", nil, 401, ""},
+		// the token bound to the certificate wins over its common name
+		{&Command{d: d, Path: "/v2/snaps", POST: rf}, "POST", withToken, 401, ""},
+		{&Command{d: d, Path: "/v2/changes", GET: rf}, "GET", withToken, 200, ""},
+		// remote clients never reach root only commands
+		{&Command{d: d, Path: "/v2/snaps", POST: rf, RootOnly: true}, "POST", byName, 401, ""},
+		{&Command{d: d, Path: "/v2/changes", GET: rf, RootOnly: true}, "GET", withToken, 401, ""},
+	} {
+		gotUser = nil
+		req, err := http.NewRequest(t.method, t.cmd.Path, nil)
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = "192.0.2.1:4242"
+		if t.peer != nil {
+			req.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{t.peer.cert, ca.cert}},
+			}
+		}
+		rec := httptest.NewRecorder()
+		t.cmd.ServeHTTP(rec, req)
+		c.Check(rec.Code, check.Equals, t.code, check.Commentf("%s %s", t.method, t.cmd.Path))
+		if t.user != "" {
+			c.Assert(gotUser, check.NotNil)
+			c.Check(gotUser.Username, check.Equals, t.user)
+		} else {
+			c.Check(gotUser, check.IsNil)
+		}
+	}
+}
+
+func (s *daemonSuite) TestInitTLSListenerDisabled(c *check.C) {
+	d := newTestDaemon(c)
+	writeTestTLSDir(c)
+
+	d.initTLSListener()
+	c.Check(d.tlsListener, check.IsNil)
+}
+
+func (s *daemonSuite) TestInitTLSListenerMissingCertificates(c *check.C) {
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	d := newTestDaemon(c)
+	s.setTLSListenAddress(c, d, "127.0.0.1:0")
+
+	d.initTLSListener()
+	c.Check(d.tlsListener, check.IsNil)
+	c.Check(logbuf.String(), testutil.Contains, "cannot set up TLS listener on 127.0.0.1:0: cannot load server certificate")
+}
+
+func (s *daemonSuite) TestTLSListenerServes(c *check.C) {
+	d := newTestDaemon(c)
+	s.markSeeded(d)
+	ca := writeTestTLSDir(c)
+	s.setTLSListenAddress(c, d, "127.0.0.1:0")
+
+	st := d.overlord.State()
+	st.Lock()
+	_, err := auth.NewUser(st, "someuser", "someone@example.com", "macaroon", nil)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+
+	d.initTLSListener()
+	c.Assert(d.tlsListener, check.NotNil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	d.snapdListener = l
+
+	c.Assert(d.Start(), check.IsNil)
+	defer func() {
+		c.Check(d.Stop(nil), check.IsNil)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(peer *testCert) (*http.Response, error) {
+		tlsConf := &tls.Config{RootCAs: roots}
+		if peer != nil {
+			tlsConf.Certificates = []tls.Certificate{peer.tlsCertificate(c)}
+		}
+		cli := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConf, DisableKeepAlives: true}}
+		return cli.Get("https://" + d.tlsListener.Addr().String() + "/v2/changes?select=all")
+	}
+
+	rsp, err := get(makeTestCert(c, "someuser", ca))
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 200)
+
+	rsp, err = get(makeTestCert(c, "nobody", ca))
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 401)
+
+	// a certificate not signed by the client CA is refused
+	_, err = get(makeTestCert(c, "someuser", nil))
+	c.Check(err, check.NotNil)
+	// as is not presenting any
+	_, err = get(nil)
+	c.Check(err, check.NotNil)
+}
@@ -63,14 +63,20 @@ var (
 	SnapSeedDir   string
 	SnapDeviceDir string
 
+	SnapSaveDir       string
+	SnapDeviceSaveDir string
+
 	SnapAssertsDBDir      string
 	SnapCookieDir         string
 	SnapTrustedAccountKey string
 	SnapAssertsSpoolDir   string
 	SnapSeqDir            string
 
-	SnapStateFile     string
-	SnapSystemKeyFile string
+	SnapStateFile         string
+	SnapSystemKeyFile     string
+	SnapConfigSecretsFile string
+	SnapdTLSDir           string
+	SnapChangesArchiveDir string
 
 	SnapRepairDir        string
 	SnapRepairStateFile  string
@@ -100,6 +106,7 @@ var (
 
 	SnapModeenvFile   string
 	SnapBootAssetsDir string
+	SnapFDEDir        string
 
 	CloudMetaDataFile     string
 	CloudInstanceDataFile string
@@ -255,6 +262,30 @@ func SnapBootAssetsDirUnder(rootdir string) string {
 	return filepath.Join(rootdir, snappyDir, "boot-assets")
 }
 
+// SnapFDEDirUnder returns the path to full disk encryption state directory
+// under a rootdir.
+func SnapFDEDirUnder(rootdir string) string {
+	return filepath.Join(rootdir, snappyDir, "device/fde")
+}
+
+// SnapDeviceDirUnder returns the path to the device state directory, which
+// holds the device keys, under a rootdir.
+func SnapDeviceDirUnder(rootdir string) string {
+	return filepath.Join(rootdir, snappyDir, "device")
+}
+
+// SnapAssertsDBDirUnder returns the path to the assertions database directory
+// under a rootdir.
+func SnapAssertsDBDirUnder(rootdir string) string {
+	return filepath.Join(rootdir, snappyDir, "assertions")
+}
+
+// SnapSaveDirUnder returns the path to the directory where the ubuntu-save
+// partition is made available, under a rootdir.
+func SnapSaveDirUnder(rootdir string) string {
+	return filepath.Join(rootdir, snappyDir, "save")
+}
+
 // AddRootDirCallback registers a callback for whenever the global root
 // directory (set by SetRootDir) is changed to enable updates to variables in
 // other packages that depend on its location.
@@ -321,6 +352,9 @@ func SetRootDir(rootdir string) {
 
 	SnapStateFile = SnapStateFileUnder(rootdir)
 	SnapSystemKeyFile = filepath.Join(rootdir, snappyDir, "system-key")
+	SnapConfigSecretsFile = filepath.Join(rootdir, snappyDir, "config-secrets.json")
+	SnapdTLSDir = filepath.Join(rootdir, snappyDir, "tls")
+	SnapChangesArchiveDir = filepath.Join(rootdir, snappyDir, "changes-archive")
 
 	SnapCacheDir = filepath.Join(rootdir, "/var/cache/snapd")
 	SnapNamesFile = filepath.Join(SnapCacheDir, "names")
@@ -331,8 +365,12 @@ func SetRootDir(rootdir string) {
 	SnapSeedDir = SnapSeedDirUnder(rootdir)
 	SnapDeviceDir = filepath.Join(rootdir, snappyDir, "device")
 
+	SnapSaveDir = SnapSaveDirUnder(rootdir)
+	SnapDeviceSaveDir = filepath.Join(SnapSaveDir, "device")
+
 	SnapModeenvFile = SnapModeenvFileUnder(rootdir)
 	SnapBootAssetsDir = SnapBootAssetsDirUnder(rootdir)
+	SnapFDEDir = SnapFDEDirUnder(rootdir)
 
 	SnapRepairDir = filepath.Join(rootdir, snappyDir, "repair")
 	SnapRepairStateFile = filepath.Join(SnapRepairDir, "repair.json")
@@ -50,6 +50,7 @@ const (
 	SystemBoot = "system-boot"
 	SystemData = "system-data"
 	SystemSeed = "system-seed"
+	SystemSave = "system-save"
 
 	bootImage  = "system-boot-image"
 	bootSelect = "system-boot-select"
@@ -76,6 +77,45 @@ type Info struct {
 	Defaults map[string]map[string]interface{} `yaml:"defaults,omitempty"`
 
 	Connections []Connection `yaml:"connections"`
+
+	// KernelCmdline carries the kernel command line arguments the system
+	// configuration can append to the run mode command line.
+	KernelCmdline KernelCmdline `yaml:"kernel-cmdline,omitempty"`
+}
+
+// KernelCmdline describes the kernel command line arguments that are allowed
+// to be appended.
+type KernelCmdline struct {
+	// Allow lists the allowed arguments, an entry of the form param=value
+	// allows exactly that argument, a bare param allows it with any value.
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+// Allows returns true if the kernel command line argument is allowed.
+func (k *KernelCmdline) Allows(arg string) bool {
+	param := strings.SplitN(arg, "=", 2)[0]
+	for _, allowed := range k.Allow {
+		if allowed == arg || allowed == param {
+			return true
+		}
+	}
+	return false
+}
+
+func validateKernelCmdline(k *KernelCmdline) error {
+	for _, arg := range k.Allow {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'") {
+			return fmt.Errorf("invalid allowed kernel command line argument %q", arg)
+		}
+		param := strings.SplitN(arg, "=", 2)[0]
+		if param == "" {
+			return fmt.Errorf("invalid allowed kernel command line argument %q", arg)
+		}
+		if strings.HasPrefix(param, "snapd_") {
+			return fmt.Errorf("cannot allow reserved kernel command line argument %q", arg)
+		}
+	}
+	return nil
 }
 
 // Volume defines the structure and content for the image to be written into a
@@ -335,6 +375,10 @@ func InfoFromGadgetYaml(gadgetYaml []byte, model Model) (*Info, error) {
 		}
 	}
 
+	if err := validateKernelCmdline(&gi.KernelCmdline); err != nil {
+		return nil, err
+	}
+
 	if len(gi.Volumes) == 0 && classicOrUnconstrained(model) {
 		// volumes can be left out on classic
 		// can still specify defaults though
@@ -351,10 +395,10 @@ func InfoFromGadgetYaml(gadgetYaml []byte, model Model) (*Info, error) {
 		switch v.Bootloader {
 		case "":
 			// pass
-		case "grub", "u-boot", "android-boot", "lk":
+		case "grub", "systemd-boot", "u-boot", "android-boot", "lk":
 			bootloadersFound += 1
 		default:
-			return nil, errors.New("bootloader must be one of grub, u-boot, android-boot or lk")
+			return nil, errors.New("bootloader must be one of grub, systemd-boot, u-boot, android-boot or lk")
 		}
 	}
 	switch {
@@ -409,6 +453,7 @@ type validationState struct {
 	SystemSeed *VolumeStructure
 	SystemData *VolumeStructure
 	SystemBoot *VolumeStructure
+	SystemSave *VolumeStructure
 }
 
 func validateVolume(name string, vol *Volume, model Model) error {
@@ -475,6 +520,11 @@ func validateVolume(name string, vol *Volume, model Model) error {
 				return fmt.Errorf("cannot have more than one partition with system-boot role")
 			}
 			state.SystemBoot = &vol.Structure[idx]
+		case SystemSave:
+			if state.SystemSave != nil {
+				return fmt.Errorf("cannot have more than one partition with system-save role")
+			}
+			state.SystemSave = &vol.Structure[idx]
 		}
 
 		previousEnd = end
@@ -540,6 +590,15 @@ func ensureVolumeConsistencyWithConstraints(state *validationState, model Model)
 }
 
 func ensureVolumeConsistency(state *validationState, model Model) error {
+	if state.SystemSave != nil {
+		// ubuntu-save only exists alongside the UC20 partitions
+		if state.SystemSeed == nil {
+			return fmt.Errorf("the system-save role requires system-seed to be defined")
+		}
+		if state.SystemSave.Label != "" {
+			return fmt.Errorf("system-save structure must not have a label")
+		}
+	}
 	if model == nil {
 		return ensureVolumeConsistencyNoConstraints(state)
 	}
@@ -724,7 +783,7 @@ func validateRole(vs *VolumeStructure, vol *Volume) error {
 	}
 
 	switch vsRole {
-	case SystemData, SystemSeed:
+	case SystemData, SystemSeed, SystemSave:
 		// roles have cross dependencies, consistency checks are done at
 		// the volume level
 	case schemaMBR:
@@ -551,7 +551,7 @@ volumes:
 	c.Assert(err, IsNil)
 
 	_, err = gadget.ReadInfo(s.dir, nil)
-	c.Assert(err, ErrorMatches, "bootloader must be one of grub, u-boot, android-boot or lk")
+	c.Assert(err, ErrorMatches, "bootloader must be one of grub, systemd-boot, u-boot, android-boot or lk")
 }
 
 func (s *gadgetYamlTestSuite) TestReadGadgetYamlEmptyBootloader(c *C) {
@@ -590,6 +590,57 @@ defaults:
 	c.Assert(err, ErrorMatches, `default stanza not keyed by "system" or snap-id: foo`)
 }
 
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlKernelCmdline(c *C) {
+	mockGadgetYaml := []byte(`
+kernel-cmdline:
+  allow:
+    - isolcpus
+    - debug
+    - console=ttyS0,115200
+`)
+	err := ioutil.WriteFile(s.gadgetYamlPath, mockGadgetYaml, 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := gadget.ReadInfo(s.dir, nil)
+	c.Assert(err, IsNil)
+	c.Assert(ginfo.KernelCmdline.Allow, DeepEquals, []string{"isolcpus", "debug", "console=ttyS0,115200"})
+
+	for _, tc := range []struct {
+		arg     string
+		allowed bool
+	}{
+		{"isolcpus=1,2", true},
+		{"isolcpus", true},
+		{"debug", true},
+		{"debug=1", true},
+		{"console=ttyS0,115200", true},
+		{"console=tty1", false},
+		{"console", false},
+		{"quiet", false},
+	} {
+		c.Check(ginfo.KernelCmdline.Allows(tc.arg), Equals, tc.allowed, Commentf("%q", tc.arg))
+	}
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlKernelCmdlineInvalid(c *C) {
+	for _, tc := range []struct {
+		allow string
+		err   string
+	}{
+		{`""`, `invalid allowed kernel command line argument ""`},
+		{`"=1"`, `invalid allowed kernel command line argument "=1"`},
+		{`"foo bar"`, `invalid allowed kernel command line argument "foo bar"`},
+		{`snapd_recovery_mode`, `cannot allow reserved kernel command line argument "snapd_recovery_mode"`},
+	} {
+		mockGadgetYaml := []byte(fmt.Sprintf("kernel-cmdline:\n  allow:\n    - %s\n", tc.allow))
+		err := ioutil.WriteFile(s.gadgetYamlPath, mockGadgetYaml, 0644)
+		c.Assert(err, IsNil)
+
+		_, err = gadget.ReadInfo(s.dir, nil)
+		c.Check(err, ErrorMatches, tc.err)
+	}
+}
+
 func (s *gadgetYamlTestSuite) TestReadGadgetYamlInvalidConnection(c *C) {
 	mockGadgetYamlBroken := `
 connections:
@@ -1532,6 +1583,19 @@ func (s *gadgetYamlTestSuite) TestEnsureVolumeConsistency(c *C) {
 	vs.SystemSeed = &gadget.VolumeStructure{}
 	err = gadget.EnsureVolumeConsistency(vs, nil)
 	c.Assert(err, ErrorMatches, "the system-seed role requires system-data to be defined")
+
+	// Check system-save
+	vs = state(false, "")
+	vs.SystemSave = &gadget.VolumeStructure{}
+	err = gadget.EnsureVolumeConsistency(vs, nil)
+	c.Assert(err, ErrorMatches, "the system-save role requires system-seed to be defined")
+	vs = state(true, "")
+	vs.SystemSave = &gadget.VolumeStructure{}
+	err = gadget.EnsureVolumeConsistency(vs, nil)
+	c.Assert(err, IsNil)
+	vs.SystemSave.Label = "ubuntu-save"
+	err = gadget.EnsureVolumeConsistency(vs, nil)
+	c.Assert(err, ErrorMatches, "system-save structure must not have a label")
 }
 
 func (s *gadgetYamlTestSuite) TestGadgetConsistencyWithoutConstraints(c *C) {
@@ -32,6 +32,7 @@ import (
 
 const (
 	ubuntuDataLabel = "ubuntu-data"
+	ubuntuSaveLabel = "ubuntu-save"
 )
 
 func deviceFromRole(lv *gadget.LaidOutVolume, role string) (device string, err error) {
@@ -49,6 +50,15 @@ func deviceFromRole(lv *gadget.LaidOutVolume, role string) (device string, err e
 	return "", fmt.Errorf("cannot find role %s in gadget", role)
 }
 
+func structureWithRole(lv *gadget.LaidOutVolume, role string) *gadget.LaidOutStructure {
+	for i := range lv.LaidOutStructure {
+		if lv.LaidOutStructure[i].Role == role {
+			return &lv.LaidOutStructure[i]
+		}
+	}
+	return nil
+}
+
 // Run bootstraps the partitions of a device, by either creating
 // missing ones or recreating installed ones.
 func Run(gadgetRoot, device string, options Options, observer SystemInstallObserver) error {
@@ -83,8 +93,14 @@ func Run(gadgetRoot, device string, options Options, observer SystemInstallObser
 		return fmt.Errorf("gadget and %v partition table not compatible: %v", device, err)
 	}
 
-	// remove partitions added during a previous install attempt
-	if err := removeCreatedPartitions(diskLayout); err != nil {
+	// remove partitions added during a previous install attempt, ubuntu-save
+	// is kept when requested so that its contents survive
+	saveStructure := structureWithRole(lv, gadget.SystemSave)
+	var keep []gadget.Size
+	if options.KeepSave && saveStructure != nil {
+		keep = append(keep, saveStructure.StartOffset)
+	}
+	if err := removeCreatedPartitions(diskLayout, keep...); err != nil {
 		return fmt.Errorf("cannot remove partitions from previous install: %v", err)
 	}
 	// at this point we removed any existing partition, nuke any
@@ -102,9 +118,9 @@ func Run(gadgetRoot, device string, options Options, observer SystemInstallObser
 		return fmt.Errorf("cannot create the partitions: %v", err)
 	}
 
-	// We're currently generating a single encryption key, this may change later
-	// if we create multiple encrypted partitions.
-	var key secboot.EncryptionKey
+	// The data partition key is sealed, the ubuntu-save key is stored in
+	// the data partition. Both partitions share the recovery key.
+	var key, saveKey secboot.EncryptionKey
 	var rkey secboot.RecoveryKey
 
 	if options.Encrypt {
@@ -113,20 +129,37 @@ func Run(gadgetRoot, device string, options Options, observer SystemInstallObser
 			return fmt.Errorf("cannot create encryption key: %v", err)
 		}
 
-		rkey, err = secboot.NewRecoveryKey()
-		if err != nil {
-			return fmt.Errorf("cannot create recovery key: %v", err)
+		if options.SaveKey != nil {
+			saveKey = *options.SaveKey
+		} else {
+			saveKey, err = secboot.NewEncryptionKey()
+			if err != nil {
+				return fmt.Errorf("cannot create encryption key: %v", err)
+			}
+		}
+
+		if options.RecoveryKey != nil {
+			rkey = *options.RecoveryKey
+		} else {
+			rkey, err = secboot.NewRecoveryKey()
+			if err != nil {
+				return fmt.Errorf("cannot create recovery key: %v", err)
+			}
 		}
 	}
 
 	for _, part := range created {
-		if options.Encrypt && part.Role == gadget.SystemData {
-			dataPart, err := newEncryptedDevice(&part, key, ubuntuDataLabel)
+		if options.Encrypt && (part.Role == gadget.SystemData || part.Role == gadget.SystemSave) {
+			partKey, name := key, ubuntuDataLabel
+			if part.Role == gadget.SystemSave {
+				partKey, name = saveKey, ubuntuSaveLabel
+			}
+			dataPart, err := newEncryptedDevice(&part, partKey, name)
 			if err != nil {
 				return err
 			}
 
-			if err := dataPart.AddRecoveryKey(key, rkey); err != nil {
+			if err := dataPart.AddRecoveryKey(partKey, rkey); err != nil {
 				return err
 			}
 
@@ -166,6 +199,15 @@ func Run(gadgetRoot, device string, options Options, observer SystemInstallObser
 		return fmt.Errorf("cannot store recovery key: %v", err)
 	}
 
+	// Write the ubuntu-save key, it is used to unlock ubuntu-save once
+	// ubuntu-data is unlocked
+	if saveStructure != nil {
+		saveKeyFile := filepath.Join(boot.InstallHostFDEDataDir, "ubuntu-save.key")
+		if err := saveKey.Save(saveKeyFile); err != nil {
+			return fmt.Errorf("cannot store ubuntu-save key: %v", err)
+		}
+	}
+
 	if observer != nil {
 		observer.ChosenEncryptionKey(key)
 	}
@@ -29,6 +29,14 @@ type Options struct {
 	Mount bool
 	// Encrypt the data partition
 	Encrypt bool
+	// KeepSave preserves an existing ubuntu-save partition instead of
+	// recreating it
+	KeepSave bool
+	// SaveKey is the key of the preserved encrypted ubuntu-save partition
+	SaveKey *secboot.EncryptionKey
+	// RecoveryKey is the recovery key of the preserved encrypted
+	// ubuntu-save partition, it is reused for the new data partition
+	RecoveryKey *secboot.RecoveryKey
 }
 
 type SystemInstallObserver interface {
@@ -29,6 +29,7 @@ import (
 	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/strutil"
 )
 
 var (
@@ -67,14 +68,22 @@ func createMissingPartitions(dl *gadget.OnDiskVolume, pv *gadget.LaidOutVolume)
 	return created, nil
 }
 
-// removeCreatedPartitions removes partitions added during a previous install.
-func removeCreatedPartitions(dl *gadget.OnDiskVolume) error {
+// removeCreatedPartitions removes partitions added during a previous install,
+// except for the ones starting at the offsets listed in keep.
+func removeCreatedPartitions(dl *gadget.OnDiskVolume, keep ...gadget.Size) error {
 	indexes := make([]string, 0, len(dl.Structure))
+	var kept []string
 	for i, s := range dl.Structure {
-		if s.CreatedDuringInstall {
-			logger.Noticef("partition %s was created during previous install", s.Node)
-			indexes = append(indexes, strconv.Itoa(i+1))
+		if !s.CreatedDuringInstall {
+			continue
 		}
+		if isKept(s.StartOffset, keep) {
+			logger.Noticef("partition %s was created during previous install and is kept", s.Node)
+			kept = append(kept, s.Node)
+			continue
+		}
+		logger.Noticef("partition %s was created during previous install", s.Node)
+		indexes = append(indexes, strconv.Itoa(i+1))
 	}
 	if len(indexes) == 0 {
 		return nil
@@ -97,13 +106,28 @@ func removeCreatedPartitions(dl *gadget.OnDiskVolume) error {
 	}
 
 	// Ensure all created partitions were removed
-	if remaining := gadget.CreatedDuringInstall(dl); len(remaining) > 0 {
+	var remaining []string
+	for _, node := range gadget.CreatedDuringInstall(dl) {
+		if !strutil.ListContains(kept, node) {
+			remaining = append(remaining, node)
+		}
+	}
+	if len(remaining) > 0 {
 		return fmt.Errorf("cannot remove partitions: %s", strings.Join(remaining, ", "))
 	}
 
 	return nil
 }
 
+func isKept(offset gadget.Size, keep []gadget.Size) bool {
+	for _, k := range keep {
+		if k == offset {
+			return true
+		}
+	}
+	return false
+}
+
 // ensureNodeExists makes sure the device nodes for all device structures are
 // available and notified to udev, within a specified amount of time.
 func ensureNodesExistImpl(dss []gadget.OnDiskStructure, timeout time.Duration) error {
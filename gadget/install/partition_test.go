@@ -302,6 +302,28 @@ func (s *partitionTestSuite) TestRemovePartitionsError(c *C) {
 	c.Assert(err, ErrorMatches, "cannot remove partitions: /dev/node3")
 }
 
+func (s *partitionTestSuite) TestRemovePartitionsKeep(c *C) {
+	cmdSfdisk := testutil.MockCommand(c, "sfdisk", makeSfdiskScript(scriptPartitionsBiosSeedData))
+	defer cmdSfdisk.Restore()
+
+	cmdLsblk := testutil.MockCommand(c, "lsblk", makeLsblkScript(scriptPartitionsBiosSeedData))
+	defer cmdLsblk.Restore()
+
+	cmdPartx := testutil.MockCommand(c, "partx", "")
+	defer cmdPartx.Restore()
+
+	dl, err := gadget.OnDiskVolumeFromDevice("/dev/node")
+	c.Assert(err, IsNil)
+
+	// the partition created during install at 2461696 sectors is kept
+	err = install.RemoveCreatedPartitions(dl, 2461696*512)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmdSfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", "-d", "/dev/node"},
+	})
+}
+
 func (s *partitionTestSuite) TestEnsureNodesExist(c *C) {
 	const mockUdevadmScript = `err=%q; echo "$err"; [ -n "$err" ] && exit 1 || exit 0`
 	for _, tc := range []struct {
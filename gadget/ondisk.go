@@ -36,6 +36,7 @@ const (
 	ubuntuBootLabel = "ubuntu-boot"
 	ubuntuSeedLabel = "ubuntu-seed"
 	ubuntuDataLabel = "ubuntu-data"
+	ubuntuSaveLabel = "ubuntu-save"
 
 	sectorSize Size = 512
 
@@ -351,6 +352,8 @@ func BuildPartitionList(dl *OnDiskVolume, pv *LaidOutVolume) (sfdiskInput *bytes
 			s.Label = ubuntuSeedLabel
 		case SystemData:
 			s.Label = ubuntuDataLabel
+		case SystemSave:
+			s.Label = ubuntuSaveLabel
 		}
 
 		toBeCreated = append(toBeCreated, OnDiskStructure{
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	. "gopkg.in/check.v1"
 
@@ -428,6 +429,67 @@ func (s *ondiskTestSuite) TestBuildPartitionList(c *C) {
 	c.Assert(create, DeepEquals, []gadget.OnDiskStructure{mockOnDiskStructureWritable})
 }
 
+func (s *ondiskTestSuite) TestBuildPartitionListWithSave(c *C) {
+	cmdLsblk := testutil.MockCommand(c, "lsblk", mockLsblkScriptBiosSeed)
+	defer cmdLsblk.Restore()
+
+	gadgetRoot := c.MkDir()
+	err := makeMockGadget(gadgetRoot, strings.Replace(gadgetContent, `      - name: Writable
+`, `      - name: Save
+        role: system-save
+        filesystem: ext4
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 16M
+      - name: Writable
+`, 1))
+	c.Assert(err, IsNil)
+
+	ptable := gadget.SFDiskPartitionTable{
+		Label:    "gpt",
+		ID:       "9151F25B-CDF0-48F1-9EDE-68CBD616E2CA",
+		Device:   "/dev/node",
+		Unit:     "sectors",
+		FirstLBA: 34,
+		LastLBA:  8388574,
+		Partitions: []gadget.SFDiskPartition{
+			{
+				Node:  "/dev/node1",
+				Start: 2048,
+				Size:  2048,
+				Type:  "21686148-6449-6E6F-744E-656564454649",
+				UUID:  "2E59D969-52AB-430B-88AC-F83873519F6F",
+				Name:  "BIOS Boot",
+			},
+			{
+				Node:  "/dev/node2",
+				Start: 4096,
+				Size:  2457600,
+				Type:  "EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+				UUID:  "216c34ff-9be6-4787-9ab3-a4c1429c3e73",
+				Name:  "Recovery",
+			},
+		},
+	}
+
+	pv, err := gadget.PositionedVolumeFromGadget(gadgetRoot)
+	c.Assert(err, IsNil)
+
+	dl, err := gadget.OnDiskVolumeFromPartitionTable(ptable)
+	c.Assert(err, IsNil)
+
+	sfdiskInput, create := gadget.BuildPartitionList(dl, pv)
+	c.Assert(sfdiskInput.String(), Equals, `/dev/node3 : start=     2461696, size=       32768, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, name="Save", attrs="GUID:59"
+/dev/node4 : start=     2494464, size=     5894111, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, name="Writable", attrs="GUID:59"
+`)
+	c.Assert(create, HasLen, 2)
+	c.Check(create[0].Node, Equals, "/dev/node3")
+	c.Check(create[0].Role, Equals, "system-save")
+	c.Check(create[0].Label, Equals, "ubuntu-save")
+	c.Check(create[1].Node, Equals, "/dev/node4")
+	c.Check(create[1].Role, Equals, "system-data")
+	c.Check(create[1].Label, Equals, "ubuntu-data")
+}
+
 func (s *ondiskTestSuite) TestUpdatePartitionList(c *C) {
 	const mockSfdiskScriptBios = `
 >&2 echo "Some warning from sfdisk"
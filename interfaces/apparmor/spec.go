@@ -343,6 +343,43 @@ func (spec *Specification) AddOvername(si *snap.Info) {
 	spec.AddUpdateNS(buf.String())
 }
 
+// AddSaveData adds AppArmor snippets allowing the snap to use its data
+// directory on the ubuntu-save partition, for snaps asking for it.
+//
+// Specifically snap-update-ns will apply the following bind mount
+// - /var/lib/snapd/save/snap/foo_bar -> /var/snap/foo/save
+func (spec *Specification) AddSaveData(si *snap.Info) {
+	if !si.SaveData {
+		return
+	}
+
+	// Get tags describing all apps and hooks, the data is shared by the
+	// entire snap.
+	tags := make([]string, 0, len(si.Apps)+len(si.Hooks))
+	for _, app := range si.Apps {
+		tags = append(tags, app.SecurityTag())
+	}
+	for _, hook := range si.Hooks {
+		tags = append(tags, hook.SecurityTag())
+	}
+
+	if spec.snippets == nil {
+		spec.snippets = make(map[string][]string)
+	}
+	dir := si.SaveDataMountDir()
+	snippet := fmt.Sprintf("# Writable area on the ubuntu-save partition\n%s/ r,\n%s/** mrwklix,", dir, dir)
+	for _, tag := range tags {
+		spec.snippets[tag] = append(spec.snippets[tag], snippet)
+		sort.Strings(spec.snippets[tag])
+	}
+
+	emit := spec.AddUpdateNSf
+	emit("  # Allow bind mounting the data on the ubuntu-save partition\n")
+	emit("  mount options=(bind, rw) %s/ -> %s/,\n", si.CommonDataSaveDir(), dir)
+	emit("  umount %s/,\n", dir)
+	GenWritableProfile(emit, dir, 3) // At least /, /var/ and /var/snap/
+}
+
 // isProbably writable returns true if the path is probably representing writable area.
 func isProbablyWritable(path string) bool {
 	return strings.HasPrefix(path, "/var/snap/") || strings.HasPrefix(path, "/home/") || strings.HasPrefix(path, "/root/")
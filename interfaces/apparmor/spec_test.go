@@ -507,6 +507,34 @@ func (s *specSuite) TestApparmorOvernameSnippets(c *C) {
 	c.Assert(updateNS[0], Equals, profile)
 }
 
+func (s *specSuite) TestApparmorSaveDataSnippetsNotAskedFor(c *C) {
+	snapInfo := snaptest.MockInfo(c, snapTrivial, &snap.SideInfo{Revision: snap.R(42)})
+	s.spec.AddSaveData(snapInfo)
+	c.Assert(s.spec.Snippets(), HasLen, 0)
+	c.Assert(s.spec.UpdateNS(), HasLen, 0)
+}
+
+func (s *specSuite) TestApparmorSaveDataSnippets(c *C) {
+	snapInfo := snaptest.MockInfo(c, snapTrivial+"save-data: true\n", &snap.SideInfo{Revision: snap.R(42)})
+	snapInfo.InstanceKey = "instance"
+
+	s.spec.AddSaveData(snapInfo)
+	c.Assert(s.spec.Snippets(), DeepEquals, map[string][]string{
+		"snap.some-snap_instance.app": {`# Writable area on the ubuntu-save partition
+/var/snap/some-snap/save/ r,
+/var/snap/some-snap/save/** mrwklix,`},
+	})
+
+	profile := `  # Allow bind mounting the data on the ubuntu-save partition
+  mount options=(bind, rw) /var/lib/snapd/save/snap/some-snap_instance/ -> /var/snap/some-snap/save/,
+  umount /var/snap/some-snap/save/,
+  # Writable directory /var/snap/some-snap/save
+  /var/snap/some-snap/save/ rw,
+  /var/snap/some-snap/ rw,
+`
+	c.Assert(strings.Join(s.spec.UpdateNS(), ""), Equals, profile)
+}
+
 func (s *specSuite) TestUsesPtraceTrace(c *C) {
 	c.Assert(s.spec.UsesPtraceTrace(), Equals, false)
 	s.spec.SetUsesPtraceTrace()
@@ -140,6 +140,23 @@ func (spec *Specification) AddLayout(si *snap.Info) {
 	}
 }
 
+// AddSaveData records the bind mount of the data directory of the snap kept
+// on the ubuntu-save partition, for snaps asking for it. Nothing is added
+// when the directory does not exist, e.g. on devices without ubuntu-save.
+//
+// - /var/lib/snapd/save/snap/foo_bar -> /var/snap/foo/save
+func (spec *Specification) AddSaveData(info *snap.Info) {
+	if !info.SaveData || !osutil.IsDirectory(info.CommonDataSaveDir()) {
+		return
+	}
+	spec.AddMountEntry(osutil.MountEntry{
+		Name:    info.CommonDataSaveDir(),
+		Dir:     info.SaveDataMountDir(),
+		Type:    "none",
+		Options: []string{"bind", "rw"},
+	})
+}
+
 // MountEntries returns a copy of the added mount entries.
 func (spec *Specification) MountEntries() []osutil.MountEntry {
 	result := make([]osutil.MountEntry, 0, len(spec.overname)+len(spec.layout)+len(spec.general))
@@ -20,10 +20,13 @@
 package mount_test
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/ifacetest"
 	"github.com/snapcore/snapd/interfaces/mount"
@@ -206,6 +209,35 @@ layout:
 	})
 }
 
+func (s *specSuite) TestSaveDataMountEntries(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("")
+
+	snapInfo := &snap.Info{SideInfo: snap.SideInfo{RealName: "foo", Revision: snap.R(42)}, InstanceKey: "instance"}
+	c.Assert(os.MkdirAll(snapInfo.CommonDataSaveDir(), 0755), IsNil)
+
+	// the snap did not ask for it
+	s.spec.AddSaveData(snapInfo)
+	c.Assert(s.spec.MountEntries(), HasLen, 0)
+
+	snapInfo.SaveData = true
+	s.spec.AddSaveData(snapInfo)
+	c.Assert(s.spec.MountEntries(), DeepEquals, []osutil.MountEntry{
+		// /var/lib/snapd/save/snap/foo_instance -> /var/snap/foo/save
+		{Name: snapInfo.CommonDataSaveDir(), Dir: filepath.Join(dirs.SnapDataDir, "foo/save"), Type: "none", Options: []string{"bind", "rw"}},
+	})
+	c.Assert(s.spec.UserMountEntries(), HasLen, 0)
+}
+
+func (s *specSuite) TestSaveDataMountEntriesNoSave(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("")
+
+	snapInfo := &snap.Info{SideInfo: snap.SideInfo{RealName: "foo", Revision: snap.R(42)}, SaveData: true}
+	s.spec.AddSaveData(snapInfo)
+	c.Assert(s.spec.MountEntries(), HasLen, 0)
+}
+
 func (s *specSuite) TestParallelInstanceMountEntriesNoInstanceKey(c *C) {
 	snapInfo := &snap.Info{SideInfo: snap.SideInfo{RealName: "foo", Revision: snap.R(42)}}
 	s.spec.AddOvername(snapInfo)
@@ -0,0 +1,130 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package metrics_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/metrics"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type metricsSuite struct {
+	restore func()
+}
+
+var _ = Suite(&metricsSuite{})
+
+func (s *metricsSuite) SetUpTest(c *C) {
+	s.restore = metrics.MockRegistry()
+}
+
+func (s *metricsSuite) TearDownTest(c *C) {
+	s.restore()
+}
+
+func write(c *C) string {
+	var buf bytes.Buffer
+	c.Assert(metrics.Write(&buf), IsNil)
+	return buf.String()
+}
+
+func (s *metricsSuite) TestEmpty(c *C) {
+	c.Check(write(c), Equals, "# EOF\n")
+}
+
+func (s *metricsSuite) TestCounter(c *C) {
+	counter := metrics.NewCounterVec("test_changes", "Changes by outcome.", "kind", "status")
+	counter.Inc("install-snap", "Done")
+	counter.Inc("install-snap", "Done")
+	counter.Add(3, "remove-snap", "Error")
+	// unlabelled counters are fine too
+	metrics.NewCounterVec("test_bytes", "Bytes.").Add(1024)
+
+	c.Check(write(c), Equals, `# TYPE test_bytes counter
+# HELP test_bytes Bytes.
+test_bytes_total 1024
+# TYPE test_changes counter
+# HELP test_changes Changes by outcome.
+test_changes_total{kind="install-snap",status="Done"} 2
+test_changes_total{kind="remove-snap",status="Error"} 3
+# EOF
+`)
+
+	c.Check(func() { counter.Add(-1, "install-snap", "Done") }, PanicMatches, `internal error: cannot decrease counter "test_changes"`)
+	c.Check(func() { counter.Inc("install-snap") }, PanicMatches, `internal error: metric "test_changes" has 2 labels, got 1 values`)
+}
+
+func (s *metricsSuite) TestGauge(c *C) {
+	gauge := metrics.NewGaugeVec("test_size_bytes", "Size.")
+	gauge.Set(10)
+	gauge.Set(4.5)
+
+	c.Check(write(c), Equals, `# TYPE test_size_bytes gauge
+# HELP test_size_bytes Size.
+test_size_bytes 4.5
+# EOF
+`)
+}
+
+func (s *metricsSuite) TestHistogram(c *C) {
+	hist := metrics.NewHistogramVec("test_seconds", "Durations.", []float64{0.1, 1}, "kind")
+	hist.Observe(0.05, "a")
+	hist.Observe(0.5, "a")
+	hist.Observe(2, "a")
+	hist.Observe(math.Inf(1), "b")
+
+	c.Check(write(c), Equals, `# TYPE test_seconds histogram
+# HELP test_seconds Durations.
+test_seconds_bucket{kind="a",le="0.1"} 1
+test_seconds_bucket{kind="a",le="1"} 2
+test_seconds_bucket{kind="a",le="+Inf"} 3
+test_seconds_count{kind="a"} 3
+test_seconds_sum{kind="a"} 2.55
+test_seconds_bucket{kind="b",le="0.1"} 0
+test_seconds_bucket{kind="b",le="1"} 0
+test_seconds_bucket{kind="b",le="+Inf"} 1
+test_seconds_count{kind="b"} 1
+test_seconds_sum{kind="b"} +Inf
+# EOF
+`)
+
+	c.Check(func() { metrics.NewHistogramVec("test_unsorted", "", []float64{1, 0.1}) }, PanicMatches, `internal error: buckets of histogram "test_unsorted" are not sorted`)
+}
+
+func (s *metricsSuite) TestLabelValuesEscaped(c *C) {
+	metrics.NewCounterVec("test_escaped", "Escaped.", "v").Inc("a\"b\\c\nd")
+
+	c.Check(write(c), Equals, `# TYPE test_escaped counter
+# HELP test_escaped Escaped.
+test_escaped_total{v="a\"b\\c\nd"} 1
+# EOF
+`)
+}
+
+func (s *metricsSuite) TestRegisterTwice(c *C) {
+	metrics.NewCounterVec("test_twice", "")
+	c.Check(func() { metrics.NewGaugeVec("test_twice", "") }, PanicMatches, `internal error: metric "test_twice" registered twice`)
+}
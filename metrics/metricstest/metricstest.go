@@ -0,0 +1,53 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package metricstest contains helpers to check metrics in tests.
+package metricstest
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/metrics"
+)
+
+// Sample returns the current value of the given sample, written as in the
+// OpenMetrics output (e.g. `snapd_changes_total{kind="install-snap",status="Done"}`),
+// or 0 if there is no such sample yet.
+func Sample(c *check.C, sample string) float64 {
+	var buf bytes.Buffer
+	c.Assert(metrics.Write(&buf), check.IsNil)
+
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, sample+" ") {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimPrefix(line, sample+" "), 64)
+		c.Assert(err, check.IsNil)
+		return v
+	}
+	c.Assert(scanner.Err(), check.IsNil)
+	return 0
+}
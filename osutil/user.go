@@ -21,6 +21,7 @@ package osutil
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
@@ -28,6 +29,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/snapcore/snapd/osutil/sys"
 )
@@ -199,8 +201,8 @@ func AddUser(name string, opts *AddUserOptions) error {
 	}
 
 	if opts.Sudoer {
-		if err := AtomicWriteFile(sudoersFile(name), []byte(fmt.Sprintf(sudoersTemplate, name)), 0400, 0); err != nil {
-			return fmt.Errorf("cannot create file under sudoers.d: %s", err)
+		if err := SetUserSudoer(name, true); err != nil {
+			return err
 		}
 	}
 
@@ -230,6 +232,11 @@ func AddUser(name string, opts *AddUserOptions) error {
 		}
 	}
 
+	return SetUserSSHKeys(name, opts.SSHKeys)
+}
+
+// SetUserSSHKeys replaces the authorized ssh keys of the given user.
+func SetUserSSHKeys(name string, sshKeys []string) error {
 	u, err := userLookup(name)
 	if err != nil {
 		return fmt.Errorf("cannot find user %q: %s", name, err)
@@ -245,7 +252,7 @@ func AddUser(name string, opts *AddUserOptions) error {
 		return fmt.Errorf("cannot create %s: %s", sshDir, err)
 	}
 	authKeys := filepath.Join(sshDir, "authorized_keys")
-	authKeysContent := strings.Join(opts.SSHKeys, "\n")
+	authKeysContent := strings.Join(sshKeys, "\n")
 	if err := AtomicWriteFileChown(authKeys, []byte(authKeysContent), 0600, 0, uid, gid); err != nil {
 		return fmt.Errorf("cannot write %s: %s", authKeys, err)
 	}
@@ -253,6 +260,113 @@ func AddUser(name string, opts *AddUserOptions) error {
 	return nil
 }
 
+// SetUserSudoer grants or revokes passwordless sudo for the given user.
+func SetUserSudoer(name string, sudoer bool) error {
+	if !sudoer {
+		if err := os.Remove(sudoersFile(name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove sudoers file for user %q: %v", name, err)
+		}
+		return nil
+	}
+	if err := AtomicWriteFile(sudoersFile(name), []byte(fmt.Sprintf(sudoersTemplate, name)), 0400, 0); err != nil {
+		return fmt.Errorf("cannot create file under sudoers.d: %s", err)
+	}
+	return nil
+}
+
+// SetUserExpiry sets the date on which the account of the given user gets
+// disabled, the zero time means the account never expires.
+func SetUserExpiry(name string, expiry time.Time) error {
+	// -1 removes the expiry
+	date := "-1"
+	if !expiry.IsZero() {
+		date = expiry.Format("2006-01-02")
+	}
+	cmdStr := []string{
+		"usermod",
+		"--expiredate", date,
+		// no --extrauser required, see LP: #1562872
+		name,
+	}
+	if output, err := exec.Command(cmdStr[0], cmdStr[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot set expiry of user %q: %s", name, OutputErr(output, err))
+	}
+	return nil
+}
+
+// UsersWithGecos returns the names of the local users with the given gecos,
+// as listed by getent(1), that knows about extrausers too.
+func UsersWithGecos(gecos string) ([]string, error) {
+	output, err := exec.Command("getent", "passwd").Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list users: %v", OutputErr(output, err))
+	}
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		// name:password:uid:gid:gecos:home:shell
+		fields := strings.Split(line, ":")
+		if len(fields) != 7 {
+			continue
+		}
+		// adduser may add empty room number, phones etc
+		if strings.TrimRight(fields[4], ",") == gecos {
+			names = append(names, fields[0])
+		}
+	}
+	return names, nil
+}
+
+// UserSSHKeys returns the authorized ssh keys of the given user.
+func UserSSHKeys(name string) ([]string, error) {
+	u, err := userLookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find user %q: %s", name, err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(u.HomeDir, ".ssh", "authorized_keys"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sshKeys []string
+	for _, key := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(key) != "" {
+			sshKeys = append(sshKeys, key)
+		}
+	}
+	return sshKeys, nil
+}
+
+// IsUserSudoer returns whether the given user was granted passwordless sudo
+// by AddUser or SetUserSudoer.
+func IsUserSudoer(name string) bool {
+	return FileExists(sudoersFile(name))
+}
+
+// UserExpiry returns the date on which the account of the given user gets
+// disabled, the zero time means the account never expires.
+func UserExpiry(name string) (time.Time, error) {
+	output, err := exec.Command("getent", "shadow", name).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot get expiry of user %q: %v", name, OutputErr(output, err))
+	}
+	// name:password:lastchange:min:max:warn:inactive:expire:reserved
+	fields := strings.Split(strings.TrimSpace(string(output)), ":")
+	if len(fields) != 9 {
+		return time.Time{}, fmt.Errorf("cannot get expiry of user %q: unexpected shadow entry", name)
+	}
+	if fields[7] == "" {
+		return time.Time{}, nil
+	}
+	// in days since the epoch
+	days, err := strconv.Atoi(fields[7])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot get expiry of user %q: %v", name, err)
+	}
+	return time.Unix(0, 0).UTC().AddDate(0, 0, days), nil
+}
+
 type DelUserOptions struct {
 	ExtraUsers bool
 }
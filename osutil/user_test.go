@@ -26,6 +26,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -132,6 +133,111 @@ func (s *createUserSuite) TestAddUserSSHKeys(c *check.C) {
 
 }
 
+func (s *createUserSuite) TestSetUserSSHKeys(c *check.C) {
+	err := osutil.SetUserSSHKeys("karl.sagan", []string{"ssh-key3"})
+	c.Assert(err, check.IsNil)
+	c.Check(filepath.Join(s.mockHome, ".ssh", "authorized_keys"), testutil.FileEquals, "ssh-key3")
+}
+
+func (s *createUserSuite) TestSetUserSudoer(c *check.C) {
+	mockSudoers := c.MkDir()
+	restorer := osutil.MockSudoersDotD(mockSudoers)
+	defer restorer()
+
+	err := osutil.SetUserSudoer("karl.sagan", true)
+	c.Assert(err, check.IsNil)
+	sudoersFile := filepath.Join(mockSudoers, "create-user-karl%2Esagan")
+	c.Check(sudoersFile, testutil.FileContains, "karl.sagan ALL=(ALL) NOPASSWD:ALL\n")
+
+	err = osutil.SetUserSudoer("karl.sagan", false)
+	c.Assert(err, check.IsNil)
+	c.Check(sudoersFile, testutil.FileAbsent)
+
+	// revoking is idempotent
+	err = osutil.SetUserSudoer("karl.sagan", false)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *createUserSuite) TestSetUserExpiry(c *check.C) {
+	err := osutil.SetUserExpiry("karl.sagan", time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	err = osutil.SetUserExpiry("karl.sagan", time.Time{})
+	c.Assert(err, check.IsNil)
+
+	c.Check(s.mockUserMod.Calls(), check.DeepEquals, [][]string{
+		{"usermod", "--expiredate", "2021-03-04", "karl.sagan"},
+		{"usermod", "--expiredate", "-1", "karl.sagan"},
+	})
+}
+
+func (s *createUserSuite) TestSetUserExpiryUnhappy(c *check.C) {
+	mockUserMod := testutil.MockCommand(c, "usermod", "echo some error; exit 1")
+	defer mockUserMod.Restore()
+
+	err := osutil.SetUserExpiry("karl.sagan", time.Time{})
+	c.Assert(err, check.ErrorMatches, `cannot set expiry of user "karl.sagan": some error`)
+}
+
+func (s *createUserSuite) TestUsersWithGecos(c *check.C) {
+	mockGetent := testutil.MockCommand(c, "getent", `cat <<EOF
+root:x:0:0:root:/root:/bin/bash
+alice:x:1000:1000:managed by snapd,,,:/home/alice:/bin/bash
+bob:x:1001:1001:Bob:/home/bob:/bin/bash
+karl.sagan:x:1002:1002:managed by snapd:/home/karl.sagan:/bin/bash
+EOF`)
+	defer mockGetent.Restore()
+
+	names, err := osutil.UsersWithGecos("managed by snapd")
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"alice", "karl.sagan"})
+	c.Check(mockGetent.Calls(), check.DeepEquals, [][]string{{"getent", "passwd"}})
+}
+
+func (s *createUserSuite) TestUserSSHKeys(c *check.C) {
+	keys, err := osutil.UserSSHKeys("karl.sagan")
+	c.Assert(err, check.IsNil)
+	c.Check(keys, check.HasLen, 0)
+
+	err = osutil.SetUserSSHKeys("karl.sagan", []string{"ssh-key1", "ssh-key2"})
+	c.Assert(err, check.IsNil)
+	keys, err = osutil.UserSSHKeys("karl.sagan")
+	c.Assert(err, check.IsNil)
+	c.Check(keys, check.DeepEquals, []string{"ssh-key1", "ssh-key2"})
+}
+
+func (s *createUserSuite) TestIsUserSudoer(c *check.C) {
+	restorer := osutil.MockSudoersDotD(c.MkDir())
+	defer restorer()
+
+	c.Check(osutil.IsUserSudoer("karl.sagan"), check.Equals, false)
+	c.Assert(osutil.SetUserSudoer("karl.sagan", true), check.IsNil)
+	c.Check(osutil.IsUserSudoer("karl.sagan"), check.Equals, true)
+}
+
+func (s *createUserSuite) TestUserExpiry(c *check.C) {
+	mockGetent := testutil.MockCommand(c, "getent", `echo 'karl.sagan:!:18500:0:99999:7::18690:'`)
+	defer mockGetent.Restore()
+
+	expiry, err := osutil.UserExpiry("karl.sagan")
+	c.Assert(err, check.IsNil)
+	c.Check(expiry.Equal(time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)), check.Equals, true)
+	c.Check(mockGetent.Calls(), check.DeepEquals, [][]string{{"getent", "shadow", "karl.sagan"}})
+
+	mockGetent.Restore()
+	mockGetent = testutil.MockCommand(c, "getent", `echo 'karl.sagan:!:18500:0:99999:7:::'`)
+	expiry, err = osutil.UserExpiry("karl.sagan")
+	c.Assert(err, check.IsNil)
+	c.Check(expiry.IsZero(), check.Equals, true)
+}
+
+func (s *createUserSuite) TestUserExpiryUnhappy(c *check.C) {
+	mockGetent := testutil.MockCommand(c, "getent", "exit 2")
+	defer mockGetent.Restore()
+
+	_, err := osutil.UserExpiry("karl.sagan")
+	c.Assert(err, check.ErrorMatches, `cannot get expiry of user "karl.sagan": exit status 2`)
+}
+
 func (s *createUserSuite) TestAddUserInvalidUsername(c *check.C) {
 	err := osutil.AddUser("k!", nil)
 	c.Assert(err, check.ErrorMatches, `cannot add user "k!": name contains invalid characters`)
@@ -39,6 +39,9 @@ type AuthState struct {
 	Users       []UserState  `json:"users"`
 	Device      *DeviceState `json:"device,omitempty"`
 	MacaroonKey []byte       `json:"macaroon-key,omitempty"`
+
+	LastTokenID int          `json:"last-token-id,omitempty"`
+	Tokens      []TokenState `json:"tokens,omitempty"`
 }
 
 // DeviceState represents the device's identity and store credentials
@@ -0,0 +1,263 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// ReadAction is the action of a scope that allows GET requests.
+const ReadAction = "read"
+
+// TokenScope describes the part of the API a token grants access to.
+type TokenScope struct {
+	// Endpoint is the API path as registered by the daemon, e.g.
+	// "/v2/changes" or "/v2/snaps/{name}".
+	Endpoint string `json:"endpoint"`
+	// Actions are the allowed actions: ReadAction covers GET requests,
+	// the others are the actions of the requests to the endpoint,
+	// e.g. "refresh" or "restart".
+	Actions []string `json:"actions"`
+	// Snaps, if set, restricts the scope to requests about only those
+	// snaps.
+	Snaps []string `json:"snaps,omitempty"`
+}
+
+// allows returns whether the scope covers the given request.
+func (sc *TokenScope) allows(endpoint, action string, snaps []string) bool {
+	if sc.Endpoint != endpoint || !strutil.ListContains(sc.Actions, action) {
+		return false
+	}
+	if len(sc.Snaps) == 0 {
+		return true
+	}
+	if len(snaps) == 0 {
+		// a snap restricted scope does not cover requests about
+		// all snaps
+		return false
+	}
+	for _, snap := range snaps {
+		if !strutil.ListContains(sc.Snaps, snap) {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenState represents a scoped API access token minted by root.
+type TokenState struct {
+	ID    int    `json:"id"`
+	Label string `json:"label,omitempty"`
+	// Digest is the hex encoded SHA256 of the token, the token itself
+	// is only known to whoever minted it.
+	Digest  string       `json:"digest"`
+	Scopes  []TokenScope `json:"scopes"`
+	Created time.Time    `json:"created"`
+	// Expires is when the token stops being valid, the zero time means
+	// never.
+	Expires time.Time `json:"expires"`
+	// CertFingerprint is the hex encoded SHA256 of the DER client
+	// certificate the token is bound to, if any. Such tokens are used by
+	// presenting the certificate to the TLS listener.
+	CertFingerprint string `json:"cert-fingerprint,omitempty"`
+}
+
+// Allows returns whether the token grants the given action on the endpoint
+// for the given snaps.
+func (t *TokenState) Allows(endpoint, action string, snaps []string) bool {
+	for i := range t.Scopes {
+		if t.Scopes[i].allows(endpoint, action, snaps) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TokenState) expired() bool {
+	return !t.Expires.IsZero() && !timeNow().Before(t.Expires)
+}
+
+var timeNow = time.Now
+
+var ErrInvalidToken = errors.New("invalid token")
+
+func tokenDigest(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// NewToken mints a token with the given scopes, valid until expires (or
+// forever, if zero). It returns the token state and the token itself, which
+// is not kept.
+func NewToken(st *state.State, label string, scopes []TokenScope, expires time.Time) (*TokenState, string, error) {
+	return newToken(st, label, "", scopes, expires)
+}
+
+// NewCertToken mints a token with the given scopes, valid until expires (or
+// forever, if zero), bound to the client certificate with the given
+// fingerprint instead of being handed out.
+func NewCertToken(st *state.State, label, certFingerprint string, scopes []TokenScope, expires time.Time) (*TokenState, error) {
+	if certFingerprint == "" {
+		return nil, fmt.Errorf("cannot create a certificate token without a certificate")
+	}
+	tok, _, err := newToken(st, label, certFingerprint, scopes, expires)
+	return tok, err
+}
+
+func newToken(st *state.State, label, certFingerprint string, scopes []TokenScope, expires time.Time) (*TokenState, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("cannot create a token without scopes")
+	}
+	for _, sc := range scopes {
+		if sc.Endpoint == "" || len(sc.Actions) == 0 {
+			return nil, "", fmt.Errorf("cannot create a token with a scope missing its endpoint or actions")
+		}
+	}
+
+	var authStateData AuthState
+	err := st.Get("auth", &authStateData)
+	if err != nil && err != state.ErrNoState {
+		return nil, "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	authStateData.LastTokenID++
+	tokenState := TokenState{
+		ID:      authStateData.LastTokenID,
+		Label:   label,
+		Digest:  tokenDigest(token),
+		Scopes:  scopes,
+		Created: timeNow().UTC(),
+
+		CertFingerprint: certFingerprint,
+	}
+	if !expires.IsZero() {
+		tokenState.Expires = expires.UTC()
+	}
+	authStateData.Tokens = append(authStateData.Tokens, tokenState)
+
+	st.Set("auth", authStateData)
+
+	return &tokenState, token, nil
+}
+
+// Tokens returns the tokens minted so far and not removed, expired ones
+// included.
+func Tokens(st *state.State) ([]*TokenState, error) {
+	var authStateData AuthState
+
+	err := st.Get("auth", &authStateData)
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*TokenState, len(authStateData.Tokens))
+	for i := range authStateData.Tokens {
+		tokens[i] = &authStateData.Tokens[i]
+	}
+	return tokens, nil
+}
+
+// RemoveToken revokes the token with the given ID.
+func RemoveToken(st *state.State, id int) (removed *TokenState, err error) {
+	var authStateData AuthState
+
+	err = st.Get("auth", &authStateData)
+	if err == state.ErrNoState {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range authStateData.Tokens {
+		if authStateData.Tokens[i].ID == id {
+			removed := authStateData.Tokens[i]
+			authStateData.Tokens = append(authStateData.Tokens[:i], authStateData.Tokens[i+1:]...)
+			st.Set("auth", authStateData)
+			return &removed, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// CheckToken returns the TokenState for the given token, if it is known and
+// has not expired. Tokens bound to a certificate are not accepted.
+func CheckToken(st *state.State, token string) (*TokenState, error) {
+	digest := tokenDigest(token)
+	return checkToken(st, func(t *TokenState) bool {
+		return t.CertFingerprint == "" && subtle.ConstantTimeCompare([]byte(t.Digest), []byte(digest)) == 1
+	})
+}
+
+// CheckCertToken returns the TokenState bound to the client certificate with
+// the given fingerprint, if there is one and it has not expired.
+func CheckCertToken(st *state.State, certFingerprint string) (*TokenState, error) {
+	if certFingerprint == "" {
+		return nil, ErrInvalidAuth
+	}
+	return checkToken(st, func(t *TokenState) bool {
+		return t.CertFingerprint == certFingerprint
+	})
+}
+
+func checkToken(st *state.State, p func(*TokenState) bool) (*TokenState, error) {
+	var authStateData AuthState
+	if err := st.Get("auth", &authStateData); err != nil {
+		return nil, ErrInvalidAuth
+	}
+
+	for i := range authStateData.Tokens {
+		t := &authStateData.Tokens[i]
+		if !p(t) {
+			continue
+		}
+		if t.expired() {
+			return nil, ErrInvalidAuth
+		}
+		return t, nil
+	}
+	return nil, ErrInvalidAuth
+}
+
+// CertFingerprint returns the fingerprint of a DER encoded certificate as
+// used by certificate tokens.
+func CertFingerprint(der []byte) string {
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,190 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package auth_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+var monitoringScopes = []auth.TokenScope{
+	{Endpoint: "/v2/changes", Actions: []string{"read"}},
+	{Endpoint: "/v2/snaps", Actions: []string{"refresh"}, Snaps: []string{"foo", "bar"}},
+	{Endpoint: "/v2/apps", Actions: []string{"start", "stop", "restart"}, Snaps: []string{"baz"}},
+}
+
+func (as *authSuite) TestNewTokenAndCheck(c *C) {
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	defer auth.MockTimeNow(func() time.Time { return now })()
+
+	as.state.Lock()
+	defer as.state.Unlock()
+
+	tok, token, err := auth.NewToken(as.state, "monitoring", monitoringScopes, time.Time{})
+	c.Assert(err, IsNil)
+	c.Check(token, HasLen, 43)
+	c.Check(tok.ID, Equals, 1)
+	c.Check(tok.Label, Equals, "monitoring")
+	c.Check(tok.Created.Equal(now), Equals, true)
+	c.Check(tok.Expires.IsZero(), Equals, true)
+	// only a digest of the token is kept
+	c.Check(tok.Digest, Not(Equals), token)
+	c.Check(tok.Digest, HasLen, 64)
+
+	checked, err := auth.CheckToken(as.state, token)
+	c.Assert(err, IsNil)
+	c.Check(checked, DeepEquals, tok)
+
+	_, err = auth.CheckToken(as.state, "bogus")
+	c.Check(err, Equals, auth.ErrInvalidAuth)
+
+	tok2, token2, err := auth.NewToken(as.state, "", monitoringScopes[:1], time.Time{})
+	c.Assert(err, IsNil)
+	c.Check(tok2.ID, Equals, 2)
+	c.Check(token2, Not(Equals), token)
+
+	tokens, err := auth.Tokens(as.state)
+	c.Assert(err, IsNil)
+	c.Check(tokens, DeepEquals, []*auth.TokenState{tok, tok2})
+}
+
+func (as *authSuite) TestNewTokenErrors(c *C) {
+	as.state.Lock()
+	defer as.state.Unlock()
+
+	_, _, err := auth.NewToken(as.state, "", nil, time.Time{})
+	c.Check(err, ErrorMatches, "cannot create a token without scopes")
+	_, _, err = auth.NewToken(as.state, "", []auth.TokenScope{{Endpoint: "/v2/changes"}}, time.Time{})
+	c.Check(err, ErrorMatches, "cannot create a token with a scope missing its endpoint or actions")
+	_, _, err = auth.NewToken(as.state, "", []auth.TokenScope{{Actions: []string{"read"}}}, time.Time{})
+	c.Check(err, ErrorMatches, "cannot create a token with a scope missing its endpoint or actions")
+}
+
+func (as *authSuite) TestCheckTokenExpired(c *C) {
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	defer auth.MockTimeNow(func() time.Time { return now })()
+
+	as.state.Lock()
+	defer as.state.Unlock()
+
+	tok, token, err := auth.NewToken(as.state, "", monitoringScopes, now.Add(time.Hour))
+	c.Assert(err, IsNil)
+	c.Check(tok.Expires.Equal(now.Add(time.Hour)), Equals, true)
+
+	_, err = auth.CheckToken(as.state, token)
+	c.Check(err, IsNil)
+
+	now = now.Add(time.Hour)
+	_, err = auth.CheckToken(as.state, token)
+	c.Check(err, Equals, auth.ErrInvalidAuth)
+}
+
+func (as *authSuite) TestRemoveToken(c *C) {
+	as.state.Lock()
+	defer as.state.Unlock()
+
+	_, err := auth.RemoveToken(as.state, 1)
+	c.Check(err, Equals, auth.ErrInvalidToken)
+
+	tok, token, err := auth.NewToken(as.state, "", monitoringScopes, time.Time{})
+	c.Assert(err, IsNil)
+	// users are not affected by tokens
+	_, err = auth.NewUser(as.state, "username", "email@test.com", "macaroon", nil)
+	c.Assert(err, IsNil)
+
+	removed, err := auth.RemoveToken(as.state, tok.ID)
+	c.Assert(err, IsNil)
+	c.Check(removed, DeepEquals, tok)
+
+	_, err = auth.CheckToken(as.state, token)
+	c.Check(err, Equals, auth.ErrInvalidAuth)
+	tokens, err := auth.Tokens(as.state)
+	c.Assert(err, IsNil)
+	c.Check(tokens, HasLen, 0)
+	_, err = auth.RemoveToken(as.state, tok.ID)
+	c.Check(err, Equals, auth.ErrInvalidToken)
+
+	users, err := auth.Users(as.state)
+	c.Assert(err, IsNil)
+	c.Check(users, HasLen, 1)
+}
+
+func (as *authSuite) TestTokenAllows(c *C) {
+	tok := &auth.TokenState{Scopes: monitoringScopes}
+
+	for _, t := range []struct {
+		endpoint string
+		action   string
+		snaps    []string
+		allowed  bool
+	}{
+		{"/v2/changes", "read", nil, true},
+		{"/v2/changes", "abort", nil, false},
+		{"/v2/change/{id}", "read", nil, false},
+		{"/v2/snaps", "refresh", []string{"foo"}, true},
+		{"/v2/snaps", "refresh", []string{"foo", "bar"}, true},
+		{"/v2/snaps", "refresh", []string{"foo", "other"}, false},
+		// refreshing all snaps is not covered
+		{"/v2/snaps", "refresh", nil, false},
+		{"/v2/snaps", "remove", []string{"foo"}, false},
+		{"/v2/apps", "restart", []string{"baz"}, true},
+		{"/v2/apps", "read", []string{"baz"}, false},
+	} {
+		c.Check(tok.Allows(t.endpoint, t.action, t.snaps), Equals, t.allowed, Commentf("%v", t))
+	}
+}
+
+func (as *authSuite) TestNewCertTokenAndCheck(c *C) {
+	as.state.Lock()
+	defer as.state.Unlock()
+
+	fingerprint := auth.CertFingerprint([]byte("der data"))
+	c.Check(fingerprint, HasLen, 64)
+
+	_, err := auth.NewCertToken(as.state, "", "", monitoringScopes, time.Time{})
+	c.Check(err, ErrorMatches, "cannot create a certificate token without a certificate")
+
+	tok, err := auth.NewCertToken(as.state, "lab", fingerprint, monitoringScopes, time.Time{})
+	c.Assert(err, IsNil)
+	c.Check(tok.CertFingerprint, Equals, fingerprint)
+
+	checked, err := auth.CheckCertToken(as.state, fingerprint)
+	c.Assert(err, IsNil)
+	c.Check(checked, DeepEquals, tok)
+
+	_, err = auth.CheckCertToken(as.state, auth.CertFingerprint([]byte("other")))
+	c.Check(err, Equals, auth.ErrInvalidAuth)
+	_, err = auth.CheckCertToken(as.state, "")
+	c.Check(err, Equals, auth.ErrInvalidAuth)
+
+	// plain tokens are not usable by certificate and the other way round
+	plain, token, err := auth.NewToken(as.state, "", monitoringScopes, time.Time{})
+	c.Assert(err, IsNil)
+	c.Check(plain.CertFingerprint, Equals, "")
+	checked, err = auth.CheckCertToken(as.state, fingerprint)
+	c.Assert(err, IsNil)
+	c.Check(checked.ID, Equals, tok.ID)
+	checked, err = auth.CheckToken(as.state, token)
+	c.Assert(err, IsNil)
+	c.Check(checked.ID, Equals, plain.ID)
+}
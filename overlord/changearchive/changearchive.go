@@ -0,0 +1,238 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package changearchive keeps a record of the changes pruned from the
+// state in a size-bounded, rotating log on disk.
+package changearchive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	// maxFileSize is the size after which the current archive file is
+	// rotated.
+	maxFileSize int64 = 4 * 1024 * 1024
+	// maxRotatedFiles is how many rotated archive files are kept in
+	// addition to the current one.
+	maxRotatedFiles = 3
+)
+
+// Record is the archived form of a change.
+type Record struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Summary   string     `json:"summary"`
+	Status    string     `json:"status"`
+	Err       string     `json:"err,omitempty"`
+	SpawnTime time.Time  `json:"spawn-time"`
+	ReadyTime *time.Time `json:"ready-time,omitempty"`
+	SnapNames []string   `json:"snap-names,omitempty"`
+
+	Data map[string]*json.RawMessage `json:"data,omitempty"`
+
+	Tasks []*TaskRecord `json:"tasks,omitempty"`
+}
+
+// TaskRecord is the archived form of a task.
+type TaskRecord struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Summary   string     `json:"summary"`
+	Status    string     `json:"status"`
+	Log       []string   `json:"log,omitempty"`
+	SpawnTime time.Time  `json:"spawn-time"`
+	ReadyTime *time.Time `json:"ready-time,omitempty"`
+}
+
+func archiveFile() string {
+	return filepath.Join(dirs.SnapChangesArchiveDir, "changes.log")
+}
+
+func rotatedFile(n int) string {
+	return fmt.Sprintf("%s.%d", archiveFile(), n)
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// NewRecord returns the archived form of the given change.
+func NewRecord(chg *state.Change) *Record {
+	rec := &Record{
+		ID:        chg.ID(),
+		Kind:      chg.Kind(),
+		Summary:   chg.Summary(),
+		Status:    chg.Status().String(),
+		SpawnTime: chg.SpawnTime(),
+		ReadyTime: timePtr(chg.ReadyTime()),
+	}
+	if err := chg.Err(); err != nil {
+		rec.Err = err.Error()
+	}
+	// errors are ignored, the data is optional
+	chg.Get("snap-names", &rec.SnapNames)
+	chg.Get("api-data", &rec.Data)
+
+	for _, t := range chg.Tasks() {
+		rec.Tasks = append(rec.Tasks, &TaskRecord{
+			ID:        t.ID(),
+			Kind:      t.Kind(),
+			Summary:   t.Summary(),
+			Status:    t.Status().String(),
+			Log:       t.Log(),
+			SpawnTime: t.SpawnTime(),
+			ReadyTime: timePtr(t.ReadyTime()),
+		})
+	}
+	return rec
+}
+
+// rotate moves the current archive file to the first rotated slot,
+// shifting the older ones and dropping the oldest.
+func rotate() error {
+	if err := os.Remove(rotatedFile(maxRotatedFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := maxRotatedFiles - 1; n > 0; n-- {
+		if err := os.Rename(rotatedFile(n), rotatedFile(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if maxRotatedFiles == 0 {
+		return os.Remove(archiveFile())
+	}
+	return os.Rename(archiveFile(), rotatedFile(1))
+}
+
+// Append adds the given change to the archive, rotating the archive
+// files as needed.
+func Append(chg *state.Change) error {
+	line, err := json.Marshal(NewRecord(chg))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(dirs.SnapChangesArchiveDir, 0700); err != nil {
+		return err
+	}
+	fi, err := os.Stat(archiveFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && fi.Size() > 0 && fi.Size()+int64(len(line)) > maxFileSize {
+		if err := rotate(); err != nil {
+			return fmt.Errorf("cannot rotate change archive: %v", err)
+		}
+	}
+
+	f, err := os.OpenFile(archiveFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readFile(fn string, recs []*Record) ([]*Record, error) {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return recs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, int(maxFileSize)+1)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// a truncated last line is not fatal
+			logger.Noticef("cannot decode archived change in %s: %v", fn, err)
+			continue
+		}
+		recs = append(recs, &rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read change archive: %v", err)
+	}
+	return recs, nil
+}
+
+// Read returns all the archived changes, oldest first.
+func Read() ([]*Record, error) {
+	var recs []*Record
+	var err error
+	for n := maxRotatedFiles; n > 0; n-- {
+		recs, err = readFile(rotatedFile(n), recs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return readFile(archiveFile(), recs)
+}
+
+// Enabled returns whether archiving of pruned changes is enabled
+// through the core changes.archive option.
+func Enabled(st *state.State) (bool, error) {
+	// the option can be set both as a boolean and as a string
+	var v interface{}
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "changes.archive", &v); err != nil && !config.IsNoOption(err) {
+		return false, err
+	}
+	return fmt.Sprintf("%v", v) == "true", nil
+}
+
+// Setup arranges for the changes pruned from the state to be archived
+// when enabled.
+func Setup(st *state.State) {
+	st.OnPrune(func(chg *state.Change) {
+		enabled, err := Enabled(st)
+		if err != nil {
+			logger.Noticef("cannot get changes.archive option: %v", err)
+			return
+		}
+		if !enabled {
+			return
+		}
+		if err := Append(chg); err != nil {
+			logger.Noticef("cannot archive change %s: %v", chg.ID(), err)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package changearchive_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/changearchive"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type archiveSuite struct {
+	st *state.State
+}
+
+var _ = Suite(&archiveSuite{})
+
+func (s *archiveSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.st = state.New(nil)
+}
+
+func (s *archiveSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("")
+}
+
+func (s *archiveSuite) newChange(c *C, kind string) *state.Change {
+	chg := s.st.NewChange(kind, "summary of "+kind)
+	t := s.st.NewTask("some-task", "some task")
+	t.Logf("did something")
+	chg.AddTask(t)
+	chg.Set("snap-names", []string{"foo"})
+	t.SetStatus(state.DoneStatus)
+	return chg
+}
+
+func (s *archiveSuite) TestAppendRead(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	chg1 := s.newChange(c, "install-snap")
+	chg2 := s.newChange(c, "remove-snap")
+	chg2.Tasks()[0].Errorf("boom")
+	chg2.Tasks()[0].SetStatus(state.ErrorStatus)
+
+	c.Assert(changearchive.Append(chg1), IsNil)
+	c.Assert(changearchive.Append(chg2), IsNil)
+
+	recs, err := changearchive.Read()
+	c.Assert(err, IsNil)
+	c.Assert(recs, HasLen, 2)
+
+	rec := recs[0]
+	c.Check(rec.ID, Equals, chg1.ID())
+	c.Check(rec.Kind, Equals, "install-snap")
+	c.Check(rec.Summary, Equals, "summary of install-snap")
+	c.Check(rec.Status, Equals, "Done")
+	c.Check(rec.Err, Equals, "")
+	c.Check(rec.SpawnTime.Equal(chg1.SpawnTime()), Equals, true)
+	c.Assert(rec.ReadyTime, NotNil)
+	c.Check(rec.ReadyTime.Equal(chg1.ReadyTime()), Equals, true)
+	c.Check(rec.SnapNames, DeepEquals, []string{"foo"})
+	c.Assert(rec.Tasks, HasLen, 1)
+	c.Check(rec.Tasks[0].Kind, Equals, "some-task")
+	c.Check(rec.Tasks[0].Status, Equals, "Done")
+	c.Check(rec.Tasks[0].Log, HasLen, 1)
+	c.Check(rec.Tasks[0].Log[0], Matches, ".* INFO did something")
+
+	c.Check(recs[1].ID, Equals, chg2.ID())
+	c.Check(recs[1].Status, Equals, "Error")
+	c.Check(recs[1].Err, Matches, `(?s)cannot perform the following tasks:.*boom.*`)
+}
+
+func (s *archiveSuite) TestReadNoArchive(c *C) {
+	recs, err := changearchive.Read()
+	c.Assert(err, IsNil)
+	c.Check(recs, HasLen, 0)
+}
+
+func (s *archiveSuite) TestRotation(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	// room for about two records per file
+	restore := changearchive.MockLimits(1000, 2)
+	defer restore()
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		chg := s.newChange(c, "install-snap")
+		ids = append(ids, chg.ID())
+		c.Assert(changearchive.Append(chg), IsNil)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapChangesArchiveDir, "*"))
+	c.Assert(err, IsNil)
+	sort.Strings(matches)
+	c.Check(matches, DeepEquals, []string{
+		filepath.Join(dirs.SnapChangesArchiveDir, "changes.log"),
+		filepath.Join(dirs.SnapChangesArchiveDir, "changes.log.1"),
+		filepath.Join(dirs.SnapChangesArchiveDir, "changes.log.2"),
+	})
+
+	recs, err := changearchive.Read()
+	c.Assert(err, IsNil)
+	c.Assert(len(recs) < len(ids), Equals, true)
+	c.Assert(len(recs) > 2, Equals, true)
+	// the newest records are kept, oldest first
+	var got []string
+	for _, rec := range recs {
+		got = append(got, rec.ID)
+	}
+	c.Check(got, DeepEquals, ids[len(ids)-len(recs):])
+}
+
+func (s *archiveSuite) TestReadSkipsCorruptLines(c *C) {
+	s.st.Lock()
+	chg := s.newChange(c, "install-snap")
+	c.Assert(changearchive.Append(chg), IsNil)
+	s.st.Unlock()
+
+	fn := filepath.Join(dirs.SnapChangesArchiveDir, "changes.log")
+	data, err := ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(fn, append(data, []byte(`{"id": "2", "ki`)...), 0600), IsNil)
+
+	recs, err := changearchive.Read()
+	c.Assert(err, IsNil)
+	c.Assert(recs, HasLen, 1)
+	c.Check(recs[0].ID, Equals, chg.ID())
+}
+
+func (s *archiveSuite) TestEnabled(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	enabled, err := changearchive.Enabled(s.st)
+	c.Assert(err, IsNil)
+	c.Check(enabled, Equals, false)
+
+	for _, v := range []interface{}{true, "true"} {
+		tr := config.NewTransaction(s.st)
+		c.Assert(tr.Set("core", "changes.archive", v), IsNil)
+		tr.Commit()
+
+		enabled, err = changearchive.Enabled(s.st)
+		c.Assert(err, IsNil)
+		c.Check(enabled, Equals, true)
+	}
+}
+
+func (s *archiveSuite) TestSetupArchivesPrunedChanges(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	changearchive.Setup(s.st)
+
+	s.newChange(c, "install-snap")
+	s.st.Prune(time.Now(), time.Hour, time.Hour, 0)
+	c.Check(s.st.Changes(), HasLen, 0)
+
+	// disabled by default
+	recs, err := changearchive.Read()
+	c.Assert(err, IsNil)
+	c.Check(recs, HasLen, 0)
+
+	tr := config.NewTransaction(s.st)
+	c.Assert(tr.Set("core", "changes.archive", true), IsNil)
+	tr.Commit()
+
+	chg := s.newChange(c, "remove-snap")
+	s.st.Prune(time.Now(), time.Hour, time.Hour, 0)
+	c.Check(s.st.Changes(), HasLen, 0)
+
+	recs, err = changearchive.Read()
+	c.Assert(err, IsNil)
+	c.Assert(recs, HasLen, 1)
+	c.Check(recs[0].ID, Equals, chg.ID())
+	c.Check(recs[0].Kind, Equals, "remove-snap")
+	c.Check(recs[0].Tasks, HasLen, 1)
+}
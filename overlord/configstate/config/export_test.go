@@ -21,6 +21,9 @@ package config
 
 import (
 	"encoding/json"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/state"
 )
 
 var PurgeNulls = purgeNulls
@@ -28,3 +31,29 @@ var PurgeNulls = purgeNulls
 func (t *Transaction) PristineConfig() map[string]map[string]*json.RawMessage {
 	return t.pristine
 }
+
+// SecretsFile returns the file holding the secrets of the generation
+// recorded in the state.
+func SecretsFile(st *state.State) string {
+	gen, err := secretsGeneration(st)
+	if err != nil {
+		panic(err)
+	}
+	return secretsFilename(gen)
+}
+
+func MockMaxHistory(n int) (restore func()) {
+	old := maxHistory
+	maxHistory = n
+	return func() {
+		maxHistory = old
+	}
+}
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
@@ -123,7 +123,8 @@ func PatchConfig(snapName string, subkeys []string, pos int, config interface{},
 	return nil, fmt.Errorf("internal error: unexpected configuration type %T", config)
 }
 
-// GetSnapConfig retrieves the raw configuration of a given snap.
+// GetSnapConfig retrieves the raw configuration of a given snap, without
+// its secret options.
 func GetSnapConfig(st *state.State, snapName string) (*json.RawMessage, error) {
 	var config map[string]*json.RawMessage
 	err := st.Get("config", &config)
@@ -140,11 +141,31 @@ func GetSnapConfig(st *state.State, snapName string) (*json.RawMessage, error) {
 	return snapcfg, nil
 }
 
-// SetSnapConfig replaces the configuration of a given snap.
+// SetSnapConfig replaces the configuration of a given snap. The values of
+// options of the snap that are secret are stored as such, secret options
+// missing from the configuration are kept.
 func SetSnapConfig(st *state.State, snapName string, snapcfg *json.RawMessage) error {
+	return SetSnapConfigWithSecrets(st, snapName, snapcfg, nil)
+}
+
+// SetSnapConfigWithSecrets is like SetSnapConfig, but the given top level
+// options are made secret as well before the configuration is stored.
+func SetSnapConfigWithSecrets(st *state.State, snapName string, snapcfg *json.RawMessage, secretKeys []string) error {
 	var config map[string]*json.RawMessage
 	err := st.Get("config", &config)
 	isNil := snapcfg == nil || len(*snapcfg) == 0
+	if !isNil {
+		var cfg map[string]*json.RawMessage
+		if err := json.Unmarshal(*snapcfg, &cfg); err == nil {
+			changed, err := setSnapSecrets(st, snapName, cfg, secretKeys)
+			if err != nil {
+				return err
+			}
+			if changed {
+				snapcfg = jsonRaw(cfg)
+			}
+		}
+	}
 	if err == state.ErrNoState {
 		if isNil {
 			// bail out early
@@ -253,7 +274,8 @@ func DiscardRevisionConfig(st *state.State, snapName string, rev snap.Revision)
 	return nil
 }
 
-// DeleteSnapConfig removed configuration of given snap from the state.
+// DeleteSnapConfig removed configuration, including secret options, and
+// configuration history of given snap from the state.
 func DeleteSnapConfig(st *state.State, snapName string) error {
 	var config map[string]map[string]*json.RawMessage // snap => key => value
 
@@ -267,7 +289,10 @@ func DeleteSnapConfig(st *state.State, snapName string) error {
 		delete(config, snapName)
 		st.Set("config", config)
 	}
-	return nil
+	if err := deleteSnapSecrets(st, snapName); err != nil {
+		return err
+	}
+	return deleteHistory(st, snapName)
 }
 
 // Conf is an interface describing both state and transaction.
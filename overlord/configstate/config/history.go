@@ -0,0 +1,159 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// maxHistory is the number of committed configurations kept for each snap.
+var maxHistory = 10
+
+var timeNow = time.Now
+
+// HistoryEntry is the configuration of a snap as committed by a
+// transaction.
+type HistoryEntry struct {
+	// ID identifies the entry among the history of the snap, it keeps
+	// increasing as older entries get dropped.
+	ID       int       `json:"id"`
+	Time     time.Time `json:"time"`
+	ChangeID string    `json:"change-id,omitempty"`
+	// UID is the user that requested the change, it is unset when snapd
+	// changed the configuration on its own.
+	UID    *uint32                     `json:"uid,omitempty"`
+	Config map[string]*json.RawMessage `json:"config"`
+}
+
+// NoHistoryEntryError is returned when the history of a snap has no entry
+// with the requested id.
+type NoHistoryEntryError struct {
+	SnapName string
+	ID       int
+}
+
+func (e *NoHistoryEntryError) Error() string {
+	return fmt.Sprintf("snap %q has no configuration history entry %d", e.SnapName, e.ID)
+}
+
+func getHistory(st *state.State) (map[string][]*HistoryEntry, error) {
+	var history map[string][]*HistoryEntry // snap => entries
+	err := st.Get("config-history", &history)
+	if err == state.ErrNoState {
+		return make(map[string][]*HistoryEntry), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("internal error: cannot unmarshal configuration history: %v", err)
+	}
+	return history, nil
+}
+
+// History returns the recorded configurations of the given snap, oldest
+// first.
+// The caller is responsible for locking the state.
+func History(st *state.State, snapName string) ([]*HistoryEntry, error) {
+	history, err := getHistory(st)
+	if err != nil {
+		return nil, err
+	}
+	return history[snapName], nil
+}
+
+// GetHistoryEntry returns the history entry of the given snap with the
+// given id, or a *NoHistoryEntryError.
+// The caller is responsible for locking the state.
+func GetHistoryEntry(st *state.State, snapName string, id int) (*HistoryEntry, error) {
+	entries, err := History(st, snapName)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return nil, &NoHistoryEntryError{SnapName: snapName, ID: id}
+}
+
+func recordHistory(st *state.State, snapName string, config map[string]*json.RawMessage, changeID string, uid *uint32) {
+	history, err := getHistory(st)
+	if err != nil {
+		panic(err)
+	}
+	entries := history[snapName]
+
+	id := 1
+	if len(entries) > 0 {
+		id = entries[len(entries)-1].ID + 1
+	}
+	snapcfg := make(map[string]*json.RawMessage, len(config))
+	for k, v := range config {
+		snapcfg[k] = v
+	}
+	entries = append(entries, &HistoryEntry{
+		ID:       id,
+		Time:     timeNow(),
+		ChangeID: changeID,
+		UID:      uid,
+		Config:   snapcfg,
+	})
+	if len(entries) > maxHistory {
+		entries = entries[len(entries)-maxHistory:]
+	}
+	history[snapName] = entries
+	st.Set("config-history", history)
+}
+
+// forgetHistoryValues removes the given options from the recorded
+// configurations of the snap.
+func forgetHistoryValues(st *state.State, snapName string, keys map[string]bool) {
+	history, err := getHistory(st)
+	if err != nil {
+		panic(err)
+	}
+	changed := false
+	for _, entry := range history[snapName] {
+		for k := range entry.Config {
+			if keys[k] {
+				delete(entry.Config, k)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		st.Set("config-history", history)
+	}
+}
+
+func deleteHistory(st *state.State, snapName string) error {
+	history, err := getHistory(st)
+	if err != nil {
+		return err
+	}
+	if _, ok := history[snapName]; ok {
+		delete(history, snapName)
+		st.Set("config-history", history)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package config_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type historySuite struct {
+	testutil.BaseTest
+	state *state.State
+	now   time.Time
+}
+
+var _ = Suite(&historySuite{})
+
+func (s *historySuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.state = state.New(nil)
+	s.now = time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	s.AddCleanup(config.MockTimeNow(func() time.Time { return s.now }))
+}
+
+func entryConfig(c *C, entry *config.HistoryEntry) map[string]interface{} {
+	data, err := json.Marshal(entry.Config)
+	c.Assert(err, IsNil)
+	var value map[string]interface{}
+	c.Assert(json.Unmarshal(data, &value), IsNil)
+	return value
+}
+
+func (s *historySuite) TestCommitRecordsHistory(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("snap1", "foo", "a"), IsNil)
+	c.Assert(tr.Set("snap2", "bar", "q"), IsNil)
+	tr.Commit()
+
+	s.now = s.now.Add(time.Hour)
+	tr = config.NewTransaction(s.state)
+	tr.SetChangeID("42")
+	tr.SetAuthor(1000)
+	c.Assert(tr.Set("snap1", "foo", nil), IsNil)
+	c.Assert(tr.Set("snap1", "baz.qux", 1), IsNil)
+	tr.Commit()
+
+	// nothing to commit, nothing recorded
+	config.NewTransaction(s.state).Commit()
+
+	entries, err := config.History(s.state, "snap1")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Check(entries[0].ID, Equals, 1)
+	c.Check(entries[0].Time.Equal(time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)), Equals, true)
+	c.Check(entries[0].ChangeID, Equals, "")
+	c.Check(entries[0].UID, IsNil)
+	c.Check(entryConfig(c, entries[0]), DeepEquals, map[string]interface{}{"foo": "a"})
+
+	c.Check(entries[1].ID, Equals, 2)
+	c.Check(entries[1].Time.Equal(time.Date(2020, 6, 1, 11, 0, 0, 0, time.UTC)), Equals, true)
+	c.Check(entries[1].ChangeID, Equals, "42")
+	c.Assert(entries[1].UID, NotNil)
+	c.Check(*entries[1].UID, Equals, uint32(1000))
+	c.Check(entryConfig(c, entries[1]), DeepEquals, map[string]interface{}{
+		"baz": map[string]interface{}{"qux": 1.0},
+	})
+
+	entries, err = config.History(s.state, "snap2")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entryConfig(c, entries[0]), DeepEquals, map[string]interface{}{"bar": "q"})
+
+	entries, err = config.History(s.state, "other-snap")
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+}
+
+func (s *historySuite) TestHistoryIsBounded(c *C) {
+	s.AddCleanup(config.MockMaxHistory(3))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for i := 0; i < 5; i++ {
+		tr := config.NewTransaction(s.state)
+		c.Assert(tr.Set("snap1", "foo", i), IsNil)
+		tr.Commit()
+	}
+
+	entries, err := config.History(s.state, "snap1")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 3)
+	for i, entry := range entries {
+		c.Check(entry.ID, Equals, i+3)
+		c.Check(entryConfig(c, entry), DeepEquals, map[string]interface{}{"foo": float64(i + 2)})
+	}
+}
+
+func (s *historySuite) TestGetHistoryEntry(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("snap1", "foo", "a"), IsNil)
+	tr.Commit()
+
+	entry, err := config.GetHistoryEntry(s.state, "snap1", 1)
+	c.Assert(err, IsNil)
+	c.Check(entryConfig(c, entry), DeepEquals, map[string]interface{}{"foo": "a"})
+
+	_, err = config.GetHistoryEntry(s.state, "snap1", 2)
+	c.Check(err, ErrorMatches, `snap "snap1" has no configuration history entry 2`)
+	c.Check(err, FitsTypeOf, &config.NoHistoryEntryError{})
+}
+
+func (s *historySuite) TestDeleteSnapConfigDeletesHistory(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("snap1", "foo", "a"), IsNil)
+	c.Assert(tr.Set("snap2", "bar", "q"), IsNil)
+	tr.Commit()
+
+	c.Assert(config.DeleteSnapConfig(s.state, "snap1"), IsNil)
+
+	entries, err := config.History(s.state, "snap1")
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+	entries, err = config.History(s.state, "snap2")
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 1)
+}
@@ -0,0 +1,357 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema that snaps can use in
+// meta/config-schema.json to describe their configuration.
+type Schema struct {
+	// SchemaURI and Title are accepted for compatibility with JSON
+	// Schema tooling but otherwise ignored.
+	SchemaURI   string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type    string        `json:"type,omitempty"`
+	Enum    []interface{} `json:"enum,omitempty"`
+	Default interface{}   `json:"default,omitempty"`
+	// Secret marks top level options whose values are hidden from
+	// non-root users.
+	Secret bool `json:"secret,omitempty"`
+
+	// numbers
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	// strings
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	// objects
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+
+	// arrays
+	Items *Schema `json:"items,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+var schemaTypes = map[string]bool{
+	"":        true,
+	"string":  true,
+	"integer": true,
+	"number":  true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+}
+
+// ReadSchema reads and checks the configuration schema at the given path.
+func ReadSchema(path string) (*Schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(data)
+}
+
+// ParseSchema parses and checks a configuration schema, keywords outside
+// of the supported subset are rejected.
+func ParseSchema(data []byte) (*Schema, error) {
+	var schema Schema
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	if err := dec.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("cannot parse configuration schema: %v", err)
+	}
+	if schema.Type != "" && schema.Type != "object" {
+		return nil, fmt.Errorf("invalid configuration schema: top level type must be object, not %q", schema.Type)
+	}
+	if err := schema.check(""); err != nil {
+		return nil, fmt.Errorf("invalid configuration schema: %v", err)
+	}
+	return &schema, nil
+}
+
+func (s *Schema) check(path string) error {
+	where := "top level"
+	if path != "" {
+		where = fmt.Sprintf("%q", path)
+	}
+	if !schemaTypes[s.Type] {
+		return fmt.Errorf("unsupported type %q for %s", s.Type, where)
+	}
+	if s.Secret && (path == "" || strings.ContainsAny(path, ".[")) {
+		return fmt.Errorf("secret is only supported for top level options, not %s", where)
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern for %s: %v", where, err)
+		}
+		s.pattern = re
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok {
+			return fmt.Errorf("required property %q of %s is not described", name, where)
+		}
+	}
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return fmt.Errorf("property %q of %s has no schema", name, where)
+		}
+		if err := prop.check(joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.check(path + "[]"); err != nil {
+			return err
+		}
+	}
+	if s.Default != nil {
+		if err := s.validate(path, s.Default); err != nil {
+			return fmt.Errorf("invalid default: %v", err)
+		}
+	}
+	return nil
+}
+
+// SecretOptions returns the top level options described as secret.
+func (s *Schema) SecretOptions() []string {
+	var keys []string
+	for name, prop := range s.Properties {
+		if prop.Secret {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Lookup returns the schema of the given dotted key, nil if the schema does
+// not describe it.
+func (s *Schema) Lookup(key string) *Schema {
+	if key == "" {
+		return s
+	}
+	subkeys, err := ParseKey(key)
+	if err != nil {
+		return nil
+	}
+	cur := s
+	for _, subkey := range subkeys {
+		cur = cur.Properties[subkey]
+		if cur == nil {
+			return nil
+		}
+	}
+	return cur
+}
+
+// ValidationError is returned when configuration does not conform to the
+// schema of the snap.
+type ValidationError struct {
+	Key     string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("invalid configuration: %s", e.Message)
+	}
+	return fmt.Sprintf("invalid configuration for %q: %s", e.Key, e.Message)
+}
+
+// Validate checks the whole configuration document of a snap against the
+// schema.
+func (s *Schema) Validate(value map[string]interface{}) error {
+	return s.validate("", value)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func invalid(path, format string, args ...interface{}) error {
+	return &ValidationError{Key: path, Message: fmt.Sprintf(format, args...)}
+}
+
+func asNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// sameValue compares configuration values ignoring the representation of
+// numbers.
+func sameValue(a, b interface{}) bool {
+	if na, ok := asNumber(a); ok {
+		nb, ok := asNumber(b)
+		return ok && na == nb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (s *Schema) validate(path string, value interface{}) error {
+	if value == nil {
+		// unset
+		return nil
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return invalid(path, "expected string")
+		}
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && n < *s.MinLength {
+			return invalid(path, "must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return invalid(path, "must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			return invalid(path, "must match %q", s.Pattern)
+		}
+	case "integer", "number":
+		f, ok := asNumber(value)
+		if !ok {
+			return invalid(path, "expected %s", s.Type)
+		}
+		if s.Type == "integer" && f != math.Trunc(f) {
+			return invalid(path, "expected integer")
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return invalid(path, "must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return invalid(path, "must be at most %v", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return invalid(path, "expected boolean")
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return invalid(path, "expected array")
+		}
+		if s.Items != nil {
+			for i, item := range list {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "object", "":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			if s.Type == "" {
+				break
+			}
+			return invalid(path, "expected object")
+		}
+		if err := s.validateObject(path, obj); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if sameValue(value, allowed) {
+				return nil
+			}
+		}
+		return invalid(path, "must be one of %s", enumString(s.Enum))
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(path string, obj map[string]interface{}) error {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		prop, ok := s.Properties[k]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return invalid(joinPath(path, k), "unknown option")
+			}
+			continue
+		}
+		if err := prop.validate(joinPath(path, k), obj[k]); err != nil {
+			return err
+		}
+	}
+	for _, name := range s.Required {
+		if obj[name] == nil {
+			return invalid(joinPath(path, name), "required option is not set")
+		}
+	}
+	return nil
+}
+
+func enumString(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, v := range enum {
+		data, err := json.Marshal(v)
+		if err != nil {
+			values[i] = fmt.Sprintf("%v", v)
+			continue
+		}
+		values[i] = string(data)
+	}
+	return strings.Join(values, ", ")
+}
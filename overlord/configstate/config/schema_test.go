@@ -0,0 +1,149 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package config_test
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+type schemaSuite struct{}
+
+var _ = Suite(&schemaSuite{})
+
+const testSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535, "default": 8080},
+		"ratio": {"type": "number", "minimum": 0, "maximum": 1},
+		"mode": {"type": "string", "enum": ["fast", "safe"], "default": "safe"},
+		"name": {"type": "string", "minLength": 2, "maxLength": 8, "pattern": "^[a-z]+$"},
+		"debug": {"type": "boolean"},
+		"peers": {"type": "array", "items": {"type": "string"}},
+		"db": {
+			"type": "object",
+			"additionalProperties": false,
+			"required": ["host"],
+			"properties": {
+				"host": {"type": "string"},
+				"extra": {"type": "object"}
+			}
+		}
+	}
+}`
+
+func (s *schemaSuite) TestParseSchemaErrors(c *C) {
+	for _, tc := range []struct {
+		schema string
+		err    string
+	}{
+		{`{"type": "string"}`, `invalid configuration schema: top level type must be object, not "string"`},
+		{`{"properties": {"a": {"type": "float"}}}`, `invalid configuration schema: unsupported type "float" for "a"`},
+		{`{"properties": {"a": {"type": "string", "pattern": "("}}}`, `invalid configuration schema: invalid pattern for "a": .*`},
+		{`{"properties": {"a": {"oneOf": []}}}`, `cannot parse configuration schema: json: unknown field "oneOf"`},
+		{`{"required": ["a"]}`, `invalid configuration schema: required property "a" of top level is not described`},
+		{`{"secret": true}`, `invalid configuration schema: secret is only supported for top level options, not top level`},
+		{`{"properties": {"a": {"properties": {"b": {"secret": true}}}}}`, `invalid configuration schema: secret is only supported for top level options, not "a.b"`},
+		{`{"properties": {"a": {"type": "integer", "default": "x"}}}`, `invalid configuration schema: invalid default: invalid configuration for "a": expected integer`},
+		{`{"properties": {"a": null}}`, `invalid configuration schema: property "a" of top level has no schema`},
+		{`not json`, `cannot parse configuration schema: .*`},
+	} {
+		_, err := config.ParseSchema([]byte(tc.schema))
+		c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.schema))
+	}
+}
+
+func (s *schemaSuite) TestValidate(c *C) {
+	schema, err := config.ParseSchema([]byte(testSchema))
+	c.Assert(err, IsNil)
+
+	for _, tc := range []struct {
+		value string
+		err   string
+	}{
+		{`{}`, ``},
+		{`{"port": 80, "ratio": 0.5, "mode": "fast", "name": "abc", "debug": true, "peers": ["a", "b"]}`, ``},
+		{`{"db": {"host": "localhost", "extra": {"anything": 1}}}`, ``},
+		{`{"port": null}`, ``},
+		{`{"prot": 80}`, `invalid configuration for "prot": unknown option`},
+		{`{"port": "80"}`, `invalid configuration for "port": expected integer`},
+		{`{"port": 80.5}`, `invalid configuration for "port": expected integer`},
+		{`{"port": 0}`, `invalid configuration for "port": must be at least 1`},
+		{`{"port": 70000}`, `invalid configuration for "port": must be at most 65535`},
+		{`{"ratio": 2}`, `invalid configuration for "ratio": must be at most 1`},
+		{`{"mode": "slow"}`, `invalid configuration for "mode": must be one of "fast", "safe"`},
+		{`{"name": "a"}`, `invalid configuration for "name": must be at least 2 characters long`},
+		{`{"name": "abcdefghi"}`, `invalid configuration for "name": must be at most 8 characters long`},
+		{`{"name": "ABC"}`, `invalid configuration for "name": must match "\^\[a-z\]\+\$"`},
+		{`{"debug": "yes"}`, `invalid configuration for "debug": expected boolean`},
+		{`{"peers": "a"}`, `invalid configuration for "peers": expected array`},
+		{`{"peers": ["a", 1]}`, `invalid configuration for "peers\[1\]": expected string`},
+		{`{"db": "localhost"}`, `invalid configuration for "db": expected object`},
+		{`{"db": {"hots": "localhost"}}`, `invalid configuration for "db.hots": unknown option`},
+		{`{"db": {"extra": {}}}`, `invalid configuration for "db.host": required option is not set`},
+	} {
+		var value map[string]interface{}
+		c.Assert(json.Unmarshal([]byte(tc.value), &value), IsNil)
+		err := schema.Validate(value)
+		if tc.err == "" {
+			c.Check(err, IsNil, Commentf("%s", tc.value))
+		} else {
+			c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.value))
+			c.Check(err, FitsTypeOf, &config.ValidationError{})
+		}
+	}
+}
+
+func (s *schemaSuite) TestValidateJSONNumbers(c *C) {
+	schema, err := config.ParseSchema([]byte(testSchema))
+	c.Assert(err, IsNil)
+
+	c.Check(schema.Validate(map[string]interface{}{"port": json.Number("443")}), IsNil)
+	c.Check(schema.Validate(map[string]interface{}{"port": json.Number("1.5")}), ErrorMatches, `.* expected integer`)
+	c.Check(schema.Validate(map[string]interface{}{"port": 0}), ErrorMatches, `.* must be at least 1`)
+}
+
+func (s *schemaSuite) TestSecretOptions(c *C) {
+	schema, err := config.ParseSchema([]byte(`{
+	"properties": {
+		"token": {"type": "string", "secret": true},
+		"password": {"secret": true},
+		"name": {"type": "string"}
+	}
+}`))
+	c.Assert(err, IsNil)
+	c.Check(schema.SecretOptions(), DeepEquals, []string{"password", "token"})
+}
+
+func (s *schemaSuite) TestLookup(c *C) {
+	schema, err := config.ParseSchema([]byte(testSchema))
+	c.Assert(err, IsNil)
+
+	c.Check(schema.Lookup(""), Equals, schema)
+	c.Check(schema.Lookup("port").Type, Equals, "integer")
+	c.Check(schema.Lookup("port").Default, Equals, json.Number("8080"))
+	c.Check(schema.Lookup("db.host").Type, Equals, "string")
+	c.Check(schema.Lookup("db.missing"), IsNil)
+	c.Check(schema.Lookup("port.sub"), IsNil)
+}
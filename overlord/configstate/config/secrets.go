@@ -0,0 +1,270 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// Secret options are top level options whose values are kept out of the
+// state, in a file only readable by root. Transactions merge them back with
+// the rest of the configuration of the snap.
+//
+// The file is read once and cached in the state. Every change of the
+// secrets is written to a new file, for the next generation recorded in
+// the state, so that the secrets in use are always those of the last
+// checkpointed state. The files of other generations are removed when the
+// secrets are first loaded, as only then the generation of the state is
+// known to be checkpointed.
+
+// RedactedValue replaces the values of secret options shown to non-root
+// users.
+const RedactedValue = "*****"
+
+type secretConfig map[string]map[string]*json.RawMessage // snap => option => value
+
+type cachedSecretsKey struct{}
+
+// secretsFilename returns the file holding the secrets of the given
+// generation.
+func secretsFilename(gen int) string {
+	if gen == 0 {
+		return dirs.SnapConfigSecretsFile
+	}
+	return fmt.Sprintf("%s.%d", dirs.SnapConfigSecretsFile, gen)
+}
+
+func secretsGeneration(st *state.State) (int, error) {
+	var gen int
+	if err := st.Get("config-secrets-generation", &gen); err != nil && err != state.ErrNoState {
+		return 0, err
+	}
+	return gen, nil
+}
+
+func readSecrets(filename string) (secretConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return make(secretConfig), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read secret configuration: %v", err)
+	}
+	var secrets secretConfig
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal secret configuration: %v", err)
+	}
+	if secrets == nil {
+		secrets = make(secretConfig)
+	}
+	return secrets, nil
+}
+
+// loadSecrets returns a copy of the secret configuration of all snaps.
+func loadSecrets(st *state.State) (secretConfig, error) {
+	if secrets, ok := st.Cached(cachedSecretsKey{}).(secretConfig); ok {
+		return secrets.copy(), nil
+	}
+
+	gen, err := secretsGeneration(st)
+	if err != nil {
+		return nil, err
+	}
+	current := secretsFilename(gen)
+	secrets, err := readSecrets(current)
+	if err != nil {
+		return nil, err
+	}
+	others, err := filepath.Glob(dirs.SnapConfigSecretsFile + "*")
+	if err != nil {
+		return nil, err
+	}
+	for _, filename := range others {
+		if filename != current {
+			if err := os.Remove(filename); err != nil {
+				logger.Noticef("cannot remove stale secret configuration: %v", err)
+			}
+		}
+	}
+	st.Cache(cachedSecretsKey{}, secrets)
+	return secrets.copy(), nil
+}
+
+func (secrets secretConfig) copy() secretConfig {
+	secretsCopy := make(secretConfig, len(secrets))
+	for snapName, snapSecrets := range secrets {
+		snapCopy := make(map[string]*json.RawMessage, len(snapSecrets))
+		for k, v := range snapSecrets {
+			snapCopy[k] = v
+		}
+		secretsCopy[snapName] = snapCopy
+	}
+	return secretsCopy
+}
+
+func (secrets secretConfig) marshal() []byte {
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		panic(fmt.Errorf("internal error: cannot marshal secret configuration: %v", err))
+	}
+	return data
+}
+
+// saveSecrets writes the secret configuration of all snaps to the file of
+// the next generation, which is recorded in the state.
+func saveSecrets(st *state.State, secrets secretConfig) error {
+	secrets = secrets.copy()
+	for snapName, snapSecrets := range secrets {
+		if len(snapSecrets) == 0 {
+			delete(secrets, snapName)
+		}
+	}
+	gen, err := secretsGeneration(st)
+	if err != nil {
+		return err
+	}
+	gen++
+	// no secrets at all need no file
+	if len(secrets) > 0 {
+		filename := secretsFilename(gen)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := osutil.AtomicWriteFile(filename, secrets.marshal(), 0600, 0); err != nil {
+			return err
+		}
+	}
+	st.Set("config-secrets-generation", gen)
+	st.Cache(cachedSecretsKey{}, secrets)
+	return nil
+}
+
+// SnapSecrets returns the values of the secret options of the given snap.
+// The caller is responsible for locking the state.
+func SnapSecrets(st *state.State, snapName string) (map[string]*json.RawMessage, error) {
+	secrets, err := loadSecrets(st)
+	if err != nil {
+		return nil, err
+	}
+	return secrets[snapName], nil
+}
+
+// setSnapSecrets stores, out of the given configuration of a snap, the
+// values of the options that are already secret or are among the given
+// keys, they are removed from the configuration.
+func setSnapSecrets(st *state.State, snapName string, config map[string]*json.RawMessage, secretKeys []string) (changed bool, err error) {
+	secrets, err := loadSecrets(st)
+	if err != nil {
+		return false, err
+	}
+	snapSecrets := secrets[snapName]
+	if snapSecrets == nil {
+		snapSecrets = make(map[string]*json.RawMessage)
+		secrets[snapName] = snapSecrets
+	}
+	for k, v := range config {
+		if _, ok := snapSecrets[k]; ok || strutil.ListContains(secretKeys, k) {
+			snapSecrets[k] = v
+			delete(config, k)
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, saveSecrets(st, secrets)
+}
+
+func deleteSnapSecrets(st *state.State, snapName string) error {
+	secrets, err := loadSecrets(st)
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[snapName]; !ok {
+		return nil
+	}
+	delete(secrets, snapName)
+	return saveSecrets(st, secrets)
+}
+
+// splitSecrets separates the secret options out of the configuration of
+// all snaps, the returned public configuration shares the values of the
+// given one.
+func splitSecrets(config map[string]map[string]*json.RawMessage, secretKeys map[string]map[string]bool) (public map[string]map[string]*json.RawMessage, secrets secretConfig) {
+	public = make(map[string]map[string]*json.RawMessage, len(config))
+	secrets = make(secretConfig)
+	for snapName, snapConfig := range config {
+		keys := secretKeys[snapName]
+		if len(keys) == 0 {
+			public[snapName] = snapConfig
+			continue
+		}
+		snapPublic := make(map[string]*json.RawMessage, len(snapConfig))
+		snapSecrets := make(map[string]*json.RawMessage)
+		for k, v := range snapConfig {
+			if keys[k] {
+				snapSecrets[k] = v
+			} else {
+				snapPublic[k] = v
+			}
+		}
+		public[snapName] = snapPublic
+		if len(snapSecrets) > 0 {
+			secrets[snapName] = snapSecrets
+		}
+	}
+	return public, secrets
+}
+
+// mergeSecrets adds the values of the secret options to the configuration
+// and records which options are secret.
+func mergeSecrets(config map[string]map[string]*json.RawMessage, secretKeys map[string]map[string]bool, secrets secretConfig) {
+	for snapName, snapSecrets := range secrets {
+		snapConfig := config[snapName]
+		if snapConfig == nil {
+			snapConfig = make(map[string]*json.RawMessage, len(snapSecrets))
+			config[snapName] = snapConfig
+		}
+		keys := secretKeys[snapName]
+		if keys == nil {
+			keys = make(map[string]bool, len(snapSecrets))
+			secretKeys[snapName] = keys
+		}
+		for k, v := range snapSecrets {
+			snapConfig[k] = v
+			keys[k] = true
+		}
+	}
+}
+
+func secretsEqual(a, b secretConfig) bool {
+	return bytes.Equal(a.marshal(), b.marshal())
+}
@@ -0,0 +1,382 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type secretsSuite struct {
+	state *state.State
+}
+
+var _ = Suite(&secretsSuite{})
+
+func (s *secretsSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.state = state.New(nil)
+}
+
+func (s *secretsSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("/")
+}
+
+func (s *secretsSuite) stateConfig(c *C) map[string]map[string]interface{} {
+	var cfg map[string]map[string]interface{}
+	c.Assert(s.state.Get("config", &cfg), IsNil)
+	return cfg
+}
+
+func (s *secretsSuite) TestSecretsKeptOutOfState(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "name", "foo"), IsNil)
+	c.Assert(tr.Set("test-snap", "token.value", "s3cr3t"), IsNil)
+	c.Assert(tr.MarkSecret("test-snap", "token"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+
+	c.Check(s.stateConfig(c), DeepEquals, map[string]map[string]interface{}{
+		"test-snap": {"name": "foo"},
+	})
+	c.Check(config.SecretsFile(s.state), testutil.FileEquals, `{"test-snap":{"token":{"value":"s3cr3t"}}}`)
+	st, err := os.Stat(config.SecretsFile(s.state))
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+
+	// the history does not record secrets either
+	entries, err := config.History(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entries[0].Config, HasLen, 1)
+
+	// later transactions see the secret values, and keep them secret
+	tr = config.NewTransaction(s.state)
+	var value string
+	c.Assert(tr.Get("test-snap", "token.value", &value), IsNil)
+	c.Check(value, Equals, "s3cr3t")
+	c.Check(tr.IsSecret("test-snap", "token"), Equals, true)
+	c.Check(tr.IsSecret("test-snap", "token.value"), Equals, true)
+	c.Check(tr.IsSecret("test-snap", "name"), Equals, false)
+
+	c.Assert(tr.Set("test-snap", "token.other", "x"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileEquals, `{"test-snap":{"token":{"other":"x","value":"s3cr3t"}}}`)
+	c.Check(s.stateConfig(c), DeepEquals, map[string]map[string]interface{}{
+		"test-snap": {"name": "foo"},
+	})
+
+	// no secrets need no file
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "token", nil), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileAbsent)
+}
+
+func (s *secretsSuite) TestMarkExistingOptionSecret(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "password", "pw"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileAbsent)
+
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.MarkSecret("test-snap", "password"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileEquals, `{"test-snap":{"password":"pw"}}`)
+	c.Check(s.stateConfig(c), DeepEquals, map[string]map[string]interface{}{
+		"test-snap": {},
+	})
+}
+
+func (s *secretsSuite) TestMarkSecretNested(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	err := tr.MarkSecret("test-snap", "a.b")
+	c.Check(err, ErrorMatches, `cannot mark nested option "a.b" of snap "test-snap" as secret`)
+}
+
+func (s *secretsSuite) TestUnmarkSecret(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "password", "pw"), IsNil)
+	c.Assert(tr.MarkSecret("test-snap", "password"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileEquals, `{"test-snap":{"password":"pw"}}`)
+
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.UnmarkSecret("test-snap", "password"), IsNil)
+	c.Check(tr.IsSecret("test-snap", "password"), Equals, false)
+	c.Assert(tr.Commit(), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileAbsent)
+	c.Check(s.stateConfig(c), DeepEquals, map[string]map[string]interface{}{
+		"test-snap": {"password": "pw"},
+	})
+
+	tr = config.NewTransaction(s.state)
+	c.Check(tr.IsSecret("test-snap", "password"), Equals, false)
+	err := tr.UnmarkSecret("test-snap", "a.b")
+	c.Check(err, ErrorMatches, `cannot unmark nested option "a.b" of snap "test-snap" as secret`)
+}
+
+func (s *secretsSuite) TestMarkSecretIsPartOfTransaction(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "password", "pw"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+
+	// a discarded transaction leaves no mark
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.MarkSecret("test-snap", "password"), IsNil)
+	c.Check(tr.IsSecret("test-snap", "password"), Equals, true)
+	tr = config.NewTransaction(s.state)
+	c.Check(tr.IsSecret("test-snap", "password"), Equals, false)
+
+	// a mark that is undone is not applied
+	c.Assert(tr.MarkSecret("test-snap", "password"), IsNil)
+	c.Assert(tr.UnmarkSecret("test-snap", "password"), IsNil)
+	c.Check(tr.IsSecret("test-snap", "password"), Equals, false)
+	c.Assert(tr.Commit(), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileAbsent)
+	c.Check(s.stateConfig(c), DeepEquals, map[string]map[string]interface{}{
+		"test-snap": {"password": "pw"},
+	})
+}
+
+func (s *secretsSuite) TestRedact(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.MarkSecret("test-snap", "token"), IsNil)
+
+	c.Check(tr.Redact("test-snap", "token", "s3cr3t"), Equals, config.RedactedValue)
+	c.Check(tr.Redact("test-snap", "token.value", "s3cr3t"), Equals, config.RedactedValue)
+	c.Check(tr.Redact("test-snap", "name", "foo"), Equals, "foo")
+	c.Check(tr.Redact("other-snap", "token", "foo"), Equals, "foo")
+	c.Check(tr.Redact("test-snap", "", map[string]interface{}{
+		"token": map[string]interface{}{"value": "s3cr3t"},
+		"name":  "foo",
+	}), DeepEquals, map[string]interface{}{
+		"token": config.RedactedValue,
+		"name":  "foo",
+	})
+}
+
+func (s *secretsSuite) TestSetAndDeleteSnapConfig(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "name", "foo"), IsNil)
+	c.Assert(tr.Set("test-snap", "token", "s3cr3t"), IsNil)
+	c.Assert(tr.MarkSecret("test-snap", "token"), IsNil)
+	c.Assert(tr.Set("other-snap", "password", "pw"), IsNil)
+	c.Assert(tr.MarkSecret("other-snap", "password"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+
+	// public configuration only
+	raw, err := config.GetSnapConfig(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*raw), Equals, `{"name":"foo"}`)
+
+	secrets, err := config.SnapSecrets(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(secrets, HasLen, 1)
+	c.Check(string(*secrets["token"]), Equals, `"s3cr3t"`)
+
+	// secret values are stored as such, missing secrets are kept
+	cfg := json.RawMessage(`{"name":"bar","token":"other"}`)
+	c.Assert(config.SetSnapConfig(s.state, "test-snap", &cfg), IsNil)
+	raw, err = config.GetSnapConfig(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*raw), Equals, `{"name":"bar"}`)
+	cfg = json.RawMessage(`{"name":"baz"}`)
+	c.Assert(config.SetSnapConfig(s.state, "test-snap", &cfg), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileEquals, `{"other-snap":{"password":"pw"},"test-snap":{"token":"other"}}`)
+
+	c.Assert(config.DeleteSnapConfig(s.state, "test-snap"), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileEquals, `{"other-snap":{"password":"pw"}}`)
+	c.Assert(config.DeleteSnapConfig(s.state, "other-snap"), IsNil)
+	c.Check(config.SecretsFile(s.state), testutil.FileAbsent)
+}
+
+func (s *secretsSuite) TestSetSnapConfigWithSecrets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the options are made secret even if they were not before
+	cfg := json.RawMessage(`{"name":"foo","token":"s3cr3t"}`)
+	c.Assert(config.SetSnapConfigWithSecrets(s.state, "test-snap", &cfg, []string{"token", "missing"}), IsNil)
+
+	raw, err := config.GetSnapConfig(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*raw), Equals, `{"name":"foo"}`)
+	c.Check(config.SecretsFile(s.state), testutil.FileEquals, `{"test-snap":{"token":"s3cr3t"}}`)
+
+	tr := config.NewTransaction(s.state)
+	c.Check(tr.IsSecret("test-snap", "token"), Equals, true)
+	c.Check(tr.IsSecret("test-snap", "missing"), Equals, false)
+}
+
+func (s *secretsSuite) TestSecretsReadOnce(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "token", "s3cr3t"), IsNil)
+	c.Assert(tr.MarkSecret("test-snap", "token"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+
+	// the secrets are not read again from disk
+	c.Assert(os.Remove(config.SecretsFile(s.state)), IsNil)
+	tr = config.NewTransaction(s.state)
+	var value string
+	c.Assert(tr.Get("test-snap", "token", &value), IsNil)
+	c.Check(value, Equals, "s3cr3t")
+}
+
+func (s *secretsSuite) TestSecretsLoadError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "name", "foo"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapConfigSecretsFile), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(dirs.SnapConfigSecretsFile, []byte("{"), 0600), IsNil)
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+	st.Set("config", s.stateConfig(c))
+
+	// options that are not secret can still be read
+	tr = config.NewTransaction(st)
+	var value string
+	c.Assert(tr.Get("test-snap", "name", &value), IsNil)
+	c.Check(value, Equals, "foo")
+	// others may be secret
+	err := tr.Get("test-snap", "token", &value)
+	c.Check(err, ErrorMatches, "cannot unmarshal secret configuration: .*")
+
+	// but no changes are committed, secrets could leak
+	c.Assert(tr.Set("test-snap", "name", "bar"), IsNil)
+	err = tr.Commit()
+	c.Check(err, ErrorMatches, "cannot commit configuration: cannot unmarshal secret configuration: .*")
+	var cfg map[string]map[string]interface{}
+	c.Assert(st.Get("config", &cfg), IsNil)
+	c.Check(cfg["test-snap"]["name"], Equals, "foo")
+}
+
+func (s *secretsSuite) TestSecretsFollowStateGeneration(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "token", "old"), IsNil)
+	c.Assert(tr.MarkSecret("test-snap", "token"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	oldFile := config.SecretsFile(s.state)
+
+	// the state as checkpointed before the secrets changed
+	data, err := s.state.MarshalJSON()
+	c.Assert(err, IsNil)
+
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "token", "new"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	newFile := config.SecretsFile(s.state)
+	c.Check(newFile, Not(Equals), oldFile)
+	c.Check(oldFile, testutil.FilePresent)
+
+	// snapd restarting without that change having been checkpointed
+	st, err := state.ReadState(nil, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	st.Lock()
+	defer st.Unlock()
+	secrets, err := config.SnapSecrets(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*secrets["token"]), Equals, `"old"`)
+	// the secrets of other generations are gone
+	c.Check(oldFile, testutil.FilePresent)
+	c.Check(newFile, testutil.FileAbsent)
+}
+
+func (s *secretsSuite) TestMarkSecretForgetsHistory(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("test-snap", "name", "foo"), IsNil)
+	c.Assert(tr.Set("test-snap", "password", "pw"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+
+	tr = config.NewTransaction(s.state)
+	c.Assert(tr.MarkSecret("test-snap", "password"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+
+	entries, err := config.History(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entries[0].Config, HasLen, 1)
+	c.Check(string(*entries[0].Config["name"]), Equals, `"foo"`)
+}
+
+func (s *secretsSuite) TestRedactHistory(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	value := json.RawMessage(`"pw"`)
+	name := json.RawMessage(`"foo"`)
+	entries := []*config.HistoryEntry{
+		{ID: 1, Config: map[string]*json.RawMessage{"password": &value, "name": &name}},
+	}
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.MarkSecret("test-snap", "password"), IsNil)
+	redacted := tr.RedactHistory("test-snap", entries)
+	c.Assert(redacted, HasLen, 1)
+	c.Check(redacted[0].ID, Equals, 1)
+	c.Check(string(*redacted[0].Config["password"]), Equals, `"*****"`)
+	c.Check(string(*redacted[0].Config["name"]), Equals, `"foo"`)
+	// the entries given are left alone
+	c.Check(string(*entries[0].Config["password"]), Equals, `"pw"`)
+}
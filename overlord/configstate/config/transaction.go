@@ -28,6 +28,7 @@ import (
 	"sync"
 
 	"github.com/snapcore/snapd/jsonutil"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -42,6 +43,18 @@ type Transaction struct {
 	state    *state.State
 	pristine map[string]map[string]*json.RawMessage // snap => key => value
 	changes  map[string]map[string]interface{}
+
+	// secret top level options, snap => option
+	secret map[string]map[string]bool
+	// secretsErr is set if the secret options could not be loaded
+	secretsErr error
+	// options marked (true) or unmarked (false) as secret by the
+	// transaction, applied on commit
+	secretChanges map[string]map[string]bool
+
+	// recorded in the configuration history on commit
+	changeID string
+	author   *uint32
 }
 
 // NewTransaction creates a new configuration transaction initialized with the given state.
@@ -50,6 +63,8 @@ type Transaction struct {
 func NewTransaction(st *state.State) *Transaction {
 	transaction := &Transaction{state: st}
 	transaction.changes = make(map[string]map[string]interface{})
+	transaction.secret = make(map[string]map[string]bool)
+	transaction.secretChanges = make(map[string]map[string]bool)
 
 	// Record the current state of the map containing the config of every snap
 	// in the system. We'll use it for this transaction.
@@ -59,6 +74,14 @@ func NewTransaction(st *state.State) *Transaction {
 	} else if err != nil {
 		panic(fmt.Errorf("internal error: cannot unmarshal configuration: %v", err))
 	}
+	secrets, err := loadSecrets(st)
+	if err != nil {
+		// options that are not secret can still be used
+		logger.Noticef("cannot load secret configuration: %v", err)
+		transaction.secretsErr = err
+	} else {
+		mergeSecrets(transaction.pristine, transaction.secret, secrets)
+	}
 	return transaction
 }
 
@@ -67,6 +90,125 @@ func (t *Transaction) State() *state.State {
 	return t.state
 }
 
+// SetChangeID sets the change on behalf of which the transaction is
+// committed, as recorded in the configuration history.
+func (t *Transaction) SetChangeID(changeID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.changeID = changeID
+}
+
+// SetAuthor sets the user that requested the changes of the transaction, as
+// recorded in the configuration history.
+func (t *Transaction) SetAuthor(uid uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.author = &uid
+}
+
+// MarkSecret marks the given top level option of the snap as secret, its
+// value is kept out of the state once the transaction is committed.
+func (t *Transaction) MarkSecret(instanceName, key string) error {
+	return t.setSecret(instanceName, key, true)
+}
+
+// UnmarkSecret makes the given top level option of the snap no longer
+// secret once the transaction is committed, its value is then kept in the
+// state like that of any other option. A mark made by the transaction is
+// dropped.
+func (t *Transaction) UnmarkSecret(instanceName, key string) error {
+	return t.setSecret(instanceName, key, false)
+}
+
+func (t *Transaction) setSecret(instanceName, key string, secret bool) error {
+	subkeys, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+	if len(subkeys) != 1 {
+		if secret {
+			return fmt.Errorf("cannot mark nested option %q of snap %q as secret", key, instanceName)
+		}
+		return fmt.Errorf("cannot unmark nested option %q of snap %q as secret", key, instanceName)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changes := t.secretChanges[instanceName]
+	if t.secret[instanceName][key] == secret {
+		// nothing to change on commit
+		delete(changes, key)
+		if len(changes) == 0 {
+			delete(t.secretChanges, instanceName)
+		}
+		return nil
+	}
+	if changes == nil {
+		changes = make(map[string]bool)
+		t.secretChanges[instanceName] = changes
+	}
+	changes[key] = secret
+	return nil
+}
+
+// IsSecret returns whether the given option of the snap is secret, that is
+// whether its top level option is, including the changes made by the
+// transaction.
+func (t *Transaction) IsSecret(instanceName, key string) bool {
+	subkeys, err := ParseKey(key)
+	if err != nil || len(subkeys) == 0 {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if secret, ok := t.secretChanges[instanceName][subkeys[0]]; ok {
+		return secret
+	}
+	return t.secret[instanceName][subkeys[0]]
+}
+
+// Redact returns the value of the given option of the snap as it can be
+// shown to non-root users: secret values are replaced by RedactedValue,
+// including inside the whole configuration document requested with an
+// empty key.
+func (t *Transaction) Redact(instanceName, key string, value interface{}) interface{} {
+	if key != "" {
+		if t.IsSecret(instanceName, key) {
+			return RedactedValue
+		}
+		return value
+	}
+	doc, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	redacted := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		redacted[k] = t.Redact(instanceName, k, v)
+	}
+	return redacted
+}
+
+// RedactHistory returns copies of the given configuration history entries
+// of the snap as they can be shown to non-root users, with the values of
+// secret options replaced by RedactedValue.
+func (t *Transaction) RedactHistory(instanceName string, entries []*HistoryEntry) []*HistoryEntry {
+	redacted := make([]*HistoryEntry, len(entries))
+	for i, entry := range entries {
+		entryCopy := *entry
+		entryCopy.Config = make(map[string]*json.RawMessage, len(entry.Config))
+		for k, v := range entry.Config {
+			if t.IsSecret(instanceName, k) {
+				v = jsonRaw(RedactedValue)
+			}
+			entryCopy.Config[k] = v
+		}
+		redacted[i] = &entryCopy
+	}
+	return redacted
+}
+
 func changes(cfgStr string, cfg map[string]interface{}) []string {
 	var out []string
 	for k := range cfg {
@@ -179,7 +321,16 @@ func (t *Transaction) Get(snapName, key string, result interface{}) error {
 	applyChanges(config, t.changes[snapName])
 
 	purgeNulls(config)
-	return getFromConfig(snapName, subkeys, 0, config, result)
+	return t.checkSecretsErr(getFromConfig(snapName, subkeys, 0, config, result))
+}
+
+// checkSecretsErr returns, instead of the given missing option error, the
+// error loading the secret options, as the option may well be one of them.
+func (t *Transaction) checkSecretsErr(err error) error {
+	if t.secretsErr != nil && IsNoOption(err) {
+		return t.secretsErr
+	}
+	return err
 }
 
 // GetMaybe unmarshals into result the cached value of the provided snap's configuration key.
@@ -208,7 +359,7 @@ func (t *Transaction) GetPristine(snapName, key string, result interface{}) erro
 		return err
 	}
 
-	return getFromConfig(snapName, subkeys, 0, t.pristine[snapName], result)
+	return t.checkSecretsErr(getFromConfig(snapName, subkeys, 0, t.pristine[snapName], result))
 }
 
 // GetPristineMaybe unmarshals the cached pristine (before applying any
@@ -268,12 +419,12 @@ func getFromConfig(instanceName string, subkeys []string, pos int, config map[st
 // and updates the observed configuration to the result of the operation.
 //
 // The state associated with the transaction must be locked by the caller.
-func (t *Transaction) Commit() {
+func (t *Transaction) Commit() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if len(t.changes) == 0 {
-		return
+	if len(t.changes) == 0 && len(t.secretChanges) == 0 {
+		return nil
 	}
 
 	// Update our copy of the config with the most recent one from the state.
@@ -283,6 +434,14 @@ func (t *Transaction) Commit() {
 	} else if err != nil {
 		panic(fmt.Errorf("internal error: cannot unmarshal configuration: %v", err))
 	}
+	// without the secrets, their values could end up in the state
+	secrets, err := loadSecrets(t.state)
+	if err != nil {
+		return fmt.Errorf("cannot commit configuration: %v", err)
+	}
+	t.secret = make(map[string]map[string]bool)
+	mergeSecrets(t.pristine, t.secret, secrets)
+	marked := applySecretChanges(t.secret, t.secretChanges)
 
 	// Iterate through the write cache and save each item.
 	for instanceName, snapChanges := range t.changes {
@@ -295,10 +454,54 @@ func (t *Transaction) Commit() {
 		t.pristine[instanceName] = config
 	}
 
-	t.state.Set("config", t.pristine)
+	// secret values only ever go to the secrets file
+	public, newSecrets := splitSecrets(t.pristine, t.secret)
+	if !secretsEqual(secrets, newSecrets) {
+		if err := saveSecrets(t.state, newSecrets); err != nil {
+			return fmt.Errorf("cannot commit configuration: cannot write secret configuration: %v", err)
+		}
+	}
+	// values recorded before the options became secret
+	for instanceName, keys := range marked {
+		forgetHistoryValues(t.state, instanceName, keys)
+	}
+	for instanceName := range t.changes {
+		recordHistory(t.state, instanceName, public[instanceName], t.changeID, t.author)
+	}
+
+	t.state.Set("config", public)
 
 	// The cache has been flushed, reset it.
 	t.changes = make(map[string]map[string]interface{})
+	t.secretChanges = make(map[string]map[string]bool)
+	return nil
+}
+
+// applySecretChanges marks and unmarks the secret options as changed by a
+// transaction, it returns the options that became secret.
+func applySecretChanges(secret, changes map[string]map[string]bool) (marked map[string]map[string]bool) {
+	marked = make(map[string]map[string]bool)
+	for instanceName, snapChanges := range changes {
+		keys := secret[instanceName]
+		if keys == nil {
+			keys = make(map[string]bool, len(snapChanges))
+			secret[instanceName] = keys
+		}
+		for k, isSecret := range snapChanges {
+			if !isSecret {
+				delete(keys, k)
+				continue
+			}
+			if !keys[k] {
+				keys[k] = true
+				if marked[instanceName] == nil {
+					marked[instanceName] = make(map[string]bool)
+				}
+				marked[instanceName][k] = true
+			}
+		}
+	}
+	return marked
 }
 
 func applyChanges(config map[string]*json.RawMessage, changes map[string]interface{}) {
@@ -0,0 +1,80 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+const apiTLSListenOpt = "api.tls.listen"
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core."+apiTLSListenOpt] = true
+}
+
+func validateAPITLSSettings(tr config.Conf) error {
+	addr, err := coreCfg(tr, apiTLSListenOpt)
+	if err != nil {
+		return err
+	}
+	if addr == "" {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("cannot set %q: %v", apiTLSListenOpt, err)
+	}
+	if host != "" && net.ParseIP(host) == nil {
+		return fmt.Errorf("cannot set %q: invalid IP address %q", apiTLSListenOpt, host)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return fmt.Errorf("cannot set %q: invalid port %q", apiTLSListenOpt, port)
+	}
+	return nil
+}
+
+func handleAPITLSConfiguration(tr config.Conf, opts *fsOnlyContext) error {
+	var pristineAddr, newAddr string
+
+	if err := tr.GetPristine("core", apiTLSListenOpt, &pristineAddr); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	if err := tr.Get("core", apiTLSListenOpt, &newAddr); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	if pristineAddr == newAddr {
+		return nil
+	}
+
+	// the listener is set up when the daemon starts
+	st := tr.State()
+	st.Lock()
+	defer st.Unlock()
+	logger.Noticef("TLS API listener address changed, requesting a restart of snapd")
+	st.RequestRestart(state.RestartDaemon)
+	return nil
+}
@@ -0,0 +1,106 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+type apiTLSSuite struct {
+	configcoreSuite
+
+	backend *restartBackend
+}
+
+var _ = Suite(&apiTLSSuite{})
+
+func (s *apiTLSSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	s.backend = &restartBackend{}
+	s.state = state.New(s.backend)
+}
+
+func (s *apiTLSSuite) TestConfigureAPITLSListenInvalid(c *C) {
+	for _, tc := range []struct {
+		addr string
+		err  string
+	}{
+		{"localhost", `cannot set "api.tls.listen": address localhost: missing port in address`},
+		{"example.com:8443", `cannot set "api.tls.listen": invalid IP address "example.com"`},
+		{":https", `cannot set "api.tls.listen": invalid port "https"`},
+		{":0", `cannot set "api.tls.listen": invalid port "0"`},
+		{":70000", `cannot set "api.tls.listen": invalid port "70000"`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			changes: map[string]interface{}{
+				"api.tls.listen": tc.addr,
+			},
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf(tc.addr))
+	}
+	c.Check(s.backend.restartRequested, HasLen, 0)
+}
+
+func (s *apiTLSSuite) TestConfigureAPITLSListenRequestsRestart(c *C) {
+	for _, addr := range []string{":8443", "10.0.0.1:8443", "[::1]:8443"} {
+		s.backend.restartRequested = nil
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			changes: map[string]interface{}{
+				"api.tls.listen": addr,
+			},
+		})
+		c.Assert(err, IsNil)
+		c.Check(s.backend.restartRequested, DeepEquals, []state.RestartType{state.RestartDaemon}, Commentf(addr))
+	}
+}
+
+func (s *apiTLSSuite) TestConfigureAPITLSListenUnchanged(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"api.tls.listen": ":8443",
+		},
+		changes: map[string]interface{}{
+			"api.tls.listen": ":8443",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.backend.restartRequested, HasLen, 0)
+}
+
+func (s *apiTLSSuite) TestConfigureAPITLSListenUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"api.tls.listen": ":8443",
+		},
+		changes: map[string]interface{}{
+			"api.tls.listen": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.backend.restartRequested, DeepEquals, []state.RestartType{state.RestartDaemon})
+}
@@ -24,6 +24,7 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/snapcore/snapd/overlord/configstate/config"
 )
@@ -78,6 +79,11 @@ func (cfg plainCoreConfig) Get(snapName, key string, result interface{}) error {
 	}
 
 	val, ok := cfg[key]
+	if !ok {
+		// the config may be flattened (e.g. gadget defaults), so
+		// reassemble the subtree under the key if there is one
+		val, ok = cfg.subtree(key)
+	}
 	if !ok {
 		return &config.NoOptionError{SnapName: snapName, Key: key}
 	}
@@ -87,6 +93,32 @@ func (cfg plainCoreConfig) Get(snapName, key string, result interface{}) error {
 	return nil
 }
 
+// subtree returns the nested map of the dotted keys under the given key.
+func (cfg plainCoreConfig) subtree(key string) (map[string]interface{}, bool) {
+	prefix := key + "."
+	var tree map[string]interface{}
+	for k, v := range cfg {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if tree == nil {
+			tree = make(map[string]interface{})
+		}
+		subkeys := strings.Split(strings.TrimPrefix(k, prefix), ".")
+		node := tree
+		for _, subkey := range subkeys[:len(subkeys)-1] {
+			child, ok := node[subkey].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[subkey] = child
+			}
+			node = child
+		}
+		node[subkeys[len(subkeys)-1]] = v
+	}
+	return tree, tree != nil
+}
+
 // GetMaybe implements config.ConfGetter interface.
 func (cfg plainCoreConfig) GetMaybe(instanceName, key string, result interface{}) error {
 	err := cfg.Get(instanceName, key, result)
@@ -19,7 +19,12 @@
 
 package configcore
 
-import "github.com/snapcore/snapd/osutil/sys"
+import (
+	"time"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil/sys"
+)
 
 var (
 	UpdatePiConfig       = updatePiConfig
@@ -48,3 +53,27 @@ func MockChownPath(f func(string, sys.UserID, sys.GroupID) error) func() {
 		sysChownPath = old
 	}
 }
+
+func MockNetplanWaitOnline(f func(ifaces []string, timeout time.Duration) error) func() {
+	old := netplanWaitOnline
+	netplanWaitOnline = f
+	return func() {
+		netplanWaitOnline = old
+	}
+}
+
+func MockBootSetExtraKernelCommandLine(f func(model *asserts.Model, extraArgs string) (bool, error)) func() {
+	old := bootSetExtraKernelCommandLine
+	bootSetExtraKernelCommandLine = f
+	return func() {
+		bootSetExtraKernelCommandLine = old
+	}
+}
+
+func MockOsutilCheckFreeSpace(f func(path string, minSize uint64) error) func() {
+	old := osutilCheckFreeSpace
+	osutilCheckFreeSpace = f
+	return func() {
+		osutilCheckFreeSpace = old
+	}
+}
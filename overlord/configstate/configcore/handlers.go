@@ -88,6 +88,21 @@ func init() {
 	// system.timezone
 	addFSOnlyHandler(validateTimezoneSettings, handleTimezoneConfiguration, coreOnly)
 
+	// system.network.*
+	addFSOnlyHandler(validateNetplanSettings, handleNetplanConfiguration, coreOnly)
+
+	// system.swap.size
+	addFSOnlyHandler(validateSwapSettings, handleSwapConfiguration, coreOnly)
+
+	// system.hostname
+	addFSOnlyHandler(validateHostnameSettings, handleHostnameConfiguration, coreOnly)
+
+	// system.timeserver.servers
+	addFSOnlyHandler(validateTimeserverSettings, handleTimeserverConfiguration, coreOnly)
+
+	// system.locale
+	addFSOnlyHandler(validateLocaleSettings, handleLocaleConfiguration, coreOnly)
+
 	sysconfig.ApplyFilesystemOnlyDefaultsImpl = func(rootDir string, defaults map[string]interface{}, options *sysconfig.FilesystemOnlyApplyOptions) error {
 		return filesystemOnlyApply(rootDir, plainCoreConfig(defaults), options)
 	}
@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type hostnameSuite struct {
+	configcoreSuite
+
+	mockedHostnamectl *testutil.MockCmd
+}
+
+var _ = Suite(&hostnameSuite{})
+
+func (s *hostnameSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.AddCleanup(release.MockOnClassic(false))
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc/"), 0755)
+	c.Assert(err, IsNil)
+
+	s.mockedHostnamectl = testutil.MockCommand(c, "hostnamectl", "")
+	s.AddCleanup(s.mockedHostnamectl.Restore)
+}
+
+func (s *hostnameSuite) TestConfigureHostnameInvalid(c *C) {
+	invalidHostnames := []string{
+		"-no-start-with-dash", "no-end-with-dash-", "no_underscore",
+		"no..empty-label", "no-ä", strings.Repeat("x", 65),
+		"a." + strings.Repeat("x", 64),
+	}
+
+	for _, name := range invalidHostnames {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.hostname": name,
+			},
+		})
+		c.Assert(err, ErrorMatches, `cannot set hostname.*`, Commentf("%q", name))
+	}
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
+
+func (s *hostnameSuite) TestConfigureHostnameIntegration(c *C) {
+	validHostnames := []string{
+		"a", "foo", "foo-bar", "UPPER", "42", "device-1.example.com",
+		strings.Repeat("x", 63),
+	}
+
+	for _, name := range validHostnames {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.hostname": name,
+			},
+		})
+		c.Assert(err, IsNil)
+		c.Check(s.mockedHostnamectl.Calls(), DeepEquals, [][]string{
+			{"hostnamectl", "set-hostname", name},
+		})
+		s.mockedHostnamectl.ForgetCalls()
+	}
+}
+
+func (s *hostnameSuite) TestConfigureHostnameUnchanged(c *C) {
+	err := ioutil.WriteFile(filepath.Join(dirs.GlobalRootDir, "/etc/hostname"), []byte("foo\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.hostname": "foo",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
+
+func (s *hostnameSuite) TestConfigureHostnameUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.hostname": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	// the hostname of the system is kept
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
+
+func (s *hostnameSuite) TestConfigureHostnameError(c *C) {
+	s.mockedHostnamectl.Restore()
+	s.mockedHostnamectl = testutil.MockCommand(c, "hostnamectl", "echo some error; exit 1")
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.hostname": "foo",
+		},
+	})
+	c.Assert(err, ErrorMatches, "cannot set hostname: some error")
+}
+
+func (s *hostnameSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"system.hostname": "foo",
+	})
+	tmpDir := c.MkDir()
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	c.Check(filepath.Join(tmpDir, "/etc/writable/hostname"), testutil.FileEquals, "foo\n")
+	c.Check(s.mockedHostnamectl.Calls(), HasLen, 0)
+}
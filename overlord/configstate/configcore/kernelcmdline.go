@@ -0,0 +1,144 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/strutil"
+)
+
+const kernelCmdlineAppendOpt = "system.kernel.cmdline-append"
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core."+kernelCmdlineAppendOpt] = true
+}
+
+var bootSetExtraKernelCommandLine = boot.SetExtraKernelCommandLine
+
+// the arguments end up in the bootloader environment, restrict them to a
+// safe set of characters
+var validKernelCmdlineArg = regexp.MustCompile(`^[a-zA-Z0-9_.,:/+-]+(=[a-zA-Z0-9_.,:/=+-]*)?$`).MatchString
+
+// kernelCmdlineAppendArgs returns the list of arguments to append to the
+// kernel command line.
+func kernelCmdlineAppendArgs(tr config.ConfGetter) ([]string, error) {
+	value, err := coreCfg(tr, kernelCmdlineAppendOpt)
+	if err != nil {
+		return nil, err
+	}
+	args, err := strutil.KernelCommandLineSplit(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set %s: %v", kernelCmdlineAppendOpt, err)
+	}
+	for _, arg := range args {
+		if !validKernelCmdlineArg(arg) {
+			return nil, fmt.Errorf("cannot set %s: invalid argument %q", kernelCmdlineAppendOpt, arg)
+		}
+	}
+	return args, nil
+}
+
+// gadgetKernelCmdline returns the kernel command line arguments allowed by
+// the gadget of the device.
+func gadgetKernelCmdline(st *state.State) (*gadget.KernelCmdline, error) {
+	deviceCtx, err := snapstate.DeviceCtx(st, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	gadgetInfo, err := snapstate.GadgetInfo(st, deviceCtx)
+	if err != nil {
+		return nil, err
+	}
+	ginfo, err := gadget.ReadInfo(gadgetInfo.MountDir(), deviceCtx.Model())
+	if err != nil {
+		return nil, err
+	}
+	return &ginfo.KernelCmdline, nil
+}
+
+func validateKernelCmdlineSettings(tr config.Conf) error {
+	args, err := kernelCmdlineAppendArgs(tr)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	st := tr.State()
+	st.Lock()
+	defer st.Unlock()
+
+	allowed, err := gadgetKernelCmdline(st)
+	if err != nil {
+		return fmt.Errorf("cannot set %s: cannot read the allowed kernel command line arguments: %v", kernelCmdlineAppendOpt, err)
+	}
+	for _, arg := range args {
+		if !allowed.Allows(arg) {
+			return fmt.Errorf("cannot set %s: argument %q is not allowed by the gadget", kernelCmdlineAppendOpt, arg)
+		}
+	}
+	return nil
+}
+
+func handleKernelCmdlineConfiguration(tr config.Conf, opts *fsOnlyContext) error {
+	var pristine, current string
+	if err := tr.GetPristine("core", kernelCmdlineAppendOpt, &pristine); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	if err := tr.Get("core", kernelCmdlineAppendOpt, &current); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	if pristine == current {
+		return nil
+	}
+	args, err := kernelCmdlineAppendArgs(tr)
+	if err != nil {
+		return err
+	}
+
+	st := tr.State()
+	st.Lock()
+	defer st.Unlock()
+
+	deviceCtx, err := snapstate.DeviceCtx(st, nil, nil)
+	if err != nil {
+		return err
+	}
+	rebootRequired, err := bootSetExtraKernelCommandLine(deviceCtx.Model(), strings.Join(args, " "))
+	if err != nil {
+		return fmt.Errorf("cannot set %s: %v", kernelCmdlineAppendOpt, err)
+	}
+	if rebootRequired {
+		logger.Noticef("kernel command line changed, requesting a reboot")
+		st.RequestRestart(state.RestartSystem)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/snapstate/snapstatetest"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type restartBackend struct {
+	restartRequested []state.RestartType
+}
+
+func (b *restartBackend) Checkpoint([]byte) error { return nil }
+
+func (b *restartBackend) EnsureBefore(d time.Duration) {}
+
+func (b *restartBackend) RequestRestart(t state.RestartType) {
+	b.restartRequested = append(b.restartRequested, t)
+}
+
+type kernelCmdlineSuite struct {
+	configcoreSuite
+
+	backend *restartBackend
+	model   *asserts.Model
+	calls   []string
+	setErr  error
+}
+
+var _ = Suite(&kernelCmdlineSuite{})
+
+const kernelCmdlineGadgetYaml = `
+kernel-cmdline:
+  allow:
+    - isolcpus
+    - debug
+    - console=ttyS0
+volumes:
+  pc:
+    bootloader: grub
+`
+
+func (s *kernelCmdlineSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.AddCleanup(release.MockOnClassic(false))
+	c.Assert(os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "etc"), 0755), IsNil)
+
+	s.backend = &restartBackend{}
+	s.state = state.New(s.backend)
+	s.state.Lock()
+	c.Assert(s.state.VerifyReboot("boot-id-1"), IsNil)
+	s.state.Unlock()
+
+	s.model = assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "model",
+		"authority-id": "brand",
+		"series":       "16",
+		"brand-id":     "brand",
+		"model":        "baz-3000",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "kernel",
+		"timestamp":    "2018-01-01T08:00:00+00:00",
+	}).(*asserts.Model)
+	s.AddCleanup(snapstatetest.MockDeviceModel(s.model))
+
+	si := &snap.SideInfo{RealName: "pc", Revision: snap.R(1)}
+	snaptest.MockSnapWithFiles(c, "name: pc\ntype: gadget\nversion: 1", si, [][]string{
+		{"meta/gadget.yaml", kernelCmdlineGadgetYaml},
+	})
+	s.state.Lock()
+	snapstate.Set(s.state, "pc", &snapstate.SnapState{
+		SnapType: "gadget",
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		Active:   true,
+	})
+	s.state.Unlock()
+
+	s.calls = nil
+	s.setErr = nil
+	s.AddCleanup(configcore.MockBootSetExtraKernelCommandLine(func(model *asserts.Model, extraArgs string) (bool, error) {
+		c.Check(model, Equals, s.model)
+		s.calls = append(s.calls, extraArgs)
+		return s.setErr == nil, s.setErr
+	}))
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineInvalid(c *C) {
+	for _, tc := range []struct {
+		value string
+		err   string
+	}{
+		{`isolcpus="1`, `cannot set system.kernel.cmdline-append: unbalanced quoting`},
+		{`debug;reboot`, `cannot set system.kernel.cmdline-append: invalid argument "debug;reboot"`},
+		{`isolcpus="1 2"`, `cannot set system.kernel.cmdline-append: invalid argument .*`},
+		{`quiet`, `cannot set system.kernel.cmdline-append: argument "quiet" is not allowed by the gadget`},
+		{`console=tty1`, `cannot set system.kernel.cmdline-append: argument "console=tty1" is not allowed by the gadget`},
+		{`snapd_recovery_mode=install`, `cannot set system.kernel.cmdline-append: argument "snapd_recovery_mode=install" is not allowed by the gadget`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			changes: map[string]interface{}{
+				"system.kernel.cmdline-append": tc.value,
+			},
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf("%q", tc.value))
+	}
+	c.Check(s.calls, HasLen, 0)
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"system.kernel.cmdline-append": "isolcpus=1,2 debug console=ttyS0",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.calls, DeepEquals, []string{"isolcpus=1,2 debug console=ttyS0"})
+	c.Check(s.backend.restartRequested, DeepEquals, []state.RestartType{state.RestartSystem})
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineUnchanged(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.kernel.cmdline-append": "debug",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.calls, HasLen, 0)
+	c.Check(s.backend.restartRequested, HasLen, 0)
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.kernel.cmdline-append": "debug",
+		},
+		changes: map[string]interface{}{
+			"system.kernel.cmdline-append": "",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.calls, DeepEquals, []string{""})
+	c.Check(s.backend.restartRequested, DeepEquals, []state.RestartType{state.RestartSystem})
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineError(c *C) {
+	s.setErr = errors.New("cannot reseal")
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"system.kernel.cmdline-append": "debug",
+		},
+	})
+	c.Assert(err, ErrorMatches, "cannot set system.kernel.cmdline-append: cannot reseal")
+	c.Check(s.backend.restartRequested, HasLen, 0)
+}
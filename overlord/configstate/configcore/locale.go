@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.locale"] = true
+}
+
+// locale names look like language[_territory][.codeset][@modifier]
+var validLocale = regexp.MustCompile(`^(C|POSIX|[a-z]{2,3}(_[A-Z]{2})?)(\.[a-zA-Z0-9-]+)?(@[a-zA-Z0-9]+)?$`).MatchString
+
+func validateLocaleSettings(tr config.ConfGetter) error {
+	locale, err := coreCfg(tr, "system.locale")
+	if err != nil {
+		return err
+	}
+	if locale == "" {
+		return nil
+	}
+	if !validLocale(locale) {
+		return fmt.Errorf("cannot set locale %q: name not valid", locale)
+	}
+	return nil
+}
+
+// currentLocale returns the LANG of /etc/default/locale of the running
+// system, or an empty string if it is not set.
+func currentLocale() (string, error) {
+	f, err := os.Open(filepath.Join(dirs.GlobalRootDir, "/etc/default/locale"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var lang string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "LANG=") {
+			lang = strings.Trim(line[len("LANG="):], `"'`)
+		}
+	}
+	return lang, scanner.Err()
+}
+
+func handleLocaleConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	locale, err := coreCfg(tr, "system.locale")
+	if err != nil {
+		return err
+	}
+	// nothing to do, unsetting the option keeps the locale of the
+	// system as it is
+	if locale == "" {
+		return nil
+	}
+	// runtime system
+	if opts == nil {
+		current, err := currentLocale()
+		if err == nil && current == locale {
+			return nil
+		}
+		output, err := exec.Command("localectl", "set-locale", "LANG="+locale).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("cannot set locale: %v", osutil.OutputErr(output, err))
+		}
+	} else {
+		// this is what localectl writes on Ubuntu
+		localePath := filepath.Join(opts.RootDir, "/etc/default/locale")
+		if err := os.MkdirAll(filepath.Dir(localePath), 0755); err != nil {
+			return err
+		}
+		if err := osutil.AtomicWriteFile(localePath, []byte("LANG="+locale+"\n"), 0644, 0); err != nil {
+			return fmt.Errorf("cannot write locale: %v", err)
+		}
+	}
+
+	return nil
+}
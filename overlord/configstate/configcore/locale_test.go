@@ -0,0 +1,147 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package configcore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type localeSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&localeSuite{})
+
+func (s *localeSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc/"), 0755)
+	c.Assert(err, IsNil)
+}
+
+func (s *localeSuite) TestConfigureLocaleInvalid(c *C) {
+	invalidLocales := []string{
+		"english", "en_us", "EN_US", "en_US.", "en_US.UTF-8@", "en_US UTF-8", "../../etc",
+	}
+
+	for _, locale := range invalidLocales {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.locale": locale,
+			},
+		})
+		c.Assert(err, ErrorMatches, `cannot set locale .*: name not valid`, Commentf("%q", locale))
+	}
+}
+
+func (s *localeSuite) TestConfigureLocaleIntegration(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	mockedLocalectl := testutil.MockCommand(c, "localectl", "")
+	defer mockedLocalectl.Restore()
+
+	validLocales := []string{
+		"C", "C.UTF-8", "POSIX", "en_US.UTF-8", "de_DE", "ast_ES.utf8", "sr_RS@latin", "de_DE.UTF-8@euro",
+	}
+
+	for _, locale := range validLocales {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.locale": locale,
+			},
+		})
+		c.Assert(err, IsNil)
+		c.Check(mockedLocalectl.Calls(), DeepEquals, [][]string{
+			{"localectl", "set-locale", "LANG=" + locale},
+		})
+		mockedLocalectl.ForgetCalls()
+	}
+}
+
+func (s *localeSuite) TestConfigureLocaleAlreadySet(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	mockedLocalectl := testutil.MockCommand(c, "localectl", "")
+	defer mockedLocalectl.Restore()
+
+	localePath := filepath.Join(dirs.GlobalRootDir, "/etc/default/locale")
+	c.Assert(os.MkdirAll(filepath.Dir(localePath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(localePath, []byte("# set by the installer\nLANG=\"de_DE.UTF-8\"\n"), 0644), IsNil)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.locale": "de_DE.UTF-8",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(mockedLocalectl.Calls(), HasLen, 0)
+
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.locale": "en_US.UTF-8",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(mockedLocalectl.Calls(), DeepEquals, [][]string{
+		{"localectl", "set-locale", "LANG=en_US.UTF-8"},
+	})
+}
+
+func (s *localeSuite) TestConfigureLocaleUnset(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	mockedLocalectl := testutil.MockCommand(c, "localectl", "")
+	defer mockedLocalectl.Restore()
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.locale": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	// the locale of the system is kept
+	c.Check(mockedLocalectl.Calls(), HasLen, 0)
+}
+
+func (s *localeSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"system.locale": "de_DE.UTF-8",
+	})
+	tmpDir := c.MkDir()
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	c.Check(filepath.Join(tmpDir, "/etc/default/locale"), testutil.FileEquals, "LANG=de_DE.UTF-8\n")
+}
@@ -0,0 +1,321 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module, the options under
+	// system.network are checked by validateNetplanSettings
+	supportedConfigurations["core.system.network"] = true
+}
+
+// netplanConfigFile is the netplan configuration generated from
+// system.network, it sorts after the configuration of the image so that it
+// takes precedence.
+const netplanConfigFile = "90-snapd-config.yaml"
+
+type netplanRoute struct {
+	To     string `json:"to" yaml:"to"`
+	Via    string `json:"via" yaml:"via"`
+	Metric *int   `json:"metric,omitempty" yaml:"metric,omitempty"`
+}
+
+type netplanNameservers struct {
+	Addresses []string `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+	Search    []string `json:"search,omitempty" yaml:"search,omitempty"`
+}
+
+type netplanAccessPoint struct {
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	Hidden   bool   `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+}
+
+type netplanInterface struct {
+	DHCP4       *bool               `json:"dhcp4,omitempty" yaml:"dhcp4,omitempty"`
+	DHCP6       *bool               `json:"dhcp6,omitempty" yaml:"dhcp6,omitempty"`
+	Addresses   []string            `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+	Routes      []netplanRoute      `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Nameservers *netplanNameservers `json:"nameservers,omitempty" yaml:"nameservers,omitempty"`
+	MTU         *int                `json:"mtu,omitempty" yaml:"mtu,omitempty"`
+	// AccessPoints is only valid for wifis
+	AccessPoints map[string]netplanAccessPoint `json:"access-points,omitempty" yaml:"access-points,omitempty"`
+}
+
+// netplanNetwork is the system.network configuration, it uses the netplan
+// schema so it is rendered as is.
+type netplanNetwork struct {
+	Version   int                          `json:"-" yaml:"version"`
+	Ethernets map[string]*netplanInterface `json:"ethernets,omitempty" yaml:"ethernets,omitempty"`
+	Wifis     map[string]*netplanInterface `json:"wifis,omitempty" yaml:"wifis,omitempty"`
+}
+
+func (n *netplanNetwork) interfaces() []string {
+	var ifaces []string
+	for name := range n.Ethernets {
+		ifaces = append(ifaces, name)
+	}
+	for name := range n.Wifis {
+		ifaces = append(ifaces, name)
+	}
+	sort.Strings(ifaces)
+	return ifaces
+}
+
+// interface names are limited by the kernel to 15 characters
+var validNetplanInterface = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,14}$`).MatchString
+
+func validateNetplanInterface(name string, iface *netplanInterface, wifi bool) error {
+	if !validNetplanInterface(name) {
+		return fmt.Errorf("invalid interface name %q", name)
+	}
+	if iface == nil {
+		return fmt.Errorf("interface %q has no configuration", name)
+	}
+	for _, addr := range iface.Addresses {
+		if _, _, err := net.ParseCIDR(addr); err != nil {
+			return fmt.Errorf("invalid address %q for interface %q: address must be in CIDR notation", addr, name)
+		}
+	}
+	for _, route := range iface.Routes {
+		if route.To != "default" {
+			if _, _, err := net.ParseCIDR(route.To); err != nil {
+				return fmt.Errorf("invalid route destination %q for interface %q", route.To, name)
+			}
+		}
+		if net.ParseIP(route.Via) == nil {
+			return fmt.Errorf("invalid route gateway %q for interface %q", route.Via, name)
+		}
+		if route.Metric != nil && *route.Metric < 0 {
+			return fmt.Errorf("invalid route metric %v for interface %q", *route.Metric, name)
+		}
+	}
+	if iface.Nameservers != nil {
+		for _, addr := range iface.Nameservers.Addresses {
+			if net.ParseIP(addr) == nil {
+				return fmt.Errorf("invalid nameserver %q for interface %q", addr, name)
+			}
+		}
+	}
+	if iface.MTU != nil && (*iface.MTU < 68 || *iface.MTU > 65535) {
+		return fmt.Errorf("invalid mtu %v for interface %q", *iface.MTU, name)
+	}
+	if !wifi {
+		if len(iface.AccessPoints) != 0 {
+			return fmt.Errorf("interface %q is not a wifi interface and cannot have access points", name)
+		}
+		return nil
+	}
+	if len(iface.AccessPoints) == 0 {
+		return fmt.Errorf("wifi interface %q has no access points", name)
+	}
+	for ssid, ap := range iface.AccessPoints {
+		if ssid == "" || len(ssid) > 32 {
+			return fmt.Errorf("invalid access point name %q for interface %q", ssid, name)
+		}
+		// WPA passphrases
+		if ap.Password != "" && (len(ap.Password) < 8 || len(ap.Password) > 63) {
+			return fmt.Errorf("invalid password for access point %q of interface %q: must be between 8 and 63 characters", ssid, name)
+		}
+	}
+	return nil
+}
+
+// netplanConfig returns the system.network configuration, it is nil if
+// there is none.
+func netplanConfig(tr config.ConfGetter) (*netplanNetwork, error) {
+	var value interface{}
+	if err := tr.Get("core", "system.network", &value); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var network netplanNetwork
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&network); err != nil {
+		return nil, fmt.Errorf("cannot set system.network: %v", err)
+	}
+	network.Version = 2
+
+	for name, iface := range network.Ethernets {
+		if err := validateNetplanInterface(name, iface, false); err != nil {
+			return nil, fmt.Errorf("cannot set system.network: %v", err)
+		}
+	}
+	for name, iface := range network.Wifis {
+		if _, ok := network.Ethernets[name]; ok {
+			return nil, fmt.Errorf("cannot set system.network: interface %q is configured more than once", name)
+		}
+		if err := validateNetplanInterface(name, iface, true); err != nil {
+			return nil, fmt.Errorf("cannot set system.network: %v", err)
+		}
+	}
+	if len(network.interfaces()) == 0 {
+		return nil, nil
+	}
+	return &network, nil
+}
+
+func validateNetplanSettings(tr config.ConfGetter) error {
+	_, err := netplanConfig(tr)
+	return err
+}
+
+func renderNetplanConfig(network *netplanNetwork) ([]byte, error) {
+	data, err := yaml.Marshal(map[string]*netplanNetwork{"network": network})
+	if err != nil {
+		return nil, err
+	}
+	header := "# This file is generated by snapd from the system.network configuration,\n# do not edit.\n"
+	return append([]byte(header), data...), nil
+}
+
+// netplanConnectivityTimeout is how long the configured interfaces are
+// given to come online before the previous configuration is restored.
+var netplanConnectivityTimeout = 2 * time.Minute
+
+// netplanWaitOnline waits for any of the given interfaces to be online.
+var netplanWaitOnline = func(ifaces []string, timeout time.Duration) error {
+	args := []string{"--any", "--timeout=" + strconv.Itoa(int(timeout.Seconds()))}
+	for _, iface := range ifaces {
+		args = append(args, "--interface="+iface)
+	}
+	output, err := exec.Command("/lib/systemd/systemd-networkd-wait-online", args...).CombinedOutput()
+	if err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	return nil
+}
+
+func netplanApply() error {
+	if output, err := exec.Command("netplan", "apply").CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot apply network configuration: %v", osutil.OutputErr(output, err))
+	}
+	return nil
+}
+
+// restoreFile puts back the content the file had, it is removed if it did
+// not exist.
+func restoreFile(path string, content []byte, existed bool) error {
+	if !existed {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return osutil.AtomicWriteFile(path, content, 0600, 0)
+}
+
+func handleNetplanConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	network, err := netplanConfig(tr)
+	if err != nil {
+		return err
+	}
+
+	root := dirs.GlobalRootDir
+	if opts != nil {
+		root = opts.RootDir
+	}
+	configPath := filepath.Join(root, "/etc/netplan", netplanConfigFile)
+
+	var content []byte
+	if network != nil {
+		content, err = renderNetplanConfig(network)
+		if err != nil {
+			return err
+		}
+	}
+
+	oldContent, err := ioutil.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existed := err == nil
+	if existed == (network != nil) && bytes.Equal(oldContent, content) {
+		// nothing to do
+		return nil
+	}
+
+	// the config may contain wifi passwords
+	if network != nil {
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			return err
+		}
+		if err := osutil.AtomicWriteFile(configPath, content, 0600, 0); err != nil {
+			return err
+		}
+	} else {
+		if err := os.Remove(configPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if opts != nil {
+		// applied on boot
+		return nil
+	}
+
+	applyErr := netplanApply()
+	if applyErr == nil && network != nil {
+		if err := netplanWaitOnline(network.interfaces(), netplanConnectivityTimeout); err != nil {
+			applyErr = fmt.Errorf("cannot apply network configuration: connectivity lost: %v", err)
+		}
+	}
+	if applyErr == nil {
+		return nil
+	}
+
+	// go back to the previous configuration, which is known to work
+	if err := restoreFile(configPath, oldContent, existed); err != nil {
+		logger.Noticef("cannot restore previous network configuration: %v", err)
+		return applyErr
+	}
+	if err := netplanApply(); err != nil {
+		logger.Noticef("cannot restore previous network configuration: %v", err)
+		return applyErr
+	}
+	return fmt.Errorf("%v (previous configuration restored)", applyErr)
+}
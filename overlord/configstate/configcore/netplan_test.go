@@ -0,0 +1,283 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type netplanSuite struct {
+	configcoreSuite
+
+	mockNetplan *testutil.MockCmd
+	configPath  string
+	waitOnline  [][]string
+	onlineErr   error
+}
+
+var _ = Suite(&netplanSuite{})
+
+func (s *netplanSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.AddCleanup(release.MockOnClassic(false))
+
+	s.mockNetplan = testutil.MockCommand(c, "netplan", "")
+	s.AddCleanup(s.mockNetplan.Restore)
+
+	s.waitOnline = nil
+	s.onlineErr = nil
+	s.AddCleanup(configcore.MockNetplanWaitOnline(func(ifaces []string, timeout time.Duration) error {
+		s.waitOnline = append(s.waitOnline, ifaces)
+		return s.onlineErr
+	}))
+
+	s.configPath = filepath.Join(dirs.GlobalRootDir, "/etc/netplan/90-snapd-config.yaml")
+}
+
+func staticEth0() map[string]interface{} {
+	return map[string]interface{}{
+		"ethernets": map[string]interface{}{
+			"eth0": map[string]interface{}{
+				"dhcp4":     false,
+				"addresses": []interface{}{"10.0.0.2/24"},
+				"routes": []interface{}{
+					map[string]interface{}{"to": "default", "via": "10.0.0.1"},
+				},
+				"nameservers": map[string]interface{}{
+					"addresses": []interface{}{"10.0.0.1"},
+				},
+			},
+		},
+	}
+}
+
+const staticEth0Netplan = `# This file is generated by snapd from the system.network configuration,
+# do not edit.
+network:
+  version: 2
+  ethernets:
+    eth0:
+      dhcp4: false
+      addresses:
+      - 10.0.0.2/24
+      routes:
+      - to: default
+        via: 10.0.0.1
+      nameservers:
+        addresses:
+        - 10.0.0.1
+`
+
+func (s *netplanSuite) TestConfigureNetplanInvalid(c *C) {
+	for _, tc := range []struct {
+		network interface{}
+		err     string
+	}{
+		{map[string]interface{}{"bridges": map[string]interface{}{}}, `cannot set system.network: json: unknown field "bridges"`},
+		{map[string]interface{}{"ethernets": map[string]interface{}{"eth0": map[string]interface{}{"addresses": []interface{}{"10.0.0.2"}}}},
+			`cannot set system.network: invalid address "10.0.0.2" for interface "eth0": address must be in CIDR notation`},
+		{map[string]interface{}{"ethernets": map[string]interface{}{"eth0": map[string]interface{}{"routes": []interface{}{map[string]interface{}{"to": "default", "via": "nope"}}}}},
+			`cannot set system.network: invalid route gateway "nope" for interface "eth0"`},
+		{map[string]interface{}{"ethernets": map[string]interface{}{"eth0": map[string]interface{}{"nameservers": map[string]interface{}{"addresses": []interface{}{"1.2.3"}}}}},
+			`cannot set system.network: invalid nameserver "1.2.3" for interface "eth0"`},
+		{map[string]interface{}{"ethernets": map[string]interface{}{"not/valid": map[string]interface{}{"dhcp4": true}}},
+			`cannot set system.network: invalid interface name "not/valid"`},
+		{map[string]interface{}{"ethernets": map[string]interface{}{"eth0": map[string]interface{}{"access-points": map[string]interface{}{"ssid": map[string]interface{}{}}}}},
+			`cannot set system.network: interface "eth0" is not a wifi interface and cannot have access points`},
+		{map[string]interface{}{"wifis": map[string]interface{}{"wlan0": map[string]interface{}{"dhcp4": true}}},
+			`cannot set system.network: wifi interface "wlan0" has no access points`},
+		{map[string]interface{}{"wifis": map[string]interface{}{"wlan0": map[string]interface{}{"access-points": map[string]interface{}{"ssid": map[string]interface{}{"password": "short"}}}}},
+			`cannot set system.network: invalid password for access point "ssid" of interface "wlan0": must be between 8 and 63 characters`},
+		{"not-a-map", `cannot set system.network: json: cannot unmarshal string .*`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.network": tc.network,
+			},
+		})
+		c.Check(err, ErrorMatches, tc.err)
+	}
+	c.Check(s.mockNetplan.Calls(), HasLen, 0)
+	c.Check(s.configPath, testutil.FileAbsent)
+}
+
+func (s *netplanSuite) TestConfigureNetplanIntegration(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.network": staticEth0(),
+		},
+		changes: map[string]interface{}{
+			"system.network.ethernets.eth0.dhcp4": false,
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.configPath, testutil.FileEquals, staticEth0Netplan)
+	st, err := os.Stat(s.configPath)
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+	c.Check(s.mockNetplan.Calls(), DeepEquals, [][]string{{"netplan", "apply"}})
+	c.Check(s.waitOnline, DeepEquals, [][]string{{"eth0"}})
+
+	// nothing happens when the configuration does not change
+	s.mockNetplan.ForgetCalls()
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.network": staticEth0(),
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockNetplan.Calls(), HasLen, 0)
+}
+
+func (s *netplanSuite) TestConfigureNetplanWifi(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.network": map[string]interface{}{
+				"wifis": map[string]interface{}{
+					"wlan0": map[string]interface{}{
+						"dhcp4": true,
+						"access-points": map[string]interface{}{
+							"my-ssid": map[string]interface{}{"password": "secret-password"},
+						},
+					},
+				},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.configPath, testutil.FileEquals, `# This file is generated by snapd from the system.network configuration,
+# do not edit.
+network:
+  version: 2
+  wifis:
+    wlan0:
+      dhcp4: true
+      access-points:
+        my-ssid:
+          password: secret-password
+`)
+	c.Check(s.waitOnline, DeepEquals, [][]string{{"wlan0"}})
+}
+
+func (s *netplanSuite) TestConfigureNetplanConnectivityLostRollsBack(c *C) {
+	c.Assert(os.MkdirAll(filepath.Dir(s.configPath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.configPath, []byte("previous"), 0600), IsNil)
+	s.onlineErr = errors.New("timeout")
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.network": staticEth0(),
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot apply network configuration: connectivity lost: timeout \(previous configuration restored\)`)
+
+	c.Check(s.configPath, testutil.FileEquals, "previous")
+	c.Check(s.mockNetplan.Calls(), DeepEquals, [][]string{
+		{"netplan", "apply"},
+		{"netplan", "apply"},
+	})
+}
+
+func (s *netplanSuite) TestConfigureNetplanConnectivityLostNoPreviousConfig(c *C) {
+	s.onlineErr = errors.New("timeout")
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.network": staticEth0(),
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot apply network configuration: connectivity lost: timeout \(previous configuration restored\)`)
+	c.Check(s.configPath, testutil.FileAbsent)
+}
+
+func (s *netplanSuite) TestConfigureNetplanApplyFails(c *C) {
+	s.mockNetplan.Restore()
+	s.mockNetplan = testutil.MockCommand(c, "netplan", `
+if [ -e "$(dirname "$0")/applied" ]; then
+    exit 0
+fi
+touch "$(dirname "$0")/applied"
+echo "bad config"
+exit 1
+`)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.network": staticEth0(),
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot apply network configuration: bad config \(previous configuration restored\)`)
+	c.Check(s.configPath, testutil.FileAbsent)
+	c.Check(s.waitOnline, HasLen, 0)
+}
+
+func (s *netplanSuite) TestConfigureNetplanUnset(c *C) {
+	c.Assert(os.MkdirAll(filepath.Dir(s.configPath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.configPath, []byte(staticEth0Netplan), 0600), IsNil)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf:  map[string]interface{}{},
+		changes: map[string]interface{}{
+			"system.network": nil,
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.configPath, testutil.FileAbsent)
+	c.Check(s.mockNetplan.Calls(), DeepEquals, [][]string{{"netplan", "apply"}})
+	c.Check(s.waitOnline, HasLen, 0)
+}
+
+func (s *netplanSuite) TestFilesystemOnlyApply(c *C) {
+	// gadget defaults are flattened
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"system.network.ethernets.eth0.dhcp4":       false,
+		"system.network.ethernets.eth0.addresses":   []interface{}{"10.0.0.2/24"},
+		"system.network.ethernets.eth0.routes":      []interface{}{map[string]interface{}{"to": "default", "via": "10.0.0.1"}},
+		"system.network.ethernets.eth0.nameservers": map[string]interface{}{"addresses": []interface{}{"10.0.0.1"}},
+	})
+	tmpDir := c.MkDir()
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	c.Check(filepath.Join(tmpDir, "/etc/netplan/90-snapd-config.yaml"), testutil.FileEquals, staticEth0Netplan)
+	c.Check(s.mockNetplan.Calls(), HasLen, 0)
+	c.Check(s.waitOnline, HasLen, 0)
+}
@@ -44,6 +44,15 @@ func init() {
 	// resilience.vitality-hint
 	addWithStateHandler(validateVitalitySettings, handleVitalityConfiguration, nil)
 
+	// system.kernel.cmdline-append
+	addWithStateHandler(validateKernelCmdlineSettings, handleKernelCmdlineConfiguration, coreOnly)
+
+	// users.*
+	addWithStateHandler(validateUsersSettings, handleUsersConfiguration, coreOnly)
+
+	// api.tls.listen
+	addWithStateHandler(validateAPITLSSettings, handleAPITLSConfiguration, nil)
+
 	// XXX: this should become a FSOnlyHandler. We need to
 	// add/implement Changes() to the ConfGetter interface
 	// store-certs.*
@@ -53,6 +62,7 @@ func init() {
 	addWithStateHandler(validateRefreshSchedule, nil, validateOnly)
 	addWithStateHandler(validateRefreshRateLimit, nil, validateOnly)
 	addWithStateHandler(validateAutomaticSnapshotsExpiration, nil, validateOnly)
+	addWithStateHandler(validateChangesSettings, nil, validateOnly)
 }
 
 type withStateHandler struct {
@@ -109,6 +119,12 @@ func Run(cfg config.Conf) error {
 			if !validCertOption(k) {
 				return fmt.Errorf("cannot set store ssl certificate under name %q: name must only contain word characters or a dash", k)
 			}
+		case strings.HasPrefix(k, "core.system.network."):
+			// the network configuration is checked as a whole by
+			// validateNetplanSettings
+		case strings.HasPrefix(k, "core.users."):
+			// the users are checked as a whole by
+			// validateUsersSettings
 		case !supportedConfigurations[k]:
 			return fmt.Errorf("cannot set %q: unsupported system option", k)
 		}
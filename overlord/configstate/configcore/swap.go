@@ -0,0 +1,156 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/snapdenv"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+)
+
+const swapSizeOpt = "system.swap.size"
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core."+swapSizeOpt] = true
+}
+
+// swapFile is the swap file managed by snapd, it lives on the writable
+// partition.
+const swapFile = "/var/lib/snapd/swap/swapfile"
+
+// the kernel refuses to use swap files that are too small
+const minSwapSize = 1000 * 1000
+
+var osutilCheckFreeSpace = osutil.CheckFreeSpace
+
+// swapSize returns the configured size of the swap file, 0 means no swap.
+func swapSize(tr config.ConfGetter) (int64, error) {
+	value, err := coreCfg(tr, swapSizeOpt)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	size, err := strutil.ParseByteSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("cannot set %s: %v", swapSizeOpt, err)
+	}
+	if size < minSwapSize {
+		return 0, fmt.Errorf("cannot set %s: size must be 0 or at least 1MB", swapSizeOpt)
+	}
+	return size, nil
+}
+
+func validateSwapSettings(tr config.ConfGetter) error {
+	_, err := swapSize(tr)
+	return err
+}
+
+func createSwapFile(path string, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if output, err := exec.Command("fallocate", "-l", strconv.FormatInt(size, 10), path).CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	// swap files must not be readable by anyone else
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	if output, err := exec.Command("mkswap", path).CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	return nil
+}
+
+func handleSwapConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	size, err := swapSize(tr)
+	if err != nil {
+		return err
+	}
+
+	rootDir := dirs.GlobalRootDir
+	if opts != nil {
+		rootDir = opts.RootDir
+	}
+	path := filepath.Join(rootDir, swapFile)
+
+	var currentSize int64
+	st, err := os.Stat(path)
+	switch {
+	case err == nil:
+		currentSize = st.Size()
+	case !os.IsNotExist(err):
+		return err
+	}
+	if size == currentSize {
+		// nothing to do
+		return nil
+	}
+
+	if size > currentSize {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		// the current swap file is replaced so only the growth counts
+		if err := osutilCheckFreeSpace(filepath.Dir(path), uint64(size-currentSize)); err != nil {
+			return fmt.Errorf("cannot set %s: %v", swapSizeOpt, err)
+		}
+	}
+
+	var sysd systemd.Systemd
+	if opts != nil || snapdenv.Preseeding() {
+		// the swap unit is only enabled, it gets activated on boot
+		sysd = systemd.NewEmulationMode(rootDir)
+	} else {
+		sysd = systemd.New(dirs.GlobalRootDir, systemd.SystemMode, &sysdLogger{})
+	}
+
+	// swap needs to be turned off before the file is resized or removed
+	if err := sysd.RemoveSwapUnitFile(swapFile); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+
+	if err := createSwapFile(path, size); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("cannot create swap file: %v", err)
+	}
+	if _, err := sysd.AddSwapUnitFile(swapFile); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snapdenv"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type swapSuite struct {
+	configcoreSuite
+
+	mockFallocate *testutil.MockCmd
+	mockMkswap    *testutil.MockCmd
+	freeSpace     []uint64
+	freeSpaceErr  error
+	swapFile      string
+	swapUnit      string
+}
+
+var _ = Suite(&swapSuite{})
+
+func (s *swapSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.AddCleanup(release.MockOnClassic(false))
+	s.AddCleanup(systemd.MockStopDelays(time.Millisecond, 25*time.Second))
+
+	// fallocate -l <size> <file>
+	s.mockFallocate = testutil.MockCommand(c, "fallocate", `truncate -s "$2" "$3"`)
+	s.AddCleanup(s.mockFallocate.Restore)
+	s.mockMkswap = testutil.MockCommand(c, "mkswap", "")
+	s.AddCleanup(s.mockMkswap.Restore)
+
+	s.freeSpace = nil
+	s.freeSpaceErr = nil
+	s.AddCleanup(configcore.MockOsutilCheckFreeSpace(func(path string, minSize uint64) error {
+		c.Check(path, Equals, filepath.Dir(s.swapFile))
+		s.freeSpace = append(s.freeSpace, minSize)
+		return s.freeSpaceErr
+	}))
+
+	s.swapFile = filepath.Join(dirs.GlobalRootDir, "/var/lib/snapd/swap/swapfile")
+	s.swapUnit = filepath.Join(dirs.GlobalRootDir, "/etc/systemd/system/var-lib-snapd-swap-swapfile.swap")
+}
+
+func (s *swapSuite) mockSwapFile(c *C, size int64) {
+	c.Assert(os.MkdirAll(filepath.Dir(s.swapFile), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.swapFile, nil, 0600), IsNil)
+	c.Assert(os.Truncate(s.swapFile, size), IsNil)
+	c.Assert(os.MkdirAll(filepath.Dir(s.swapUnit), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.swapUnit, nil, 0644), IsNil)
+}
+
+func (s *swapSuite) checkSwapFile(c *C, size int64) {
+	st, err := os.Stat(s.swapFile)
+	c.Assert(err, IsNil)
+	c.Check(st.Size(), Equals, size)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+	c.Check(s.swapUnit, testutil.FileContains, "What=/var/lib/snapd/swap/swapfile\n")
+	c.Check(s.mockMkswap.Calls(), DeepEquals, [][]string{{"mkswap", s.swapFile}})
+}
+
+func (s *swapSuite) TestConfigureSwapInvalid(c *C) {
+	for _, tc := range []struct {
+		value string
+		err   string
+	}{
+		{"1", `cannot set system.swap.size: cannot parse "1": need a number with a unit as input`},
+		{"-1MB", `cannot set system.swap.size: cannot parse "-1MB": size cannot be negative`},
+		{"1XB", `cannot set system.swap.size: cannot parse "1XB": try 'kB' or 'MB'`},
+		{"100kB", `cannot set system.swap.size: size must be 0 or at least 1MB`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.swap.size": tc.value,
+			},
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf("%q", tc.value))
+	}
+	c.Check(s.mockFallocate.Calls(), HasLen, 0)
+	c.Check(s.swapFile, testutil.FileAbsent)
+}
+
+func (s *swapSuite) TestConfigureSwapCreate(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.swap.size": "2MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	s.checkSwapFile(c, 2000000)
+	c.Check(s.freeSpace, DeepEquals, []uint64{2000000})
+	c.Check(s.mockFallocate.Calls(), DeepEquals, [][]string{{"fallocate", "-l", "2000000", s.swapFile}})
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"--root", dirs.GlobalRootDir, "enable", "var-lib-snapd-swap-swapfile.swap"},
+		{"start", "var-lib-snapd-swap-swapfile.swap"},
+	})
+
+	// nothing happens when the size does not change
+	s.systemctlArgs = nil
+	s.mockFallocate.ForgetCalls()
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.swap.size": "2MB",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.mockFallocate.Calls(), HasLen, 0)
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
+
+func (s *swapSuite) TestConfigureSwapResize(c *C) {
+	s.mockSwapFile(c, 1000000)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.swap.size": "3MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	s.checkSwapFile(c, 3000000)
+	// only the growth needs to be available
+	c.Check(s.freeSpace, DeepEquals, []uint64{2000000})
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"stop", "var-lib-snapd-swap-swapfile.swap"},
+		{"show", "--property=ActiveState", "var-lib-snapd-swap-swapfile.swap"},
+		{"--root", dirs.GlobalRootDir, "disable", "var-lib-snapd-swap-swapfile.swap"},
+		{"daemon-reload"},
+		{"daemon-reload"},
+		{"--root", dirs.GlobalRootDir, "enable", "var-lib-snapd-swap-swapfile.swap"},
+		{"start", "var-lib-snapd-swap-swapfile.swap"},
+	})
+}
+
+func (s *swapSuite) TestConfigureSwapShrinkSkipsFreeSpaceCheck(c *C) {
+	s.mockSwapFile(c, 3000000)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.swap.size": "1MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	s.checkSwapFile(c, 1000000)
+	c.Check(s.freeSpace, HasLen, 0)
+}
+
+func (s *swapSuite) TestConfigureSwapNotEnoughSpace(c *C) {
+	s.freeSpaceErr = &osutil.NotEnoughDiskSpaceError{Path: filepath.Dir(s.swapFile), Delta: 1000}
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.swap.size": "2GB",
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot set system.swap.size: insufficient space in ".*", at least 1kB more is required`)
+	c.Check(s.freeSpace, DeepEquals, []uint64{2000000000})
+	c.Check(s.mockFallocate.Calls(), HasLen, 0)
+	c.Check(s.swapFile, testutil.FileAbsent)
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
+
+func (s *swapSuite) TestConfigureSwapRemove(c *C) {
+	s.mockSwapFile(c, 1000000)
+
+	for _, value := range []interface{}{"0", ""} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.swap.size": value,
+			},
+		})
+		c.Assert(err, IsNil)
+
+		c.Check(s.swapFile, testutil.FileAbsent)
+		c.Check(s.swapUnit, testutil.FileAbsent)
+	}
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"stop", "var-lib-snapd-swap-swapfile.swap"},
+		{"show", "--property=ActiveState", "var-lib-snapd-swap-swapfile.swap"},
+		{"--root", dirs.GlobalRootDir, "disable", "var-lib-snapd-swap-swapfile.swap"},
+		{"daemon-reload"},
+	})
+}
+
+func (s *swapSuite) TestConfigureSwapMkswapFails(c *C) {
+	s.mockMkswap.Restore()
+	s.mockMkswap = testutil.MockCommand(c, "mkswap", "echo bad swap; exit 1")
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.swap.size": "1MB",
+		},
+	})
+	c.Assert(err, ErrorMatches, "cannot create swap file: bad swap")
+	c.Check(s.swapFile, testutil.FileAbsent)
+	c.Check(s.swapUnit, testutil.FileAbsent)
+}
+
+func (s *swapSuite) TestConfigureSwapPreseeding(c *C) {
+	s.AddCleanup(snapdenv.MockPreseeding(true))
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.swap.size": "1MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	s.checkSwapFile(c, 1000000)
+	// the unit is enabled but not started
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "var-lib-snapd-swap-swapfile.swap"},
+	})
+}
+
+func (s *swapSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"system.swap.size": "1MB",
+	})
+	tmpDir := c.MkDir()
+	s.swapFile = filepath.Join(tmpDir, "/var/lib/snapd/swap/swapfile")
+	s.swapUnit = filepath.Join(tmpDir, "/etc/systemd/system/var-lib-snapd-swap-swapfile.swap")
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	s.checkSwapFile(c, 1000000)
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"--root", tmpDir, "enable", "var-lib-snapd-swap-swapfile.swap"},
+	})
+}
@@ -0,0 +1,106 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.timeserver.servers"] = true
+}
+
+const timesyncdConfFile = "20-snapd-timeserver.conf"
+
+// timeservers returns the NTP servers from the comma separated
+// system.timeserver.servers option.
+func timeservers(tr config.ConfGetter) ([]string, error) {
+	value, err := coreCfg(tr, "system.timeserver.servers")
+	if err != nil {
+		return nil, err
+	}
+	servers := strutil.CommaSeparatedList(value)
+	for _, server := range servers {
+		if net.ParseIP(server) == nil && !validHostname(server) {
+			return nil, fmt.Errorf("cannot set time servers: %q is not a valid host name or address", server)
+		}
+	}
+	return servers, nil
+}
+
+func validateTimeserverSettings(tr config.ConfGetter) error {
+	_, err := timeservers(tr)
+	return err
+}
+
+func handleTimeserverConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	servers, err := timeservers(tr)
+	if err != nil {
+		return err
+	}
+
+	var sysd systemd.Systemd
+
+	rootDir := dirs.GlobalRootDir
+	if opts != nil {
+		rootDir = opts.RootDir
+	} else {
+		sysd = systemd.New(dirs.GlobalRootDir, systemd.SystemMode, &sysdLogger{})
+	}
+	dir := filepath.Join(rootDir, "/etc/systemd/timesyncd.conf.d")
+
+	dirContent := make(map[string]osutil.FileState, 1)
+	if len(servers) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		content := fmt.Sprintf("[Time]\nNTP=%s\n", strings.Join(servers, " "))
+		dirContent[timesyncdConfFile] = &osutil.MemoryFileState{
+			Content: []byte(content),
+			Mode:    0644,
+		}
+	}
+
+	changed, removed, err := osutil.EnsureDirState(dir, timesyncdConfFile, dirContent)
+	if err != nil {
+		return err
+	}
+
+	// something was changed, restart timesyncd to pick up the servers
+	if sysd != nil && (len(changed) > 0 || len(removed) > 0) {
+		if err := sysd.Restart("systemd-timesyncd.service", 30*time.Second); err != nil {
+			return fmt.Errorf("cannot restart time synchronization service: %v", err)
+		}
+	}
+
+	return nil
+}
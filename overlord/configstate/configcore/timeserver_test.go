@@ -0,0 +1,118 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package configcore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type timeserverSuite struct {
+	configcoreSuite
+
+	confPath string
+}
+
+var _ = Suite(&timeserverSuite{})
+
+func (s *timeserverSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.AddCleanup(release.MockOnClassic(false))
+	s.AddCleanup(systemd.MockStopDelays(time.Millisecond, 25*time.Second))
+
+	s.confPath = filepath.Join(dirs.GlobalRootDir, "/etc/systemd/timesyncd.conf.d/20-snapd-timeserver.conf")
+}
+
+func (s *timeserverSuite) TestConfigureTimeserversInvalid(c *C) {
+	for _, servers := range []string{"no_underscore", "ntp.example.com,-bad", "1.2.3.4 5.6.7.8"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.timeserver.servers": servers,
+			},
+		})
+		c.Check(err, ErrorMatches, `cannot set time servers: ".*" is not a valid host name or address`, Commentf("%q", servers))
+	}
+	c.Check(s.confPath, testutil.FileAbsent)
+}
+
+func (s *timeserverSuite) TestConfigureTimeserversIntegration(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timeserver.servers": "ntp.example.com, 10.0.0.1,fe80::1",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.confPath, testutil.FileEquals, "[Time]\nNTP=ntp.example.com 10.0.0.1 fe80::1\n")
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"stop", "systemd-timesyncd.service"},
+		{"show", "--property=ActiveState", "systemd-timesyncd.service"},
+		{"start", "systemd-timesyncd.service"},
+	})
+
+	// nothing happens when the servers do not change
+	s.systemctlArgs = nil
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timeserver.servers": "ntp.example.com,10.0.0.1,fe80::1",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
+
+func (s *timeserverSuite) TestConfigureTimeserversUnset(c *C) {
+	c.Assert(os.MkdirAll(filepath.Dir(s.confPath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.confPath, []byte("[Time]\nNTP=10.0.0.1\n"), 0644), IsNil)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timeserver.servers": "",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.confPath, testutil.FileAbsent)
+	c.Check(s.systemctlArgs, HasLen, 3)
+}
+
+func (s *timeserverSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"system.timeserver.servers": "ntp.example.com",
+	})
+	tmpDir := c.MkDir()
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	c.Check(filepath.Join(tmpDir, "/etc/systemd/timesyncd.conf.d/20-snapd-timeserver.conf"), testutil.FileEquals, "[Time]\nNTP=ntp.example.com\n")
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
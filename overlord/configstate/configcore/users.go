@@ -0,0 +1,41 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package configcore
+
+import (
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/devicestate"
+)
+
+func init() {
+	// add supported configuration of this module, the options under
+	// users are checked by validateUsersSettings
+	supportedConfigurations["core.users"] = true
+}
+
+func validateUsersSettings(tr config.Conf) error {
+	_, err := devicestate.DeclarativeUsers(tr)
+	return err
+}
+
+// the users are reconciled by devicestate, make that happen right away
+func handleUsersConfiguration(tr config.Conf, opts *fsOnlyContext) error {
+	tr.State().EnsureBefore(0)
+	return nil
+}
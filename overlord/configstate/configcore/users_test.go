@@ -0,0 +1,90 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package configcore_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+)
+
+type ensureBackend struct {
+	ensureBefore []time.Duration
+}
+
+func (b *ensureBackend) Checkpoint([]byte) error { return nil }
+
+func (b *ensureBackend) EnsureBefore(d time.Duration) {
+	b.ensureBefore = append(b.ensureBefore, d)
+}
+
+func (b *ensureBackend) RequestRestart(t state.RestartType) {}
+
+type usersSuite struct {
+	configcoreSuite
+
+	backend *ensureBackend
+}
+
+var _ = Suite(&usersSuite{})
+
+func (s *usersSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+	s.AddCleanup(release.MockOnClassic(false))
+	c.Assert(os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "etc"), 0755), IsNil)
+
+	s.backend = &ensureBackend{}
+	s.state = state.New(s.backend)
+}
+
+func (s *usersSuite) TestConfigureUsersInvalid(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"users": map[string]interface{}{
+				"alice": map[string]interface{}{"expiry": "never"},
+			},
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot set users: invalid expiry "never" for user "alice": expected YYYY-MM-DD`)
+	c.Check(s.backend.ensureBefore, HasLen, 0)
+}
+
+func (s *usersSuite) TestConfigureUsersTriggersEnsure(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"users": map[string]interface{}{
+				"alice": map[string]interface{}{"sudoer": true},
+			},
+		},
+		changes: map[string]interface{}{
+			"users.alice.sudoer": true,
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.backend.ensureBefore, DeepEquals, []time.Duration{0})
+}
@@ -22,11 +22,15 @@
 package configstate
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/jsonutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
@@ -92,11 +96,79 @@ func ConfigureInstalled(st *state.State, snapName string, patch map[string]inter
 	if err := canConfigure(st, snapName); err != nil {
 		return nil, err
 	}
+	if err := validatePatch(st, snapName, patch); err != nil {
+		return nil, err
+	}
 
 	taskset := Configure(st, snapName, patch, flags)
 	return taskset, nil
 }
 
+// validatePatch checks early that the patch results in a configuration that
+// conforms to the schema of the snap, if it has one.
+func validatePatch(st *state.State, snapName string, patch map[string]interface{}) error {
+	if len(patch) == 0 {
+		return nil
+	}
+	schema, err := SnapConfigSchema(st, snapName)
+	if err != nil || schema == nil {
+		return err
+	}
+	tr := config.NewTransaction(st)
+	for _, key := range sortPatchKeysByDepth(patch) {
+		if err := tr.Set(snapName, key, patch[key]); err != nil {
+			return err
+		}
+	}
+	var value map[string]interface{}
+	if err := tr.Get(snapName, "", &value); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	return schema.Validate(value)
+}
+
+// RevertConfig returns a taskset that reapplies, through the configure hook,
+// the configuration of an installed snap recorded in its configuration
+// history with the given id.
+func RevertConfig(st *state.State, snapName string, id int) (*state.TaskSet, error) {
+	if err := canConfigure(st, snapName); err != nil {
+		return nil, err
+	}
+	entry, err := config.GetHistoryEntry(st, snapName, id)
+	if err != nil {
+		return nil, err
+	}
+	var current map[string]*json.RawMessage
+	if raw, err := config.GetSnapConfig(st, snapName); err != nil {
+		return nil, err
+	} else if raw != nil {
+		if err := json.Unmarshal(*raw, &current); err != nil {
+			return nil, fmt.Errorf("internal error: cannot unmarshal configuration: %v", err)
+		}
+	}
+
+	// top level options are replaced as a whole, the ones that were
+	// set since get unset
+	patch := make(map[string]interface{}, len(entry.Config)+len(current))
+	for key, raw := range entry.Config {
+		var value interface{}
+		if err := jsonutil.DecodeWithNumber(bytes.NewReader(*raw), &value); err != nil {
+			return nil, fmt.Errorf("internal error: cannot unmarshal configuration: %v", err)
+		}
+		patch[key] = value
+	}
+	for key := range current {
+		if _, ok := entry.Config[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	if err := validatePatch(st, snapName, patch); err != nil {
+		return nil, err
+	}
+
+	return Configure(st, snapName, patch, 0), nil
+}
+
 // Configure returns a taskset to apply the given configuration patch.
 func Configure(st *state.State, snapName string, patch map[string]interface{}, flags int) *state.TaskSet {
 	summary := fmt.Sprintf(i18n.G("Run configure hook of %q snap"), snapName)
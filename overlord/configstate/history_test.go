@@ -0,0 +1,142 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configstate_test
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+type historySuite struct {
+	state *state.State
+}
+
+var _ = Suite(&historySuite{})
+
+func (s *historySuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.state = state.New(nil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{
+			{RealName: "test-snap", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		Active:   true,
+		SnapType: "app",
+	})
+}
+
+func (s *historySuite) TearDownTest(c *C) {
+	dirs.SetRootDir("/")
+}
+
+func (s *historySuite) commit(c *C, values map[string]interface{}) {
+	tr := config.NewTransaction(s.state)
+	for k, v := range values {
+		c.Assert(tr.Set("test-snap", k, v), IsNil)
+	}
+	tr.Commit()
+}
+
+func (s *historySuite) TestRevertConfig(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.commit(c, map[string]interface{}{"foo": "a", "bar.baz": 1})
+	s.commit(c, map[string]interface{}{"foo": "b", "bar.qux": 2, "new": true})
+
+	ts, err := configstate.RevertConfig(s.state, "test-snap", 1)
+	c.Assert(err, IsNil)
+	tasks := ts.Tasks()
+	c.Assert(tasks, HasLen, 1)
+	c.Check(tasks[0].Kind(), Equals, "run-hook")
+	c.Check(tasks[0].Summary(), Equals, `Run configure hook of "test-snap" snap`)
+
+	var contextData struct {
+		Patch map[string]interface{} `json:"patch"`
+	}
+	c.Assert(tasks[0].Get("hook-context", &contextData), IsNil)
+	c.Check(contextData.Patch, DeepEquals, map[string]interface{}{
+		"foo": "a",
+		"bar": map[string]interface{}{"baz": 1.0},
+		"new": nil,
+	})
+}
+
+func (s *historySuite) TestRevertConfigNoEntry(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.commit(c, map[string]interface{}{"foo": "a"})
+
+	_, err := configstate.RevertConfig(s.state, "test-snap", 3)
+	c.Check(err, ErrorMatches, `snap "test-snap" has no configuration history entry 3`)
+	c.Check(err, FitsTypeOf, &config.NoHistoryEntryError{})
+}
+
+func (s *historySuite) TestRevertConfigNotInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := configstate.RevertConfig(s.state, "other-snap", 1)
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+}
+
+func (s *historySuite) TestContextTransactionRecordsOrigin(c *C) {
+	s.state.Lock()
+	chg := s.state.NewChange("configure-snap", "...")
+	chg.Set("author-uid", 1000)
+	task := s.state.NewTask("run-hook", "...")
+	chg.AddTask(task)
+	s.state.Unlock()
+
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "configure"}
+	context, err := hookstate.NewContext(task, s.state, setup, hooktest.NewMockHandler(), "")
+	c.Assert(err, IsNil)
+
+	context.Lock()
+	defer context.Unlock()
+	tr := configstate.ContextTransaction(context)
+	c.Assert(tr.Set("test-snap", "foo", "bar"), IsNil)
+	c.Assert(context.Done(), IsNil)
+
+	entries, err := config.History(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Check(entries[0].ChangeID, Equals, chg.ID())
+	c.Assert(entries[0].UID, NotNil)
+	c.Check(*entries[0].UID, Equals, uint32(1000))
+	data, err := json.Marshal(entries[0].Config)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"foo":"bar"}`)
+}
@@ -48,9 +48,19 @@ func ContextTransaction(context *hookstate.Context) *config.Transaction {
 
 	// It wasn't already cached, so create and cache a new one
 	tr = config.NewTransaction(context.State())
+	if task, ok := context.Task(); ok && task.Change() != nil {
+		chg := task.Change()
+		tr.SetChangeID(chg.ID())
+		var uid uint32
+		if err := chg.Get("author-uid", &uid); err == nil {
+			tr.SetAuthor(uid)
+		}
+	}
 
 	context.OnDone(func() error {
-		tr.Commit()
+		if err := tr.Commit(); err != nil {
+			return err
+		}
 		if context.InstanceName() == "core" {
 			// make sure the Ensure logic can process
 			// system configuration changes as soon as possible
@@ -121,7 +131,9 @@ func (h *configureHandler) Before() error {
 		}
 	}
 
-	return nil
+	// reject values, including gadget defaults, that do not conform to
+	// the schema of the snap before the hook gets to see them
+	return ValidateSnapConfig(tr, instanceName)
 }
 
 // Done is called by the HookManager after the configure hook has exited
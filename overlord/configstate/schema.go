@@ -0,0 +1,78 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package configstate
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// SnapConfigSchema returns the configuration schema shipped by the snap in
+// meta/config-schema.json, it is nil if the snap does not have one.
+//
+// The state must be locked by the caller.
+func SnapConfigSchema(st *state.State, snapName string) (*config.Schema, error) {
+	// the core configuration is validated by configcore
+	if snapName == "core" {
+		return nil, nil
+	}
+	info, err := snapstate.CurrentInfo(st, snapName)
+	if _, ok := err.(*snap.NotInstalledError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	schema, err := config.ReadSchema(filepath.Join(info.MountDir(), "meta", "config-schema.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// ValidateSnapConfig checks the configuration of the snap, as seen by the
+// transaction, against the schema of the snap. A *config.ValidationError
+// is returned if the configuration does not conform to it. The options
+// the schema describes as secret are marked as such in the transaction.
+//
+// The state must be locked by the caller.
+func ValidateSnapConfig(tr *config.Transaction, snapName string) error {
+	schema, err := SnapConfigSchema(tr.State(), snapName)
+	if err != nil || schema == nil {
+		return err
+	}
+	for _, key := range schema.SecretOptions() {
+		if err := tr.MarkSecret(snapName, key); err != nil {
+			return err
+		}
+	}
+	var value map[string]interface{}
+	if err := tr.Get(snapName, "", &value); err != nil && !config.IsNoOption(err) {
+		return err
+	}
+	return schema.Validate(value)
+}
@@ -0,0 +1,167 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package configstate_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type schemaSuite struct {
+	state *state.State
+}
+
+var _ = Suite(&schemaSuite{})
+
+const schemaSnapYaml = `name: test-snap
+version: 1
+hooks:
+    configure:
+`
+
+func (s *schemaSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.state = state.New(nil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{RealName: "test-snap", Revision: snap.R(1)}
+	info := snaptest.MockSnap(c, schemaSnapYaml, si)
+	schema := `{
+	"additionalProperties": false,
+	"properties": {
+		"port": {"type": "integer", "minimum": 1},
+		"name": {"type": "string"},
+		"token": {"type": "string", "secret": true}
+	}
+}`
+	c.Assert(ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "config-schema.json"), []byte(schema), 0644), IsNil)
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si},
+		Current:  snap.R(1),
+		Active:   true,
+		SnapType: "app",
+	})
+}
+
+func (s *schemaSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("/")
+}
+
+func (s *schemaSuite) TestSnapConfigSchema(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	schema, err := configstate.SnapConfigSchema(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Assert(schema, NotNil)
+	c.Check(schema.Lookup("port").Type, Equals, "integer")
+
+	// no schema for snaps that are not installed, or for core
+	schema, err = configstate.SnapConfigSchema(s.state, "other-snap")
+	c.Assert(err, IsNil)
+	c.Check(schema, IsNil)
+	schema, err = configstate.SnapConfigSchema(s.state, "core")
+	c.Assert(err, IsNil)
+	c.Check(schema, IsNil)
+}
+
+func (s *schemaSuite) TestConfigureInstalledValidatesPatch(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := configstate.ConfigureInstalled(s.state, "test-snap", map[string]interface{}{"prot": 80}, 0)
+	c.Assert(err, ErrorMatches, `invalid configuration for "prot": unknown option`)
+	c.Check(err, FitsTypeOf, &config.ValidationError{})
+
+	_, err = configstate.ConfigureInstalled(s.state, "test-snap", map[string]interface{}{"port": 0}, 0)
+	c.Assert(err, ErrorMatches, `invalid configuration for "port": must be at least 1`)
+
+	ts, err := configstate.ConfigureInstalled(s.state, "test-snap", map[string]interface{}{"port": 80}, 0)
+	c.Assert(err, IsNil)
+	c.Check(ts.Tasks(), HasLen, 1)
+
+	// nothing was stored
+	var port int
+	err = config.NewTransaction(s.state).Get("test-snap", "port", &port)
+	c.Check(config.IsNoOption(err), Equals, true)
+}
+
+func (s *schemaSuite) TestConfigureHandlerBeforeValidates(c *C) {
+	s.state.Lock()
+	task := s.state.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "configure"}
+	context, err := hookstate.NewContext(task, s.state, setup, hooktest.NewMockHandler(), "")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+
+	context.Lock()
+	context.Set("patch", map[string]interface{}{
+		"name": 42,
+	})
+	context.Unlock()
+
+	handler := configstate.NewConfigureHandler(context)
+	c.Check(handler.Before(), ErrorMatches, `invalid configuration for "name": expected string`)
+}
+
+func (s *schemaSuite) TestConfigureHandlerMarksSecrets(c *C) {
+	s.state.Lock()
+	task := s.state.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "configure"}
+	context, err := hookstate.NewContext(task, s.state, setup, hooktest.NewMockHandler(), "")
+	s.state.Unlock()
+	c.Assert(err, IsNil)
+
+	context.Lock()
+	context.Set("patch", map[string]interface{}{
+		"name":  "foo",
+		"token": "s3cr3t",
+	})
+	context.Unlock()
+
+	handler := configstate.NewConfigureHandler(context)
+	c.Assert(handler.Before(), IsNil)
+
+	context.Lock()
+	defer context.Unlock()
+	tr := configstate.ContextTransaction(context)
+	c.Check(tr.IsSecret("test-snap", "token"), Equals, true)
+	c.Assert(context.Done(), IsNil)
+
+	raw, err := config.GetSnapConfig(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*raw), Equals, `{"name":"foo"}`)
+	secrets, err := config.SnapSecrets(s.state, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*secrets["token"]), Equals, `"s3cr3t"`)
+}
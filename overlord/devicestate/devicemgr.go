@@ -71,10 +71,14 @@ type DeviceManager struct {
 
 	ensureInstalledRan bool
 
+	ensureDeviceIdentitySavedRan bool
+
 	cloudInitAlreadyRestricted           bool
 	cloudInitErrorAttemptStart           *time.Time
 	cloudInitEnabledInactiveAttemptStart *time.Time
 
+	declarativeUsers declarativeUsersState
+
 	lastBecomeOperationalAttempt time.Time
 	becomeOperationalBackoff     time.Duration
 	registered                   bool
@@ -123,6 +127,7 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, runner *state.T
 	runner.AddHandler("mark-preseeded", m.doMarkPreseeded, nil)
 	runner.AddHandler("mark-seeded", m.doMarkSeeded, nil)
 	runner.AddHandler("setup-run-system", m.doSetupRunSystem, nil)
+	runner.AddHandler("factory-reset-run-system", m.doSetupRunSystem, nil)
 	runner.AddHandler("prepare-remodeling", m.doPrepareRemodeling, nil)
 	runner.AddCleanup("prepare-remodeling", m.cleanupRemodel)
 	// this *must* always run last and finalizes a remodel
@@ -307,6 +312,16 @@ func (m *DeviceManager) ensureOperational() error {
 
 	if device.Serial != "" {
 		// serial is set, we are all set
+		m.ensureDeviceIdentitySaved(device)
+		return nil
+	}
+
+	// after a factory reset the device keeps the identity it had before
+	restored, err := m.restoreDeviceIdentity(device)
+	if err != nil {
+		return err
+	}
+	if restored {
 		return nil
 	}
 
@@ -742,7 +757,15 @@ func (m *DeviceManager) ensureInstalled() error {
 		return nil
 	}
 
-	if m.SystemMode() != "install" {
+	var kind, taskKind, summary, taskSummary string
+	switch m.SystemMode() {
+	case "install":
+		kind, summary = "install-system", i18n.G("Install the system")
+		taskKind, taskSummary = "setup-run-system", i18n.G("Setup system for run mode")
+	case "factory-reset":
+		kind, summary = "factory-reset", i18n.G("Perform a factory reset of the system")
+		taskKind, taskSummary = "factory-reset-run-system", i18n.G("Recreate the system for run mode")
+	default:
 		return nil
 	}
 
@@ -755,17 +778,17 @@ func (m *DeviceManager) ensureInstalled() error {
 		return nil
 	}
 
-	if m.changeInFlight("install-system") {
+	if m.changeInFlight(kind) {
 		return nil
 	}
 
 	m.ensureInstalledRan = true
 
 	tasks := []*state.Task{}
-	setupRunSystem := m.state.NewTask("setup-run-system", i18n.G("Setup system for run mode"))
+	setupRunSystem := m.state.NewTask(taskKind, taskSummary)
 	tasks = append(tasks, setupRunSystem)
 
-	chg := m.state.NewChange("install-system", i18n.G("Install the system"))
+	chg := m.state.NewChange(kind, summary)
 	chg.AddAll(state.NewTaskSet(tasks...))
 
 	return nil
@@ -815,7 +838,9 @@ func markSeededInConfig(st *state.State) error {
 		if err := tr.Set("core", "seed.loaded", true); err != nil {
 			return err
 		}
-		tr.Commit()
+		if err := tr.Commit(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -899,6 +924,10 @@ func (m *DeviceManager) Ensure() error {
 		if err := m.ensureInstalled(); err != nil {
 			errs = append(errs, err)
 		}
+
+		if err := m.ensureDeclarativeUsers(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	if len(errs) > 0 {
@@ -975,10 +1004,12 @@ var defaultSystemActions = []SystemAction{
 var currentSystemActions = []SystemAction{
 	{Title: "Reinstall", Mode: "install"},
 	{Title: "Recover", Mode: "recover"},
+	{Title: "Factory reset", Mode: "factory-reset"},
 	{Title: "Run normally", Mode: "run"},
 }
 var recoverSystemActions = []SystemAction{
 	{Title: "Reinstall", Mode: "install"},
+	{Title: "Factory reset", Mode: "factory-reset"},
 	{Title: "Run normally", Mode: "run"},
 }
 
@@ -1131,8 +1162,9 @@ func (m *DeviceManager) switchToSystemAndMode(systemLabel, mode string, sameSyst
 			sameSystemAndMode()
 			return nil
 		}
-	case "install":
-		// requesting system actions in install mode does not make sense atm
+	case "install", "factory-reset":
+		// requesting system actions in install or factory-reset mode does
+		// not make sense atm
 		//
 		// TODO:UC20: maybe factory hooks will be able to something like
 		// this?
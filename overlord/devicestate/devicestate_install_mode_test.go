@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	. "gopkg.in/check.v1"
 
@@ -39,6 +40,7 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/secboot"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/sysconfig"
@@ -592,3 +594,186 @@ func (s *deviceMgrInstallModeSuite) TestInstallModeWritesModel(c *C) {
 
 	c.Check(filepath.Join(boot.InitramfsUbuntuBootDir, "model"), testutil.FileEquals, buf.String())
 }
+
+func (s *deviceMgrInstallModeSuite) findFactoryReset() *state.Change {
+	for _, chg := range s.state.Changes() {
+		if chg.Kind() == "factory-reset" {
+			return chg
+		}
+	}
+	return nil
+}
+
+// mockFactoryResetChange runs a factory reset, with the device identity
+// stored under identityDir if it is set.
+func (s *deviceMgrInstallModeSuite) mockFactoryResetChange(c *C, identityDir string) (ops []string, opts install.Options) {
+	return s.mockFactoryResetChangeWithHostData(c, identityDir, true)
+}
+
+// mockFactoryResetChangeWithHostData runs a factory reset, with the
+// ubuntu-data of the installed system mounted by snap-bootstrap if
+// hostDataMounted is set.
+func (s *deviceMgrInstallModeSuite) mockFactoryResetChangeWithHostData(c *C, identityDir string, hostDataMounted bool) (ops []string, opts install.Options) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	restore = devicestate.MockInstallRun(func(gadgetRoot, device string, options install.Options, _ install.SystemInstallObserver) error {
+		ops = append(ops, "install")
+		opts = options
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockUnmountHostUbuntuData(func() error {
+		ops = append(ops, "unmount")
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockBootMakeBootable(func(model *asserts.Model, rootdir string, bootWith *boot.BootableSet, seal *boot.TrustedAssetsInstallObserver) error {
+		ops = append(ops, "make-bootable")
+		return nil
+	})
+	defer restore()
+
+	func() {
+		s.state.Lock()
+		defer s.state.Unlock()
+		s.makeMockInstalledPcGadget(c, "dangerous", "")
+	}()
+
+	if hostDataMounted {
+		c.Assert(os.MkdirAll(filepath.Join(boot.InitramfsHostUbuntuDataDir, "system-data"), 0755), IsNil)
+	}
+	if identityDir != "" {
+		encDevKey, err := asserts.EncodePublicKey(devKey.PublicKey())
+		c.Assert(err, IsNil)
+		serial, err := s.brands.Signing("my-brand").Sign(asserts.SerialType, map[string]interface{}{
+			"brand-id":            "my-brand",
+			"model":               "my-model",
+			"serial":              "serial-1234",
+			"device-key":          string(encDevKey),
+			"device-key-sha3-384": devKey.PublicKey().ID(),
+			"timestamp":           time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, IsNil)
+		assertsDir, keysDir := identityDir, identityDir
+		if identityDir != boot.InstallHostDeviceSaveDir {
+			assertsDir = dirs.SnapAssertsDBDirUnder(identityDir)
+			keysDir = dirs.SnapDeviceDirUnder(identityDir)
+		}
+		bs, err := asserts.OpenFSBackstore(assertsDir)
+		c.Assert(err, IsNil)
+		c.Assert(bs.Put(asserts.SerialType, serial), IsNil)
+		c.Assert(bs.Put(asserts.AccountKeyType, s.brands.AccountKey("my-brand")), IsNil)
+		keypairMgr, err := asserts.OpenFSKeypairManager(keysDir)
+		c.Assert(err, IsNil)
+		c.Assert(keypairMgr.Put(devKey), IsNil)
+	}
+
+	modeenv := boot.Modeenv{
+		Mode:           "factory-reset",
+		RecoverySystem: "20191218",
+	}
+	c.Assert(modeenv.WriteTo(""), IsNil)
+	devicestate.SetSystemMode(s.mgr, "factory-reset")
+
+	// normally done by snap-bootstrap
+	err := os.MkdirAll(boot.InitramfsUbuntuBootDir, 0755)
+	c.Assert(err, IsNil)
+
+	s.settle(c)
+
+	return ops, opts
+}
+
+func (s *deviceMgrInstallModeSuite) checkFactoryResetKeptDeviceIdentity(c *C) {
+	keypairMgr, err := asserts.OpenFSKeypairManager(dirs.SnapDeviceDirUnder(boot.InstallHostWritableDir))
+	c.Assert(err, IsNil)
+	_, err = keypairMgr.Get(devKey.PublicKey().ID())
+	c.Check(err, IsNil)
+	bs, err := asserts.OpenFSBackstore(dirs.SnapAssertsDBDirUnder(boot.InstallHostWritableDir))
+	c.Assert(err, IsNil)
+	_, err = bs.Get(asserts.SerialType, []string{"my-brand", "my-model", "serial-1234"}, asserts.SerialType.MaxSupportedFormat())
+	c.Check(err, IsNil)
+	_, err = bs.Get(asserts.AccountKeyType, []string{s.brands.AccountKey("my-brand").PublicKeyID()}, asserts.AccountKeyType.MaxSupportedFormat())
+	c.Check(err, IsNil)
+	c.Check(filepath.Join(dirs.SnapDeviceDirUnder(boot.InstallHostWritableDir), "factory-reset"), testutil.FileEquals,
+		fmt.Sprintf(`{"brand-id":"my-brand","model":"my-model","serial":"serial-1234","key-id":%q}`, devKey.PublicKey().ID()))
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetKeepsDeviceIdentity(c *C) {
+	// the identity of the device as found in the ubuntu-data mounted by
+	// snap-bootstrap
+	ops, opts := s.mockFactoryResetChange(c, filepath.Join(boot.InitramfsHostUbuntuDataDir, "system-data"))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(s.findInstallSystem(), IsNil)
+	factoryReset := s.findFactoryReset()
+	c.Assert(factoryReset, NotNil)
+	c.Check(factoryReset.Err(), IsNil)
+	c.Check(factoryReset.Status(), Equals, state.DoneStatus)
+	c.Check(ops, DeepEquals, []string{"unmount", "install", "make-bootable"})
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystemNow})
+	c.Check(opts.KeepSave, Equals, true)
+	c.Check(opts.SaveKey, IsNil)
+	c.Check(opts.RecoveryKey, IsNil)
+
+	// the identity was written to the new ubuntu-data
+	s.checkFactoryResetKeptDeviceIdentity(c)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetKeepsDeviceIdentityFromSave(c *C) {
+	// the keys of the kept ubuntu-save are in the old ubuntu-data
+	fdeDir := dirs.SnapFDEDirUnder(filepath.Join(boot.InitramfsHostUbuntuDataDir, "system-data"))
+	saveKey := secboot.EncryptionKey{1, 2, 3, 4}
+	c.Assert(saveKey.Save(filepath.Join(fdeDir, "ubuntu-save.key")), IsNil)
+	rkey := secboot.RecoveryKey{5, 6, 7, 8}
+	c.Assert(rkey.Save(filepath.Join(fdeDir, "recovery.key")), IsNil)
+
+	ops, opts := s.mockFactoryResetChange(c, boot.InstallHostDeviceSaveDir)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	factoryReset := s.findFactoryReset()
+	c.Assert(factoryReset, NotNil)
+	c.Check(factoryReset.Err(), IsNil)
+	c.Check(ops, DeepEquals, []string{"unmount", "install", "make-bootable"})
+	c.Check(opts.KeepSave, Equals, true)
+	c.Assert(opts.SaveKey, NotNil)
+	c.Check(*opts.SaveKey, DeepEquals, saveKey)
+	c.Assert(opts.RecoveryKey, NotNil)
+	c.Check(*opts.RecoveryKey, DeepEquals, rkey)
+
+	// the identity kept on ubuntu-save was written to the new ubuntu-data
+	s.checkFactoryResetKeptDeviceIdentity(c)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetNotRegistered(c *C) {
+	ops, _ := s.mockFactoryResetChange(c, "")
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	factoryReset := s.findFactoryReset()
+	c.Assert(factoryReset, NotNil)
+	c.Check(factoryReset.Err(), IsNil)
+	c.Check(ops, DeepEquals, []string{"unmount", "install", "make-bootable"})
+	c.Check(filepath.Join(dirs.SnapDeviceDirUnder(boot.InstallHostWritableDir), "factory-reset"), testutil.FileAbsent)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetHostDataNotMounted(c *C) {
+	// snap-bootstrap could not unlock or mount the ubuntu-data of the
+	// installed system
+	ops, _ := s.mockFactoryResetChangeWithHostData(c, "", false)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	factoryReset := s.findFactoryReset()
+	c.Assert(factoryReset, NotNil)
+	c.Check(factoryReset.Err(), ErrorMatches, `(?s).*cannot factory reset: ubuntu-data of the installed system is not mounted at .*/run/mnt/host/ubuntu-data\).*`)
+	c.Check(ops, HasLen, 0)
+	c.Check(s.restartRequests, HasLen, 0)
+}
@@ -21,11 +21,13 @@ package devicestate_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -34,6 +36,7 @@ import (
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/assertstate"
@@ -49,6 +52,7 @@ import (
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/testutil"
 )
 
 var testKeyLength = 1024
@@ -191,6 +195,92 @@ func (s *deviceMgrSerialSuite) TestFullDeviceRegistrationHappy(c *C) {
 	c.Check(device.KeyID, Equals, privKey.PublicKey().ID())
 }
 
+func (s *deviceMgrSerialSuite) TestFullDeviceRegistrationKeepsIdentityOnSave(c *C) {
+	r1 := devicestate.MockKeyLength(testKeyLength)
+	defer r1()
+
+	mockServer := s.mockServer(c, "REQID-1", nil)
+	defer mockServer.Close()
+
+	r2 := devicestate.MockBaseStoreURL(mockServer.URL)
+	defer r2()
+
+	// the device has ubuntu-save
+	c.Assert(os.MkdirAll(dirs.SnapSaveDir, 0755), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.makeModelAssertionInState(c, "canonical", "pc", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+	devicestatetest.MockGadget(c, s.state, "pc", snap.R(2), nil)
+	s.state.Set("seeded", true)
+
+	s.state.Unlock()
+	s.settle(c)
+	s.state.Lock()
+
+	device, err := devicestatetest.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device.Serial, Equals, "9999")
+
+	// the identity is also on ubuntu-save
+	keypairMgr, err := asserts.OpenFSKeypairManager(dirs.SnapDeviceSaveDir)
+	c.Assert(err, IsNil)
+	_, err = keypairMgr.Get(device.KeyID)
+	c.Check(err, IsNil)
+	bs, err := asserts.OpenFSBackstore(dirs.SnapDeviceSaveDir)
+	c.Assert(err, IsNil)
+	_, err = bs.Get(asserts.SerialType, []string{"canonical", "pc", "9999"}, asserts.SerialType.MaxSupportedFormat())
+	c.Check(err, IsNil)
+}
+
+func (s *deviceMgrSerialSuite) TestEnsureOperationalKeepsExistingIdentityOnSave(c *C) {
+	c.Assert(os.MkdirAll(dirs.SnapSaveDir, 0755), IsNil)
+
+	s.state.Lock()
+	model := s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	encDevKey, err := asserts.EncodePublicKey(devKey.PublicKey())
+	c.Assert(err, IsNil)
+	serial, err := s.brands.Signing("my-brand").Sign(asserts.SerialType, map[string]interface{}{
+		"brand-id":            "my-brand",
+		"model":               "my-model",
+		"serial":              "serial-1234",
+		"device-key":          string(encDevKey),
+		"device-key-sha3-384": devKey.PublicKey().ID(),
+		"timestamp":           time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	assertstatetest.AddMany(s.state, serial)
+	devicestate.KeypairManager(s.mgr).Put(devKey)
+	// registered before ubuntu-save was used
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand:  "my-brand",
+		Model:  "my-model",
+		Serial: "serial-1234",
+		KeyID:  devKey.PublicKey().ID(),
+	})
+	s.state.Unlock()
+
+	err = devicestate.EnsureOperational(s.mgr)
+	c.Assert(err, IsNil)
+
+	serialNum, err := devicestate.ReadDeviceIdentitySerial(dirs.SnapDeviceSaveDir, dirs.SnapDeviceSaveDir, model)
+	c.Assert(err, IsNil)
+	c.Check(serialNum, Equals, "serial-1234")
+}
+
 func (s *deviceMgrSerialSuite) TestFullDeviceRegistrationHappyWithProxy(c *C) {
 	r1 := devicestate.MockKeyLength(testKeyLength)
 	defer r1()
@@ -1867,3 +1957,97 @@ func (s *deviceMgrSerialSuite) TestDeviceRegistrationNotInInstallMode(c *C) {
 	becomeOperational := s.findBecomeOperationalChange()
 	c.Assert(becomeOperational, IsNil)
 }
+
+func (s *deviceMgrSerialSuite) mockFactoryResetIdentity(c *C, model string) {
+	encDevKey, err := asserts.EncodePublicKey(devKey.PublicKey())
+	c.Assert(err, IsNil)
+	serial, err := s.brands.Signing("my-brand").Sign(asserts.SerialType, map[string]interface{}{
+		"brand-id":            "my-brand",
+		"model":               model,
+		"serial":              "serial-1234",
+		"device-key":          string(encDevKey),
+		"device-key-sha3-384": devKey.PublicKey().ID(),
+		"timestamp":           time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	assertstatetest.AddMany(s.state, serial)
+
+	marker := fmt.Sprintf(`{"brand-id":"my-brand","model":%q,"serial":"serial-1234","key-id":%q}`, model, devKey.PublicKey().ID())
+	err = os.MkdirAll(dirs.SnapDeviceDir, 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(filepath.Join(dirs.SnapDeviceDir, "factory-reset"), []byte(marker), 0600)
+	c.Assert(err, IsNil)
+}
+
+func (s *deviceMgrSerialSuite) TestDeviceRegistrationRestoresFactoryResetIdentity(c *C) {
+	st := s.state
+	st.Lock()
+	s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand: "my-brand",
+		Model: "my-model",
+	})
+	devicestatetest.MockGadget(c, s.state, "pc", snap.R(2), nil)
+	st.Set("seeded", true)
+	s.mockFactoryResetIdentity(c, "my-model")
+	devicestate.KeypairManager(s.mgr).Put(devKey)
+	st.Unlock()
+
+	s.settle(c)
+
+	st.Lock()
+	defer st.Unlock()
+
+	// no registration, the identity from before the reset is used
+	c.Check(s.findBecomeOperationalChange(), IsNil)
+	device, err := devicestatetest.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device, DeepEquals, &auth.DeviceState{
+		Brand:  "my-brand",
+		Model:  "my-model",
+		Serial: "serial-1234",
+		KeyID:  devKey.PublicKey().ID(),
+	})
+	select {
+	case <-s.mgr.Registered():
+	default:
+		c.Fatal("should have been marked registered")
+	}
+	c.Check(filepath.Join(dirs.SnapDeviceDir, "factory-reset"), testutil.FileAbsent)
+}
+
+func (s *deviceMgrSerialSuite) TestDeviceRegistrationFactoryResetIdentityMissingKey(c *C) {
+	st := s.state
+	st.Lock()
+	s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"kernel":       "pc-kernel",
+		"gadget":       "pc",
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand: "my-brand",
+		Model: "my-model",
+	})
+	devicestatetest.MockGadget(c, s.state, "pc", snap.R(2), nil)
+	st.Set("seeded", true)
+	s.mockFactoryResetIdentity(c, "my-model")
+	// but the device key is not there
+	st.Unlock()
+
+	err := devicestate.EnsureOperational(s.mgr)
+	c.Assert(err, IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+
+	// the identity is dropped and the device registers again
+	device, err := devicestatetest.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device.Serial, Equals, "")
+	c.Check(s.findBecomeOperationalChange(), NotNil)
+	c.Check(filepath.Join(dirs.SnapDeviceDir, "factory-reset"), testutil.FileAbsent)
+}
@@ -0,0 +1,370 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package devicestate_test
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/release"
+)
+
+type declarativeUsersSuite struct {
+	deviceMgrBaseSuite
+
+	now    time.Time
+	calls  []string
+	addErr error
+	// system are the users managed by snapd as they are on the system
+	system map[string]*devicestate.DeclarativeUser
+}
+
+var _ = Suite(&declarativeUsersSuite{})
+
+func (s *declarativeUsersSuite) SetUpTest(c *C) {
+	s.deviceMgrBaseSuite.SetUpTest(c)
+
+	s.state.Lock()
+	s.state.Set("seeded", true)
+	s.state.Unlock()
+
+	s.now = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.AddCleanup(devicestate.MockDeclarativeUsersTimeNow(func() time.Time { return s.now }))
+
+	s.calls = nil
+	s.addErr = nil
+	s.system = make(map[string]*devicestate.DeclarativeUser)
+	s.AddCleanup(devicestate.MockOsutilAddUser(func(name string, opts *osutil.AddUserOptions) error {
+		c.Check(opts.ExtraUsers, Equals, true)
+		c.Check(opts.Gecos, Equals, "managed by snapd")
+		s.calls = append(s.calls, "add:"+name)
+		if s.addErr != nil {
+			return s.addErr
+		}
+		if opts.Sudoer {
+			s.calls = append(s.calls, "sudoer:"+name)
+		}
+		for _, key := range opts.SSHKeys {
+			s.calls = append(s.calls, "key:"+name+":"+key)
+		}
+		s.system[name] = &devicestate.DeclarativeUser{SSHKeys: opts.SSHKeys, Sudoer: opts.Sudoer}
+		return nil
+	}))
+	s.AddCleanup(devicestate.MockOsutilDelUser(func(name string, opts *osutil.DelUserOptions) error {
+		c.Check(opts.ExtraUsers, Equals, true)
+		s.calls = append(s.calls, "del:"+name)
+		delete(s.system, name)
+		return nil
+	}))
+	s.AddCleanup(devicestate.MockOsutilSetUserSSHKeys(func(name string, sshKeys []string) error {
+		s.calls = append(s.calls, "set-keys:"+name)
+		s.system[name].SSHKeys = sshKeys
+		return nil
+	}))
+	s.AddCleanup(devicestate.MockOsutilSetUserSudoer(func(name string, sudoer bool) error {
+		if sudoer {
+			s.calls = append(s.calls, "sudoer:"+name)
+		} else {
+			s.calls = append(s.calls, "no-sudoer:"+name)
+		}
+		s.system[name].Sudoer = sudoer
+		return nil
+	}))
+	s.AddCleanup(devicestate.MockOsutilSetUserExpiry(func(name string, expiry time.Time) error {
+		if expiry.IsZero() {
+			s.calls = append(s.calls, "expiry:"+name+":never")
+			s.system[name].Expiry = ""
+		} else {
+			s.calls = append(s.calls, "expiry:"+name+":"+expiry.Format("2006-01-02"))
+			s.system[name].Expiry = expiry.Format("2006-01-02")
+		}
+		return nil
+	}))
+
+	s.AddCleanup(devicestate.MockOsutilUsersWithGecos(func(gecos string) ([]string, error) {
+		c.Check(gecos, Equals, "managed by snapd")
+		var names []string
+		for name := range s.system {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}))
+	s.AddCleanup(devicestate.MockOsutilUserSSHKeys(func(name string) ([]string, error) {
+		return s.system[name].SSHKeys, nil
+	}))
+	s.AddCleanup(devicestate.MockOsutilIsUserSudoer(func(name string) bool {
+		return s.system[name].Sudoer
+	}))
+	s.AddCleanup(devicestate.MockOsutilUserExpiry(func(name string) (time.Time, error) {
+		if s.system[name].Expiry == "" {
+			return time.Time{}, nil
+		}
+		return time.Parse("2006-01-02", s.system[name].Expiry)
+	}))
+}
+
+func (s *declarativeUsersSuite) setUsers(c *C, users interface{}) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "users", users), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+}
+
+func (s *declarativeUsersSuite) TestDeclarativeUsersInvalid(c *C) {
+	for _, tc := range []struct {
+		users map[string]interface{}
+		err   string
+	}{
+		{map[string]interface{}{"k!": map[string]interface{}{}}, `cannot set users: invalid user name "k!"`},
+		{map[string]interface{}{"bob": map[string]interface{}{"shell": "/bin/sh"}}, `cannot set users: invalid user "bob": json: unknown field "shell"`},
+		{map[string]interface{}{"bob": map[string]interface{}{"sudoer": "yes"}}, `cannot set users: invalid user "bob": json: cannot unmarshal string .*`},
+		{map[string]interface{}{"bob": map[string]interface{}{"ssh-keys": []interface{}{"key\nother"}}}, `cannot set users: invalid ssh key for user "bob"`},
+		{map[string]interface{}{"bob": map[string]interface{}{"expiry": "tomorrow"}}, `cannot set users: invalid expiry "tomorrow" for user "bob": expected YYYY-MM-DD`},
+	} {
+		s.setUsers(c, tc.users)
+		s.state.Lock()
+		_, err := devicestate.DeclarativeUsers(config.NewTransaction(s.state))
+		s.state.Unlock()
+		c.Check(err, ErrorMatches, tc.err)
+	}
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersReconciles(c *C) {
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{
+			"ssh-keys": []interface{}{"ssh-rsa AAAA alice"},
+			"sudoer":   true,
+		},
+		"bob": map[string]interface{}{
+			"expiry": "2021-06-01",
+		},
+	})
+
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, DeepEquals, []string{
+		"add:alice", "sudoer:alice", "key:alice:ssh-rsa AAAA alice",
+		"add:bob", "expiry:bob:2021-06-01",
+	})
+
+	// nothing happens when the configuration is unchanged
+	s.calls = nil
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	s.now = s.now.Add(10 * time.Minute)
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+
+	// keys and sudo are updated, removed users get deleted
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{
+			"ssh-keys": []interface{}{"ssh-rsa BBBB alice"},
+		},
+		"bob": nil,
+	})
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, DeepEquals, []string{
+		"set-keys:alice", "no-sudoer:alice",
+		"del:bob",
+	})
+	c.Check(s.system, DeepEquals, map[string]*devicestate.DeclarativeUser{
+		"alice": {SSHKeys: []string{"ssh-rsa BBBB alice"}},
+	})
+	c.Check(s.createdUsers(c), DeepEquals, []string{"alice"})
+}
+
+func (s *declarativeUsersSuite) createdUsers(c *C) []string {
+	s.state.Lock()
+	defer s.state.Unlock()
+	var created []string
+	c.Assert(s.state.Get("declarative-users", &created), IsNil)
+	return created
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersRestoresSystem(c *C) {
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{
+			"ssh-keys": []interface{}{"ssh-rsa AAAA alice"},
+		},
+		"bob": map[string]interface{}{},
+	})
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+
+	// changed by hand on the system
+	s.system["alice"].SSHKeys = nil
+	s.system["alice"].Sudoer = true
+	delete(s.system, "bob")
+
+	// the system is not checked again before the interval
+	s.calls = nil
+	s.now = s.now.Add(time.Minute)
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+
+	s.now = s.now.Add(5 * time.Minute)
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, DeepEquals, []string{
+		"set-keys:alice", "no-sudoer:alice",
+		"add:bob",
+	})
+	c.Check(s.system, DeepEquals, map[string]*devicestate.DeclarativeUser{
+		"alice": {SSHKeys: []string{"ssh-rsa AAAA alice"}},
+		"bob":   {},
+	})
+	c.Check(s.createdUsers(c), DeepEquals, []string{"alice", "bob"})
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersOnlyTouchesCreatedUsers(c *C) {
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{},
+	})
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.createdUsers(c), DeepEquals, []string{"alice"})
+
+	// a local user that set the gecos used by snapd on its own, e.g.
+	// with chfn
+	s.system["mallory"] = &devicestate.DeclarativeUser{Sudoer: true}
+
+	s.calls = nil
+	s.now = s.now.Add(10 * time.Minute)
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+
+	// undeclaring a user only removes those created by snapd
+	s.setUsers(c, map[string]interface{}{
+		"alice": nil,
+	})
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, DeepEquals, []string{"del:alice"})
+	c.Check(s.system, DeepEquals, map[string]*devicestate.DeclarativeUser{
+		"mallory": {Sudoer: true},
+	})
+	c.Check(s.createdUsers(c), HasLen, 0)
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersForgetsUsersRemovedByHand(c *C) {
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{},
+	})
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+
+	delete(s.system, "alice")
+	s.setUsers(c, map[string]interface{}{
+		"alice": nil,
+	})
+	s.calls = nil
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+	c.Check(s.createdUsers(c), HasLen, 0)
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersErrorBackoff(c *C) {
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{},
+	})
+
+	s.addErr = errors.New("adduser failed")
+	err := devicestate.EnsureDeclarativeUsers(s.mgr)
+	c.Assert(err, ErrorMatches, `cannot apply declared users: adduser failed \(will retry in 1m0s\)`)
+	c.Check(s.calls, DeepEquals, []string{"add:alice"})
+
+	// not retried before the backoff is over
+	s.calls = nil
+	s.now = s.now.Add(30 * time.Second)
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+
+	// the backoff doubles
+	s.now = s.now.Add(30 * time.Second)
+	err = devicestate.EnsureDeclarativeUsers(s.mgr)
+	c.Assert(err, ErrorMatches, `cannot apply declared users: adduser failed \(will retry in 2m0s\)`)
+	c.Check(s.calls, DeepEquals, []string{"add:alice"})
+
+	s.calls = nil
+	s.now = s.now.Add(time.Minute)
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+
+	s.addErr = nil
+	s.now = s.now.Add(time.Minute)
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, DeepEquals, []string{"add:alice"})
+	c.Check(s.system, HasLen, 1)
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersErrorBackoffMax(c *C) {
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{},
+	})
+
+	s.addErr = errors.New("adduser failed")
+	var err error
+	for i := 0; i < 12; i++ {
+		err = devicestate.EnsureDeclarativeUsers(s.mgr)
+		c.Assert(err, NotNil)
+		s.now = s.now.Add(6 * time.Hour)
+	}
+	c.Check(err, ErrorMatches, `cannot apply declared users: adduser failed \(will retry in 6h0m0s\)`)
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersChangeRetriesNow(c *C) {
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{},
+	})
+
+	s.addErr = errors.New("adduser failed")
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), NotNil)
+
+	// what is declared for the user changed, it is tried right away
+	s.addErr = nil
+	s.calls = nil
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{"sudoer": true},
+	})
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, DeepEquals, []string{"add:alice", "sudoer:alice"})
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersNotSeeded(c *C) {
+	s.state.Lock()
+	s.state.Set("seeded", false)
+	s.state.Unlock()
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{},
+	})
+
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+}
+
+func (s *declarativeUsersSuite) TestEnsureDeclarativeUsersClassic(c *C) {
+	s.AddCleanup(release.MockOnClassic(true))
+	s.setUsers(c, map[string]interface{}{
+		"alice": map[string]interface{}{},
+	})
+
+	c.Assert(devicestate.EnsureDeclarativeUsers(s.mgr), IsNil)
+	c.Check(s.calls, HasLen, 0)
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/gadget/install"
 	"github.com/snapcore/snapd/httputil"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/overlord/storecontext"
@@ -132,6 +133,18 @@ func EnsureSeeded(m *DeviceManager) error {
 	return m.ensureSeeded()
 }
 
+func EnsureOperational(m *DeviceManager) error {
+	return m.ensureOperational()
+}
+
+func ReadDeviceIdentitySerial(assertsDir, keysDir string, model *asserts.Model) (string, error) {
+	id, err := readDeviceIdentity(assertsDir, keysDir, model)
+	if err != nil || id == nil {
+		return "", err
+	}
+	return id.serial.Serial(), nil
+}
+
 func EnsureCloudInitRestricted(m *DeviceManager) error {
 	return m.ensureCloudInitRestricted()
 }
@@ -256,6 +269,14 @@ func MockInstallRun(f func(gadgetRoot, device string, options install.Options, o
 	}
 }
 
+func MockUnmountHostUbuntuData(f func() error) (restore func()) {
+	old := unmountHostUbuntuData
+	unmountHostUbuntuData = f
+	return func() {
+		unmountHostUbuntuData = old
+	}
+}
+
 func MockCloudInitStatus(f func() (sysconfig.CloudInitState, error)) (restore func()) {
 	old := cloudInitStatus
 	cloudInitStatus = f
@@ -271,3 +292,87 @@ func MockRestrictCloudInit(f func(sysconfig.CloudInitState, *sysconfig.CloudInit
 		restrictCloudInit = old
 	}
 }
+
+func MockDeclarativeUsersTimeNow(f func() time.Time) (restore func()) {
+	old := declarativeUsersTimeNow
+	declarativeUsersTimeNow = f
+	return func() {
+		declarativeUsersTimeNow = old
+	}
+}
+
+func EnsureDeclarativeUsers(m *DeviceManager) error {
+	return m.ensureDeclarativeUsers()
+}
+
+func MockOsutilAddUser(f func(name string, opts *osutil.AddUserOptions) error) (restore func()) {
+	old := osutilAddUser
+	osutilAddUser = f
+	return func() {
+		osutilAddUser = old
+	}
+}
+
+func MockOsutilDelUser(f func(name string, opts *osutil.DelUserOptions) error) (restore func()) {
+	old := osutilDelUser
+	osutilDelUser = f
+	return func() {
+		osutilDelUser = old
+	}
+}
+
+func MockOsutilSetUserSSHKeys(f func(name string, sshKeys []string) error) (restore func()) {
+	old := osutilSetUserSSHKeys
+	osutilSetUserSSHKeys = f
+	return func() {
+		osutilSetUserSSHKeys = old
+	}
+}
+
+func MockOsutilSetUserSudoer(f func(name string, sudoer bool) error) (restore func()) {
+	old := osutilSetUserSudoer
+	osutilSetUserSudoer = f
+	return func() {
+		osutilSetUserSudoer = old
+	}
+}
+
+func MockOsutilSetUserExpiry(f func(name string, expiry time.Time) error) (restore func()) {
+	old := osutilSetUserExpiry
+	osutilSetUserExpiry = f
+	return func() {
+		osutilSetUserExpiry = old
+	}
+}
+
+func MockOsutilUsersWithGecos(f func(gecos string) ([]string, error)) (restore func()) {
+	old := osutilUsersWithGecos
+	osutilUsersWithGecos = f
+	return func() {
+		osutilUsersWithGecos = old
+	}
+}
+
+func MockOsutilUserSSHKeys(f func(name string) ([]string, error)) (restore func()) {
+	old := osutilUserSSHKeys
+	osutilUserSSHKeys = f
+	return func() {
+		osutilUserSSHKeys = old
+	}
+}
+
+func MockOsutilIsUserSudoer(f func(name string) bool) (restore func()) {
+	old := osutilIsUserSudoer
+	osutilIsUserSudoer = f
+	return func() {
+		osutilIsUserSudoer = old
+	}
+}
+
+func MockOsutilUserExpiry(f func(name string) (time.Time, error)) (restore func()) {
+	old := osutilUserExpiry
+	osutilUserExpiry = f
+	return func() {
+		osutilUserExpiry = old
+	}
+}
@@ -0,0 +1,252 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
+)
+
+// deviceIdentity is the identity of a registered device, that is carried
+// over a factory reset.
+type deviceIdentity struct {
+	serial *asserts.Serial
+	// signKey is the account-key that signed the serial, it is nil when
+	// it is not part of the assertions database (e.g. it is trusted)
+	signKey *asserts.AccountKey
+	privKey asserts.PrivateKey
+}
+
+// factoryResetMarker records the identity written to the recreated
+// ubuntu-data, so that it can be restored once the run system is seeded.
+type factoryResetMarker struct {
+	BrandID string `json:"brand-id"`
+	Model   string `json:"model"`
+	Serial  string `json:"serial"`
+	KeyID   string `json:"key-id"`
+}
+
+func factoryResetMarkerFileUnder(rootdir string) string {
+	return filepath.Join(dirs.SnapDeviceDirUnder(rootdir), "factory-reset")
+}
+
+// readDeviceIdentity reads the identity of a device of the given model from
+// the assertions and device keys stored in the given directories. It returns
+// nil if the device was never registered.
+func readDeviceIdentity(assertsDir, keysDir string, model *asserts.Model) (*deviceIdentity, error) {
+	bs, err := asserts.OpenFSBackstore(assertsDir)
+	if err != nil {
+		return nil, err
+	}
+	keypairMgr, err := asserts.OpenFSKeypairManager(keysDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var serials []*asserts.Serial
+	headers := map[string]string{
+		"brand-id": model.BrandID(),
+		"model":    model.Model(),
+	}
+	err = bs.Search(asserts.SerialType, headers, func(a asserts.Assertion) {
+		serials = append(serials, a.(*asserts.Serial))
+	}, asserts.SerialType.MaxSupportedFormat())
+	if err != nil {
+		return nil, fmt.Errorf("cannot find serial assertions: %v", err)
+	}
+
+	var id *deviceIdentity
+	for _, serial := range serials {
+		privKey, err := keypairMgr.Get(serial.DeviceKey().ID())
+		if err != nil {
+			// not the serial of this device
+			continue
+		}
+		if id != nil && !serial.Timestamp().After(id.serial.Timestamp()) {
+			continue
+		}
+		id = &deviceIdentity{serial: serial, privKey: privKey}
+	}
+	if id == nil {
+		return nil, nil
+	}
+
+	a, err := bs.Get(asserts.AccountKeyType, []string{id.serial.SignKeyID()}, asserts.AccountKeyType.MaxSupportedFormat())
+	if err != nil && !asserts.IsNotFound(err) {
+		return nil, fmt.Errorf("cannot find serial signing key: %v", err)
+	}
+	if err == nil {
+		id.signKey = a.(*asserts.AccountKey)
+	}
+	return id, nil
+}
+
+// storeDeviceIdentity stores the assertions and device key of the device
+// identity in the given directories.
+func storeDeviceIdentity(id *deviceIdentity, assertsDir, keysDir string) error {
+	keypairMgr, err := asserts.OpenFSKeypairManager(keysDir)
+	if err != nil {
+		return err
+	}
+	if _, err := keypairMgr.Get(id.privKey.PublicKey().ID()); err != nil {
+		if err := keypairMgr.Put(id.privKey); err != nil {
+			return fmt.Errorf("cannot store device key: %v", err)
+		}
+	}
+
+	bs, err := asserts.OpenFSBackstore(assertsDir)
+	if err != nil {
+		return err
+	}
+	if id.signKey != nil {
+		if err := bs.Put(asserts.AccountKeyType, id.signKey); err != nil {
+			if _, ok := err.(*asserts.RevisionError); !ok {
+				return fmt.Errorf("cannot store serial signing key: %v", err)
+			}
+		}
+	}
+	if err := bs.Put(asserts.SerialType, id.serial); err != nil {
+		if _, ok := err.(*asserts.RevisionError); !ok {
+			return fmt.Errorf("cannot store serial: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeDeviceIdentity writes the device identity to the snapd state under
+// rootdir, to be restored when the system is seeded.
+func writeDeviceIdentity(id *deviceIdentity, rootdir string) error {
+	if err := storeDeviceIdentity(id, dirs.SnapAssertsDBDirUnder(rootdir), dirs.SnapDeviceDirUnder(rootdir)); err != nil {
+		return err
+	}
+
+	marker, err := json.Marshal(&factoryResetMarker{
+		BrandID: id.serial.BrandID(),
+		Model:   id.serial.Model(),
+		Serial:  id.serial.Serial(),
+		KeyID:   id.privKey.PublicKey().ID(),
+	})
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(factoryResetMarkerFileUnder(rootdir), marker, 0600, 0)
+}
+
+// restoreDeviceIdentity sets the device serial and key recorded when the
+// system was factory reset, so that the device does not need to register
+// again. It returns true if the identity was restored.
+func (m *DeviceManager) restoreDeviceIdentity(device *auth.DeviceState) (bool, error) {
+	markerFile := factoryResetMarkerFileUnder(dirs.GlobalRootDir)
+	content, err := ioutil.ReadFile(markerFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if device.Brand == "" || device.Model == "" {
+		// not seeded yet
+		return false, nil
+	}
+
+	var marker factoryResetMarker
+	if err := json.Unmarshal(content, &marker); err != nil {
+		return false, fmt.Errorf("cannot decode factory reset device identity: %v", err)
+	}
+	// the identity is dropped if it cannot be used, the device will
+	// register again
+	restored := func() bool {
+		if marker.BrandID != device.Brand || marker.Model != device.Model {
+			logger.Noticef("cannot restore device identity of model %s/%s on a %s/%s device", marker.BrandID, marker.Model, device.Brand, device.Model)
+			return false
+		}
+		_, err := assertstate.DB(m.state).Find(asserts.SerialType, map[string]string{
+			"brand-id": marker.BrandID,
+			"model":    marker.Model,
+			"serial":   marker.Serial,
+		})
+		if err != nil {
+			logger.Noticef("cannot restore device identity: cannot find serial assertion: %v", err)
+			return false
+		}
+		if _, err := m.keypairMgr.Get(marker.KeyID); err != nil {
+			logger.Noticef("cannot restore device identity: %v", err)
+			return false
+		}
+		return true
+	}()
+	if err := os.Remove(markerFile); err != nil {
+		return false, err
+	}
+	if !restored {
+		return false, nil
+	}
+
+	device.KeyID = marker.KeyID
+	device.Serial = marker.Serial
+	if err := m.setDevice(device); err != nil {
+		return false, err
+	}
+	logger.Noticef("restored device identity with serial %s", marker.Serial)
+	m.markRegistered()
+	return true, nil
+}
+
+// unmountHostUbuntuData releases the ubuntu-data partition that the
+// initramfs mounted in factory-reset mode, so that it can be recreated.
+var unmountHostUbuntuData = func() error {
+	mounts, err := osutil.LoadMountInfo()
+	if err != nil {
+		return err
+	}
+	source := ""
+	for _, mnt := range mounts {
+		if mnt.MountDir == boot.InitramfsHostUbuntuDataDir {
+			source = mnt.MountSource
+		}
+	}
+	if source == "" {
+		// not mounted
+		return nil
+	}
+	if output, err := exec.Command("umount", boot.InitramfsHostUbuntuDataDir).CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot unmount ubuntu-data: %v", osutil.OutputErr(output, err))
+	}
+	if strings.HasPrefix(source, "/dev/mapper/") {
+		// the partition is encrypted
+		if output, err := exec.Command("cryptsetup", "close", source).CombinedOutput(); err != nil {
+			return fmt.Errorf("cannot close encrypted ubuntu-data: %v", osutil.OutputErr(output, err))
+		}
+	}
+	return nil
+}
@@ -142,10 +142,35 @@ func (m *DeviceManager) doSetupRunSystem(t *state.Task, _ *tomb.Tomb) error {
 		return fmt.Errorf("missing modeenv, cannot proceed")
 	}
 
+	// a factory reset recreates the run system like an install does, but
+	// keeps the identity of the device
+	factoryReset := t.Kind() == "factory-reset-run-system"
+	var identity *deviceIdentity
 	// bootstrap
 	bopts := install.Options{
 		Mount: true,
 	}
+	if factoryReset {
+		hostWritableDir := filepath.Join(boot.InitramfsHostUbuntuDataDir, "system-data")
+		if !osutil.IsDirectory(hostWritableDir) {
+			// the device identity and the keys of ubuntu-save
+			// cannot be kept without it
+			return fmt.Errorf("cannot factory reset: ubuntu-data of the installed system is not mounted at %s", boot.InitramfsHostUbuntuDataDir)
+		}
+		identity, err = readFactoryResetIdentity(hostWritableDir, deviceCtx.Model())
+		if err != nil {
+			return fmt.Errorf("cannot read device identity: %v", err)
+		}
+		// ubuntu-save is kept, along with the keys to unlock it
+		bopts.KeepSave = true
+		bopts.SaveKey, bopts.RecoveryKey, err = readFactoryResetKeys(hostWritableDir)
+		if err != nil {
+			return fmt.Errorf("cannot read ubuntu-save keys: %v", err)
+		}
+		if err := unmountHostUbuntuData(); err != nil {
+			return err
+		}
+	}
 	useEncryption, err := checkEncryption(deviceCtx.Model())
 	if err != nil {
 		return err
@@ -177,6 +202,13 @@ func (m *DeviceManager) doSetupRunSystem(t *state.Task, _ *tomb.Tomb) error {
 		return fmt.Errorf("cannot create partitions: %v", err)
 	}
 
+	// the device identity and snap data stored on ubuntu-save go there
+	if osutil.IsDirectory(boot.InitramfsUbuntuSaveDir) {
+		if err := os.MkdirAll(boot.InstallHostDeviceSaveDir, 0755); err != nil {
+			return err
+		}
+	}
+
 	if trustedInstallObserver != nil {
 		if err := trustedInstallObserver.ObserveExistingTrustedRecoveryAssets(boot.InitramfsUbuntuSeedDir); err != nil {
 			return fmt.Errorf("cannot observe existing trusted recovery assets: err")
@@ -217,6 +249,13 @@ func (m *DeviceManager) doSetupRunSystem(t *state.Task, _ *tomb.Tomb) error {
 		return fmt.Errorf("cannot make run system bootable: %v", err)
 	}
 
+	if identity != nil {
+		logger.Noticef("keep device identity with serial %s", identity.serial.Serial())
+		if err := writeDeviceIdentity(identity, boot.InstallHostWritableDir); err != nil {
+			return fmt.Errorf("cannot keep device identity: %v", err)
+		}
+	}
+
 	// store install-mode log into ubuntu-data partition
 	if err := writeLogs(boot.InstallHostWritableDir); err != nil {
 		logger.Noticef("cannot write logs: %v", err)
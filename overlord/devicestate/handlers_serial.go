@@ -236,6 +236,10 @@ func (rc *initialRegistrationContext) FinishRegistration(serial *asserts.Serial)
 	}
 	rc.deviceMgr.markRegistered()
 
+	if err := rc.deviceMgr.saveDeviceIdentity(device); err != nil {
+		logger.Noticef("cannot keep device identity on ubuntu-save: %v", err)
+	}
+
 	// make sure we timely consider anything that was blocked on
 	// registration
 	rc.deviceMgr.state.EnsureBefore(0)
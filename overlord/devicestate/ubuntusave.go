@@ -0,0 +1,131 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/secboot"
+)
+
+// readFactoryResetIdentity reads the identity of a device that is being
+// factory reset. The copy kept on ubuntu-save is preferred, the one from
+// the ubuntu-data that is about to be recreated is used otherwise.
+func readFactoryResetIdentity(hostWritableDir string, model *asserts.Model) (*deviceIdentity, error) {
+	if osutil.IsDirectory(boot.InstallHostDeviceSaveDir) {
+		id, err := readDeviceIdentity(boot.InstallHostDeviceSaveDir, boot.InstallHostDeviceSaveDir, model)
+		if err != nil {
+			logger.Noticef("cannot read device identity from ubuntu-save: %v", err)
+		}
+		if id != nil {
+			return id, nil
+		}
+	}
+	return readDeviceIdentity(dirs.SnapAssertsDBDirUnder(hostWritableDir), dirs.SnapDeviceDirUnder(hostWritableDir), model)
+}
+
+// readFactoryResetKeys reads the ubuntu-save key and the recovery key from
+// the ubuntu-data that is about to be recreated, so that the kept
+// ubuntu-save partition can still be unlocked. The keys are nil if the
+// device is not encrypted.
+func readFactoryResetKeys(hostWritableDir string) (saveKey *secboot.EncryptionKey, rkey *secboot.RecoveryKey, err error) {
+	fdeDir := dirs.SnapFDEDirUnder(hostWritableDir)
+
+	saveKeyFile := filepath.Join(fdeDir, "ubuntu-save.key")
+	if osutil.FileExists(saveKeyFile) {
+		key, err := secboot.EncryptionKeyFromFile(saveKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		saveKey = &key
+	}
+
+	rkeyFile := filepath.Join(fdeDir, "recovery.key")
+	if osutil.FileExists(rkeyFile) {
+		key, err := secboot.RecoveryKeyFromFile(rkeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		rkey = &key
+	}
+	return saveKey, rkey, nil
+}
+
+// saveDeviceIdentity keeps a copy of the device serial and key on
+// ubuntu-save, so that they survive a reinstall of ubuntu-data. It does
+// nothing on devices without ubuntu-save.
+func (m *DeviceManager) saveDeviceIdentity(device *auth.DeviceState) error {
+	if !osutil.IsDirectory(dirs.SnapSaveDir) {
+		return nil
+	}
+
+	db := assertstate.DB(m.state)
+	a, err := db.Find(asserts.SerialType, map[string]string{
+		"brand-id": device.Brand,
+		"model":    device.Model,
+		"serial":   device.Serial,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot find serial assertion: %v", err)
+	}
+	serial := a.(*asserts.Serial)
+	privKey, err := m.keyPair()
+	if err != nil {
+		return err
+	}
+	id := &deviceIdentity{serial: serial, privKey: privKey}
+
+	a, err = db.Find(asserts.AccountKeyType, map[string]string{
+		"public-key-sha3-384": serial.SignKeyID(),
+	})
+	if err != nil && !asserts.IsNotFound(err) {
+		return fmt.Errorf("cannot find serial signing key: %v", err)
+	}
+	if err == nil {
+		id.signKey = a.(*asserts.AccountKey)
+	}
+
+	if err := os.MkdirAll(dirs.SnapDeviceSaveDir, 0755); err != nil {
+		return err
+	}
+	return storeDeviceIdentity(id, dirs.SnapDeviceSaveDir, dirs.SnapDeviceSaveDir)
+}
+
+// ensureDeviceIdentitySaved makes sure that the identity of devices that
+// registered before ubuntu-save was used is also kept there.
+func (m *DeviceManager) ensureDeviceIdentitySaved(device *auth.DeviceState) {
+	if m.ensureDeviceIdentitySavedRan {
+		return
+	}
+	m.ensureDeviceIdentitySavedRan = true
+
+	if err := m.saveDeviceIdentity(device); err != nil {
+		logger.Noticef("cannot keep device identity on ubuntu-save: %v", err)
+	}
+}
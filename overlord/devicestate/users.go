@@ -0,0 +1,407 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var (
+	osutilAddUser        = osutil.AddUser
+	osutilDelUser        = osutil.DelUser
+	osutilSetUserSSHKeys = osutil.SetUserSSHKeys
+	osutilSetUserSudoer  = osutil.SetUserSudoer
+	osutilSetUserExpiry  = osutil.SetUserExpiry
+
+	osutilUsersWithGecos = osutil.UsersWithGecos
+	osutilUserSSHKeys    = osutil.UserSSHKeys
+	osutilIsUserSudoer   = osutil.IsUserSudoer
+	osutilUserExpiry     = osutil.UserExpiry
+)
+
+// declarativeUserGecos is set on the users created from the users system
+// option. As any user can change their own gecos, the users created by
+// snapd are also recorded in the state under declarativeUsersStateKey and
+// only those are ever updated or removed.
+const declarativeUserGecos = "managed by snapd"
+
+const declarativeUsersStateKey = "declarative-users"
+
+var (
+	// declarativeUsersCheckInterval is the time between checks of the
+	// users of the system against the users system option, which is
+	// otherwise checked when it changes
+	declarativeUsersCheckInterval = 5 * time.Minute
+	// a user that cannot be applied is retried after a delay that
+	// doubles with every failure, up to a maximum
+	declarativeUserRetryMin = time.Minute
+	declarativeUserRetryMax = 6 * time.Hour
+
+	// the declared users keep their own clock, as they are checked on
+	// every ensure
+	declarativeUsersTimeNow = time.Now
+)
+
+// declarativeUserRetry tracks the failures to apply a declared user.
+type declarativeUserRetry struct {
+	// declared is what failed to be applied, nil for a removal
+	declared *DeclarativeUser
+	backoff  time.Duration
+	next     time.Time
+}
+
+// declarativeUsersState is what the device manager keeps in memory about
+// the reconciliation of the declared users.
+type declarativeUsersState struct {
+	declared  map[string]*DeclarativeUser
+	nextCheck time.Time
+	retries   map[string]*declarativeUserRetry
+}
+
+// DeclarativeUser describes a local user as configured under the users.<name>
+// system options.
+type DeclarativeUser struct {
+	SSHKeys []string `json:"ssh-keys,omitempty"`
+	Sudoer  bool     `json:"sudoer,omitempty"`
+	// Expiry is the date, in YYYY-MM-DD format, on which the account
+	// gets disabled.
+	Expiry string `json:"expiry,omitempty"`
+}
+
+func (u *DeclarativeUser) expiry() time.Time {
+	// validated by DeclarativeUsers
+	t, _ := time.Parse("2006-01-02", u.Expiry)
+	return t
+}
+
+// DeclarativeUsers returns the local users described by the users system
+// option, indexed by their name.
+func DeclarativeUsers(tr config.ConfGetter) (map[string]*DeclarativeUser, error) {
+	var value map[string]interface{}
+	if err := tr.Get("core", "users", &value); err != nil && !config.IsNoOption(err) {
+		return nil, fmt.Errorf("cannot set users: %v", err)
+	}
+	users := make(map[string]*DeclarativeUser, len(value))
+	for name, v := range value {
+		if !osutil.IsValidUsername(name) {
+			return nil, fmt.Errorf("cannot set users: invalid user name %q", name)
+		}
+		if v == nil {
+			// the user was unset
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var u DeclarativeUser
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&u); err != nil {
+			return nil, fmt.Errorf("cannot set users: invalid user %q: %v", name, err)
+		}
+		for _, key := range u.SSHKeys {
+			if strings.TrimSpace(key) == "" || strings.ContainsAny(key, "\n\r") {
+				return nil, fmt.Errorf("cannot set users: invalid ssh key for user %q", name)
+			}
+		}
+		if u.Expiry != "" {
+			if _, err := time.Parse("2006-01-02", u.Expiry); err != nil {
+				return nil, fmt.Errorf("cannot set users: invalid expiry %q for user %q: expected YYYY-MM-DD", u.Expiry, name)
+			}
+		}
+		users[name] = &u
+	}
+	return users, nil
+}
+
+// systemDeclarativeUsers returns the users created from the users system
+// option as they are on the system, the created users are those recorded
+// in the state.
+func systemDeclarativeUsers(created []string) (map[string]*DeclarativeUser, error) {
+	names, err := osutilUsersWithGecos(declarativeUserGecos)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]*DeclarativeUser, len(names))
+	for _, name := range names {
+		if !strutil.ListContains(created, name) {
+			// not created by snapd, even if it claims so
+			continue
+		}
+		sshKeys, err := osutilUserSSHKeys(name)
+		if err != nil {
+			return nil, err
+		}
+		expiry, err := osutilUserExpiry(name)
+		if err != nil {
+			return nil, err
+		}
+		u := &DeclarativeUser{
+			SSHKeys: sshKeys,
+			Sudoer:  osutilIsUserSudoer(name),
+		}
+		if !expiry.IsZero() {
+			u.Expiry = expiry.Format("2006-01-02")
+		}
+		users[name] = u
+	}
+	return users, nil
+}
+
+func createDeclarativeUser(name string, u *DeclarativeUser) error {
+	err := osutilAddUser(name, &osutil.AddUserOptions{
+		Gecos:      declarativeUserGecos,
+		Sudoer:     u.Sudoer,
+		SSHKeys:    u.SSHKeys,
+		ExtraUsers: !release.OnClassic,
+	})
+	if err != nil {
+		return err
+	}
+	if u.Expiry != "" {
+		return osutilSetUserExpiry(name, u.expiry())
+	}
+	return nil
+}
+
+func updateDeclarativeUser(name string, old, u *DeclarativeUser) error {
+	if !sshKeysEqual(old.SSHKeys, u.SSHKeys) {
+		if err := osutilSetUserSSHKeys(name, u.SSHKeys); err != nil {
+			return err
+		}
+	}
+	if old.Sudoer != u.Sudoer {
+		if err := osutilSetUserSudoer(name, u.Sudoer); err != nil {
+			return err
+		}
+	}
+	if old.Expiry != u.Expiry {
+		if err := osutilSetUserExpiry(name, u.expiry()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureDeclarativeUsers reconciles the local users of the system with the
+// users system option, users that are no longer configured get removed. The
+// users of the system are checked when the option changes and otherwise
+// every declarativeUsersCheckInterval, a user that cannot be applied is
+// retried with a backoff.
+func (m *DeviceManager) ensureDeclarativeUsers() error {
+	if release.OnClassic {
+		return nil
+	}
+
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	var seeded bool
+	if err := m.state.Get("seeded", &seeded); err != nil && err != state.ErrNoState {
+		return err
+	}
+	if !seeded {
+		// gadget defaults are applied during seeding
+		return nil
+	}
+
+	users, err := DeclarativeUsers(config.NewTransaction(m.state))
+	if err != nil {
+		return err
+	}
+
+	s := &m.declarativeUsers
+	now := declarativeUsersTimeNow()
+	if now.Before(s.nextCheck) && declarativeUsersEqual(s.declared, users) {
+		return nil
+	}
+	s.declared = users
+	s.nextCheck = now.Add(declarativeUsersCheckInterval)
+	if s.retries == nil {
+		s.retries = make(map[string]*declarativeUserRetry)
+	}
+
+	var created []string
+	if err := m.state.Get(declarativeUsersStateKey, &created); err != nil && err != state.ErrNoState {
+		return err
+	}
+	onSystem, err := systemDeclarativeUsers(created)
+	if err != nil {
+		return fmt.Errorf("cannot apply declared users: %v", err)
+	}
+
+	names := make([]string, 0, len(users)+len(onSystem))
+	for name := range users {
+		names = append(names, name)
+	}
+	for name := range onSystem {
+		if _, ok := users[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		u, old := users[name], onSystem[name]
+		var apply func() error
+		switch {
+		case old == nil:
+			apply = func() error {
+				logger.Noticef("creating declared user %q", name)
+				if err := createDeclarativeUser(name, u); err != nil {
+					return err
+				}
+				if !strutil.ListContains(created, name) {
+					created = append(created, name)
+				}
+				return nil
+			}
+		case u == nil:
+			apply = func() error {
+				logger.Noticef("removing user %q that is no longer declared", name)
+				if err := osutilDelUser(name, &osutil.DelUserOptions{ExtraUsers: !release.OnClassic}); err != nil {
+					return err
+				}
+				created = removeName(created, name)
+				return nil
+			}
+		case !declarativeUserEqual(old, u):
+			apply = func() error {
+				logger.Noticef("updating declared user %q", name)
+				return updateDeclarativeUser(name, old, u)
+			}
+		default:
+			delete(s.retries, name)
+			continue
+		}
+
+		retry := s.retries[name]
+		if retry != nil && !declarativeUserEqual(retry.declared, u) {
+			// what is declared changed since it failed
+			retry = nil
+		}
+		if retry != nil && now.Before(retry.next) {
+			if retry.next.Before(s.nextCheck) {
+				s.nextCheck = retry.next
+			}
+			continue
+		}
+
+		if err := apply(); err != nil {
+			if retry == nil {
+				retry = &declarativeUserRetry{
+					declared: u,
+					backoff:  declarativeUserRetryMin,
+				}
+			} else {
+				retry.backoff *= 2
+				if retry.backoff > declarativeUserRetryMax {
+					retry.backoff = declarativeUserRetryMax
+				}
+			}
+			retry.next = now.Add(retry.backoff)
+			s.retries[name] = retry
+			if retry.next.Before(s.nextCheck) {
+				s.nextCheck = retry.next
+			}
+			errs = append(errs, fmt.Sprintf("%v (will retry in %s)", err, retry.backoff))
+			continue
+		}
+		delete(s.retries, name)
+	}
+	for _, name := range created {
+		if _, ok := users[name]; !ok {
+			if _, ok := onSystem[name]; !ok {
+				// removed by other means
+				created = removeName(created, name)
+			}
+		}
+	}
+	sort.Strings(created)
+	m.state.Set(declarativeUsersStateKey, created)
+	for name := range s.retries {
+		if _, ok := users[name]; !ok {
+			if _, ok := onSystem[name]; !ok {
+				delete(s.retries, name)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot apply declared users: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func removeName(names []string, name string) []string {
+	res := make([]string, 0, len(names))
+	for _, n := range names {
+		if n != name {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func declarativeUsersEqual(a, b map[string]*DeclarativeUser) bool {
+	if a == nil || len(a) != len(b) {
+		return false
+	}
+	for name, u := range a {
+		v, ok := b[name]
+		if !ok || !declarativeUserEqual(u, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func declarativeUserEqual(a, b *DeclarativeUser) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return sshKeysEqual(a.SSHKeys, b.SSHKeys) && a.Sudoer == b.Sudoer && a.Expiry == b.Expiry
+}
+
+func sshKeysEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -224,3 +224,53 @@ func Get(st *state.State, snap string) (*HealthState, error) {
 
 	return &health, nil
 }
+
+// SetApp saves the health of the given app of the given snap, as found
+// by the health probe of the app, in snapd's state. A nil health removes
+// the one saved for the app.
+func SetApp(st *state.State, snapName, appName string, health *HealthState) error {
+	hs, err := AllApps(st)
+	if err != nil {
+		return err
+	}
+	if health == nil {
+		if hs[snapName][appName] == nil {
+			return nil
+		}
+		delete(hs[snapName], appName)
+		if len(hs[snapName]) == 0 {
+			delete(hs, snapName)
+		}
+	} else {
+		if hs == nil {
+			hs = map[string]map[string]*HealthState{}
+		}
+		if hs[snapName] == nil {
+			hs[snapName] = map[string]*HealthState{}
+		}
+		hs[snapName][appName] = health
+	}
+	st.Set("app-health", hs)
+
+	return nil
+}
+
+// AllApps returns the health of the apps of all snaps, by snap and app
+// name.
+func AllApps(st *state.State) (map[string]map[string]*HealthState, error) {
+	var hs map[string]map[string]*HealthState
+	if err := st.Get("app-health", &hs); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	return hs, nil
+}
+
+// GetApp returns the health of the given app of the given snap, or nil
+// if it is not known.
+func GetApp(st *state.State, snapName, appName string) (*HealthState, error) {
+	hs, err := AllApps(st)
+	if err != nil {
+		return nil, err
+	}
+	return hs[snapName][appName], nil
+}
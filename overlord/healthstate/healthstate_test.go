@@ -253,3 +253,47 @@ func (s *healthSuite) TestSetFromHookContextEmpty(c *check.C) {
 	// no health in the context -> no health in state
 	c.Check(s.state.Get("health", &hs), check.Equals, state.ErrNoState)
 }
+
+func (s *healthSuite) TestAppHealth(c *check.C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	hs, err := healthstate.AllApps(s.state)
+	c.Assert(err, check.IsNil)
+	c.Check(hs, check.IsNil)
+	health, err := healthstate.GetApp(s.state, "test-snap", "svc")
+	c.Assert(err, check.IsNil)
+	c.Check(health, check.IsNil)
+
+	okay := &healthstate.HealthState{Revision: snap.R(42), Status: healthstate.OkayStatus}
+	bad := &healthstate.HealthState{Revision: snap.R(42), Status: healthstate.ErrorStatus, Message: "boom"}
+	c.Assert(healthstate.SetApp(s.state, "test-snap", "svc", okay), check.IsNil)
+	c.Assert(healthstate.SetApp(s.state, "test-snap", "other", bad), check.IsNil)
+
+	health, err = healthstate.GetApp(s.state, "test-snap", "svc")
+	c.Assert(err, check.IsNil)
+	c.Check(health, check.DeepEquals, okay)
+	hs, err = healthstate.AllApps(s.state)
+	c.Assert(err, check.IsNil)
+	c.Check(hs, check.DeepEquals, map[string]map[string]*healthstate.HealthState{
+		"test-snap": {"svc": okay, "other": bad},
+	})
+
+	// the health of the snap itself is kept apart
+	snapHealth, err := healthstate.Get(s.state, "test-snap")
+	c.Assert(err, check.IsNil)
+	c.Check(snapHealth, check.IsNil)
+
+	c.Assert(healthstate.SetApp(s.state, "test-snap", "svc", nil), check.IsNil)
+	c.Assert(healthstate.SetApp(s.state, "test-snap", "unknown", nil), check.IsNil)
+	hs, err = healthstate.AllApps(s.state)
+	c.Assert(err, check.IsNil)
+	c.Check(hs, check.DeepEquals, map[string]map[string]*healthstate.HealthState{
+		"test-snap": {"other": bad},
+	})
+
+	c.Assert(healthstate.SetApp(s.state, "test-snap", "other", nil), check.IsNil)
+	hs, err = healthstate.AllApps(s.state)
+	c.Assert(err, check.IsNil)
+	c.Check(hs, check.HasLen, 0)
+}
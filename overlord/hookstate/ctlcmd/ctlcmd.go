@@ -35,6 +35,7 @@ type baseCommand struct {
 	stdout io.Writer
 	stderr io.Writer
 	c      *hookstate.Context
+	uid    uint32
 }
 
 func (c *baseCommand) setStdout(w io.Writer) {
@@ -65,6 +66,10 @@ func (c *baseCommand) context() *hookstate.Context {
 	return c.c
 }
 
+func (c *baseCommand) setUid(uid uint32) {
+	c.uid = uid
+}
+
 type command interface {
 	setStdout(w io.Writer)
 	setStderr(w io.Writer)
@@ -72,6 +77,9 @@ type command interface {
 	setContext(context *hookstate.Context)
 	context() *hookstate.Context
 
+	// setUid sets the user that invoked the command
+	setUid(uid uint32)
+
 	Execute(args []string) error
 }
 
@@ -138,6 +146,7 @@ func Run(context *hookstate.Context, args []string, uid uint32) (stdout, stderr
 			cmd.setStdout(&stdoutBuffer)
 			cmd.setStderr(&stderrBuffer)
 			cmd.setContext(context)
+			cmd.setUid(uid)
 			data = cmd
 		} else {
 			data = &ForbiddenCommand{Uid: uid, Name: name}
@@ -176,10 +176,15 @@ func (c *getCommand) getConfigSetting(context *hookstate.Context) error {
 	transaction := configstate.ContextTransaction(context)
 	context.Unlock()
 
+	instanceName := c.context().InstanceName()
 	return c.printValues(func(key string) (interface{}, bool, error) {
 		var value interface{}
-		err := transaction.Get(c.context().InstanceName(), key, &value)
+		err := transaction.Get(instanceName, key, &value)
 		if err == nil {
+			if c.uid != 0 {
+				// secret values are only shown to root
+				value = transaction.Redact(instanceName, key, value)
+			}
 			return value, true, nil
 		}
 		if config.IsNoOption(err) {
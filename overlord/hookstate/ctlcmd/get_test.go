@@ -20,6 +20,7 @@
 package ctlcmd_test
 
 import (
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/configstate/config"
@@ -245,6 +246,40 @@ func (s *getSuite) TestGetRegularUser(c *C) {
 	c.Assert(string(stderr), Equals, "")
 }
 
+func (s *getSuite) TestGetSecretRedactedForRegularUser(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("/")
+
+	state := state.New(nil)
+	state.Lock()
+
+	task := state.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "test-snap", Revision: snap.R(1), Hook: "test-hook"}
+
+	tr := config.NewTransaction(state)
+	tr.Set("test-snap", "token", "s3cr3t")
+	tr.Set("test-snap", "name", "foo")
+	c.Assert(tr.MarkSecret("test-snap", "token"), IsNil)
+	tr.Commit()
+
+	state.Unlock()
+
+	mockHandler := hooktest.NewMockHandler()
+	mockContext, err := hookstate.NewContext(task, task.State(), setup, mockHandler, "")
+	c.Assert(err, IsNil)
+
+	stdout, _, err := ctlcmd.Run(mockContext, []string{"get", "token"}, 1000)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "*****\n")
+	stdout, _, err = ctlcmd.Run(mockContext, []string{"get", "name"}, 1000)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "foo\n")
+
+	stdout, _, err = ctlcmd.Run(mockContext, []string{"get", "token"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "s3cr3t\n")
+}
+
 func (s *getSuite) TestCommandWithoutContext(c *C) {
 	_, _, err := ctlcmd.Run(nil, []string{"get", "foo"}, 0)
 	c.Check(err, ErrorMatches, ".*cannot get without a context.*")
@@ -34,6 +34,9 @@ import (
 type setCommand struct {
 	baseCommand
 
+	Secret   bool `long:"secret" description:"hide the values of the given top level options from non-root users"`
+	NoSecret bool `long:"no-secret" description:"stop hiding the values of the given top level options from non-root users"`
+
 	Positional struct {
 		PlugOrSlotSpec string   `positional-arg-name:":<plug|slot>"`
 		ConfValues     []string `positional-arg-name:"key=value"`
@@ -60,6 +63,14 @@ Plug and slot attributes may be set in the respective prepare and connect hooks
 naming the respective plug or slot:
 
     $ snapctl set :myplug path=/dev/ttyS0
+
+Top level options holding credentials may be marked secret, their values are
+then kept in a root-only location and hidden from non-root users:
+
+    $ snapctl set --secret api-token=$TOKEN
+
+The values of options marked secret are shown again to non-root users once
+they are set with --no-secret.
 `)
 
 func init() {
@@ -92,19 +103,68 @@ func (s *setCommand) Execute(args []string) error {
 	if snap != "" {
 		return fmt.Errorf(`"snapctl set %s" not supported, use "snapctl set :%s" instead`, s.Positional.PlugOrSlotSpec, parts[1])
 	}
+	if s.Secret {
+		return fmt.Errorf("cannot use --secret with interface attributes")
+	}
+	if s.NoSecret {
+		return fmt.Errorf("cannot use --no-secret with interface attributes")
+	}
 	return s.setInterfaceSetting(context, name)
 }
 
 func (s *setCommand) setConfigSetting(context *hookstate.Context) error {
+	if s.Secret && s.NoSecret {
+		return fmt.Errorf("cannot use --secret and --no-secret together")
+	}
+	changeSecret := s.Secret || s.NoSecret
+
 	context.Lock()
 	tr := configstate.ContextTransaction(context)
 	context.Unlock()
 
+	instanceName := s.context().InstanceName()
+	// previous values of the keys that were set, and whether they were
+	// secret, to put them back if the resulting configuration is not
+	// valid
+	var keys []string
+	previous := make(map[string]interface{})
+	wasSecret := make(map[string]bool)
+	set := func(key string, value interface{}) {
+		if _, ok := previous[key]; !ok {
+			var old interface{}
+			tr.GetMaybe(instanceName, key, &old)
+			previous[key] = old
+			wasSecret[key] = tr.IsSecret(instanceName, key)
+			keys = append(keys, key)
+		}
+		tr.Set(instanceName, key, value)
+	}
+	setSecret := func(key string, secret bool) error {
+		if secret {
+			return tr.MarkSecret(instanceName, key)
+		}
+		return tr.UnmarkSecret(instanceName, key)
+	}
+
+	if changeSecret {
+		// only top level options can be secret, refuse before touching
+		// the transaction
+		for _, patchValue := range s.Positional.ConfValues {
+			key := strings.TrimSuffix(strings.SplitN(patchValue, "=", 2)[0], "!")
+			if strings.Contains(key, ".") {
+				if s.NoSecret {
+					return fmt.Errorf("cannot unmark nested option %q of snap %q as secret", key, instanceName)
+				}
+				return fmt.Errorf("cannot mark nested option %q of snap %q as secret", key, instanceName)
+			}
+		}
+	}
+
 	for _, patchValue := range s.Positional.ConfValues {
 		parts := strings.SplitN(patchValue, "=", 2)
 		if len(parts) == 1 && strings.HasSuffix(patchValue, "!") {
 			key := strings.TrimSuffix(patchValue, "!")
-			tr.Set(s.context().InstanceName(), key, nil)
+			set(key, nil)
 			continue
 		}
 		if len(parts) != 2 {
@@ -117,7 +177,28 @@ func (s *setCommand) setConfigSetting(context *hookstate.Context) error {
 			value = parts[1]
 		}
 
-		tr.Set(s.context().InstanceName(), key, value)
+		set(key, value)
+	}
+
+	if changeSecret {
+		for _, key := range keys {
+			if err := setSecret(key, s.Secret); err != nil {
+				return err
+			}
+		}
+	}
+
+	context.Lock()
+	err := configstate.ValidateSnapConfig(tr, instanceName)
+	context.Unlock()
+	if err != nil {
+		for i := len(keys) - 1; i >= 0; i-- {
+			tr.Set(instanceName, keys[i], previous[keys[i]])
+			if changeSecret {
+				setSecret(keys[i], wasSecret[keys[i]])
+			}
+		}
+		return err
 	}
 
 	return nil
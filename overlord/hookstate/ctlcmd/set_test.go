@@ -21,15 +21,20 @@ package ctlcmd_test
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
 	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
 
 	. "gopkg.in/check.v1"
 )
@@ -99,6 +104,140 @@ func (s *setSuite) TestCommand(c *C) {
 	c.Check(value, Equals, "qux")
 }
 
+func (s *setSuite) TestCommandSchemaValidation(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("/")
+
+	st := s.mockContext.State()
+	st.Lock()
+	si := &snap.SideInfo{RealName: "test-snap", Revision: snap.R(1)}
+	info := snaptest.MockSnap(c, "name: test-snap\nversion: 1", si)
+	schema := `{"properties": {"port": {"type": "integer"}}}`
+	c.Assert(ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "config-schema.json"), []byte(schema), 0644), IsNil)
+	snapstate.Set(st, "test-snap", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si},
+		Current:  snap.R(1),
+		Active:   true,
+		SnapType: "app",
+	})
+	st.Unlock()
+
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"set", "port=80"}, 0)
+	c.Assert(err, IsNil)
+
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "foo=bar", "port=eighty"}, 0)
+	c.Assert(err, ErrorMatches, `invalid configuration for "port": expected integer`)
+
+	// the invalid values were not kept
+	s.mockContext.Lock()
+	defer s.mockContext.Unlock()
+	c.Check(s.mockContext.Done(), IsNil)
+
+	tr := config.NewTransaction(st)
+	var port int
+	c.Check(tr.Get("test-snap", "port", &port), IsNil)
+	c.Check(port, Equals, 80)
+	var value string
+	c.Check(tr.Get("test-snap", "foo", &value), ErrorMatches, `snap "test-snap" has no "foo" configuration option`)
+}
+
+func (s *setSuite) TestCommandSecret(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("/")
+
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"set", "--secret", "token=s3cr3t"}, 0)
+	c.Assert(err, IsNil)
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "name=foo"}, 0)
+	c.Assert(err, IsNil)
+
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "--secret", "a.b=c"}, 0)
+	c.Assert(err, ErrorMatches, `cannot mark nested option "a.b" of snap "test-snap" as secret`)
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "--secret", ":myplug", "foo=bar"}, 0)
+	c.Assert(err, ErrorMatches, `cannot use --secret with interface attributes`)
+
+	s.mockContext.Lock()
+	defer s.mockContext.Unlock()
+	c.Check(s.mockContext.Done(), IsNil)
+
+	st := s.mockContext.State()
+	raw, err := config.GetSnapConfig(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*raw), Equals, `{"name":"foo"}`)
+	secrets, err := config.SnapSecrets(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*secrets["token"]), Equals, `"s3cr3t"`)
+}
+
+func (s *setSuite) TestCommandSecretSchemaValidation(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("/")
+
+	st := s.mockContext.State()
+	st.Lock()
+	si := &snap.SideInfo{RealName: "test-snap", Revision: snap.R(1)}
+	info := snaptest.MockSnap(c, "name: test-snap\nversion: 1", si)
+	schema := `{"properties": {"port": {"type": "integer"}}}`
+	c.Assert(ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "config-schema.json"), []byte(schema), 0644), IsNil)
+	snapstate.Set(st, "test-snap", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si},
+		Current:  snap.R(1),
+		Active:   true,
+		SnapType: "app",
+	})
+	st.Unlock()
+
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"set", "port=80"}, 0)
+	c.Assert(err, IsNil)
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "--secret", "port=eighty"}, 0)
+	c.Assert(err, ErrorMatches, `invalid configuration for "port": expected integer`)
+
+	// the mark was rolled back with the value
+	s.mockContext.Lock()
+	defer s.mockContext.Unlock()
+	c.Check(s.mockContext.Done(), IsNil)
+
+	raw, err := config.GetSnapConfig(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*raw), Equals, `{"port":80}`)
+	secrets, err := config.SnapSecrets(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(secrets, HasLen, 0)
+}
+
+func (s *setSuite) TestCommandNoSecret(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("/")
+
+	st := s.mockContext.State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	c.Assert(tr.Set("test-snap", "token", "s3cr3t"), IsNil)
+	c.Assert(tr.MarkSecret("test-snap", "token"), IsNil)
+	c.Assert(tr.Commit(), IsNil)
+	st.Unlock()
+
+	_, _, err := ctlcmd.Run(s.mockContext, []string{"set", "--no-secret", "token=public"}, 0)
+	c.Assert(err, IsNil)
+
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "--no-secret", "a.b=c"}, 0)
+	c.Assert(err, ErrorMatches, `cannot unmark nested option "a.b" of snap "test-snap" as secret`)
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "--secret", "--no-secret", "a=b"}, 0)
+	c.Assert(err, ErrorMatches, `cannot use --secret and --no-secret together`)
+	_, _, err = ctlcmd.Run(s.mockContext, []string{"set", "--no-secret", ":myplug", "foo=bar"}, 0)
+	c.Assert(err, ErrorMatches, `cannot use --no-secret with interface attributes`)
+
+	s.mockContext.Lock()
+	defer s.mockContext.Unlock()
+	c.Check(s.mockContext.Done(), IsNil)
+
+	raw, err := config.GetSnapConfig(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(string(*raw), Equals, `{"token":"public"}`)
+	secrets, err := config.SnapSecrets(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(secrets, HasLen, 0)
+}
+
 func (s *setSuite) TestSetRegularUserForbidden(c *C) {
 	_, _, err := ctlcmd.Run(s.mockContext, []string{"set", "test-key1"}, 1000)
 	c.Assert(err, ErrorMatches, `cannot use "set" with uid 1000, try with sudo`)
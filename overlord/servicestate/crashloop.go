@@ -0,0 +1,247 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/systemd"
+)
+
+var (
+	// crashLoopCheckInterval is the time between checks of the restart
+	// counts of the services, which are done as part of the ensure loop
+	crashLoopCheckInterval = time.Minute
+	// a service restarted by systemd at least crashLoopRestarts times
+	// within crashLoopWindow is deemed to be in a crash loop
+	crashLoopWindow   = 10 * time.Minute
+	crashLoopRestarts = 5
+	// crashLoopLogLines is the number of lines of the journal of a
+	// service added to the warning about it being in a crash loop
+	crashLoopLogLines = 10
+
+	serviceRestartCounts = func(apps []*snap.AppInfo) (map[string]int, error) {
+		names := make([]string, len(apps))
+		for i, app := range apps {
+			names[i] = app.ServiceName()
+		}
+		sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null)
+		return sysd.RestartCounts(names...)
+	}
+
+	serviceLastLogs = serviceLastLogsImpl
+)
+
+// ServiceRestarts describes the restarts of a service by systemd, as last
+// checked.
+type ServiceRestarts struct {
+	// Count is the number of times systemd restarted the service
+	// since it was last started otherwise.
+	Count int `json:"count"`
+	// CrashLoop is set if the service keeps being restarted.
+	CrashLoop bool `json:"crash-loop,omitempty"`
+}
+
+// AllServiceRestarts returns what is known of the restarts of the services
+// of all snaps, by snap and app name. Services that were not restarted by
+// systemd are left out.
+func AllServiceRestarts(st *state.State) (map[string]map[string]*ServiceRestarts, error) {
+	var restarts map[string]map[string]*ServiceRestarts
+	if err := st.Get("service-restarts", &restarts); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	return restarts, nil
+}
+
+type restartSample struct {
+	time  time.Time
+	count int
+}
+
+// crashLoopWatcher periodically checks how many times systemd restarted
+// the services of the active snaps, warning about the services that are
+// in a crash loop.
+type crashLoopWatcher struct {
+	state *state.State
+	infos snapInfoCache
+
+	lastCheck time.Time
+	// unsupported is set once systemd is found not to count restarts
+	unsupported bool
+	// samples are the restart counts of the services within the
+	// crash loop window, by security tag
+	samples map[string][]restartSample
+}
+
+func newCrashLoopWatcher(st *state.State) *crashLoopWatcher {
+	return &crashLoopWatcher{
+		state:   st,
+		samples: make(map[string][]restartSample),
+	}
+}
+
+// ensure checks the restart counts of the services if it is time to, and
+// schedules the next check.
+func (w *crashLoopWatcher) ensure() error {
+	if w.unsupported {
+		return nil
+	}
+	st := w.state
+	now := timeNow()
+	if w.lastCheck.IsZero() {
+		// give the services time to start before the first check
+		w.lastCheck = now
+		st.EnsureBefore(crashLoopCheckInterval)
+		return nil
+	}
+	if now.Sub(w.lastCheck) < crashLoopCheckInterval {
+		return nil
+	}
+	w.lastCheck = now
+	st.EnsureBefore(crashLoopCheckInterval)
+
+	st.Lock()
+	svcs, err := w.infos.systemServices(st)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// systemctl is not called with the state lock held, and only once
+	// for all the services
+	var svcCounts map[string]int
+	if len(svcs) > 0 {
+		svcCounts, err = serviceRestartCounts(svcs)
+		if err == systemd.ErrNoRestartCount {
+			logger.Noticef("cannot detect services in a crash loop: %v", err)
+			w.unsupported = true
+			return nil
+		}
+		if err != nil {
+			logger.Noticef("cannot get restart counts of services: %v", err)
+			return nil
+		}
+	}
+	counts := make(map[*snap.AppInfo]int, len(svcs))
+	for _, app := range svcs {
+		if n, ok := svcCounts[app.ServiceName()]; ok {
+			counts[app] = n
+		}
+	}
+
+	st.Lock()
+	old, err := AllServiceRestarts(st)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	restarts := make(map[string]map[string]*ServiceRestarts)
+	samples := make(map[string][]restartSample, len(counts))
+	var looping []*snap.AppInfo
+	recent := make(map[*snap.AppInfo]int)
+	for app, n := range counts {
+		key := app.SecurityTag()
+		appSamples := w.samples[key]
+		if len(appSamples) > 0 && n < appSamples[len(appSamples)-1].count {
+			// the service was started again otherwise,
+			// resetting the count
+			appSamples = nil
+		}
+		appSamples = append(appSamples, restartSample{time: now, count: n})
+		for now.Sub(appSamples[0].time) > crashLoopWindow {
+			appSamples = appSamples[1:]
+		}
+		samples[key] = appSamples
+
+		if n == 0 {
+			continue
+		}
+		recent[app] = n - appSamples[0].count
+		crashLoop := recent[app] >= crashLoopRestarts
+		snapName := app.Snap.InstanceName()
+		if prev := old[snapName][app.Name]; crashLoop && (prev == nil || !prev.CrashLoop) {
+			looping = append(looping, app)
+		}
+		if restarts[snapName] == nil {
+			restarts[snapName] = make(map[string]*ServiceRestarts)
+		}
+		restarts[snapName][app.Name] = &ServiceRestarts{Count: n, CrashLoop: crashLoop}
+	}
+	w.samples = samples
+
+	logs := make(map[*snap.AppInfo][]string, len(looping))
+	for _, app := range looping {
+		lines, err := serviceLastLogs(app, crashLoopLogLines)
+		if err != nil {
+			logger.Noticef("cannot get logs of service %q: %v", app.ServiceName(), err)
+		}
+		logs[app] = lines
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	if !reflect.DeepEqual(restarts, old) && (len(restarts) > 0 || len(old) > 0) {
+		st.Set("service-restarts", restarts)
+	}
+	for _, app := range looping {
+		msg := fmt.Sprintf("service %q is in a crash loop: it was restarted by systemd %d times in the last %s",
+			app.Snap.InstanceName()+"."+app.Name, recent[app], crashLoopWindow)
+		if lines := logs[app]; len(lines) > 0 {
+			msg += ", its last log lines are:\n" + strings.Join(lines, "\n")
+		}
+		logger.Noticef("Service %q is in a crash loop", app.ServiceName())
+		st.Warnf("%s", msg)
+	}
+	return nil
+}
+
+func serviceLastLogsImpl(app *snap.AppInfo, n int) ([]string, error) {
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null)
+	reader, err := sysd.LogReader([]string{app.ServiceName()}, n, false)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var lines []string
+	dec := json.NewDecoder(reader)
+	for {
+		var log systemd.Log
+		if err := dec.Decode(&log); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return lines, err
+		}
+		lines = append(lines, log.Message())
+	}
+	return lines, nil
+}
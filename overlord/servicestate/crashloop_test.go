@@ -0,0 +1,299 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type crashLoopSuite struct {
+	testutil.BaseTest
+	state      *state.State
+	serviceMgr *servicestate.ServiceManager
+
+	now      time.Time
+	counts   map[string]int
+	countErr error
+	checked  []string
+	calls    int
+	logged   []string
+}
+
+var _ = Suite(&crashLoopSuite{})
+
+const crashingSnapYaml = `name: test-snap
+version: 1.0
+apps:
+  svc1:
+    daemon: simple
+  svc2:
+    daemon: simple
+  cmd:
+    command: bin/cmd
+`
+
+func (s *crashLoopSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	s.state = o.State()
+	s.serviceMgr = servicestate.Manager(s.state, o.TaskRunner())
+	o.AddManager(s.serviceMgr)
+	o.AddManager(o.TaskRunner())
+	c.Assert(o.StartUp(), IsNil)
+
+	s.now = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.AddCleanup(servicestate.MockTimeNow(func() time.Time { return s.now }))
+	s.AddCleanup(servicestate.MockCrashLoopDetection(time.Minute, 5*time.Minute, 5))
+
+	s.counts = make(map[string]int)
+	s.countErr = nil
+	s.checked = nil
+	s.calls = 0
+	s.AddCleanup(servicestate.MockServiceRestartCounts(func(apps []*snap.AppInfo) (map[string]int, error) {
+		s.calls++
+		counts := make(map[string]int, len(apps))
+		for _, app := range apps {
+			s.checked = append(s.checked, app.Name)
+			counts[app.ServiceName()] = s.counts[app.Name]
+		}
+		if s.countErr != nil {
+			return nil, s.countErr
+		}
+		return counts, nil
+	}))
+	s.logged = nil
+	s.AddCleanup(servicestate.MockServiceLastLogs(func(app *snap.AppInfo, n int) ([]string, error) {
+		c.Check(n, Equals, 10)
+		s.logged = append(s.logged, app.Name)
+		return []string{"starting", "panic: boom"}, nil
+	}))
+
+	si := &snap.SideInfo{RealName: "test-snap", Revision: snap.R(7)}
+	snaptest.MockSnap(c, crashingSnapYaml, si)
+	s.state.Lock()
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+	s.state.Unlock()
+
+	// the first ensure only schedules the first check
+	c.Assert(s.serviceMgr.Ensure(), IsNil)
+}
+
+// check lets a check interval pass and ensures, returning the services
+// whose restart count was checked
+func (s *crashLoopSuite) check(c *C) []string {
+	s.checked = nil
+	s.now = s.now.Add(time.Minute)
+	c.Assert(s.serviceMgr.Ensure(), IsNil)
+	sort.Strings(s.checked)
+	return s.checked
+}
+
+func (s *crashLoopSuite) restarts(c *C) map[string]map[string]*servicestate.ServiceRestarts {
+	s.state.Lock()
+	defer s.state.Unlock()
+	restarts, err := servicestate.AllServiceRestarts(s.state)
+	c.Assert(err, IsNil)
+	return restarts
+}
+
+func (s *crashLoopSuite) warnings() []string {
+	s.state.Lock()
+	defer s.state.Unlock()
+	var msgs []string
+	for _, w := range s.state.AllWarnings() {
+		msgs = append(msgs, w.String())
+	}
+	return msgs
+}
+
+func (s *crashLoopSuite) TestNotCheckedBeforeInterval(c *C) {
+	s.now = s.now.Add(30 * time.Second)
+	c.Assert(s.serviceMgr.Ensure(), IsNil)
+	c.Check(s.checked, HasLen, 0)
+
+	c.Check(s.check(c), DeepEquals, []string{"svc1", "svc2"})
+	c.Check(s.restarts(c), IsNil)
+}
+
+func (s *crashLoopSuite) TestRestartCounts(c *C) {
+	s.counts["svc1"] = 2
+	c.Check(s.check(c), DeepEquals, []string{"svc1", "svc2"})
+	// systemd was asked once for all the services
+	c.Check(s.calls, Equals, 1)
+	c.Check(s.restarts(c), DeepEquals, map[string]map[string]*servicestate.ServiceRestarts{
+		"test-snap": {"svc1": {Count: 2}},
+	})
+	c.Check(s.warnings(), HasLen, 0)
+	c.Check(s.logged, HasLen, 0)
+
+	// the count is reset when the service is started by hand
+	s.counts["svc1"] = 0
+	s.check(c)
+	c.Check(s.restarts(c), HasLen, 0)
+}
+
+func (s *crashLoopSuite) TestCrashLoop(c *C) {
+	s.check(c)
+	s.counts["svc1"] = 3
+	s.check(c)
+	c.Check(s.warnings(), HasLen, 0)
+
+	s.counts["svc1"] = 6
+	s.check(c)
+	c.Check(s.restarts(c), DeepEquals, map[string]map[string]*servicestate.ServiceRestarts{
+		"test-snap": {"svc1": {Count: 6, CrashLoop: true}},
+	})
+	c.Check(s.logged, DeepEquals, []string{"svc1"})
+	c.Check(s.warnings(), DeepEquals, []string{
+		`service "test-snap.svc1" is in a crash loop: it was restarted by systemd 6 times in the last 5m0s, its last log lines are:
+starting
+panic: boom`,
+	})
+
+	// still in a crash loop, no new warning
+	s.counts["svc1"] = 8
+	s.check(c)
+	c.Check(s.restarts(c)["test-snap"]["svc1"], DeepEquals, &servicestate.ServiceRestarts{Count: 8, CrashLoop: true})
+	c.Check(s.logged, HasLen, 1)
+	c.Check(s.warnings(), HasLen, 1)
+
+	// no more restarts for a whole window
+	for i := 0; i < 5; i++ {
+		s.check(c)
+	}
+	c.Check(s.restarts(c)["test-snap"]["svc1"], DeepEquals, &servicestate.ServiceRestarts{Count: 8})
+	c.Check(s.warnings(), HasLen, 1)
+}
+
+func (s *crashLoopSuite) TestCrashLoopAfterCountReset(c *C) {
+	s.counts["svc2"] = 4
+	s.check(c)
+	s.counts["svc2"] = 1
+	s.check(c)
+	// the count was reset, only 3 restarts since then
+	s.counts["svc2"] = 4
+	s.check(c)
+	c.Check(s.restarts(c)["test-snap"]["svc2"], DeepEquals, &servicestate.ServiceRestarts{Count: 4})
+
+	s.counts["svc2"] = 6
+	s.check(c)
+	c.Check(s.restarts(c)["test-snap"]["svc2"], DeepEquals, &servicestate.ServiceRestarts{Count: 6, CrashLoop: true})
+	c.Check(s.logged, DeepEquals, []string{"svc2"})
+}
+
+func (s *crashLoopSuite) TestRestartCountUnsupported(c *C) {
+	s.countErr = systemd.ErrNoRestartCount
+	c.Check(s.check(c), HasLen, 2)
+	c.Check(s.check(c), HasLen, 0)
+	c.Check(s.restarts(c), IsNil)
+}
+
+func (s *crashLoopSuite) TestRestartCountError(c *C) {
+	s.counts["svc1"] = 2
+	s.check(c)
+
+	s.countErr = errors.New("boom")
+	s.counts["svc1"] = 3
+	c.Check(s.check(c), HasLen, 2)
+	// what was known is kept
+	c.Check(s.restarts(c)["test-snap"]["svc1"], DeepEquals, &servicestate.ServiceRestarts{Count: 2})
+
+	// and checked again the next time
+	s.countErr = nil
+	c.Check(s.check(c), HasLen, 2)
+	c.Check(s.restarts(c)["test-snap"]["svc1"], DeepEquals, &servicestate.ServiceRestarts{Count: 3})
+}
+
+type ensureBeforeBackend struct {
+	ensureBefore []time.Duration
+}
+
+func (b *ensureBeforeBackend) Checkpoint([]byte) error {
+	return nil
+}
+
+func (b *ensureBeforeBackend) EnsureBefore(d time.Duration) {
+	b.ensureBefore = append(b.ensureBefore, d)
+}
+
+func (b *ensureBeforeBackend) RequestRestart(state.RestartType) {}
+
+func (s *crashLoopSuite) TestNextCheckScheduled(c *C) {
+	b := &ensureBeforeBackend{}
+	st := state.New(b)
+	mgr := servicestate.Manager(st, state.NewTaskRunner(st))
+
+	// the first check is scheduled
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Check(b.ensureBefore, DeepEquals, []time.Duration{time.Minute})
+
+	// not due yet, it stays scheduled
+	s.now = s.now.Add(30 * time.Second)
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Check(b.ensureBefore, HasLen, 1)
+
+	// the next one is scheduled after checking
+	s.now = s.now.Add(30 * time.Second)
+	c.Assert(mgr.Ensure(), IsNil)
+	c.Check(b.ensureBefore, DeepEquals, []time.Duration{time.Minute, time.Minute})
+}
+
+func (s *crashLoopSuite) TestServiceLastLogs(c *C) {
+	restore := systemd.MockJournalctl(func(svcs []string, n int, follow bool) (io.ReadCloser, error) {
+		c.Check(svcs, DeepEquals, []string{"snap.test-snap.svc1.service"})
+		c.Check(n, Equals, 2)
+		c.Check(follow, Equals, false)
+		return ioutil.NopCloser(strings.NewReader(`{"MESSAGE": "starting"}
+{"MESSAGE": "panic: boom"}
+`)), nil
+	})
+	defer restore()
+
+	info := snaptest.MockInfo(c, crashingSnapYaml, &snap.SideInfo{Revision: snap.R(7)})
+	lines, err := servicestate.ServiceLastLogs(info.Apps["svc1"], 2)
+	c.Assert(err, IsNil)
+	c.Check(lines, DeepEquals, []string{"starting", "panic: boom"})
+}
@@ -19,6 +19,80 @@
 
 package servicestate
 
+import (
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/snap"
+)
+
 var (
 	UpdateSnapstateServices = updateSnapstateServices
 )
+
+var RunHealthProbe = runHealthProbeImpl
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
+
+func MockRunHealthProbe(f func(probe *snap.HealthProbeInfo, tb *tomb.Tomb) error) (restore func()) {
+	old := runHealthProbe
+	runHealthProbe = f
+	return func() {
+		runHealthProbe = old
+	}
+}
+
+func MockServiceIsActive(f func(app *snap.AppInfo) (bool, error)) (restore func()) {
+	old := serviceIsActive
+	serviceIsActive = f
+	return func() {
+		serviceIsActive = old
+	}
+}
+
+// ProbeHealth starts the health probes that are due, as the loop does, and
+// waits for them to be done.
+func (m *ServiceManager) ProbeHealth() (next time.Duration, err error) {
+	next, err = m.prober.probeDue()
+	m.prober.wg.Wait()
+	return next, err
+}
+
+func MockCrashLoopDetection(checkInterval, window time.Duration, restarts int) (restore func()) {
+	oldCheckInterval := crashLoopCheckInterval
+	oldWindow := crashLoopWindow
+	oldRestarts := crashLoopRestarts
+	crashLoopCheckInterval = checkInterval
+	crashLoopWindow = window
+	crashLoopRestarts = restarts
+	return func() {
+		crashLoopCheckInterval = oldCheckInterval
+		crashLoopWindow = oldWindow
+		crashLoopRestarts = oldRestarts
+	}
+}
+
+func MockServiceRestartCounts(f func(apps []*snap.AppInfo) (map[string]int, error)) (restore func()) {
+	old := serviceRestartCounts
+	serviceRestartCounts = f
+	return func() {
+		serviceRestartCounts = old
+	}
+}
+
+func MockServiceLastLogs(f func(app *snap.AppInfo, n int) ([]string, error)) (restore func()) {
+	old := serviceLastLogs
+	serviceLastLogs = f
+	return func() {
+		serviceLastLogs = old
+	}
+}
+
+var ServiceLastLogs = serviceLastLogsImpl
@@ -0,0 +1,397 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/healthstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/systemd"
+)
+
+var (
+	timeNow = time.Now
+
+	runHealthProbe = runHealthProbeImpl
+
+	serviceIsActive = func(app *snap.AppInfo) (bool, error) {
+		sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null)
+		return sysd.IsActive(app.ServiceName())
+	}
+
+	// healthProbeHTTPClient only talks to the service itself, the
+	// probe is about it answering: following redirects or going
+	// through a proxy would have snapd fetch whatever the snap
+	// points it to
+	healthProbeHTTPClient = &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: &http.Transport{Proxy: nil},
+	}
+)
+
+// probeState is the in-memory state of the health probe of a service.
+type probeState struct {
+	lastRun  time.Time
+	failures int
+	running  bool
+}
+
+// healthProber runs the health probes of the services of the active snaps,
+// recording the health of the services in healthstate. The probes are run
+// from its own loop, as they come due, and not from the ensure loop of the
+// overlord.
+type healthProber struct {
+	state *state.State
+	infos snapInfoCache
+
+	mu      sync.Mutex
+	probes  map[string]*probeState
+	started bool
+	wakeup  chan struct{}
+	wg      sync.WaitGroup
+	tomb    tomb.Tomb
+}
+
+func newHealthProber(st *state.State) *healthProber {
+	return &healthProber{
+		state:  st,
+		probes: make(map[string]*probeState),
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+// start starts the loop running the health probes.
+func (p *healthProber) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started {
+		return
+	}
+	p.started = true
+	go p.loop()
+}
+
+// wake has the loop look again for the services to probe, e.g. because
+// snaps were installed or removed.
+func (p *healthProber) wake() {
+	select {
+	case p.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// loop runs the probes as they come due until the prober is stopped. It is
+// not waited for on stop, as it might be waiting for the state lock held by
+// the caller, but once stopped it does not start any probes anymore.
+func (p *healthProber) loop() {
+	for {
+		next, err := p.probeDue()
+		if err != nil {
+			logger.Noticef("cannot run health probes: %v", err)
+		}
+		// without services to probe only a wake up matters
+		var timer *time.Timer
+		var due <-chan time.Time
+		if next > 0 {
+			timer = time.NewTimer(next)
+			due = timer.C
+		}
+		select {
+		case <-p.tomb.Dying():
+		case <-p.wakeup:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-p.tomb.Dying():
+			return
+		default:
+		}
+	}
+}
+
+// probedServices returns the services of the active snaps that have a
+// health probe.
+func (p *healthProber) probedServices() ([]*snap.AppInfo, error) {
+	svcs, err := p.infos.systemServices(p.state)
+	if err != nil {
+		return nil, err
+	}
+	var apps []*snap.AppInfo
+	for _, app := range svcs {
+		if app.HealthProbe != nil {
+			apps = append(apps, app)
+		}
+	}
+	return apps, nil
+}
+
+// probeDue starts the health probes that are due, and forgets about the
+// health of the services that are not probed anymore. It returns the time
+// until the next probe is due, zero if there are no probes.
+func (p *healthProber) probeDue() (time.Duration, error) {
+	st := p.state
+	st.Lock()
+	defer st.Unlock()
+
+	apps, err := p.probedServices()
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.tomb.Dying():
+		return 0, nil
+	default:
+	}
+
+	now := timeNow()
+	var next time.Duration
+	probed := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		key := app.SecurityTag()
+		probed[key] = true
+		ps := p.probes[key]
+		if ps == nil {
+			ps = &probeState{}
+			p.probes[key] = ps
+		}
+		interval := app.HealthProbe.EffectiveInterval()
+		if ps.running {
+			continue
+		}
+		wait := ps.lastRun.Add(interval).Sub(now)
+		if wait <= 0 {
+			ps.lastRun = now
+			ps.running = true
+			wait = interval
+			p.wg.Add(1)
+			go p.probe(app)
+		}
+		if next == 0 || wait < next {
+			next = wait
+		}
+	}
+	for key := range p.probes {
+		if !probed[key] {
+			delete(p.probes, key)
+		}
+	}
+
+	healths, err := healthstate.AllApps(st)
+	if err != nil {
+		return 0, err
+	}
+	for snapName, appHealths := range healths {
+		for appName := range appHealths {
+			if !probed[snap.AppSecurityTag(snapName, appName)] {
+				if err := healthstate.SetApp(st, snapName, appName, nil); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	return next, nil
+}
+
+// stop stops the loop and the running health probes and waits for them to
+// be done.
+func (p *healthProber) stop() {
+	p.mu.Lock()
+	p.tomb.Kill(nil)
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *healthProber) probe(app *snap.AppInfo) {
+	defer p.wg.Done()
+
+	active, err := serviceIsActive(app)
+	if err != nil {
+		logger.Noticef("cannot check whether service %q is active: %v", app.ServiceName(), err)
+		active = false
+	}
+	if !active {
+		// only running services are probed
+		err = errServiceInactive
+	} else {
+		err = runHealthProbe(app.HealthProbe, &p.tomb)
+	}
+
+	st := p.state
+	st.Lock()
+	defer st.Unlock()
+	if err := p.record(app, err); err != nil {
+		logger.Noticef("cannot record health of service %q: %v", app.ServiceName(), err)
+	}
+}
+
+var errServiceInactive = errors.New("service is not active")
+
+// record records the result of the health probe of the given app. It
+// must be called with the state lock held.
+func (p *healthProber) record(app *snap.AppInfo, probeErr error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := app.SecurityTag()
+	ps := p.probes[key]
+	if ps == nil {
+		// the service is not probed anymore
+		return nil
+	}
+	ps.running = false
+
+	select {
+	case <-p.tomb.Dying():
+		// the probe may have been aborted
+		return nil
+	default:
+	}
+
+	st := p.state
+	snapName := app.Snap.InstanceName()
+	if probeErr == errServiceInactive {
+		ps.failures = 0
+		return healthstate.SetApp(st, snapName, app.Name, nil)
+	}
+
+	probe := app.HealthProbe
+	var health *healthstate.HealthState
+	if probeErr == nil {
+		ps.failures = 0
+		health = &healthstate.HealthState{
+			Status: healthstate.OkayStatus,
+		}
+	} else {
+		ps.failures++
+		logger.Debugf("health probe of service %q failed (%d/%d): %v", app.ServiceName(), ps.failures, probe.EffectiveThreshold(), probeErr)
+		if ps.failures < probe.EffectiveThreshold() {
+			return nil
+		}
+		health = &healthstate.HealthState{
+			Status:  healthstate.ErrorStatus,
+			Code:    "snapd-probe-failed",
+			Message: fmt.Sprintf("%s health probe failed: %v", probe.Kind(), probeErr),
+		}
+		if probe.Restart {
+			ps.failures = 0
+			if err := restartUnhealthy(st, app); err != nil {
+				logger.Noticef("cannot restart unhealthy service %q: %v", app.ServiceName(), err)
+			}
+		}
+	}
+
+	old, err := healthstate.GetApp(st, snapName, app.Name)
+	if err != nil {
+		return err
+	}
+	if old != nil && old.Revision == app.Snap.Revision && old.Status == health.Status && old.Message == health.Message {
+		// keep the time since when the service is in that state
+		return nil
+	}
+	health.Revision = app.Snap.Revision
+	health.Timestamp = timeNow()
+	return healthstate.SetApp(st, snapName, app.Name, health)
+}
+
+// restartUnhealthy creates a change restarting the given service, unless
+// its snap is being operated on.
+func restartUnhealthy(st *state.State, app *snap.AppInfo) error {
+	snapName := app.Snap.InstanceName()
+	if err := snapstate.CheckChangeConflict(st, snapName, nil); err != nil {
+		return err
+	}
+
+	t := st.NewTask("service-control", fmt.Sprintf("Restart unhealthy service %q", app.ServiceName()))
+	t.Set("service-action", ServiceAction{
+		SnapName: snapName,
+		Action:   "restart",
+		Services: []string{app.Name},
+	})
+	chg := st.NewChange("service-control", fmt.Sprintf("Restart unhealthy service %q", app.ServiceName()))
+	chg.AddTask(t)
+	st.EnsureBefore(0)
+	logger.Noticef("Restarting unhealthy service %q", app.ServiceName())
+	return nil
+}
+
+func runHealthProbeImpl(probe *snap.HealthProbeInfo, tb *tomb.Tomb) error {
+	timeout := probe.EffectiveTimeout()
+	switch probe.Kind() {
+	case "exec":
+		argv := strings.Fields(probe.App.LauncherHealthProbeCommand())
+		if output, err := osutil.RunAndWait(argv, nil, timeout, tb); err != nil {
+			return osutil.OutputErr(output, err)
+		}
+		return nil
+	case "http":
+		ctx, cancel := context.WithTimeout(tb.Context(nil), timeout)
+		defer cancel()
+		url := fmt.Sprintf("http://127.0.0.1:%d%s", probe.HTTP.Port, probe.HTTP.Path)
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		rsp, err := healthProbeHTTPClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode >= 400 {
+			return fmt.Errorf("got %q", rsp.Status)
+		}
+		return nil
+	case "tcp":
+		var dialer net.Dialer
+		ctx, cancel := context.WithTimeout(tb.Context(nil), timeout)
+		defer cancel()
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(probe.TCP.Port)))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	return fmt.Errorf("internal error: unknown health probe kind %q", probe.Kind())
+}
@@ -0,0 +1,381 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/healthstate"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type healthProbeSuite struct {
+	testutil.BaseTest
+	state      *state.State
+	serviceMgr *servicestate.ServiceManager
+
+	now      time.Time
+	mu       sync.Mutex
+	probed   []string
+	results  map[string]error
+	inactive map[string]bool
+}
+
+var _ = Suite(&healthProbeSuite{})
+
+const probedSnapYaml = `name: test-snap
+version: 1.0
+apps:
+  web:
+    daemon: simple
+    health-probe:
+      http:
+        port: 8080
+      threshold: 2
+      restart: true
+  db:
+    daemon: simple
+    health-probe:
+      tcp:
+        port: 5432
+  plain:
+    daemon: simple
+  desktop:
+    daemon: simple
+    daemon-scope: user
+    health-probe:
+      exec: bin/check
+`
+
+func (s *healthProbeSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	s.state = o.State()
+	s.serviceMgr = servicestate.Manager(s.state, o.TaskRunner())
+	o.AddManager(s.serviceMgr)
+	o.AddManager(o.TaskRunner())
+	// the probing loop is not started, the tests run the due probes
+	// themselves
+
+	s.now = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.AddCleanup(servicestate.MockTimeNow(func() time.Time { return s.now }))
+
+	s.probed = nil
+	s.results = make(map[string]error)
+	s.inactive = make(map[string]bool)
+	s.AddCleanup(servicestate.MockRunHealthProbe(func(probe *snap.HealthProbeInfo, tb *tomb.Tomb) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.probed = append(s.probed, probe.App.Name)
+		return s.results[probe.App.Name]
+	}))
+	s.AddCleanup(servicestate.MockServiceIsActive(func(app *snap.AppInfo) (bool, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return !s.inactive[app.Name], nil
+	}))
+
+	si := &snap.SideInfo{RealName: "test-snap", Revision: snap.R(7)}
+	snaptest.MockSnap(c, probedSnapYaml, si)
+	s.state.Lock()
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+	s.state.Unlock()
+}
+
+func (s *healthProbeSuite) ensure(c *C) []string {
+	s.mu.Lock()
+	s.probed = nil
+	s.mu.Unlock()
+
+	_, err := s.serviceMgr.ProbeHealth()
+	c.Assert(err, IsNil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Strings(s.probed)
+	return s.probed
+}
+
+func (s *healthProbeSuite) appHealth(c *C, app string) *healthstate.HealthState {
+	s.state.Lock()
+	defer s.state.Unlock()
+	health, err := healthstate.GetApp(s.state, "test-snap", app)
+	c.Assert(err, IsNil)
+	return health
+}
+
+func (s *healthProbeSuite) TestProbesRunWhenDue(c *C) {
+	c.Check(s.ensure(c), DeepEquals, []string{"db", "web"})
+	okay := &healthstate.HealthState{
+		Revision:  snap.R(7),
+		Timestamp: s.now,
+		Status:    healthstate.OkayStatus,
+	}
+	c.Check(s.appHealth(c, "web"), DeepEquals, okay)
+	c.Check(s.appHealth(c, "db"), DeepEquals, okay)
+	c.Check(s.appHealth(c, "plain"), IsNil)
+	c.Check(s.appHealth(c, "desktop"), IsNil)
+
+	// not due yet
+	s.now = s.now.Add(10 * time.Second)
+	c.Check(s.ensure(c), HasLen, 0)
+
+	s.now = s.now.Add(snap.DefaultHealthProbeInterval)
+	c.Check(s.ensure(c), DeepEquals, []string{"db", "web"})
+	// the health did not change, and neither did its timestamp
+	c.Check(s.appHealth(c, "db"), DeepEquals, okay)
+}
+
+func (s *healthProbeSuite) TestProbeHealthNextDue(c *C) {
+	next, err := s.serviceMgr.ProbeHealth()
+	c.Assert(err, IsNil)
+	c.Check(next, Equals, snap.DefaultHealthProbeInterval)
+
+	s.now = s.now.Add(10 * time.Second)
+	next, err = s.serviceMgr.ProbeHealth()
+	c.Assert(err, IsNil)
+	c.Check(next, Equals, snap.DefaultHealthProbeInterval-10*time.Second)
+
+	s.state.Lock()
+	snapstate.Set(s.state, "test-snap", nil)
+	s.state.Unlock()
+	next, err = s.serviceMgr.ProbeHealth()
+	c.Assert(err, IsNil)
+	c.Check(next, Equals, time.Duration(0))
+}
+
+func (s *healthProbeSuite) TestProbeLoop(c *C) {
+	c.Assert(s.serviceMgr.StartUp(), IsNil)
+	defer s.serviceMgr.Stop()
+
+	probed := func() []string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return append([]string(nil), s.probed...)
+	}
+	for i := 0; i < 500 && len(probed()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sorted := probed()
+	sort.Strings(sorted)
+	c.Check(sorted, DeepEquals, []string{"db", "web"})
+
+	// the probes did not go through the ensure loop
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(s.state.Changes(), HasLen, 0)
+}
+
+func (s *healthProbeSuite) TestProbeFailureThreshold(c *C) {
+	s.results["db"] = errors.New("connection refused")
+
+	for i := 1; i < snap.DefaultHealthProbeThreshold; i++ {
+		c.Check(s.ensure(c), DeepEquals, []string{"db", "web"})
+		c.Check(s.appHealth(c, "db"), IsNil, Commentf("#%d", i))
+		s.now = s.now.Add(snap.DefaultHealthProbeInterval)
+	}
+
+	c.Check(s.ensure(c), DeepEquals, []string{"db", "web"})
+	c.Check(s.appHealth(c, "db"), DeepEquals, &healthstate.HealthState{
+		Revision:  snap.R(7),
+		Timestamp: s.now,
+		Status:    healthstate.ErrorStatus,
+		Code:      "snapd-probe-failed",
+		Message:   "tcp health probe failed: connection refused",
+	})
+
+	// no restart was asked for
+	s.state.Lock()
+	c.Check(s.state.Changes(), HasLen, 0)
+	s.state.Unlock()
+
+	delete(s.results, "db")
+	s.now = s.now.Add(snap.DefaultHealthProbeInterval)
+	c.Check(s.ensure(c), DeepEquals, []string{"db", "web"})
+	c.Check(s.appHealth(c, "db").Status, Equals, healthstate.OkayStatus)
+}
+
+func (s *healthProbeSuite) TestProbeRestart(c *C) {
+	s.results["web"] = errors.New(`got "503 Service Unavailable"`)
+
+	s.ensure(c)
+	s.now = s.now.Add(snap.DefaultHealthProbeInterval)
+	s.ensure(c)
+
+	c.Check(s.appHealth(c, "web"), DeepEquals, &healthstate.HealthState{
+		Revision:  snap.R(7),
+		Timestamp: s.now,
+		Status:    healthstate.ErrorStatus,
+		Code:      "snapd-probe-failed",
+		Message:   `http health probe failed: got "503 Service Unavailable"`,
+	})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	chgs := s.state.Changes()
+	c.Assert(chgs, HasLen, 1)
+	c.Check(chgs[0].Kind(), Equals, "service-control")
+	tasks := chgs[0].Tasks()
+	c.Assert(tasks, HasLen, 1)
+	c.Check(tasks[0].Kind(), Equals, "service-control")
+	c.Check(tasks[0].Summary(), Equals, `Restart unhealthy service "snap.test-snap.web.service"`)
+	var action servicestate.ServiceAction
+	c.Assert(tasks[0].Get("service-action", &action), IsNil)
+	c.Check(action, DeepEquals, servicestate.ServiceAction{
+		SnapName: "test-snap",
+		Action:   "restart",
+		Services: []string{"web"},
+	})
+}
+
+func (s *healthProbeSuite) TestProbeRestartConflict(c *C) {
+	s.results["web"] = errors.New("boom")
+
+	s.state.Lock()
+	chg := s.state.NewChange("refresh", "...")
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: &snap.SideInfo{RealName: "test-snap"}})
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.ensure(c)
+	s.now = s.now.Add(snap.DefaultHealthProbeInterval)
+	s.ensure(c)
+
+	c.Check(s.appHealth(c, "web").Status, Equals, healthstate.ErrorStatus)
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(s.state.Changes(), HasLen, 1)
+}
+
+func (s *healthProbeSuite) TestProbeInactiveService(c *C) {
+	c.Check(s.ensure(c), DeepEquals, []string{"db", "web"})
+	c.Check(s.appHealth(c, "db"), NotNil)
+
+	s.inactive["db"] = true
+	s.results["db"] = errors.New("connection refused")
+	for i := 0; i < snap.DefaultHealthProbeThreshold; i++ {
+		s.now = s.now.Add(snap.DefaultHealthProbeInterval)
+		c.Check(s.ensure(c), DeepEquals, []string{"web"})
+	}
+	// a stopped service has no health
+	c.Check(s.appHealth(c, "db"), IsNil)
+}
+
+func (s *healthProbeSuite) TestProbeForgetsRemovedSnaps(c *C) {
+	s.ensure(c)
+
+	s.state.Lock()
+	snapstate.Set(s.state, "test-snap", nil)
+	healthstate.SetApp(s.state, "gone-snap", "svc", &healthstate.HealthState{Status: healthstate.OkayStatus})
+	s.state.Unlock()
+
+	c.Check(s.ensure(c), HasLen, 0)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	healths, err := healthstate.AllApps(s.state)
+	c.Assert(err, IsNil)
+	c.Check(healths, HasLen, 0)
+}
+
+func (s *healthProbeSuite) TestStop(c *C) {
+	s.serviceMgr.Stop()
+	c.Check(s.ensure(c), HasLen, 0)
+}
+
+func (s *healthProbeSuite) TestRunHealthProbeHTTP(c *C) {
+	status := 200
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	c.Assert(err, IsNil)
+	n, err := strconv.Atoi(port)
+	c.Assert(err, IsNil)
+
+	probe := &snap.HealthProbeInfo{HTTP: &snap.HTTPProbeInfo{Port: n, Path: "/healthz"}}
+	var tb tomb.Tomb
+	c.Check(servicestate.RunHealthProbe(probe, &tb), IsNil)
+	c.Check(path, Equals, "/healthz")
+
+	status = 500
+	c.Check(servicestate.RunHealthProbe(probe, &tb), ErrorMatches, `got "500 Internal Server Error"`)
+}
+
+func (s *healthProbeSuite) TestRunHealthProbeHTTPNoRedirect(c *C) {
+	followed := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	probe := &snap.HealthProbeInfo{HTTP: &snap.HTTPProbeInfo{Port: port, Path: "/"}}
+	var tb tomb.Tomb
+	c.Check(servicestate.RunHealthProbe(probe, &tb), IsNil)
+	c.Check(followed, Equals, false)
+}
+
+func (s *healthProbeSuite) TestRunHealthProbeTCP(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	probe := &snap.HealthProbeInfo{TCP: &snap.TCPProbeInfo{Port: port}}
+	var tb tomb.Tomb
+	c.Check(servicestate.RunHealthProbe(probe, &tb), IsNil)
+
+	l.Close()
+	c.Check(servicestate.RunHealthProbe(probe, &tb), ErrorMatches, ".*connection refused")
+}
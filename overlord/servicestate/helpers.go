@@ -23,10 +23,51 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 )
 
+// snapInfoCache keeps the current infos of the active snaps, as reading
+// the snap.yaml of every snap on every ensure would be wasteful.
+type snapInfoCache struct {
+	infos map[string]*snap.Info
+}
+
+// systemServices returns the system services of the active snaps. It
+// must be called with the state lock held.
+func (ic *snapInfoCache) systemServices(st *state.State) ([]*snap.AppInfo, error) {
+	snapStates, err := snapstate.All(st)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]*snap.Info, len(snapStates))
+	var svcs []*snap.AppInfo
+	for name, snapst := range snapStates {
+		if !snapst.Active {
+			continue
+		}
+		// the info is reused while the revision stays the same
+		info := ic.infos[name]
+		if info == nil || info.Revision != snapst.Current {
+			info, err = snapst.CurrentInfo()
+			if err != nil {
+				logger.Noticef("cannot get current info of snap %q: %v", name, err)
+				continue
+			}
+		}
+		infos[name] = info
+		for _, app := range info.Services() {
+			if app.DaemonScope == snap.SystemDaemon {
+				svcs = append(svcs, app)
+			}
+		}
+	}
+	ic.infos = infos
+	return svcs, nil
+}
+
 // updateSnapstateServices uses ServicesEnabledByHooks and ServicesDisabledByHooks in
 // snapstate and the provided enabled or disabled list to update the state of services in snapstate.
 // It is meant for doServiceControl to help track enabling and disabling of services.
@@ -28,23 +28,41 @@ import (
 
 // ServiceManager is responsible for starting and stopping snap services.
 type ServiceManager struct {
-	state *state.State
+	state   *state.State
+	prober  *healthProber
+	watcher *crashLoopWatcher
 }
 
 // Manager returns a new service manager.
 func Manager(st *state.State, runner *state.TaskRunner) *ServiceManager {
 	delayedCrossMgrInit()
 	m := &ServiceManager{
-		state: st,
+		state:   st,
+		prober:  newHealthProber(st),
+		watcher: newCrashLoopWatcher(st),
 	}
 	// TODO: undo handler
 	runner.AddHandler("service-control", m.doServiceControl, nil)
 	return m
 }
 
+// StartUp implements StateStarterUp.Startup. It starts the loop running the
+// health probes of the services.
+func (m *ServiceManager) StartUp() error {
+	m.prober.start()
+	return nil
+}
+
 // Ensure implements StateManager.Ensure.
 func (m *ServiceManager) Ensure() error {
-	return nil
+	// the snaps may have changed
+	m.prober.wake()
+	return m.watcher.ensure()
+}
+
+// Stop implements StateStopper. It stops the running health probes.
+func (m *ServiceManager) Stop() {
+	m.prober.stop()
 }
 
 func delayedCrossMgrInit() {
@@ -69,6 +69,8 @@ var (
 // Flags encompasses extra flags for snapshots backend Save.
 type Flags struct {
 	Auto bool
+	// SecretConf lists the options of the configuration that are secret.
+	SecretConf []string
 }
 
 // Iter loops over all snapshots in the snapshots directory, applying the given
@@ -215,8 +217,10 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	}
 
 	var auto bool
+	var secretConf []string
 	if flags != nil {
 		auto = flags.Auto
+		secretConf = flags.SecretConf
 	}
 
 	snapshot := &client.Snapshot{
@@ -231,6 +235,8 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		Size:     0,
 		Conf:     cfg,
 		Auto:     auto,
+
+		SecretConf: secretConf,
 	}
 
 	aw, err := osutil.NewAtomicFile(Filename(snapshot), 0600, 0, osutil.NoChown, osutil.NoChown)
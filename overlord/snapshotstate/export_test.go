@@ -166,6 +166,22 @@ func MockConfigSetSnapConfig(f func(*state.State, string, *json.RawMessage) erro
 	}
 }
 
+func MockConfigSetSnapConfigWithSecrets(f func(*state.State, string, *json.RawMessage, []string) error) (restore func()) {
+	old := configSetSnapConfigWithSecrets
+	configSetSnapConfigWithSecrets = f
+	return func() {
+		configSetSnapConfigWithSecrets = old
+	}
+}
+
+func MockConfigSnapSecrets(f func(*state.State, string) (map[string]*json.RawMessage, error)) (restore func()) {
+	old := configSnapSecrets
+	configSnapSecrets = f
+	return func() {
+		configSnapSecrets = old
+	}
+}
+
 // For testing only
 func (mgr *SnapshotManager) SetLastForgetExpiredSnapshotTime(t time.Time) {
 	mgr.lastForgetExpiredSnapshotTime = t
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"gopkg.in/tomb.v2"
@@ -38,16 +39,18 @@ import (
 )
 
 var (
-	osRemove             = os.Remove
-	snapstateCurrentInfo = snapstate.CurrentInfo
-	configGetSnapConfig  = config.GetSnapConfig
-	configSetSnapConfig  = config.SetSnapConfig
-	backendOpen          = backend.Open
-	backendSave          = backend.Save
-	backendRestore       = (*backend.Reader).Restore // TODO: look into using an interface instead
-	backendCheck         = (*backend.Reader).Check
-	backendRevert        = (*backend.RestoreState).Revert // ditto
-	backendCleanup       = (*backend.RestoreState).Cleanup
+	osRemove                       = os.Remove
+	snapstateCurrentInfo           = snapstate.CurrentInfo
+	configGetSnapConfig            = config.GetSnapConfig
+	configSetSnapConfig            = config.SetSnapConfig
+	configSetSnapConfigWithSecrets = config.SetSnapConfigWithSecrets
+	configSnapSecrets              = config.SnapSecrets
+	backendOpen                    = backend.Open
+	backendSave                    = backend.Save
+	backendRestore                 = (*backend.Reader).Restore // TODO: look into using an interface instead
+	backendCheck                   = (*backend.Reader).Check
+	backendRevert                  = (*backend.RestoreState).Revert // ditto
+	backendCleanup                 = (*backend.RestoreState).Cleanup
 
 	autoExpirationInterval = time.Hour * 24 // interval between forgetExpiredSnapshots runs as part of Ensure()
 )
@@ -154,6 +157,8 @@ type snapshotSetup struct {
 	Filename string        `json:"filename,omitempty"`
 	Current  snap.Revision `json:"current"`
 	Auto     bool          `json:"auto,omitempty"`
+
+	IncludeSecrets bool `json:"include-secrets,omitempty"`
 }
 
 func filename(setID uint64, si *snap.Info) string {
@@ -168,17 +173,17 @@ func filename(setID uint64, si *snap.Info) string {
 
 // prepareSave does all the steps of doSave that require the state lock;
 // it has no real significance beyond making the lock handling simpler
-func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg map[string]interface{}, err error) {
+func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg map[string]interface{}, secretConf []string, err error) {
 	st := task.State()
 	st.Lock()
 	defer st.Unlock()
 
 	if err := task.Get("snapshot-setup", &snapshot); err != nil {
-		return nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
+		return nil, nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
 	}
 	cur, err = snapstateCurrentInfo(st, snapshot.Snap)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	// updating snapshot-setup with the filename, for use in undo
 	snapshot.Filename = filename(snapshot.SetID, cur)
@@ -186,34 +191,53 @@ func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg
 
 	rawCfg, err := configGetSnapConfig(st, snapshot.Snap)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	if rawCfg != nil {
 		if err := json.Unmarshal(*rawCfg, &cfg); err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 	}
+	if snapshot.IncludeSecrets {
+		secrets, err := configSnapSecrets(st, snapshot.Snap)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		for k, v := range secrets {
+			var value interface{}
+			if err := json.Unmarshal(*v, &value); err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if cfg == nil {
+				cfg = make(map[string]interface{}, len(secrets))
+			}
+			cfg[k] = value
+			secretConf = append(secretConf, k)
+		}
+		sort.Strings(secretConf)
+	}
 
 	// this should be done last because of it modifies the state and the caller needs to undo this if other operation fails.
 	if snapshot.Auto {
 		expiration, err := AutomaticSnapshotExpiration(st)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 		if err := saveExpiration(st, snapshot.SetID, time.Now().Add(expiration)); err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 	}
 
-	return snapshot, cur, cfg, nil
+	return snapshot, cur, cfg, secretConf, nil
 }
 
 func doSave(task *state.Task, tomb *tomb.Tomb) error {
-	snapshot, cur, cfg, err := prepareSave(task)
+	snapshot, cur, cfg, secretConf, err := prepareSave(task)
 	if err != nil {
 		return err
 	}
-	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, &backend.Flags{Auto: snapshot.Auto})
+	flags := &backend.Flags{Auto: snapshot.Auto, SecretConf: secretConf}
+	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, flags)
 	if err != nil {
 		st := task.State()
 		st.Lock()
@@ -283,7 +307,9 @@ func doRestore(task *state.Task, tomb *tomb.Tomb) error {
 	st.Lock()
 	defer st.Unlock()
 
-	if err := configSetSnapConfig(st, snapshot.Snap, (*json.RawMessage)(&buf)); err != nil {
+	// the options that were secret are made secret again, even if
+	// the snap was removed meanwhile
+	if err := configSetSnapConfigWithSecrets(st, snapshot.Snap, (*json.RawMessage)(&buf), reader.SecretConf); err != nil {
 		backendRevert(restoreState)
 		return fmt.Errorf("cannot set snap config: %v", err)
 	}
@@ -33,6 +33,7 @@ import (
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
@@ -268,6 +269,10 @@ func (snapshotSuite) TestDoSave(c *check.C) {
 		c.Check(flags.Auto, check.Equals, false)
 		return nil, nil
 	})()
+	defer snapshotstate.MockConfigSnapSecrets(func(*state.State, string) (map[string]*json.RawMessage, error) {
+		c.Fatalf("secrets should not be read")
+		return nil, nil
+	})()
 
 	st := state.New(nil)
 	st.Lock()
@@ -282,6 +287,119 @@ func (snapshotSuite) TestDoSave(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (snapshotSuite) TestDoSaveIncludeSecrets(c *check.C) {
+	snapInfo := snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "a-snap",
+			Revision: snap.R(-1),
+		},
+		Version: "1.33",
+	}
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snapInfo, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(_ *state.State, snapname string) (*json.RawMessage, error) {
+		buf := json.RawMessage(`{"hello": "there"}`)
+		return &buf, nil
+	})()
+	defer snapshotstate.MockConfigSnapSecrets(func(_ *state.State, snapname string) (map[string]*json.RawMessage, error) {
+		c.Check(snapname, check.Equals, "a-snap")
+		buf := json.RawMessage(`"s3cr3t"`)
+		return map[string]*json.RawMessage{"token": &buf}, nil
+	})()
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+		c.Check(cfg, check.DeepEquals, map[string]interface{}{"hello": "there", "token": "s3cr3t"})
+		c.Check(flags.SecretConf, check.DeepEquals, []string{"token"})
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":          42,
+		"snap":            "a-snap",
+		"include-secrets": true,
+	})
+	st.Unlock()
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+}
+
+func (snapshotSuite) TestRestoreSecretsAfterReinstall(c *check.C) {
+	snapInfo := snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "a-snap",
+			Revision: snap.R(-1),
+		},
+		Version: "1.33",
+	}
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snapInfo, nil
+	})()
+	var saved client.Snapshot
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+		saved = client.Snapshot{Conf: cfg, SecretConf: flags.SecretConf}
+		return &saved, nil
+	})()
+	defer snapshotstate.MockBackendOpen(func(string) (*backend.Reader, error) {
+		return &backend.Reader{Snapshot: saved}, nil
+	})()
+	defer snapshotstate.MockBackendRestore(func(*backend.Reader, context.Context, snap.Revision, []string, backend.Logf) (*backend.RestoreState, error) {
+		return &backend.RestoreState{}, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	tr := config.NewTransaction(st)
+	c.Assert(tr.Set("a-snap", "hello", "there"), check.IsNil)
+	c.Assert(tr.Set("a-snap", "token", "s3cr3t"), check.IsNil)
+	c.Assert(tr.MarkSecret("a-snap", "token"), check.IsNil)
+	c.Assert(tr.Commit(), check.IsNil)
+
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":          42,
+		"snap":            "a-snap",
+		"include-secrets": true,
+	})
+	st.Unlock()
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	st.Lock()
+	c.Assert(err, check.IsNil)
+	c.Check(saved.SecretConf, check.DeepEquals, []string{"token"})
+
+	// the snap is removed, and installed again
+	c.Assert(config.DeleteSnapConfig(st, "a-snap"), check.IsNil)
+
+	task = st.NewTask("restore-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"snap":     "a-snap",
+		"filename": "/some/file.zip",
+	})
+	st.Unlock()
+	err = snapshotstate.DoRestore(task, &tomb.Tomb{})
+	st.Lock()
+	c.Assert(err, check.IsNil)
+
+	// the secret is not in the public configuration
+	raw, err := config.GetSnapConfig(st, "a-snap")
+	c.Assert(err, check.IsNil)
+	c.Check(string(*raw), check.Equals, `{"hello":"there"}`)
+	secrets, err := config.SnapSecrets(st, "a-snap")
+	c.Assert(err, check.IsNil)
+	c.Assert(secrets, check.HasLen, 1)
+	c.Check(string(*secrets["token"]), check.Equals, `"s3cr3t"`)
+
+	tr = config.NewTransaction(st)
+	c.Check(tr.IsSecret("a-snap", "token"), check.Equals, true)
+	var token string
+	c.Assert(tr.Get("a-snap", "token", &token), check.IsNil)
+	c.Check(token, check.Equals, "s3cr3t")
+}
+
 func (snapshotSuite) TestDoSaveFailsWithNoSnap(c *check.C) {
 	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) {
 		return nil, errors.New("bzzt")
@@ -497,6 +615,10 @@ func (rs *readerSuite) SetUpTest(c *check.C) {
 			rs.calls = append(rs.calls, "set config")
 			return nil
 		}),
+		snapshotstate.MockConfigSetSnapConfigWithSecrets(func(*state.State, string, *json.RawMessage, []string) error {
+			rs.calls = append(rs.calls, "set config")
+			return nil
+		}),
 		snapshotstate.MockBackendOpen(func(string) (*backend.Reader, error) {
 			rs.calls = append(rs.calls, "open")
 			return &backend.Reader{}, nil
@@ -535,7 +657,10 @@ func (rs *readerSuite) TestDoRestore(c *check.C) {
 		rs.calls = append(rs.calls, "open")
 		c.Check(filename, check.Equals, "/some/file.zip")
 		return &backend.Reader{
-			Snapshot: client.Snapshot{Conf: map[string]interface{}{"hello": "there"}},
+			Snapshot: client.Snapshot{
+				Conf:       map[string]interface{}{"hello": "there", "token": "s3cr3t"},
+				SecretConf: []string{"token"},
+			},
 		}, nil
 	})()
 	defer snapshotstate.MockBackendRestore(func(_ *backend.Reader, _ context.Context, _ snap.Revision, users []string, _ backend.Logf) (*backend.RestoreState, error) {
@@ -543,10 +668,11 @@ func (rs *readerSuite) TestDoRestore(c *check.C) {
 		c.Check(users, check.DeepEquals, []string{"a-user", "b-user"})
 		return &backend.RestoreState{}, nil
 	})()
-	defer snapshotstate.MockConfigSetSnapConfig(func(_ *state.State, snapname string, conf *json.RawMessage) error {
+	defer snapshotstate.MockConfigSetSnapConfigWithSecrets(func(_ *state.State, snapname string, conf *json.RawMessage, secretKeys []string) error {
 		rs.calls = append(rs.calls, "set config")
 		c.Check(snapname, check.Equals, "a-snap")
-		c.Check(string(*conf), check.Equals, `{"hello":"there"}`)
+		c.Check(string(*conf), check.Equals, `{"hello":"there","token":"s3cr3t"}`)
+		c.Check(secretKeys, check.DeepEquals, []string{"token"})
 		return nil
 	})()
 
@@ -632,7 +758,7 @@ func (rs *readerSuite) TestDoRestoreFailsOnRestoreError(c *check.C) {
 }
 
 func (rs *readerSuite) TestDoRestoreFailsAndRevertsOnSetConfigError(c *check.C) {
-	defer snapshotstate.MockConfigSetSnapConfig(func(*state.State, string, *json.RawMessage) error {
+	defer snapshotstate.MockConfigSetSnapConfigWithSecrets(func(*state.State, string, *json.RawMessage, []string) error {
 		rs.calls = append(rs.calls, "set config")
 		return errors.New("bzzt")
 	})()
@@ -276,9 +276,20 @@ func checkSnapshotTaskConflict(st *state.State, setID uint64, conflictingKinds .
 // Note that the state must be locked by the caller.
 var List = backend.List
 
+// SaveOptions holds optional parameters for Save.
+type SaveOptions struct {
+	// IncludeSecrets makes the snapshots carry the secret configuration
+	// options of the snaps, which are left out otherwise.
+	IncludeSecrets bool
+}
+
 // Save creates a taskset for taking snapshots of snaps' data.
 // Note that the state must be locked by the caller.
-func Save(st *state.State, instanceNames []string, users []string) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+func Save(st *state.State, instanceNames []string, users []string, opts *SaveOptions) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+	if opts == nil {
+		opts = &SaveOptions{}
+	}
+
 	if len(instanceNames) == 0 {
 		instanceNames, err = allActiveSnapNames(st)
 		if err != nil {
@@ -302,9 +313,10 @@ func Save(st *state.State, instanceNames []string, users []string) (setID uint64
 		desc := fmt.Sprintf("Save data of snap %q in snapshot set #%d", name, setID)
 		task := st.NewTask("save-snapshot", desc)
 		snapshot := snapshotSetup{
-			SetID: setID,
-			Snap:  name,
-			Users: users,
+			SetID:          setID,
+			Snap:           name,
+			Users:          users,
+			IncludeSecrets: opts.IncludeSecrets,
 		}
 		task.Set("snapshot-setup", &snapshot)
 		// Here, note that a snapshot set behaves as a unit: it either
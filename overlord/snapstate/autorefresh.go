@@ -132,7 +132,9 @@ func (m *autoRefresh) EffectiveRefreshHold() (time.Time, error) {
 func (m *autoRefresh) clearRefreshHold() {
 	tr := config.NewTransaction(m.state)
 	tr.Set("core", "refresh.hold", nil)
-	tr.Commit()
+	if err := tr.Commit(); err != nil {
+		logger.Noticef("cannot clear refresh hold: %v", err)
+	}
 }
 
 // AtSeed configures refresh policies at end of seeding.
@@ -150,7 +152,9 @@ func (m *autoRefresh) AtSeed() error {
 		// is older than X weeks/months we skip the holding?
 		now := time.Now().UTC()
 		tr.Set("core", "refresh.hold", now.Add(2*time.Hour))
-		tr.Commit()
+		if err := tr.Commit(); err != nil {
+			return err
+		}
 		m.nextRefresh = now
 	}
 	return nil
@@ -22,7 +22,9 @@ package backend
 import (
 	"os"
 
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
 )
@@ -46,6 +48,15 @@ func (b Backend) CopySnapData(newSnap, oldSnap *snap.Info, meter progress.Meter)
 		return err
 	}
 
+	// on devices with an ubuntu-save partition also make sure snaps asking
+	// for it have a data directory there, it is kept across removals and
+	// reinstalls of the snap unless purged
+	if newSnap.SaveData && osutil.IsDirectory(dirs.SnapSaveDir) {
+		if err := os.MkdirAll(newSnap.CommonDataSaveDir(), 0755); err != nil {
+			return err
+		}
+	}
+
 	if oldSnap == nil {
 		return os.MkdirAll(newSnap.DataDir(), 0755)
 	} else if oldSnap.Revision == newSnap.Revision {
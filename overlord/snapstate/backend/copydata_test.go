@@ -264,6 +264,52 @@ func (s *copydataSuite) TestCopyDataDoUndoFirstInstall(c *C) {
 	c.Check(os.IsNotExist(err), Equals, true)
 }
 
+func (s *copydataSuite) TestCopyDataDoUndoFirstInstallWithSave(c *C) {
+	c.Assert(os.MkdirAll(dirs.SnapSaveDir, 0755), IsNil)
+	v1 := snaptest.MockSnap(c, helloYaml1+"save-data: true\n", &snap.SideInfo{Revision: snap.R(10)})
+	// the data kept from before a reinstall of ubuntu-data
+	c.Assert(os.MkdirAll(v1.CommonDataSaveDir(), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(v1.CommonDataSaveDir(), "creds"), []byte("secret"), 0600), IsNil)
+
+	// first install
+	err := s.be.CopySnapData(v1, nil, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(v1.CommonDataDir(), testutil.FilePresent)
+
+	// the data on ubuntu-save survives undoing it
+	err = s.be.UndoCopySnapData(v1, nil, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(v1.CommonDataDir(), testutil.FileAbsent)
+	c.Check(filepath.Join(v1.CommonDataSaveDir(), "creds"), testutil.FileEquals, "secret")
+}
+
+func (s *copydataSuite) TestCopyDataSaveDataCreated(c *C) {
+	c.Assert(os.MkdirAll(dirs.SnapSaveDir, 0755), IsNil)
+	v1 := snaptest.MockSnap(c, helloYaml1+"save-data: true\n", &snap.SideInfo{Revision: snap.R(10)})
+
+	err := s.be.CopySnapData(v1, nil, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(v1.CommonDataSaveDir(), testutil.FilePresent)
+}
+
+func (s *copydataSuite) TestCopyDataSaveDataNotAskedFor(c *C) {
+	c.Assert(os.MkdirAll(dirs.SnapSaveDir, 0755), IsNil)
+	v1 := snaptest.MockSnap(c, helloYaml1, &snap.SideInfo{Revision: snap.R(10)})
+
+	err := s.be.CopySnapData(v1, nil, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(v1.CommonDataSaveDir(), testutil.FileAbsent)
+}
+
+func (s *copydataSuite) TestCopyDataNoSave(c *C) {
+	v1 := snaptest.MockSnap(c, helloYaml1+"save-data: true\n", &snap.SideInfo{Revision: snap.R(10)})
+
+	err := s.be.CopySnapData(v1, nil, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(v1.CommonDataSaveDir(), testutil.FileAbsent)
+	c.Check(dirs.SnapSaveDir, testutil.FileAbsent)
+}
+
 func (s *copydataSuite) TestCopyDataDoABA(c *C) {
 	v1 := snaptest.MockSnap(c, helloYaml1, &snap.SideInfo{Revision: snap.R(10)})
 	s.populateData(c, snap.R(10))
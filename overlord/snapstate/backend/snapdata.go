@@ -52,6 +52,12 @@ func (b Backend) RemoveSnapCommonData(snap *snap.Info) error {
 	return removeDirs(dirs)
 }
 
+// RemoveSnapSaveData removes the data of the given snap kept on the
+// ubuntu-save partition.
+func (b Backend) RemoveSnapSaveData(snap *snap.Info) error {
+	return os.RemoveAll(snap.CommonDataSaveDir())
+}
+
 // RemoveSnapDataDir removes base snap data directory
 func (b Backend) RemoveSnapDataDir(info *snap.Info, hasOtherInstances bool) error {
 	if info.InstanceKey != "" {
@@ -77,6 +77,10 @@ func (s *snapdataSuite) TestRemoveSnapCommonData(c *C) {
 	err = os.MkdirAll(varCommonData, 0755)
 	c.Assert(err, IsNil)
 
+	saveData := filepath.Join(dirs.SnapSaveDir, "snap/hello")
+	err = os.MkdirAll(saveData, 0755)
+	c.Assert(err, IsNil)
+
 	info := snaptest.MockSnap(c, helloYaml1, &snap.SideInfo{Revision: snap.R(10)})
 
 	err = s.be.RemoveSnapCommonData(info)
@@ -85,6 +89,21 @@ func (s *snapdataSuite) TestRemoveSnapCommonData(c *C) {
 	c.Assert(osutil.FileExists(filepath.Dir(homeCommonData)), Equals, true)
 	c.Assert(osutil.FileExists(varCommonData), Equals, false)
 	c.Assert(osutil.FileExists(filepath.Dir(varCommonData)), Equals, true)
+	// the data on ubuntu-save is kept
+	c.Assert(osutil.IsDirectory(saveData), Equals, true)
+}
+
+func (s *snapdataSuite) TestRemoveSnapSaveData(c *C) {
+	saveData := filepath.Join(dirs.SnapSaveDir, "snap/hello")
+	err := os.MkdirAll(saveData, 0755)
+	c.Assert(err, IsNil)
+
+	info := snaptest.MockSnap(c, helloYaml1, &snap.SideInfo{Revision: snap.R(10)})
+
+	err = s.be.RemoveSnapSaveData(info)
+	c.Assert(err, IsNil)
+	c.Assert(osutil.FileExists(saveData), Equals, false)
+	c.Assert(osutil.IsDirectory(dirs.SnapSaveDir), Equals, true)
 }
 
 func (s *snapdataSuite) TestRemoveSnapDataDir(c *C) {
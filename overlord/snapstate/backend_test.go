@@ -1017,6 +1017,14 @@ func (f *fakeSnappyBackend) RemoveSnapCommonData(info *snap.Info) error {
 	return nil
 }
 
+func (f *fakeSnappyBackend) RemoveSnapSaveData(info *snap.Info) error {
+	f.appendOp(&fakeOp{
+		op:   "remove-snap-save-data",
+		path: info.MountDir(),
+	})
+	return nil
+}
+
 func (f *fakeSnappyBackend) RemoveSnapDataDir(info *snap.Info, otherInstances bool) error {
 	f.ops = append(f.ops, fakeOp{
 		op:             "remove-snap-data-dir",
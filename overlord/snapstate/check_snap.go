@@ -27,6 +27,7 @@ import (
 
 	"github.com/snapcore/snapd/arch"
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
@@ -601,6 +602,22 @@ func validateSystemUsernames(si *snap.Info) error {
 	return nil
 }
 
+var bootCheckBootChainsForKernel = boot.CheckBootChainsForKernel
+
+// checkKernelBootChains checks that the encryption keys of the device can be
+// resealed once the kernel is installed, so that a refresh to a kernel that
+// would leave the device prompting for the recovery key is refused early.
+func checkKernelBootChains(st *state.State, snapInfo, curInfo *snap.Info, snapf snap.Container, flags Flags, deviceCtx DeviceContext) error {
+	if snapInfo.Type() != snap.TypeKernel || deviceCtx == nil {
+		// not a relevant check
+		return nil
+	}
+	if !deviceCtx.RunMode() || deviceCtx.Model().Grade() == asserts.ModelGradeUnset {
+		return nil
+	}
+	return bootCheckBootChainsForKernel(snapInfo, snapf, deviceCtx.Model())
+}
+
 func checkAndCreateSystemUsernames(si *snap.Info) error {
 	// No need to check support if no system-usernames
 	if len(si.SystemUsernames) == 0 {
@@ -659,4 +676,5 @@ func init() {
 	AddCheckSnapCallback(checkGadgetOrKernel)
 	AddCheckSnapCallback(checkBases)
 	AddCheckSnapCallback(checkEpochs)
+	AddCheckSnapCallback(checkKernelBootChains)
 }
@@ -26,6 +26,7 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/arch"
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/state"
@@ -621,6 +622,69 @@ version: 2
 	c.Check(err, IsNil)
 }
 
+func (s *checkSnapSuite) TestCheckSnapKernelUpdateBootChains(c *C) {
+	reset := release.MockOnClassic(false)
+	defer reset()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	si := &snap.SideInfo{RealName: "kernel", Revision: snap.R(2), SnapID: "kernel-id"}
+	snaptest.MockSnap(c, `
+name: kernel
+type: kernel
+version: 1
+`, si)
+	snapstate.Set(st, "kernel", &snapstate.SnapState{
+		SnapType: "kernel",
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+
+	const yaml = `name: kernel
+type: kernel
+version: 2
+`
+
+	info, err := snap.InfoFromSnapYaml([]byte(yaml))
+	c.Assert(err, IsNil)
+	info.SnapID = "kernel-id"
+	info.Revision = snap.R(3)
+
+	container := emptyContainer(c)
+	var openSnapFile = func(path string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
+		return info, container, nil
+	}
+	restore := snapstate.MockOpenSnapFile(openSnapFile)
+	defer restore()
+
+	checkCalls := 0
+	restore = snapstate.MockBootCheckBootChainsForKernel(func(kernel snap.PlaceInfo, kernelFile snap.Container, model *asserts.Model) error {
+		checkCalls++
+		c.Check(kernel.Filename(), Equals, "kernel_3.snap")
+		c.Check(kernelFile, Equals, container)
+		c.Check(model.Model(), Equals, "baz-3000")
+		return errors.New("cannot find expected boot asset bootx64.efi in modeenv")
+	})
+	defer restore()
+
+	// not a UC20 model, no boot chains
+	st.Unlock()
+	err = snapstate.CheckSnap(st, "snap-path", "kernel", nil, nil, snapstate.Flags{}, s.deviceCtx)
+	st.Lock()
+	c.Check(err, IsNil)
+	c.Check(checkCalls, Equals, 0)
+
+	deviceCtx := &snapstatetest.TrivialDeviceContext{DeviceModel: MakeModel20("gadget", nil)}
+	st.Unlock()
+	err = snapstate.CheckSnap(st, "snap-path", "kernel", nil, nil, snapstate.Flags{}, deviceCtx)
+	st.Lock()
+	c.Check(err, ErrorMatches, "cannot find expected boot asset bootx64.efi in modeenv")
+	c.Check(checkCalls, Equals, 1)
+}
+
 func (s *checkSnapSuite) TestCheckSnapKernelAdditionProhibitedBySnapID(c *C) {
 	reset := release.MockOnClassic(false)
 	defer reset()
@@ -23,6 +23,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
@@ -40,6 +41,12 @@ func MockSnapReadInfo(mock func(name string, si *snap.SideInfo) (*snap.Info, err
 	return func() { snapReadInfo = old }
 }
 
+func MockBootCheckBootChainsForKernel(mock func(kernel snap.PlaceInfo, kernelFile snap.Container, model *asserts.Model) error) (restore func()) {
+	old := bootCheckBootChainsForKernel
+	bootCheckBootChainsForKernel = mock
+	return func() { bootCheckBootChainsForKernel = old }
+}
+
 func MockMountPollInterval(intv time.Duration) (restore func()) {
 	old := mountPollInterval
 	mountPollInterval = intv
@@ -19,6 +19,19 @@
 
 package snapstate
 
+// TransactionType specifies how a multi-snap operation is undone when
+// it fails for some of the snaps.
+type TransactionType string
+
+const (
+	// TransactionPerSnap undoes only the operation on the snaps for
+	// which it failed, the default.
+	TransactionPerSnap TransactionType = "per-snap"
+	// TransactionAllSnaps undoes the operation on all the snaps when
+	// it fails for any of them.
+	TransactionAllSnaps TransactionType = "all-snaps"
+)
+
 // Flags are used to pass additional flags to operations and to keep track of snap modes.
 type Flags struct {
 	// DevMode switches confinement to non-enforcing mode.
@@ -68,6 +81,10 @@ type Flags struct {
 
 	// RequireTypeBase is set to mark that a snap needs to be of type: base, otherwise installation fails.
 	RequireTypeBase bool `json:"require-base-type,omitempty"`
+
+	// Transaction is set to TransactionAllSnaps to have a multi-snap
+	// refresh either succeed or be undone for all the snaps.
+	Transaction TransactionType `json:"transaction,omitempty"`
 }
 
 // DevModeAllowed returns whether a snap can be installed with devmode confinement (either set or overridden)
@@ -80,5 +97,6 @@ func (f Flags) ForSnapSetup() Flags {
 	f.SkipConfigure = false
 	f.NoReRefresh = false
 	f.RequireTypeBase = false
+	f.Transaction = ""
 	return f
 }
@@ -1904,6 +1904,16 @@ func (m *SnapManager) doClearSnapData(t *state.Task, _ *tomb.Tomb) error {
 		st.Lock()
 		defer st.Unlock()
 
+		var purge bool
+		if err := t.Get("purge", &purge); err != nil && err != state.ErrNoState {
+			return err
+		}
+		if purge {
+			if err := m.backend.RemoveSnapSaveData(info); err != nil {
+				return err
+			}
+		}
+
 		otherInstances, err := hasOtherInstances(st, snapsup.InstanceName())
 		if err != nil {
 			return err
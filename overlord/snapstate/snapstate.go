@@ -1026,8 +1026,9 @@ func updateManyFiltered(ctx context.Context, st *state.State, names []string, us
 	if ValidateRefreshes != nil && len(updates) != 0 {
 		updates, err = ValidateRefreshes(st, updates, ignoreValidation, userID, deviceCtx)
 		if err != nil {
-			// not doing "refresh all" report the error
-			if len(names) != 0 {
+			// not doing "refresh all" or refreshing all the snaps
+			// together, report the error
+			if len(names) != 0 || flags.Transaction == TransactionAllSnaps {
 				return nil, nil, err
 			}
 			// doing "refresh all", log the problems
@@ -1061,7 +1062,9 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 
 	tasksets := make([]*state.TaskSet, 0, len(updates)+2) // 1 for auto-aliases, 1 for re-refresh
 
-	refreshAll := len(names) == 0
+	// when refreshing all the snaps together a failure for any of
+	// them must be reported, not skipped
+	refreshAll := len(names) == 0 && globalFlags.Transaction != TransactionAllSnaps
 	var nameSet map[string]bool
 	if len(names) != 0 {
 		nameSet = make(map[string]bool, len(names))
@@ -1070,6 +1073,20 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 		}
 	}
 
+	// all the tasks of a transactional refresh go into the same lane
+	// so that any failure undoes the refresh of all the snaps
+	var transactionLane int
+	if globalFlags.Transaction == TransactionAllSnaps {
+		transactionLane = st.NewLane()
+	}
+	joinLane := func(ts *state.TaskSet) {
+		if transactionLane != 0 {
+			ts.JoinLane(transactionLane)
+		} else {
+			ts.JoinLane(st.NewLane())
+		}
+	}
+
 	newAutoAliases, mustPruneAutoAliases, transferTargets, err := autoAliasesUpdate(st, names, updates)
 	if err != nil {
 		return nil, nil, err
@@ -1088,6 +1105,9 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 		if err != nil {
 			return nil, nil, err
 		}
+		if transactionLane != 0 {
+			pruningAutoAliasesTs.JoinLane(transactionLane)
+		}
 		tasksets = append(tasksets, pruningAutoAliasesTs)
 	}
 
@@ -1164,7 +1184,7 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 			}
 			return nil, nil, err
 		}
-		ts.JoinLane(st.NewLane())
+		joinLane(ts)
 
 		// because of the sorting of updates we fill prereqs
 		// first (if branch) and only then use it to setup
@@ -1194,6 +1214,9 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 		if err != nil {
 			return nil, nil, err
 		}
+		if transactionLane != 0 {
+			addAutoAliasesTs.JoinLane(transactionLane)
+		}
 		tasksets = append(tasksets, addAutoAliasesTs)
 	}
 
@@ -1883,7 +1906,8 @@ func canRemove(st *state.State, si *snap.Info, snapst *SnapState, removeAll bool
 
 // RemoveFlags are used to pass additional flags to the Remove operation.
 type RemoveFlags struct {
-	// Remove the snap without creating snapshot data
+	// Remove the snap without creating snapshot data, and with its data
+	// on the ubuntu-save partition
 	Purge bool
 }
 
@@ -2054,7 +2078,17 @@ func Remove(st *state.State, name string, revision snap.Revision, flags *RemoveF
 		seq := snapst.Sequence
 		for i := len(seq) - 1; i >= 0; i-- {
 			si := seq[i]
-			addNext(removeInactiveRevision(st, name, info.SnapID, si.Revision))
+			ts := removeInactiveRevision(st, name, info.SnapID, si.Revision)
+			if flags != nil && flags.Purge {
+				// the data kept on ubuntu-save is only removed
+				// on an explicit purge
+				for _, t := range ts.Tasks() {
+					if t.Kind() == "clear-snap" {
+						t.Set("purge", true)
+					}
+				}
+			}
+			addNext(ts)
 		}
 	} else {
 		addNext(removeInactiveRevision(st, name, info.SnapID, revision))
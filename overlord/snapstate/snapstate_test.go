@@ -1039,6 +1039,50 @@ func (s *snapmgrTestSuite) TestRemoveTasksAutoSnapshotDisabledByPurgeFlag(c *C)
 	})
 }
 
+func (s *snapmgrTestSuite) TestRemovePurgeRunThrough(c *C) {
+	si := snap.SideInfo{
+		SnapID:   "some-snap-id",
+		RealName: "some-snap",
+		Revision: snap.R(7),
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{&si},
+		Current:  si.Revision,
+		SnapType: "app",
+	})
+
+	chg := s.state.NewChange("remove", "remove a snap")
+	ts, err := snapstate.Remove(s.state, "some-snap", snap.R(0), &snapstate.RemoveFlags{Purge: true})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	defer s.se.Stop()
+	s.settle(c)
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	// the data on ubuntu-save is only removed when purging
+	c.Check(s.fakeBackend.ops.Ops(), DeepEquals, []string{
+		"auto-disconnect:Doing",
+		"remove-snap-aliases",
+		"unlink-snap",
+		"remove-profiles:Doing",
+		"remove-snap-data",
+		"remove-snap-common-data",
+		"remove-snap-save-data",
+		"remove-snap-data-dir",
+		"remove-snap-files",
+		"discard-namespace",
+		"remove-snap-dir",
+	})
+}
+
 func (s *snapmgrTestSuite) TestRemoveHookNotExecutedIfNotLastRevison(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -4524,6 +4524,143 @@ func (s *snapmgrTestSuite) TestUpdateManyWaitForBasesUC16(c *C) {
 	})
 }
 
+func (s *snapmgrTestSuite) TestUpdateManyTransactionAllSnaps(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+	snapstate.Set(s.state, "services-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "services-snap", SnapID: "services-snap-id", Revision: snap.R(2)},
+		},
+		Current:  snap.R(2),
+		SnapType: "app",
+	})
+
+	flags := &snapstate.Flags{Transaction: snapstate.TransactionAllSnaps}
+	updates, tts, err := snapstate.UpdateMany(context.Background(), s.state, []string{"some-snap", "services-snap"}, 0, flags)
+	c.Assert(err, IsNil)
+	c.Assert(tts, HasLen, 3)
+	verifyLastTasksetIsReRefresh(c, tts)
+	c.Check(updates, HasLen, 2)
+
+	// all the tasks are in the same lane
+	for _, ts := range tts[:2] {
+		for _, t := range ts.Tasks() {
+			c.Assert(t.Lanes(), DeepEquals, []int{1})
+		}
+	}
+
+	// the transaction is not recorded in the snap setup
+	snapsup, err := snapstate.TaskSnapSetup(tts[0].Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.Flags.Transaction, Equals, snapstate.TransactionType(""))
+
+	// but it is for the re-refresh
+	var rerefreshFlags snapstate.Flags
+	c.Assert(tts[2].Tasks()[0].Get("rerefresh-setup", &rerefreshFlags), IsNil)
+	c.Check(rerefreshFlags.Transaction, Equals, snapstate.TransactionAllSnaps)
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyTransactionAllSnapsUndoRunThrough(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+	snapstate.Set(s.state, "services-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "services-snap", SnapID: "services-snap-id", Revision: snap.R(2)},
+		},
+		Current:  snap.R(2),
+		SnapType: "app",
+	})
+
+	chg := s.state.NewChange("refresh", "refresh some snaps")
+	flags := &snapstate.Flags{Transaction: snapstate.TransactionAllSnaps}
+	_, tts, err := snapstate.UpdateMany(context.Background(), s.state, []string{"some-snap", "services-snap"}, 0, flags)
+	c.Assert(err, IsNil)
+	for _, ts := range tts {
+		chg.AddAll(ts)
+	}
+
+	// make the refresh of only one of the snaps fail once it is done
+	refreshTs := tts[0]
+	last := lastWithLane(refreshTs.Tasks())
+	c.Assert(last, NotNil)
+	terr := s.state.NewTask("error-trigger", "provoking total undo")
+	terr.WaitFor(last)
+	terr.JoinLane(last.Lanes()[0])
+	chg.AddTask(terr)
+
+	s.state.Unlock()
+	defer s.se.Stop()
+	s.settle(c)
+	s.state.Lock()
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+
+	// the refresh of both snaps was undone
+	for _, ts := range tts[:2] {
+		for _, t := range ts.Tasks() {
+			if t.Kind() == "link-snap" {
+				c.Check(t.Status(), Equals, state.UndoneStatus)
+			}
+		}
+	}
+	for name, rev := range map[string]snap.Revision{"some-snap": snap.R(1), "services-snap": snap.R(2)} {
+		var snapst snapstate.SnapState
+		c.Assert(snapstate.Get(s.state, name, &snapst), IsNil)
+		c.Check(snapst.Current, Equals, rev, Commentf(name))
+		c.Check(snapst.Sequence, HasLen, 1, Commentf(name))
+	}
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyTransactionAllSnapsReportsErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	// a conflicting change
+	chg := s.state.NewChange("other", "...")
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: &snap.SideInfo{RealName: "some-snap"}})
+	chg.AddTask(t)
+
+	// refreshing all snaps skips the conflicting snap
+	updates, _, err := snapstate.UpdateMany(context.Background(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+
+	// unless they are refreshed together
+	flags := &snapstate.Flags{Transaction: snapstate.TransactionAllSnaps}
+	_, _, err = snapstate.UpdateMany(context.Background(), s.state, nil, 0, flags)
+	c.Check(err, FitsTypeOf, &snapstate.ChangeConflictError{})
+}
+
 func (s *snapmgrTestSuite) TestUpdateManyWaitForBasesUC18(c *C) {
 	r := snapstatetest.MockDeviceModel(ModelWithBase("core18"))
 	defer r()
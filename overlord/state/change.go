@@ -25,8 +25,12 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/snapcore/snapd/metrics"
 )
 
+var changesTotal = metrics.NewCounterVec("snapd_changes", "Changes that became ready, by change kind and status.", "kind", "status")
+
 // Status is used for status values for changes and tasks.
 type Status int
 
@@ -128,6 +132,7 @@ type Change struct {
 
 	spawnTime time.Time
 	readyTime time.Time
+	notBefore time.Time
 }
 
 type byReadyTime []*Change
@@ -161,6 +166,7 @@ type marshalledChange struct {
 
 	SpawnTime time.Time  `json:"spawn-time"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
+	NotBefore *time.Time `json:"not-before,omitempty"`
 }
 
 // MarshalJSON makes Change a json.Marshaller
@@ -170,6 +176,10 @@ func (c *Change) MarshalJSON() ([]byte, error) {
 	if !c.readyTime.IsZero() {
 		readyTime = &c.readyTime
 	}
+	var notBefore *time.Time
+	if !c.notBefore.IsZero() {
+		notBefore = &c.notBefore
+	}
 	return json.Marshal(marshalledChange{
 		ID:      c.id,
 		Kind:    c.kind,
@@ -182,6 +192,7 @@ func (c *Change) MarshalJSON() ([]byte, error) {
 
 		SpawnTime: c.spawnTime,
 		ReadyTime: readyTime,
+		NotBefore: notBefore,
 	})
 }
 
@@ -212,6 +223,9 @@ func (c *Change) UnmarshalJSON(data []byte) error {
 	if unmarshalled.ReadyTime != nil {
 		c.readyTime = *unmarshalled.ReadyTime
 	}
+	if unmarshalled.NotBefore != nil {
+		c.notBefore = *unmarshalled.NotBefore
+	}
 	return nil
 }
 
@@ -315,6 +329,7 @@ func (c *Change) markReady() {
 	}
 	if c.readyTime.IsZero() {
 		c.readyTime = timeNow()
+		changesTotal.Inc(c.kind, c.Status().String())
 	}
 }
 
@@ -394,6 +409,28 @@ func (c *Change) ReadyTime() time.Time {
 	return c.readyTime
 }
 
+// SetNotBefore schedules the change to start no earlier than when. The
+// tasks of the change are not run before that time, but the change can
+// be aborted in the meantime. The zero time removes the constraint.
+func (c *Change) SetNotBefore(when time.Time) {
+	c.state.writing()
+	c.notBefore = when
+	if !when.IsZero() {
+		d := when.Sub(timeNow())
+		if d < 0 {
+			d = 0
+		}
+		c.state.EnsureBefore(d)
+	}
+}
+
+// NotBefore returns the time before which the change must not start,
+// if any.
+func (c *Change) NotBefore() time.Time {
+	c.state.reading()
+	return c.notBefore
+}
+
 // changeError holds a set of task errors.
 type changeError struct {
 	errors []taskError
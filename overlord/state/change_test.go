@@ -20,12 +20,14 @@
 package state_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/snapcore/snapd/metrics/metricstest"
 	"github.com/snapcore/snapd/overlord/state"
 
 	. "gopkg.in/check.v1"
@@ -45,6 +47,33 @@ func (cs *changeSuite) TestNewChange(c *C) {
 	c.Check(chg.Summary(), Equals, "summary...")
 }
 
+func (cs *changeSuite) TestNotBefore(c *C) {
+	b := &fakeStateBackend{ensureBefore: time.Hour}
+	st := state.New(b)
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now()
+	restore := state.MockTime(now)
+	defer restore()
+
+	chg := st.NewChange("install", "...")
+	c.Check(chg.NotBefore().IsZero(), Equals, true)
+
+	when := now.Add(10 * time.Minute)
+	chg.SetNotBefore(when)
+	c.Check(chg.NotBefore().Equal(when), Equals, true)
+	c.Check(b.ensureBefore, Equals, 10*time.Minute)
+
+	// the constraint is checkpointed
+	data, err := json.Marshal(chg)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, fmt.Sprintf(`.*"not-before":"%s".*`, when.Format(time.RFC3339Nano)))
+
+	chg.SetNotBefore(time.Time{})
+	c.Check(chg.NotBefore().IsZero(), Equals, true)
+}
+
 func (cs *changeSuite) TestReadyTime(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -67,6 +96,30 @@ func (cs *changeSuite) TestReadyTime(c *C) {
 	c.Check(t.Before(now.Add(5*time.Second)), Equals, true)
 }
 
+func (cs *changeSuite) TestReadyCountedInMetrics(c *C) {
+	const done = `snapd_changes_total{kind="metrics-test",status="Done"}`
+	const errored = `snapd_changes_total{kind="metrics-test",status="Error"}`
+	doneBefore := metricstest.Sample(c, done)
+	erroredBefore := metricstest.Sample(c, errored)
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg1 := st.NewChange("metrics-test", "...")
+	t1 := st.NewTask("download", "...")
+	chg1.AddTask(t1)
+	t1.SetStatus(state.DoneStatus)
+	// becoming ready is counted only once
+	chg1.SetStatus(state.DoneStatus)
+
+	chg2 := st.NewChange("metrics-test", "...")
+	chg2.SetStatus(state.ErrorStatus)
+
+	c.Check(metricstest.Sample(c, done), Equals, doneBefore+1)
+	c.Check(metricstest.Sample(c, errored), Equals, erroredBefore+1)
+}
+
 func (cs *changeSuite) TestStatusString(c *C) {
 	for s := state.Status(0); s < state.ErrorStatus+1; s++ {
 		c.Assert(s.String(), Matches, ".+")
@@ -32,6 +32,12 @@ import (
 	"time"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
+)
+
+var (
+	lockHeldSeconds = metrics.NewHistogramVec("snapd_state_lock_held_seconds", "Time the state lock was held for.", []float64{0.0001, 0.001, 0.01, 0.1, 1, 10})
+	stateSizeBytes  = metrics.NewGaugeVec("snapd_state_size_bytes", "Size of the state as last checkpointed.")
 )
 
 // A Backend is used by State to checkpoint on every unlock operation
@@ -98,8 +104,9 @@ const (
 // The state is persisted on every unlock operation via the StateBackend
 // it was initialized with.
 type State struct {
-	mu  sync.Mutex
-	muC int32
+	mu       sync.Mutex
+	muC      int32
+	lockedAt time.Time
 
 	lastTaskId   int
 	lastChangeId int
@@ -118,6 +125,8 @@ type State struct {
 	restarting RestartType
 	restartLck sync.Mutex
 	bootID     string
+
+	pruneCallback func(chg *Change)
 }
 
 // New returns a new empty state.
@@ -142,6 +151,7 @@ func (s *State) Modified() bool {
 func (s *State) Lock() {
 	s.mu.Lock()
 	atomic.AddInt32(&s.muC, 1)
+	s.lockedAt = time.Now()
 }
 
 func (s *State) reading() {
@@ -158,6 +168,7 @@ func (s *State) writing() {
 }
 
 func (s *State) unlock() {
+	lockHeldSeconds.Observe(time.Since(s.lockedAt).Seconds())
 	atomic.AddInt32(&s.muC, -1)
 	s.mu.Unlock()
 }
@@ -245,6 +256,7 @@ func (s *State) Unlock() {
 	for time.Since(start) <= unlockCheckpointRetryMaxTime {
 		if err = s.backend.Checkpoint(data); err == nil {
 			s.modified = false
+			stateSizeBytes.Set(float64(len(data)))
 			return
 		}
 		time.Sleep(unlockCheckpointRetryInterval)
@@ -441,6 +453,18 @@ func (s *State) tasksIn(tids []string) []*Task {
 	return res
 }
 
+// OnPrune sets a callback executed by Prune with each change it is about to
+// remove, while the change still has its tasks.
+func (s *State) OnPrune(f func(chg *Change)) {
+	s.pruneCallback = f
+}
+
+func (s *State) pruned(chg *Change) {
+	if s.pruneCallback != nil {
+		s.pruneCallback(chg)
+	}
+}
+
 // Prune does several cleanup tasks to the in-memory state:
 //
 //  * it removes changes that became ready for more than pruneWait and aborts
@@ -484,9 +508,15 @@ func (s *State) Prune(startOfOperation time.Time, pruneWait, abortWait time.Dura
 		if spawnTime.Before(startOfOperation) {
 			spawnTime = startOfOperation
 		}
+		// changes scheduled for later are only considered from
+		// the time they can start
+		if notBefore := chg.NotBefore(); notBefore.After(spawnTime) {
+			spawnTime = notBefore
+		}
 		if readyTime.IsZero() {
 			if spawnTime.Before(pruneLimit) && len(chg.Tasks()) == 0 {
 				chg.Abort()
+				s.pruned(chg)
 				delete(s.changes, chg.ID())
 			} else if spawnTime.Before(abortLimit) {
 				chg.Abort()
@@ -496,6 +526,7 @@ func (s *State) Prune(startOfOperation time.Time, pruneWait, abortWait time.Dura
 		// change old or we have too many changes
 		if readyTime.Before(pruneLimit) || readyChangesCount > maxReadyChanges {
 			s.writing()
+			s.pruned(chg)
 			for _, t := range chg.Tasks() {
 				delete(s.tasks, t.ID())
 			}
@@ -28,6 +28,7 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/metrics/metricstest"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -596,6 +597,20 @@ func (ss *stateSuite) TestCheckpointPreserveLastIds(c *C) {
 
 }
 
+func (ss *stateSuite) TestLockAndCheckpointMetrics(c *C) {
+	locks := metricstest.Sample(c, "snapd_state_lock_held_seconds_count")
+
+	b := new(fakeStateBackend)
+	st := state.New(b)
+	st.Lock()
+	st.Set("foo", "bar")
+	st.Unlock()
+
+	c.Assert(b.checkpoints, HasLen, 1)
+	c.Check(metricstest.Sample(c, "snapd_state_size_bytes"), Equals, float64(len(b.checkpoints[0])))
+	c.Check(metricstest.Sample(c, "snapd_state_lock_held_seconds_count"), Equals, locks+1)
+}
+
 func (ss *stateSuite) TestCheckpointPreserveCleanStatus(c *C) {
 	b := new(fakeStateBackend)
 	st := state.New(b)
@@ -820,6 +835,64 @@ func (ss *stateSuite) TestPruneEmptyChange(c *C) {
 	c.Assert(st.Change(chg.ID()), IsNil)
 }
 
+func (ss *stateSuite) TestPruneScheduledChange(c *C) {
+	st := state.New(&fakeStateBackend{})
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now()
+	pruneWait := 1 * time.Hour
+	abortWait := 3 * time.Hour
+
+	t := st.NewTask("foo", "...")
+	chg := st.NewChange("scheduled", "...")
+	chg.AddTask(t)
+	state.MockChangeTimes(chg, now.Add(-abortWait-time.Hour), time.Time{})
+	chg.SetNotBefore(now.Add(-time.Hour))
+
+	// not aborted as it could only start an hour ago
+	st.Prune(now.AddDate(-1, 0, 0), pruneWait, abortWait, 100)
+	c.Check(t.Status(), Equals, state.DoStatus)
+
+	chg.SetNotBefore(now.Add(-abortWait - time.Minute))
+	st.Prune(now.AddDate(-1, 0, 0), pruneWait, abortWait, 100)
+	c.Check(t.Status(), Equals, state.HoldStatus)
+}
+
+func (ss *stateSuite) TestPruneCallback(c *C) {
+	st := state.New(&fakeStateBackend{})
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now()
+	pruneWait := 1 * time.Hour
+	abortWait := 3 * time.Hour
+
+	t1 := st.NewTask("foo", "...")
+	chg1 := st.NewChange("prune", "...")
+	chg1.AddTask(t1)
+	t1.SetStatus(state.DoneStatus)
+	state.MockChangeTimes(chg1, now.Add(-pruneWait), now.Add(-pruneWait))
+
+	t2 := st.NewTask("foo", "...")
+	chg2 := st.NewChange("ready-but-recent", "...")
+	chg2.AddTask(t2)
+	t2.SetStatus(state.DoneStatus)
+
+	var pruned []string
+	st.OnPrune(func(chg *state.Change) {
+		pruned = append(pruned, chg.Kind())
+		// the change still has its tasks
+		c.Check(chg.Tasks(), HasLen, 1)
+		c.Check(st.Change(chg.ID()), Equals, chg)
+	})
+
+	st.Prune(now.AddDate(-1, 0, 0), pruneWait, abortWait, 100)
+	c.Check(pruned, DeepEquals, []string{"prune"})
+	c.Check(st.Change(chg1.ID()), IsNil)
+	c.Check(st.Change(chg2.ID()), Equals, chg2)
+}
+
 func (ss *stateSuite) TestPruneMaxChangesHappy(c *C) {
 	st := state.New(&fakeStateBackend{})
 	st.Lock()
@@ -26,8 +26,11 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 )
 
+var taskRunSeconds = metrics.NewHistogramVec("snapd_task_run_seconds", "Time spent running task handlers, by task kind and phase (do or undo).", metrics.DurationBuckets, "kind", "phase")
+
 // HandlerFunc is the type of function for the handlers
 type HandlerFunc func(task *Task, tomb *tomb.Tomb) error
 
@@ -170,6 +173,7 @@ func (r *TaskRunner) AddBlocked(pred func(t *Task, running []*Task) bool) {
 func (r *TaskRunner) run(t *Task) {
 	var handler HandlerFunc
 	var accuRuntime func(dur time.Duration)
+	var phase string
 	switch t.Status() {
 	case DoStatus:
 		t.SetStatus(DoingStatus)
@@ -177,6 +181,7 @@ func (r *TaskRunner) run(t *Task) {
 	case DoingStatus:
 		handler = r.handlerPair(t).do
 		accuRuntime = t.accumulateDoingTime
+		phase = "do"
 
 	case UndoStatus:
 		t.SetStatus(UndoingStatus)
@@ -184,6 +189,7 @@ func (r *TaskRunner) run(t *Task) {
 	case UndoingStatus:
 		handler = r.handlerPair(t).undo
 		accuRuntime = t.accumulateUndoingTime
+		phase = "undo"
 
 	default:
 		panic("internal error: attempted to run task in status " + t.Status().String())
@@ -209,6 +215,7 @@ func (r *TaskRunner) run(t *Task) {
 		r.state.Lock()
 		defer r.state.Unlock()
 		accuRuntime(t1.Sub(t0))
+		taskRunSeconds.Observe(t1.Sub(t0).Seconds(), t.Kind(), phase)
 
 		delete(r.tombs, t.ID())
 
@@ -420,6 +427,10 @@ ConsiderTasks:
 
 		// skip tasks scheduled for later and also track the earliest one
 		tWhen := t.AtTime()
+		if chg := t.Change(); chg != nil && status == DoStatus && chg.notBefore.After(tWhen) {
+			// the change itself is scheduled for later
+			tWhen = chg.notBefore
+		}
 		if !tWhen.IsZero() && ensureTime.Before(tWhen) {
 			if nextTaskTime.IsZero() || nextTaskTime.After(tWhen) {
 				nextTaskTime = tWhen
@@ -32,6 +32,7 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics/metricstest"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -404,6 +405,47 @@ func (ts *taskRunnerSuite) TestStopHandlerJustFinishing(c *C) {
 	c.Check(t.UndoingTime(), Equals, time.Duration(0))
 }
 
+func (ts *taskRunnerSuite) TestTaskRunTimeMetrics(c *C) {
+	const do = `snapd_task_run_seconds_count{kind="metrics-test",phase="do"}`
+	const undo = `snapd_task_run_seconds_count{kind="metrics-test",phase="undo"}`
+	doBefore := metricstest.Sample(c, do)
+	undoBefore := metricstest.Sample(c, undo)
+
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	r.AddHandler("metrics-test", func(t *state.Task, tb *tomb.Tomb) error {
+		return nil
+	}, func(t *state.Task, tb *tomb.Tomb) error {
+		return nil
+	})
+	r.AddHandler("fail", func(t *state.Task, tb *tomb.Tomb) error {
+		return errors.New("boom")
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("metrics-test", "...")
+	t2 := st.NewTask("fail", "...")
+	t2.WaitFor(t1)
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+	st.Unlock()
+
+	for i := 0; i < 5; i++ {
+		r.Ensure()
+		r.Wait()
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	c.Assert(t1.Status(), Equals, state.UndoneStatus)
+	c.Check(metricstest.Sample(c, do), Equals, doBefore+1)
+	c.Check(metricstest.Sample(c, undo), Equals, undoBefore+1)
+}
+
 func (ts *taskRunnerSuite) TestStopKinds(c *C) {
 	sb := &stateBackend{}
 	st := state.New(sb)
@@ -586,6 +628,86 @@ func (ts *taskRunnerSuite) TestRetryAfterDuration(c *C) {
 	c.Check(t.AtTime().IsZero(), Equals, true)
 }
 
+func (ts *taskRunnerSuite) TestChangeNotBefore(c *C) {
+	sb := &stateBackend{ensureBefore: time.Hour}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	ran := 0
+	r.AddHandler("foo", func(t *state.Task, _ *tomb.Tomb) error {
+		ran++
+		return nil
+	}, nil)
+
+	now := time.Now()
+	restore := state.MockTime(now)
+	defer restore()
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("foo", "...")
+	chg.AddTask(t)
+	chg.SetNotBefore(now.Add(2 * time.Hour))
+	st.Unlock()
+
+	sb.ensureBefore = time.Hour
+	r.Ensure() // too soon
+	r.Wait()
+
+	st.Lock()
+	c.Check(t.Status(), Equals, state.DoStatus)
+	c.Check(ran, Equals, 0)
+	c.Check(sb.ensureBefore, Equals, time.Hour)
+	st.Unlock()
+
+	state.MockTime(now.Add(90 * time.Minute))
+	r.Ensure() // still too soon, next ensure is scheduled for the start
+	r.Wait()
+
+	st.Lock()
+	c.Check(ran, Equals, 0)
+	c.Check(sb.ensureBefore, Equals, 30*time.Minute)
+	st.Unlock()
+
+	state.MockTime(now.Add(2 * time.Hour))
+	r.Ensure()
+	r.Wait()
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(ran, Equals, 1)
+	c.Check(t.Status(), Equals, state.DoneStatus)
+}
+
+func (ts *taskRunnerSuite) TestChangeNotBeforeAbort(c *C) {
+	sb := &stateBackend{ensureBefore: time.Hour}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	r.AddHandler("foo", func(t *state.Task, _ *tomb.Tomb) error {
+		c.Fatalf("unexpected run of %s", t.Kind())
+		return nil
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("foo", "...")
+	chg.AddTask(t)
+	chg.SetNotBefore(time.Now().Add(time.Hour))
+	chg.Abort()
+	st.Unlock()
+
+	ensureChange(c, r, sb, chg)
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(t.Status(), Equals, state.HoldStatus)
+	c.Check(chg.Status(), Equals, state.HoldStatus)
+	c.Check(chg.IsReady(), Equals, true)
+}
+
 func (ts *taskRunnerSuite) testTaskSerialization(c *C, setupBlocked func(r *state.TaskRunner)) {
 	ensureBeforeTick := make(chan bool, 1)
 	sb := &stateBackend{
@@ -22,12 +22,19 @@ package overlord
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 
 	"github.com/snapcore/snapd/overlord/state"
 )
 
+var (
+	ensureSeconds = metrics.NewHistogramVec("snapd_ensure_seconds", "Time taken by ensure passes of the state engine.", metrics.DurationBuckets)
+	ensureErrors  = metrics.NewCounterVec("snapd_ensure_errors", "Ensure passes of the state engine that failed.")
+)
+
 // StateManager is implemented by types responsible for observing
 // the system and manipulating it to reflect the desired state.
 type StateManager interface {
@@ -143,6 +150,7 @@ func (se *StateEngine) Ensure() error {
 	if se.stopped {
 		return fmt.Errorf("state engine already stopped")
 	}
+	t0 := time.Now()
 	var errs []error
 	for _, m := range se.managers {
 		err := m.Ensure()
@@ -151,7 +159,9 @@ func (se *StateEngine) Ensure() error {
 			errs = append(errs, err)
 		}
 	}
+	ensureSeconds.Observe(time.Since(t0).Seconds())
 	if len(errs) != 0 {
+		ensureErrors.Inc()
 		return &ensureError{errs}
 	}
 	return nil
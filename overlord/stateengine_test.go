@@ -24,6 +24,7 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/metrics/metricstest"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/state"
 )
@@ -151,9 +152,15 @@ func (ses *stateEngineSuite) TestEnsureError(c *C) {
 	c.Assert(se.StartUp(), IsNil)
 	calls = []string{}
 
+	ensures := metricstest.Sample(c, "snapd_ensure_seconds_count")
+	ensureErrors := metricstest.Sample(c, "snapd_ensure_errors_total")
+
 	err := se.Ensure()
 	c.Check(err.Error(), DeepEquals, "state ensure errors: [boom1 boom2]")
 	c.Check(calls, DeepEquals, []string{"ensure:mgr1", "ensure:mgr2"})
+
+	c.Check(metricstest.Sample(c, "snapd_ensure_seconds_count"), Equals, ensures+1)
+	c.Check(metricstest.Sample(c, "snapd_ensure_errors_total"), Equals, ensureErrors+1)
 }
 
 func (ses *stateEngineSuite) TestStop(c *C) {
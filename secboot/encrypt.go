@@ -20,13 +20,22 @@
 package secboot
 
 import (
+	"bytes"
 	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/disks"
+	"github.com/snapcore/snapd/randutil"
 )
 
+var randutilRandomKernelUUID = randutil.RandomKernelUUID
+
 const (
 	// The encryption key size is set so it has the same entropy as the derived
 	// key. The recovery key is shorter and goes through KDF iterations.
@@ -44,6 +53,28 @@ func NewEncryptionKey() (EncryptionKey, error) {
 	return key, err
 }
 
+// EncryptionKeyFromFile reads the encryption key stored in the given file.
+func EncryptionKeyFromFile(filename string) (EncryptionKey, error) {
+	var key EncryptionKey
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return key, err
+	}
+	if len(data) != encryptionKeySize {
+		return key, fmt.Errorf("cannot read encryption key: unexpected size %v", len(data))
+	}
+	copy(key[:], data)
+	return key, nil
+}
+
+// Save writes the encryption key in the location specified by filename.
+func (key EncryptionKey) Save(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(filename, key[:], 0600, 0)
+}
+
 type RecoveryKey [recoveryKeySize]byte
 
 func NewRecoveryKey() (RecoveryKey, error) {
@@ -54,6 +85,31 @@ func NewRecoveryKey() (RecoveryKey, error) {
 	return key, err
 }
 
+// String returns the recovery key in the form it is entered by the user when
+// unlocking an encrypted volume, that is as 8 groups of 5 digits.
+func (key RecoveryKey) String() string {
+	var u16 [recoveryKeySize / 2]uint16
+	for i := range u16 {
+		u16[i] = binary.LittleEndian.Uint16(key[i*2:])
+	}
+	return fmt.Sprintf("%05d-%05d-%05d-%05d-%05d-%05d-%05d-%05d",
+		u16[0], u16[1], u16[2], u16[3], u16[4], u16[5], u16[6], u16[7])
+}
+
+// RecoveryKeyFromFile reads the recovery key stored in the given file.
+func RecoveryKeyFromFile(filename string) (RecoveryKey, error) {
+	var key RecoveryKey
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return key, err
+	}
+	if len(data) != recoveryKeySize {
+		return key, fmt.Errorf("cannot read recovery key: unexpected size %v", len(data))
+	}
+	copy(key[:], data)
+	return key, nil
+}
+
 // Save writes the recovery key in the location specified by filename.
 func (key RecoveryKey) Save(filename string) error {
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
@@ -61,3 +117,33 @@ func (key RecoveryKey) Save(filename string) error {
 	}
 	return osutil.AtomicWriteFile(filename, key[:], 0600, 0)
 }
+
+// RemoveRecoveryKey removes the recovery key rkey from the keyslots of the
+// encrypted volume on the block device given by node.
+func RemoveRecoveryKey(rkey RecoveryKey, node string) error {
+	cmd := exec.Command("cryptsetup", "luksRemoveKey", "--key-file", "-", node)
+	cmd.Stdin = bytes.NewReader(rkey[:])
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	return nil
+}
+
+// UnlockEncryptedVolumeUsingKey unlocks the encrypted volume with the specified
+// name on the given disk using the provided key. The path to the decrypted
+// device node is returned.
+func UnlockEncryptedVolumeUsingKey(disk disks.Disk, name string, key EncryptionKey) (string, error) {
+	partUUID, err := disk.FindMatchingPartitionUUID(name + "-enc")
+	if err != nil {
+		return "", err
+	}
+	encdev := filepath.Join("/dev/disk/by-partuuid", partUUID)
+
+	mapperName := name + "-" + randutilRandomKernelUUID()
+	cmd := exec.Command("cryptsetup", "open", "--key-file", "-", encdev, mapperName)
+	cmd.Stdin = bytes.NewReader(key[:])
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("cannot unlock encrypted device %q: %v", encdev, osutil.OutputErr(output, err))
+	}
+	return filepath.Join("/dev/mapper", mapperName), nil
+}
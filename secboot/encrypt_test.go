@@ -22,10 +22,13 @@ package secboot_test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/osutil/disks"
 	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/testutil"
 )
 
 type encryptSuite struct{}
@@ -44,3 +47,105 @@ func (s *encryptSuite) TestRecoveryKeySave(c *C) {
 	c.Assert(data, DeepEquals, rkey[:])
 	os.Remove("test-key")
 }
+
+func (s *encryptSuite) TestRecoveryKeyString(c *C) {
+	rkey := secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
+	c.Check(rkey.String(), Equals, "00256-00770-01284-01798-02312-02826-03340-65294")
+}
+
+func (s *encryptSuite) TestRecoveryKeyFromFile(c *C) {
+	rkey := secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
+	p := filepath.Join(c.MkDir(), "recovery.key")
+	err := rkey.Save(p)
+	c.Assert(err, IsNil)
+
+	key, err := secboot.RecoveryKeyFromFile(p)
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, rkey)
+
+	err = ioutil.WriteFile(p, []byte("short"), 0600)
+	c.Assert(err, IsNil)
+	_, err = secboot.RecoveryKeyFromFile(p)
+	c.Assert(err, ErrorMatches, "cannot read recovery key: unexpected size 5")
+
+	_, err = secboot.RecoveryKeyFromFile(filepath.Join(c.MkDir(), "missing"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *encryptSuite) TestRemoveRecoveryKey(c *C) {
+	d := c.MkDir()
+	cmd := testutil.MockCommand(c, "cryptsetup", `cat > `+filepath.Join(d, "stdin"))
+	defer cmd.Restore()
+
+	rkey := secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
+	err := secboot.RemoveRecoveryKey(rkey, "/dev/node")
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"cryptsetup", "luksRemoveKey", "--key-file", "-", "/dev/node"},
+	})
+	c.Check(filepath.Join(d, "stdin"), testutil.FileEquals, string(rkey[:]))
+
+	cmd = testutil.MockCommand(c, "cryptsetup", `echo "No key available with this passphrase."; exit 2`)
+	defer cmd.Restore()
+	err = secboot.RemoveRecoveryKey(rkey, "/dev/node")
+	c.Assert(err, ErrorMatches, "No key available with this passphrase.")
+}
+
+func (s *encryptSuite) TestEncryptionKeySaveAndFromFile(c *C) {
+	key := secboot.EncryptionKey{}
+	for i := range key {
+		key[i] = byte(i)
+	}
+	p := filepath.Join(c.MkDir(), "sub/ubuntu-save.key")
+	err := key.Save(p)
+	c.Assert(err, IsNil)
+	fileInfo, err := os.Stat(p)
+	c.Assert(err, IsNil)
+	c.Check(fileInfo.Mode(), Equals, os.FileMode(0600))
+
+	readKey, err := secboot.EncryptionKeyFromFile(p)
+	c.Assert(err, IsNil)
+	c.Check(readKey, DeepEquals, key)
+
+	err = ioutil.WriteFile(p, []byte("short"), 0600)
+	c.Assert(err, IsNil)
+	_, err = secboot.EncryptionKeyFromFile(p)
+	c.Assert(err, ErrorMatches, "cannot read encryption key: unexpected size 5")
+}
+
+func (s *encryptSuite) TestUnlockEncryptedVolumeUsingKey(c *C) {
+	d := c.MkDir()
+	cmd := testutil.MockCommand(c, "cryptsetup", `cat > `+filepath.Join(d, "stdin"))
+	defer cmd.Restore()
+
+	disk := &disks.MockDiskMapping{
+		FilesystemLabelToPartUUID: map[string]string{
+			"ubuntu-save-enc": "ubuntu-save-enc-partuuid",
+		},
+	}
+	key := secboot.EncryptionKey{1, 2, 3, 4}
+	dev, err := secboot.UnlockEncryptedVolumeUsingKey(disk, "ubuntu-save", key)
+	c.Assert(err, IsNil)
+	c.Check(dev, Matches, "/dev/mapper/ubuntu-save-[0-9a-f-]+")
+	c.Assert(cmd.Calls(), HasLen, 1)
+	c.Check(cmd.Calls()[0], DeepEquals, []string{
+		"cryptsetup", "open", "--key-file", "-", "/dev/disk/by-partuuid/ubuntu-save-enc-partuuid", filepath.Base(dev),
+	})
+	c.Check(filepath.Join(d, "stdin"), testutil.FileEquals, string(key[:]))
+}
+
+func (s *encryptSuite) TestUnlockEncryptedVolumeUsingKeyErrors(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", `echo "No key available with this passphrase."; exit 2`)
+	defer cmd.Restore()
+
+	disk := &disks.MockDiskMapping{
+		FilesystemLabelToPartUUID: map[string]string{
+			"ubuntu-save-enc": "ubuntu-save-enc-partuuid",
+		},
+	}
+	_, err := secboot.UnlockEncryptedVolumeUsingKey(disk, "ubuntu-save", secboot.EncryptionKey{})
+	c.Assert(err, ErrorMatches, `cannot unlock encrypted device "/dev/disk/by-partuuid/ubuntu-save-enc-partuuid": No key available with this passphrase.`)
+
+	_, err = secboot.UnlockEncryptedVolumeUsingKey(disk, "ubuntu-other", secboot.EncryptionKey{})
+	c.Assert(err, ErrorMatches, `filesystem label "ubuntu-other-enc" not found`)
+}
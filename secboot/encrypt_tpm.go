@@ -42,3 +42,10 @@ func FormatEncryptedDevice(key EncryptionKey, label, node string) error {
 func AddRecoveryKey(key EncryptionKey, rkey RecoveryKey, node string) error {
 	return sbAddRecoveryKeyToLUKS2Container(node, key[:], rkey)
 }
+
+// AddRecoveryKeyUsingRecoveryKey adds a new recovery key newRKey to the existing
+// encrypted volume on the block device given by node, which is unlocked with
+// its current recovery key rkey.
+func AddRecoveryKeyUsingRecoveryKey(rkey, newRKey RecoveryKey, node string) error {
+	return sbAddRecoveryKeyToLUKS2Container(node, rkey[:], newRKey)
+}
@@ -97,3 +97,22 @@ func (s *encryptSuite) TestAddRecoveryKey(c *C) {
 		}
 	}
 }
+
+func (s *encryptSuite) TestAddRecoveryKeyUsingRecoveryKey(c *C) {
+	myRecoveryKey := secboot.RecoveryKey{15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0}
+	myNewRecoveryKey := secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+	calls := 0
+	restore := secboot.MockSbAddRecoveryKeyToLUKS2Container(func(devicePath string, key []byte, recoveryKey [16]byte) error {
+		calls++
+		c.Assert(devicePath, Equals, "/dev/node")
+		c.Assert(key, DeepEquals, myRecoveryKey[:])
+		c.Assert(recoveryKey[:], DeepEquals, myNewRecoveryKey[:])
+		return nil
+	})
+	defer restore()
+
+	err := secboot.AddRecoveryKeyUsingRecoveryKey(myRecoveryKey, myNewRecoveryKey, "/dev/node")
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 1)
+}
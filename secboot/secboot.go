@@ -65,3 +65,12 @@ type SealKeyParams struct {
 	// The path to the lockout authorization file (only relevant for TPM)
 	TPMLockoutAuthFile string
 }
+
+type ResealKeyParams struct {
+	// The snap model parameters
+	ModelParams []*SealKeyModelParams
+	// The path to the sealed key file
+	KeyFile string
+	// The path to the authorization policy update data file (only relevant for TPM)
+	TPMPolicyUpdateDataFile string
+}
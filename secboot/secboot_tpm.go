@@ -37,7 +37,6 @@ import (
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/osutil/disks"
-	"github.com/snapcore/snapd/randutil"
 	"github.com/snapcore/snapd/snap/snapfile"
 )
 
@@ -58,8 +57,7 @@ var (
 	sbAddSnapModelProfile            = sb.AddSnapModelProfile
 	sbProvisionTPM                   = sb.ProvisionTPM
 	sbSealKeyToTPM                   = sb.SealKeyToTPM
-
-	randutilRandomKernelUUID = randutil.RandomKernelUUID
+	sbUpdateKeyPCRProtectionPolicy   = sb.UpdateKeyPCRProtectionPolicy
 
 	isTPMEnabled = isTPMEnabledImpl
 )
@@ -322,15 +320,40 @@ func SealKey(key EncryptionKey, params *SealKeyParams) error {
 		return fmt.Errorf("TPM device is not enabled")
 	}
 
-	modelPCRProfiles := make([]*sb.PCRProtectionProfile, 0, numModels)
+	pcrProfile, err := buildPCRProtectionProfile(params.ModelParams)
+	if err != nil {
+		return err
+	}
+
+	// Provision the TPM as late as possible
+	if err := tpmProvision(tpm, params.TPMLockoutAuthFile); err != nil {
+		return err
+	}
+
+	// Seal key to the TPM
+	creationParams := sb.KeyCreationParams{
+		PCRProfile: pcrProfile,
+		PINHandle:  pinHandle,
+	}
+	if err := sbSealKeyToTPM(tpm, key[:], params.KeyFile, params.TPMPolicyUpdateDataFile, &creationParams); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// buildPCRProtectionProfile builds the PCR protection profile for the given
+// sets of model specific parameters.
+func buildPCRProtectionProfile(modelParams []*SealKeyModelParams) (*sb.PCRProtectionProfile, error) {
+	modelPCRProfiles := make([]*sb.PCRProtectionProfile, 0, len(modelParams))
 
-	for _, modelParams := range params.ModelParams {
+	for _, mp := range modelParams {
 		modelProfile := sb.NewPCRProtectionProfile()
 
 		// Add EFI secure boot policy profile
-		loadSequences, err := buildLoadSequences(modelParams.EFILoadChains)
+		loadSequences, err := buildLoadSequences(mp.EFILoadChains)
 		if err != nil {
-			return fmt.Errorf("cannot build EFI image load sequences: %v", err)
+			return nil, fmt.Errorf("cannot build EFI image load sequences: %v", err)
 		}
 		policyParams := sb.EFISecureBootPolicyProfileParams{
 			PCRAlgorithm:  tpm2.HashAlgorithmSHA256,
@@ -342,30 +365,30 @@ func SealKey(key EncryptionKey, params *SealKeyParams) error {
 		}
 
 		if err := sbAddEFISecureBootPolicyProfile(modelProfile, &policyParams); err != nil {
-			return fmt.Errorf("cannot add EFI secure boot policy profile: %v", err)
+			return nil, fmt.Errorf("cannot add EFI secure boot policy profile: %v", err)
 		}
 
 		// Add systemd EFI stub profile
-		if len(modelParams.KernelCmdlines) != 0 {
+		if len(mp.KernelCmdlines) != 0 {
 			systemdStubParams := sb.SystemdEFIStubProfileParams{
 				PCRAlgorithm:   tpm2.HashAlgorithmSHA256,
 				PCRIndex:       tpmPCR,
-				KernelCmdlines: modelParams.KernelCmdlines,
+				KernelCmdlines: mp.KernelCmdlines,
 			}
 			if err := sbAddSystemdEFIStubProfile(modelProfile, &systemdStubParams); err != nil {
-				return fmt.Errorf("cannot add systemd EFI stub profile: %v", err)
+				return nil, fmt.Errorf("cannot add systemd EFI stub profile: %v", err)
 			}
 		}
 
 		// Add snap model profile
-		if modelParams.Model != nil {
+		if mp.Model != nil {
 			snapModelParams := sb.SnapModelProfileParams{
 				PCRAlgorithm: tpm2.HashAlgorithmSHA256,
 				PCRIndex:     tpmPCR,
-				Models:       []*asserts.Model{modelParams.Model},
+				Models:       []*asserts.Model{mp.Model},
 			}
 			if err := sbAddSnapModelProfile(modelProfile, &snapModelParams); err != nil {
-				return fmt.Errorf("cannot add snap model profile: %v", err)
+				return nil, fmt.Errorf("cannot add snap model profile: %v", err)
 			}
 		}
 
@@ -373,27 +396,37 @@ func SealKey(key EncryptionKey, params *SealKeyParams) error {
 	}
 
 	var pcrProfile *sb.PCRProtectionProfile
-	if numModels > 1 {
+	if len(modelParams) > 1 {
 		pcrProfile = sb.NewPCRProtectionProfile().AddProfileOR(modelPCRProfiles...)
 	} else {
 		pcrProfile = modelPCRProfiles[0]
 	}
 
-	// Provision the TPM as late as possible
-	if err := tpmProvision(tpm, params.TPMLockoutAuthFile); err != nil {
-		return err
+	return pcrProfile, nil
+}
+
+// ResealKey updates the PCR protection policy for the sealed encryption key
+// according to the specified parameters.
+func ResealKey(params *ResealKeyParams) error {
+	numModels := len(params.ModelParams)
+	if numModels < 1 {
+		return fmt.Errorf("at least one set of model-specific parameters is required")
 	}
 
-	// Seal key to the TPM
-	creationParams := sb.KeyCreationParams{
-		PCRProfile: pcrProfile,
-		PINHandle:  pinHandle,
+	tpm, err := sbConnectToDefaultTPM()
+	if err != nil {
+		return fmt.Errorf("cannot connect to TPM: %v", err)
 	}
-	if err := sbSealKeyToTPM(tpm, key[:], params.KeyFile, params.TPMPolicyUpdateDataFile, &creationParams); err != nil {
+	if !isTPMEnabled(tpm) {
+		return fmt.Errorf("TPM device is not enabled")
+	}
+
+	pcrProfile, err := buildPCRProtectionProfile(params.ModelParams)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return sbUpdateKeyPCRProtectionPolicy(tpm, params.KeyFile, params.TPMPolicyUpdateDataFile, pcrProfile)
 }
 
 func tpmProvision(tpm *sb.TPMConnection, lockoutAuthFile string) error {
@@ -787,6 +787,95 @@ func (s *secbootSuite) TestSealKeyNoModelParams(c *C) {
 	c.Assert(err, ErrorMatches, "at least one set of model-specific parameters is required")
 }
 
+func (s *secbootSuite) TestResealKey(c *C) {
+	mockErr := errors.New("some error")
+
+	for _, tc := range []struct {
+		tpmErr               error
+		tpmEnabled           bool
+		addSystemdEFIStubErr error
+		resealErr            error
+		resealCalls          int
+		expectedErr          string
+	}{
+		{tpmErr: mockErr, expectedErr: "cannot connect to TPM: some error"},
+		{tpmEnabled: false, expectedErr: "TPM device is not enabled"},
+		{tpmEnabled: true, addSystemdEFIStubErr: mockErr, expectedErr: "cannot add systemd EFI stub profile: some error"},
+		{tpmEnabled: true, resealErr: mockErr, resealCalls: 1, expectedErr: "some error"},
+		{tpmEnabled: true, resealCalls: 1, expectedErr: ""},
+	} {
+		mockEFI := bootloader.NewBootFile("", filepath.Join(c.MkDir(), "file.efi"), bootloader.RoleRecovery)
+		err := ioutil.WriteFile(mockEFI.Path, nil, 0644)
+		c.Assert(err, IsNil)
+
+		myParams := &secboot.ResealKeyParams{
+			ModelParams: []*secboot.SealKeyModelParams{
+				{
+					EFILoadChains:  []*secboot.LoadChain{secboot.NewLoadChain(mockEFI)},
+					KernelCmdlines: []string{"cmdline", "cmdline isolcpus=1"},
+					Model:          &asserts.Model{},
+				},
+			},
+			KeyFile:                 "keyfile",
+			TPMPolicyUpdateDataFile: "policy-update-data-file",
+		}
+
+		tpm, restore := mockSbTPMConnection(c, tc.tpmErr)
+		defer restore()
+
+		restore = secboot.MockIsTPMEnabled(func(t *sb.TPMConnection) bool {
+			return tc.tpmEnabled
+		})
+		defer restore()
+
+		restore = secboot.MockSbAddEFISecureBootPolicyProfile(func(profile *sb.PCRProtectionProfile, params *sb.EFISecureBootPolicyProfileParams) error {
+			return nil
+		})
+		defer restore()
+
+		addSystemdEfiStubCalls := 0
+		restore = secboot.MockSbAddSystemdEFIStubProfile(func(profile *sb.PCRProtectionProfile, params *sb.SystemdEFIStubProfileParams) error {
+			addSystemdEfiStubCalls++
+			c.Assert(params.KernelCmdlines, DeepEquals, []string{"cmdline", "cmdline isolcpus=1"})
+			return tc.addSystemdEFIStubErr
+		})
+		defer restore()
+
+		restore = secboot.MockSbAddSnapModelProfile(func(profile *sb.PCRProtectionProfile, params *sb.SnapModelProfileParams) error {
+			return nil
+		})
+		defer restore()
+
+		resealCalls := 0
+		restore = secboot.MockSbUpdateKeyPCRProtectionPolicy(func(t *sb.TPMConnection, keyPath, policyUpdatePath string, profile *sb.PCRProtectionProfile) error {
+			resealCalls++
+			c.Assert(t, Equals, tpm)
+			c.Assert(keyPath, Equals, myParams.KeyFile)
+			c.Assert(policyUpdatePath, Equals, myParams.TPMPolicyUpdateDataFile)
+			c.Assert(profile, NotNil)
+			return tc.resealErr
+		})
+		defer restore()
+
+		err = secboot.ResealKey(myParams)
+		if tc.expectedErr == "" {
+			c.Assert(err, IsNil)
+			c.Assert(addSystemdEfiStubCalls, Equals, 1)
+		} else {
+			c.Assert(err, ErrorMatches, tc.expectedErr)
+		}
+		c.Assert(resealCalls, Equals, tc.resealCalls)
+	}
+}
+
+func (s *secbootSuite) TestResealKeyNoModelParams(c *C) {
+	err := secboot.ResealKey(&secboot.ResealKeyParams{
+		KeyFile:                 "keyfile",
+		TPMPolicyUpdateDataFile: "policy-update-data-file",
+	})
+	c.Assert(err, ErrorMatches, "at least one set of model-specific parameters is required")
+}
+
 func createMockSnapFile(snapDir, snapPath, snapType string) (snap.Container, error) {
 	snapYamlPath := filepath.Join(snapDir, "meta/snap.yaml")
 	if err := os.MkdirAll(filepath.Dir(snapYamlPath), 0755); err != nil {
@@ -191,6 +191,13 @@ func CommonDataDir(name string) string {
 	return filepath.Join(dirs.SnapDataDir, name, "common")
 }
 
+// CommonDataSaveDir returns the directory on the ubuntu-save partition that
+// holds the data of the given snap. The name can be either a snap name or snap
+// instance name.
+func CommonDataSaveDir(name string) string {
+	return filepath.Join(dirs.SnapSaveDir, "snap", name)
+}
+
 // HooksDir returns the directory containing the snap's hooks for given snap
 // name. The name can be either a snap name or snap instance name.
 func HooksDir(name string, revision Revision) string {
@@ -311,6 +318,10 @@ type Info struct {
 	// List of system users (usernames) this snap may use. The group of the same
 	// name must also exist.
 	SystemUsernames map[string]*SystemUsernameInfo
+
+	// SaveData is set if the snap asked for a data directory on the
+	// ubuntu-save partition, made available as $SNAP_SAVE_DATA.
+	SaveData bool
 }
 
 // StoreAccount holds information about a store account, for example of snap
@@ -478,6 +489,19 @@ func (s *Info) CommonDataDir() string {
 	return CommonDataDir(s.InstanceName())
 }
 
+// CommonDataSaveDir returns the directory on the ubuntu-save partition that
+// holds the data of the snap.
+func (s *Info) CommonDataSaveDir() string {
+	return CommonDataSaveDir(s.InstanceName())
+}
+
+// SaveDataMountDir returns the directory where the data of the snap kept on
+// the ubuntu-save partition is bind mounted in the mount namespace of the
+// snap, as seen from inside it.
+func (s *Info) SaveDataMountDir() string {
+	return filepath.Join(BaseDataDir(s.SnapName()), "save")
+}
+
 // DataHomeDir returns the per user data directory of the snap.
 func (s *Info) DataHomeDir() string {
 	return filepath.Join(dirs.SnapDataHomeGlob, s.InstanceName(), s.Revision.String())
@@ -814,6 +838,90 @@ type TimerInfo struct {
 	Timer string
 }
 
+// Defaults for the optional settings of a health probe.
+const (
+	DefaultHealthProbeInterval  = 30 * time.Second
+	DefaultHealthProbeTimeout   = 10 * time.Second
+	DefaultHealthProbeThreshold = 3
+)
+
+// HealthProbeInfo provides information on how the health of a service
+// is periodically probed. Exactly one of Exec, HTTP and TCP is set.
+type HealthProbeInfo struct {
+	App *AppInfo
+
+	// Exec is a command of the snap that must succeed for the
+	// service to be healthy.
+	Exec string
+	// HTTP is a HTTP GET on localhost that must get a response with
+	// a status below 400 for the service to be healthy.
+	HTTP *HTTPProbeInfo
+	// TCP is a TCP port on localhost that must accept connections
+	// for the service to be healthy.
+	TCP *TCPProbeInfo
+
+	Interval timeout.Timeout
+	Timeout  timeout.Timeout
+	// Threshold is the number of consecutive failed probes after
+	// which the service is deemed unhealthy.
+	Threshold int
+	// Restart is set if the service is to be restarted once deemed
+	// unhealthy.
+	Restart bool
+}
+
+// HTTPProbeInfo provides information on a HTTP health probe.
+type HTTPProbeInfo struct {
+	Port int
+	Path string
+}
+
+// TCPProbeInfo provides information on a TCP health probe.
+type TCPProbeInfo struct {
+	Port int
+}
+
+// Kind returns the kind of the health probe, one of exec, http and tcp.
+func (probe *HealthProbeInfo) Kind() string {
+	switch {
+	case probe.Exec != "":
+		return "exec"
+	case probe.HTTP != nil:
+		return "http"
+	case probe.TCP != nil:
+		return "tcp"
+	}
+	return ""
+}
+
+// EffectiveInterval returns the time between probes, taking the default
+// into account.
+func (probe *HealthProbeInfo) EffectiveInterval() time.Duration {
+	if probe.Interval > 0 {
+		return time.Duration(probe.Interval)
+	}
+	return DefaultHealthProbeInterval
+}
+
+// EffectiveTimeout returns the time a probe can take, taking the default
+// into account.
+func (probe *HealthProbeInfo) EffectiveTimeout() time.Duration {
+	if probe.Timeout > 0 {
+		return time.Duration(probe.Timeout)
+	}
+	return DefaultHealthProbeTimeout
+}
+
+// EffectiveThreshold returns the number of consecutive failed probes
+// after which the service is deemed unhealthy, taking the default into
+// account.
+func (probe *HealthProbeInfo) EffectiveThreshold() int {
+	if probe.Threshold > 0 {
+		return probe.Threshold
+	}
+	return DefaultHealthProbeThreshold
+}
+
 // StopModeType is the type for the "stop-mode:" of a snap app
 type StopModeType string
 
@@ -885,6 +993,8 @@ type AppInfo struct {
 
 	Timer *TimerInfo
 
+	HealthProbe *HealthProbeInfo
+
 	Autostart string
 }
 
@@ -1018,6 +1128,12 @@ func (app *AppInfo) LauncherPostStopCommand() string {
 	return app.launcherCommand("--command=post-stop")
 }
 
+// LauncherHealthProbeCommand returns the launcher command line to use when
+// invoking the app health probe command binary.
+func (app *AppInfo) LauncherHealthProbeCommand() string {
+	return app.launcherCommand("--command=health-probe")
+}
+
 // ServiceName returns the systemd service name for the daemon app.
 func (app *AppInfo) ServiceName() string {
 	return app.SecurityTag() + ".service"
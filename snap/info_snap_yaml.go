@@ -53,6 +53,7 @@ type snapYaml struct {
 	Hooks           map[string]hookYaml    `yaml:"hooks,omitempty"`
 	Layout          map[string]layoutYaml  `yaml:"layout,omitempty"`
 	SystemUsernames map[string]interface{} `yaml:"system-usernames,omitempty"`
+	SaveData        bool                   `yaml:"save-data,omitempty"`
 
 	// TypoLayouts is used to detect the use of the incorrect plural form of "layout"
 	TypoLayouts typoDetector `yaml:"layouts,omitempty"`
@@ -103,6 +104,8 @@ type appYaml struct {
 
 	Timer string `yaml:"timer,omitempty"`
 
+	HealthProbe *healthProbeYaml `yaml:"health-probe,omitempty"`
+
 	Autostart string `yaml:"autostart,omitempty"`
 }
 
@@ -128,6 +131,25 @@ type socketsYaml struct {
 	SocketMode   os.FileMode `yaml:"socket-mode,omitempty"`
 }
 
+type healthProbeYaml struct {
+	Exec      string          `yaml:"exec,omitempty"`
+	HTTP      *httpProbeYaml  `yaml:"http,omitempty"`
+	TCP       *tcpProbeYaml   `yaml:"tcp,omitempty"`
+	Interval  timeout.Timeout `yaml:"interval,omitempty"`
+	Timeout   timeout.Timeout `yaml:"timeout,omitempty"`
+	Threshold int             `yaml:"threshold,omitempty"`
+	Restart   bool            `yaml:"restart,omitempty"`
+}
+
+type httpProbeYaml struct {
+	Port int    `yaml:"port"`
+	Path string `yaml:"path,omitempty"`
+}
+
+type tcpProbeYaml struct {
+	Port int `yaml:"port"`
+}
+
 // InfoFromSnapYaml creates a new info based on the given snap.yaml data
 func InfoFromSnapYaml(yamlData []byte) (*Info, error) {
 	return infoFromSnapYaml(yamlData, new(scopedTracker))
@@ -277,6 +299,7 @@ func infoSkeletonFromSnapYaml(y snapYaml) *Info {
 		License:             y.License,
 		Epoch:               y.Epoch,
 		Confinement:         confinement,
+		SaveData:            y.SaveData,
 		Base:                y.Base,
 		Apps:                make(map[string]*AppInfo),
 		LegacyAliases:       make(map[string]*AppInfo),
@@ -452,6 +475,27 @@ func setAppsFromSnapYaml(y snapYaml, snap *Info, strk *scopedTracker) error {
 				Timer: yApp.Timer,
 			}
 		}
+		if yProbe := yApp.HealthProbe; yProbe != nil {
+			app.HealthProbe = &HealthProbeInfo{
+				App:       app,
+				Exec:      yProbe.Exec,
+				Interval:  yProbe.Interval,
+				Timeout:   yProbe.Timeout,
+				Threshold: yProbe.Threshold,
+				Restart:   yProbe.Restart,
+			}
+			if yProbe.HTTP != nil {
+				app.HealthProbe.HTTP = &HTTPProbeInfo{
+					Port: yProbe.HTTP.Port,
+					Path: yProbe.HTTP.Path,
+				}
+			}
+			if yProbe.TCP != nil {
+				app.HealthProbe.TCP = &TCPProbeInfo{
+					Port: yProbe.TCP.Port,
+				}
+			}
+		}
 		// collect all common IDs
 		if app.CommonID != "" {
 			snap.CommonIDs = append(snap.CommonIDs, app.CommonID)
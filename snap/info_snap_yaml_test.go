@@ -1428,6 +1428,21 @@ version: 1.0
 	c.Assert(info.Epoch, DeepEquals, snap.E("0"))
 }
 
+func (s *YamlSuite) TestSnapYamlSaveData(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte(`name: binary
+version: 1.0
+`))
+	c.Assert(err, IsNil)
+	c.Check(info.SaveData, Equals, false)
+
+	info, err = snap.InfoFromSnapYaml([]byte(`name: binary
+version: 1.0
+save-data: true
+`))
+	c.Assert(err, IsNil)
+	c.Check(info.SaveData, Equals, true)
+}
+
 func (s *YamlSuite) TestSnapYamlConfinementDefault(c *C) {
 	y := []byte(`name: binary
 version: 1.0
@@ -1855,6 +1870,60 @@ apps:
 	c.Check(app.Timer, DeepEquals, &snap.TimerInfo{App: app, Timer: "mon,10:00-12:00"})
 }
 
+func (s *YamlSuite) TestSnapYamlAppHealthProbe(c *C) {
+	y := []byte(`name: wat
+version: 42
+apps:
+ foo:
+   daemon: simple
+   health-probe:
+     http:
+       port: 8080
+       path: /healthz
+     interval: 1m
+     timeout: 5s
+     threshold: 5
+     restart: true
+ bar:
+   daemon: simple
+   health-probe:
+     exec: bin/check
+ baz:
+   daemon: simple
+   health-probe:
+     tcp:
+       port: 22
+
+`)
+	info, err := snap.InfoFromSnapYaml(y)
+	c.Assert(err, IsNil)
+
+	app := info.Apps["foo"]
+	c.Check(app.HealthProbe, DeepEquals, &snap.HealthProbeInfo{
+		App:       app,
+		HTTP:      &snap.HTTPProbeInfo{Port: 8080, Path: "/healthz"},
+		Interval:  timeout.Timeout(time.Minute),
+		Timeout:   timeout.Timeout(5 * time.Second),
+		Threshold: 5,
+		Restart:   true,
+	})
+	c.Check(app.HealthProbe.Kind(), Equals, "http")
+	c.Check(app.HealthProbe.EffectiveInterval(), Equals, time.Minute)
+	c.Check(app.HealthProbe.EffectiveTimeout(), Equals, 5*time.Second)
+	c.Check(app.HealthProbe.EffectiveThreshold(), Equals, 5)
+
+	app = info.Apps["bar"]
+	c.Check(app.HealthProbe, DeepEquals, &snap.HealthProbeInfo{App: app, Exec: "bin/check"})
+	c.Check(app.HealthProbe.Kind(), Equals, "exec")
+	c.Check(app.HealthProbe.EffectiveInterval(), Equals, snap.DefaultHealthProbeInterval)
+	c.Check(app.HealthProbe.EffectiveTimeout(), Equals, snap.DefaultHealthProbeTimeout)
+	c.Check(app.HealthProbe.EffectiveThreshold(), Equals, snap.DefaultHealthProbeThreshold)
+
+	app = info.Apps["baz"]
+	c.Check(app.HealthProbe, DeepEquals, &snap.HealthProbeInfo{App: app, TCP: &snap.TCPProbeInfo{Port: 22}})
+	c.Check(app.HealthProbe.Kind(), Equals, "tcp")
+}
+
 func (s *YamlSuite) TestSnapYamlAppAutostart(c *C) {
 	yAutostart := []byte(`name: wat
 version: 42
@@ -1025,6 +1025,17 @@ func (s *infoSuite) TestMinimalInfoDirAndFileMethodsParallelInstall(c *C) {
 	s.testInstanceDirAndFileMethods(c, info)
 }
 
+func (s *infoSuite) TestSaveDataDirs(c *C) {
+	dirs.SetRootDir("")
+	info := &snap.Info{SuggestedName: "name"}
+	c.Check(info.CommonDataSaveDir(), Equals, "/var/lib/snapd/save/snap/name")
+	c.Check(info.SaveDataMountDir(), Equals, "/var/snap/name/save")
+
+	info.InstanceKey = "instance"
+	c.Check(info.CommonDataSaveDir(), Equals, "/var/lib/snapd/save/snap/name_instance")
+	c.Check(info.SaveDataMountDir(), Equals, "/var/snap/name/save")
+}
+
 func (s *infoSuite) TestDirAndFileMethodsParallelInstall(c *C) {
 	dirs.SetRootDir("")
 	info := &snap.Info{SuggestedName: "name", InstanceKey: "instance"}
@@ -69,7 +69,7 @@ func snapEnv(info *snap.Info) osutil.Environment {
 // used by so many other modules, we run into circular dependencies if it's
 // somewhere more reasonable like the snappy module.
 func basicEnv(info *snap.Info) osutil.Environment {
-	return osutil.Environment{
+	env := osutil.Environment{
 		// This uses CoreSnapMountDir because the computed environment
 		// variables are conveyed to the started application process which
 		// shall *either* execute with the new mount namespace where snaps are
@@ -93,6 +93,12 @@ func basicEnv(info *snap.Info) osutil.Environment {
 		"SNAP_LIBRARY_PATH": "/var/lib/snapd/lib/gl:/var/lib/snapd/lib/gl32:/var/lib/snapd/void",
 		"SNAP_REEXEC":       os.Getenv("SNAP_REEXEC"),
 	}
+	// the save data directory is only bind mounted for snaps asking for
+	// it, on devices with an ubuntu-save partition
+	if info.SaveData && osutil.IsDirectory(info.CommonDataSaveDir()) {
+		env["SNAP_SAVE_DATA"] = info.SaveDataMountDir()
+	}
+	return env
 }
 
 // userEnv returns the user-level environment variables for a snap.
@@ -24,6 +24,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
 	"testing"
 
 	. "gopkg.in/check.v1"
@@ -96,6 +97,22 @@ func (ts *HTestSuite) TestBasic(c *C) {
 	})
 }
 
+func (ts *HTestSuite) TestBasicWithSaveData(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("")
+
+	c.Assert(os.MkdirAll(filepath.Join(dirs.SnapSaveDir, "snap/foo"), 0755), IsNil)
+
+	// the snap did not ask for it
+	_, ok := basicEnv(mockSnapInfo)["SNAP_SAVE_DATA"]
+	c.Check(ok, Equals, false)
+
+	info := *mockSnapInfo
+	info.SaveData = true
+	env := basicEnv(&info)
+	c.Check(env["SNAP_SAVE_DATA"], Equals, filepath.Join(dirs.SnapDataDir, "foo/save"))
+}
+
 func (ts *HTestSuite) TestUser(c *C) {
 	env := userEnv(mockSnapInfo, "/root")
 	c.Assert(env, DeepEquals, osutil.Environment{
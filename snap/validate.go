@@ -28,6 +28,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/snapcore/snapd/osutil"
@@ -618,6 +619,67 @@ func validateAppTimer(app *AppInfo) error {
 	return nil
 }
 
+func validateAppHealthProbe(app *AppInfo) error {
+	probe := app.HealthProbe
+	if probe == nil {
+		return nil
+	}
+
+	if !app.IsService() {
+		return errors.New("health-probe is only applicable to services")
+	}
+	if app.DaemonScope != SystemDaemon {
+		return errors.New("health-probe is only supported for system services")
+	}
+
+	kinds := 0
+	if probe.Exec != "" {
+		if err := validateField("health-probe exec", probe.Exec, appContentWhitelist); err != nil {
+			return err
+		}
+		kinds++
+	}
+	if probe.HTTP != nil {
+		if err := validateProbePort(probe.HTTP.Port); err != nil {
+			return err
+		}
+		if probe.HTTP.Path != "" && !strings.HasPrefix(probe.HTTP.Path, "/") {
+			return fmt.Errorf("health-probe http path must start with /, not %q", probe.HTTP.Path)
+		}
+		kinds++
+	}
+	if probe.TCP != nil {
+		if err := validateProbePort(probe.TCP.Port); err != nil {
+			return err
+		}
+		kinds++
+	}
+	if kinds != 1 {
+		return errors.New("health-probe must have exactly one of exec, http or tcp")
+	}
+
+	if probe.Interval != 0 && probe.Interval < timeout.Timeout(time.Second) {
+		return errors.New("health-probe interval cannot be less than 1s")
+	}
+	if probe.Timeout < 0 {
+		return errors.New("health-probe timeout cannot be negative")
+	}
+	if probe.EffectiveTimeout() > probe.EffectiveInterval() {
+		return errors.New("health-probe timeout cannot be longer than its interval")
+	}
+	if probe.Threshold < 0 {
+		return errors.New("health-probe threshold cannot be negative")
+	}
+	return nil
+}
+
+func validateProbePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("health-probe port must be between 1 and 65535, not %d", port)
+	}
+	return nil
+}
+
 func validateAppRestart(app *AppInfo) error {
 	// app.RestartCond value is validated when unmarshalling
 
@@ -761,6 +823,9 @@ func ValidateApp(app *AppInfo) error {
 	if err := validateAppRestart(app); err != nil {
 		return err
 	}
+	if err := validateAppHealthProbe(app); err != nil {
+		return err
+	}
 	if err := validateAppOrderNames(app, app.Before); err != nil {
 		return err
 	}
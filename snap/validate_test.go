@@ -1569,6 +1569,88 @@ apps:
 	}
 }
 
+func (s *YamlSuite) TestValidateAppHealthProbe(c *C) {
+	meta := []byte(`
+name: foo
+version: 1.0
+`)
+
+	tcs := []struct {
+		name string
+		desc string
+		err  string
+	}{{
+		name: "exec",
+		desc: "daemon: simple\n    health-probe:\n      exec: bin/check",
+	}, {
+		name: "http",
+		desc: "daemon: simple\n    health-probe:\n      http:\n        port: 80\n        path: /health\n      interval: 10s\n      timeout: 10s",
+	}, {
+		name: "tcp",
+		desc: "daemon: simple\n    health-probe:\n      tcp:\n        port: 80\n      threshold: 1\n      restart: true",
+	}, {
+		name: "not a service",
+		desc: "command: bin/foo\n    health-probe:\n      exec: bin/check",
+		err:  `health-probe is only applicable to services`,
+	}, {
+		name: "user service",
+		desc: "daemon: simple\n    daemon-scope: user\n    health-probe:\n      exec: bin/check",
+		err:  `health-probe is only supported for system services`,
+	}, {
+		name: "no probe",
+		desc: "daemon: simple\n    health-probe:\n      interval: 10s",
+		err:  `health-probe must have exactly one of exec, http or tcp`,
+	}, {
+		name: "two probes",
+		desc: "daemon: simple\n    health-probe:\n      exec: bin/check\n      tcp:\n        port: 80",
+		err:  `health-probe must have exactly one of exec, http or tcp`,
+	}, {
+		name: "bad exec",
+		desc: "daemon: simple\n    health-probe:\n      exec: bin/check;rm",
+		err:  `app description field 'health-probe exec' contains illegal "bin/check;rm" \(legal: '.*'\)`,
+	}, {
+		name: "bad port",
+		desc: "daemon: simple\n    health-probe:\n      tcp:\n        port: 70000",
+		err:  `health-probe port must be between 1 and 65535, not 70000`,
+	}, {
+		name: "missing port",
+		desc: "daemon: simple\n    health-probe:\n      http:\n        path: /health",
+		err:  `health-probe port must be between 1 and 65535, not 0`,
+	}, {
+		name: "bad path",
+		desc: "daemon: simple\n    health-probe:\n      http:\n        port: 80\n        path: health",
+		err:  `health-probe http path must start with /, not "health"`,
+	}, {
+		name: "short interval",
+		desc: "daemon: simple\n    health-probe:\n      exec: bin/check\n      interval: 500ms",
+		err:  `health-probe interval cannot be less than 1s`,
+	}, {
+		name: "negative timeout",
+		desc: "daemon: simple\n    health-probe:\n      exec: bin/check\n      timeout: -1s",
+		err:  `health-probe timeout cannot be negative`,
+	}, {
+		name: "long timeout",
+		desc: "daemon: simple\n    health-probe:\n      exec: bin/check\n      interval: 10s\n      timeout: 20s",
+		err:  `health-probe timeout cannot be longer than its interval`,
+	}, {
+		name: "negative threshold",
+		desc: "daemon: simple\n    health-probe:\n      exec: bin/check\n      threshold: -1",
+		err:  `health-probe threshold cannot be negative`,
+	}}
+	for _, tc := range tcs {
+		c.Logf("trying %q", tc.name)
+		info, err := InfoFromSnapYaml(append(meta, "apps:\n  foo:\n    "+tc.desc+"\n"...))
+		c.Assert(err, IsNil)
+
+		err = Validate(info)
+		if tc.err != "" {
+			c.Assert(err, ErrorMatches, `invalid definition of application "foo": `+tc.err)
+		} else {
+			c.Assert(err, IsNil)
+		}
+	}
+}
+
 func (s *ValidateSuite) TestValidateOsCannotHaveBase(c *C) {
 	info, err := InfoFromSnapYaml([]byte(`name: foo
 version: 1.0
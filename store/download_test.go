@@ -38,6 +38,7 @@ import (
 	"gopkg.in/retry.v1"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/metrics/metricstest"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/progress"
@@ -76,6 +77,8 @@ func (s *downloadSuite) TestActualDownload(c *C) {
 	c.Assert(mockServer, NotNil)
 	defer mockServer.Close()
 
+	downloaded := metricstest.Sample(c, "snapd_store_download_bytes_total")
+
 	theStore := store.New(&store.Config{}, nil)
 	var buf SillyBuffer
 	// keep tests happy
@@ -84,6 +87,7 @@ func (s *downloadSuite) TestActualDownload(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(buf.String(), Equals, "response-data")
 	c.Check(n, Equals, 1)
+	c.Check(metricstest.Sample(c, "snapd_store_download_bytes_total"), Equals, downloaded+float64(len("response-data")))
 }
 
 func (s *downloadSuite) TestActualDownloadAutoRefresh(c *C) {
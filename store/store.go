@@ -44,6 +44,7 @@ import (
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/jsonutil"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/release"
@@ -803,6 +804,22 @@ func (s *Store) retryRequestDecodeJSON(ctx context.Context, reqOptions *requestO
 	}, defaultRetryStrategy)
 }
 
+var (
+	requestSeconds = metrics.NewHistogramVec("snapd_store_request_seconds", "Time taken by requests to the store, by endpoint.", metrics.DurationBuckets, "endpoint")
+	requestErrors  = metrics.NewCounterVec("snapd_store_request_errors", "Requests to the store that failed or got a server error, by endpoint.", "endpoint")
+)
+
+// metricsEndpoint returns the endpoint a store request is accounted to in
+// metrics: the first three elements of its path, leaving out the snap
+// names, assertion keys and the like that follow.
+func metricsEndpoint(u *url.URL) string {
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 4)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
 // doRequest does an authenticated request to the store handling a potential macaroon refresh required if needed
 func (s *Store) doRequest(ctx context.Context, client *http.Client, reqOptions *requestOptions, user *auth.UserState) (*http.Response, error) {
 	authRefreshes := 0
@@ -815,10 +832,17 @@ func (s *Store) doRequest(ctx context.Context, client *http.Client, reqOptions *
 			req = req.WithContext(ctx)
 		}
 
+		endpoint := metricsEndpoint(req.URL)
+		t0 := time.Now()
 		resp, err := client.Do(req)
+		requestSeconds.Observe(time.Since(t0).Seconds(), endpoint)
 		if err != nil {
+			requestErrors.Inc(endpoint)
 			return nil, err
 		}
+		if resp.StatusCode >= 500 {
+			requestErrors.Inc(endpoint)
+		}
 
 		wwwAuth := resp.Header.Get("WWW-Authenticate")
 		if resp.StatusCode == 401 && authRefreshes < 4 {
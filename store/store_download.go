@@ -41,6 +41,7 @@ import (
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/progress"
@@ -257,6 +258,8 @@ var ratelimitReader = ratelimit.Reader
 
 var download = downloadImpl
 
+var downloadBytes = metrics.NewCounterVec("snapd_store_download_bytes", "Bytes of snaps downloaded from the store.")
+
 // download writes an http.Request showing a progress.Meter
 func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user *auth.UserState, s *Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter, dlOpts *DownloadOptions) error {
 	if dlOpts == nil {
@@ -350,7 +353,9 @@ func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user
 			bucket := ratelimit.NewBucketWithRate(float64(limit), 2*limit)
 			limiter = ratelimitReader(resp.Body, bucket)
 		}
-		_, finalErr = io.Copy(mw, limiter)
+		var n int64
+		n, finalErr = io.Copy(mw, limiter)
+		downloadBytes.Add(float64(n))
 		pbar.Finished()
 		if finalErr != nil {
 			if httputil.ShouldRetryAttempt(attempt, finalErr) {
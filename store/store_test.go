@@ -48,6 +48,7 @@ import (
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics/metricstest"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
@@ -937,6 +938,40 @@ func (s *storeTestSuite) TestDoRequestSetsExtraHeaders(c *C) {
 	c.Check(string(responseData), Equals, "response-data")
 }
 
+func (s *storeTestSuite) TestDoRequestMetrics(c *C) {
+	fail := false
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(500)
+		}
+		io.WriteString(w, "response-data")
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	const requests = `snapd_store_request_seconds_count{endpoint="/v2/snaps/info"}`
+	const failures = `snapd_store_request_errors_total{endpoint="/v2/snaps/info"}`
+	requestsBefore := metricstest.Sample(c, requests)
+	failuresBefore := metricstest.Sample(c, failures)
+
+	sto := store.New(&store.Config{}, nil)
+	// the snap name is not part of the endpoint
+	endpoint, _ := url.Parse(mockServer.URL + "/v2/snaps/info/hello")
+	reqOptions := store.NewRequestOptions("GET", endpoint)
+
+	response, err := sto.DoRequest(s.ctx, sto.Client(), reqOptions, s.user)
+	c.Assert(err, IsNil)
+	response.Body.Close()
+
+	fail = true
+	response, err = sto.DoRequest(s.ctx, sto.Client(), reqOptions, s.user)
+	c.Assert(err, IsNil)
+	response.Body.Close()
+
+	c.Check(metricstest.Sample(c, requests), Equals, requestsBefore+2)
+	c.Check(metricstest.Sample(c, failures), Equals, failuresBefore+1)
+}
+
 func (s *storeTestSuite) TestLoginUser(c *C) {
 	macaroon, err := makeTestMacaroon()
 	c.Assert(err, IsNil)
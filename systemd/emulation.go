@@ -98,6 +98,10 @@ func (s *emulation) IsActive(service string) (bool, error) {
 	return false, errNotImplemented
 }
 
+func (s *emulation) RestartCounts(services ...string) (map[string]int, error) {
+	return nil, errNotImplemented
+}
+
 func (s *emulation) LogReader(services []string, n int, follow bool) (io.ReadCloser, error) {
 	return nil, errNotImplemented
 }
@@ -167,6 +171,29 @@ func (s *emulation) RemoveMountUnitFile(mountedDir string) error {
 	return nil
 }
 
+func (s *emulation) AddSwapUnitFile(what string) (string, error) {
+	swapUnitName, err := writeSwapUnitFile(s.rootDir, what)
+	if err != nil {
+		return "", err
+	}
+	// the swap file is activated on the next boot
+	if err := s.Enable(swapUnitName); err != nil {
+		return "", err
+	}
+	return swapUnitName, nil
+}
+
+func (s *emulation) RemoveSwapUnitFile(what string) error {
+	unit := swapUnitPathUnder(s.rootDir, what)
+	if !osutil.FileExists(unit) {
+		return nil
+	}
+	if err := s.Disable(filepath.Base(unit)); err != nil {
+		return err
+	}
+	return os.Remove(unit)
+}
+
 func (s *emulation) Mask(service string) error {
 	_, err := systemctlCmd("--root", s.rootDir, "mask", service)
 	return err
@@ -234,12 +234,22 @@ type Systemd interface {
 	IsEnabled(service string) (bool, error)
 	// IsActive checks whether the given service is Active
 	IsActive(service string) (bool, error)
+	// RestartCounts returns the number of times each of the given
+	// services was restarted by systemd since it was last started
+	// otherwise, by service name.
+	RestartCounts(services ...string) (map[string]int, error)
 	// LogReader returns a reader for the given services' log.
 	LogReader(services []string, n int, follow bool) (io.ReadCloser, error)
 	// AddMountUnitFile adds/enables/starts a mount unit.
 	AddMountUnitFile(name, revision, what, where, fstype string) (string, error)
 	// RemoveMountUnitFile unmounts/stops/disables/removes a mount unit.
 	RemoveMountUnitFile(baseDir string) error
+	// AddSwapUnitFile adds/enables/starts a swap unit for the given swap
+	// file.
+	AddSwapUnitFile(what string) (string, error)
+	// RemoveSwapUnitFile stops/disables/removes the swap unit of the given
+	// swap file.
+	RemoveSwapUnitFile(what string) error
 	// Mask the given service.
 	Mask(service string) error
 	// Unmask the given service.
@@ -579,6 +589,57 @@ func (s *systemd) IsActive(serviceName string) (bool, error) {
 	return false, err
 }
 
+// ErrNoRestartCount is returned by RestartCounts when systemd does not keep
+// count of the restarts of services, as before systemd 235.
+var ErrNoRestartCount = errors.New("systemd does not count the restarts of services")
+
+func (s *systemd) RestartCounts(serviceNames ...string) (map[string]int, error) {
+	if s.mode == GlobalUserMode {
+		panic("cannot call show with GlobalUserMode")
+	}
+	if len(serviceNames) == 0 {
+		return nil, nil
+	}
+	cmd := append([]string{"show", "--property=Id,NRestarts"}, serviceNames...)
+	out, err := s.systemctl(cmd...)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(serviceNames))
+	// systemctl separates the properties of each unit by an empty line
+	for _, unit := range strings.Split(strings.TrimSpace(string(out)), "\n\n") {
+		var id, restarts string
+		for _, line := range strings.Split(unit, "\n") {
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("cannot get restart counts: bad line %q in ‘systemctl show’ output", line)
+			}
+			switch kv[0] {
+			case "Id":
+				id = kv[1]
+			case "NRestarts":
+				restarts = kv[1]
+			}
+		}
+		// older systemd versions show nothing for unknown properties
+		if restarts == "" {
+			return nil, ErrNoRestartCount
+		}
+		n, err := strconv.Atoi(restarts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get restart count of %q: %v", id, err)
+		}
+		counts[id] = n
+	}
+	for _, name := range serviceNames {
+		if _, ok := counts[name]; !ok {
+			return nil, fmt.Errorf("cannot get restart count of %q: missing in ‘systemctl show’ output", name)
+		}
+	}
+	return counts, nil
+}
+
 func (s *systemd) Stop(serviceName string, timeout time.Duration) error {
 	if s.mode == GlobalUserMode {
 		panic("cannot call stop with GlobalUserMode")
@@ -867,6 +928,91 @@ func (s *systemd) RemoveMountUnitFile(mountedDir string) error {
 	return nil
 }
 
+// SwapUnitPath returns the path of the swap unit of the given swap file.
+func SwapUnitPath(what string) string {
+	return swapUnitPathUnder(dirs.GlobalRootDir, what)
+}
+
+func swapUnitPathUnder(rootDir, what string) string {
+	escapedPath := EscapeUnitNamePath(what)
+	return filepath.Join(rootDir, "/etc/systemd/system", escapedPath+".swap")
+}
+
+var swapUnitTemplate = `[Unit]
+Description=Swap file managed by snapd
+Before=snapd.service
+
+[Swap]
+What=%s
+
+[Install]
+WantedBy=swap.target
+`
+
+func writeSwapUnitFile(rootDir, what string) (swapUnitName string, err error) {
+	su := swapUnitPathUnder(rootDir, what)
+	if err := os.MkdirAll(filepath.Dir(su), 0755); err != nil {
+		return "", err
+	}
+	content := fmt.Sprintf(swapUnitTemplate, what)
+	if err := osutil.AtomicWriteFile(su, []byte(content), 0644, 0); err != nil {
+		return "", err
+	}
+	return filepath.Base(su), nil
+}
+
+func (s *systemd) AddSwapUnitFile(what string) (string, error) {
+	daemonReloadLock.Lock()
+	defer daemonReloadLock.Unlock()
+
+	swapUnitName, err := writeSwapUnitFile(dirs.GlobalRootDir, what)
+	if err != nil {
+		return "", err
+	}
+
+	// make sure that systemd knows about the new or changed swap unit
+	if err := s.daemonReloadNoLock(); err != nil {
+		return "", err
+	}
+
+	if err := s.Enable(swapUnitName); err != nil {
+		return "", err
+	}
+	if err := s.Start(swapUnitName); err != nil {
+		return "", err
+	}
+
+	return swapUnitName, nil
+}
+
+func (s *systemd) RemoveSwapUnitFile(what string) error {
+	daemonReloadLock.Lock()
+	defer daemonReloadLock.Unlock()
+
+	unit := SwapUnitPath(what)
+	if !osutil.FileExists(unit) {
+		return nil
+	}
+
+	// stopping the unit disables the swap file
+	if err := s.Stop(filepath.Base(unit), 5*time.Minute); err != nil {
+		return err
+	}
+	if err := s.Disable(filepath.Base(unit)); err != nil {
+		return err
+	}
+	if err := os.Remove(unit); err != nil {
+		return err
+	}
+	// daemon-reload to ensure that systemd actually really
+	// forgets about this swap unit
+	if err := s.daemonReloadNoLock(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *systemd) ReloadOrRestart(serviceName string) error {
 	if s.mode == GlobalUserMode {
 		panic("cannot call restart with GlobalUserMode")
@@ -787,6 +787,46 @@ func (s *SystemdTestSuite) TestIsActiveIsActive(c *C) {
 	c.Check(s.argses, DeepEquals, [][]string{{"--root", "xyzzy", "is-active", "foo"}})
 }
 
+func (s *SystemdTestSuite) TestRestartCounts(c *C) {
+	s.outs = [][]byte{[]byte("Id=foo.service\nNRestarts=7\n\nId=bar.service\nNRestarts=0\n")}
+
+	counts, err := New("xyzzy", SystemMode, s.rep).RestartCounts("foo.service", "bar.service")
+	c.Assert(err, IsNil)
+	c.Check(counts, DeepEquals, map[string]int{"foo.service": 7, "bar.service": 0})
+	c.Check(s.argses, DeepEquals, [][]string{{"show", "--property=Id,NRestarts", "foo.service", "bar.service"}})
+}
+
+func (s *SystemdTestSuite) TestRestartCountsNone(c *C) {
+	counts, err := New("xyzzy", SystemMode, s.rep).RestartCounts()
+	c.Assert(err, IsNil)
+	c.Check(counts, HasLen, 0)
+	c.Check(s.argses, HasLen, 0)
+}
+
+func (s *SystemdTestSuite) TestRestartCountsUnsupported(c *C) {
+	for _, out := range []string{"Id=foo.service\n", "Id=foo.service\nNRestarts=\n"} {
+		s.outs = [][]byte{[]byte(out)}
+		s.i = 0
+
+		_, err := New("xyzzy", SystemMode, s.rep).RestartCounts("foo.service")
+		c.Check(err, Equals, ErrNoRestartCount, Commentf("%q", out))
+	}
+}
+
+func (s *SystemdTestSuite) TestRestartCountsBad(c *C) {
+	for out, msg := range map[string]string{
+		"Id=foo.service\nNRestarts=lots\n": `cannot get restart count of "foo.service": strconv.Atoi: parsing "lots": invalid syntax`,
+		"Id=foo.service\nwhat\n":           `cannot get restart counts: bad line "what" in ‘systemctl show’ output`,
+		"Id=other.service\nNRestarts=1\n":  `cannot get restart count of "foo.service": missing in ‘systemctl show’ output`,
+	} {
+		s.outs = [][]byte{[]byte(out)}
+		s.i = 0
+
+		_, err := New("xyzzy", SystemMode, s.rep).RestartCounts("foo.service")
+		c.Check(err, ErrorMatches, msg, Commentf("%q", out))
+	}
+}
+
 func (s *SystemdTestSuite) TestIsActiveUnexpectedErr(c *C) {
 	sysErr := &Error{}
 	sysErr.SetExitCode(1)
@@ -826,6 +866,62 @@ func (s *SystemdTestSuite) TestRemoveMountUnit(c *C) {
 	})
 }
 
+func (s *SystemdTestSuite) TestAddSwapUnit(c *C) {
+	rootDir := dirs.GlobalRootDir
+
+	swapUnitName, err := New(rootDir, SystemMode, nil).AddSwapUnitFile("/var/lib/snapd/swap/swapfile")
+	c.Assert(err, IsNil)
+	c.Check(swapUnitName, Equals, "var-lib-snapd-swap-swapfile.swap")
+
+	c.Assert(filepath.Join(dirs.SnapServicesDir, swapUnitName), testutil.FileEquals, `[Unit]
+Description=Swap file managed by snapd
+Before=snapd.service
+
+[Swap]
+What=/var/lib/snapd/swap/swapfile
+
+[Install]
+WantedBy=swap.target
+`)
+	c.Check(SwapUnitPath("/var/lib/snapd/swap/swapfile"), Equals, filepath.Join(dirs.SnapServicesDir, swapUnitName))
+
+	c.Assert(s.argses, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"--root", rootDir, "enable", "var-lib-snapd-swap-swapfile.swap"},
+		{"start", "var-lib-snapd-swap-swapfile.swap"},
+	})
+}
+
+func (s *SystemdTestSuite) TestRemoveSwapUnit(c *C) {
+	rootDir := dirs.GlobalRootDir
+	restore := MockStopDelays(time.Millisecond, 25*time.Second)
+	defer restore()
+
+	swapUnit := SwapUnitPath("/var/lib/snapd/swap/swapfile")
+	makeMockFile(c, swapUnit)
+
+	s.outs = [][]byte{
+		nil, // for the "stop" itself
+		[]byte("ActiveState=inactive\n"),
+	}
+	err := New(rootDir, SystemMode, s.rep).RemoveSwapUnitFile("/var/lib/snapd/swap/swapfile")
+	c.Assert(err, IsNil)
+
+	c.Check(swapUnit, testutil.FileAbsent)
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"stop", "var-lib-snapd-swap-swapfile.swap"},
+		{"show", "--property=ActiveState", "var-lib-snapd-swap-swapfile.swap"},
+		{"--root", rootDir, "disable", "var-lib-snapd-swap-swapfile.swap"},
+		{"daemon-reload"},
+	})
+
+	// nothing happens when there is no unit
+	s.argses = nil
+	err = New(rootDir, SystemMode, s.rep).RemoveSwapUnitFile("/var/lib/snapd/swap/swapfile")
+	c.Assert(err, IsNil)
+	c.Check(s.argses, HasLen, 0)
+}
+
 func (s *SystemdTestSuite) TestDaemonReloadMutex(c *C) {
 	s.testDaemonReloadMutex(c, Systemd.DaemonReload)
 }
@@ -1052,6 +1148,27 @@ func (s *SystemdTestSuite) TestPreseedModeBindmountNotSupported(c *C) {
 	c.Assert(err, ErrorMatches, `bind-mounted directory is not supported in emulation mode`)
 }
 
+func (s *SystemdTestSuite) TestPreseedModeAddAndRemoveSwapUnit(c *C) {
+	rootDir := c.MkDir()
+	sysd := NewEmulationMode(rootDir)
+
+	swapUnitName, err := sysd.AddSwapUnitFile("/var/lib/snapd/swap/swapfile")
+	c.Assert(err, IsNil)
+	swapUnit := filepath.Join(rootDir, "/etc/systemd/system", swapUnitName)
+	c.Check(swapUnit, testutil.FileContains, "What=/var/lib/snapd/swap/swapfile\n")
+	// the unit is enabled but not started
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"--root", rootDir, "enable", "var-lib-snapd-swap-swapfile.swap"},
+	})
+
+	s.argses = nil
+	c.Assert(sysd.RemoveSwapUnitFile("/var/lib/snapd/swap/swapfile"), IsNil)
+	c.Check(swapUnit, testutil.FileAbsent)
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"--root", rootDir, "disable", "var-lib-snapd-swap-swapfile.swap"},
+	})
+}
+
 func (s *SystemdTestSuite) TestEnableInEmulationMode(c *C) {
 	sysd := NewEmulationMode("/path")
 	c.Assert(sysd.Enable("foo"), IsNil)
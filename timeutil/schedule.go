@@ -901,3 +901,63 @@ func Includes(schedule []*Schedule, t time.Time) bool {
 	}
 	return false
 }
+
+// windowStartAfter returns the start of the earliest window of the schedule
+// that starts at or after t, looking at most a year ahead. It returns the zero
+// time if there is no such window.
+func (sched *Schedule) windowStartAfter(t time.Time) time.Time {
+	tspans := sched.flattenedClockSpans()
+	limit := t.AddDate(1, 0, 0)
+
+	for day := t; day.Before(limit); day = day.Add(24 * time.Hour) {
+		if len(sched.WeekSpans) > 0 {
+			var weekMatch bool
+			for _, week := range sched.WeekSpans {
+				if week.Match(day) {
+					weekMatch = true
+					break
+				}
+			}
+			if !weekMatch {
+				continue
+			}
+		}
+
+		var start time.Time
+		for _, tspan := range tspans {
+			window := tspan.Window(day)
+			if window.Start.Before(t) {
+				continue
+			}
+			if start.IsZero() || window.Start.Before(start) {
+				start = window.Start
+			}
+		}
+		if !start.IsZero() {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// WindowStart returns t if it falls inside the time range covered by the
+// schedule, otherwise it returns the start of the earliest window of the
+// schedule after t. The zero time is returned if no window opens within a
+// year from t.
+func WindowStart(schedule []*Schedule, t time.Time) time.Time {
+	if Includes(schedule, t) {
+		return t
+	}
+
+	var start time.Time
+	for _, sched := range schedule {
+		s := sched.windowStartAfter(t)
+		if s.IsZero() {
+			continue
+		}
+		if start.IsZero() || s.Before(start) {
+			start = s
+		}
+	}
+	return start
+}
@@ -1264,3 +1264,61 @@ func (ts *timeutilSuite) TestMonthNext(c *C) {
 	}
 
 }
+
+func (ts *timeutilSuite) TestWindowStart(c *C) {
+	const shortForm = "2006-01-02 15:04:05"
+
+	for _, t := range []struct {
+		schedule  string
+		now       string
+		expecting string
+	}{
+		{
+			// already inside the window
+			schedule:  "02:00-04:00",
+			now:       "2017-02-06 03:00:00",
+			expecting: "2017-02-06 03:00:00",
+		}, {
+			schedule:  "02:00-04:00",
+			now:       "2017-02-06 01:00:00",
+			expecting: "2017-02-06 02:00:00",
+		}, {
+			// window already closed today
+			schedule:  "02:00-04:00",
+			now:       "2017-02-06 12:00:00",
+			expecting: "2017-02-07 02:00:00",
+		}, {
+			schedule:  "02:00-04:00,06:00-08:00",
+			now:       "2017-02-06 05:00:00",
+			expecting: "2017-02-06 06:00:00",
+		}, {
+			// Mon 2017-02-06, next friday
+			schedule:  "fri,23:00-01:00",
+			now:       "2017-02-06 12:00:00",
+			expecting: "2017-02-10 23:00:00",
+		}, {
+			// earliest of multiple schedules
+			schedule:  "fri,10:00,,tue,10:00",
+			now:       "2017-02-06 12:00:00",
+			expecting: "2017-02-07 10:00:00",
+		}, {
+			// first monday of the next month
+			schedule:  "mon1,10:00-11:00",
+			now:       "2017-02-06 12:00:00",
+			expecting: "2017-03-06 10:00:00",
+		},
+	} {
+		c.Logf("trying %+v", t)
+
+		now, err := time.ParseInLocation(shortForm, t.now, time.Local)
+		c.Assert(err, IsNil)
+		expecting, err := time.ParseInLocation(shortForm, t.expecting, time.Local)
+		c.Assert(err, IsNil)
+
+		sched, err := timeutil.ParseSchedule(t.schedule)
+		c.Assert(err, IsNil)
+
+		c.Check(timeutil.WindowStart(sched, now).Equal(expecting), Equals, true,
+			Commentf("unexpected window start %v for schedule %v and time %v", timeutil.WindowStart(sched, now), t.schedule, now))
+	}
+}